@@ -0,0 +1,204 @@
+#!/bin/bash
+
+# Download Path Load Test Script
+# Times package file downloads through a running groxpi in each cache state:
+# cold miss, warm cache and many clients fetching the same uncached file
+# Usage: ./download_path_test.sh <groxpi_url> <timestamp> [test_scenario]
+
+set -euo pipefail
+
+# Configuration
+GROXPI_URL="${1:-}"
+TIMESTAMP="${2:-}"
+TEST_SCENARIO="${3:-all}"
+
+# Load Configuration
+WARM_REQUESTS="${WARM_REQUESTS:-20}"
+CONCURRENCY="${CONCURRENCY:-16}"
+REQUEST_TIMEOUT="${REQUEST_TIMEOUT:-600}"
+
+# Test files as package/filename - a small wheel and a large one
+TEST_FILES=(${TEST_FILES:-"six/six-1.16.0-py2.py3-none-any.whl" "pandas/pandas-2.2.2-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl"})
+
+# Colors for output
+RED='\033[0;31m'
+GREEN='\033[0;32m'
+YELLOW='\033[1;33m'
+BLUE='\033[0;34m'
+NC='\033[0m' # No Color
+
+# Function to print colored output
+log_info() { echo -e "${BLUE}[INFO]${NC} $1"; }
+log_success() { echo -e "${GREEN}[SUCCESS]${NC} $1"; }
+log_warning() { echo -e "${YELLOW}[WARNING]${NC} $1"; }
+log_error() { echo -e "${RED}[ERROR]${NC} $1"; }
+
+# Function to show usage
+show_usage() {
+    echo "Usage: $0 <groxpi_url> <timestamp> [test_scenario]"
+    echo ""
+    echo "Parameters:"
+    echo "  groxpi_url     - groxpi server URL (e.g., http://server1:5005)"
+    echo "  timestamp      - Consistent timestamp for file naming (e.g., 20240101_120000)"
+    echo "  test_scenario  - Test scenario to run (default: all)"
+    echo ""
+    echo "Test Scenarios:"
+    echo "  all                  - Run all test scenarios"
+    echo "  cold-miss            - Download each file with its package purged from the cache"
+    echo "  warm                 - Download each cached file WARM_REQUESTS times"
+    echo "  concurrent-same-file - CONCURRENCY clients download the same uncached file at once"
+    echo ""
+    echo "Environment:"
+    echo "  TEST_FILES       - Space-separated package/filename list (default: ${TEST_FILES[*]})"
+    echo "  WARM_REQUESTS    - Downloads per file in the warm scenario (default: 20)"
+    echo "  CONCURRENCY      - Clients in the concurrent scenario (default: 16)"
+    echo "  REQUEST_TIMEOUT  - Seconds a single download may take (default: 600)"
+    echo ""
+    echo "Examples:"
+    echo "  $0 http://server1:5005 20240101_120000"
+    echo "  CONCURRENCY=64 $0 http://server1:5005 20240101_120000 concurrent-same-file"
+}
+
+# Function to validate inputs
+validate_inputs() {
+    if [ -z "$GROXPI_URL" ] || [ -z "$TIMESTAMP" ]; then
+        show_usage
+        exit 1
+    fi
+
+    # Remove trailing slashes
+    GROXPI_URL="${GROXPI_URL%/}"
+
+    # Validate timestamp format (YYYYMMDD_HHMMSS)
+    if [[ ! $TIMESTAMP =~ ^[0-9]{8}_[0-9]{6}$ ]]; then
+        log_error "Invalid timestamp format. Expected: YYYYMMDD_HHMMSS (e.g., 20240101_120000)"
+        exit 1
+    fi
+}
+
+# Function to purge a package's cached files
+purge_package() {
+    local package=$1
+
+    if ! curl -sf --max-time 30 -X DELETE "$GROXPI_URL/cache/$package?purge=hard" >/dev/null; then
+        log_warning "  Failed to purge $package from the cache"
+    fi
+}
+
+# Function to download one file and append a CSV row with its timings
+download_file() {
+    local scenario=$1
+    local file=$2
+    local request=$3
+    local csv_file=$4
+
+    local metrics
+    metrics=$(curl -s -o /dev/null --max-time "$REQUEST_TIMEOUT" \
+        -w "%{http_code},%{size_download},%{time_starttransfer},%{time_total},%{speed_download}" \
+        "$GROXPI_URL/simple/$file" 2>/dev/null || echo "000,0,0,0,0")
+
+    echo "$scenario,$file,$request,$metrics" >> "$csv_file"
+}
+
+# Function to summarize a scenario's rows
+summarize() {
+    local scenario=$1
+    local csv_file=$2
+
+    awk -F',' -v scenario="$scenario" '
+        $1 == scenario {
+            n++; bytes += $5; total += $7
+            if ($4 != 200) failed++
+            if ($7 > max) max = $7
+        }
+        END {
+            if (n == 0) exit
+            printf "  %d requests, %d failed, mean %.3fs, max %.3fs, %.1f MB/s\n",
+                n, failed, total / n, max, (total > 0 ? bytes / total / 1048576 : 0)
+        }' "$csv_file"
+}
+
+# Cold miss: every download goes upstream
+run_cold_miss() {
+    local csv_file=$1
+
+    log_info "Cold miss: ${#TEST_FILES[@]} files"
+    for file in "${TEST_FILES[@]}"; do
+        purge_package "${file%%/*}"
+        download_file "cold-miss" "$file" 1 "$csv_file"
+    done
+    summarize "cold-miss" "$csv_file"
+}
+
+# Warm: every download is served from the cache
+run_warm() {
+    local csv_file=$1
+
+    log_info "Warm cache: $WARM_REQUESTS downloads per file"
+    for file in "${TEST_FILES[@]}"; do
+        # Make sure the file is cached before timing
+        curl -s -o /dev/null --max-time "$REQUEST_TIMEOUT" "$GROXPI_URL/simple/$file" || true
+        for request in $(seq 1 "$WARM_REQUESTS"); do
+            download_file "warm" "$file" "$request" "$csv_file"
+        done
+    done
+    summarize "warm" "$csv_file"
+}
+
+# Concurrent same file: one upstream download shared by every client
+run_concurrent_same_file() {
+    local csv_file=$1
+
+    log_info "Concurrent same file: $CONCURRENCY clients per file"
+    for file in "${TEST_FILES[@]}"; do
+        purge_package "${file%%/*}"
+
+        local start_time=$(date +%s.%N)
+        for request in $(seq 1 "$CONCURRENCY"); do
+            download_file "concurrent-same-file" "$file" "$request" "$csv_file" &
+        done
+        wait
+        local end_time=$(date +%s.%N)
+
+        log_info "  $file: all clients done in $(echo "$end_time - $start_time" | bc -l 2>/dev/null || echo "N/A")s"
+    done
+    summarize "concurrent-same-file" "$csv_file"
+}
+
+main() {
+    if [ "${1:-}" = "-h" ] || [ "${1:-}" = "--help" ]; then
+        show_usage
+        exit 0
+    fi
+    validate_inputs
+
+    if ! curl -sf --connect-timeout 5 --max-time 10 "$GROXPI_URL/health" >/dev/null 2>&1; then
+        log_error "groxpi is not reachable ($GROXPI_URL)"
+        exit 1
+    fi
+
+    local results_dir="$(dirname "$0")/../results"
+    mkdir -p "$results_dir"
+    local csv_file="$results_dir/download-path-${TIMESTAMP}.csv"
+    echo "scenario,file,request,http_code,size_bytes,time_starttransfer,time_total,speed_bytes_per_sec" > "$csv_file"
+
+    case "$TEST_SCENARIO" in
+        all)
+            run_cold_miss "$csv_file"
+            run_warm "$csv_file"
+            run_concurrent_same_file "$csv_file"
+            ;;
+        cold-miss) run_cold_miss "$csv_file" ;;
+        warm) run_warm "$csv_file" ;;
+        concurrent-same-file) run_concurrent_same_file "$csv_file" ;;
+        *)
+            log_error "Unknown test scenario: $TEST_SCENARIO"
+            show_usage
+            exit 1
+            ;;
+    esac
+
+    log_success "Results written to $csv_file"
+}
+
+main "$@"
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/huyhandes/groxpi/internal/bundle"
+	"github.com/huyhandes/groxpi/internal/config"
+	"github.com/huyhandes/groxpi/internal/server"
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// runBundleCommand implements the "export" and "import" subcommands used to
+// seed air-gapped instances directly from/to the configured storage
+func runBundleCommand(cfg *config.Config, name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	output := fs.String("o", "", "bundle file to write (export)")
+	overwrite := fs.Bool("overwrite", false, "replace files that already exist (import)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n  groxpi export -o bundle.tar <package>...\n  groxpi import [-overwrite] [bundle.tar]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keys, err := storage.NewKeyLayout(cfg.StorageKeyTemplate)
+	if err != nil {
+		return err
+	}
+
+	store, err := server.OpenStorage(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %w", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	ctx := context.Background()
+
+	switch name {
+	case "export":
+		packages := make([]string, 0, fs.NArg())
+		for _, pkg := range fs.Args() {
+			packages = append(packages, strings.ReplaceAll(strings.ToLower(pkg), "_", "-"))
+		}
+
+		// Logs go to stdout, so the bundle always needs its own file
+		if *output == "" {
+			fs.Usage()
+			return fmt.Errorf("export requires -o")
+		}
+
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+
+		manifest, err := bundle.Export(ctx, store, keys, packages, f)
+		if err != nil {
+			_ = os.Remove(*output)
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d files from %d packages\n", len(manifest.Files), len(packages))
+
+	case "import":
+		var r io.Reader = os.Stdin
+		if fs.NArg() > 0 && fs.Arg(0) != "-" {
+			f, err := os.Open(fs.Arg(0))
+			if err != nil {
+				return err
+			}
+			defer func() { _ = f.Close() }()
+			r = f
+		}
+
+		result, err := bundle.Import(ctx, store, keys, r, *overwrite)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Imported %d files (%s), skipped %d already cached\n",
+			result.Imported, FormatBytes(result.Bytes), result.Skipped)
+	}
+
+	return nil
+}
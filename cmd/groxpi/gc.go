@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/phuslu/log"
+
+	"github.com/huyhandes/groxpi/internal/config"
+	"github.com/huyhandes/groxpi/internal/gc"
+	"github.com/huyhandes/groxpi/internal/retention"
+	"github.com/huyhandes/groxpi/internal/server"
+)
+
+// runGCCommand implements the "gc" subcommand, which deletes stale cached
+// files and partial writes directly from the configured storage
+func runGCCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	maxAge := fs.Duration("max-age", cfg.GCMaxAge, "delete files not accessed for longer than this")
+	tempMaxAge := fs.Duration("temp-max-age", cfg.GCTempMaxAge, "delete partial writes older than this")
+	dryRun := fs.Bool("dry-run", false, "report what would be deleted without deleting")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := server.OpenStorage(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %w", err)
+	}
+
+	// Access times come from the metadata database when the server isn't
+	// holding it open; otherwise from file modification times
+	metadataDB, err := server.OpenCatalog(cfg, store)
+	if err != nil {
+		log.Warn().Err(err).Msg("Metadata database unavailable, using file modification times")
+	}
+	defer func() {
+		_ = store.Close()
+		if metadataDB != nil {
+			_ = metadataDB.Close()
+		}
+	}()
+
+	report, err := gc.Run(context.Background(), store, gc.Options{
+		MaxAge:     *maxAge,
+		TempMaxAge: *tempMaxAge,
+		DryRun:     *dryRun,
+		Retention:  retention.New(cfg.RetentionKeepVersions, cfg.RetentionRules),
+	})
+	if err != nil {
+		return err
+	}
+
+	verb := "Deleted"
+	if report.DryRun {
+		verb = "Would delete"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d of %d files (%s, %d of them superseded) and %d partial writes (%s)\n",
+		verb, report.Deleted, report.Scanned, FormatBytes(report.ReclaimedBytes), report.Superseded,
+		report.TempDeleted, FormatBytes(report.TempBytes))
+
+	return nil
+}
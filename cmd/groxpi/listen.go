@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// sdListenFDsStart is the first file descriptor passed by systemd socket activation
+const sdListenFDsStart = 3
+
+// listenSpec describes a single address the HTTP server listens on
+type listenSpec struct {
+	Network string // "tcp", "tcp4", "tcp6" or "unix"
+	Address string
+}
+
+func (l listenSpec) String() string {
+	if l.Network == "unix" {
+		return "unix:" + l.Address
+	}
+	return l.Address
+}
+
+// parseListenAddr parses a GROXPI_LISTEN entry.
+// Accepted forms: ":5000", "0.0.0.0:5000", "[::]:5000", "host:5000" and "unix:/path/to.sock".
+// IP literals bind to their own address family so "0.0.0.0:5000" and "[::]:5000"
+// can be used together without the IPv6 socket claiming the IPv4 port.
+func parseListenAddr(addr string) (listenSpec, error) {
+	addr = strings.TrimSpace(addr)
+
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if path == "" {
+			return listenSpec{}, fmt.Errorf("empty unix socket path in %q", addr)
+		}
+		return listenSpec{Network: "unix", Address: path}, nil
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return listenSpec{}, fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	if port == "" {
+		return listenSpec{}, fmt.Errorf("missing port in listen address %q", addr)
+	}
+
+	network := "tcp"
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() != nil {
+			network = "tcp4"
+		} else {
+			network = "tcp6"
+		}
+	}
+
+	return listenSpec{Network: network, Address: addr}, nil
+}
+
+// openListeners opens every configured address, closing any already-opened
+// listeners if one of them fails. Unix sockets are created with socketMode.
+func openListeners(addrs []string, socketMode os.FileMode) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(addrs))
+
+	for _, addr := range addrs {
+		spec, err := parseListenAddr(addr)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+
+		var ln net.Listener
+		if spec.Network == "unix" {
+			ln, err = listenUnix(spec.Address, socketMode)
+		} else {
+			ln, err = net.Listen(spec.Network, spec.Address)
+		}
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("failed to listen on %s: %w", spec, err)
+		}
+		listeners = append(listeners, ln)
+	}
+
+	return listeners, nil
+}
+
+// listenUnix listens on a Unix domain socket, replacing a stale socket file
+// left behind by a previous process and applying the requested permissions
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			_ = ln.Close()
+			return nil, fmt.Errorf("failed to chmod socket %s: %w", path, err)
+		}
+	}
+
+	return ln, nil
+}
+
+// removeStaleSocket deletes path if it is a socket nobody is accepting on.
+// Regular files and live sockets are left alone so we never clobber them.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("socket %s is already in use", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("failed to probe socket %s: %w", path, err)
+	}
+
+	return os.Remove(path)
+}
+
+// systemdListeners returns listeners passed via systemd socket activation
+// (LISTEN_PID/LISTEN_FDS), or nil when the process was not socket-activated.
+// The activation variables are cleared so child processes don't inherit them.
+func systemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		fd := sdListenFDsStart + i
+		syscall.CloseOnExec(fd)
+
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		file := os.NewFile(uintptr(fd), name)
+		ln, err := net.FileListener(file)
+		_ = file.Close() // FileListener dups the descriptor
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("failed to use activated socket %s: %w", name, err)
+		}
+		listeners = append(listeners, ln)
+	}
+
+	return listeners, nil
+}
+
+// closeListeners closes all listeners, ignoring errors
+func closeListeners(listeners []net.Listener) {
+	for _, ln := range listeners {
+		_ = ln.Close()
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestParseListenAddr(t *testing.T) {
+	testCases := []struct {
+		addr    string
+		network string
+		address string
+		wantErr bool
+	}{
+		{":5000", "tcp", ":5000", false},
+		{"0.0.0.0:5000", "tcp4", "0.0.0.0:5000", false},
+		{"[::]:5000", "tcp6", "[::]:5000", false},
+		{"[::1]:8080", "tcp6", "[::1]:8080", false},
+		{"localhost:5000", "tcp", "localhost:5000", false},
+		{" 127.0.0.1:5000 ", "tcp4", "127.0.0.1:5000", false},
+		{"unix:/run/groxpi.sock", "unix", "/run/groxpi.sock", false},
+		{"unix:", "", "", true},
+		{"5000", "", "", true},
+		{"127.0.0.1:", "", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.addr, func(t *testing.T) {
+			spec, err := parseListenAddr(tc.addr)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for %q, got %+v", tc.addr, spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if spec.Network != tc.network || spec.Address != tc.address {
+				t.Errorf("parseListenAddr(%q) = %s/%s, expected %s/%s", tc.addr, spec.Network, spec.Address, tc.network, tc.address)
+			}
+		})
+	}
+}
+
+func TestOpenListeners(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "groxpi.sock")
+
+	listeners, err := openListeners([]string{"127.0.0.1:0", "unix:" + sock}, 0600)
+	if err != nil {
+		t.Fatalf("openListeners failed: %v", err)
+	}
+	defer closeListeners(listeners)
+
+	if len(listeners) != 2 {
+		t.Fatalf("Expected 2 listeners, got %d", len(listeners))
+	}
+	if listeners[1].Addr().Network() != "unix" {
+		t.Errorf("Expected unix listener, got %s", listeners[1].Addr().Network())
+	}
+
+	info, err := os.Stat(sock)
+	if err != nil {
+		t.Fatalf("Failed to stat socket: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected socket mode 0600, got %o", info.Mode().Perm())
+	}
+
+	// A bad entry must not leak the listeners opened before it
+	if _, err := openListeners([]string{"127.0.0.1:0", "bogus"}, 0600); err == nil {
+		t.Error("Expected error for invalid address")
+	}
+}
+
+func TestListenUnix_StaleSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "stale.sock")
+
+	// Leave a socket file behind without anyone accepting on it
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: sock, Net: "unix"})
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	stale.SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	ln, err := listenUnix(sock, 0660)
+	if err != nil {
+		t.Fatalf("Expected stale socket to be replaced, got: %v", err)
+	}
+
+	// A live socket must not be taken over
+	if _, err := listenUnix(sock, 0660); err == nil {
+		t.Error("Expected error when socket is in use")
+	}
+	_ = ln.Close()
+
+	// Regular files are never removed
+	file := filepath.Join(t.TempDir(), "regular")
+	if err := os.WriteFile(file, []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := listenUnix(file, 0660); err == nil {
+		t.Error("Expected error when path is a regular file")
+	}
+}
+
+func TestSystemdListeners_NotActivated(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+
+	listeners, err := systemdListeners()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if listeners != nil {
+		t.Errorf("Expected no listeners for a different LISTEN_PID, got %d", len(listeners))
+	}
+}
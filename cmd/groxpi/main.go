@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,11 +12,19 @@ import (
 
 	"github.com/huyhandes/groxpi/internal/config"
 	"github.com/huyhandes/groxpi/internal/logger"
+	"github.com/huyhandes/groxpi/internal/memlimit"
 	"github.com/huyhandes/groxpi/internal/server"
+	"github.com/huyhandes/groxpi/internal/version"
 	"github.com/phuslu/log"
 )
 
 func main() {
+	// Build details don't need configuration or logging
+	if len(os.Args) > 1 && (os.Args[1] == "--version" || os.Args[1] == "version") {
+		printVersion(os.Stdout)
+		return
+	}
+
 	// Load configuration
 	cfg := config.Load()
 
@@ -24,7 +33,25 @@ func main() {
 		Level:  cfg.LogLevel,
 		Format: cfg.LogFormat,
 		Color:  cfg.LogColor,
+		File: logger.FileConfig{
+			Path:           cfg.LogFile,
+			MaxSize:        cfg.LogFileMaxSize,
+			RotateInterval: cfg.LogFileRotateInterval,
+			MaxBackups:     cfg.LogFileMaxBackups,
+			Compress:       cfg.LogFileCompress,
+		},
+		Syslog: logger.SyslogConfig{
+			Address:  cfg.LogSyslog,
+			Tag:      cfg.LogSyslogTag,
+			Facility: cfg.LogSyslogFacility,
+		},
+		Journald: cfg.LogJournald,
+		NoStdout: !cfg.LogStdout,
+
+		Modules:     cfg.LogLevels,
+		DebugSample: cfg.LogDebugSample,
 	})
+	defer func() { _ = logger.Close() }()
 
 	// Test debug logging immediately after logger init
 	log.Debug().
@@ -33,12 +60,26 @@ func main() {
 		Bool("log_color", cfg.LogColor).
 		Msg("🔧 Logger initialized and debug logging is working")
 
+	// Applies to subcommands too: an export or import can be as heavy as serving
+	memlimit.Apply(cfg.MemoryLimit, cfg.GCPercent)
+
+	// Offline maintenance subcommands operate on storage and exit
+	if len(os.Args) > 1 {
+		if handled, err := runCommand(cfg, os.Args[1], os.Args[2:]); handled {
+			if err != nil {
+				log.Fatal().Err(err).Str("command", os.Args[1]).Msg("Command failed")
+			}
+			return
+		}
+	}
+
 	// Log startup info
 	log.Info().
-		Str("version", "1.0.0").
+		Str("version", version.Get()).
 		Str("storage_type", cfg.StorageType).
 		Str("log_level", cfg.LogLevel).
 		Str("log_format", cfg.LogFormat).
+		Strs("features", cfg.Features.List()).
 		Msg("🚀 Starting groxpi server")
 
 	// Log configuration
@@ -48,6 +89,7 @@ func main() {
 		Str("cache_size_human", FormatBytes(cfg.CacheSize)).
 		Dur("index_ttl", cfg.IndexTTL).
 		Str("port", cfg.Port).
+		Strs("listen", cfg.ListenAddrs).
 		Msg("📋 Configuration loaded")
 
 	// Log storage configuration
@@ -59,6 +101,15 @@ func main() {
 			Str("region", cfg.S3Region).
 			Bool("ssl", cfg.S3UseSSL).
 			Msg("☁️  S3 storage configured")
+	} else if cfg.StorageType == "webdav" {
+		log.Info().
+			Str("url", cfg.WebDAVURL).
+			Str("username", cfg.WebDAVUsername).
+			Msg("🗄️  WebDAV storage configured")
+	} else if cfg.StorageType == "memory" {
+		log.Info().
+			Int64("cache_size_bytes", cfg.CacheSize).
+			Msg("🧠 In-memory storage configured, nothing is kept across restarts")
 	} else {
 		log.Info().
 			Str("cache_dir", cfg.CacheDir).
@@ -67,24 +118,63 @@ func main() {
 
 	// Create server
 	srv := server.New(cfg)
-	router := srv.Router()
 
-	// Create HTTP server
-	httpServer := &http.Server{
-		Addr:    ":" + cfg.Port,
-		Handler: router,
+	// Prefer sockets handed over by systemd; otherwise open all configured
+	// listeners before serving so bad addresses fail fast
+	listeners, err := systemdListeners()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to use systemd socket activation")
+	}
+	if len(listeners) > 0 {
+		log.Info().Int("count", len(listeners)).Msg("🔌 Using systemd-activated sockets")
+	} else {
+		listeners, err = openListeners(cfg.ListenAddrs, cfg.UnixSocketMode)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to open listeners")
+		}
 	}
 
-	// Start server in goroutine
-	go func() {
-		log.Info().
-			Str("address", ":"+cfg.Port).
-			Msg("🌐 HTTP server starting")
+	// Create HTTP server
+	httpServer := srv.HTTPServer()
+	log.Info().
+		Bool("uv_compat", cfg.UVCompat).
+		Dur("keepalive_timeout", cfg.KeepAliveTimeout).
+		Int("max_concurrent_streams", cfg.MaxConcurrentStreams).
+		Bool("tls", cfg.TLSCertFile != "").
+		Bool("h2c", cfg.H2C).
+		Bool("http3", cfg.HTTP3).
+		Msg("🔗 Client connection tuning")
+
+	// Start one serve loop per listener
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			log.Info().
+				Str("network", ln.Addr().Network()).
+				Str("address", ln.Addr().String()).
+				Msg("🌐 HTTP server starting")
+
+			var err error
+			if cfg.TLSCertFile != "" {
+				err = httpServer.ServeTLS(ln, cfg.TLSCertFile, cfg.TLSKeyFile)
+			} else {
+				err = httpServer.Serve(ln)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				log.Fatal().Err(err).Str("address", ln.Addr().String()).Msg("Failed to start server")
+			}
+		}(ln)
+	}
 
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal().Err(err).Msg("Failed to start server")
-		}
-	}()
+	// HTTP/3 listens on UDP next to the TCP listeners
+	h3Server := srv.HTTP3Server()
+	if h3Server != nil {
+		go func() {
+			log.Info().Str("address", h3Server.Addr).Msg("🌐 HTTP/3 server starting")
+			if err := h3Server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile); err != nil && err != http.ErrServerClosed {
+				log.Fatal().Err(err).Str("address", h3Server.Addr).Msg("Failed to start HTTP/3 server")
+			}
+		}()
+	}
 
 	// Wait for interrupt signal
 	stop := make(chan os.Signal, 1)
@@ -99,10 +189,37 @@ func main() {
 	if err := httpServer.Shutdown(ctx); err != nil {
 		log.Error().Err(err).Msg("Server forced to shutdown")
 	}
+	if h3Server != nil {
+		if err := h3Server.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("HTTP/3 server forced to shutdown")
+		}
+	}
+	srv.Close()
 
 	log.Info().Msg("✅ Server stopped gracefully")
 }
 
+// runCommand dispatches maintenance subcommands; handled is false when name
+// is not a known subcommand and the server should start normally
+func runCommand(cfg *config.Config, name string, args []string) (handled bool, err error) {
+	switch name {
+	case "export", "import":
+		return true, runBundleCommand(cfg, name, args)
+	case "gc":
+		return true, runGCCommand(cfg, args)
+	case "migrate-keys":
+		return true, runMigrateKeysCommand(cfg, args)
+	case "migrate-prefix":
+		return true, runMigratePrefixCommand(cfg, args)
+	case "selftest":
+		return true, runSelftestCommand(cfg, args)
+	case "replay":
+		return true, runReplayCommand(cfg, args)
+	default:
+		return false, nil
+	}
+}
+
 // formatBytes converts bytes to human readable format
 func FormatBytes(bytes int64) string {
 	const unit = 1024
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/huyhandes/groxpi/internal/config"
+	"github.com/huyhandes/groxpi/internal/server"
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// runMigrateKeysCommand implements the "migrate-keys" subcommand, which
+// relocates cached files from an old key layout to the configured one. With
+// the same layout on both sides it moves files stored under package names
+// that weren't fully normalized, such as the dotted names of older releases.
+func runMigrateKeysCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("migrate-keys", flag.ContinueOnError)
+	defaultFrom := storage.DefaultKeyTemplate
+	if cfg.StorageKeyFallback != "" {
+		defaultFrom = cfg.StorageKeyFallback
+	}
+	fromTemplate := fs.String("from", defaultFrom, "key template the files are currently stored under")
+	dryRun := fs.Bool("dry-run", false, "report what would be moved without moving")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	from, err := storage.NewKeyLayout(*fromTemplate)
+	if err != nil {
+		return err
+	}
+	to, err := storage.NewKeyLayout(cfg.StorageKeyTemplate)
+	if err != nil {
+		return err
+	}
+	store, err := server.OpenStorage(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %w", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	report, err := storage.MigrateKeys(context.Background(), store, from, to, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "Moved"
+	if report.DryRun {
+		verb = "Would move"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d of %d files (%s) to %s, %d failed\n",
+		verb, report.Moved, report.Scanned, FormatBytes(report.Bytes), to.Template(), report.Failed)
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d files could not be moved; run the migration again to retry", report.Failed)
+	}
+	return nil
+}
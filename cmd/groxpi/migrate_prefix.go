@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/huyhandes/groxpi/internal/config"
+	"github.com/huyhandes/groxpi/internal/server"
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// runMigratePrefixCommand implements the "migrate-prefix" subcommand, which
+// moves S3 objects from an old prefix to the configured GROXPI_S3_PREFIX
+func runMigratePrefixCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("migrate-prefix", flag.ContinueOnError)
+	fromTemplate := fs.String("from", "", "prefix the objects are currently stored under; placeholders are expanded as in GROXPI_S3_PREFIX")
+	dryRun := fs.Bool("dry-run", false, "report what would be moved without moving")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if cfg.StorageType != "s3" && cfg.StorageType != "hybrid" {
+		return errors.New("migrate-prefix requires GROXPI_STORAGE_TYPE to be s3 or hybrid")
+	}
+	fromPrefix, err := config.ExpandPrefix(*fromTemplate, os.Getenv)
+	if err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	from, to := strings.Trim(fromPrefix, "/"), strings.Trim(cfg.S3Prefix, "/")
+	if from == to {
+		return fmt.Errorf("source and target prefixes are both %q; set GROXPI_S3_PREFIX to the new prefix", to)
+	}
+
+	// When the new prefix lies within the old one, its objects show up in
+	// the old one's listing and must stay where they are
+	var exclude string
+	if from == "" {
+		exclude = to + "/"
+	} else if rest, ok := strings.CutPrefix(to, from+"/"); ok {
+		exclude = rest + "/"
+	}
+
+	// Both sides are opened as plain S3 storage: the L1 cache of hybrid
+	// storage doesn't include the prefix in its keys
+	fromCfg, toCfg := *cfg, *cfg
+	fromCfg.StorageType, toCfg.StorageType = "s3", "s3"
+	fromCfg.S3Prefix = fromPrefix
+
+	src, err := server.OpenStorage(&fromCfg)
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+	dst, err := server.OpenStorage(&toCfg)
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %w", err)
+	}
+	defer func() { _ = dst.Close() }()
+
+	report, err := storage.MigratePrefix(context.Background(), src, dst, exclude, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "Moved"
+	if report.DryRun {
+		verb = "Would move"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d of %d objects (%s) from %q to %q, %d failed\n",
+		verb, report.Moved, report.Scanned, FormatBytes(report.Bytes), from, to, report.Failed)
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d objects could not be moved; run the migration again to retry", report.Failed)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/capture"
+	"github.com/huyhandes/groxpi/internal/config"
+)
+
+// runReplayCommand implements the "replay" subcommand, which re-issues the
+// requests in a capture file against a target instance
+func runReplayCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	target := fs.String("target", "http://localhost:"+cfg.Port, "base URL of the instance to replay against")
+	speed := fs.Float64("speed", 1, "multiple of the captured pace; 0 sends requests as fast as -concurrency allows")
+	concurrency := fs.Int("concurrency", 16, "requests in flight at most")
+	token := fs.String("token", "", "bearer token for a target that requires one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: groxpi replay [flags] <capture file>")
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	// Interrupting a long replay still prints what was measured so far
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := capture.Replay(ctx, file, capture.ReplayOptions{
+		Target:      *target,
+		Speed:       *speed,
+		Concurrency: *concurrency,
+		Token:       *token,
+	})
+	if report == nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Replayed %d requests against %s in %s: %d failed, %d with a different status, %s received\n",
+		report.Requests, *target, report.Duration.Round(time.Millisecond), report.Failed, report.StatusChanged, FormatBytes(report.Bytes))
+	fmt.Fprintf(os.Stderr, "Latency p50 %s, p95 %s, p99 %s, max %s\n",
+		report.P50.Round(time.Microsecond), report.P95.Round(time.Microsecond), report.P99.Round(time.Microsecond), report.Max.Round(time.Microsecond))
+	statuses := make([]int, 0, len(report.Statuses))
+	for status := range report.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(os.Stderr, "  %d: %d\n", status, report.Statuses[status])
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
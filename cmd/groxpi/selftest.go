@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/config"
+	"github.com/huyhandes/groxpi/internal/pypi"
+	"github.com/huyhandes/groxpi/internal/selftest"
+	"github.com/huyhandes/groxpi/internal/server"
+)
+
+// runSelftestCommand implements the "selftest" subcommand, which checks
+// that the configured storage and upstream index work before a rollout
+func runSelftestCommand(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	pkg := fs.String("package", selftest.DefaultPackage, "package whose metadata is fetched from the index")
+	timeout := fs.Duration("timeout", 30*time.Second, "give up on the whole run after this long")
+	skipUpstream := fs.Bool("skip-upstream", false, "only check storage")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := server.OpenStorage(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %w", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	opts := selftest.Options{Storage: store, Package: *pkg}
+	if !*skipUpstream {
+		opts.Upstream = pypi.NewClient(cfg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	report := selftest.Run(ctx, opts)
+
+	for _, check := range report.Checks {
+		status, detail := "ok  ", check.Detail
+		if !check.OK {
+			status, detail = "FAIL", check.Error
+		}
+		fmt.Fprintf(os.Stderr, "%s %-18s %8s  %s\n", status, check.Name, check.Latency.Round(time.Millisecond), detail)
+	}
+
+	if failed := report.Failed(); failed > 0 {
+		return fmt.Errorf("%d of %d checks failed (storage %s, index %s)", failed, len(report.Checks), cfg.StorageType, cfg.IndexURL)
+	}
+	fmt.Fprintf(os.Stderr, "All %d checks passed in %s\n", len(report.Checks), report.Duration.Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/huyhandes/groxpi/internal/server"
+	"github.com/huyhandes/groxpi/internal/version"
+)
+
+// printVersion writes the build details and compiled-in features
+func printVersion(w io.Writer) {
+	features := server.BuildFeatures()
+	_, _ = fmt.Fprintln(w, version.Info())
+	_, _ = fmt.Fprintf(w, "storage backends: %s\n", strings.Join(features.StorageBackends, ", "))
+	_, _ = fmt.Fprintf(w, "index encodings: %s\n", strings.Join(features.IndexEncodings, ", "))
+	_, _ = fmt.Fprintf(w, "http3: %t\n", features.HTTP3)
+}
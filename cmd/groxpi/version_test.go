@@ -0,0 +1,21 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/huyhandes/groxpi/internal/version"
+)
+
+func TestPrintVersion(t *testing.T) {
+	var out strings.Builder
+	printVersion(&out)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "groxpi "+version.Get()) {
+		t.Errorf("Unexpected version output:\n%s", out.String())
+	}
+	if lines[1] != "storage backends: local, s3, hybrid" {
+		t.Errorf("Expected storage backends, got %q", lines[1])
+	}
+}
@@ -0,0 +1,158 @@
+// Package groxpi embeds the groxpi PyPI caching proxy in other Go programs,
+// e.g. as part of a build service, without going through environment
+// variables:
+//
+//	cfg := groxpi.DefaultConfig()
+//	cfg.IndexURL = "https://pypi.org/simple/"
+//	cfg.CacheDir = "/var/cache/groxpi"
+//	cfg.BasePath = "/pypi" // Links in HTML pages include the mount prefix
+//
+//	proxy, err := groxpi.New(groxpi.Options{Config: cfg})
+//	if err != nil {
+//		return err
+//	}
+//	defer proxy.Close()
+//
+//	mux.Handle("/pypi/", http.StripPrefix("/pypi", proxy.Handler()))
+package groxpi
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/huyhandes/groxpi/internal/clientid"
+	"github.com/huyhandes/groxpi/internal/config"
+	"github.com/huyhandes/groxpi/internal/server"
+)
+
+// Config is the full groxpi configuration; see docs/configuration.md for
+// the environment variable behind each field
+type Config = config.Config
+
+// Mount is a logical index served under its own path prefix
+type Mount = config.Mount
+
+// Hooks applies embedder policy (license checks, tagging, auditing) during
+// the request lifecycle; embed NopHooks to implement only some methods
+type Hooks = server.Hooks
+
+// NopHooks implements every hook as a no-op
+type NopHooks = server.NopHooks
+
+// Hook arguments
+type (
+	IndexRequest  = server.IndexRequest
+	FileRequest   = server.FileRequest
+	FileCached    = server.FileCached
+	UpstreamError = server.UpstreamError
+
+	// ClientIdentity is the client behind a request, from its User-Agent
+	// and GROXPI_CLIENT_TEAM_HEADER
+	ClientIdentity = clientid.Identity
+)
+
+// DefaultConfig returns the configuration groxpi runs with when no
+// environment variables are set
+func DefaultConfig() *Config {
+	return config.Default()
+}
+
+// ConfigFromEnv reads the configuration from the environment the way the
+// groxpi binary does
+func ConfigFromEnv() (cfg *Config, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid configuration: %v", r)
+		}
+	}()
+	return config.Load(), nil
+}
+
+// Options configures an embedded proxy
+type Options struct {
+	Config *Config // nil = DefaultConfig()
+
+	// Hooks run in order for the proxy and every mounted index; the first
+	// request hook returning an error rejects the request with 403
+	Hooks []Hooks
+
+	// OnClose functions run, in order, once Close has stopped background
+	// work and closed storage
+	OnClose []func()
+}
+
+// Proxy is an embedded groxpi instance
+type Proxy struct {
+	srv *server.Server
+
+	mu      sync.Mutex
+	onClose []func()
+	closed  bool
+}
+
+// New validates the configuration, opens storage and starts background work
+// such as mirroring and trash expiry. The caller serves Handler and must
+// call Close when done.
+func New(opts Options) (*Proxy, error) {
+	cfg := opts.Config
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	srv, err := server.Open(cfg, opts.Hooks...)
+	if err != nil {
+		return nil, err
+	}
+	return &Proxy{srv: srv, onClose: append([]func(){}, opts.OnClose...)}, nil
+}
+
+// Handler serves the index, file downloads and admin routes of the proxy
+// and its mounted indexes
+func (p *Proxy) Handler() http.Handler {
+	return p.srv.Handler()
+}
+
+// HTTPServer returns an http.Server for Handler with the configured
+// timeouts, header limits and HTTP/2 settings, for callers that don't bring
+// their own
+func (p *Proxy) HTTPServer() *http.Server {
+	return p.srv.HTTPServer()
+}
+
+// HTTP3Server returns the HTTP/3 server for Handler when Config.HTTP3 is
+// set, nil otherwise; start it with ListenAndServeTLS
+func (p *Proxy) HTTP3Server() *http3.Server {
+	return p.srv.HTTP3Server()
+}
+
+// OnClose registers fn to run after Close
+func (p *Proxy) OnClose(fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onClose = append(p.onClose, fn)
+}
+
+// Close stops background work, closes storage and runs the OnClose hooks.
+// Stop serving Handler first; calling Close again does nothing.
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	hooks := p.onClose
+	p.mu.Unlock()
+
+	p.srv.Close()
+	for _, fn := range hooks {
+		fn()
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package groxpi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNew_Embedded(t *testing.T) {
+	index := httptest.NewServer(http.NotFoundHandler())
+	defer index.Close()
+
+	cfg := DefaultConfig()
+	cfg.IndexURL = index.URL + "/simple/"
+	cfg.CacheDir = t.TempDir()
+	cfg.LocalCacheDir = cfg.CacheDir
+
+	var closed []string
+	proxy, err := New(Options{Config: cfg, OnClose: []func(){func() { closed = append(closed, "options") }}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	proxy.OnClose(func() { closed = append(closed, "registered") })
+
+	mux := http.NewServeMux()
+	mux.Handle("/pypi/", http.StripPrefix("/pypi", proxy.Handler()))
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/pypi/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected health check through the embedding mux, got %d", w.Code)
+	}
+
+	if err := proxy.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	_ = proxy.Close()
+	if len(closed) != 2 || closed[0] != "options" || closed[1] != "registered" {
+		t.Errorf("Expected close hooks to run once in order, got %v", closed)
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CacheDir = t.TempDir()
+	cfg.MirrorEnabled = true // Requires S3-backed storage
+
+	if _, err := New(Options{Config: cfg}); err == nil {
+		t.Error("Expected an error instead of a panic or exit")
+	}
+}
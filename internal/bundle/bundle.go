@@ -0,0 +1,341 @@
+package bundle
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/phuslu/log"
+
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+const (
+	// ManifestName is the tar entry holding the manifest. It is written last
+	// because hashes are computed while files are streamed into the archive.
+	ManifestName = "manifest.json"
+
+	// FormatVersion is bumped on incompatible bundle layout changes. Import
+	// accepts bundles up to it and rejects newer ones rather than guessing.
+	FormatVersion = 1
+
+	packagesPrefix = "packages/"
+
+	// StagingPrefix holds the files of an import until the bundle has passed
+	// its manifest check, so a rejected bundle never reaches cached keys
+	StagingPrefix = "staging/"
+
+	// paxMetadataPrefix namespaces object metadata in entry PAX records
+	paxMetadataPrefix = "GROXPI.meta."
+)
+
+// ManifestFile describes one file in a bundle
+type ManifestFile struct {
+	Key    string `json:"key"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest lists the contents of a bundle
+type Manifest struct {
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	Packages  []string       `json:"packages"`
+	Files     []ManifestFile `json:"files"`
+}
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	Imported int   `json:"imported"`
+	Skipped  int   `json:"skipped"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// Export writes the cached files of the given (normalized) packages to w as a
+// tar bundle followed by its manifest. keys is the store's key layout;
+// entries in the bundle always use packages/<package>/<file> so bundles move
+// between instances with different layouts.
+func Export(ctx context.Context, store storage.Storage, keys *storage.KeyLayout, packages []string, w io.Writer) (*Manifest, error) {
+	return ExportSelected(ctx, store, keys, packages, nil, w)
+}
+
+// ExportSelected is Export limited to the files keep accepts (nil = all),
+// e.g. the files of some versions of a package
+func ExportSelected(ctx context.Context, store storage.Storage, keys *storage.KeyLayout, packages []string, keep func(pkg, file string) bool, w io.Writer) (*Manifest, error) {
+	if len(packages) == 0 {
+		return nil, errors.New("no packages selected for export")
+	}
+
+	tw := tar.NewWriter(w)
+	manifest := &Manifest{
+		Version:   FormatVersion,
+		CreatedAt: time.Now().UTC(),
+		Packages:  packages,
+	}
+
+	for _, pkg := range packages {
+		objects, err := store.List(ctx, storage.ListOptions{Prefix: keys.PackagePrefix(pkg)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", pkg, err)
+		}
+
+		for _, obj := range objects {
+			if keep != nil && !keep(pkg, path.Base(obj.Key)) {
+				continue
+			}
+			file, err := exportObject(ctx, store, tw, obj, packagesPrefix+pkg+"/"+path.Base(obj.Key))
+			if err != nil {
+				return nil, err
+			}
+			manifest.Files = append(manifest.Files, *file)
+		}
+	}
+
+	data, err := sonic.ConfigStd.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    ManifestName,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: manifest.CreatedAt,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to write manifest header: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish bundle: %w", err)
+	}
+
+	log.Info().
+		Strs("packages", packages).
+		Int("files", len(manifest.Files)).
+		Msg("Cache bundle exported")
+
+	return manifest, nil
+}
+
+func exportObject(ctx context.Context, store storage.Storage, tw *tar.Writer, obj *storage.ObjectInfo, name string) (*ManifestFile, error) {
+	reader, info, err := store.Get(ctx, obj.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", obj.Key, err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	size := obj.Size
+	var records map[string]string
+	if info != nil {
+		if info.Size > 0 {
+			size = info.Size
+		}
+		records = metadataRecords(info.Metadata)
+	}
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:       name,
+		Mode:       0644,
+		Size:       size,
+		ModTime:    obj.LastModified,
+		PAXRecords: records,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to write header for %s: %w", obj.Key, err)
+	}
+
+	hasher := sha256.New()
+	written, err := io.Copy(tw, io.TeeReader(reader, hasher))
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", obj.Key, err)
+	}
+	if written != size {
+		return nil, fmt.Errorf("size changed while exporting %s: expected %d, got %d", obj.Key, size, written)
+	}
+
+	return &ManifestFile{
+		Key:    name,
+		Size:   size,
+		SHA256: hex.EncodeToString(hasher.Sum(nil)),
+	}, nil
+}
+
+// metadataRecords maps object metadata to vendor PAX records, so bundles
+// carry it between instances
+func metadataRecords(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	records := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		records[paxMetadataPrefix+k] = v
+	}
+	return records
+}
+
+// metadataFromRecords extracts object metadata from an entry's PAX records
+func metadataFromRecords(records map[string]string) map[string]string {
+	var metadata map[string]string
+	for k, v := range records {
+		if name, ok := strings.CutPrefix(k, paxMetadataPrefix); ok {
+			if metadata == nil {
+				metadata = make(map[string]string)
+			}
+			metadata[name] = v
+		}
+	}
+	return metadata
+}
+
+// Import reads a bundle from r into store. Files already present are skipped
+// unless overwrite is set. Files are staged under StagingPrefix while the
+// bundle is read and only moved to their keys, in the store's key layout,
+// once all of them match the manifest; otherwise they are dropped and an
+// error returned, leaving the cache as it was.
+func Import(ctx context.Context, store storage.Storage, keys *storage.KeyLayout, r io.Reader, overwrite bool) (*ImportResult, error) {
+	tr := tar.NewReader(r)
+	result := &ImportResult{}
+	hashes := make(map[string]string)
+	staged := make(map[string]string) // Bundle entry -> staging key
+	staging := StagingPrefix + stagingID() + "/"
+	var manifest *Manifest
+
+	// Whatever is still staged on return was never moved into the cache
+	defer func() {
+		ctx := context.WithoutCancel(ctx)
+		for _, key := range staged {
+			if err := store.Delete(ctx, key); err != nil {
+				log.Warn().Err(err).Str("key", key).Msg("Failed to remove staged bundle file")
+			}
+		}
+	}()
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if hdr.Name == ManifestName {
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return result, fmt.Errorf("failed to read manifest: %w", err)
+			}
+			manifest = &Manifest{}
+			if err := sonic.Unmarshal(data, manifest); err != nil {
+				return result, fmt.Errorf("invalid manifest: %w", err)
+			}
+			continue
+		}
+
+		pkg, file, ok := parseKey(hdr.Name)
+		if !ok {
+			return result, fmt.Errorf("unexpected entry in bundle: %q", hdr.Name)
+		}
+
+		if !overwrite {
+			if exists, err := store.Exists(ctx, keys.Key(pkg, file)); err == nil && exists {
+				hashes[hdr.Name] = ""
+				result.Skipped++
+				continue
+			}
+		}
+
+		hasher := sha256.New()
+		stagingKey := staging + hdr.Name
+		putCtx := storage.WithMetadata(ctx, metadataFromRecords(hdr.PAXRecords))
+		if _, err := store.Put(putCtx, stagingKey, io.TeeReader(tr, hasher), hdr.Size, "application/octet-stream"); err != nil {
+			return result, fmt.Errorf("failed to stage %s: %w", hdr.Name, err)
+		}
+		staged[hdr.Name] = stagingKey
+		hashes[hdr.Name] = hex.EncodeToString(hasher.Sum(nil))
+		result.Imported++
+		result.Bytes += hdr.Size
+	}
+
+	if manifest == nil {
+		return nil, errors.New("bundle has no manifest")
+	}
+	if manifest.Version < 1 || manifest.Version > FormatVersion {
+		return nil, fmt.Errorf("unsupported bundle format version %d: this groxpi imports versions 1 to %d; import with the groxpi that exported it or a newer one", manifest.Version, FormatVersion)
+	}
+
+	if err := verify(manifest, hashes); err != nil {
+		return nil, err
+	}
+
+	for name, stagingKey := range staged {
+		pkg, file, _ := parseKey(name)
+		if err := storage.Move(ctx, store, stagingKey, keys.Key(pkg, file)); err != nil {
+			return result, fmt.Errorf("failed to store %s: %w", name, err)
+		}
+		delete(staged, name)
+	}
+
+	log.Info().
+		Strs("packages", manifest.Packages).
+		Int("imported", result.Imported).
+		Int("skipped", result.Skipped).
+		Int64("bytes", result.Bytes).
+		Msg("Cache bundle imported")
+
+	return result, nil
+}
+
+// stagingID names one import's staging area, so concurrent imports don't
+// share files
+func stagingID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// verify checks the imported files against the manifest. Skipped files carry
+// an empty hash and are only checked for presence.
+func verify(manifest *Manifest, hashes map[string]string) error {
+	listed := make(map[string]struct{}, len(manifest.Files))
+	for _, f := range manifest.Files {
+		listed[f.Key] = struct{}{}
+		got, ok := hashes[f.Key]
+		if !ok {
+			return fmt.Errorf("bundle is missing %s", f.Key)
+		}
+		if got != "" && got != f.SHA256 {
+			return fmt.Errorf("sha256 mismatch for %s", f.Key)
+		}
+	}
+	for key := range hashes {
+		if _, ok := listed[key]; !ok {
+			return fmt.Errorf("%s is not listed in the manifest", key)
+		}
+	}
+	return nil
+}
+
+// parseKey accepts only packages/<package>/<file> entries
+func parseKey(name string) (pkg, file string, ok bool) {
+	if path.Clean(name) != name || !strings.HasPrefix(name, packagesPrefix) {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(name, packagesPrefix), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || parts[0] == ".." || parts[1] == ".." {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
@@ -0,0 +1,295 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+func newStore(t *testing.T, files map[string]string) storage.Storage {
+	t.Helper()
+
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	for key, data := range files {
+		if _, err := store.Put(context.Background(), key, strings.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+			t.Fatalf("Put %s failed: %v", key, err)
+		}
+	}
+	return store
+}
+
+func defaultKeys(t *testing.T) *storage.KeyLayout {
+	t.Helper()
+
+	keys, err := storage.NewKeyLayout(storage.DefaultKeyTemplate)
+	if err != nil {
+		t.Fatalf("NewKeyLayout failed: %v", err)
+	}
+	return keys
+}
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := newStore(t, map[string]string{
+		"packages/numpy/numpy-1.26.4.tar.gz":        "numpy sdist",
+		"packages/requests/requests-2.31.0.tar.gz":  "requests sdist",
+		"packages/unrelated/unrelated-1.0.0.tar.gz": "not exported",
+	})
+
+	var buf bytes.Buffer
+	manifest, err := Export(ctx, src, defaultKeys(t), []string{"numpy", "requests"}, &buf)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if len(manifest.Files) != 2 {
+		t.Fatalf("Expected 2 files in manifest, got %d", len(manifest.Files))
+	}
+
+	dst := newStore(t, map[string]string{
+		"packages/numpy/numpy-1.26.4.tar.gz": "numpy sdist",
+	})
+
+	result, err := Import(ctx, dst, defaultKeys(t), bytes.NewReader(buf.Bytes()), false)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if result.Imported != 1 || result.Skipped != 1 {
+		t.Errorf("Expected 1 imported and 1 skipped, got %+v", result)
+	}
+
+	reader, _, err := dst.Get(ctx, "packages/requests/requests-2.31.0.tar.gz")
+	if err != nil {
+		t.Fatalf("Imported file missing: %v", err)
+	}
+	defer func() { _ = reader.Close() }()
+	data, _ := io.ReadAll(reader)
+	if string(data) != "requests sdist" {
+		t.Errorf("Unexpected imported content %q", data)
+	}
+
+	if exists, _ := dst.Exists(ctx, "packages/unrelated/unrelated-1.0.0.tar.gz"); exists {
+		t.Error("Unselected package should not be exported")
+	}
+}
+
+func TestExportImport_KeepsMetadata(t *testing.T) {
+	ctx := context.Background()
+	src := newStore(t, nil)
+	key := "packages/numpy/numpy-1.26.4.tar.gz"
+	putCtx := storage.WithMetadata(ctx, map[string]string{storage.MetaSHA256: "abc123"})
+	if _, err := src.Put(putCtx, key, strings.NewReader("numpy sdist"), 11, "application/octet-stream"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := Export(ctx, src, defaultKeys(t), []string{"numpy"}, &buf); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	dst := newStore(t, nil)
+	if _, err := Import(ctx, dst, defaultKeys(t), bytes.NewReader(buf.Bytes()), false); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	info, err := dst.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Imported file missing: %v", err)
+	}
+	if info.Metadata[storage.MetaSHA256] != "abc123" {
+		t.Errorf("Expected metadata to survive the bundle, got %v", info.Metadata)
+	}
+}
+
+func TestImport_RejectsTamperedBundle(t *testing.T) {
+	ctx := context.Background()
+	src := newStore(t, map[string]string{
+		"packages/six/six-1.16.0.tar.gz": "original",
+	})
+
+	var buf bytes.Buffer
+	if _, err := Export(ctx, src, defaultKeys(t), []string{"six"}, &buf); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	// Same length, different content
+	tampered := bytes.Replace(buf.Bytes(), []byte("original"), []byte("modified"), 1)
+
+	dst := newStore(t, nil)
+	if _, err := Import(ctx, dst, defaultKeys(t), bytes.NewReader(tampered), false); err == nil {
+		t.Fatal("Expected hash mismatch error")
+	}
+
+	if exists, _ := dst.Exists(ctx, "packages/six/six-1.16.0.tar.gz"); exists {
+		t.Error("Tampered file should be removed after a failed import")
+	}
+}
+
+func TestImport_RejectedOverwriteKeepsCache(t *testing.T) {
+	ctx := context.Background()
+	src := newStore(t, map[string]string{
+		"packages/six/six-1.16.0.tar.gz": "original",
+	})
+
+	var buf bytes.Buffer
+	if _, err := Export(ctx, src, defaultKeys(t), []string{"six"}, &buf); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	tampered := bytes.Replace(buf.Bytes(), []byte("original"), []byte("modified"), 1)
+
+	// A bad bundle neither replaces nor deletes what is already cached
+	dst := newStore(t, map[string]string{
+		"packages/six/six-1.16.0.tar.gz": "original",
+	})
+	if _, err := Import(ctx, dst, defaultKeys(t), bytes.NewReader(tampered), true); err == nil {
+		t.Fatal("Expected hash mismatch error")
+	}
+	reader, _, err := dst.Get(ctx, "packages/six/six-1.16.0.tar.gz")
+	if err != nil {
+		t.Fatalf("Cached file removed by a rejected import: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	_ = reader.Close()
+	if string(data) != "original" {
+		t.Errorf("Cached file overwritten by a rejected import: %q", data)
+	}
+
+	staged := 0
+	_ = dst.(storage.Walker).Walk(ctx, StagingPrefix, func(*storage.ObjectInfo) error {
+		staged++
+		return nil
+	})
+	if staged != 0 {
+		t.Errorf("Expected no staged files left, got %d", staged)
+	}
+}
+
+func TestImport_RejectsUnsafeEntries(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	_ = tw.WriteHeader(&tar.Header{Name: "packages/../../etc/passwd", Mode: 0644, Size: 1})
+	_, _ = tw.Write([]byte("x"))
+	_ = tw.Close()
+
+	if _, err := Import(context.Background(), newStore(t, nil), defaultKeys(t), &buf, false); err == nil {
+		t.Fatal("Expected error for path traversal entry")
+	}
+}
+
+func TestImport_RequiresManifest(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	_ = tw.WriteHeader(&tar.Header{Name: "packages/six/six-1.16.0.tar.gz", Mode: 0644, Size: 3})
+	_, _ = tw.Write([]byte("six"))
+	_ = tw.Close()
+
+	dst := newStore(t, nil)
+	if _, err := Import(context.Background(), dst, defaultKeys(t), &buf, false); err == nil {
+		t.Fatal("Expected error for bundle without manifest")
+	}
+	if exists, _ := dst.Exists(context.Background(), "packages/six/six-1.16.0.tar.gz"); exists {
+		t.Error("Files from a bundle without manifest should be removed")
+	}
+}
+
+func TestImport_RejectsNewerVersion(t *testing.T) {
+	manifest := `{"version":99,"packages":["six"],"files":[{"key":"packages/six/six-1.16.0.tar.gz","size":3}]}`
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	_ = tw.WriteHeader(&tar.Header{Name: "packages/six/six-1.16.0.tar.gz", Mode: 0644, Size: 3})
+	_, _ = tw.Write([]byte("six"))
+	_ = tw.WriteHeader(&tar.Header{Name: ManifestName, Mode: 0644, Size: int64(len(manifest))})
+	_, _ = tw.Write([]byte(manifest))
+	_ = tw.Close()
+
+	dst := newStore(t, nil)
+	_, err := Import(context.Background(), dst, defaultKeys(t), &buf, false)
+	if err == nil || !strings.Contains(err.Error(), "version 99") {
+		t.Fatalf("Expected an unsupported version error, got %v", err)
+	}
+	if exists, _ := dst.Exists(context.Background(), "packages/six/six-1.16.0.tar.gz"); exists {
+		t.Error("Files from a rejected bundle should be removed")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	tests := map[string]bool{
+		"packages/numpy/numpy-1.0.tar.gz": true,
+		"packages/numpy/../x":             false,
+		"packages/numpy":                  false,
+		"packages/a/b/c":                  false,
+		"/packages/numpy/x":               false,
+		"mirror/state.json":               false,
+	}
+
+	for key, want := range tests {
+		if _, _, got := parseKey(key); got != want {
+			t.Errorf("parseKey(%q) ok = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestExportImport_AcrossKeyLayouts(t *testing.T) {
+	ctx := context.Background()
+	sharded, err := storage.NewKeyLayout("packages/{p2}/{package}/{file}")
+	if err != nil {
+		t.Fatalf("NewKeyLayout failed: %v", err)
+	}
+
+	src := newStore(t, map[string]string{
+		"packages/nu/numpy/numpy-1.26.4.tar.gz": "numpy sdist",
+	})
+
+	var buf bytes.Buffer
+	manifest, err := Export(ctx, src, sharded, []string{"numpy"}, &buf)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if len(manifest.Files) != 1 || manifest.Files[0].Key != "packages/numpy/numpy-1.26.4.tar.gz" {
+		t.Fatalf("Expected bundle entries in the default layout, got %+v", manifest.Files)
+	}
+
+	dst := newStore(t, nil)
+	if _, err := Import(ctx, dst, defaultKeys(t), bytes.NewReader(buf.Bytes()), false); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if exists, _ := dst.Exists(ctx, "packages/numpy/numpy-1.26.4.tar.gz"); !exists {
+		t.Error("Expected file to be stored in the destination layout")
+	}
+}
+
+func TestExport_RequiresPackages(t *testing.T) {
+	if _, err := Export(context.Background(), newStore(t, nil), defaultKeys(t), nil, io.Discard); err == nil {
+		t.Error("Expected error when no packages are selected")
+	}
+}
+
+func TestExportSelected(t *testing.T) {
+	src := newStore(t, map[string]string{
+		"packages/numpy/numpy-1.26.4.tar.gz":                      "numpy 1.26.4",
+		"packages/numpy/numpy-2.0.0-cp312-cp312-linux_x86_64.whl": "numpy 2.0.0",
+	})
+
+	var buf bytes.Buffer
+	manifest, err := ExportSelected(context.Background(), src, defaultKeys(t), []string{"numpy"}, func(pkg, file string) bool {
+		return strings.HasPrefix(file, "numpy-2.0.0-")
+	}, &buf)
+	if err != nil {
+		t.Fatalf("ExportSelected failed: %v", err)
+	}
+	if len(manifest.Files) != 1 || manifest.Files[0].Key != "packages/numpy/numpy-2.0.0-cp312-cp312-linux_x86_64.whl" {
+		t.Errorf("Expected only the selected file, got %+v", manifest.Files)
+	}
+	if result, err := Import(context.Background(), newStore(t, nil), defaultKeys(t), &buf, false); err != nil || result.Imported != 1 {
+		t.Errorf("Expected the selection to import, got %+v, %v", result, err)
+	}
+}
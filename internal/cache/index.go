@@ -1,18 +1,25 @@
 package cache
 
 import (
+	"math"
+	"math/rand/v2"
 	"sync"
 	"time"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
 )
 
 type IndexEntry struct {
 	Data      interface{}
 	ExpiresAt time.Time
+	StoredAt  time.Time
+	Delta     time.Duration // How long fetching Data took, scaling its early refresh window
 }
 
 type IndexCache struct {
 	mu      sync.RWMutex
 	entries map[string]*IndexEntry
+	beta    float64 // Early refresh eagerness (0 = refresh on expiry only)
 }
 
 func NewIndexCache() *IndexCache {
@@ -37,34 +44,118 @@ func (c *IndexCache) Get(key string) (interface{}, bool) {
 	return entry.Data, true
 }
 
+// GetStale returns an entry even if it has expired, for serving when the
+// upstream index cannot be reached
+func (c *IndexCache) GetStale(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+
+	return entry.Data, true
+}
+
 func (c *IndexCache) Set(key string, data interface{}, ttl time.Duration) {
+	c.SetFetched(key, data, ttl, 0)
+}
+
+// SetFetched stores data that took delta to fetch. Entries that are slow to
+// fetch become due for early refresh sooner.
+func (c *IndexCache) SetFetched(key string, data interface{}, ttl, delta time.Duration) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	now := time.Now()
 	c.entries[key] = &IndexEntry{
 		Data:      data,
-		ExpiresAt: time.Now().Add(ttl),
+		ExpiresAt: now.Add(ttl),
+		StoredAt:  now,
+		Delta:     delta,
+	}
+}
+
+// SetEarlyRefresh enables probabilistic early refresh (XFetch) with the
+// given eagerness; 1 is the usual choice, higher values refresh earlier and
+// 0 disables it
+func (c *IndexCache) SetEarlyRefresh(beta float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.beta = max(beta, 0)
+}
+
+// RefreshDue reports whether the live entry for key should be refreshed
+// before it expires. Each call draws at random, with a probability rising
+// towards expiry, so callers of a popular key refresh it a little early
+// and at different times instead of all missing when it expires.
+func (c *IndexCache) RefreshDue(key string) bool {
+	c.mu.RLock()
+	entry, exists := c.entries[key]
+	beta := c.beta
+	c.mu.RUnlock()
+
+	if !exists || beta == 0 || entry.Delta <= 0 {
+		return false
+	}
+	remaining := time.Until(entry.ExpiresAt)
+	if remaining <= 0 {
+		return false // Expired entries are refreshed by the miss
 	}
+	// XFetch: -ln(U) is exponentially distributed, so the draw lands within
+	// the remaining time with a probability that grows as it shrinks
+	early := time.Duration(float64(entry.Delta) * beta * -math.Log(1-rand.Float64()))
+	return early >= remaining
+}
+
+// Age returns how long ago the entry for key was stored, expired or not
+func (c *IndexCache) Age(key string) (time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return 0, false
+	}
+	return time.Since(entry.StoredAt), true
 }
 
 func (c *IndexCache) InvalidateList() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	delete(c.entries, "package-list")
+	delete(c.entries, cachekey.PackageList)
 }
 
 func (c *IndexCache) InvalidatePackage(packageName string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	delete(c.entries, "package:"+packageName)
+	delete(c.entries, cachekey.Project(packageName))
 }
 
 func (c *IndexCache) GetPackage(packageName string) (interface{}, bool) {
-	return c.Get("package:" + packageName)
+	return c.Get(cachekey.Project(packageName))
+}
+
+func (c *IndexCache) GetPackageStale(packageName string) (interface{}, bool) {
+	return c.GetStale(cachekey.Project(packageName))
 }
 
 func (c *IndexCache) SetPackage(packageName string, data interface{}, ttl time.Duration) {
-	c.Set("package:"+packageName, data, ttl)
+	c.Set(cachekey.Project(packageName), data, ttl)
+}
+
+func (c *IndexCache) SetPackageFetched(packageName string, data interface{}, ttl, delta time.Duration) {
+	c.SetFetched(cachekey.Project(packageName), data, ttl, delta)
+}
+
+func (c *IndexCache) PackageAge(packageName string) (time.Duration, bool) {
+	return c.Age(cachekey.Project(packageName))
+}
+
+func (c *IndexCache) PackageRefreshDue(packageName string) bool {
+	return c.RefreshDue(cachekey.Project(packageName))
 }
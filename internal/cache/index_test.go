@@ -224,3 +224,68 @@ func TestIndexCache_NegativeTTL(t *testing.T) {
 		t.Error("Expected entry with negative TTL to be expired immediately")
 	}
 }
+
+func TestIndexCache_GetStale(t *testing.T) {
+	indexCache := NewIndexCache()
+
+	indexCache.SetPackage("numpy", "expired-data", -1*time.Second)
+
+	if _, exists := indexCache.GetPackage("numpy"); exists {
+		t.Error("Expected expired entry to be missing from Get")
+	}
+
+	data, exists := indexCache.GetPackageStale("numpy")
+	if !exists || data != "expired-data" {
+		t.Errorf("Expected stale entry, got %v (exists=%v)", data, exists)
+	}
+
+	indexCache.InvalidatePackage("numpy")
+	if _, exists := indexCache.GetPackageStale("numpy"); exists {
+		t.Error("Expected invalidated entry to be gone")
+	}
+}
+
+func TestIndexCache_RefreshDue(t *testing.T) {
+	indexCache := NewIndexCache()
+	indexCache.SetFetched("near-expiry", "data", time.Second, time.Hour)
+	indexCache.SetFetched("far-from-expiry", "data", time.Hour, time.Millisecond)
+	indexCache.Set("unmeasured", "data", time.Second)
+	indexCache.SetFetched("expired", "data", -time.Second, time.Hour)
+
+	if indexCache.RefreshDue("near-expiry") {
+		t.Error("Expected no early refresh until enabled")
+	}
+
+	indexCache.SetEarlyRefresh(1)
+	due := 0
+	for i := 0; i < 100; i++ {
+		if indexCache.RefreshDue("near-expiry") {
+			due++
+		}
+		for _, key := range []string{"far-from-expiry", "unmeasured", "expired", "missing"} {
+			if indexCache.RefreshDue(key) {
+				t.Errorf("Expected no early refresh of %s", key)
+			}
+		}
+	}
+	// Due with probability exp(-1s/1h) per call
+	if due < 90 {
+		t.Errorf("Expected an entry slower to fetch than its remaining TTL to be due, got %d of 100", due)
+	}
+
+	if _, ok := indexCache.Get("near-expiry"); !ok {
+		t.Error("Expected an entry due for early refresh to still be served")
+	}
+}
+
+func TestIndexCache_Age(t *testing.T) {
+	indexCache := NewIndexCache()
+	if _, ok := indexCache.PackageAge("six"); ok {
+		t.Error("Expected no age for an uncached package")
+	}
+	indexCache.SetPackage("six", "data", -time.Second)
+	age, ok := indexCache.PackageAge("six")
+	if !ok || age < 0 || age > time.Second {
+		t.Errorf("Expected the age of an expired entry, got %s (%v)", age, ok)
+	}
+}
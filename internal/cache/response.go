@@ -89,6 +89,11 @@ func (c *ResponseCache) GetZeroCopy(key string) ([]byte, func(), bool) {
 }
 
 func (c *ResponseCache) Set(key string, data []byte, ttl time.Duration) {
+	c.put(key, data, time.Now().Add(ttl))
+}
+
+// put stores an entry expiring at expiresAt and returns it
+func (c *ResponseCache) put(key string, data []byte, expiresAt time.Time) *ResponseEntry {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -111,15 +116,43 @@ func (c *ResponseCache) Set(key string, data []byte, ttl time.Duration) {
 		}
 	}
 
-	c.entries[key] = &ResponseEntry{
+	entry := &ResponseEntry{
 		Data:      data,
-		ExpiresAt: time.Now().Add(ttl),
+		ExpiresAt: expiresAt,
 		Size:      newSize,
 		RefCount:  0, // Initialize reference count
 	}
+	c.entries[key] = entry
 
 	// Add to LRU
 	c.lru = append(c.lru, key)
+	return entry
+}
+
+// Expiry returns when an entry expires
+func (c *ResponseCache) Expiry(key string) (time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, exists := c.entries[key]
+	if !exists {
+		return time.Time{}, false
+	}
+	return entry.ExpiresAt, true
+}
+
+// snapshot returns the entries that haven't expired
+func (c *ResponseCache) snapshot() map[string]*ResponseEntry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	entries := make(map[string]*ResponseEntry, len(c.entries))
+	for key, entry := range c.entries {
+		if now.Before(entry.ExpiresAt) {
+			entries[key] = entry
+		}
+	}
+	return entries
 }
 
 func (c *ResponseCache) updateLRU(key string) {
@@ -0,0 +1,327 @@
+package cache
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/phuslu/log"
+)
+
+// Response cache entries are saved compressed with one of these
+const (
+	StoreEncodingZstd = "zstd"
+	StoreEncodingGzip = "gzip"
+)
+
+// storeExtensions are the file extensions of each encoding
+var storeExtensions = map[string]string{
+	StoreEncodingZstd: ".zst",
+	StoreEncodingGzip: ".gz",
+}
+
+// StoreVersion is the layout of saved entries, their header and the
+// rendered page they hold. It is part of each file's name and header; bump
+// it when either changes, so pages saved by another build are discarded
+// instead of served.
+const StoreVersion = 1
+
+// storeHeader precedes an entry's data in its file
+type storeHeader struct {
+	Version   int       `json:"version"`
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// storePrefix starts the file names of entries saved as StoreVersion
+var storePrefix = fmt.Sprintf("v%d-", StoreVersion)
+
+// ResponseStore keeps a ResponseCache's entries in a directory, one
+// compressed file per entry, so a restarted instance starts with the
+// rendered pages, above all the full project list, it served before. A nil
+// store keeps nothing.
+type ResponseStore struct {
+	cache    *ResponseCache
+	dir      string
+	encoding string
+	interval time.Duration
+
+	mu    sync.Mutex                // Serializes saves
+	saved map[string]*ResponseEntry // Entries as last written, to skip unchanged ones
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewResponseStore creates a store saving c to dir every interval. It
+// returns nil when dir is empty.
+func NewResponseStore(c *ResponseCache, dir, encoding string, interval time.Duration) *ResponseStore {
+	if dir == "" {
+		return nil
+	}
+	if _, ok := storeExtensions[encoding]; !ok {
+		encoding = StoreEncodingZstd
+	}
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	return &ResponseStore{
+		cache:    c,
+		dir:      dir,
+		encoding: encoding,
+		interval: interval,
+		saved:    make(map[string]*ResponseEntry),
+	}
+}
+
+// Load reads the saved entries into the cache. Entries that expired are
+// skipped, except those keep accepts: they are loaded to expire after
+// grace, so they can be served while they are refreshed, and their keys
+// are returned. Unreadable files, and those saved as another StoreVersion,
+// are removed.
+func (s *ResponseStore) Load(grace time.Duration, keep func(key string) bool) (loaded int, stale []string, err error) {
+	if s == nil {
+		return 0, nil, nil
+	}
+	files, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, file := range files {
+		encoding, ok := storeEncoding(file.Name())
+		if !ok || file.IsDir() {
+			continue
+		}
+		path := filepath.Join(s.dir, file.Name())
+		if !strings.HasPrefix(file.Name(), storePrefix) {
+			log.Debug().Str("file", path).Msg("Removing saved response of another version")
+			_ = os.Remove(path)
+			continue
+		}
+		header, data, err := readStoreFile(path, encoding)
+		if err == nil && header.Version != StoreVersion {
+			err = fmt.Errorf("version %d, this groxpi saves version %d", header.Version, StoreVersion)
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("file", path).Msg("Removing unreadable saved response")
+			_ = os.Remove(path)
+			continue
+		}
+
+		expiresAt := header.ExpiresAt
+		if !now.Before(expiresAt) {
+			if grace <= 0 || keep == nil || !keep(header.Key) {
+				continue
+			}
+			expiresAt = now.Add(grace)
+			stale = append(stale, header.Key)
+		}
+		entry := s.cache.put(header.Key, data, expiresAt)
+		if encoding == s.encoding {
+			s.saved[header.Key] = entry
+		}
+		loaded++
+	}
+	return loaded, stale, nil
+}
+
+// Save writes the entries that changed since the last save and removes the
+// files of entries no longer cached
+func (s *ResponseStore) Save() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	entries := s.cache.snapshot()
+	for key, entry := range entries {
+		if s.saved[key] == entry {
+			continue
+		}
+		if err := s.writeStoreFile(key, entry); err != nil {
+			return fmt.Errorf("save response %q: %w", key, err)
+		}
+		s.saved[key] = entry
+	}
+
+	wanted := make(map[string]bool, len(entries))
+	for key := range entries {
+		wanted[s.fileName(key)] = true
+	}
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if _, ok := storeEncoding(file.Name()); ok && !wanted[file.Name()] {
+			_ = os.Remove(filepath.Join(s.dir, file.Name()))
+		}
+	}
+	for key := range s.saved {
+		if _, ok := entries[key]; !ok {
+			delete(s.saved, key)
+		}
+	}
+	return nil
+}
+
+// Start saves the cache in the background every interval until Stop
+func (s *ResponseStore) Start() {
+	if s == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Save(); err != nil {
+					log.Warn().Err(err).Str("dir", s.dir).Msg("Failed to save response cache")
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends background saving and saves the cache a last time
+func (s *ResponseStore) Stop() {
+	if s == nil {
+		return
+	}
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+	if err := s.Save(); err != nil {
+		log.Warn().Err(err).Str("dir", s.dir).Msg("Failed to save response cache")
+	}
+}
+
+// fileName names an entry's file by StoreVersion and a hash of its key, as
+// keys hold ':' and project names
+func (s *ResponseStore) fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return storePrefix + hex.EncodeToString(sum[:16]) + storeExtensions[s.encoding]
+}
+
+// writeStoreFile writes an entry through a temporary file, so a crash
+// mid-write leaves the previous file in place
+func (s *ResponseStore) writeStoreFile(key string, entry *ResponseEntry) error {
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	var w io.WriteCloser
+	switch s.encoding {
+	case StoreEncodingGzip:
+		w = gzip.NewWriter(tmp)
+	default:
+		if w, err = zstd.NewWriter(tmp); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	header, err := json.Marshal(storeHeader{Version: StoreVersion, Key: key, ExpiresAt: entry.ExpiresAt})
+	if err == nil {
+		_, err = w.Write(append(header, '\n'))
+	}
+	if err == nil {
+		_, err = w.Write(entry.Data)
+	}
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, s.fileName(key)))
+}
+
+// readStoreFile reads an entry's header and data
+func readStoreFile(path, encoding string) (storeHeader, []byte, error) {
+	var header storeHeader
+	f, err := os.Open(path)
+	if err != nil {
+		return header, nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader
+	switch encoding {
+	case StoreEncodingGzip:
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return header, nil, err
+		}
+		defer gz.Close()
+		r = gz
+	default:
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return header, nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	br := bufio.NewReader(r)
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return header, nil, err
+	}
+	if err := json.Unmarshal(line, &header); err != nil || header.Key == "" {
+		return header, nil, errors.New("invalid header")
+	}
+	data, err := io.ReadAll(br)
+	return header, data, err
+}
+
+// storeEncoding returns the encoding of a saved entry's file name
+func storeEncoding(name string) (string, bool) {
+	if strings.HasPrefix(name, ".") {
+		return "", false
+	}
+	for encoding, ext := range storeExtensions {
+		if strings.HasSuffix(name, ext) {
+			return encoding, true
+		}
+	}
+	return "", false
+}
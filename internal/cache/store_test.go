@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseStore_SaveAndLoad(t *testing.T) {
+	for _, encoding := range []string{StoreEncodingZstd, StoreEncodingGzip} {
+		t.Run(encoding, func(t *testing.T) {
+			dir := t.TempDir()
+			saved := NewResponseCache(1024 * 1024)
+			saved.Set("json:package-list", []byte(`{"projects":[{"name":"numpy"}]}`), time.Hour)
+			saved.Set("json:package:numpy", []byte(`{"name":"numpy"}`), time.Hour)
+			if err := NewResponseStore(saved, dir, encoding, time.Minute).Save(); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+
+			files, _ := filepath.Glob(filepath.Join(dir, "*"+storeExtensions[encoding]))
+			if len(files) != 2 {
+				t.Fatalf("Expected 2 %s files, got %v", encoding, files)
+			}
+
+			loaded := NewResponseCache(1024 * 1024)
+			n, stale, err := NewResponseStore(loaded, dir, encoding, time.Minute).Load(time.Minute, nil)
+			if err != nil || n != 2 || len(stale) != 0 {
+				t.Fatalf("Expected 2 fresh entries, got %d, %v, %v", n, stale, err)
+			}
+			if data, found := loaded.Get("json:package:numpy"); !found || string(data) != `{"name":"numpy"}` {
+				t.Errorf("Expected the saved page, got %q", data)
+			}
+			if expiresAt, _ := loaded.Expiry("json:package-list"); time.Until(expiresAt) < 59*time.Minute {
+				t.Errorf("Expected the saved expiry kept, got %v", expiresAt)
+			}
+		})
+	}
+}
+
+func TestResponseStore_Stale(t *testing.T) {
+	dir := t.TempDir()
+	saved := NewResponseCache(1024 * 1024)
+	saved.Set("json:package-list", []byte(`{"projects":[]}`), time.Hour)
+	saved.Set("json:package:numpy", []byte(`{"name":"numpy"}`), time.Hour)
+	store := NewResponseStore(saved, dir, StoreEncodingZstd, time.Minute)
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Rewrite both as expired an hour ago
+	for _, key := range []string{"json:package-list", "json:package:numpy"} {
+		if err := store.writeStoreFile(key, &ResponseEntry{Data: []byte("{}"), ExpiresAt: time.Now().Add(-time.Hour)}); err != nil {
+			t.Fatalf("writeStoreFile failed: %v", err)
+		}
+	}
+
+	loaded := NewResponseCache(1024 * 1024)
+	keep := func(key string) bool { return key == "json:package-list" }
+	n, stale, err := NewResponseStore(loaded, dir, StoreEncodingZstd, time.Minute).Load(time.Minute, keep)
+	if err != nil || n != 1 || !slices.Equal(stale, []string{"json:package-list"}) {
+		t.Fatalf("Expected only the kept entry loaded stale, got %d, %v, %v", n, stale, err)
+	}
+	if _, found := loaded.Get("json:package-list"); !found {
+		t.Error("Expected the stale entry served during the grace period")
+	}
+	if _, found := loaded.Get("json:package:numpy"); found {
+		t.Error("Expected the expired entry skipped")
+	}
+}
+
+func TestResponseStore_Cleanup(t *testing.T) {
+	dir := t.TempDir()
+	responses := NewResponseCache(1024 * 1024)
+	responses.Set("json:package:numpy", []byte(`{"name":"numpy"}`), time.Hour)
+	responses.Set("json:package:requests", []byte(`{"name":"requests"}`), time.Hour)
+	store := NewResponseStore(responses, dir, StoreEncodingZstd, time.Minute)
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Unchanged entries aren't rewritten; dropped ones are removed
+	numpy := filepath.Join(dir, store.fileName("json:package:numpy"))
+	old := time.Now().Add(-time.Hour)
+	_ = os.Chtimes(numpy, old, old)
+	responses.Invalidate("json:package:requests")
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if info, err := os.Stat(numpy); err != nil || !info.ModTime().Equal(old) {
+		t.Errorf("Expected the unchanged entry left alone, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, store.fileName("json:package:requests"))); !os.IsNotExist(err) {
+		t.Errorf("Expected the dropped entry's file removed, got %v", err)
+	}
+
+	// Unreadable files are removed on load
+	corrupt := filepath.Join(dir, storePrefix+"corrupt.zst")
+	_ = os.WriteFile(corrupt, []byte("not zstd"), 0o644)
+	if n, _, err := NewResponseStore(NewResponseCache(1024*1024), dir, StoreEncodingZstd, time.Minute).Load(0, nil); err != nil || n != 1 {
+		t.Errorf("Expected 1 entry loaded, got %d, %v", n, err)
+	}
+	if _, err := os.Stat(corrupt); !os.IsNotExist(err) {
+		t.Errorf("Expected the corrupt file removed, got %v", err)
+	}
+}
+
+func TestResponseStore_Version(t *testing.T) {
+	dir := t.TempDir()
+	responses := NewResponseCache(1024 * 1024)
+	responses.Set("json:package:numpy", []byte(`{"name":"numpy"}`), time.Hour)
+	store := NewResponseStore(responses, dir, StoreEncodingGzip, time.Minute)
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	saved := filepath.Join(dir, store.fileName("json:package:numpy"))
+	if !strings.HasPrefix(filepath.Base(saved), fmt.Sprintf("v%d-", StoreVersion)) {
+		t.Errorf("Expected the version in the file name, got %s", saved)
+	}
+
+	// A file from before versioning, and one whose header names another
+	// version, are discarded rather than served
+	legacy := filepath.Join(dir, strings.TrimPrefix(filepath.Base(saved), storePrefix))
+	data, _ := os.ReadFile(saved)
+	_ = os.WriteFile(legacy, data, 0o644)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	fmt.Fprintf(gz, "{\"version\":%d,\"key\":\"json:package:requests\",\"expires_at\":%q}\n{}", StoreVersion+1, time.Now().Add(time.Hour).Format(time.RFC3339))
+	_ = gz.Close()
+	newer := filepath.Join(dir, store.fileName("json:package:requests"))
+	_ = os.WriteFile(newer, buf.Bytes(), 0o644)
+
+	loaded := NewResponseCache(1024 * 1024)
+	if n, _, err := NewResponseStore(loaded, dir, StoreEncodingGzip, time.Minute).Load(0, nil); err != nil || n != 1 {
+		t.Errorf("Expected only the current entry loaded, got %d, %v", n, err)
+	}
+	if _, found := loaded.Get("json:package:requests"); found {
+		t.Error("Expected the entry of another version not loaded")
+	}
+	for _, path := range []string{legacy, newer} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s removed, got %v", filepath.Base(path), err)
+		}
+	}
+}
+
+func TestResponseStore_Nil(t *testing.T) {
+	store := NewResponseStore(NewResponseCache(1024), "", StoreEncodingZstd, time.Minute)
+	if store != nil {
+		t.Fatal("Expected no store without a directory")
+	}
+	store.Start()
+	store.Stop()
+	if n, _, err := store.Load(time.Minute, nil); n != 0 || err != nil {
+		t.Errorf("Expected nothing loaded, got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,63 @@
+// Package cachekey builds the keys package data is cached under. Storage
+// keys, index and response cache entries, download coordination and the
+// background workers all derive theirs here, so a project requested as
+// Flask_SQLAlchemy, flask.sqlalchemy or flask-sqlalchemy is cached, fetched
+// and invalidated as one.
+package cachekey
+
+import "strings"
+
+const (
+	// PackageList is the index cache entry of the list of all projects
+	PackageList = "package-list"
+
+	// PackageListResponse is the response cache entry of the rendered
+	// JSON project list
+	PackageListResponse = "json:" + PackageList
+
+	projectPrefix = "package:"
+)
+
+// Package normalizes a project name as PEP 503 does: lowercased, with each
+// run of '-', '_' and '.' replaced by a single '-'. Surrounding whitespace
+// and separators are dropped.
+func Package(name string) string {
+	name = strings.TrimSpace(name)
+	var sb strings.Builder
+	sb.Grow(len(name))
+	separator := false
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '-' || c == '_' || c == '.' {
+			separator = true
+			continue
+		}
+		if separator && sb.Len() > 0 {
+			sb.WriteByte('-')
+		}
+		separator = false
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// Project is the index cache entry of a project's files
+func Project(pkg string) string {
+	return projectPrefix + Package(pkg)
+}
+
+// ProjectResponse is the response cache entry of a project's rendered JSON
+// page
+func ProjectResponse(pkg string) string {
+	return "json:" + Project(pkg)
+}
+
+// Download identifies a file while it is being downloaded. File names are
+// kept as they are: they are served by upstream as uploaded, and the case
+// and '+' of a local version (torch-2.0.0+cpu) belong to the name.
+func Download(pkg, file string) string {
+	return Package(pkg) + "/" + file
+}
@@ -0,0 +1,61 @@
+package cachekey
+
+import "testing"
+
+func TestPackage(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"numpy", "numpy"},
+		{"NumPy", "numpy"},
+		{"Flask_SQLAlchemy", "flask-sqlalchemy"},
+		{"flask.sqlalchemy", "flask-sqlalchemy"},
+		{"flask-sqlalchemy", "flask-sqlalchemy"},
+		{"zope.interface", "zope-interface"},
+		{"ruamel.yaml.clib", "ruamel-yaml-clib"},
+		{"foo__bar", "foo-bar"},
+		{"foo-_.-bar", "foo-bar"},
+		{"backports.zoneinfo", "backports-zoneinfo"},
+		{"Sphinx", "sphinx"},
+		{"PyYAML", "pyyaml"},
+		{"  requests \n", "requests"},
+		{"-leading", "leading"},
+		{"trailing_", "trailing"},
+		{"a", "a"},
+		{"0x", "0x"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Package(tt.name); got != tt.want {
+			t.Errorf("Package(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		// Normalizing is idempotent
+		if got := Package(Package(tt.name)); got != tt.want {
+			t.Errorf("Package(Package(%q)) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{Project("Flask_SQLAlchemy"), "package:flask-sqlalchemy"},
+		{ProjectResponse("zope.interface"), "json:package:zope-interface"},
+		{PackageListResponse, "json:package-list"},
+		{Download("Django", "Django-4.2.tar.gz"), "django/Django-4.2.tar.gz"},
+		{Download("torch", "torch-2.0.0+cpu-cp311-cp311-linux_x86_64.whl"), "torch/torch-2.0.0+cpu-cp311-cp311-linux_x86_64.whl"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("Expected %q, got %q", tt.want, tt.got)
+		}
+	}
+
+	// Every spelling of a project shares its keys
+	for _, name := range []string{"Flask_SQLAlchemy", "flask.sqlalchemy", "FLASK-SQLALCHEMY"} {
+		if Project(name) != Project("flask-sqlalchemy") || Download(name, "f.whl") != Download("flask-sqlalchemy", "f.whl") {
+			t.Errorf("Expected %q to share the keys of flask-sqlalchemy", name)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package cadence tracks how often each package's file list actually
+// changes upstream and derives how long it may stay cached, so packages that
+// rarely release are fetched rarely while busy ones stay fresh.
+package cadence
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// maxTracked bounds how many packages are tracked; the least recently
+// fetched are forgotten beyond it
+const maxTracked = 100000
+
+// Config configures adaptive TTLs
+type Config struct {
+	Initial time.Duration // TTL of a package seen for the first time
+	Min     time.Duration // Shortest TTL
+	Max     time.Duration // Longest TTL
+}
+
+// Stats reports what the tracker knows
+type Stats struct {
+	Tracked int `json:"tracked"`
+	AtMin   int `json:"at_min"` // Packages changing so often they get the shortest TTL
+	AtMax   int `json:"at_max"` // Packages stable enough to get the longest TTL
+}
+
+type history struct {
+	fingerprint uint64
+	changed     time.Time // When the file list was last seen to change, or first seen
+	fetched     time.Time
+	ttl         time.Duration
+}
+
+// Tracker adapts each package's TTL to how often its files change. Every
+// fetch that finds the file list unchanged doubles the TTL; a change sets it
+// to a quarter of the time since the previous change, so a package that
+// releases daily is checked every few hours. TTLs stay within [Min, Max].
+// A nil tracker tracks nothing.
+type Tracker struct {
+	cfg Config
+
+	mu       sync.Mutex
+	packages map[string]*history
+}
+
+// New creates a tracker; Initial is clamped to [Min, Max]
+func New(cfg Config) *Tracker {
+	if cfg.Min <= 0 {
+		cfg.Min = time.Minute
+	}
+	if cfg.Max < cfg.Min {
+		cfg.Max = cfg.Min
+	}
+	cfg.Initial = min(max(cfg.Initial, cfg.Min), cfg.Max)
+	return &Tracker{
+		cfg:      cfg,
+		packages: make(map[string]*history),
+	}
+}
+
+// Fingerprint identifies a file list, given each file's name and whether it
+// is yanked, in upstream order
+func Fingerprint(names []string, yanked []bool) uint64 {
+	h := fnv.New64a()
+	for i, name := range names {
+		_, _ = h.Write([]byte(name))
+		if i < len(yanked) && yanked[i] {
+			_, _ = h.Write([]byte{1})
+		}
+		_, _ = h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// Observe records a fetch of pkg's file list with the given fingerprint at
+// now and returns the TTL it may be cached for
+func (t *Tracker) Observe(pkg string, fingerprint uint64, now time.Time) time.Duration {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.packages[pkg]
+	switch {
+	case !ok:
+		if len(t.packages) >= maxTracked {
+			t.forgetOldest()
+		}
+		h = &history{fingerprint: fingerprint, changed: now, ttl: t.cfg.Initial}
+		t.packages[pkg] = h
+	case h.fingerprint == fingerprint:
+		h.ttl = t.clamp(2 * h.ttl)
+	default:
+		h.ttl = t.clamp(now.Sub(h.changed) / 4)
+		h.fingerprint = fingerprint
+		h.changed = now
+	}
+	h.fetched = now
+	return h.ttl
+}
+
+// TTL returns the TTL pkg was last given, if it is tracked
+func (t *Tracker) TTL(pkg string) (time.Duration, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, ok := t.packages[pkg]
+	if !ok {
+		return 0, false
+	}
+	return h.ttl, true
+}
+
+// Stats reports how many packages are tracked and how many sit at either
+// bound
+func (t *Tracker) Stats() Stats {
+	if t == nil {
+		return Stats{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := Stats{Tracked: len(t.packages)}
+	for _, h := range t.packages {
+		switch h.ttl {
+		case t.cfg.Min:
+			stats.AtMin++
+		case t.cfg.Max:
+			stats.AtMax++
+		}
+	}
+	return stats
+}
+
+func (t *Tracker) clamp(ttl time.Duration) time.Duration {
+	return min(max(ttl, t.cfg.Min), t.cfg.Max)
+}
+
+// forgetOldest drops the package fetched longest ago. Called with t.mu held.
+func (t *Tracker) forgetOldest() {
+	var oldest string
+	var oldestAt time.Time
+	for pkg, h := range t.packages {
+		if oldest == "" || h.fetched.Before(oldestAt) {
+			oldest, oldestAt = pkg, h.fetched
+		}
+	}
+	delete(t.packages, oldest)
+}
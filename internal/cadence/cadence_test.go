@@ -0,0 +1,76 @@
+package cadence
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTracker_StablePackagesGetLongerTTLs(t *testing.T) {
+	tr := New(Config{Initial: 5 * time.Minute, Min: time.Minute, Max: time.Hour})
+	if _, ok := tr.TTL("six"); ok {
+		t.Error("Expected an unseen package to have no adaptive TTL")
+	}
+
+	now := time.Now()
+	files := Fingerprint([]string{"six-1.16.0.tar.gz"}, nil)
+	if ttl := tr.Observe("six", files, now); ttl != 5*time.Minute {
+		t.Errorf("Expected the initial TTL for a new package, got %v", ttl)
+	}
+	for _, want := range []time.Duration{10 * time.Minute, 20 * time.Minute, 40 * time.Minute, time.Hour, time.Hour} {
+		now = now.Add(time.Hour)
+		if ttl := tr.Observe("six", files, now); ttl != want {
+			t.Errorf("Expected an unchanged package's TTL to double to %v, got %v", want, ttl)
+		}
+	}
+	if ttl, ok := tr.TTL("six"); !ok || ttl != time.Hour {
+		t.Errorf("Expected the last TTL to be remembered, got %v, %v", ttl, ok)
+	}
+	if stats := tr.Stats(); stats.Tracked != 1 || stats.AtMax != 1 {
+		t.Errorf("Expected one package at the maximum, got %+v", stats)
+	}
+}
+
+func TestTracker_ChangingPackagesGetShorterTTLs(t *testing.T) {
+	tr := New(Config{Initial: time.Hour, Min: time.Minute, Max: 24 * time.Hour})
+	now := time.Now()
+	tr.Observe("boto3", Fingerprint([]string{"boto3-1.0.whl"}, nil), now)
+
+	// Released again 20 minutes later
+	now = now.Add(20 * time.Minute)
+	if ttl := tr.Observe("boto3", Fingerprint([]string{"boto3-1.0.whl", "boto3-1.1.whl"}, nil), now); ttl != 5*time.Minute {
+		t.Errorf("Expected a quarter of the time between releases, got %v", ttl)
+	}
+
+	// Released again a minute later: the TTL bottoms out at the minimum
+	now = now.Add(time.Minute)
+	if ttl := tr.Observe("boto3", Fingerprint([]string{"boto3-1.0.whl", "boto3-1.1.whl", "boto3-1.2.whl"}, nil), now); ttl != time.Minute {
+		t.Errorf("Expected the minimum TTL, got %v", ttl)
+	}
+	if stats := tr.Stats(); stats.AtMin != 1 {
+		t.Errorf("Expected one package at the minimum, got %+v", stats)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	names := []string{"six-1.15.0.tar.gz", "six-1.16.0.tar.gz"}
+	if Fingerprint(names, nil) == Fingerprint(names, []bool{false, true}) {
+		t.Error("Expected yanking a file to change the fingerprint")
+	}
+	if Fingerprint(names, nil) != Fingerprint(names, []bool{false, false}) {
+		t.Error("Expected no yanked files to match no yanked state")
+	}
+	if Fingerprint([]string{"ab", "c"}, nil) == Fingerprint([]string{"a", "bc"}, nil) {
+		t.Error("Expected file names to be kept apart")
+	}
+}
+
+func TestTracker_Nil(t *testing.T) {
+	var tr *Tracker
+	tr.Observe("six", 1, time.Now())
+	if _, ok := tr.TTL("six"); ok {
+		t.Error("Expected a nil tracker to track nothing")
+	}
+	if stats := tr.Stats(); stats.Tracked != 0 {
+		t.Errorf("Expected no stats from a nil tracker, got %+v", stats)
+	}
+}
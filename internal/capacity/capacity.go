@@ -0,0 +1,216 @@
+// Package capacity forecasts when the cache reaches its size limit from its
+// growth over a sliding window, so operators can grow a cache volume before
+// eviction churn starts rather than after.
+package capacity
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+const (
+	// minHistory is the share of the window samples must span before a
+	// forecast is made, so the first minutes after a start don't alert
+	minHistory = 4
+
+	// clearRatio is how much further than the horizon the projection must
+	// move before an alert clears, so it doesn't flap around the horizon
+	clearRatio = 1.25
+)
+
+// Config configures a Forecaster
+type Config struct {
+	Usage    func() (used, quota int64, ok bool) // Current cache bytes and size limit
+	Interval time.Duration                       // Time between samples (default 5 minutes)
+	Window   time.Duration                       // Growth is measured over this much history (default 24 hours)
+	Horizon  time.Duration                       // Alert when the cache is projected full within this (0 = no alerts)
+	OnAlert  func(Forecast)                      // Called when an alert starts
+}
+
+// Forecast is the cache's utilization trend at the last sample
+type Forecast struct {
+	UsedBytes     int64   `json:"used_bytes"`
+	QuotaBytes    int64   `json:"quota_bytes"`
+	Utilization   float64 `json:"utilization"`          // UsedBytes / QuotaBytes
+	GrowthPerDay  int64   `json:"growth_bytes_per_day"` // Negative while the cache shrinks
+	Projected     bool    `json:"projected"`            // Enough history, and full or growing towards the limit
+	FullInSeconds int64   `json:"full_in_seconds"`      // Until the limit is reached, when projected
+	Alerting      bool    `json:"alerting"`             // Projected full within the horizon
+}
+
+// FullIn is the time until the cache is projected full
+func (f Forecast) FullIn() time.Duration {
+	return time.Duration(f.FullInSeconds) * time.Second
+}
+
+type sample struct {
+	at   time.Time
+	used int64
+}
+
+// Forecaster samples cache usage and fits its growth rate. A nil forecaster
+// has no forecast.
+type Forecaster struct {
+	cfg Config
+
+	mu       sync.Mutex
+	samples  []sample
+	forecast Forecast
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a forecaster. It returns nil when cfg.Usage is nil.
+func New(cfg Config) *Forecaster {
+	if cfg.Usage == nil {
+		return nil
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Minute
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 24 * time.Hour
+	}
+	return &Forecaster{cfg: cfg}
+}
+
+// Start samples usage in the background until Stop
+func (f *Forecaster) Start() {
+	if f == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	f.done = make(chan struct{})
+
+	f.check()
+	go func() {
+		defer close(f.done)
+		ticker := time.NewTicker(f.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				f.check()
+			}
+		}
+	}()
+}
+
+// Stop ends sampling
+func (f *Forecaster) Stop() {
+	if f == nil || f.cancel == nil {
+		return
+	}
+	f.cancel()
+	<-f.done
+}
+
+// Forecast returns the forecast made at the last sample
+func (f *Forecaster) Forecast() Forecast {
+	if f == nil {
+		return Forecast{}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.forecast
+}
+
+func (f *Forecaster) check() {
+	if used, quota, ok := f.cfg.Usage(); ok {
+		f.observe(time.Now(), used, quota)
+	}
+}
+
+// observe records a sample and updates the forecast and alert state
+func (f *Forecaster) observe(now time.Time, used, quota int64) {
+	f.mu.Lock()
+	f.samples = append(f.samples, sample{at: now, used: used})
+	cutoff := now.Add(-f.cfg.Window)
+	drop := 0
+	for drop < len(f.samples)-1 && f.samples[drop].at.Before(cutoff) {
+		drop++
+	}
+	f.samples = f.samples[drop:]
+
+	next := Forecast{UsedBytes: used, QuotaBytes: quota, Alerting: f.forecast.Alerting}
+	if quota > 0 {
+		next.Utilization = float64(used) / float64(quota)
+	}
+	perSecond, fitted := f.growth()
+	if fitted {
+		next.GrowthPerDay = int64(perSecond * (24 * time.Hour).Seconds())
+		switch {
+		case quota <= 0:
+		case used >= quota:
+			next.Projected = true
+		case perSecond > 0:
+			next.Projected = true
+			next.FullInSeconds = int64(float64(quota-used) / perSecond)
+		}
+	}
+
+	started, cleared := false, false
+	if f.cfg.Horizon > 0 {
+		within := next.Projected && next.FullIn() <= f.cfg.Horizon
+		beyond := !next.Projected || float64(next.FullIn()) > float64(f.cfg.Horizon)*clearRatio
+		switch {
+		case within && !next.Alerting:
+			next.Alerting, started = true, true
+		case beyond && next.Alerting:
+			next.Alerting, cleared = false, true
+		}
+	}
+	f.forecast = next
+	f.mu.Unlock()
+
+	switch {
+	case started:
+		log.Warn().
+			Int64("used_bytes", used).
+			Int64("quota_bytes", quota).
+			Int64("growth_bytes_per_day", next.GrowthPerDay).
+			Dur("full_in", next.FullIn()).
+			Msg("Cache projected to reach its size limit")
+		if f.cfg.OnAlert != nil {
+			f.cfg.OnAlert(next)
+		}
+	case cleared:
+		log.Info().Int64("used_bytes", used).Int64("growth_bytes_per_day", next.GrowthPerDay).Msg("Cache no longer projected to reach its size limit soon")
+	}
+}
+
+// growth fits the samples' bytes per second by least squares. It needs
+// samples spanning a quarter of the window.
+func (f *Forecaster) growth() (float64, bool) {
+	n := len(f.samples)
+	if n < 2 || f.samples[n-1].at.Sub(f.samples[0].at) < f.cfg.Window/minHistory {
+		return 0, false
+	}
+
+	origin := f.samples[0].at
+	var meanX, meanY float64
+	for _, s := range f.samples {
+		meanX += s.at.Sub(origin).Seconds()
+		meanY += float64(s.used)
+	}
+	meanX /= float64(n)
+	meanY /= float64(n)
+
+	var cov, variance float64
+	for _, s := range f.samples {
+		dx := s.at.Sub(origin).Seconds() - meanX
+		cov += dx * (float64(s.used) - meanY)
+		variance += dx * dx
+	}
+	if variance == 0 {
+		return 0, false
+	}
+	return cov / variance, true
+}
@@ -0,0 +1,101 @@
+package capacity
+
+import (
+	"testing"
+	"time"
+)
+
+const gb = 1 << 30
+
+func TestForecaster_Projection(t *testing.T) {
+	f := New(Config{
+		Usage:  func() (int64, int64, bool) { return 0, 0, false },
+		Window: 24 * time.Hour,
+	})
+	start := time.Now()
+
+	// Too little history for a forecast
+	f.observe(start, 10*gb, 100*gb)
+	f.observe(start.Add(time.Hour), 11*gb, 100*gb)
+	if forecast := f.Forecast(); forecast.Projected || forecast.GrowthPerDay != 0 {
+		t.Errorf("Expected no projection after an hour, got %+v", forecast)
+	}
+
+	// 1GB an hour: 24GB a day, 84GB to go
+	for hour := 2; hour <= 6; hour++ {
+		f.observe(start.Add(time.Duration(hour)*time.Hour), int64(10+hour)*gb, 100*gb)
+	}
+	forecast := f.Forecast()
+	if forecast.GrowthPerDay != 24*gb {
+		t.Errorf("Expected 24GB a day, got %d", forecast.GrowthPerDay)
+	}
+	if !forecast.Projected || forecast.FullIn() != 84*time.Hour {
+		t.Errorf("Expected the cache full in 84h, got %+v", forecast)
+	}
+	if forecast.Utilization != 0.16 {
+		t.Errorf("Expected 16%% utilization, got %v", forecast.Utilization)
+	}
+}
+
+func TestForecaster_Alert(t *testing.T) {
+	var alerts []Forecast
+	f := New(Config{
+		Usage:   func() (int64, int64, bool) { return 0, 0, false },
+		Window:  4 * time.Hour,
+		Horizon: 24 * time.Hour,
+		OnAlert: func(forecast Forecast) { alerts = append(alerts, forecast) },
+	})
+	start := time.Now()
+
+	// 1GB an hour with 100GB to go is beyond the horizon
+	f.observe(start, 0, 100*gb)
+	f.observe(start.Add(time.Hour), gb, 100*gb)
+	if f.Forecast().Alerting || len(alerts) != 0 {
+		t.Fatal("Expected no alert beyond the horizon")
+	}
+
+	// 10GB an hour with 59GB to go is within it, and alerts once
+	f.observe(start.Add(2*time.Hour), 11*gb, 100*gb)
+	f.observe(start.Add(3*time.Hour), 21*gb, 100*gb)
+	f.observe(start.Add(4*time.Hour), 31*gb, 100*gb)
+	f.observe(start.Add(5*time.Hour), 41*gb, 100*gb)
+	if !f.Forecast().Alerting || len(alerts) != 1 {
+		t.Fatalf("Expected one alert, got %d: %+v", len(alerts), f.Forecast())
+	}
+
+	// Growth stopping clears it once the samples showing it age out
+	for hour := 6; hour <= 10; hour++ {
+		f.observe(start.Add(time.Duration(hour)*time.Hour), 41*gb, 100*gb)
+	}
+	if f.Forecast().Alerting || len(alerts) != 1 {
+		t.Errorf("Expected the alert cleared, got %+v", f.Forecast())
+	}
+}
+
+func TestForecaster_Full(t *testing.T) {
+	f := New(Config{
+		Usage:   func() (int64, int64, bool) { return 0, 0, false },
+		Window:  time.Hour,
+		Horizon: time.Hour,
+	})
+	start := time.Now()
+
+	// An evicting cache stays at its limit
+	f.observe(start, 100*gb, 100*gb)
+	f.observe(start.Add(time.Hour), 100*gb, 100*gb)
+	if forecast := f.Forecast(); !forecast.Projected || forecast.FullInSeconds != 0 || !forecast.Alerting {
+		t.Errorf("Expected a full cache to alert, got %+v", forecast)
+	}
+}
+
+func TestNew_NoUsage(t *testing.T) {
+	if f := New(Config{}); f != nil {
+		t.Error("Expected no forecaster without a usage source")
+	}
+	var f *Forecaster
+	f.Start()
+	f.Stop()
+	if forecast := f.Forecast(); forecast.Projected {
+		t.Errorf("Expected an empty forecast, got %+v", forecast)
+	}
+}
@@ -0,0 +1,110 @@
+// Package capture records the requests a groxpi serves to a file and replays
+// them against another instance, to benchmark configuration and storage
+// changes with production-shaped traffic. Records carry the route, package,
+// file and timing of a request, never who made it: client addresses,
+// credentials and other headers are left out.
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+// Record is one captured request
+type Record struct {
+	Time     time.Time     `json:"time"`             // When the request arrived
+	Method   string        `json:"method"`           // GET or HEAD
+	Route    string        `json:"route"`            // Route pattern, e.g. /simple/:package/
+	Path     string        `json:"path"`             // Request path and query, including any mount prefix
+	Accept   string        `json:"accept,omitempty"` // Chooses between HTML and JSON pages
+	Package  string        `json:"package,omitempty"`
+	File     string        `json:"file,omitempty"`
+	Status   int           `json:"status"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Stats counts captured requests
+type Stats struct {
+	File     string `json:"file"`
+	Recorded int64  `json:"recorded"`
+	Failed   int64  `json:"failed"` // Records that could not be written
+}
+
+// Recorder appends records to a file as JSON lines. A nil recorder records
+// nothing.
+type Recorder struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+
+	recorded, failed atomic.Int64
+}
+
+// Open starts capturing to path, appending to what is already there
+func Open(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %w", err)
+	}
+	log.Info().Str("file", path).Msg("Capturing requests for replay")
+	return &Recorder{path: path, file: file}, nil
+}
+
+// Record appends rec to the capture file
+func (r *Recorder) Record(rec Record) {
+	if r == nil {
+		return
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		r.failed.Add(1)
+		return
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	if _, err := r.file.Write(line); err != nil {
+		// Capturing is best effort; one warning per failure would flood the
+		// log when the disk is full
+		if r.failed.Add(1) == 1 {
+			log.Warn().Err(err).Str("file", r.path).Msg("Failed to write capture record")
+		}
+		return
+	}
+	r.recorded.Add(1)
+}
+
+// Close stops capturing and closes the file
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// Stats reports what has been captured
+func (r *Recorder) Stats() Stats {
+	if r == nil {
+		return Stats{}
+	}
+	return Stats{File: r.path, Recorded: r.recorded.Load(), Failed: r.failed.Load()}
+}
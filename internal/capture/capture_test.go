@@ -0,0 +1,117 @@
+package capture
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	r.Record(Record{Time: start, Method: "GET", Route: "/simple/:package/", Path: "/simple/six/", Package: "six", Status: 200, Bytes: 512, Duration: time.Millisecond})
+	r.Record(Record{Time: start.Add(time.Second), Method: "GET", Route: "/simple/:package/:file", Path: "/simple/six/six-1.16.0-py2.py3-none-any.whl", Package: "six", File: "six-1.16.0-py2.py3-none-any.whl", Status: 200})
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	r.Record(Record{Path: "/simple/"}) // After Close
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var records []Record
+	if err := Read(file, func(rec Record) error {
+		records = append(records, rec)
+		return nil
+	}); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(records) != 2 || records[0].Package != "six" || !records[0].Time.Equal(start) || records[0].Duration != time.Millisecond || records[1].File == "" {
+		t.Errorf("Unexpected records %+v", records)
+	}
+	if stats := r.Stats(); stats.Recorded != 2 || stats.File != path {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	if err := Read(strings.NewReader("{not json}\n"), func(Record) error { return nil }); err == nil {
+		t.Error("Expected an invalid record to be rejected")
+	}
+}
+
+func TestRecorder_Nil(t *testing.T) {
+	var r *Recorder
+	r.Record(Record{Path: "/simple/"})
+	if err := r.Close(); err != nil || r.Stats() != (Stats{}) {
+		t.Error("Expected a nil recorder to record nothing")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.RequestURI())
+		mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/simple/missing/" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/simple/six/six.whl" {
+			http.Redirect(w, r, "https://cdn.example/six.whl", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+
+	start := time.Now()
+	captured := strings.Join([]string{
+		`{"time":"` + start.Format(time.RFC3339Nano) + `","method":"GET","path":"/simple/six/","status":200}`,
+		`{"time":"` + start.Add(200*time.Millisecond).Format(time.RFC3339Nano) + `","method":"GET","path":"/search?q=six","status":200}`,
+		`{"time":"` + start.Add(400*time.Millisecond).Format(time.RFC3339Nano) + `","method":"GET","path":"/simple/missing/","status":200}`,
+		`{"time":"` + start.Add(600*time.Millisecond).Format(time.RFC3339Nano) + `","method":"GET","path":"/simple/six/six.whl","status":302}`,
+	}, "\n")
+
+	report, err := Replay(context.Background(), strings.NewReader(captured), ReplayOptions{
+		Target: target.URL + "/",
+		Speed:  2,
+		Token:  "token",
+	})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if report.Requests != 4 || report.Failed != 0 || report.StatusChanged != 1 || report.Statuses[200] != 2 || report.Statuses[302] != 1 || report.Bytes < 4 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	// The captured 600ms replayed at twice the pace
+	if report.Duration < 300*time.Millisecond {
+		t.Errorf("Expected the captured pacing to be kept, replay took %s", report.Duration)
+	}
+	if !strings.Contains(strings.Join(paths, " "), "/search?q=six") {
+		t.Errorf("Expected the query to be replayed, got %v", paths)
+	}
+
+	if _, err := Replay(context.Background(), strings.NewReader(captured), ReplayOptions{}); err == nil {
+		t.Error("Expected a replay without a target to be rejected")
+	}
+}
@@ -0,0 +1,189 @@
+package capture
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRecordLine bounds one line of a capture file
+const maxRecordLine = 1024 * 1024
+
+// ReplayOptions configures a replay
+type ReplayOptions struct {
+	Target      string       // Base URL of the instance requests are sent to
+	Speed       float64      // Multiple of the captured pace (0 = as fast as Concurrency allows)
+	Concurrency int          // Requests in flight at most (default 16)
+	Token       string       // Bearer token for targets requiring one
+	Client      *http.Client // (nil = one that doesn't follow redirects)
+}
+
+// Report summarizes a replay
+type Report struct {
+	Requests      int           `json:"requests"`
+	Failed        int           `json:"failed"`         // Requests that got no response
+	StatusChanged int           `json:"status_changed"` // Responses whose status differs from the captured one
+	Statuses      map[int]int   `json:"statuses"`
+	Bytes         int64         `json:"bytes"`
+	Duration      time.Duration `json:"duration"`
+	P50           time.Duration `json:"p50"`
+	P95           time.Duration `json:"p95"`
+	P99           time.Duration `json:"p99"`
+	Max           time.Duration `json:"max"`
+}
+
+// Read calls fn with each record read from r, in order
+func Read(r io.Reader, fn func(Record) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("invalid capture record on line %d: %w", line, err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Replay re-issues the requests captured in r against opts.Target, keeping
+// the captured gaps between them scaled by opts.Speed. Records are expected
+// roughly in arrival order, as a server writes them; one behind schedule is
+// sent at once. Replay stops early when ctx ends.
+func Replay(ctx context.Context, r io.Reader, opts ReplayOptions) (*Report, error) {
+	if opts.Target == "" {
+		return nil, errors.New("no replay target")
+	}
+	if opts.Speed < 0 {
+		return nil, fmt.Errorf("invalid replay speed %v", opts.Speed)
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 16
+	}
+	client := opts.Client
+	if client == nil {
+		// A redirect to the CDN or upstream is the target's whole answer
+		client = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	}
+	target := strings.TrimSuffix(opts.Target, "/")
+
+	var (
+		mu        sync.Mutex
+		report    = &Report{Statuses: make(map[int]int)}
+		latencies []time.Duration
+		wg        sync.WaitGroup
+		slots     = make(chan struct{}, opts.Concurrency)
+		start     = time.Now()
+		first     time.Time
+	)
+	err := Read(r, func(rec Record) error {
+		if opts.Speed > 0 {
+			if first.IsZero() {
+				first = rec.Time
+			}
+			due := start.Add(time.Duration(float64(rec.Time.Sub(first)) / opts.Speed))
+			if wait := time.Until(due); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				}
+			}
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			status, size, latency, err := send(ctx, client, target, opts.Token, rec)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Requests++
+			if err != nil {
+				report.Failed++
+				return
+			}
+			report.Statuses[status]++
+			report.Bytes += size
+			if status != rec.Status {
+				report.StatusChanged++
+			}
+			latencies = append(latencies, latency)
+		}()
+		return nil
+	})
+	wg.Wait()
+
+	report.Duration = time.Since(start)
+	slices.Sort(latencies)
+	report.P50 = percentile(latencies, 0.50)
+	report.P95 = percentile(latencies, 0.95)
+	report.P99 = percentile(latencies, 0.99)
+	if len(latencies) > 0 {
+		report.Max = latencies[len(latencies)-1]
+	}
+	return report, err
+}
+
+// send issues rec against target and reads the whole response, as the
+// client that made it would have
+func send(ctx context.Context, client *http.Client, target, token string, rec Record) (int, int64, time.Duration, error) {
+	method := rec.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target+rec.Path, nil)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if rec.Accept != "" {
+		req.Header.Set("Accept", rec.Accept)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	begin := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	size, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return resp.StatusCode, size, time.Since(begin), nil
+}
+
+// percentile returns the p-th latency of sorted latencies (0 when empty)
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[min(len(sorted)-1, int(float64(len(sorted))*p))]
+}
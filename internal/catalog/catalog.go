@@ -0,0 +1,486 @@
+// Package catalog keeps bookkeeping about cached objects (size, hash, hit
+// count and access times) in an embedded bbolt database, so it survives
+// restarts instead of being rebuilt from file modification times.
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phuslu/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// flushInterval bounds how long recorded hits stay in memory only; batching
+// them keeps a disk write off every download
+const flushInterval = 5 * time.Second
+
+var (
+	objectsBucket = []byte("objects")
+	hashesBucket  = []byte("sha256") // SHA-256 digest -> key of an object with it
+	metaBucket    = []byte("meta")
+	schemaKey     = []byte("schema_version")
+)
+
+// SchemaVersion is the database layout this build reads and writes. It is
+// bumped, with a migration appended, whenever the layout changes:
+//
+//	1: objects bucket
+//	2: SHA-256 index
+const SchemaVersion = 2
+
+// migrations[i] upgrades a database from version i+1 to i+2
+var migrations = []func(tx *bolt.Tx) error{
+	buildHashIndex,
+}
+
+// ErrIncompatibleSchema is returned by Open for a database written by a
+// newer groxpi, which this one could misread or corrupt
+var ErrIncompatibleSchema = errors.New("incompatible metadata database schema")
+
+// Entry is what the catalog records about one cached object
+type Entry struct {
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256,omitempty"`
+	Hits         int64     `json:"hits"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastAccessed time.Time `json:"last_accessed"`
+}
+
+// Stats summarizes the objects in the catalog
+type Stats struct {
+	Objects int64 `json:"objects"`
+	Bytes   int64 `json:"bytes"`
+	Hits    int64 `json:"hits"`
+}
+
+// add adds (sign 1) or removes (sign -1) e from the totals
+func (s *Stats) add(e *Entry, sign int64) {
+	if e == nil {
+		return
+	}
+	s.Objects += sign
+	s.Bytes += sign * e.Size
+	s.Hits += sign * e.Hits
+}
+
+// Catalog records cached objects by storage key. Changes are held in memory
+// and written to the database in batches; a crash loses at most the last
+// flushInterval of hits and access times.
+type Catalog struct {
+	db        *bolt.DB
+	mu        sync.Mutex
+	pending   map[string]*Entry // Changes not yet written; nil marks a deletion
+	flushing  map[string]*Entry // Changes being written by Flush
+	flushMu   sync.Mutex        // Serializes flushes
+	stats     Stats
+	now       func() time.Time
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Open opens or creates the catalog database at path and starts flushing
+// changes in the background until Close
+func Open(path string) (*Catalog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create metadata database directory: %w", err)
+	}
+	// The timeout turns a second groxpi on the same file into an error
+	// rather than a hang
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metadata database: %w", err)
+	}
+
+	c := &Catalog{
+		db:      db,
+		pending: make(map[string]*Entry),
+		now:     time.Now,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	var from int
+	err = db.Update(func(tx *bolt.Tx) error {
+		if from, err = migrate(tx); err != nil {
+			return err
+		}
+		return tx.Bucket(objectsBucket).ForEach(func(k, v []byte) error {
+			c.stats.add(decode(v), 1)
+			return nil
+		})
+	})
+	if errors.Is(err, ErrIncompatibleSchema) {
+		_ = db.Close()
+		return nil, fmt.Errorf("%s was written by a newer groxpi (%w); upgrade groxpi or point GROXPI_METADATA_DB at another file", path, err)
+	}
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to load metadata database: %w", err)
+	}
+
+	if from > 0 && from < SchemaVersion {
+		log.Info().Str("path", path).Int("from", from).Int("to", SchemaVersion).Msg("Metadata database migrated")
+	}
+
+	go c.flushLoop()
+
+	log.Info().
+		Str("path", path).
+		Int64("objects", c.stats.Objects).
+		Msg("Metadata database opened")
+
+	return c, nil
+}
+
+// migrate brings the database to SchemaVersion, returning the version it
+// had (0 if new). Databases without a recorded version predate versioning and are
+// treated as version 1; new ones go through every migration too, which is
+// cheap while they are empty.
+func migrate(tx *bolt.Tx) (int, error) {
+	meta, err := tx.CreateBucketIfNotExists(metaBucket)
+	if err != nil {
+		return 0, err
+	}
+	from := 1
+	switch raw := meta.Get(schemaKey); {
+	case raw != nil:
+		if from, err = strconv.Atoi(string(raw)); err != nil || from < 1 {
+			return 0, fmt.Errorf("invalid schema version %q", raw)
+		}
+	case tx.Bucket(objectsBucket) == nil:
+		from = 0 // New database
+	}
+	if from > SchemaVersion {
+		return 0, fmt.Errorf("%w: version %d, this groxpi supports up to %d", ErrIncompatibleSchema, from, SchemaVersion)
+	}
+
+	if _, err := tx.CreateBucketIfNotExists(objectsBucket); err != nil {
+		return 0, err
+	}
+	for version := max(from, 1); version < SchemaVersion; version++ {
+		if err := migrations[version-1](tx); err != nil {
+			return 0, fmt.Errorf("failed to migrate from schema version %d: %w", version, err)
+		}
+	}
+	return from, meta.Put(schemaKey, []byte(strconv.Itoa(SchemaVersion)))
+}
+
+// buildHashIndex indexes the objects by SHA-256 digest. An index left by a
+// build that didn't record the schema version is rebuilt.
+func buildHashIndex(tx *bolt.Tx) error {
+	if tx.Bucket(hashesBucket) != nil {
+		if err := tx.DeleteBucket(hashesBucket); err != nil {
+			return err
+		}
+	}
+	hashes, err := tx.CreateBucket(hashesBucket)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(objectsBucket).ForEach(func(k, v []byte) error {
+		if e := decode(v); e != nil && e.SHA256 != "" {
+			return hashes.Put([]byte(strings.ToLower(e.SHA256)), k)
+		}
+		return nil
+	})
+}
+
+// RecordWrite records that key was stored with size bytes. Hits of an
+// earlier copy of the same key are kept.
+func (c *Catalog) RecordWrite(key string, size int64, sha256 string) {
+	c.update(key, func(e *Entry) *Entry {
+		now := c.now()
+		if e == nil {
+			e = &Entry{}
+		}
+		e.Size = size
+		e.SHA256 = sha256
+		e.CreatedAt = now
+		e.LastAccessed = now
+		return e
+	})
+}
+
+// RecordHit counts a read of key, adding it with size bytes if unknown
+func (c *Catalog) RecordHit(key string, size int64) {
+	c.update(key, func(e *Entry) *Entry {
+		now := c.now()
+		if e == nil {
+			e = &Entry{Size: size, CreatedAt: now}
+		}
+		e.Hits++
+		e.LastAccessed = now
+		return e
+	})
+}
+
+// Put records e for key as is, e.g. for files found on disk that the
+// catalog didn't know about
+func (c *Catalog) Put(key string, e Entry) {
+	c.update(key, func(*Entry) *Entry { return &e })
+}
+
+// Delete forgets key
+func (c *Catalog) Delete(key string) {
+	c.update(key, func(*Entry) *Entry { return nil })
+}
+
+// Get returns what is recorded about key
+func (c *Catalog) Get(key string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e := c.lookup(key); e != nil {
+		return *e, true
+	}
+	return Entry{}, false
+}
+
+// KeyForHash returns the key of an object recorded with the given SHA-256
+// digest, so a file published under several names is stored once
+func (c *Catalog) KeyForHash(sha256 string) (string, bool) {
+	sha256 = strings.ToLower(sha256)
+	if sha256 == "" {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Unwritten changes first
+	for _, changes := range []map[string]*Entry{c.pending, c.flushing} {
+		for key, e := range changes {
+			if e != nil && strings.EqualFold(e.SHA256, sha256) {
+				return key, true
+			}
+		}
+	}
+
+	var key string
+	_ = c.db.View(func(tx *bolt.Tx) error {
+		key = string(tx.Bucket(hashesBucket).Get([]byte(sha256)))
+		return nil
+	})
+	if key == "" {
+		return "", false
+	}
+	// The object may have been deleted or rewritten since the last flush
+	if e := c.lookup(key); e == nil || !strings.EqualFold(e.SHA256, sha256) {
+		return "", false
+	}
+	return key, true
+}
+
+// LastAccessed returns when key was last read or written
+func (c *Catalog) LastAccessed(key string) (time.Time, bool) {
+	e, ok := c.Get(key)
+	return e.LastAccessed, ok
+}
+
+// Range calls fn for every recorded object. It works on a snapshot, so fn
+// may change the catalog.
+func (c *Catalog) Range(fn func(key string, e Entry)) error {
+	c.mu.Lock()
+	snapshot := make(map[string]*Entry)
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(objectsBucket).ForEach(func(k, v []byte) error {
+			if e := decode(v); e != nil {
+				snapshot[string(k)] = e
+			}
+			return nil
+		})
+	})
+	for _, changes := range []map[string]*Entry{c.flushing, c.pending} {
+		for key, e := range changes {
+			if e == nil {
+				delete(snapshot, key)
+			} else {
+				snapshot[key] = e
+			}
+		}
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to read metadata database: %w", err)
+	}
+
+	for key, e := range snapshot {
+		fn(key, *e)
+	}
+	return nil
+}
+
+// Stats returns the number, total size and total hits of recorded objects
+func (c *Catalog) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Flush writes pending changes to the database
+func (c *Catalog) Flush() error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.mu.Lock()
+	batch := c.pending
+	if len(batch) == 0 {
+		c.mu.Unlock()
+		return nil
+	}
+	c.pending = make(map[string]*Entry)
+	c.flushing = batch
+	c.mu.Unlock()
+
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(objectsBucket)
+		hashes := tx.Bucket(hashesBucket)
+		for key, e := range batch {
+			if err := updateHash(hashes, key, decode(b.Get([]byte(key))), e); err != nil {
+				return err
+			}
+			if e == nil {
+				if err := b.Delete([]byte(key)); err != nil {
+					return err
+				}
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(key), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	c.mu.Lock()
+	c.flushing = nil
+	if err != nil {
+		// Keep the batch for the next flush unless it was superseded meanwhile
+		for key, e := range batch {
+			if _, ok := c.pending[key]; !ok {
+				c.pending[key] = e
+			}
+		}
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to write metadata database: %w", err)
+	}
+	return nil
+}
+
+// Close flushes pending changes and closes the database
+func (c *Catalog) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+		err = c.Flush()
+		if closeErr := c.db.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+func (c *Catalog) flushLoop() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if err := c.Flush(); err != nil {
+				log.Warn().Err(err).Msg("Failed to flush metadata database")
+			}
+		}
+	}
+}
+
+// update replaces key's entry with what fn returns for a copy of the
+// current one (nil if unknown); returning nil deletes it
+func (c *Catalog) update(key string, fn func(e *Entry) *Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	old := c.lookup(key)
+	var current *Entry
+	if old != nil {
+		copied := *old
+		current = &copied
+	}
+	updated := fn(current)
+	if old == nil && updated == nil {
+		return
+	}
+
+	c.stats.add(old, -1)
+	c.stats.add(updated, 1)
+	c.pending[key] = updated
+}
+
+// lookup returns key's entry, unwritten changes first; c.mu must be held
+func (c *Catalog) lookup(key string) *Entry {
+	if e, ok := c.pending[key]; ok {
+		return e
+	}
+	if e, ok := c.flushing[key]; ok {
+		return e
+	}
+	var e *Entry
+	_ = c.db.View(func(tx *bolt.Tx) error {
+		e = decode(tx.Bucket(objectsBucket).Get([]byte(key)))
+		return nil
+	})
+	return e
+}
+
+// updateHash moves key's hash index entry from its old digest to its new
+// one. An old digest indexed under another key is left alone.
+func updateHash(hashes *bolt.Bucket, key string, old, updated *Entry) error {
+	var oldHash, newHash []byte
+	if old != nil {
+		oldHash = []byte(strings.ToLower(old.SHA256))
+	}
+	if updated != nil {
+		newHash = []byte(strings.ToLower(updated.SHA256))
+	}
+
+	if len(oldHash) > 0 && string(oldHash) != string(newHash) && string(hashes.Get(oldHash)) == key {
+		if err := hashes.Delete(oldHash); err != nil {
+			return err
+		}
+	}
+	if len(newHash) > 0 {
+		return hashes.Put(newHash, []byte(key))
+	}
+	return nil
+}
+
+// decode parses a stored entry, returning nil for missing or corrupt data
+func decode(data []byte) *Entry {
+	if data == nil {
+		return nil
+	}
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil
+	}
+	return &e
+}
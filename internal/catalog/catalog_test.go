@@ -0,0 +1,212 @@
+package catalog
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestCatalog(t *testing.T, path string) *Catalog {
+	t.Helper()
+	c, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	return c
+}
+
+func TestCatalog_RecordAndReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "meta", "catalog.db")
+	c := openTestCatalog(t, path)
+
+	written := time.Unix(1700000000, 0).UTC()
+	c.now = func() time.Time { return written }
+	c.RecordWrite("packages/numpy/numpy-1.26.4.tar.gz", 100, "abc123")
+	c.RecordWrite("packages/six/six-1.16.0-py2.py3-none-any.whl", 50, "")
+
+	// Hits are seen before and after a flush
+	accessed := written.Add(time.Hour)
+	c.now = func() time.Time { return accessed }
+	c.RecordHit("packages/numpy/numpy-1.26.4.tar.gz", 100)
+	if err := c.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	c.RecordHit("packages/numpy/numpy-1.26.4.tar.gz", 100)
+	c.Delete("packages/six/six-1.16.0-py2.py3-none-any.whl")
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	c = openTestCatalog(t, path)
+	defer func() { _ = c.Close() }()
+
+	e, ok := c.Get("packages/numpy/numpy-1.26.4.tar.gz")
+	if !ok {
+		t.Fatal("Expected the entry to survive a reopen")
+	}
+	if e.Size != 100 || e.SHA256 != "abc123" || e.Hits != 2 {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+	if !e.CreatedAt.Equal(written) || !e.LastAccessed.Equal(accessed) {
+		t.Errorf("Expected created %v and accessed %v, got %+v", written, accessed, e)
+	}
+	if _, ok := c.Get("packages/six/six-1.16.0-py2.py3-none-any.whl"); ok {
+		t.Error("Expected the deleted entry to be gone")
+	}
+
+	if stats := c.Stats(); stats != (Stats{Objects: 1, Bytes: 100, Hits: 2}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestCatalog_RewriteKeepsHits(t *testing.T) {
+	c := openTestCatalog(t, filepath.Join(t.TempDir(), "catalog.db"))
+	defer func() { _ = c.Close() }()
+
+	c.RecordHit("packages/numpy/numpy-1.26.4.tar.gz", 80)
+	c.RecordWrite("packages/numpy/numpy-1.26.4.tar.gz", 100, "abc123")
+
+	e, _ := c.Get("packages/numpy/numpy-1.26.4.tar.gz")
+	if e.Hits != 1 || e.Size != 100 {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+	if stats := c.Stats(); stats != (Stats{Objects: 1, Bytes: 100, Hits: 1}) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestCatalog_Range(t *testing.T) {
+	c := openTestCatalog(t, filepath.Join(t.TempDir(), "catalog.db"))
+	defer func() { _ = c.Close() }()
+
+	c.RecordWrite("a", 1, "")
+	c.RecordWrite("b", 2, "")
+	if err := c.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	c.RecordWrite("c", 3, "")
+	c.Delete("a")
+
+	// Entries flushed and pending are both visited, and fn may change the catalog
+	seen := make(map[string]int64)
+	err := c.Range(func(key string, e Entry) {
+		seen[key] = e.Size
+		c.Delete(key)
+	})
+	if err != nil {
+		t.Fatalf("Range failed: %v", err)
+	}
+	if len(seen) != 2 || seen["b"] != 2 || seen["c"] != 3 {
+		t.Errorf("Unexpected entries %v", seen)
+	}
+	if stats := c.Stats(); stats.Objects != 0 {
+		t.Errorf("Expected an empty catalog, got %+v", stats)
+	}
+}
+
+func TestOpen_Locked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.db")
+	c := openTestCatalog(t, path)
+	defer func() { _ = c.Close() }()
+
+	if _, err := Open(path); err == nil {
+		t.Error("Expected opening a database in use to fail")
+	}
+}
+
+func TestOpen_MigratesUnversionedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.db")
+
+	// A database from before the hash index and schema versioning
+	db, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		t.Fatalf("bolt.Open failed: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(objectsBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("packages/numpy/numpy-1.26.4.tar.gz"), []byte(`{"size":100,"sha256":"ABC123","hits":3}`))
+	})
+	if err != nil {
+		t.Fatalf("Failed to write old database: %v", err)
+	}
+	_ = db.Close()
+
+	c := openTestCatalog(t, path)
+	defer func() { _ = c.Close() }()
+
+	if stats := c.Stats(); stats.Objects != 1 || stats.Hits != 3 {
+		t.Errorf("Expected the old entry to be loaded, got %+v", stats)
+	}
+	if key, ok := c.KeyForHash("abc123"); !ok || key != "packages/numpy/numpy-1.26.4.tar.gz" {
+		t.Errorf("Expected the hash index to be built, got %q, %v", key, ok)
+	}
+	_ = c.db.View(func(tx *bolt.Tx) error {
+		if got := string(tx.Bucket(metaBucket).Get(schemaKey)); got != "2" {
+			t.Errorf("Expected schema version 2 to be recorded, got %q", got)
+		}
+		return nil
+	})
+}
+
+func TestOpen_RefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.db")
+	c := openTestCatalog(t, path)
+	_ = c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put(schemaKey, []byte("99"))
+	})
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := Open(path); !errors.Is(err, ErrIncompatibleSchema) {
+		t.Errorf("Expected ErrIncompatibleSchema, got %v", err)
+	}
+}
+
+func TestCatalog_KeyForHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.db")
+	c := openTestCatalog(t, path)
+
+	c.RecordWrite("packages/numpy/numpy-1.26.4.tar.gz", 100, "ABC123")
+	c.RecordWrite("packages/six/six-1.16.0-py2.py3-none-any.whl", 50, "def456")
+
+	// Found before and after a flush
+	if key, ok := c.KeyForHash("abc123"); !ok || key != "packages/numpy/numpy-1.26.4.tar.gz" {
+		t.Errorf("Expected numpy for an unflushed write, got %q, %v", key, ok)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if key, ok := c.KeyForHash("ABC123"); !ok || key != "packages/numpy/numpy-1.26.4.tar.gz" {
+		t.Errorf("Expected numpy after a flush, got %q, %v", key, ok)
+	}
+
+	// Deletions and rewrites hide the old digest at once
+	c.Delete("packages/numpy/numpy-1.26.4.tar.gz")
+	c.RecordWrite("packages/six/six-1.16.0-py2.py3-none-any.whl", 50, "fed654")
+	if _, ok := c.KeyForHash("abc123"); ok {
+		t.Error("Expected deleted object's digest to be forgotten")
+	}
+	if _, ok := c.KeyForHash("def456"); ok {
+		t.Error("Expected rewritten object's old digest to be forgotten")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	c = openTestCatalog(t, path)
+	defer func() { _ = c.Close() }()
+	if key, ok := c.KeyForHash("fed654"); !ok || key != "packages/six/six-1.16.0-py2.py3-none-any.whl" {
+		t.Errorf("Expected six after reopening, got %q, %v", key, ok)
+	}
+	if _, ok := c.KeyForHash("abc123"); ok {
+		t.Error("Expected deleted object's digest to stay forgotten")
+	}
+}
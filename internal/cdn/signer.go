@@ -0,0 +1,155 @@
+package cdn
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Provider names accepted by NewSigner
+const (
+	ProviderCloudFront = "cloudfront"
+	ProviderHMAC       = "hmac"
+)
+
+// Config holds CDN signing configuration
+type Config struct {
+	BaseURL        string        // CDN origin URL, e.g. https://d111111abcdef8.cloudfront.net
+	Provider       string        // "cloudfront" or "hmac"
+	KeyPairID      string        // CloudFront public key / key pair ID
+	PrivateKeyPath string        // PEM-encoded RSA private key (CloudFront)
+	SigningSecret  string        // Shared secret (HMAC / Fastly token auth)
+	URLTTL         time.Duration // Lifetime of signed URLs
+}
+
+// Signer generates time-limited CDN URLs for stored objects
+type Signer interface {
+	// SignURL returns a signed URL for the given object path, valid until expires
+	SignURL(objectPath string, expires time.Time) (string, error)
+}
+
+// NewSigner creates a Signer for the configured provider
+func NewSigner(cfg *Config) (Signer, error) {
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("CDN base URL is required")
+	}
+
+	base := strings.TrimSuffix(cfg.BaseURL, "/")
+
+	switch strings.ToLower(cfg.Provider) {
+	case "", ProviderCloudFront:
+		if cfg.KeyPairID == "" {
+			return nil, fmt.Errorf("CloudFront key pair ID is required")
+		}
+		pemData, err := os.ReadFile(cfg.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CDN private key: %w", err)
+		}
+		key, err := parseRSAPrivateKey(pemData)
+		if err != nil {
+			return nil, err
+		}
+		return &cloudFrontSigner{baseURL: base, keyPairID: cfg.KeyPairID, key: key}, nil
+	case ProviderHMAC:
+		if cfg.SigningSecret == "" {
+			return nil, fmt.Errorf("CDN signing secret is required for hmac provider")
+		}
+		return &hmacSigner{baseURL: base, secret: []byte(cfg.SigningSecret)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported CDN provider: %s", cfg.Provider)
+	}
+}
+
+// parseRSAPrivateKey decodes a PKCS#1 or PKCS#8 PEM-encoded RSA private key
+func parseRSAPrivateKey(pemData []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode CDN private key PEM")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CDN private key: %w", err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("CDN private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// objectURL joins the CDN base URL and an object path, escaping each segment
+func objectURL(baseURL, objectPath string) string {
+	segments := strings.Split(strings.TrimPrefix(objectPath, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return baseURL + "/" + strings.Join(segments, "/")
+}
+
+// cloudFrontSigner signs URLs using a CloudFront canned policy
+type cloudFrontSigner struct {
+	baseURL   string
+	keyPairID string
+	key       *rsa.PrivateKey
+}
+
+// cloudFrontEncoding is base64 with CloudFront's URL-safe substitutions (+ → -, = → _, / → ~)
+var cloudFrontEncoding = strings.NewReplacer("+", "-", "=", "_", "/", "~")
+
+// SignURL returns a CloudFront canned-policy signed URL
+func (s *cloudFrontSigner) SignURL(objectPath string, expires time.Time) (string, error) {
+	resource := objectURL(s.baseURL, objectPath)
+	epoch := expires.Unix()
+
+	policy := fmt.Sprintf(`{"Statement":[{"Resource":"%s","Condition":{"DateLessThan":{"AWS:EpochTime":%d}}}]}`, resource, epoch)
+	digest := sha1.Sum([]byte(policy))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA1, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign CloudFront policy: %w", err)
+	}
+
+	encoded := cloudFrontEncoding.Replace(base64.StdEncoding.EncodeToString(signature))
+
+	return fmt.Sprintf("%s?Expires=%d&Signature=%s&Key-Pair-Id=%s", resource, epoch, encoded, s.keyPairID), nil
+}
+
+// hmacSigner signs URLs with an HMAC-SHA256 token, suitable for Fastly and
+// other edges that validate a shared-secret token in VCL/edge code
+type hmacSigner struct {
+	baseURL string
+	secret  []byte
+}
+
+// SignURL returns a URL carrying expires and signature query parameters.
+// The signature is hex(HMAC-SHA256(secret, "<escaped path>:<expires>")).
+func (s *hmacSigner) SignURL(objectPath string, expires time.Time) (string, error) {
+	resource := objectURL(s.baseURL, objectPath)
+	escapedPath := strings.TrimPrefix(resource, s.baseURL)
+	epoch := strconv.FormatInt(expires.Unix(), 10)
+
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(escapedPath + ":" + epoch))
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	return resource + "?expires=" + epoch + "&signature=" + signature, nil
+}
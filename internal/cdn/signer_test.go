@@ -0,0 +1,135 @@
+package cdn
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestKey(t *testing.T) (string, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "cdn.pem")
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(path, pemData, 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	return path, key
+}
+
+func TestNewSigner_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"missing base URL", Config{Provider: ProviderHMAC, SigningSecret: "s"}},
+		{"cloudfront missing key pair", Config{BaseURL: "https://cdn.example.com", Provider: ProviderCloudFront}},
+		{"cloudfront missing key file", Config{BaseURL: "https://cdn.example.com", KeyPairID: "K1", PrivateKeyPath: "/nonexistent.pem"}},
+		{"hmac missing secret", Config{BaseURL: "https://cdn.example.com", Provider: ProviderHMAC}},
+		{"unknown provider", Config{BaseURL: "https://cdn.example.com", Provider: "akamai"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSigner(&tt.cfg); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestCloudFrontSigner_SignURL(t *testing.T) {
+	keyPath, key := writeTestKey(t)
+
+	signer, err := NewSigner(&Config{
+		BaseURL:        "https://d111.cloudfront.net/",
+		Provider:       ProviderCloudFront,
+		KeyPairID:      "KTESTKEY",
+		PrivateKeyPath: keyPath,
+	})
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+
+	expires := time.Unix(1700000000, 0)
+	signed, err := signer.SignURL("groxpi/packages/numpy/numpy-1.0+cpu.whl", expires)
+	if err != nil {
+		t.Fatalf("SignURL failed: %v", err)
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("Failed to parse signed URL: %v", err)
+	}
+
+	resource := "https://d111.cloudfront.net/groxpi/packages/numpy/numpy-1.0+cpu.whl"
+	if !strings.HasPrefix(signed, resource+"?") {
+		t.Errorf("Expected signed URL to start with %s, got %s", resource, signed)
+	}
+
+	q := u.Query()
+	if q.Get("Expires") != "1700000000" {
+		t.Errorf("Expected Expires=1700000000, got %s", q.Get("Expires"))
+	}
+	if q.Get("Key-Pair-Id") != "KTESTKEY" {
+		t.Errorf("Expected Key-Pair-Id=KTESTKEY, got %s", q.Get("Key-Pair-Id"))
+	}
+
+	// Undo CloudFront's URL-safe substitutions and verify against the public key
+	sigParam := strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(q.Get("Signature"))
+	signature, err := base64.StdEncoding.DecodeString(sigParam)
+	if err != nil {
+		t.Fatalf("Failed to decode signature: %v", err)
+	}
+
+	policy := fmt.Sprintf(`{"Statement":[{"Resource":"%s","Condition":{"DateLessThan":{"AWS:EpochTime":1700000000}}}]}`, resource)
+	digest := sha1.Sum([]byte(policy))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], signature); err != nil {
+		t.Errorf("Signature verification failed: %v", err)
+	}
+}
+
+func TestHMACSigner_SignURL(t *testing.T) {
+	signer, err := NewSigner(&Config{
+		BaseURL:       "https://cdn.example.com",
+		Provider:      ProviderHMAC,
+		SigningSecret: "topsecret",
+	})
+	if err != nil {
+		t.Fatalf("NewSigner failed: %v", err)
+	}
+
+	signed, err := signer.SignURL("packages/requests/requests-2.31.0.tar.gz", time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatalf("SignURL failed: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("topsecret"))
+	mac.Write([]byte("/packages/requests/requests-2.31.0.tar.gz:1700000000"))
+	expected := "https://cdn.example.com/packages/requests/requests-2.31.0.tar.gz?expires=1700000000&signature=" +
+		hex.EncodeToString(mac.Sum(nil))
+
+	if signed != expected {
+		t.Errorf("Expected %s, got %s", expected, signed)
+	}
+}
@@ -0,0 +1,234 @@
+// Package chaos injects faults into groxpi's outgoing HTTP traffic (the
+// upstream index and S3), for game-days that check how a staging deployment
+// copes with a slow or failing dependency. Nothing is injected unless a
+// server is explicitly configured for it.
+package chaos
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+// Fault is a kind of injected failure
+type Fault string
+
+// Faults
+const (
+	Delay   Fault = "delay"   // Hold the request for up to MaxDelay before sending it
+	Reset   Fault = "reset"   // Fail the request as if the connection was reset
+	Partial Fault = "partial" // Cut the response body off partway through
+)
+
+// Boundaries faults can be injected at
+const (
+	Upstream = "upstream" // Index pages and file downloads
+	Storage  = "storage"  // S3 requests, including the L2 tier of hybrid storage
+)
+
+var (
+	knownFaults     = []Fault{Delay, Reset, Partial}
+	knownBoundaries = []string{Upstream, Storage}
+)
+
+// partialUnknownLength bounds how much of a body of unknown length is
+// buffered to pick where a partial fault cuts it
+const partialUnknownLength = 64 * 1024
+
+// Config selects which faults are injected where
+type Config struct {
+	Faults     []string      // Fault names
+	Boundaries []string      // Boundary names
+	Rate       float64       // Share of requests that get a fault, 0 to 1
+	MaxDelay   time.Duration // Longest delay injected
+}
+
+// Injector injects faults into requests through its transports. A nil
+// injector injects nothing.
+type Injector struct {
+	faults     []Fault
+	boundaries map[string]bool
+	rate       float64
+	maxDelay   time.Duration
+
+	counts map[string]map[Fault]*atomic.Int64 // Boundary -> fault -> injected
+}
+
+// New creates an injector, rejecting unknown fault and boundary names
+func New(cfg Config) (*Injector, error) {
+	if cfg.Rate < 0 || cfg.Rate > 1 {
+		return nil, fmt.Errorf("invalid fault injection rate %v: must be between 0 and 1", cfg.Rate)
+	}
+
+	i := &Injector{
+		boundaries: make(map[string]bool),
+		rate:       cfg.Rate,
+		maxDelay:   cfg.MaxDelay,
+		counts:     make(map[string]map[Fault]*atomic.Int64),
+	}
+	for _, name := range cfg.Faults {
+		fault := Fault(strings.ToLower(name))
+		if !slices.Contains(knownFaults, fault) {
+			return nil, fmt.Errorf("unknown fault %q", name)
+		}
+		i.faults = append(i.faults, fault)
+	}
+	for _, name := range cfg.Boundaries {
+		boundary := strings.ToLower(name)
+		if !slices.Contains(knownBoundaries, boundary) {
+			return nil, fmt.Errorf("unknown fault injection boundary %q", name)
+		}
+		i.boundaries[boundary] = true
+		i.counts[boundary] = make(map[Fault]*atomic.Int64)
+		for _, fault := range i.faults {
+			i.counts[boundary][fault] = &atomic.Int64{}
+		}
+	}
+	if len(i.faults) == 0 || len(i.boundaries) == 0 {
+		return nil, errors.New("fault injection needs at least one fault and one boundary")
+	}
+
+	log.Warn().
+		Strs("faults", cfg.Faults).
+		Strs("boundaries", cfg.Boundaries).
+		Float64("rate", cfg.Rate).
+		Dur("max_delay", cfg.MaxDelay).
+		Msg("Fault injection enabled, requests will fail on purpose")
+	return i, nil
+}
+
+// Transport wraps next so requests through it may get a fault, if the
+// injector covers boundary
+func (i *Injector) Transport(boundary string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if i == nil || !i.boundaries[boundary] {
+		return next
+	}
+	return &faultyTransport{injector: i, boundary: boundary, next: next}
+}
+
+// Stats reports the faults injected so far by boundary and fault
+func (i *Injector) Stats() map[string]map[string]int64 {
+	if i == nil {
+		return nil
+	}
+	stats := make(map[string]map[string]int64, len(i.counts))
+	for boundary, faults := range i.counts {
+		stats[boundary] = make(map[string]int64, len(faults))
+		for fault, count := range faults {
+			stats[boundary][string(fault)] = count.Load()
+		}
+	}
+	return stats
+}
+
+// pick returns the fault for the next request, if it gets one
+func (i *Injector) pick() (Fault, bool) {
+	if rand.Float64() >= i.rate {
+		return "", false
+	}
+	return i.faults[rand.IntN(len(i.faults))], true
+}
+
+type faultyTransport struct {
+	injector *Injector
+	boundary string
+	next     http.RoundTripper
+}
+
+func (t *faultyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault, ok := t.injector.pick()
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+	t.injector.counts[t.boundary][fault].Add(1)
+	log.Debug().Str("boundary", t.boundary).Str("fault", string(fault)).Str("url", req.URL.String()).Msg("Injecting fault")
+
+	switch fault {
+	case Delay:
+		if t.injector.maxDelay > 0 {
+			timer := time.NewTimer(rand.N(t.injector.maxDelay))
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-req.Context().Done():
+				if req.Body != nil {
+					_ = req.Body.Close()
+				}
+				return nil, req.Context().Err()
+			}
+		}
+		return t.next.RoundTrip(req)
+
+	case Reset:
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, fmt.Errorf("injected fault: %w", syscall.ECONNRESET)
+
+	default: // Partial
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return resp, err
+		}
+		limit := resp.ContentLength
+		if limit <= 0 {
+			// Buffer the start of a body of unknown length, so the cut
+			// falls within it even when it is short
+			head, err := io.ReadAll(io.LimitReader(resp.Body, partialUnknownLength))
+			if err != nil {
+				_ = resp.Body.Close()
+				return nil, err
+			}
+			limit = int64(len(head))
+			resp.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(head), resp.Body), Closer: resp.Body}
+		}
+		var cut int64
+		if limit > 0 {
+			cut = rand.Int64N(limit)
+		}
+		resp.Body = &truncatedBody{ReadCloser: resp.Body, remaining: cut}
+		return resp, nil
+	}
+}
+
+// readCloser reads from a Reader and closes a Closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// truncatedBody ends a body with io.ErrUnexpectedEOF after remaining bytes,
+// as a connection dropped mid-transfer does. A body that ends before the
+// cut ends with io.ErrUnexpectedEOF too, so the fault never goes unseen.
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
@@ -0,0 +1,108 @@
+package chaos
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNew_RejectsInvalidSettings(t *testing.T) {
+	tests := map[string]Config{
+		"unknown fault":    {Faults: []string{"explode"}, Boundaries: []string{Upstream}, Rate: 0.1},
+		"unknown boundary": {Faults: []string{"reset"}, Boundaries: []string{"disk"}, Rate: 0.1},
+		"rate above one":   {Faults: []string{"reset"}, Boundaries: []string{Upstream}, Rate: 2},
+		"no faults":        {Boundaries: []string{Upstream}, Rate: 0.1},
+	}
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := New(cfg); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func newServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTransport(t *testing.T) {
+	body := strings.Repeat("groxpi ", 1000)
+	server := newServer(t, body)
+
+	get := func(injector *Injector, boundary string) (string, error) {
+		t.Helper()
+		client := &http.Client{Transport: injector.Transport(boundary, nil)}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		data, err := io.ReadAll(resp.Body)
+		return string(data), err
+	}
+
+	t.Run("reset", func(t *testing.T) {
+		injector, err := New(Config{Faults: []string{"reset"}, Boundaries: []string{Upstream}, Rate: 1})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		if _, err := get(injector, Upstream); !errors.Is(err, syscall.ECONNRESET) {
+			t.Errorf("Expected a connection reset, got %v", err)
+		}
+		if got := injector.Stats()[Upstream]["reset"]; got != 1 {
+			t.Errorf("Expected one reset counted, got %d", got)
+		}
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		injector, err := New(Config{Faults: []string{"partial"}, Boundaries: []string{Upstream}, Rate: 1})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		data, err := get(injector, Upstream)
+		if !errors.Is(err, io.ErrUnexpectedEOF) || len(data) >= len(body) {
+			t.Errorf("Expected a truncated body, got %d of %d bytes and %v", len(data), len(body), err)
+		}
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		injector, err := New(Config{Faults: []string{"delay"}, Boundaries: []string{Upstream}, Rate: 1, MaxDelay: 10 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		if data, err := get(injector, Upstream); err != nil || data != body {
+			t.Errorf("Expected the full body after a delay, got %d bytes and %v", len(data), err)
+		}
+	})
+
+	t.Run("other boundary", func(t *testing.T) {
+		injector, err := New(Config{Faults: []string{"reset"}, Boundaries: []string{Storage}, Rate: 1})
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		if data, err := get(injector, Upstream); err != nil || data != body {
+			t.Errorf("Expected upstream requests untouched, got %v", err)
+		}
+	})
+
+	t.Run("nil injector", func(t *testing.T) {
+		var injector *Injector
+		if data, err := get(injector, Upstream); err != nil || data != body {
+			t.Errorf("Expected a nil injector to inject nothing, got %v", err)
+		}
+		if injector.Stats() != nil {
+			t.Error("Expected no stats from a nil injector")
+		}
+	})
+}
@@ -0,0 +1,207 @@
+// Package clientid identifies the clients of the index from their
+// User-Agent and an optional team header, so traffic can be attributed to
+// the tools, teams and pipelines it comes from.
+package clientid
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	// Unknown labels requests without a User-Agent
+	Unknown = "unknown"
+
+	// Other labels installers not in knownInstallers, and the teams seen
+	// after maxTracked combinations are counted
+	Other = "other"
+
+	// maxTeamLength caps honored team header values
+	maxTeamLength = 64
+
+	// maxTracked bounds the combinations counted, so a client sending a new
+	// team on every request can't grow the metrics without limit
+	maxTracked = 200
+)
+
+// knownInstallers are the clients labeled by name; their User-Agent starts
+// with name/version
+var knownInstallers = map[string]bool{
+	"pip": true, "uv": true, "poetry": true, "pdm": true, "pipenv": true,
+	"hatch": true, "pex": true, "twine": true, "conda": true, "rye": true,
+	"bandersnatch": true, "devpi-server": true, "groxpi": true,
+}
+
+// Identity describes the client behind a request
+type Identity struct {
+	Installer      string `json:"installer"`                // Client name, Unknown or Other
+	Version        string `json:"version,omitempty"`        // Client version
+	Python         string `json:"python,omitempty"`         // Python version, from pip and uv
+	Implementation string `json:"implementation,omitempty"` // Python implementation, e.g. CPython
+	System         string `json:"system,omitempty"`         // Operating system, e.g. Linux
+	CI             bool   `json:"ci"`                       // Whether the client runs in CI
+	Team           string `json:"team,omitempty"`           // Value of the team header
+}
+
+// linehaul is the JSON pip and uv append to their User-Agent
+type linehaul struct {
+	Installer struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"installer"`
+	Python         string `json:"python"`
+	Implementation struct {
+		Name string `json:"name"`
+	} `json:"implementation"`
+	System struct {
+		Name string `json:"name"`
+	} `json:"system"`
+	CI *bool `json:"ci"`
+}
+
+// Parse identifies the client sending userAgent, along with team, the value
+// of the configured team header. Invalid team values are ignored.
+func Parse(userAgent, team string) Identity {
+	id := Identity{Installer: Unknown}
+	if validTeam(team) {
+		id.Team = team
+	}
+
+	userAgent = strings.TrimSpace(userAgent)
+	if userAgent == "" {
+		return id
+	}
+
+	// pip/23.0 {"installer":{"name":"pip","version":"23.0"},"python":"3.11.4",...}
+	product, rest, _ := strings.Cut(userAgent, " ")
+	name, version, _ := strings.Cut(product, "/")
+	name = strings.ToLower(name)
+
+	var data linehaul
+	if strings.HasPrefix(rest, "{") && json.Unmarshal([]byte(rest), &data) == nil {
+		if data.Installer.Name != "" {
+			name, version = strings.ToLower(data.Installer.Name), data.Installer.Version
+		}
+		id.Python = data.Python
+		id.Implementation = data.Implementation.Name
+		id.System = data.System.Name
+		id.CI = data.CI != nil && *data.CI
+	}
+
+	if !knownInstallers[name] {
+		id.Installer = Other
+		return id
+	}
+	id.Installer = name
+	id.Version = version
+	return id
+}
+
+// validTeam reports whether a team header value is safe to log and use as
+// a metrics label
+func validTeam(team string) bool {
+	if team == "" || len(team) > maxTeamLength {
+		return false
+	}
+	for i := 0; i < len(team); i++ {
+		ch := team[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		case ch == '-', ch == '_', ch == '.', ch == '/', ch == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Count is the traffic of one installer and team
+type Count struct {
+	Installer     string `json:"installer"`
+	Team          string `json:"team"`
+	CI            bool   `json:"ci"`
+	Requests      int64  `json:"requests"`
+	Downloads     int64  `json:"downloads"`
+	DownloadBytes int64  `json:"download_bytes"`
+}
+
+type countKey struct {
+	installer, team string
+	ci              bool
+}
+
+// Stats counts requests per installer, team and CI use. A nil Stats counts
+// nothing.
+type Stats struct {
+	mu     sync.Mutex
+	counts map[countKey]*Count
+}
+
+// NewStats creates empty client counters
+func NewStats() *Stats {
+	return &Stats{counts: make(map[countKey]*Count)}
+}
+
+// Record counts a request from id, and the bytes sent when it downloaded a
+// package file
+func (s *Stats) Record(id Identity, download bool, bytes int64) {
+	if s == nil {
+		return
+	}
+	key := countKey{installer: id.Installer, team: id.Team, ci: id.CI}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count, ok := s.counts[key]
+	if !ok {
+		if len(s.counts) >= maxTracked {
+			key.team = Other
+			count, ok = s.counts[key]
+		}
+		if !ok {
+			count = &Count{Installer: key.installer, Team: key.team, CI: key.ci}
+			s.counts[key] = count
+		}
+	}
+	count.Requests++
+	if download {
+		count.Downloads++
+		if bytes > 0 {
+			count.DownloadBytes += bytes
+		}
+	}
+}
+
+// Snapshot returns the counters ordered by installer, team and CI use
+func (s *Stats) Snapshot() []Count {
+	if s == nil {
+		return []Count{}
+	}
+	s.mu.Lock()
+	counts := make([]Count, 0, len(s.counts))
+	for _, count := range s.counts {
+		counts = append(counts, *count)
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(counts, func(a, b Count) int {
+		if c := cmp.Compare(a.Installer, b.Installer); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Team, b.Team); c != 0 {
+			return c
+		}
+		if a.CI == b.CI {
+			return 0
+		}
+		if a.CI {
+			return 1
+		}
+		return -1
+	})
+	return counts
+}
@@ -0,0 +1,87 @@
+package clientid
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		userAgent, team string
+		want            Identity
+	}{
+		{
+			userAgent: `pip/24.0 {"ci":true,"cpu":"x86_64","implementation":{"name":"CPython","version":"3.12.1"},"installer":{"name":"pip","version":"24.0"},"python":"3.12.1","system":{"name":"Linux","release":"6.5.0"}}`,
+			team:      "data-platform",
+			want:      Identity{Installer: "pip", Version: "24.0", Python: "3.12.1", Implementation: "CPython", System: "Linux", CI: true, Team: "data-platform"},
+		},
+		{
+			userAgent: `uv/0.4.18 {"installer":{"name":"uv","version":"0.4.18"},"python":"3.11.9","implementation":{"name":"CPython","version":"3.11.9"},"system":{"name":"Darwin","release":"23.6.0"},"ci":null}`,
+			want:      Identity{Installer: "uv", Version: "0.4.18", Python: "3.11.9", Implementation: "CPython", System: "Darwin"},
+		},
+		{
+			userAgent: "Poetry/1.8.3 (+https://python-poetry.org)",
+			want:      Identity{Installer: "poetry", Version: "1.8.3"},
+		},
+		{
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64)",
+			team:      "bad team!",
+			want:      Identity{Installer: Other},
+		},
+		{
+			userAgent: `pip/24.0 {not json`,
+			want:      Identity{Installer: "pip", Version: "24.0"},
+		},
+		{
+			want: Identity{Installer: Unknown},
+		},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.userAgent, tt.team); got != tt.want {
+			t.Errorf("Parse(%q, %q) = %+v, want %+v", tt.userAgent, tt.team, got, tt.want)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	stats := NewStats()
+	pip := Identity{Installer: "pip", Team: "ml", CI: true}
+	stats.Record(pip, true, 100)
+	stats.Record(pip, false, 50)
+	stats.Record(Identity{Installer: "uv"}, true, 10)
+
+	counts := stats.Snapshot()
+	if len(counts) != 2 {
+		t.Fatalf("Expected 2 counts, got %+v", counts)
+	}
+	if got := counts[0]; got != (Count{Installer: "pip", Team: "ml", CI: true, Requests: 2, Downloads: 1, DownloadBytes: 100}) {
+		t.Errorf("Unexpected pip count %+v", got)
+	}
+	if got := counts[1]; got.Installer != "uv" || got.Downloads != 1 {
+		t.Errorf("Unexpected uv count %+v", got)
+	}
+}
+
+func TestStats_Bounded(t *testing.T) {
+	stats := NewStats()
+	for i := range maxTracked + 50 {
+		stats.Record(Identity{Installer: "pip", Team: fmt.Sprintf("team-%d", i)}, false, 0)
+	}
+	counts := stats.Snapshot()
+	if len(counts) != maxTracked+1 {
+		t.Fatalf("Expected %d counts, got %d", maxTracked+1, len(counts))
+	}
+	for _, count := range counts {
+		if count.Team == Other && count.Requests != 50 {
+			t.Errorf("Expected the overflow counted as %q, got %+v", Other, count)
+		}
+	}
+}
+
+func TestStats_Nil(t *testing.T) {
+	var stats *Stats
+	stats.Record(Identity{Installer: "pip"}, true, 1)
+	if counts := stats.Snapshot(); len(counts) != 0 {
+		t.Errorf("Expected nil stats to count nothing, got %+v", counts)
+	}
+}
@@ -0,0 +1,155 @@
+package compat
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/config"
+	"github.com/huyhandes/groxpi/internal/server"
+)
+
+// Requirements with enough transitive dependencies that uv fetches many
+// project pages and files in parallel
+var requirements = []string{
+	"requests",
+	"httpx",
+	"rich",
+	"click",
+	"attrs",
+	"packaging",
+	"pydantic",
+}
+
+// proxy is a groxpi instance listening on a loopback port
+type proxy struct {
+	URL         string
+	connections atomic.Int64
+	requests    atomic.Int64
+}
+
+// startProxy runs groxpi in uv compatibility mode against the index in
+// GROXPI_COMPAT_INDEX_URL (PyPI by default)
+func startProxy(t *testing.T) *proxy {
+	t.Helper()
+
+	t.Setenv("GROXPI_INDEX_URL", getEnv("GROXPI_COMPAT_INDEX_URL", "https://pypi.org/simple/"))
+	t.Setenv("GROXPI_CACHE_DIR", t.TempDir())
+	t.Setenv("GROXPI_UV_COMPAT", "true")
+	t.Setenv("GROXPI_LOGGING_LEVEL", "ERROR")
+
+	srv := server.New(config.Load())
+	t.Cleanup(srv.Close)
+
+	p := &proxy{}
+	httpServer := srv.HTTPServer()
+	handler := httpServer.Handler
+	httpServer.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.requests.Add(1)
+		handler.ServeHTTP(w, r)
+	})
+	httpServer.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			p.connections.Add(1)
+		}
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go func() { _ = httpServer.Serve(ln) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(ctx)
+	})
+
+	p.URL = "http://" + ln.Addr().String()
+	return p
+}
+
+// run executes a client command, failing the test with its output on error
+func run(t *testing.T, env []string, name string, args ...string) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s %s failed: %v\n%s", name, strings.Join(args, " "), err, output)
+	}
+}
+
+func requireTool(t *testing.T, name string) {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("Skipping client compatibility test in short mode")
+	}
+	if _, err := exec.LookPath(name); err != nil {
+		t.Skipf("%s not found in PATH", name)
+	}
+}
+
+func TestUV_ParallelInstall(t *testing.T) {
+	requireTool(t, "uv")
+	p := startProxy(t)
+
+	env := []string{
+		"UV_NO_CACHE=1",
+		"UV_CONCURRENT_DOWNLOADS=64",
+		"UV_INDEX_URL=" + p.URL + "/simple/",
+	}
+	install := func(target string) {
+		args := append([]string{"pip", "install", "--target", target}, requirements...)
+		run(t, env, "uv", args...)
+	}
+
+	// Cold cache: every page and file is fetched from upstream
+	install(filepath.Join(t.TempDir(), "cold"))
+
+	// Parallel fetches must share kept-alive connections rather than
+	// opening one per request
+	requests, connections := p.requests.Load(), p.connections.Load()
+	t.Logf("cold install: %d requests over %d connections", requests, connections)
+	if connections >= requests {
+		t.Errorf("Expected connection reuse, got %d connections for %d requests", connections, requests)
+	}
+
+	// Warm cache: the same install is served from groxpi's cache
+	install(filepath.Join(t.TempDir(), "warm"))
+}
+
+func TestPip_Download(t *testing.T) {
+	requireTool(t, "python3")
+	if err := exec.Command("python3", "-m", "pip", "--version").Run(); err != nil {
+		t.Skip("pip is not installed for python3")
+	}
+	p := startProxy(t)
+
+	args := append([]string{
+		"-m", "pip", "download",
+		"--no-cache-dir",
+		"--disable-pip-version-check",
+		"--index-url", p.URL + "/simple/",
+		"--dest", t.TempDir(),
+	}, requirements...)
+	run(t, nil, "python3", args...)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
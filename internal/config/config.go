@@ -1,35 +1,107 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/huyhandes/groxpi/internal/constraint"
+	"github.com/huyhandes/groxpi/internal/distfile"
+	"github.com/huyhandes/groxpi/internal/feature"
+	"github.com/huyhandes/groxpi/internal/logger"
+	"github.com/huyhandes/groxpi/internal/retention"
+	"github.com/huyhandes/groxpi/internal/version"
 )
 
 type Config struct {
 	// Index configuration
-	IndexURL       string
-	IndexTTL       time.Duration
-	ExtraIndexURLs []string
-	ExtraIndexTTLs []time.Duration
+	IndexURL          string
+	IndexTTL          time.Duration
+	IndexEarlyRefresh float64       // Eagerness of probabilistic early index refresh (0 = refresh on expiry)
+	DegradedTTL       time.Duration // TTL for responses built from stale data while upstream fails
+	StableJSON        bool          // Render index pages deterministically: sorted JSON keys, files and versions
+	ExtraIndexURLs    []string
+	ExtraIndexTTLs    []time.Duration
+	IndexUsername     string // Basic auth for the upstream index host (optional)
+	IndexPassword     string
+	IndexQuirks       []string     // Simple API deviations of the index to tolerate, e.g. "html-only" or "artifactory"
+	IndexEncodings    []string     // Content encodings asked of the index, preferred first ("identity" = uncompressed)
+	UserAgentContact  string       // Operator contact (URL or email) appended to the upstream User-Agent
+	IndexRoutes       []IndexRoute // Packages resolved only from another index, never IndexURL; the first match wins
+
+	// Mounted indexes
+	Mounts   map[string]Mount // Logical indexes keyed by path prefix, e.g. "prod" serves /prod/simple/
+	BasePath string           // Path prefix this instance is served under ("" for the root index)
+
+	// Tenant configuration (mounts override these via GROXPI_MOUNT_<NAME>_*)
+	RateLimit  float64  // Requests per second allowed across all clients (0 = unlimited)
+	RateBurst  int      // Requests allowed at once before RateLimit applies (0 = one second's worth)
+	AuthTokens []string // Tokens clients must present (empty = open access)
+
+	// ClientTeamHeader names the request header attributing traffic to a
+	// team or pipeline, e.g. X-CI-Pipeline (empty = none)
+	ClientTeamHeader string
+
+	// RefreshTokens let the clients holding one send X-Groxpi-Refresh to
+	// bypass the caches for a request (empty = refresh disabled)
+	RefreshTokens []string
+
+	// AdminTokens let the clients holding one send X-Groxpi-Admin-Token to
+	// use the /admin/ endpoints (empty = admin endpoints disabled)
+	AdminTokens []string
 
 	// Cache configuration
-	CacheSize int64
-	CacheDir  string
+	CacheSize  int64
+	CacheDir   string
+	MetadataDB string // bbolt file persisting cache access times and hit counts (empty = memory only)
+
+	// EvictionGrace exempts cached files written less than this long ago
+	// from LRU eviction, on top of the files being read (0 = disabled)
+	EvictionGrace time.Duration
+
+	// VerifyRate is the share of files served from storage whose bytes are
+	// hashed on the way out and checked against their stored SHA-256; a
+	// corrupt file is evicted (0 = never, 1 = every download)
+	VerifyRate float64
+
+	// Index metadata budgets, kept apart from the package file cache so large
+	// files can't evict it
+	MetadataCacheDir  string // Local directory for metadata documents such as provenance (empty = stored with package files)
+	MetadataCacheSize int64  // Size limit for MetadataCacheDir
+	ResponseCacheSize int64  // Memory for rendered index pages
+
+	// Rendered index pages saved to disk, compressed, and loaded at startup
+	// so a restarted instance serves the index without a cold start
+	ResponseCacheDir          string        // Directory the pages are saved in (empty = memory only)
+	ResponseCacheEncoding     string        // "zstd" or "gzip"
+	ResponseCacheSaveInterval time.Duration // Time between saves; pages are also saved at shutdown
 
 	// Storage configuration
-	StorageType       string // "local", "s3", or "hybrid"
-	S3Endpoint        string
-	S3AccessKeyID     string
-	S3SecretAccessKey string
-	S3Region          string
-	S3Bucket          string
-	S3Prefix          string
-	S3ForcePathStyle  bool
-	S3UseSSL          bool
-	S3PartSize        int64 // Multipart upload part size
-	S3MaxConnections  int   // Max concurrent S3 connections (legacy)
+	StorageType        string // "local", "s3", "hybrid", "webdav", or "memory"
+	StorageKeyTemplate string // Storage key layout for package files, e.g. packages/{hash2}/{package}/{file}
+	StorageKeyFallback string // Previous key template, still looked up while files are migrated from it (empty = none)
+	StorageWritePolicy string // Which of two overlapping local writes of a file is kept: "last-writer-wins" or "first-writer-wins"
+	S3Endpoint         string
+	S3AccessKeyID      string
+	S3SecretAccessKey  string
+	S3Region           string
+	S3Bucket           string
+	S3Prefix           string
+	S3ForcePathStyle   bool
+	S3UseSSL           bool
+	S3PartSize         int64 // Multipart upload part size
+	S3MaxConnections   int   // Max concurrent S3 connections (legacy)
+
+	// Encryption of locally cached files (local storage and the hybrid L1)
+	CacheEncryptionKey     string // Base64 AES-256 key (empty = plaintext)
+	CacheEncryptionKeyFile string // File holding the base64 key, e.g. mounted by a KMS agent
 
 	// Hybrid/Tiered storage configuration
 	LocalCacheSize      int64         // Size limit for local L1 cache (hybrid mode only)
@@ -37,6 +109,8 @@ type Config struct {
 	LocalCacheTTL       time.Duration // TTL for local L1 cache entries (0 = disabled)
 	TieredSyncWorkers   int           // Number of workers for L1 population (default: 5)
 	TieredSyncQueueSize int           // Size of tiered sync queue (default: 100)
+	RangeCacheSize      int64         // Size limit for byte ranges of L2 objects kept in L1 (0 = disabled)
+	RangeCacheMaxLength int64         // Longest byte range kept in the range cache
 
 	// S3 Performance Configuration
 	S3ReadPoolSize   int  // Max connections for GET operations
@@ -48,76 +122,554 @@ type Config struct {
 	S3AsyncWorkers   int  // Number of async write workers
 	S3AsyncQueueSize int  // Size of async write queue
 
+	// S3 parallel download configuration
+	S3DownloadPartSize    int64 // Range fetched per request when serving large files
+	S3DownloadConcurrency int   // Ranges fetched at once (1 = single GET)
+
+	// S3Routes keep matching files in buckets other than S3Bucket; the
+	// first match wins
+	S3Routes []S3Route
+
+	// WebDAV storage configuration, for NAS shares without an S3 API
+	WebDAVURL      string // Collection objects are stored under, e.g. https://nas.example.com/dav/groxpi/
+	WebDAVUsername string
+	WebDAVPassword string
+
+	// S3 existence cache configuration
+	S3StatCacheTTL         time.Duration // How long HEAD results are reused (0 = disabled)
+	S3StatCacheNegativeTTL time.Duration // How long a missing object is remembered (0 = not at all)
+	S3StatCacheSize        int           // Max cached HEAD results
+
+	// CDN configuration
+	CDNURL            string        // CDN origin URL fronting the S3 bucket (empty = disabled)
+	CDNProvider       string        // "cloudfront" or "hmac"
+	CDNKeyPairID      string        // CloudFront key pair ID
+	CDNPrivateKeyPath string        // Path to PEM-encoded RSA private key (CloudFront)
+	CDNSigningSecret  string        // Shared secret for HMAC token signing
+	CDNURLTTL         time.Duration // Lifetime of signed CDN URLs
+
+	// Mirror configuration
+	MirrorEnabled  bool          // Proactively sync upstream files into storage
+	MirrorPackages []string      // Packages to mirror (empty = entire index)
+	MirrorInterval time.Duration // Delay between sync passes
+	MirrorWorkers  int           // Concurrent file downloads per package
+
+	// Replication configuration
+	ReplicationPrimary bool   // Announce stored files to standbys at /replication/
+	ReplicationSource  string // Primary a standby copies files from (empty = not a standby)
+	ReplicationToken   string // Token the standby presents to the primary
+	ReplicationWorkers int    // Concurrent file copies on a standby
+
+	// Cache warming configuration
+	WarmWorkers int // Concurrent file downloads per POST /warm job
+
+	// Prefetch configuration
+	PrefetchEnabled    bool          // Download the likely next file after a package listing
+	PrefetchPlatforms  []string      // Wheel platform tags worth prefetching, most preferred first
+	PrefetchPythonTags []string      // Wheel Python tags worth prefetching (empty = any)
+	PrefetchWorkers    int           // Concurrent prefetches
+	PrefetchCooldown   time.Duration // Delay before a package is prefetched for again
+
+	// Fault injection configuration, for game-days against staging
+	ChaosEnabled    bool          // Inject faults into upstream and storage requests
+	ChaosFaults     []string      // Faults injected: delay, reset, partial
+	ChaosBoundaries []string      // Where faults are injected: upstream, storage
+	ChaosRate       float64       // Share of requests that get a fault
+	ChaosMaxDelay   time.Duration // Longest injected delay
+
+	// Hot package configuration
+	HotPackages        int           // Hottest packages kept warm (0 = off)
+	HotHalfLife        time.Duration // Request counts halve over this long
+	HotRefreshInterval time.Duration // How often the hot set is recomputed and refreshed
+	HotTTLFactor       float64       // Index TTL multiplier for hot packages
+
+	// Adaptive TTL configuration
+	AdaptiveTTL    bool          // Derive each package's index TTL from how often its files change
+	AdaptiveTTLMin time.Duration // Shortest adaptive TTL
+	AdaptiveTTLMax time.Duration // Longest adaptive TTL
+
+	// Traffic capture configuration
+	CaptureFile string // Append anonymized request records here for replay (empty = off)
+
+	// Job configuration
+	JobsPersist bool // Keep job records in storage across restarts
+
+	// File passthrough configuration
+	FilesProxyHosts []string // Hosts whose URLs /files/<url> accepts (empty = route disabled)
+
+	// Garbage collection configuration
+	GCMaxAge     time.Duration // Delete cached files not accessed within this window
+	GCTempMaxAge time.Duration // Delete partial writes older than this
+
+	// Version retention configuration
+	RetentionKeepVersions int              // Newest versions kept per package by eviction and GC (0 = all)
+	RetentionRules        []retention.Rule // Per-package overrides; the first matching pattern wins
+
+	// Version constraint configuration
+	Constraints     []constraint.Constraint // Versions file lists are limited to, e.g. setuptools<70
+	ConstraintsFile string                  // constraints.txt-format file of constraints
+
+	// Quarantine configuration
+	QuarantineWindow  time.Duration // How long newly uploaded files stay hidden (0 = disabled)
+	QuarantineExempt  []string      // Package name globs never quarantined
+	QuarantineUnknown string        // Files without an upload time: "deny" hides them, "allow" serves them
+
+	// Trash configuration
+	TrashRetention time.Duration // How long soft-deleted packages can be restored (0 = disabled)
+
+	// Capacity forecasting configuration
+	CapacityAlertDays      int           // Warn when the cache is projected full within this many days (0 = no alerts)
+	CapacityWindow         time.Duration // Cache growth is measured over this much history
+	CapacitySampleInterval time.Duration // Time between cache usage samples
+
+	// Webhook configuration
+	WebhookURLs              []string      // Endpoints cache events are posted to (empty = disabled)
+	WebhookSecret            string        // HMAC-SHA256 key signing webhook payloads
+	WebhookEvents            []string      // Event types to send (empty = all)
+	WebhookTimeout           time.Duration // Per-delivery timeout
+	UpstreamFailureThreshold int           // Consecutive upstream failures before upstream.down fires
+
+	// Index mirror probing configuration
+	IndexMirrors      []string      // Mirrors of IndexURL requests may be routed to (empty = probing disabled)
+	ProbeInterval     time.Duration // Time between probe rounds
+	ProbeTimeout      time.Duration // Per-probe timeout
+	ProbePath         string        // Path probed below each index
+	ProbeThreshold    int           // Consecutive probes needed to change an index's health
+	ProbeSwitchMargin float64       // How much faster another healthy index must be to switch (0.3 = 30%)
+	ProbeSwitchRounds int           // Probe rounds the faster index must lead before switching
+
+	// Cache sharing with other groxpi instances found on the LAN over mDNS
+	PeerCache    bool          // Ask peers for files before upstream (defaults to the peer-cache feature flag)
+	PeerInstance string        // Name advertised to peers (default: hostname and port)
+	PeerPort     int           // Port advertised to peers (defaults to Port)
+	PeerInterval time.Duration // Time between browses for peers
+	PeerTimeout  time.Duration // How long a peer may take to answer
+
+	// Upstream limiter configuration
+	UpstreamMaxConcurrency int           // Max concurrent upstream requests, index and files (0 = unlimited)
+	UpstreamQueueTimeout   time.Duration // How long a request may wait for a free slot
+	MaxInFlightFetches     int           // Distinct index fetches allowed in flight at once
+
+	// Idle index connections get a HEAD request this often, so interactive
+	// requests don't pay for a new TLS handshake (0 = disabled)
+	UpstreamKeepaliveInterval time.Duration
+
+	// Memory: the GC is tuned for MemoryLimit, and new downloads are
+	// rejected while the heap is above MemoryShedThreshold
+	MemoryLimit         int64 // Soft memory limit in bytes (0 = GOMEMLIMIT or none)
+	GCPercent           int   // GC target percentage (0 = GOGC or 100, negative = off)
+	MemoryShedThreshold int64 // Heap bytes above which downloads are shed (0 = never)
+
 	// Timeout configuration
 	DownloadTimeout time.Duration
-	ConnectTimeout  time.Duration
-	ReadTimeout     time.Duration
+
+	// DisconnectCompleteThreshold is the share of a streamed file past which
+	// a client disconnecting leaves the download to finish into storage;
+	// before it, the upstream fetch is aborted
+	DisconnectCompleteThreshold float64
+
+	// Download policy: files not cached yet are streamed through the cache,
+	// or redirected upstream when larger than RedirectAbove bytes (0 = never)
+	// or when a policy matching their package says so
+	RedirectAbove    int64
+	DownloadPolicies []DownloadPolicy // Per-package overrides; the first match wins
+	// Request deadlines by route class, reaching upstream and storage calls
+	// through the request context (0 = none)
+	IndexRequestTimeout    time.Duration // Index pages, search and status
+	DownloadRequestTimeout time.Duration // Package files, bundles and replication objects
+	AdminRequestTimeout    time.Duration // Cache management, GC, jobs and other routes
+	ConnectTimeout         time.Duration
+	ReadTimeout            time.Duration
 
 	// Server configuration
-	Port      string
-	LogLevel  string
-	LogFormat string // console or json
-	LogColor  bool   // enable color for console logs
+	Port                 string
+	ListenAddrs          []string      // Addresses to listen on (GROXPI_LISTEN, defaults to ":" + Port)
+	UnixSocketMode       os.FileMode   // Permissions applied to Unix socket listeners
+	UVCompat             bool          // Tune client connection handling for highly parallel clients such as uv
+	KeepAliveTimeout     time.Duration // How long idle client connections stay open (0 = disable keep-alive)
+	MaxConcurrentStreams int           // HTTP/2 streams allowed per client connection
+	ReadHeaderTimeout    time.Duration // Time allowed to send request headers (0 = unlimited)
+	ServerReadTimeout    time.Duration // Time allowed to send the whole request (0 = unlimited)
+	ServerWriteTimeout   time.Duration // Time allowed to write the response (0 = unlimited)
+	MaxHeaderBytes       int           // Request header size limit (0 = net/http default of 1MB)
+	MaxURLLength         int           // Request URL length limit (0 = unlimited)
+	MaxParamLength       int           // Package and file name length limit in the path (0 = unlimited)
+	MaxBodyBytes         int64         // Request body size limit (0 = unlimited)
+	TLSCertFile          string        // Serve HTTPS (and HTTP/2) with this certificate and TLSKeyFile
+	TLSKeyFile           string
+	SigningKeyFile       string // Ed25519 key index responses are signed with (empty = unsigned)
+	H2C                  bool   // Accept HTTP/2 without TLS (prior knowledge) on plain listeners
+	HTTP3                bool   // Also serve HTTP/3 over QUIC; requires TLS (defaults to the http3 feature flag)
+	HTTP3Addr            string // UDP address for HTTP/3 (defaults to ":" + Port)
+	LogLevel             string
+	LogFormat            string // console or json
+	LogColor             bool   // enable color for console logs
+
+	// Log levels of single modules by package name, e.g. storage or
+	// streaming, overriding LogLevel; changeable at /admin/loglevel
+	LogLevels      map[string]string
+	LogDebugSample int // Debug lines each logging call site may write per second (0 = all)
+
+	// Log file sink, for hosts without a log shipper (LogFile empty = stdout only)
+	LogFile               string
+	LogFileMaxSize        int64         // Rotate once the file is larger than this many bytes (0 = no size limit)
+	LogFileRotateInterval time.Duration // Also rotate this often (0 = by size only)
+	LogFileMaxBackups     int           // Rotated files kept (0 = all)
+	LogFileCompress       bool          // Gzip rotated files
+	LogStdout             bool          // Also log to stdout while logging to LogFile, syslog or journald
+
+	// Syslog and journald sinks, for aggregation without extra agents
+	LogSyslog         string // udp://host:port, tcp://host:port or a socket path such as /dev/log (empty = off)
+	LogSyslogTag      string // APP-NAME of syslog messages
+	LogSyslogFacility string // Facility name, e.g. daemon or local0
+	LogJournald       bool   // Log to journald (Linux only)
+
+	// Experimental features
+	Features     feature.Flags // Switched-on flags, from FeaturesFile then GROXPI_FEATURES
+	FeaturesFile string        // File of flag settings (empty = none)
 
 	// SSL configuration
 	DisableSSLVerification bool
 
 	// Response configuration
 	BinaryFileMimeType bool
+
+	// Responses that are never gzipped because they are already compressed:
+	// paths ending in one of the extensions (e.g. .whl, .tar.gz) and files
+	// served with one of the content types
+	GzipExcludedExtensions []string
+	GzipExcludedTypes      []string
+}
+
+// Mount is a logical index served under its own path prefix with its own
+// upstream and cache namespace
+type Mount struct {
+	IndexURL string
+	Username string
+	Password string
+	Quirks   []string // Simple API deviations of the mount's index
+
+	// Tenant limits; zero values inherit the root index's settings, except
+	// AuthTokens, which never do
+	CacheSize  int64
+	RateLimit  float64
+	RateBurst  int
+	AuthTokens []string
+}
+
+// S3Route keeps the files whose name matches Pattern (a path.Match glob
+// such as "torch-*" or "*.provenance") in a bucket of their own, e.g. huge
+// wheels in a cheaper one. Routes with the same Name share a bucket;
+// connection settings left unset inherit the default bucket's.
+type S3Route struct {
+	Pattern         string
+	Name            string
+	Bucket          string
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+	Region          string
+	Prefix          string
+}
+
+// IndexRoute pins the packages whose normalized name matches Pattern (a
+// path.Match glob such as "acme-*") to one index, so an internal name can't
+// be resolved from a public index that someone registered it on
+type IndexRoute struct {
+	Pattern  string
+	IndexURL string
+	Username string
+	Password string
+}
+
+// RouteFor returns the first index route matching package pkg
+func (c *Config) RouteFor(pkg string) (IndexRoute, bool) {
+	name := distfile.NormalizeName(pkg)
+	for _, route := range c.IndexRoutes {
+		if ok, _ := path.Match(route.Pattern, name); ok {
+			return route, true
+		}
+	}
+	return IndexRoute{}, false
+}
+
+// DownloadPolicy overrides the default download policy for the packages
+// whose normalized name matches Pattern (a path.Match glob)
+type DownloadPolicy struct {
+	Pattern       string
+	Redirect      bool  // Redirect every file
+	RedirectAbove int64 // Redirect files larger than this many bytes (0 = none)
+}
+
+// RedirectsDownload reports whether a file of package pkg that isn't
+// cached, size bytes large (0 = unknown), is redirected upstream rather
+// than streamed through the cache. Without a download timeout every file
+// is redirected.
+func (c *Config) RedirectsDownload(pkg string, size int64) bool {
+	if c.DownloadTimeout <= 0 {
+		return true
+	}
+	policy := DownloadPolicy{RedirectAbove: c.RedirectAbove}
+	name := distfile.NormalizeName(pkg)
+	for _, p := range c.DownloadPolicies {
+		if ok, _ := path.Match(p.Pattern, name); ok {
+			policy = p
+			break
+		}
+	}
+	return policy.Redirect || policy.RedirectAbove > 0 && size > policy.RedirectAbove
 }
 
+// reservedMountNames collide with the root index's own routes
+var reservedMountNames = map[string]bool{
+	"simple": true, "index": true, "cache": true, "search": true,
+	"package": true, "mirror": true, "health": true, "metrics": true,
+	"files": true, "warm": true, "jobs": true, "replication": true,
+	"version": true, "stats": true, "provenance": true, "bundle": true,
+	"signing-key": true, "admin": true,
+}
+
+var mountNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Load reads the configuration from GROXPI_* (and AWS_*) environment
+// variables. It panics on invalid settings.
 func Load() *Config {
+	cfg := load(os.Getenv)
+	if err := cfg.Validate(); err != nil {
+		panic(err.Error())
+	}
+	return cfg
+}
+
+// Default returns the configuration used when no environment variables are
+// set, for programs embedding groxpi to adjust
+func Default() *Config {
+	return load(func(string) string { return "" })
+}
+
+// load builds a configuration from the variables getenv returns
+func load(getenv func(string) string) *Config {
+	e := env(getenv)
 	cfg := &Config{
-		IndexURL:               getEnv("GROXPI_INDEX_URL", "https://pypi.org/simple/"),
-		IndexTTL:               getDurationEnv("GROXPI_INDEX_TTL", 30*time.Minute),
-		CacheSize:              getIntEnv("GROXPI_CACHE_SIZE", 5*1024*1024*1024), // 5GB
-		CacheDir:               getEnv("GROXPI_CACHE_DIR", ""),
-		DownloadTimeout:        getFloatDurationEnv("GROXPI_DOWNLOAD_TIMEOUT", 900*time.Millisecond),
-		Port:                   getEnv("PORT", "5000"),
-		LogLevel:               getEnv("GROXPI_LOGGING_LEVEL", "INFO"),
-		LogFormat:              getEnv("GROXPI_LOG_FORMAT", "console"),
-		LogColor:               getBoolEnv("GROXPI_LOG_COLOR", true),
-		DisableSSLVerification: getBoolEnv("GROXPI_DISABLE_INDEX_SSL_VERIFICATION", false),
-		BinaryFileMimeType:     getBoolEnv("GROXPI_BINARY_FILE_MIME_TYPE", false),
+		IndexURL:               e.getEnv("GROXPI_INDEX_URL", "https://pypi.org/simple/"),
+		IndexTTL:               e.getDurationEnv("GROXPI_INDEX_TTL", 30*time.Minute),
+		IndexEarlyRefresh:      e.getFloatEnv("GROXPI_INDEX_EARLY_REFRESH", 1),
+		DegradedTTL:            e.getDurationEnv("GROXPI_DEGRADED_TTL", 30*time.Second),
+		StableJSON:             e.getBoolEnv("GROXPI_STABLE_JSON", false),
+		CacheSize:              e.getIntEnv("GROXPI_CACHE_SIZE", 5*1024*1024*1024), // 5GB
+		CacheDir:               e.getEnv("GROXPI_CACHE_DIR", ""),
+		MetadataDB:             e.getEnv("GROXPI_METADATA_DB", ""),
+		EvictionGrace:          e.getDurationEnv("GROXPI_EVICTION_GRACE", 5*time.Minute),
+		VerifyRate:             e.getFloatEnv("GROXPI_VERIFY_RATE", 0),
+		MetadataCacheDir:       e.getEnv("GROXPI_METADATA_CACHE_DIR", ""),
+		MetadataCacheSize:      e.getIntEnv("GROXPI_METADATA_CACHE_SIZE", 256*1024*1024), // 256MB
+		ResponseCacheSize:      e.getIntEnv("GROXPI_RESPONSE_CACHE_SIZE", 50*1024*1024),  // 50MB
+		DownloadTimeout:        e.getFloatDurationEnv("GROXPI_DOWNLOAD_TIMEOUT", 900*time.Millisecond),
+		RedirectAbove:          e.getIntEnv("GROXPI_REDIRECT_ABOVE", 0),
+		Port:                   e.getEnv("PORT", "5000"),
+		LogLevel:               e.getEnv("GROXPI_LOGGING_LEVEL", "INFO"),
+		LogFormat:              e.getEnv("GROXPI_LOG_FORMAT", "console"),
+		LogColor:               e.getBoolEnv("GROXPI_LOG_COLOR", true),
+		LogDebugSample:         int(e.getIntEnv("GROXPI_LOG_DEBUG_SAMPLE", 0)),
+		LogFile:                e.getEnv("GROXPI_LOG_FILE", ""),
+		LogFileMaxSize:         e.getIntEnv("GROXPI_LOG_FILE_MAX_SIZE", 100*1024*1024), // 100MB
+		LogFileRotateInterval:  e.getDurationEnv("GROXPI_LOG_FILE_ROTATE_INTERVAL", 24*time.Hour),
+		LogFileMaxBackups:      int(e.getIntEnv("GROXPI_LOG_FILE_MAX_BACKUPS", 7)),
+		LogFileCompress:        e.getBoolEnv("GROXPI_LOG_FILE_COMPRESS", true),
+		LogStdout:              e.getBoolEnv("GROXPI_LOG_STDOUT", true),
+		LogSyslog:              e.getEnv("GROXPI_LOG_SYSLOG", ""),
+		LogSyslogTag:           e.getEnv("GROXPI_LOG_SYSLOG_TAG", "groxpi"),
+		LogSyslogFacility:      e.getEnv("GROXPI_LOG_SYSLOG_FACILITY", "daemon"),
+		LogJournald:            e.getBoolEnv("GROXPI_LOG_JOURNALD", false),
+		DisableSSLVerification: e.getBoolEnv("GROXPI_DISABLE_INDEX_SSL_VERIFICATION", false),
+		IndexUsername:          e.getEnv("GROXPI_INDEX_USERNAME", ""),
+		IndexPassword:          e.getEnv("GROXPI_INDEX_PASSWORD", ""),
+		IndexQuirks:            splitAndTrim(e.getEnv("GROXPI_INDEX_QUIRKS", ""), ","),
+		IndexEncodings:         splitAndTrim(e.getEnv("GROXPI_INDEX_ENCODINGS", "zstd,gzip"), ","),
+		UserAgentContact:       e.getEnv("GROXPI_USER_AGENT_CONTACT", ""),
+		BinaryFileMimeType:     e.getBoolEnv("GROXPI_BINARY_FILE_MIME_TYPE", false),
+		GzipExcludedExtensions: splitAndTrim(e.getEnv("GROXPI_GZIP_EXCLUDED_EXTENSIONS", ".whl,.tar.gz,.tgz,.tar.bz2,.tbz,.tar.xz,.zip,.egg,.gz,.bz2,.xz,.zst"), ","),
+		GzipExcludedTypes:      splitAndTrim(e.getEnv("GROXPI_GZIP_EXCLUDED_TYPES", "application/octet-stream,application/zip,application/gzip,application/x-gzip,application/x-tar,application/x-bzip2,application/x-xz,application/zstd"), ","),
 
 		// Storage configuration
-		StorageType:       getEnv("GROXPI_STORAGE_TYPE", "local"),
-		S3Endpoint:        getEnv("AWS_ENDPOINT_URL", ""),
-		S3AccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
-		S3SecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
-		S3Region:          getEnv("AWS_REGION", "us-east-1"),
-		S3Bucket:          getEnv("GROXPI_S3_BUCKET", ""),
-		S3Prefix:          getEnv("GROXPI_S3_PREFIX", "groxpi"),
-		S3ForcePathStyle:  getBoolEnv("GROXPI_S3_FORCE_PATH_STYLE", false),
-		S3UseSSL:          getBoolEnv("GROXPI_S3_USE_SSL", true),
-		S3PartSize:        getIntEnv("GROXPI_S3_PART_SIZE", 10*1024*1024), // 10MB
-		S3MaxConnections:  int(getIntEnv("GROXPI_S3_MAX_CONNECTIONS", 100)),
+		StorageType:        e.getEnv("GROXPI_STORAGE_TYPE", "local"),
+		StorageKeyTemplate: e.getEnv("GROXPI_STORAGE_KEY_TEMPLATE", "packages/{package}/{file}"),
+		StorageKeyFallback: e.getEnv("GROXPI_STORAGE_KEY_FALLBACK_TEMPLATE", ""),
+		StorageWritePolicy: e.getEnv("GROXPI_STORAGE_WRITE_POLICY", "last-writer-wins"),
+		S3Endpoint:         e.getEnv("AWS_ENDPOINT_URL", ""),
+		S3AccessKeyID:      e.getEnv("AWS_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey:  e.getEnv("AWS_SECRET_ACCESS_KEY", ""),
+		S3Region:           e.getEnv("AWS_REGION", "us-east-1"),
+		S3Bucket:           e.getEnv("GROXPI_S3_BUCKET", ""),
+		S3Prefix:           e.getEnv("GROXPI_S3_PREFIX", "groxpi"),
+		S3ForcePathStyle:   e.getBoolEnv("GROXPI_S3_FORCE_PATH_STYLE", false),
+		S3UseSSL:           e.getBoolEnv("GROXPI_S3_USE_SSL", true),
+		S3PartSize:         e.getIntEnv("GROXPI_S3_PART_SIZE", 10*1024*1024), // 10MB
+		S3MaxConnections:   int(e.getIntEnv("GROXPI_S3_MAX_CONNECTIONS", 100)),
+
+		// Local cache encryption
+		CacheEncryptionKey:     e.getEnv("GROXPI_CACHE_ENCRYPTION_KEY", ""),
+		CacheEncryptionKeyFile: e.getEnv("GROXPI_CACHE_ENCRYPTION_KEY_FILE", ""),
 
 		// S3 Performance Configuration
-		S3ReadPoolSize:   int(getIntEnv("GROXPI_S3_READ_POOL_SIZE", 50)),
-		S3WritePoolSize:  int(getIntEnv("GROXPI_S3_WRITE_POOL_SIZE", 30)),
-		S3MetaPoolSize:   int(getIntEnv("GROXPI_S3_META_POOL_SIZE", 20)),
-		S3EnableHTTP2:    getBoolEnv("GROXPI_S3_ENABLE_HTTP2", true),
-		S3TransferAccel:  getBoolEnv("GROXPI_S3_TRANSFER_ACCEL", false),
-		S3AsyncWrites:    getBoolEnv("GROXPI_S3_ASYNC_WRITES", true),
-		S3AsyncWorkers:   int(getIntEnv("GROXPI_S3_ASYNC_WORKERS", 10)),
-		S3AsyncQueueSize: int(getIntEnv("GROXPI_S3_ASYNC_QUEUE_SIZE", 1000)),
+		S3ReadPoolSize:   int(e.getIntEnv("GROXPI_S3_READ_POOL_SIZE", 50)),
+		S3WritePoolSize:  int(e.getIntEnv("GROXPI_S3_WRITE_POOL_SIZE", 30)),
+		S3MetaPoolSize:   int(e.getIntEnv("GROXPI_S3_META_POOL_SIZE", 20)),
+		S3EnableHTTP2:    e.getBoolEnv("GROXPI_S3_ENABLE_HTTP2", true),
+		S3TransferAccel:  e.getBoolEnv("GROXPI_S3_TRANSFER_ACCEL", false),
+		S3AsyncWrites:    e.getBoolEnv("GROXPI_S3_ASYNC_WRITES", true),
+		S3AsyncWorkers:   int(e.getIntEnv("GROXPI_S3_ASYNC_WORKERS", 10)),
+		S3AsyncQueueSize: int(e.getIntEnv("GROXPI_S3_ASYNC_QUEUE_SIZE", 1000)),
+
+		// S3 parallel download configuration
+		S3DownloadPartSize:    e.getIntEnv("GROXPI_S3_DOWNLOAD_PART_SIZE", 16*1024*1024), // 16MB
+		S3DownloadConcurrency: int(e.getIntEnv("GROXPI_S3_DOWNLOAD_CONCURRENCY", 4)),
+
+		// WebDAV storage configuration
+		WebDAVURL:      e.getEnv("GROXPI_WEBDAV_URL", ""),
+		WebDAVUsername: e.getEnv("GROXPI_WEBDAV_USERNAME", ""),
+		WebDAVPassword: e.getEnv("GROXPI_WEBDAV_PASSWORD", ""),
+
+		// S3 existence cache configuration
+		S3StatCacheTTL:         e.getDurationEnv("GROXPI_S3_STAT_CACHE_TTL", 5*time.Minute),
+		S3StatCacheNegativeTTL: e.getDurationEnv("GROXPI_S3_STAT_CACHE_NEGATIVE_TTL", 10*time.Second),
+		S3StatCacheSize:        int(e.getIntEnv("GROXPI_S3_STAT_CACHE_SIZE", 10000)),
 
 		// Hybrid/Tiered storage configuration
-		LocalCacheSize:      getIntEnv("GROXPI_LOCAL_CACHE_SIZE", 10*1024*1024*1024), // 10GB default
-		LocalCacheDir:       getEnv("GROXPI_LOCAL_CACHE_DIR", ""),
-		LocalCacheTTL:       getDurationEnv("GROXPI_LOCAL_CACHE_TTL", 0), // 0 = disabled
-		TieredSyncWorkers:   int(getIntEnv("GROXPI_TIERED_SYNC_WORKERS", 5)),
-		TieredSyncQueueSize: int(getIntEnv("GROXPI_TIERED_SYNC_QUEUE_SIZE", 100)),
+		LocalCacheSize:      e.getIntEnv("GROXPI_LOCAL_CACHE_SIZE", 10*1024*1024*1024), // 10GB default
+		LocalCacheDir:       e.getEnv("GROXPI_LOCAL_CACHE_DIR", ""),
+		LocalCacheTTL:       e.getDurationEnv("GROXPI_LOCAL_CACHE_TTL", 0), // 0 = disabled
+		TieredSyncWorkers:   int(e.getIntEnv("GROXPI_TIERED_SYNC_WORKERS", 5)),
+		TieredSyncQueueSize: int(e.getIntEnv("GROXPI_TIERED_SYNC_QUEUE_SIZE", 100)),
+		RangeCacheSize:      e.getIntEnv("GROXPI_RANGE_CACHE_SIZE", 256*1024*1024),   // 256MB default
+		RangeCacheMaxLength: e.getIntEnv("GROXPI_RANGE_CACHE_MAX_LENGTH", 1024*1024), // 1MB default
+
+		// CDN configuration
+		CDNURL:            e.getEnv("GROXPI_CDN_URL", ""),
+		CDNProvider:       e.getEnv("GROXPI_CDN_PROVIDER", "cloudfront"),
+		CDNKeyPairID:      e.getEnv("GROXPI_CDN_KEY_PAIR_ID", ""),
+		CDNPrivateKeyPath: e.getEnv("GROXPI_CDN_PRIVATE_KEY_PATH", ""),
+		CDNSigningSecret:  e.getEnv("GROXPI_CDN_SIGNING_SECRET", ""),
+		CDNURLTTL:         e.getDurationEnv("GROXPI_CDN_URL_TTL", 15*time.Minute),
+
+		// Mirror configuration
+		MirrorEnabled:  e.getBoolEnv("GROXPI_MIRROR_ENABLED", false),
+		MirrorPackages: splitAndTrim(e.getEnv("GROXPI_MIRROR_PACKAGES", ""), ","),
+		MirrorInterval: e.getDurationEnv("GROXPI_MIRROR_INTERVAL", 24*time.Hour),
+		MirrorWorkers:  int(e.getIntEnv("GROXPI_MIRROR_WORKERS", 4)),
+
+		// Replication configuration
+		ReplicationPrimary: e.getBoolEnv("GROXPI_REPLICATION_PRIMARY", false),
+		ReplicationSource:  e.getEnv("GROXPI_REPLICATION_SOURCE", ""),
+		ReplicationToken:   e.getEnv("GROXPI_REPLICATION_TOKEN", ""),
+		ReplicationWorkers: int(e.getIntEnv("GROXPI_REPLICATION_WORKERS", 4)),
+
+		// Cache warming configuration
+		WarmWorkers: int(e.getIntEnv("GROXPI_WARM_WORKERS", 4)),
+
+		// Prefetch configuration
+		PrefetchEnabled:    e.getBoolEnv("GROXPI_PREFETCH_ENABLED", false),
+		PrefetchPlatforms:  splitAndTrim(e.getEnv("GROXPI_PREFETCH_PLATFORMS", "any"), ","),
+		PrefetchPythonTags: splitAndTrim(e.getEnv("GROXPI_PREFETCH_PYTHON_TAGS", ""), ","),
+		PrefetchWorkers:    int(e.getIntEnv("GROXPI_PREFETCH_WORKERS", 2)),
+		PrefetchCooldown:   e.getDurationEnv("GROXPI_PREFETCH_COOLDOWN", time.Hour),
+
+		// Fault injection configuration
+		ChaosEnabled:    e.getBoolEnv("GROXPI_CHAOS_ENABLED", false),
+		ChaosFaults:     splitAndTrim(e.getEnv("GROXPI_CHAOS_FAULTS", "delay,reset,partial"), ","),
+		ChaosBoundaries: splitAndTrim(e.getEnv("GROXPI_CHAOS_BOUNDARIES", "upstream,storage"), ","),
+		ChaosRate:       e.getFloatEnv("GROXPI_CHAOS_RATE", 0.05),
+		ChaosMaxDelay:   e.getFloatDurationEnv("GROXPI_CHAOS_MAX_DELAY", 5*time.Second),
+
+		// Hot package configuration
+		HotPackages:        int(e.getIntEnv("GROXPI_HOT_PACKAGES", 0)),
+		HotHalfLife:        e.getDurationEnv("GROXPI_HOT_HALF_LIFE", time.Hour),
+		HotRefreshInterval: e.getDurationEnv("GROXPI_HOT_REFRESH_INTERVAL", time.Minute),
+		HotTTLFactor:       e.getFloatEnv("GROXPI_HOT_TTL_FACTOR", 4),
+
+		// Adaptive TTL configuration
+		AdaptiveTTL:    e.getBoolEnv("GROXPI_ADAPTIVE_TTL", false),
+		AdaptiveTTLMin: e.getDurationEnv("GROXPI_ADAPTIVE_TTL_MIN", 5*time.Minute),
+		AdaptiveTTLMax: e.getDurationEnv("GROXPI_ADAPTIVE_TTL_MAX", 24*time.Hour),
+
+		// Traffic capture configuration
+		CaptureFile: e.getEnv("GROXPI_CAPTURE_FILE", ""),
+
+		// Job configuration
+		JobsPersist: e.getBoolEnv("GROXPI_JOBS_PERSIST", false),
+
+		// File passthrough configuration
+		FilesProxyHosts: splitAndTrim(e.getEnv("GROXPI_FILES_PROXY_HOSTS", ""), ","),
+
+		// Garbage collection configuration
+		GCMaxAge:     e.getDurationEnv("GROXPI_GC_MAX_AGE", 30*24*time.Hour),
+		GCTempMaxAge: e.getDurationEnv("GROXPI_GC_TEMP_MAX_AGE", time.Hour),
+
+		// Version retention configuration
+		RetentionKeepVersions: int(e.getIntEnv("GROXPI_RETENTION_KEEP_VERSIONS", 0)),
+
+		// Trash configuration
+		TrashRetention: e.getDurationEnv("GROXPI_TRASH_RETENTION", 7*24*time.Hour),
+
+		// Quarantine configuration
+		QuarantineWindow:  e.getDurationEnv("GROXPI_QUARANTINE_WINDOW", 0),
+		QuarantineExempt:  splitAndTrim(e.getEnv("GROXPI_QUARANTINE_EXEMPT", ""), ","),
+		QuarantineUnknown: e.getEnv("GROXPI_QUARANTINE_UNKNOWN", "deny"),
+
+		// Capacity forecasting configuration
+		CapacityAlertDays:      int(e.getIntEnv("GROXPI_CAPACITY_ALERT_DAYS", 7)),
+		CapacityWindow:         e.getDurationEnv("GROXPI_CAPACITY_WINDOW", 24*time.Hour),
+		CapacitySampleInterval: e.getDurationEnv("GROXPI_CAPACITY_SAMPLE_INTERVAL", 5*time.Minute),
+
+		// Webhook configuration
+		WebhookURLs:              splitAndTrim(e.getEnv("GROXPI_WEBHOOK_URLS", ""), ","),
+		WebhookSecret:            e.getEnv("GROXPI_WEBHOOK_SECRET", ""),
+		WebhookEvents:            splitAndTrim(e.getEnv("GROXPI_WEBHOOK_EVENTS", ""), ","),
+		WebhookTimeout:           e.getDurationEnv("GROXPI_WEBHOOK_TIMEOUT", 10*time.Second),
+		UpstreamFailureThreshold: int(e.getIntEnv("GROXPI_UPSTREAM_FAILURE_THRESHOLD", 5)),
+
+		// Index mirror probing configuration
+		IndexMirrors:      splitAndTrim(e.getEnv("GROXPI_INDEX_MIRRORS", ""), ","),
+		ProbeInterval:     e.getDurationEnv("GROXPI_PROBE_INTERVAL", 30*time.Second),
+		ProbeTimeout:      e.getDurationEnv("GROXPI_PROBE_TIMEOUT", 5*time.Second),
+		ProbePath:         e.getEnv("GROXPI_PROBE_PATH", "pip/"),
+		ProbeThreshold:    int(e.getIntEnv("GROXPI_PROBE_THRESHOLD", 3)),
+		ProbeSwitchMargin: e.getFloatEnv("GROXPI_PROBE_SWITCH_MARGIN", 0.3),
+		ProbeSwitchRounds: int(e.getIntEnv("GROXPI_PROBE_SWITCH_ROUNDS", 3)),
+
+		// Upstream limiter configuration
+		UpstreamMaxConcurrency:    int(e.getIntEnv("GROXPI_UPSTREAM_MAX_CONCURRENCY", 0)),
+		UpstreamQueueTimeout:      e.getDurationEnv("GROXPI_UPSTREAM_QUEUE_TIMEOUT", 30*time.Second),
+		UpstreamKeepaliveInterval: e.getDurationEnv("GROXPI_UPSTREAM_KEEPALIVE_INTERVAL", 0),
+		MaxInFlightFetches:        int(e.getIntEnv("GROXPI_MAX_INFLIGHT_FETCHES", 1024)),
+
+		// Request deadlines
+		IndexRequestTimeout:    e.getDurationEnv("GROXPI_INDEX_REQUEST_TIMEOUT", 2*time.Minute),
+		DownloadRequestTimeout: e.getDurationEnv("GROXPI_DOWNLOAD_REQUEST_TIMEOUT", 2*time.Hour),
+		AdminRequestTimeout:    e.getDurationEnv("GROXPI_ADMIN_REQUEST_TIMEOUT", 30*time.Minute),
+
+		// Memory configuration
+		MemoryLimit:         e.getIntEnv("GROXPI_MEMORY_LIMIT", 0),
+		GCPercent:           int(e.getIntEnv("GROXPI_GC_PERCENT", 0)),
+		MemoryShedThreshold: e.getIntEnv("GROXPI_MEMORY_SHED_THRESHOLD", 0),
+
+		// Tenant configuration
+		RateLimit:  e.getFloatEnv("GROXPI_RATE_LIMIT", 0),
+		RateBurst:  int(e.getIntEnv("GROXPI_RATE_BURST", 0)),
+		AuthTokens: splitAndTrim(e.getEnv("GROXPI_AUTH_TOKENS", ""), ","),
+
+		ClientTeamHeader: e.getEnv("GROXPI_CLIENT_TEAM_HEADER", ""),
+		RefreshTokens:    splitAndTrim(e.getEnv("GROXPI_REFRESH_TOKENS", ""), ","),
+		AdminTokens:      splitAndTrim(e.getEnv("GROXPI_ADMIN_TOKENS", ""), ","),
 	}
 
 	// Parse extra index URLs
-	if extraURLs := getEnv("GROXPI_EXTRA_INDEX_URLS", ""); extraURLs != "" {
+	if extraURLs := e.getEnv("GROXPI_EXTRA_INDEX_URLS", ""); extraURLs != "" {
 		cfg.ExtraIndexURLs = splitAndTrim(extraURLs, ",")
 	}
 
 	// Parse extra index TTLs
-	if extraTTLs := getEnv("GROXPI_EXTRA_INDEX_TTLS", ""); extraTTLs != "" {
+	if extraTTLs := e.getEnv("GROXPI_EXTRA_INDEX_TTLS", ""); extraTTLs != "" {
 		ttlStrs := splitAndTrim(extraTTLs, ",")
 		cfg.ExtraIndexTTLs = make([]time.Duration, len(ttlStrs))
 		for i, ttlStr := range ttlStrs {
@@ -135,19 +687,227 @@ func Load() *Config {
 		}
 	}
 
+	// Parse mounted indexes ("name=url" pairs); credentials and tenant limits
+	// come from GROXPI_MOUNT_<NAME>_* variables
+	if mounts := e.getEnv("GROXPI_MOUNTS", ""); mounts != "" {
+		cfg.Mounts = make(map[string]Mount)
+		for _, entry := range splitAndTrim(mounts, ",") {
+			name, indexURL, ok := strings.Cut(entry, "=")
+			name, indexURL = strings.TrimSpace(name), strings.TrimSpace(indexURL)
+			if !ok || indexURL == "" || !mountNamePattern.MatchString(name) || reservedMountNames[name] {
+				panic(fmt.Sprintf("invalid GROXPI_MOUNTS entry %q: expected name=url with a lowercase name not used by a root route", entry))
+			}
+
+			envName := "GROXPI_MOUNT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+			cfg.Mounts[name] = Mount{
+				IndexURL:   indexURL,
+				Username:   e.getEnv(envName+"_USERNAME", ""),
+				Password:   e.getEnv(envName+"_PASSWORD", ""),
+				Quirks:     splitAndTrim(e.getEnv(envName+"_QUIRKS", ""), ","),
+				CacheSize:  e.getIntEnv(envName+"_CACHE_SIZE", 0),
+				RateLimit:  e.getFloatEnv(envName+"_RATE_LIMIT", 0),
+				RateBurst:  int(e.getIntEnv(envName+"_RATE_BURST", 0)),
+				AuthTokens: splitAndTrim(e.getEnv(envName+"_AUTH_TOKENS", ""), ","),
+			}
+		}
+	}
+
+	// Parse index routes ("pattern=mount" or "pattern=url" pairs); a mount
+	// lends the route its credentials
+	if routes := e.getEnv("GROXPI_INDEX_ROUTES", ""); routes != "" {
+		for _, entry := range splitAndTrim(routes, ",") {
+			pattern, target, ok := strings.Cut(entry, "=")
+			route := IndexRoute{Pattern: strings.TrimSpace(pattern), IndexURL: strings.TrimSpace(target)}
+			if mount, isMount := cfg.Mounts[route.IndexURL]; isMount {
+				route.IndexURL, route.Username, route.Password = mount.IndexURL, mount.Username, mount.Password
+			}
+			if !ok || validateIndexRoute(route) != nil {
+				panic(fmt.Sprintf("invalid GROXPI_INDEX_ROUTES entry %q: expected pattern=mount or pattern=url with a glob pattern and an http(s) index URL", entry))
+			}
+			cfg.IndexRoutes = append(cfg.IndexRoutes, route)
+		}
+	}
+
+	// Parse download policy overrides ("pattern=stream", "pattern=redirect"
+	// or "pattern=bytes" pairs)
+	if policies := e.getEnv("GROXPI_DOWNLOAD_POLICIES", ""); policies != "" {
+		for _, entry := range splitAndTrim(policies, ",") {
+			pattern, value, ok := strings.Cut(entry, "=")
+			policy := DownloadPolicy{Pattern: strings.TrimSpace(pattern)}
+			_, matchErr := path.Match(policy.Pattern, "")
+			switch value = strings.TrimSpace(value); value {
+			case "stream":
+			case "redirect":
+				policy.Redirect = true
+			default:
+				above, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || above <= 0 {
+					ok = false
+				}
+				policy.RedirectAbove = above
+			}
+			if !ok || policy.Pattern == "" || matchErr != nil {
+				panic(fmt.Sprintf("invalid GROXPI_DOWNLOAD_POLICIES entry %q: expected pattern=stream, pattern=redirect or pattern=bytes with a glob pattern", entry))
+			}
+			cfg.DownloadPolicies = append(cfg.DownloadPolicies, policy)
+		}
+	}
+
+	// Rendered index pages saved across restarts
+	cfg.ResponseCacheDir = e.getEnv("GROXPI_RESPONSE_CACHE_DIR", "")
+	cfg.ResponseCacheEncoding = strings.ToLower(e.getEnv("GROXPI_RESPONSE_CACHE_ENCODING", "zstd"))
+	cfg.ResponseCacheSaveInterval = e.getDurationEnv("GROXPI_RESPONSE_CACHE_SAVE_INTERVAL", 5*time.Minute)
+
+	// Parse per-module log levels ("module=LEVEL" pairs)
+	if levels := e.getEnv("GROXPI_LOG_LEVELS", ""); levels != "" {
+		cfg.LogLevels = make(map[string]string)
+		for _, entry := range splitAndTrim(levels, ",") {
+			module, level, ok := strings.Cut(entry, "=")
+			module, level = strings.TrimSpace(module), strings.TrimSpace(level)
+			if _, known := logger.LookupLevel(level); !ok || module == "" || !known {
+				panic(fmt.Sprintf("invalid GROXPI_LOG_LEVELS entry %q: expected module=LEVEL with DEBUG, INFO, WARN or ERROR", entry))
+			}
+			cfg.LogLevels[module] = strings.ToUpper(level)
+		}
+	}
+
+	// Parse version retention overrides ("pattern=count" pairs)
+	if rules := e.getEnv("GROXPI_RETENTION_RULES", ""); rules != "" {
+		for _, entry := range splitAndTrim(rules, ",") {
+			pattern, count, ok := strings.Cut(entry, "=")
+			pattern = strings.TrimSpace(pattern)
+			keep, err := strconv.Atoi(strings.TrimSpace(count))
+			_, matchErr := path.Match(pattern, "")
+			if !ok || pattern == "" || err != nil || keep < 0 || matchErr != nil {
+				panic(fmt.Sprintf("invalid GROXPI_RETENTION_RULES entry %q: expected pattern=count with a glob pattern and a non-negative count", entry))
+			}
+			cfg.RetentionRules = append(cfg.RetentionRules, retention.Rule{Pattern: pattern, Keep: keep})
+		}
+	}
+
+	// Parse version constraints: the file's come first, then the
+	// semicolon-separated GROXPI_CONSTRAINTS (commas separate specifiers)
+	cfg.ConstraintsFile = e.getEnv("GROXPI_CONSTRAINTS_FILE", "")
+	if cfg.ConstraintsFile != "" {
+		constraints, err := constraint.ReadFile(cfg.ConstraintsFile)
+		if err != nil {
+			panic(fmt.Sprintf("invalid GROXPI_CONSTRAINTS_FILE: %v", err))
+		}
+		cfg.Constraints = constraints
+	}
+	for _, entry := range splitAndTrim(e.getEnv("GROXPI_CONSTRAINTS", ""), ";") {
+		c, err := constraint.Parse(entry)
+		if err != nil {
+			panic(fmt.Sprintf("invalid GROXPI_CONSTRAINTS: %v", err))
+		}
+		cfg.Constraints = append(cfg.Constraints, c)
+	}
+
+	for _, pattern := range cfg.QuarantineExempt {
+		if _, err := path.Match(pattern, ""); err != nil {
+			panic(fmt.Sprintf("invalid GROXPI_QUARANTINE_EXEMPT pattern %q: %v", pattern, err))
+		}
+	}
+
+	if cfg.VerifyRate < 0 || cfg.VerifyRate > 1 {
+		panic(fmt.Sprintf("invalid GROXPI_VERIFY_RATE: %v is not between 0 and 1", cfg.VerifyRate))
+	}
+
+	// Parse listen addresses, falling back to all interfaces on PORT
+	if listen := e.getEnv("GROXPI_LISTEN", ""); listen != "" {
+		cfg.ListenAddrs = splitAndTrim(listen, ",")
+	}
+	if len(cfg.ListenAddrs) == 0 {
+		cfg.ListenAddrs = []string{":" + cfg.Port}
+	}
+
+	// Parse Unix socket permissions (octal, e.g. 0660)
+	cfg.UnixSocketMode = 0660
+	if mode := e.getEnv("GROXPI_UNIX_SOCKET_MODE", ""); mode != "" {
+		parsed, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || parsed > 0777 {
+			panic(fmt.Sprintf("invalid GROXPI_UNIX_SOCKET_MODE %q: expected octal permissions such as 0660", mode))
+		}
+		cfg.UnixSocketMode = os.FileMode(parsed)
+	}
+
+	// Client connection tuning; uv compatibility mode raises the defaults so
+	// its parallel fetches keep reusing connections instead of reconnecting
+	cfg.UVCompat = e.getBoolEnv("GROXPI_UV_COMPAT", false)
+	keepAlive, streams := 75*time.Second, 250
+	if cfg.UVCompat {
+		keepAlive, streams = 120*time.Second, 1000
+	}
+	cfg.KeepAliveTimeout = e.getDurationEnv("GROXPI_KEEPALIVE_TIMEOUT", keepAlive)
+	cfg.MaxConcurrentStreams = int(e.getIntEnv("GROXPI_MAX_CONCURRENT_STREAMS", int64(streams)))
+
+	// Hardening against slow or oversized requests. There is no default
+	// write timeout since large wheels stream for minutes to slow clients.
+	cfg.ReadHeaderTimeout = e.getDurationEnv("GROXPI_READ_HEADER_TIMEOUT", 10*time.Second)
+	cfg.ServerReadTimeout = e.getDurationEnv("GROXPI_SERVER_READ_TIMEOUT", 0)
+	cfg.ServerWriteTimeout = e.getDurationEnv("GROXPI_SERVER_WRITE_TIMEOUT", 0)
+	cfg.MaxHeaderBytes = int(e.getIntEnv("GROXPI_MAX_HEADER_BYTES", 64*1024))
+	cfg.MaxURLLength = int(e.getIntEnv("GROXPI_MAX_URL_LENGTH", 8192))
+	cfg.MaxParamLength = int(e.getIntEnv("GROXPI_MAX_PARAM_LENGTH", 512))
+	cfg.MaxBodyBytes = e.getIntEnv("GROXPI_MAX_BODY_BYTES", 0)
+
+	// Experimental features: the file sets the baseline and GROXPI_FEATURES
+	// overrides it, so one instance can be switched without editing the file
+	cfg.Features = feature.Flags{}
+	cfg.FeaturesFile = e.getEnv("GROXPI_FEATURES_FILE", "")
+	if cfg.FeaturesFile != "" {
+		settings, err := feature.ReadFile(cfg.FeaturesFile)
+		if err == nil {
+			err = cfg.Features.Set(settings...)
+		}
+		if err != nil {
+			panic(fmt.Sprintf("invalid GROXPI_FEATURES_FILE: %v", err))
+		}
+	}
+	if err := cfg.Features.Set(splitAndTrim(e.getEnv("GROXPI_FEATURES", ""), ",")...); err != nil {
+		panic(fmt.Sprintf("invalid GROXPI_FEATURES: %v", err))
+	}
+
+	// Protocols: HTTP/2 is negotiated over TLS; h2c and HTTP/3 are opt-in
+	cfg.TLSCertFile = e.getEnv("GROXPI_TLS_CERT_FILE", "")
+	cfg.TLSKeyFile = e.getEnv("GROXPI_TLS_KEY_FILE", "")
+	cfg.SigningKeyFile = e.getEnv("GROXPI_SIGNING_KEY_FILE", "")
+	cfg.H2C = e.getBoolEnv("GROXPI_H2C", false)
+	cfg.HTTP3 = e.getBoolEnv("GROXPI_HTTP3", cfg.Features.Enabled(feature.HTTP3))
+	cfg.HTTP3Addr = e.getEnv("GROXPI_HTTP3_LISTEN", ":"+cfg.Port)
+
+	// LAN cache sharing is opt-in
+	cfg.PeerCache = e.getBoolEnv("GROXPI_PEER_CACHE", cfg.Features.Enabled(feature.PeerCache))
+	cfg.PeerInstance = e.getEnv("GROXPI_PEER_INSTANCE", "")
+	port, _ := strconv.Atoi(cfg.Port)
+	cfg.PeerPort = int(e.getIntEnv("GROXPI_PEER_PORT", int64(port)))
+	cfg.PeerInterval = e.getDurationEnv("GROXPI_PEER_INTERVAL", 30*time.Second)
+	cfg.PeerTimeout = e.getDurationEnv("GROXPI_PEER_TIMEOUT", 2*time.Second)
+
 	// Parse timeout configurations
-	if connectTimeout := getEnv("GROXPI_CONNECT_TIMEOUT", ""); connectTimeout != "" {
-		cfg.ConnectTimeout = getFloatDurationEnv("GROXPI_CONNECT_TIMEOUT", 0)
+	if connectTimeout := e.getEnv("GROXPI_CONNECT_TIMEOUT", ""); connectTimeout != "" {
+		cfg.ConnectTimeout = e.getFloatDurationEnv("GROXPI_CONNECT_TIMEOUT", 0)
 	} else if cfg.ReadTimeout > 0 {
 		cfg.ConnectTimeout = 3100 * time.Millisecond
 	}
 
-	if readTimeout := getEnv("GROXPI_READ_TIMEOUT", ""); readTimeout != "" {
-		cfg.ReadTimeout = getFloatDurationEnv("GROXPI_READ_TIMEOUT", 0)
+	if readTimeout := e.getEnv("GROXPI_READ_TIMEOUT", ""); readTimeout != "" {
+		cfg.ReadTimeout = e.getFloatDurationEnv("GROXPI_READ_TIMEOUT", 0)
 	} else if cfg.ConnectTimeout > 0 {
 		cfg.ReadTimeout = 20 * time.Second
 	}
 
+	// A client leaving past half of a download leaves it to finish into storage
+	cfg.DisconnectCompleteThreshold = e.getFloatEnv("GROXPI_DISCONNECT_COMPLETE_THRESHOLD", 0.5)
+
+	// Expand placeholders in the S3 prefix, so clusters sharing a bucket
+	// each get a namespace of their own
+	prefix, err := ExpandPrefix(cfg.S3Prefix, getenv)
+	if err != nil {
+		panic(fmt.Sprintf("invalid GROXPI_S3_PREFIX: %v", err))
+	}
+	cfg.S3Prefix = prefix
+
 	// Set default cache dir if not specified
 	if cfg.CacheDir == "" {
 		cfg.CacheDir = os.TempDir()
@@ -158,34 +918,311 @@ func Load() *Config {
 		cfg.LocalCacheDir = cfg.CacheDir
 	}
 
-	// Validate S3 configuration if S3 or hybrid storage is selected
-	if cfg.StorageType == "s3" || cfg.StorageType == "hybrid" {
-		// Set S3 endpoint to AWS default if not specified
-		if cfg.S3Endpoint == "" {
-			cfg.S3Endpoint = "s3.amazonaws.com"
+	// Set S3 endpoint to AWS default if not specified
+	if (cfg.StorageType == "s3" || cfg.StorageType == "hybrid") && cfg.S3Endpoint == "" {
+		cfg.S3Endpoint = "s3.amazonaws.com"
+	}
+
+	// Parse bucket routes ("pattern=name" pairs); each bucket comes from
+	// GROXPI_S3_ROUTE_<NAME>_* variables, inheriting unset settings
+	if routes := e.getEnv("GROXPI_S3_ROUTES", ""); routes != "" {
+		for _, entry := range splitAndTrim(routes, ",") {
+			pattern, name, ok := strings.Cut(entry, "=")
+			pattern, name = strings.TrimSpace(pattern), strings.TrimSpace(name)
+			if _, err := path.Match(pattern, ""); !ok || pattern == "" || err != nil || !mountNamePattern.MatchString(name) {
+				panic(fmt.Sprintf("invalid GROXPI_S3_ROUTES entry %q: expected pattern=name with a glob pattern and a lowercase bucket name", entry))
+			}
+
+			envName := "GROXPI_S3_ROUTE_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+			route := S3Route{
+				Pattern:         pattern,
+				Name:            name,
+				Bucket:          e.getEnv(envName+"_BUCKET", ""),
+				Endpoint:        e.getEnv(envName+"_ENDPOINT", cfg.S3Endpoint),
+				AccessKeyID:     e.getEnv(envName+"_ACCESS_KEY_ID", cfg.S3AccessKeyID),
+				SecretAccessKey: e.getEnv(envName+"_SECRET_ACCESS_KEY", cfg.S3SecretAccessKey),
+				Region:          e.getEnv(envName+"_REGION", cfg.S3Region),
+				Prefix:          cfg.S3Prefix,
+			}
+			if route.Bucket == "" {
+				panic(fmt.Sprintf("invalid GROXPI_S3_ROUTES entry %q: %s_BUCKET is not set", entry, envName))
+			}
+			if prefix := e.getEnv(envName+"_PREFIX", ""); prefix != "" {
+				expanded, err := ExpandPrefix(prefix, getenv)
+				if err != nil {
+					panic(fmt.Sprintf("invalid %s_PREFIX: %v", envName, err))
+				}
+				route.Prefix = expanded
+			}
+			cfg.S3Routes = append(cfg.S3Routes, route)
 		}
+	}
+
+	return cfg
+}
 
-		// Validate required S3 settings
-		if cfg.S3Bucket == "" {
-			panic("GROXPI_S3_BUCKET must be set when using S3 or hybrid storage")
+// Validate reports settings that cannot work together
+func (c *Config) Validate() error {
+	// Validate required S3 settings if S3 or hybrid storage is selected
+	if c.StorageType == "s3" || c.StorageType == "hybrid" {
+		if c.S3Bucket == "" {
+			return errors.New("GROXPI_S3_BUCKET must be set when using S3 or hybrid storage")
 		}
-		if cfg.S3AccessKeyID == "" || cfg.S3SecretAccessKey == "" {
-			panic("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set when using S3 or hybrid storage")
+		if c.S3AccessKeyID == "" || c.S3SecretAccessKey == "" {
+			return errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set when using S3 or hybrid storage")
 		}
 	}
 
-	return cfg
+	if c.StorageType == "webdav" && c.WebDAVURL == "" {
+		return errors.New("GROXPI_WEBDAV_URL must be set when using WebDAV storage")
+	}
+
+	switch c.StorageWritePolicy {
+	case "", "last-writer-wins", "first-writer-wins":
+	default:
+		return fmt.Errorf("GROXPI_STORAGE_WRITE_POLICY must be last-writer-wins or first-writer-wins, got %q", c.StorageWritePolicy)
+	}
+
+	switch c.QuarantineUnknown {
+	case "", "deny", "allow":
+	default:
+		return fmt.Errorf("GROXPI_QUARANTINE_UNKNOWN must be deny or allow, got %q", c.QuarantineUnknown)
+	}
+
+	if c.ResponseCacheDir != "" {
+		switch c.ResponseCacheEncoding {
+		case "zstd", "gzip":
+		default:
+			return fmt.Errorf("GROXPI_RESPONSE_CACHE_ENCODING must be zstd or gzip, got %q", c.ResponseCacheEncoding)
+		}
+		if c.ResponseCacheSaveInterval <= 0 {
+			return errors.New("GROXPI_RESPONSE_CACHE_SAVE_INTERVAL must be positive")
+		}
+	}
+
+	// Only files cached on local disk are encrypted
+	if c.CacheEncryptionKey != "" && c.CacheEncryptionKeyFile != "" {
+		return errors.New("GROXPI_CACHE_ENCRYPTION_KEY and GROXPI_CACHE_ENCRYPTION_KEY_FILE cannot both be set")
+	}
+	if (c.CacheEncryptionKey != "" || c.CacheEncryptionKeyFile != "") && c.StorageType != "local" && c.StorageType != "hybrid" {
+		return errors.New("cache encryption requires GROXPI_STORAGE_TYPE to be local or hybrid")
+	}
+
+	// CDN redirects require an S3-backed origin
+	if c.CDNURL != "" && c.StorageType != "s3" && c.StorageType != "hybrid" {
+		return errors.New("GROXPI_CDN_URL requires GROXPI_STORAGE_TYPE to be s3 or hybrid")
+	}
+
+	// Routed buckets hang off the default one
+	if len(c.S3Routes) > 0 && c.StorageType != "s3" && c.StorageType != "hybrid" {
+		return errors.New("GROXPI_S3_ROUTES requires GROXPI_STORAGE_TYPE to be s3 or hybrid")
+	}
+	// CDN redirects point into the default bucket only
+	if len(c.S3Routes) > 0 && c.CDNURL != "" {
+		return errors.New("GROXPI_S3_ROUTES cannot be combined with GROXPI_CDN_URL")
+	}
+
+	// A full mirror does not fit the size-bounded local LRU cache
+	if c.MirrorEnabled && c.StorageType != "s3" && c.StorageType != "hybrid" && c.StorageType != "webdav" {
+		return errors.New("GROXPI_MIRROR_ENABLED requires GROXPI_STORAGE_TYPE to be s3, hybrid or webdav")
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("GROXPI_TLS_CERT_FILE and GROXPI_TLS_KEY_FILE must be set together")
+	}
+	if c.HTTP3 && c.TLSCertFile == "" {
+		return errors.New("GROXPI_HTTP3 requires GROXPI_TLS_CERT_FILE and GROXPI_TLS_KEY_FILE")
+	}
+
+	if c.RedirectAbove < 0 {
+		return errors.New("GROXPI_REDIRECT_ABOVE must not be negative")
+	}
+	if c.DisconnectCompleteThreshold < 0 || c.DisconnectCompleteThreshold > 1 {
+		return errors.New("GROXPI_DISCONNECT_COMPLETE_THRESHOLD must be between 0 and 1")
+	}
+
+	if c.AdaptiveTTL && c.AdaptiveTTLMin <= 0 {
+		return errors.New("GROXPI_ADAPTIVE_TTL_MIN must be positive")
+	}
+	if c.AdaptiveTTL && c.AdaptiveTTLMax < c.AdaptiveTTLMin {
+		return errors.New("GROXPI_ADAPTIVE_TTL_MAX must not be less than GROXPI_ADAPTIVE_TTL_MIN")
+	}
+
+	if c.CapacityAlertDays < 0 {
+		return errors.New("GROXPI_CAPACITY_ALERT_DAYS must not be negative")
+	}
+	if c.CapacitySampleInterval <= 0 || c.CapacityWindow < c.CapacitySampleInterval {
+		return errors.New("GROXPI_CAPACITY_SAMPLE_INTERVAL must be positive and GROXPI_CAPACITY_WINDOW at least as long")
+	}
+
+	if c.LogDebugSample < 0 {
+		return errors.New("GROXPI_LOG_DEBUG_SAMPLE must not be negative")
+	}
+	if !c.LogStdout && c.LogFile == "" && c.LogSyslog == "" && !c.LogJournald {
+		return errors.New("GROXPI_LOG_STDOUT=false requires GROXPI_LOG_FILE, GROXPI_LOG_SYSLOG or GROXPI_LOG_JOURNALD")
+	}
+	if c.LogFile != "" && (c.LogFileMaxSize < 0 || c.LogFileRotateInterval < 0 || c.LogFileMaxBackups < 0) {
+		return errors.New("GROXPI_LOG_FILE_MAX_SIZE, GROXPI_LOG_FILE_ROTATE_INTERVAL and GROXPI_LOG_FILE_MAX_BACKUPS must not be negative")
+	}
+
+	if c.LogSyslog != "" {
+		if _, _, err := logger.ParseSyslogAddress(c.LogSyslog); err != nil {
+			return fmt.Errorf("GROXPI_LOG_SYSLOG: %w", err)
+		}
+		if _, ok := logger.ParseFacility(c.LogSyslogFacility); !ok {
+			return fmt.Errorf("GROXPI_LOG_SYSLOG_FACILITY must be a syslog facility such as daemon or local0, got %q", c.LogSyslogFacility)
+		}
+	}
+
+	if c.PeerCache && (c.PeerPort <= 0 || c.PeerPort > 65535) {
+		return fmt.Errorf("GROXPI_PEER_PORT must be a port number, got %d", c.PeerPort)
+	}
+
+	for _, route := range c.IndexRoutes {
+		if err := validateIndexRoute(route); err != nil {
+			return err
+		}
+	}
+
+	for name, mount := range c.Mounts {
+		if mount.IndexURL == "" || !mountNamePattern.MatchString(name) || reservedMountNames[name] {
+			return fmt.Errorf("invalid mount %q: expected an index URL and a lowercase name not used by a root route", name)
+		}
+	}
+	return nil
+}
+
+func validateIndexRoute(route IndexRoute) error {
+	if _, err := path.Match(route.Pattern, ""); err != nil || route.Pattern == "" {
+		return fmt.Errorf("invalid index route pattern %q", route.Pattern)
+	}
+	parsed, err := url.Parse(route.IndexURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid index route URL %q for %q", route.IndexURL, route.Pattern)
+	}
+	return nil
+}
+
+// UserAgent returns the User-Agent for requests to the index and its files
+func (c *Config) UserAgent() string {
+	return version.UserAgent(c.UserAgentContact)
+}
+
+// ForMount returns the configuration for the mounted index name: the same
+// settings with that mount's upstream and a storage namespace of its own
+func (c *Config) ForMount(name string) *Config {
+	mount := c.Mounts[name]
+
+	mounted := *c
+	mounted.IndexURL = mount.IndexURL
+	mounted.IndexUsername = mount.Username
+	mounted.IndexPassword = mount.Password
+	mounted.IndexQuirks = mount.Quirks
+	mounted.ExtraIndexURLs = nil
+	mounted.IndexMirrors = nil
+	mounted.ExtraIndexTTLs = nil
+	mounted.Mounts = nil
+	mounted.MemoryShedThreshold = 0 // The heap is shared; the root watchdog covers mounts
+	mounted.CaptureFile = ""        // Mounts record into the root's capture file
+	mounted.PeerCache = false       // Mounts share the root's peer discovery
+	mounted.BasePath = c.BasePath + "/" + name
+
+	mounted.CacheDir = filepath.Join(c.CacheDir, name)
+	if c.MetadataDB != "" {
+		mounted.MetadataDB = filepath.Join(filepath.Dir(c.MetadataDB), name, filepath.Base(c.MetadataDB))
+	}
+	if c.MetadataCacheDir != "" {
+		mounted.MetadataCacheDir = filepath.Join(c.MetadataCacheDir, name)
+	}
+	if c.ResponseCacheDir != "" {
+		mounted.ResponseCacheDir = filepath.Join(c.ResponseCacheDir, name)
+	}
+	mounted.LocalCacheDir = filepath.Join(c.LocalCacheDir, name)
+	mounted.S3Prefix = path.Join(c.S3Prefix, name)
+	if c.WebDAVURL != "" {
+		mounted.WebDAVURL = strings.TrimSuffix(c.WebDAVURL, "/") + "/" + name + "/"
+	}
+	if len(c.S3Routes) > 0 {
+		mounted.S3Routes = make([]S3Route, len(c.S3Routes))
+		for i, route := range c.S3Routes {
+			route.Prefix = path.Join(route.Prefix, name)
+			mounted.S3Routes[i] = route
+		}
+	}
+
+	// The cache quota bounds the mount's local LRU cache (the L1 cache in
+	// hybrid mode)
+	if mount.CacheSize > 0 {
+		mounted.CacheSize = mount.CacheSize
+		mounted.LocalCacheSize = mount.CacheSize
+	}
+	if mount.RateLimit > 0 {
+		mounted.RateLimit = mount.RateLimit
+		mounted.RateBurst = mount.RateBurst
+	}
+	mounted.AuthTokens = mount.AuthTokens
+
+	// Mirroring follows the root index's package list only
+	mounted.MirrorEnabled = false
+
+	// Each mount follows the same mount on the primary
+	if c.ReplicationSource != "" {
+		mounted.ReplicationSource = strings.TrimSuffix(c.ReplicationSource, "/") + "/" + name
+	}
+	return &mounted
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+// prefixPlaceholder matches a {name} placeholder in a prefix template
+var prefixPlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+var (
+	placeholderNamePattern  = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	placeholderValuePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+)
+
+// ExpandPrefix replaces each {name} placeholder in template with the
+// environment variable NAME, e.g. {cluster}/{region} with the values of
+// CLUSTER and REGION. Each variable must be set to a single path segment,
+// so a missing or malformed value fails at startup instead of writing
+// objects under the wrong prefix.
+func ExpandPrefix(template string, getenv func(string) string) (string, error) {
+	var errs []error
+	expanded := prefixPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		if !placeholderNamePattern.MatchString(name) {
+			errs = append(errs, fmt.Errorf("invalid placeholder %s: expected a lowercase name", placeholder))
+			return ""
+		}
+		variable := strings.ToUpper(name)
+		value := getenv(variable)
+		if value == "" {
+			errs = append(errs, fmt.Errorf("placeholder %s needs %s to be set", placeholder, variable))
+		} else if !placeholderValuePattern.MatchString(value) || value == "." || value == ".." {
+			errs = append(errs, fmt.Errorf("%s=%q is not a valid prefix segment", variable, value))
+		}
+		return value
+	})
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+	if strings.ContainsAny(expanded, "{}") {
+		return "", fmt.Errorf("unbalanced braces in %q", template)
+	}
+	return expanded, nil
+}
+
+// env looks up environment variables
+type env func(key string) string
+
+func (e env) getEnv(key, defaultValue string) string {
+	if value := e(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
 
-func getIntEnv(key string, defaultValue int64) int64 {
-	if value := os.Getenv(key); value != "" {
+func (e env) getIntEnv(key string, defaultValue int64) int64 {
+	if value := e(key); value != "" {
 		if intVal, err := strconv.ParseInt(value, 10, 64); err == nil {
 			return intVal
 		}
@@ -193,8 +1230,8 @@ func getIntEnv(key string, defaultValue int64) int64 {
 	return defaultValue
 }
 
-func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
+func (e env) getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := e(key); value != "" {
 		if intVal, err := strconv.Atoi(value); err == nil {
 			return time.Duration(intVal) * time.Second
 		}
@@ -202,8 +1239,8 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
-func getFloatDurationEnv(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
+func (e env) getFloatDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := e(key); value != "" {
 		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
 			return time.Duration(floatVal * float64(time.Second))
 		}
@@ -211,8 +1248,17 @@ func getFloatDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
-func getBoolEnv(key string, defaultValue bool) bool {
-	value := strings.ToLower(os.Getenv(key))
+func (e env) getFloatEnv(key string, defaultValue float64) float64 {
+	if value := e(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return defaultValue
+}
+
+func (e env) getBoolEnv(key string, defaultValue bool) bool {
+	value := strings.ToLower(e(key))
 	if value == "" {
 		return defaultValue
 	}
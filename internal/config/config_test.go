@@ -2,8 +2,13 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/huyhandes/groxpi/internal/feature"
 )
 
 func TestLoad(t *testing.T) {
@@ -23,6 +28,11 @@ func TestLoad(t *testing.T) {
 		"GROXPI_EXTRA_INDEX_TTLS",
 		"GROXPI_CONNECT_TIMEOUT",
 		"GROXPI_READ_TIMEOUT",
+		"GROXPI_STORAGE_TYPE",
+		"GROXPI_CDN_URL",
+		"GROXPI_CDN_URL_TTL",
+		"GROXPI_MIRROR_ENABLED",
+		"GROXPI_MIRROR_PACKAGES",
 	}
 
 	for _, env := range envVars {
@@ -170,6 +180,1150 @@ func TestLoad(t *testing.T) {
 			t.Errorf("Expected ReadTimeout to be 30s, got %v", cfg.ReadTimeout)
 		}
 	})
+
+	t.Run("CDN requires S3-backed storage", func(t *testing.T) {
+		_ = os.Setenv("GROXPI_STORAGE_TYPE", "local")
+		_ = os.Setenv("GROXPI_CDN_URL", "https://d111.cloudfront.net")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_STORAGE_TYPE")
+			_ = os.Unsetenv("GROXPI_CDN_URL")
+		}()
+
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected panic when CDN is enabled with local storage")
+			}
+		}()
+
+		Load()
+	})
+
+	t.Run("CDN URL TTL default", func(t *testing.T) {
+		cfg := Load()
+
+		if cfg.CDNURL != "" {
+			t.Errorf("Expected CDN to be disabled by default, got %s", cfg.CDNURL)
+		}
+
+		if cfg.CDNURLTTL != 15*time.Minute {
+			t.Errorf("Expected default CDNURLTTL to be 15m, got %v", cfg.CDNURLTTL)
+		}
+	})
+
+	t.Run("Mirror requires S3-backed storage", func(t *testing.T) {
+		_ = os.Setenv("GROXPI_STORAGE_TYPE", "local")
+		_ = os.Setenv("GROXPI_MIRROR_ENABLED", "true")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_STORAGE_TYPE")
+			_ = os.Unsetenv("GROXPI_MIRROR_ENABLED")
+		}()
+
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected panic when mirror is enabled with local storage")
+			}
+		}()
+
+		Load()
+	})
+
+	t.Run("Mirror defaults and package subset", func(t *testing.T) {
+		_ = os.Setenv("GROXPI_MIRROR_PACKAGES", "numpy, requests ,")
+		defer func() { _ = os.Unsetenv("GROXPI_MIRROR_PACKAGES") }()
+
+		cfg := Load()
+
+		if cfg.MirrorEnabled {
+			t.Error("Expected mirror to be disabled by default")
+		}
+		if cfg.MirrorInterval != 24*time.Hour {
+			t.Errorf("Expected default MirrorInterval to be 24h, got %v", cfg.MirrorInterval)
+		}
+		if cfg.MirrorWorkers != 4 {
+			t.Errorf("Expected default MirrorWorkers to be 4, got %d", cfg.MirrorWorkers)
+		}
+		if len(cfg.MirrorPackages) != 2 || cfg.MirrorPackages[0] != "numpy" || cfg.MirrorPackages[1] != "requests" {
+			t.Errorf("Expected MirrorPackages [numpy requests], got %v", cfg.MirrorPackages)
+		}
+	})
+
+	t.Run("GC and trash defaults", func(t *testing.T) {
+		cfg := Load()
+
+		if cfg.GCMaxAge != 30*24*time.Hour {
+			t.Errorf("Expected default GCMaxAge to be 30 days, got %v", cfg.GCMaxAge)
+		}
+		if cfg.GCTempMaxAge != time.Hour {
+			t.Errorf("Expected default GCTempMaxAge to be 1h, got %v", cfg.GCTempMaxAge)
+		}
+		if cfg.TrashRetention != 7*24*time.Hour {
+			t.Errorf("Expected default TrashRetention to be 7 days, got %v", cfg.TrashRetention)
+		}
+	})
+
+	t.Run("Storage key template", func(t *testing.T) {
+		if cfg := Load(); cfg.StorageKeyTemplate != "packages/{package}/{file}" {
+			t.Errorf("Expected default key template, got %q", cfg.StorageKeyTemplate)
+		}
+
+		_ = os.Setenv("GROXPI_STORAGE_KEY_TEMPLATE", "packages/{hash2}/{package}/{file}")
+		defer func() { _ = os.Unsetenv("GROXPI_STORAGE_KEY_TEMPLATE") }()
+
+		_ = os.Setenv("GROXPI_STORAGE_KEY_FALLBACK_TEMPLATE", "packages/{package}/{file}")
+		defer func() { _ = os.Unsetenv("GROXPI_STORAGE_KEY_FALLBACK_TEMPLATE") }()
+
+		cfg := Load()
+		if cfg.StorageKeyTemplate != "packages/{hash2}/{package}/{file}" {
+			t.Errorf("Expected configured key template, got %q", cfg.StorageKeyTemplate)
+		}
+		if cfg.StorageKeyFallback != "packages/{package}/{file}" {
+			t.Errorf("Expected configured fallback template, got %q", cfg.StorageKeyFallback)
+		}
+	})
+
+	t.Run("Storage write policy", func(t *testing.T) {
+		if cfg := Load(); cfg.StorageWritePolicy != "last-writer-wins" {
+			t.Errorf("Expected default write policy, got %q", cfg.StorageWritePolicy)
+		}
+
+		_ = os.Setenv("GROXPI_STORAGE_WRITE_POLICY", "first-writer-wins")
+		defer func() { _ = os.Unsetenv("GROXPI_STORAGE_WRITE_POLICY") }()
+
+		cfg := Load()
+		if cfg.StorageWritePolicy != "first-writer-wins" {
+			t.Errorf("Expected configured write policy, got %q", cfg.StorageWritePolicy)
+		}
+		cfg.StorageWritePolicy = "newest"
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected an unknown write policy to be invalid")
+		}
+	})
+
+	t.Run("Cache encryption", func(t *testing.T) {
+		_ = os.Setenv("GROXPI_CACHE_ENCRYPTION_KEY_FILE", "/run/secrets/cache-key")
+		defer func() { _ = os.Unsetenv("GROXPI_CACHE_ENCRYPTION_KEY_FILE") }()
+
+		cfg := Load()
+		if cfg.CacheEncryptionKeyFile != "/run/secrets/cache-key" {
+			t.Errorf("Expected configured key file, got %q", cfg.CacheEncryptionKeyFile)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected encrypted local storage to be valid: %v", err)
+		}
+		cfg.CacheEncryptionKey = "a2V5"
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected a key and key file together to be invalid")
+		}
+		cfg.CacheEncryptionKey = ""
+		cfg.StorageType = "s3"
+		cfg.S3Bucket, cfg.S3AccessKeyID, cfg.S3SecretAccessKey = "bucket", "id", "secret"
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected encryption to be invalid for S3 storage")
+		}
+	})
+
+	t.Run("Warm workers", func(t *testing.T) {
+		if cfg := Load(); cfg.WarmWorkers != 4 {
+			t.Errorf("Expected default WarmWorkers to be 4, got %d", cfg.WarmWorkers)
+		}
+	})
+
+	t.Run("Webhooks", func(t *testing.T) {
+		if cfg := Load(); len(cfg.WebhookURLs) != 0 || cfg.UpstreamFailureThreshold != 5 {
+			t.Errorf("Expected webhooks disabled with a threshold of 5, got %v, %d", cfg.WebhookURLs, cfg.UpstreamFailureThreshold)
+		}
+
+		_ = os.Setenv("GROXPI_WEBHOOK_URLS", "https://hooks.example/a, https://hooks.example/b")
+		_ = os.Setenv("GROXPI_WEBHOOK_EVENTS", "file.cached,upstream.down")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_WEBHOOK_URLS")
+			_ = os.Unsetenv("GROXPI_WEBHOOK_EVENTS")
+		}()
+
+		cfg := Load()
+		if len(cfg.WebhookURLs) != 2 || cfg.WebhookURLs[1] != "https://hooks.example/b" {
+			t.Errorf("Unexpected webhook URLs %v", cfg.WebhookURLs)
+		}
+		if len(cfg.WebhookEvents) != 2 || cfg.WebhookEvents[0] != "file.cached" {
+			t.Errorf("Unexpected webhook events %v", cfg.WebhookEvents)
+		}
+	})
+
+	t.Run("Version retention", func(t *testing.T) {
+		if cfg := Load(); cfg.RetentionKeepVersions != 0 || len(cfg.RetentionRules) != 0 {
+			t.Errorf("Expected version retention disabled by default, got %d, %v", cfg.RetentionKeepVersions, cfg.RetentionRules)
+		}
+
+		_ = os.Setenv("GROXPI_RETENTION_KEEP_VERSIONS", "3")
+		_ = os.Setenv("GROXPI_RETENTION_RULES", "torch*=1, numpy=0")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_RETENTION_KEEP_VERSIONS")
+			_ = os.Unsetenv("GROXPI_RETENTION_RULES")
+		}()
+
+		cfg := Load()
+		if cfg.RetentionKeepVersions != 3 || len(cfg.RetentionRules) != 2 {
+			t.Fatalf("Unexpected retention config %d, %v", cfg.RetentionKeepVersions, cfg.RetentionRules)
+		}
+		if rule := cfg.RetentionRules[0]; rule.Pattern != "torch*" || rule.Keep != 1 {
+			t.Errorf("Unexpected first rule %+v", rule)
+		}
+
+		_ = os.Setenv("GROXPI_RETENTION_RULES", "torch")
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected panic for a rule without a count")
+			}
+		}()
+		Load()
+	})
+
+	t.Run("Version constraints", func(t *testing.T) {
+		if cfg := Load(); len(cfg.Constraints) != 0 {
+			t.Errorf("Expected no constraints by default, got %v", cfg.Constraints)
+		}
+
+		file := filepath.Join(t.TempDir(), "constraints.txt")
+		if err := os.WriteFile(file, []byte("# pins\nsetuptools<70\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_ = os.Setenv("GROXPI_CONSTRAINTS_FILE", file)
+		_ = os.Setenv("GROXPI_CONSTRAINTS", "numpy>=1.20,<2; urllib3!=2.0.*")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_CONSTRAINTS_FILE")
+			_ = os.Unsetenv("GROXPI_CONSTRAINTS")
+		}()
+
+		cfg := Load()
+		if len(cfg.Constraints) != 3 {
+			t.Fatalf("Expected 3 constraints, got %v", cfg.Constraints)
+		}
+		if got := cfg.Constraints[0].String() + " " + cfg.Constraints[1].String(); got != "setuptools<70 numpy>=1.20,<2" {
+			t.Errorf("Unexpected constraints %q", got)
+		}
+
+		_ = os.Setenv("GROXPI_CONSTRAINTS", "numpy; python_version<'3.9'")
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected panic for a constraint with a marker")
+			}
+		}()
+		Load()
+	})
+
+	t.Run("Index routes", func(t *testing.T) {
+		_ = os.Setenv("GROXPI_MOUNTS", "internal=https://pypi.acme.example/simple/")
+		_ = os.Setenv("GROXPI_MOUNT_INTERNAL_USERNAME", "ci")
+		_ = os.Setenv("GROXPI_INDEX_ROUTES", "acme-*=internal, legacy-*=https://legacy.example/simple/")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_MOUNTS")
+			_ = os.Unsetenv("GROXPI_MOUNT_INTERNAL_USERNAME")
+			_ = os.Unsetenv("GROXPI_INDEX_ROUTES")
+		}()
+
+		cfg := Load()
+		if len(cfg.IndexRoutes) != 2 {
+			t.Fatalf("Expected 2 routes, got %+v", cfg.IndexRoutes)
+		}
+		route, ok := cfg.RouteFor("Acme_Tools")
+		if !ok || route.IndexURL != "https://pypi.acme.example/simple/" || route.Username != "ci" {
+			t.Errorf("Expected acme packages routed to the internal mount, got %+v", route)
+		}
+		if route, ok := cfg.RouteFor("legacy-lib"); !ok || route.IndexURL != "https://legacy.example/simple/" || route.Username != "" {
+			t.Errorf("Unexpected legacy route %+v", route)
+		}
+		if _, ok := cfg.RouteFor("requests"); ok {
+			t.Error("Expected unmatched packages on the main index")
+		}
+		if _, ok := cfg.ForMount("internal").RouteFor("acme-tools"); !ok {
+			t.Error("Expected mounts to keep the routes")
+		}
+
+		_ = os.Setenv("GROXPI_INDEX_ROUTES", "acme-*=nowhere")
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected panic for a route to neither a mount nor a URL")
+			}
+		}()
+		Load()
+	})
+
+	t.Run("Quarantine", func(t *testing.T) {
+		if cfg := Load(); cfg.QuarantineWindow != 0 || len(cfg.QuarantineExempt) != 0 || cfg.QuarantineUnknown != "deny" {
+			t.Errorf("Expected quarantine disabled by default, got %v %v %q", cfg.QuarantineWindow, cfg.QuarantineExempt, cfg.QuarantineUnknown)
+		}
+
+		_ = os.Setenv("GROXPI_QUARANTINE_WINDOW", "172800")
+		_ = os.Setenv("GROXPI_QUARANTINE_EXEMPT", "internal-*, certifi")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_QUARANTINE_WINDOW")
+			_ = os.Unsetenv("GROXPI_QUARANTINE_EXEMPT")
+		}()
+
+		cfg := Load()
+		if cfg.QuarantineWindow != 48*time.Hour || len(cfg.QuarantineExempt) != 2 || cfg.QuarantineExempt[1] != "certifi" {
+			t.Errorf("Unexpected quarantine config %v %v", cfg.QuarantineWindow, cfg.QuarantineExempt)
+		}
+		cfg.QuarantineUnknown = "maybe"
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected an unknown GROXPI_QUARANTINE_UNKNOWN value to be invalid")
+		}
+
+		_ = os.Setenv("GROXPI_QUARANTINE_EXEMPT", "internal-[")
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected panic for an invalid exemption pattern")
+			}
+		}()
+		Load()
+	})
+
+	t.Run("Default ignores the environment", func(t *testing.T) {
+		_ = os.Setenv("GROXPI_INDEX_URL", "https://private.example/simple/")
+		defer func() { _ = os.Unsetenv("GROXPI_INDEX_URL") }()
+
+		cfg := Default()
+		if cfg.IndexURL != "https://pypi.org/simple/" || cfg.IndexTTL != 30*time.Minute || cfg.CacheDir == "" {
+			t.Errorf("Unexpected defaults: %q %v %q", cfg.IndexURL, cfg.IndexTTL, cfg.CacheDir)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected defaults to be valid, got %v", err)
+		}
+
+		cfg.StorageType = "s3"
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected S3 storage without a bucket to be invalid")
+		}
+	})
+
+	t.Run("Index mirror probing", func(t *testing.T) {
+		cfg := Load()
+		if len(cfg.IndexMirrors) != 0 || cfg.ProbeInterval != 30*time.Second || cfg.ProbeThreshold != 3 || cfg.ProbeSwitchMargin != 0.3 {
+			t.Errorf("Unexpected probe defaults: %v %v %d %v", cfg.IndexMirrors, cfg.ProbeInterval, cfg.ProbeThreshold, cfg.ProbeSwitchMargin)
+		}
+
+		_ = os.Setenv("GROXPI_INDEX_MIRRORS", "https://mirror-a.example/simple/, https://mirror-b.example/simple/")
+		defer func() { _ = os.Unsetenv("GROXPI_INDEX_MIRRORS") }()
+
+		cfg = Load()
+		if len(cfg.IndexMirrors) != 2 || cfg.IndexMirrors[1] != "https://mirror-b.example/simple/" {
+			t.Errorf("Unexpected index mirrors %v", cfg.IndexMirrors)
+		}
+	})
+
+	t.Run("Job persistence", func(t *testing.T) {
+		if cfg := Load(); cfg.JobsPersist {
+			t.Error("Expected jobs to be in-memory by default")
+		}
+
+		_ = os.Setenv("GROXPI_JOBS_PERSIST", "true")
+		defer func() { _ = os.Unsetenv("GROXPI_JOBS_PERSIST") }()
+
+		if cfg := Load(); !cfg.JobsPersist {
+			t.Error("Expected GROXPI_JOBS_PERSIST to enable persistence")
+		}
+	})
+
+	t.Run("File passthrough hosts", func(t *testing.T) {
+		if cfg := Load(); len(cfg.FilesProxyHosts) != 0 {
+			t.Errorf("Expected file passthrough to be disabled by default, got %v", cfg.FilesProxyHosts)
+		}
+
+		_ = os.Setenv("GROXPI_FILES_PROXY_HOSTS", "files.pythonhosted.org, download.pytorch.org")
+		defer func() { _ = os.Unsetenv("GROXPI_FILES_PROXY_HOSTS") }()
+
+		cfg := Load()
+		if len(cfg.FilesProxyHosts) != 2 || cfg.FilesProxyHosts[1] != "download.pytorch.org" {
+			t.Errorf("Expected two passthrough hosts, got %v", cfg.FilesProxyHosts)
+		}
+	})
+
+	t.Run("Gzip exclusions", func(t *testing.T) {
+		cfg := Load()
+		if !slices.Contains(cfg.GzipExcludedExtensions, ".whl") || !slices.Contains(cfg.GzipExcludedTypes, "application/zip") {
+			t.Errorf("Expected wheels and zip files excluded by default, got %v and %v", cfg.GzipExcludedExtensions, cfg.GzipExcludedTypes)
+		}
+
+		_ = os.Setenv("GROXPI_GZIP_EXCLUDED_EXTENSIONS", ".whl, .tar.gz")
+		_ = os.Setenv("GROXPI_GZIP_EXCLUDED_TYPES", "application/zip")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_GZIP_EXCLUDED_EXTENSIONS")
+			_ = os.Unsetenv("GROXPI_GZIP_EXCLUDED_TYPES")
+		}()
+
+		cfg = Load()
+		if !slices.Equal(cfg.GzipExcludedExtensions, []string{".whl", ".tar.gz"}) || !slices.Equal(cfg.GzipExcludedTypes, []string{"application/zip"}) {
+			t.Errorf("Unexpected exclusions %v and %v", cfg.GzipExcludedExtensions, cfg.GzipExcludedTypes)
+		}
+	})
+
+	t.Run("Upstream limiter", func(t *testing.T) {
+		cfg := Load()
+		if cfg.DegradedTTL != 30*time.Second {
+			t.Errorf("Expected default DegradedTTL to be 30s, got %v", cfg.DegradedTTL)
+		}
+		if cfg.UpstreamMaxConcurrency != 0 {
+			t.Errorf("Expected upstream limiter to be disabled by default, got %d", cfg.UpstreamMaxConcurrency)
+		}
+		if cfg.UpstreamQueueTimeout != 30*time.Second {
+			t.Errorf("Expected default UpstreamQueueTimeout to be 30s, got %v", cfg.UpstreamQueueTimeout)
+		}
+
+		_ = os.Setenv("GROXPI_UPSTREAM_MAX_CONCURRENCY", "64")
+		defer func() { _ = os.Unsetenv("GROXPI_UPSTREAM_MAX_CONCURRENCY") }()
+
+		if cfg := Load(); cfg.UpstreamMaxConcurrency != 64 {
+			t.Errorf("Expected UpstreamMaxConcurrency 64, got %d", cfg.UpstreamMaxConcurrency)
+		}
+
+		if cfg.UpstreamKeepaliveInterval != 0 {
+			t.Errorf("Expected keepalive to be disabled by default, got %v", cfg.UpstreamKeepaliveInterval)
+		}
+		_ = os.Setenv("GROXPI_UPSTREAM_KEEPALIVE_INTERVAL", "20")
+		defer func() { _ = os.Unsetenv("GROXPI_UPSTREAM_KEEPALIVE_INTERVAL") }()
+		if cfg := Load(); cfg.UpstreamKeepaliveInterval != 20*time.Second {
+			t.Errorf("Expected UpstreamKeepaliveInterval 20s, got %v", cfg.UpstreamKeepaliveInterval)
+		}
+	})
+
+	t.Run("Request deadlines", func(t *testing.T) {
+		cfg := Load()
+		if cfg.IndexRequestTimeout != 2*time.Minute || cfg.DownloadRequestTimeout != 2*time.Hour || cfg.AdminRequestTimeout != 30*time.Minute {
+			t.Errorf("Unexpected default deadlines %v/%v/%v", cfg.IndexRequestTimeout, cfg.DownloadRequestTimeout, cfg.AdminRequestTimeout)
+		}
+		_ = os.Setenv("GROXPI_INDEX_REQUEST_TIMEOUT", "15")
+		_ = os.Setenv("GROXPI_DOWNLOAD_REQUEST_TIMEOUT", "0")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_INDEX_REQUEST_TIMEOUT")
+			_ = os.Unsetenv("GROXPI_DOWNLOAD_REQUEST_TIMEOUT")
+		}()
+		if cfg := Load(); cfg.IndexRequestTimeout != 15*time.Second || cfg.DownloadRequestTimeout != 0 {
+			t.Errorf("Expected 15s and no download deadline, got %v/%v", cfg.IndexRequestTimeout, cfg.DownloadRequestTimeout)
+		}
+	})
+
+	t.Run("Memory tuning", func(t *testing.T) {
+		if cfg := Load(); cfg.MemoryLimit != 0 || cfg.GCPercent != 0 || cfg.MemoryShedThreshold != 0 {
+			t.Errorf("Expected memory tuning off by default, got %d/%d/%d", cfg.MemoryLimit, cfg.GCPercent, cfg.MemoryShedThreshold)
+		}
+		_ = os.Setenv("GROXPI_MEMORY_LIMIT", "1073741824")
+		_ = os.Setenv("GROXPI_GC_PERCENT", "50")
+		_ = os.Setenv("GROXPI_MEMORY_SHED_THRESHOLD", "805306368")
+		_ = os.Setenv("GROXPI_MOUNTS", "prod=https://pypi.org/simple/")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_MEMORY_LIMIT")
+			_ = os.Unsetenv("GROXPI_GC_PERCENT")
+			_ = os.Unsetenv("GROXPI_MEMORY_SHED_THRESHOLD")
+			_ = os.Unsetenv("GROXPI_MOUNTS")
+		}()
+		cfg := Load()
+		if cfg.MemoryLimit != 1<<30 || cfg.GCPercent != 50 || cfg.MemoryShedThreshold != 768<<20 {
+			t.Errorf("Unexpected memory tuning %d/%d/%d", cfg.MemoryLimit, cfg.GCPercent, cfg.MemoryShedThreshold)
+		}
+		if cfg.ForMount("prod").MemoryShedThreshold != 0 {
+			t.Error("Expected mounts to leave shedding to the root watchdog")
+		}
+	})
+
+	t.Run("Prefetch", func(t *testing.T) {
+		cfg := Load()
+		if cfg.PrefetchEnabled || len(cfg.PrefetchPlatforms) != 1 || cfg.PrefetchPlatforms[0] != "any" || cfg.PrefetchCooldown != time.Hour {
+			t.Errorf("Unexpected prefetch defaults %v/%v/%v", cfg.PrefetchEnabled, cfg.PrefetchPlatforms, cfg.PrefetchCooldown)
+		}
+		_ = os.Setenv("GROXPI_PREFETCH_ENABLED", "true")
+		_ = os.Setenv("GROXPI_PREFETCH_PLATFORMS", "manylinux2014_x86_64, any")
+		_ = os.Setenv("GROXPI_PREFETCH_PYTHON_TAGS", "cp312,py3")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_PREFETCH_ENABLED")
+			_ = os.Unsetenv("GROXPI_PREFETCH_PLATFORMS")
+			_ = os.Unsetenv("GROXPI_PREFETCH_PYTHON_TAGS")
+		}()
+		cfg = Load()
+		if !cfg.PrefetchEnabled || len(cfg.PrefetchPlatforms) != 2 || cfg.PrefetchPlatforms[1] != "any" || len(cfg.PrefetchPythonTags) != 2 {
+			t.Errorf("Unexpected prefetch settings %v/%v/%v", cfg.PrefetchEnabled, cfg.PrefetchPlatforms, cfg.PrefetchPythonTags)
+		}
+	})
+
+	t.Run("Chaos", func(t *testing.T) {
+		cfg := Load()
+		if cfg.ChaosEnabled || len(cfg.ChaosFaults) != 3 || len(cfg.ChaosBoundaries) != 2 || cfg.ChaosRate != 0.05 || cfg.ChaosMaxDelay != 5*time.Second {
+			t.Errorf("Unexpected fault injection defaults %v/%v/%v/%v/%v", cfg.ChaosEnabled, cfg.ChaosFaults, cfg.ChaosBoundaries, cfg.ChaosRate, cfg.ChaosMaxDelay)
+		}
+		_ = os.Setenv("GROXPI_CHAOS_ENABLED", "true")
+		_ = os.Setenv("GROXPI_CHAOS_FAULTS", "delay")
+		_ = os.Setenv("GROXPI_CHAOS_RATE", "0.5")
+		_ = os.Setenv("GROXPI_CHAOS_MAX_DELAY", "0.25")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_CHAOS_ENABLED")
+			_ = os.Unsetenv("GROXPI_CHAOS_FAULTS")
+			_ = os.Unsetenv("GROXPI_CHAOS_RATE")
+			_ = os.Unsetenv("GROXPI_CHAOS_MAX_DELAY")
+		}()
+		cfg = Load()
+		if !cfg.ChaosEnabled || len(cfg.ChaosFaults) != 1 || cfg.ChaosRate != 0.5 || cfg.ChaosMaxDelay != 250*time.Millisecond {
+			t.Errorf("Unexpected fault injection settings %v/%v/%v/%v", cfg.ChaosEnabled, cfg.ChaosFaults, cfg.ChaosRate, cfg.ChaosMaxDelay)
+		}
+	})
+
+	t.Run("Index early refresh", func(t *testing.T) {
+		if cfg := Load(); cfg.IndexEarlyRefresh != 1 {
+			t.Errorf("Expected early refresh eagerness 1 by default, got %v", cfg.IndexEarlyRefresh)
+		}
+		_ = os.Setenv("GROXPI_INDEX_EARLY_REFRESH", "0")
+		defer func() { _ = os.Unsetenv("GROXPI_INDEX_EARLY_REFRESH") }()
+		if cfg := Load(); cfg.IndexEarlyRefresh != 0 {
+			t.Errorf("Expected early refresh disabled, got %v", cfg.IndexEarlyRefresh)
+		}
+	})
+
+	t.Run("Stable JSON", func(t *testing.T) {
+		if cfg := Load(); cfg.StableJSON {
+			t.Error("Expected stable JSON to be disabled by default")
+		}
+		_ = os.Setenv("GROXPI_STABLE_JSON", "true")
+		defer func() { _ = os.Unsetenv("GROXPI_STABLE_JSON") }()
+		if cfg := Load(); !cfg.StableJSON {
+			t.Error("Expected stable JSON to be enabled")
+		}
+	})
+
+	t.Run("Metadata budgets", func(t *testing.T) {
+		cfg := Load()
+		if cfg.MetadataCacheDir != "" || cfg.MetadataCacheSize != 256*1024*1024 || cfg.ResponseCacheSize != 50*1024*1024 {
+			t.Errorf("Unexpected metadata defaults %q/%d/%d", cfg.MetadataCacheDir, cfg.MetadataCacheSize, cfg.ResponseCacheSize)
+		}
+		_ = os.Setenv("GROXPI_METADATA_CACHE_DIR", "/var/lib/groxpi/metadata")
+		_ = os.Setenv("GROXPI_METADATA_CACHE_SIZE", "1048576")
+		_ = os.Setenv("GROXPI_RESPONSE_CACHE_SIZE", "2097152")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_METADATA_CACHE_DIR")
+			_ = os.Unsetenv("GROXPI_METADATA_CACHE_SIZE")
+			_ = os.Unsetenv("GROXPI_RESPONSE_CACHE_SIZE")
+		}()
+		if cfg := Load(); cfg.MetadataCacheDir != "/var/lib/groxpi/metadata" || cfg.MetadataCacheSize != 1048576 || cfg.ResponseCacheSize != 2097152 {
+			t.Errorf("Unexpected metadata budgets %q/%d/%d", cfg.MetadataCacheDir, cfg.MetadataCacheSize, cfg.ResponseCacheSize)
+		}
+	})
+
+	t.Run("Persistent response cache", func(t *testing.T) {
+		cfg := Load()
+		if cfg.ResponseCacheDir != "" || cfg.ResponseCacheEncoding != "zstd" || cfg.ResponseCacheSaveInterval != 5*time.Minute {
+			t.Errorf("Unexpected response cache defaults %q/%q/%v", cfg.ResponseCacheDir, cfg.ResponseCacheEncoding, cfg.ResponseCacheSaveInterval)
+		}
+		_ = os.Setenv("GROXPI_RESPONSE_CACHE_DIR", "/var/lib/groxpi/responses")
+		_ = os.Setenv("GROXPI_RESPONSE_CACHE_ENCODING", "GZIP")
+		_ = os.Setenv("GROXPI_RESPONSE_CACHE_SAVE_INTERVAL", "60")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_RESPONSE_CACHE_DIR")
+			_ = os.Unsetenv("GROXPI_RESPONSE_CACHE_ENCODING")
+			_ = os.Unsetenv("GROXPI_RESPONSE_CACHE_SAVE_INTERVAL")
+		}()
+		cfg = Load()
+		if cfg.ResponseCacheDir != "/var/lib/groxpi/responses" || cfg.ResponseCacheEncoding != "gzip" || cfg.ResponseCacheSaveInterval != time.Minute {
+			t.Errorf("Unexpected response cache settings %q/%q/%v", cfg.ResponseCacheDir, cfg.ResponseCacheEncoding, cfg.ResponseCacheSaveInterval)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected valid settings, got %v", err)
+		}
+		if mounted := cfg.ForMount("internal"); mounted.ResponseCacheDir != "/var/lib/groxpi/responses/internal" {
+			t.Errorf("Expected mounts to save to a subdirectory, got %q", mounted.ResponseCacheDir)
+		}
+
+		cfg.ResponseCacheEncoding = "brotli"
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected an unknown encoding to be rejected")
+		}
+	})
+
+	t.Run("Client team header", func(t *testing.T) {
+		if cfg := Load(); cfg.ClientTeamHeader != "" {
+			t.Errorf("Expected no team header by default, got %q", cfg.ClientTeamHeader)
+		}
+		_ = os.Setenv("GROXPI_CLIENT_TEAM_HEADER", "X-CI-Pipeline")
+		defer func() { _ = os.Unsetenv("GROXPI_CLIENT_TEAM_HEADER") }()
+		if cfg := Load(); cfg.ClientTeamHeader != "X-CI-Pipeline" {
+			t.Errorf("Expected X-CI-Pipeline, got %q", cfg.ClientTeamHeader)
+		}
+	})
+
+	t.Run("Eviction grace", func(t *testing.T) {
+		if cfg := Load(); cfg.EvictionGrace != 5*time.Minute {
+			t.Errorf("Expected a 5m eviction grace by default, got %v", cfg.EvictionGrace)
+		}
+		_ = os.Setenv("GROXPI_EVICTION_GRACE", "0")
+		defer func() { _ = os.Unsetenv("GROXPI_EVICTION_GRACE") }()
+		if cfg := Load(); cfg.EvictionGrace != 0 {
+			t.Errorf("Expected the eviction grace to be disabled, got %v", cfg.EvictionGrace)
+		}
+	})
+
+	t.Run("S3 routes", func(t *testing.T) {
+		_ = os.Setenv("GROXPI_STORAGE_TYPE", "s3")
+		_ = os.Setenv("GROXPI_S3_BUCKET", "groxpi")
+		_ = os.Setenv("AWS_ACCESS_KEY_ID", "key")
+		_ = os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+		_ = os.Setenv("GROXPI_S3_ROUTES", "torch-*=bulk, *.provenance=fast")
+		_ = os.Setenv("GROXPI_S3_ROUTE_BULK_BUCKET", "groxpi-bulk")
+		_ = os.Setenv("GROXPI_S3_ROUTE_BULK_ACCESS_KEY_ID", "bulk-key")
+		_ = os.Setenv("GROXPI_S3_ROUTE_FAST_BUCKET", "groxpi-fast")
+		_ = os.Setenv("GROXPI_S3_ROUTE_FAST_PREFIX", "metadata")
+		defer func() {
+			for _, name := range []string{"GROXPI_STORAGE_TYPE", "GROXPI_S3_BUCKET", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "GROXPI_S3_ROUTES",
+				"GROXPI_S3_ROUTE_BULK_BUCKET", "GROXPI_S3_ROUTE_BULK_ACCESS_KEY_ID", "GROXPI_S3_ROUTE_FAST_BUCKET", "GROXPI_S3_ROUTE_FAST_PREFIX"} {
+				_ = os.Unsetenv(name)
+			}
+		}()
+
+		cfg := Load()
+		if len(cfg.S3Routes) != 2 {
+			t.Fatalf("Expected 2 routes, got %+v", cfg.S3Routes)
+		}
+		bulk, fast := cfg.S3Routes[0], cfg.S3Routes[1]
+		if bulk.Pattern != "torch-*" || bulk.Bucket != "groxpi-bulk" || bulk.AccessKeyID != "bulk-key" || bulk.Endpoint != "s3.amazonaws.com" || bulk.Prefix != "groxpi" {
+			t.Errorf("Unexpected bulk route %+v", bulk)
+		}
+		if fast.Pattern != "*.provenance" || fast.Bucket != "groxpi-fast" || fast.AccessKeyID != "key" || fast.Prefix != "metadata" {
+			t.Errorf("Unexpected fast route %+v", fast)
+		}
+		if mounted := cfg.ForMount("prod"); mounted.S3Routes[1].Prefix != "metadata/prod" || cfg.S3Routes[1].Prefix != "metadata" {
+			t.Errorf("Expected mounts to append their name to route prefixes, got %+v", mounted.S3Routes)
+		}
+
+		cfg.CDNURL = "https://cdn.example.com"
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected routes combined with a CDN to be rejected")
+		}
+
+		_ = os.Unsetenv("GROXPI_S3_ROUTE_FAST_BUCKET")
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected panic for a route without a bucket")
+			}
+		}()
+		Load()
+	})
+
+	t.Run("WebDAV storage", func(t *testing.T) {
+		_ = os.Setenv("GROXPI_STORAGE_TYPE", "webdav")
+		_ = os.Setenv("GROXPI_WEBDAV_URL", "https://nas.example.com/dav/groxpi/")
+		_ = os.Setenv("GROXPI_WEBDAV_USERNAME", "groxpi")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_STORAGE_TYPE")
+			_ = os.Unsetenv("GROXPI_WEBDAV_URL")
+			_ = os.Unsetenv("GROXPI_WEBDAV_USERNAME")
+		}()
+
+		cfg := Load()
+		if cfg.WebDAVURL != "https://nas.example.com/dav/groxpi/" || cfg.WebDAVUsername != "groxpi" {
+			t.Errorf("Unexpected WebDAV settings %q/%q", cfg.WebDAVURL, cfg.WebDAVUsername)
+		}
+		if mounted := cfg.ForMount("prod"); mounted.WebDAVURL != "https://nas.example.com/dav/groxpi/prod/" {
+			t.Errorf("Expected mounts to get a collection of their own, got %q", mounted.WebDAVURL)
+		}
+		cfg.MirrorEnabled = true
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected mirroring onto WebDAV to be allowed, got %v", err)
+		}
+
+		cfg.WebDAVURL = ""
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected WebDAV storage without a URL to be rejected")
+		}
+	})
+
+	t.Run("S3 parallel downloads", func(t *testing.T) {
+		if cfg := Load(); cfg.S3DownloadPartSize != 16*1024*1024 || cfg.S3DownloadConcurrency != 4 {
+			t.Errorf("Unexpected parallel download defaults %d/%d", cfg.S3DownloadPartSize, cfg.S3DownloadConcurrency)
+		}
+		_ = os.Setenv("GROXPI_S3_DOWNLOAD_PART_SIZE", "8388608")
+		_ = os.Setenv("GROXPI_S3_DOWNLOAD_CONCURRENCY", "1")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_S3_DOWNLOAD_PART_SIZE")
+			_ = os.Unsetenv("GROXPI_S3_DOWNLOAD_CONCURRENCY")
+		}()
+		if cfg := Load(); cfg.S3DownloadPartSize != 8*1024*1024 || cfg.S3DownloadConcurrency != 1 {
+			t.Errorf("Unexpected parallel download settings %d/%d", cfg.S3DownloadPartSize, cfg.S3DownloadConcurrency)
+		}
+	})
+
+	t.Run("Spot checks", func(t *testing.T) {
+		if cfg := Load(); cfg.VerifyRate != 0 {
+			t.Errorf("Expected spot checks disabled by default, got %v", cfg.VerifyRate)
+		}
+		_ = os.Setenv("GROXPI_VERIFY_RATE", "0.01")
+		defer func() { _ = os.Unsetenv("GROXPI_VERIFY_RATE") }()
+		if cfg := Load(); cfg.VerifyRate != 0.01 {
+			t.Errorf("Expected a 0.01 verify rate, got %v", cfg.VerifyRate)
+		}
+
+		_ = os.Setenv("GROXPI_VERIFY_RATE", "1.5")
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected panic for a verify rate above 1")
+			}
+		}()
+		Load()
+	})
+
+	t.Run("Unix socket mode", func(t *testing.T) {
+		if cfg := Load(); cfg.UnixSocketMode != 0660 {
+			t.Errorf("Expected default socket mode 0660, got %o", cfg.UnixSocketMode)
+		}
+		_ = os.Setenv("GROXPI_UNIX_SOCKET_MODE", "0600")
+		defer func() { _ = os.Unsetenv("GROXPI_UNIX_SOCKET_MODE") }()
+		if cfg := Load(); cfg.UnixSocketMode != 0600 {
+			t.Errorf("Expected socket mode 0600, got %o", cfg.UnixSocketMode)
+		}
+
+		for _, mode := range []string{"rw-rw----", "0999", "10000"} {
+			_ = os.Setenv("GROXPI_UNIX_SOCKET_MODE", mode)
+			func() {
+				defer func() {
+					if r := recover(); r == nil {
+						t.Errorf("Expected panic for socket mode %q", mode)
+					}
+				}()
+				Load()
+			}()
+		}
+	})
+
+	t.Run("Hot packages", func(t *testing.T) {
+		cfg := Load()
+		if cfg.HotPackages != 0 || cfg.HotHalfLife != time.Hour || cfg.HotRefreshInterval != time.Minute || cfg.HotTTLFactor != 4 {
+			t.Errorf("Unexpected hot package defaults %v/%v/%v/%v", cfg.HotPackages, cfg.HotHalfLife, cfg.HotRefreshInterval, cfg.HotTTLFactor)
+		}
+		_ = os.Setenv("GROXPI_HOT_PACKAGES", "50")
+		_ = os.Setenv("GROXPI_HOT_HALF_LIFE", "600")
+		_ = os.Setenv("GROXPI_HOT_TTL_FACTOR", "2.5")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_HOT_PACKAGES")
+			_ = os.Unsetenv("GROXPI_HOT_HALF_LIFE")
+			_ = os.Unsetenv("GROXPI_HOT_TTL_FACTOR")
+		}()
+		cfg = Load()
+		if cfg.HotPackages != 50 || cfg.HotHalfLife != 10*time.Minute || cfg.HotTTLFactor != 2.5 {
+			t.Errorf("Unexpected hot package settings %v/%v/%v", cfg.HotPackages, cfg.HotHalfLife, cfg.HotTTLFactor)
+		}
+	})
+
+	t.Run("Capture", func(t *testing.T) {
+		if cfg := Load(); cfg.CaptureFile != "" {
+			t.Errorf("Expected capture off by default, got %q", cfg.CaptureFile)
+		}
+		_ = os.Setenv("GROXPI_CAPTURE_FILE", "/var/log/groxpi/capture.jsonl")
+		_ = os.Setenv("GROXPI_MOUNTS", "internal=https://pypi.internal.example/simple/")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_CAPTURE_FILE")
+			_ = os.Unsetenv("GROXPI_MOUNTS")
+		}()
+		cfg := Load()
+		if cfg.CaptureFile != "/var/log/groxpi/capture.jsonl" {
+			t.Errorf("Unexpected capture file %q", cfg.CaptureFile)
+		}
+		if mounted := cfg.ForMount("internal"); mounted.CaptureFile != "" {
+			t.Errorf("Expected mounts to share the root capture file, got %q", mounted.CaptureFile)
+		}
+	})
+
+	t.Run("Index encodings", func(t *testing.T) {
+		if cfg := Load(); len(cfg.IndexEncodings) != 2 || cfg.IndexEncodings[0] != "zstd" || cfg.IndexEncodings[1] != "gzip" {
+			t.Errorf("Expected zstd,gzip by default, got %v", cfg.IndexEncodings)
+		}
+		_ = os.Setenv("GROXPI_INDEX_ENCODINGS", "identity")
+		defer func() { _ = os.Unsetenv("GROXPI_INDEX_ENCODINGS") }()
+		if cfg := Load(); len(cfg.IndexEncodings) != 1 || cfg.IndexEncodings[0] != "identity" {
+			t.Errorf("Expected identity, got %v", cfg.IndexEncodings)
+		}
+	})
+
+	t.Run("Peer cache", func(t *testing.T) {
+		env := map[string]string{"PORT": "8080", "GROXPI_FEATURES": "peer-cache"}
+		cfg := load(func(key string) string { return env[key] })
+		if !cfg.PeerCache || cfg.PeerPort != 8080 || cfg.PeerInterval != 30*time.Second || cfg.PeerTimeout != 2*time.Second {
+			t.Errorf("Expected the peer-cache flag to enable sharing on the listen port, got %v on %d every %v", cfg.PeerCache, cfg.PeerPort, cfg.PeerInterval)
+		}
+		if cfg.ForMount("ml").PeerCache {
+			t.Error("Expected mounts to share the root's peer discovery")
+		}
+
+		env["GROXPI_PEER_CACHE"] = "false"
+		if load(func(key string) string { return env[key] }).PeerCache {
+			t.Error("Expected GROXPI_PEER_CACHE to override the peer-cache flag")
+		}
+
+		cfg.PeerPort = 70000
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected an out-of-range peer port to be invalid")
+		}
+	})
+
+	t.Run("Download policies", func(t *testing.T) {
+		env := map[string]string{
+			"GROXPI_REDIRECT_ABOVE":    "1073741824",
+			"GROXPI_DOWNLOAD_POLICIES": "torch=redirect, acme-*=stream,tensorflow*=104857600",
+			"GROXPI_DOWNLOAD_TIMEOUT":  "1",
+		}
+		cfg := load(func(key string) string { return env[key] })
+		if len(cfg.DownloadPolicies) != 3 {
+			t.Fatalf("Expected 3 download policies, got %+v", cfg.DownloadPolicies)
+		}
+
+		tests := []struct {
+			pkg      string
+			size     int64
+			redirect bool
+		}{
+			{"six", 1 << 20, false},
+			{"six", 0, false},
+			{"nvidia-cudnn-cu12", 2 << 30, true},
+			{"torch", 1 << 20, true},
+			{"Acme_Models", 2 << 30, false},
+			{"tensorflow-gpu", 200 << 20, true},
+			{"tensorflow-gpu", 50 << 20, false},
+		}
+		for _, tt := range tests {
+			if got := cfg.RedirectsDownload(tt.pkg, tt.size); got != tt.redirect {
+				t.Errorf("RedirectsDownload(%q, %d) = %v, want %v", tt.pkg, tt.size, got, tt.redirect)
+			}
+		}
+
+		cfg.DownloadTimeout = 0
+		if !cfg.RedirectsDownload("acme-models", 1) {
+			t.Error("Expected every file to be redirected without a download timeout")
+		}
+
+		env["GROXPI_DOWNLOAD_POLICIES"] = "torch=sometimes"
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected an invalid download policy to panic")
+			}
+		}()
+		load(func(key string) string { return env[key] })
+	})
+
+	t.Run("Disconnect completion threshold", func(t *testing.T) {
+		env := map[string]string{}
+		cfg := load(func(key string) string { return env[key] })
+		if cfg.DisconnectCompleteThreshold != 0.5 {
+			t.Errorf("Expected downloads past half to be completed, got %v", cfg.DisconnectCompleteThreshold)
+		}
+
+		env["GROXPI_DISCONNECT_COMPLETE_THRESHOLD"] = "1.5"
+		if err := load(func(key string) string { return env[key] }).Validate(); err == nil {
+			t.Error("Expected a threshold above 1 to be invalid")
+		}
+	})
+
+	t.Run("Adaptive TTL", func(t *testing.T) {
+		env := map[string]string{"GROXPI_ADAPTIVE_TTL": "true"}
+		cfg := load(func(key string) string { return env[key] })
+		if !cfg.AdaptiveTTL || cfg.AdaptiveTTLMin != 5*time.Minute || cfg.AdaptiveTTLMax != 24*time.Hour {
+			t.Errorf("Expected adaptive TTLs between 5m and 24h, got %v between %v and %v", cfg.AdaptiveTTL, cfg.AdaptiveTTLMin, cfg.AdaptiveTTLMax)
+		}
+
+		env["GROXPI_ADAPTIVE_TTL_MIN"] = "7200"
+		env["GROXPI_ADAPTIVE_TTL_MAX"] = "3600"
+		if err := load(func(key string) string { return env[key] }).Validate(); err == nil {
+			t.Error("Expected a maximum below the minimum to be invalid")
+		}
+	})
+
+	t.Run("Log file", func(t *testing.T) {
+		env := map[string]string{"GROXPI_LOG_FILE": "/var/log/groxpi/groxpi.log"}
+		cfg := load(func(key string) string { return env[key] })
+		if cfg.LogFileMaxSize != 100*1024*1024 || cfg.LogFileRotateInterval != 24*time.Hour || cfg.LogFileMaxBackups != 7 || !cfg.LogFileCompress || !cfg.LogStdout {
+			t.Errorf("Expected daily or 100MB compressed rotation keeping 7 files alongside stdout, got %+v", cfg)
+		}
+
+		env["GROXPI_LOG_FILE_MAX_BACKUPS"] = "-1"
+		if err := load(func(key string) string { return env[key] }).Validate(); err == nil {
+			t.Error("Expected a negative backup count to be invalid")
+		}
+
+		env = map[string]string{"GROXPI_LOG_STDOUT": "false"}
+		if err := load(func(key string) string { return env[key] }).Validate(); err == nil {
+			t.Error("Expected logging nowhere to be invalid")
+		}
+	})
+
+	t.Run("Syslog", func(t *testing.T) {
+		env := map[string]string{"GROXPI_LOG_SYSLOG": "udp://logs:514", "GROXPI_LOG_STDOUT": "false"}
+		cfg := load(func(key string) string { return env[key] })
+		if err := cfg.Validate(); err != nil || cfg.LogSyslogTag != "groxpi" || cfg.LogSyslogFacility != "daemon" {
+			t.Errorf("Expected syslog alone to be valid with the daemon facility, got %v, %q, %q", err, cfg.LogSyslogTag, cfg.LogSyslogFacility)
+		}
+
+		env["GROXPI_LOG_SYSLOG_FACILITY"] = "local9"
+		if err := load(func(key string) string { return env[key] }).Validate(); err == nil {
+			t.Error("Expected an unknown facility to be invalid")
+		}
+
+		env = map[string]string{"GROXPI_LOG_SYSLOG": "logs:514"}
+		if err := load(func(key string) string { return env[key] }).Validate(); err == nil {
+			t.Error("Expected an address without a scheme to be invalid")
+		}
+	})
+
+	t.Run("Log levels", func(t *testing.T) {
+		env := map[string]string{"GROXPI_LOG_LEVELS": "storage=debug, streaming=WARN", "GROXPI_LOG_DEBUG_SAMPLE": "50"}
+		cfg := load(func(key string) string { return env[key] })
+		if cfg.LogLevels["storage"] != "DEBUG" || cfg.LogLevels["streaming"] != "WARN" || cfg.LogDebugSample != 50 {
+			t.Errorf("Expected storage=DEBUG, streaming=WARN and a sample of 50, got %v, %d", cfg.LogLevels, cfg.LogDebugSample)
+		}
+
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected an unknown level to panic")
+			}
+		}()
+		env["GROXPI_LOG_LEVELS"] = "storage=LOUD"
+		load(func(key string) string { return env[key] })
+	})
+
+	t.Run("Feature flags", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "features")
+		if err := os.WriteFile(path, []byte("http3\npeer-cache\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_ = os.Setenv("GROXPI_FEATURES_FILE", path)
+		_ = os.Setenv("GROXPI_FEATURES", "-peer-cache")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_FEATURES_FILE")
+			_ = os.Unsetenv("GROXPI_FEATURES")
+		}()
+
+		cfg := load(os.Getenv)
+		if !cfg.Features.Enabled(feature.HTTP3) || cfg.Features.Enabled(feature.PeerCache) {
+			t.Errorf("Expected GROXPI_FEATURES to override the file, got %v", cfg.Features)
+		}
+		if !cfg.HTTP3 {
+			t.Error("Expected the http3 flag to enable HTTP/3")
+		}
+
+		_ = os.Setenv("GROXPI_HTTP3", "false")
+		defer func() { _ = os.Unsetenv("GROXPI_HTTP3") }()
+		if load(os.Getenv).HTTP3 {
+			t.Error("Expected GROXPI_HTTP3 to override the http3 flag")
+		}
+
+		_ = os.Setenv("GROXPI_FEATURES", "warp-drive")
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected a panic for an unknown feature")
+			}
+		}()
+		load(os.Getenv)
+	})
+
+	t.Run("User agent contact", func(t *testing.T) {
+		_ = os.Setenv("GROXPI_USER_AGENT_CONTACT", "ops@example.com")
+		defer func() { _ = os.Unsetenv("GROXPI_USER_AGENT_CONTACT") }()
+		cfg := Load()
+		if cfg.UserAgentContact != "ops@example.com" {
+			t.Errorf("Expected contact ops@example.com, got %q", cfg.UserAgentContact)
+		}
+		if ua := cfg.UserAgent(); !strings.HasPrefix(ua, "groxpi/") || !strings.HasSuffix(ua, " (+ops@example.com)") {
+			t.Errorf("Expected contact in User-Agent, got %q", ua)
+		}
+	})
+
+	t.Run("S3 prefix placeholders", func(t *testing.T) {
+		vars := map[string]string{"CLUSTER": "prod", "REGION": "eu-west-1", "BAD": "a/b"}
+		getenv := func(key string) string { return vars[key] }
+
+		tests := map[string]string{
+			"groxpi":                    "groxpi",
+			"groxpi/{cluster}/{region}": "groxpi/prod/eu-west-1",
+			"{cluster}-cache/":          "prod-cache/",
+		}
+		for template, want := range tests {
+			if got, err := ExpandPrefix(template, getenv); err != nil || got != want {
+				t.Errorf("ExpandPrefix(%q) = %q, %v; want %q", template, got, err, want)
+			}
+		}
+		for _, template := range []string{"groxpi/{zone}", "groxpi/{bad}", "groxpi/{Cluster}", "groxpi/{cluster", "groxpi/cluster}"} {
+			if got, err := ExpandPrefix(template, getenv); err == nil {
+				t.Errorf("Expected ExpandPrefix(%q) to fail, got %q", template, got)
+			}
+		}
+
+		_ = os.Setenv("GROXPI_S3_PREFIX", "groxpi/{groxpi_test_cluster}")
+		_ = os.Setenv("GROXPI_TEST_CLUSTER", "staging")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_S3_PREFIX")
+			_ = os.Unsetenv("GROXPI_TEST_CLUSTER")
+		}()
+		if cfg := Load(); cfg.S3Prefix != "groxpi/staging" {
+			t.Errorf("Expected the prefix expanded at load, got %q", cfg.S3Prefix)
+		}
+
+		_ = os.Unsetenv("GROXPI_TEST_CLUSTER")
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected Load to panic on an unset placeholder variable")
+			}
+		}()
+		Load()
+	})
+
+	t.Run("Mounted indexes", func(t *testing.T) {
+		_ = os.Setenv("GROXPI_MOUNTS", "prod=https://pypi.org/simple/, staging-eu=https://staging.example.com/simple/")
+		_ = os.Setenv("GROXPI_MOUNT_STAGING_EU_USERNAME", "ci")
+		_ = os.Setenv("GROXPI_MOUNT_STAGING_EU_PASSWORD", "secret")
+		_ = os.Setenv("GROXPI_MOUNT_STAGING_EU_QUIRKS", "artifactory")
+		_ = os.Setenv("GROXPI_INDEX_QUIRKS", "loose-html")
+		_ = os.Setenv("GROXPI_CACHE_DIR", "/var/cache/groxpi")
+		_ = os.Setenv("GROXPI_METADATA_DB", "/var/lib/groxpi/catalog.db")
+		_ = os.Setenv("GROXPI_METADATA_CACHE_DIR", "/var/lib/groxpi/metadata")
+		_ = os.Setenv("GROXPI_REPLICATION_SOURCE", "http://primary:5000/")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_MOUNTS")
+			_ = os.Unsetenv("GROXPI_MOUNT_STAGING_EU_USERNAME")
+			_ = os.Unsetenv("GROXPI_MOUNT_STAGING_EU_PASSWORD")
+			_ = os.Unsetenv("GROXPI_MOUNT_STAGING_EU_QUIRKS")
+			_ = os.Unsetenv("GROXPI_INDEX_QUIRKS")
+			_ = os.Unsetenv("GROXPI_CACHE_DIR")
+			_ = os.Unsetenv("GROXPI_METADATA_DB")
+			_ = os.Unsetenv("GROXPI_METADATA_CACHE_DIR")
+			_ = os.Unsetenv("GROXPI_REPLICATION_SOURCE")
+		}()
+
+		cfg := Load()
+		if len(cfg.Mounts) != 2 {
+			t.Fatalf("Expected 2 mounts, got %v", cfg.Mounts)
+		}
+		if m := cfg.Mounts["staging-eu"]; m.IndexURL != "https://staging.example.com/simple/" || m.Username != "ci" || m.Password != "secret" {
+			t.Errorf("Unexpected staging-eu mount: %+v", m)
+		}
+
+		mounted := cfg.ForMount("staging-eu")
+		if mounted.IndexURL != "https://staging.example.com/simple/" || mounted.IndexUsername != "ci" {
+			t.Errorf("Expected mount upstream and credentials, got %q as %q", mounted.IndexURL, mounted.IndexUsername)
+		}
+		if len(mounted.IndexQuirks) != 1 || mounted.IndexQuirks[0] != "artifactory" || cfg.IndexQuirks[0] != "loose-html" {
+			t.Errorf("Expected the mount's own quirks, got %v (root %v)", mounted.IndexQuirks, cfg.IndexQuirks)
+		}
+		if mounted.BasePath != "/staging-eu" || mounted.CacheDir != "/var/cache/groxpi/staging-eu" || mounted.S3Prefix != "groxpi/staging-eu" {
+			t.Errorf("Unexpected namespace: base=%q cache=%q s3=%q", mounted.BasePath, mounted.CacheDir, mounted.S3Prefix)
+		}
+		if mounted.MetadataDB != "/var/lib/groxpi/staging-eu/catalog.db" {
+			t.Errorf("Expected a metadata database per mount, got %q", mounted.MetadataDB)
+		}
+		if mounted.MetadataCacheDir != "/var/lib/groxpi/metadata/staging-eu" {
+			t.Errorf("Expected a metadata cache per mount, got %q", mounted.MetadataCacheDir)
+		}
+		if mounted.ReplicationSource != "http://primary:5000/staging-eu" {
+			t.Errorf("Expected the mount to follow the same mount on the primary, got %q", mounted.ReplicationSource)
+		}
+		if mounted.Mounts != nil || cfg.CacheDir != "/var/cache/groxpi" {
+			t.Error("ForMount must not nest mounts or modify the root config")
+		}
+	})
+
+	t.Run("Tenant limits", func(t *testing.T) {
+		_ = os.Setenv("GROXPI_RATE_LIMIT", "50")
+		_ = os.Setenv("GROXPI_AUTH_TOKENS", "root-token")
+		_ = os.Setenv("GROXPI_MOUNTS", "prod=https://pypi.org/simple/,dev=https://pypi.org/simple/")
+		_ = os.Setenv("GROXPI_MOUNT_PROD_CACHE_SIZE", "1048576")
+		_ = os.Setenv("GROXPI_MOUNT_PROD_RATE_LIMIT", "2.5")
+		_ = os.Setenv("GROXPI_MOUNT_PROD_AUTH_TOKENS", "a, b")
+		defer func() {
+			for _, key := range []string{"GROXPI_RATE_LIMIT", "GROXPI_AUTH_TOKENS", "GROXPI_MOUNTS",
+				"GROXPI_MOUNT_PROD_CACHE_SIZE", "GROXPI_MOUNT_PROD_RATE_LIMIT", "GROXPI_MOUNT_PROD_AUTH_TOKENS"} {
+				_ = os.Unsetenv(key)
+			}
+		}()
+
+		cfg := Load()
+		prod := cfg.ForMount("prod")
+		if prod.CacheSize != 1048576 || prod.RateLimit != 2.5 || len(prod.AuthTokens) != 2 {
+			t.Errorf("Unexpected prod limits: cache=%d rate=%v tokens=%v", prod.CacheSize, prod.RateLimit, prod.AuthTokens)
+		}
+
+		// Unset limits are inherited, tokens never are
+		dev := cfg.ForMount("dev")
+		if dev.CacheSize != cfg.CacheSize || dev.RateLimit != 50 || len(dev.AuthTokens) != 0 {
+			t.Errorf("Unexpected dev limits: cache=%d rate=%v tokens=%v", dev.CacheSize, dev.RateLimit, dev.AuthTokens)
+		}
+	})
+
+	t.Run("Reserved mount names", func(t *testing.T) {
+		_ = os.Setenv("GROXPI_MOUNTS", "simple=https://pypi.org/simple/")
+		defer func() { _ = os.Unsetenv("GROXPI_MOUNTS") }()
+
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected panic for a mount named after a root route")
+			}
+		}()
+		Load()
+	})
+
+	t.Run("Client connection tuning", func(t *testing.T) {
+		cfg := Load()
+		if cfg.UVCompat || cfg.KeepAliveTimeout != 75*time.Second || cfg.MaxConcurrentStreams != 250 {
+			t.Errorf("Unexpected defaults: uv_compat=%v keepalive=%v streams=%d", cfg.UVCompat, cfg.KeepAliveTimeout, cfg.MaxConcurrentStreams)
+		}
+
+		_ = os.Setenv("GROXPI_UV_COMPAT", "true")
+		defer func() { _ = os.Unsetenv("GROXPI_UV_COMPAT") }()
+
+		cfg = Load()
+		if !cfg.UVCompat || cfg.KeepAliveTimeout != 120*time.Second || cfg.MaxConcurrentStreams != 1000 {
+			t.Errorf("Unexpected uv compat defaults: keepalive=%v streams=%d", cfg.KeepAliveTimeout, cfg.MaxConcurrentStreams)
+		}
+
+		// Explicit settings win over the compat defaults
+		_ = os.Setenv("GROXPI_KEEPALIVE_TIMEOUT", "0")
+		defer func() { _ = os.Unsetenv("GROXPI_KEEPALIVE_TIMEOUT") }()
+
+		if cfg := Load(); cfg.KeepAliveTimeout != 0 {
+			t.Errorf("Expected keep-alive to be disabled, got %v", cfg.KeepAliveTimeout)
+		}
+	})
+
+	t.Run("Request limits", func(t *testing.T) {
+		cfg := Load()
+		if cfg.ReadHeaderTimeout != 10*time.Second || cfg.ServerReadTimeout != 0 || cfg.ServerWriteTimeout != 0 {
+			t.Errorf("Unexpected timeouts: header=%v read=%v write=%v", cfg.ReadHeaderTimeout, cfg.ServerReadTimeout, cfg.ServerWriteTimeout)
+		}
+		if cfg.MaxHeaderBytes != 64*1024 || cfg.MaxURLLength != 8192 || cfg.MaxParamLength != 512 || cfg.MaxBodyBytes != 0 {
+			t.Errorf("Unexpected size limits: header=%d url=%d param=%d body=%d", cfg.MaxHeaderBytes, cfg.MaxURLLength, cfg.MaxParamLength, cfg.MaxBodyBytes)
+		}
+
+		_ = os.Setenv("GROXPI_SERVER_WRITE_TIMEOUT", "600")
+		_ = os.Setenv("GROXPI_MAX_BODY_BYTES", "1048576")
+		defer func() {
+			_ = os.Unsetenv("GROXPI_SERVER_WRITE_TIMEOUT")
+			_ = os.Unsetenv("GROXPI_MAX_BODY_BYTES")
+		}()
+
+		cfg = Load()
+		if cfg.ServerWriteTimeout != 10*time.Minute || cfg.MaxBodyBytes != 1048576 {
+			t.Errorf("Unexpected configured limits: write=%v body=%d", cfg.ServerWriteTimeout, cfg.MaxBodyBytes)
+		}
+	})
+
+	t.Run("Protocols", func(t *testing.T) {
+		cfg := Load()
+		if cfg.TLSCertFile != "" || cfg.H2C || cfg.HTTP3 || cfg.HTTP3Addr != ":"+cfg.Port {
+			t.Errorf("Expected plain HTTP/1.1 by default, got tls=%q h2c=%v http3=%v on %q", cfg.TLSCertFile, cfg.H2C, cfg.HTTP3, cfg.HTTP3Addr)
+		}
+
+		cfg.HTTP3 = true
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected HTTP/3 without a certificate to be rejected")
+		}
+		cfg.TLSCertFile = "cert.pem"
+		if err := cfg.Validate(); err == nil {
+			t.Error("Expected a certificate without a key to be rejected")
+		}
+		cfg.TLSKeyFile = "key.pem"
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected HTTP/3 with TLS to be valid, got %v", err)
+		}
+	})
 }
 
 // GetEnv is not exported, skip these tests
@@ -0,0 +1,117 @@
+// Package constraint enforces organization-wide version constraints such as
+// "setuptools<70": files of versions a constraint excludes are dropped from
+// the file lists the index serves, so projects without a constraints file
+// still resolve within policy.
+package constraint
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/huyhandes/groxpi/internal/distfile"
+)
+
+// Constraint limits the versions of one package
+type Constraint struct {
+	Package    string // Normalized package name
+	Specifiers distfile.Specifiers
+}
+
+// String formats the constraint as a requirement, e.g. "setuptools<70"
+func (c Constraint) String() string {
+	return c.Package + c.Specifiers.String()
+}
+
+// Parse parses a requirement-style constraint such as "numpy>=1.20,<2".
+// Extras, URLs and environment markers can't be evaluated by the index and
+// are rejected.
+func Parse(s string) (Constraint, error) {
+	s = strings.TrimSpace(s)
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+	})
+	if end <= 0 {
+		return Constraint{}, fmt.Errorf("constraint %q has no package name or version specifier", s)
+	}
+	rest := strings.TrimSpace(s[end:])
+	if strings.ContainsAny(rest, "[;@") {
+		return Constraint{}, fmt.Errorf("constraint %q: extras, URLs and markers aren't supported", s)
+	}
+	specs, err := distfile.ParseSpecifiers(rest)
+	if err != nil {
+		return Constraint{}, fmt.Errorf("constraint %q: %w", s, err)
+	}
+	return Constraint{Package: distfile.NormalizeName(s[:end]), Specifiers: specs}, nil
+}
+
+// ReadFile reads constraints in the constraints.txt format: one per line,
+// with blank lines and '#' comments ignored
+func ReadFile(path string) ([]Constraint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var constraints []Constraint
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		c, err := Parse(line)
+		if err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, c)
+	}
+	return constraints, scanner.Err()
+}
+
+// Policy holds the constraints of every package; constraints on the same
+// package must all hold
+type Policy struct {
+	packages map[string]distfile.Specifiers
+}
+
+// New returns a policy, or nil when there are no constraints. A nil policy
+// allows everything.
+func New(constraints []Constraint) *Policy {
+	if len(constraints) == 0 {
+		return nil
+	}
+	p := &Policy{packages: make(map[string]distfile.Specifiers)}
+	for _, c := range constraints {
+		p.packages[c.Package] = append(p.packages[c.Package], c.Specifiers...)
+	}
+	return p
+}
+
+// Specifiers returns the specifiers constraining pkg (nil = unconstrained)
+func (p *Policy) Specifiers(pkg string) distfile.Specifiers {
+	if p == nil {
+		return nil
+	}
+	return p.packages[distfile.NormalizeName(pkg)]
+}
+
+// Allows reports whether version of pkg is within policy
+func (p *Policy) Allows(pkg, version string) bool {
+	return p.Specifiers(pkg).Allows(version)
+}
+
+// AllowsFile reports whether the file of pkg is within policy. Files whose
+// name doesn't parse carry no version to judge and are allowed.
+func (p *Policy) AllowsFile(pkg, filename string) bool {
+	if p.Specifiers(pkg) == nil {
+		return true
+	}
+	f, err := distfile.Parse(filename)
+	if err != nil {
+		return true
+	}
+	return p.Allows(pkg, f.Version)
+}
@@ -0,0 +1,80 @@
+package constraint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	c, err := Parse(" Setuptools < 70 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Package != "setuptools" || c.String() != "setuptools<70" {
+		t.Errorf("Unexpected constraint %+v", c)
+	}
+
+	for _, s := range []string{"", "numpy", "<2", "numpy[extra]<2", "numpy<2; python_version<'3.9'", "numpy @ https://example.com/numpy.whl", "numpy<banana"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Expected Parse(%q) to fail", s)
+		}
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "constraints.txt")
+	content := "# Org-wide pins\nsetuptools<70\n\nnumpy>=1.20,<2  # until the 2.x migration\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	constraints, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(constraints) != 2 || constraints[0].String() != "setuptools<70" || constraints[1].String() != "numpy>=1.20,<2" {
+		t.Errorf("Unexpected constraints %v", constraints)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	var constraints []Constraint
+	for _, s := range []string{"setuptools<70", "numpy>=1.20", "numpy<2"} {
+		c, err := Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		constraints = append(constraints, c)
+	}
+	p := New(constraints)
+
+	tests := []struct {
+		pkg, file string
+		want      bool
+	}{
+		{"setuptools", "setuptools-69.5.1-py3-none-any.whl", true},
+		{"setuptools", "setuptools-70.0.0-py3-none-any.whl", false},
+		{"Setuptools", "setuptools-70.0.0.tar.gz", false},
+		{"numpy", "numpy-1.26.4-cp312-cp312-manylinux_2_17_x86_64.whl", true},
+		{"numpy", "numpy-2.0.0-cp312-cp312-manylinux_2_17_x86_64.whl", false},
+		{"numpy", "numpy-1.19.5.zip", false},
+		{"numpy", "README.txt", true},
+		{"requests", "requests-2.32.3-py3-none-any.whl", true},
+	}
+	for _, tt := range tests {
+		if got := p.AllowsFile(tt.pkg, tt.file); got != tt.want {
+			t.Errorf("AllowsFile(%q, %q) = %v, want %v", tt.pkg, tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestPolicy_Nil(t *testing.T) {
+	p := New(nil)
+	if p != nil {
+		t.Fatalf("Expected no policy without constraints, got %+v", p)
+	}
+	if !p.AllowsFile("setuptools", "setuptools-70.0.0.tar.gz") || p.Specifiers("setuptools") != nil {
+		t.Error("Expected a nil policy to allow everything")
+	}
+}
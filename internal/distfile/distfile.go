@@ -0,0 +1,181 @@
+// Package distfile parses Python distribution filenames (wheels, sdists and
+// legacy eggs) into their name, version and compatibility tags.
+package distfile
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
+)
+
+// Kind is the distribution format of a file
+type Kind string
+
+const (
+	KindWheel Kind = "wheel"
+	KindSdist Kind = "sdist"
+	KindEgg   Kind = "egg"
+)
+
+// ErrInvalid is returned for filenames that are not a recognised distribution
+var ErrInvalid = errors.New("not a distribution filename")
+
+// sdistExtensions are the source distribution archive formats
+var sdistExtensions = []string{".tar.gz", ".tar.bz2", ".tar.xz", ".tar.Z", ".tgz", ".tbz", ".tar", ".zip"}
+
+// File is a parsed distribution filename. Name and Version are as written in
+// the filename; use NormalizedName to compare projects.
+type File struct {
+	Filename  string `json:"filename"`
+	Kind      Kind   `json:"kind"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Extension string `json:"extension"`
+
+	// Wheel only; tag sets are compressed in filenames ("py2.py3") and are
+	// split here
+	BuildTag     string   `json:"build_tag,omitempty"`
+	PythonTags   []string `json:"python_tags,omitempty"`
+	ABITags      []string `json:"abi_tags,omitempty"`
+	PlatformTags []string `json:"platform_tags,omitempty"`
+
+	// Egg only
+	PythonVersion string `json:"python_version,omitempty"`
+	Platform      string `json:"platform,omitempty"`
+}
+
+// Parse parses a wheel, sdist or egg filename
+func Parse(filename string) (File, error) {
+	switch {
+	case strings.HasSuffix(filename, ".whl"):
+		return parseWheel(filename)
+	case strings.HasSuffix(filename, ".egg"):
+		return parseEgg(filename)
+	}
+
+	for _, ext := range sdistExtensions {
+		if strings.HasSuffix(filename, ext) {
+			return parseSdist(filename, ext)
+		}
+	}
+	return File{}, ErrInvalid
+}
+
+// parseWheel parses {name}-{version}(-{build})?-{python}-{abi}-{platform}.whl
+func parseWheel(filename string) (File, error) {
+	parts := strings.Split(strings.TrimSuffix(filename, ".whl"), "-")
+	if len(parts) != 5 && len(parts) != 6 {
+		return File{}, ErrInvalid
+	}
+	for _, part := range parts {
+		if part == "" {
+			return File{}, ErrInvalid
+		}
+	}
+
+	f := File{
+		Filename:     filename,
+		Kind:         KindWheel,
+		Name:         parts[0],
+		Version:      parts[1],
+		Extension:    ".whl",
+		PythonTags:   strings.Split(parts[len(parts)-3], "."),
+		ABITags:      strings.Split(parts[len(parts)-2], "."),
+		PlatformTags: strings.Split(parts[len(parts)-1], "."),
+	}
+	if len(parts) == 6 {
+		// Build tags must start with a digit
+		if !isDigit(parts[2][0]) {
+			return File{}, ErrInvalid
+		}
+		f.BuildTag = parts[2]
+	}
+	return f, nil
+}
+
+// parseSdist parses {name}-{version}{ext}. Legacy sdists may have '-' in the
+// name, so the version is everything after the last '-'.
+func parseSdist(filename, ext string) (File, error) {
+	base := strings.TrimSuffix(filename, ext)
+	i := strings.LastIndex(base, "-")
+	if i <= 0 || i == len(base)-1 {
+		return File{}, ErrInvalid
+	}
+	return File{
+		Filename:  filename,
+		Kind:      KindSdist,
+		Name:      base[:i],
+		Version:   base[i+1:],
+		Extension: ext,
+	}, nil
+}
+
+// parseEgg parses {name}-{version}(-py{X.Y}(-{platform})?)?.egg
+func parseEgg(filename string) (File, error) {
+	parts := strings.SplitN(strings.TrimSuffix(filename, ".egg"), "-", 4)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return File{}, ErrInvalid
+	}
+
+	f := File{
+		Filename:  filename,
+		Kind:      KindEgg,
+		Name:      parts[0],
+		Version:   parts[1],
+		Extension: ".egg",
+	}
+	if len(parts) > 2 {
+		if !strings.HasPrefix(parts[2], "py") {
+			return File{}, ErrInvalid
+		}
+		f.PythonVersion = strings.TrimPrefix(parts[2], "py")
+	}
+	if len(parts) > 3 {
+		f.Platform = parts[3]
+	}
+	return f, nil
+}
+
+// NormalizedName returns the PEP 503 normalized project name
+func (f File) NormalizedName() string {
+	return NormalizeName(f.Name)
+}
+
+// IsPure reports whether a wheel runs on any platform and Python ABI
+func (f File) IsPure() bool {
+	return f.Kind == KindWheel && contains(f.ABITags, "none") && contains(f.PlatformTags, "any")
+}
+
+// Tags expands a wheel's compressed tag sets into every
+// {python}-{abi}-{platform} triple it supports
+func (f File) Tags() []string {
+	tags := make([]string, 0, len(f.PythonTags)*len(f.ABITags)*len(f.PlatformTags))
+	for _, py := range f.PythonTags {
+		for _, abi := range f.ABITags {
+			for _, platform := range f.PlatformTags {
+				tags = append(tags, py+"-"+abi+"-"+platform)
+			}
+		}
+	}
+	return tags
+}
+
+// NormalizeName lowercases a project name and collapses runs of '-', '_'
+// and '.' into a single '-' (PEP 503)
+func NormalizeName(name string) string {
+	return cachekey.Package(name)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
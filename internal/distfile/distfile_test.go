@@ -0,0 +1,242 @@
+package distfile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse_Wheel(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     File
+	}{
+		{"requests-2.31.0-py3-none-any.whl", File{
+			Name: "requests", Version: "2.31.0",
+			PythonTags: []string{"py3"}, ABITags: []string{"none"}, PlatformTags: []string{"any"},
+		}},
+		{"six-1.16.0-py2.py3-none-any.whl", File{
+			Name: "six", Version: "1.16.0",
+			PythonTags: []string{"py2", "py3"}, ABITags: []string{"none"}, PlatformTags: []string{"any"},
+		}},
+		{"numpy-1.26.4-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl", File{
+			Name: "numpy", Version: "1.26.4",
+			PythonTags: []string{"cp312"}, ABITags: []string{"cp312"},
+			PlatformTags: []string{"manylinux_2_17_x86_64", "manylinux2014_x86_64"},
+		}},
+		{"numpy-1.26.4-cp311-cp311-win_amd64.whl", File{
+			Name: "numpy", Version: "1.26.4",
+			PythonTags: []string{"cp311"}, ABITags: []string{"cp311"}, PlatformTags: []string{"win_amd64"},
+		}},
+		{"numpy-1.26.4-pp39-pypy39_pp73-macosx_10_9_x86_64.whl", File{
+			Name: "numpy", Version: "1.26.4",
+			PythonTags: []string{"pp39"}, ABITags: []string{"pypy39_pp73"}, PlatformTags: []string{"macosx_10_9_x86_64"},
+		}},
+		{"cryptography-42.0.5-cp39-abi3-musllinux_1_2_aarch64.whl", File{
+			Name: "cryptography", Version: "42.0.5",
+			PythonTags: []string{"cp39"}, ABITags: []string{"abi3"}, PlatformTags: []string{"musllinux_1_2_aarch64"},
+		}},
+		{"pydantic_core-2.16.3-cp312-none-win32.whl", File{
+			Name: "pydantic_core", Version: "2.16.3",
+			PythonTags: []string{"cp312"}, ABITags: []string{"none"}, PlatformTags: []string{"win32"},
+		}},
+		{"torch-2.0.0+cpu-cp310-cp310-linux_x86_64.whl", File{
+			Name: "torch", Version: "2.0.0+cpu",
+			PythonTags: []string{"cp310"}, ABITags: []string{"cp310"}, PlatformTags: []string{"linux_x86_64"},
+		}},
+		{"tensorflow-2.15.0.post1-cp311-cp311-macosx_12_0_arm64.whl", File{
+			Name: "tensorflow", Version: "2.15.0.post1",
+			PythonTags: []string{"cp311"}, ABITags: []string{"cp311"}, PlatformTags: []string{"macosx_12_0_arm64"},
+		}},
+		{"Django-5.0.3-py3-none-any.whl", File{
+			Name: "Django", Version: "5.0.3",
+			PythonTags: []string{"py3"}, ABITags: []string{"none"}, PlatformTags: []string{"any"},
+		}},
+		{"zope.interface-6.2-cp312-cp312-macosx_11_0_arm64.whl", File{
+			Name: "zope.interface", Version: "6.2",
+			PythonTags: []string{"cp312"}, ABITags: []string{"cp312"}, PlatformTags: []string{"macosx_11_0_arm64"},
+		}},
+		{"pywin32-306-cp312-cp312-win_arm64.whl", File{
+			Name: "pywin32", Version: "306",
+			PythonTags: []string{"cp312"}, ABITags: []string{"cp312"}, PlatformTags: []string{"win_arm64"},
+		}},
+		{"black-24.3.0-cp312-cp312-macosx_10_9_universal2.whl", File{
+			Name: "black", Version: "24.3.0",
+			PythonTags: []string{"cp312"}, ABITags: []string{"cp312"}, PlatformTags: []string{"macosx_10_9_universal2"},
+		}},
+		{"pyobjc_core-10.2-cp36-abi3-macosx_10_9_universal2.whl", File{
+			Name: "pyobjc_core", Version: "10.2",
+			PythonTags: []string{"cp36"}, ABITags: []string{"abi3"}, PlatformTags: []string{"macosx_10_9_universal2"},
+		}},
+		{"grpcio-1.62.1-cp37-cp37m-linux_armv7l.whl", File{
+			Name: "grpcio", Version: "1.62.1",
+			PythonTags: []string{"cp37"}, ABITags: []string{"cp37m"}, PlatformTags: []string{"linux_armv7l"},
+		}},
+		{"pip-24.0-1-py3-none-any.whl", File{
+			Name: "pip", Version: "24.0", BuildTag: "1",
+			PythonTags: []string{"py3"}, ABITags: []string{"none"}, PlatformTags: []string{"any"},
+		}},
+		{"tensorflow_gpu-2.10.0-2_cuda11-cp310-cp310-manylinux2014_x86_64.whl", File{
+			Name: "tensorflow_gpu", Version: "2.10.0", BuildTag: "2_cuda11",
+			PythonTags: []string{"cp310"}, ABITags: []string{"cp310"}, PlatformTags: []string{"manylinux2014_x86_64"},
+		}},
+		{"mypy-1.9.0-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.manylinux_2_28_x86_64.whl", File{
+			Name: "mypy", Version: "1.9.0",
+			PythonTags: []string{"cp312"}, ABITags: []string{"cp312"},
+			PlatformTags: []string{"manylinux_2_17_x86_64", "manylinux2014_x86_64", "manylinux_2_28_x86_64"},
+		}},
+		{"pyodide_http-0.2.1-py3-none-emscripten_3_1_45_wasm32.whl", File{
+			Name: "pyodide_http", Version: "0.2.1",
+			PythonTags: []string{"py3"}, ABITags: []string{"none"}, PlatformTags: []string{"emscripten_3_1_45_wasm32"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			got, err := Parse(tt.filename)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			tt.want.Filename = tt.filename
+			tt.want.Kind = KindWheel
+			tt.want.Extension = ".whl"
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q)\n got %+v\nwant %+v", tt.filename, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_Sdist(t *testing.T) {
+	tests := []struct {
+		filename, name, version, ext string
+	}{
+		{"requests-2.31.0.tar.gz", "requests", "2.31.0", ".tar.gz"},
+		{"numpy-1.26.4.tar.gz", "numpy", "1.26.4", ".tar.gz"},
+		{"python-dateutil-2.8.2.tar.gz", "python-dateutil", "2.8.2", ".tar.gz"},
+		{"pytz-2024.1.zip", "pytz", "2024.1", ".zip"},
+		{"zope.interface-6.0.zip", "zope.interface", "6.0", ".zip"},
+		{"pydantic_core-2.16.3.tar.gz", "pydantic_core", "2.16.3", ".tar.gz"},
+		{"Jinja2-2.10.tar.gz", "Jinja2", "2.10", ".tar.gz"},
+		{"setuptools-69.2.0.tar.gz", "setuptools", "69.2.0", ".tar.gz"},
+		{"pip-1.0.tar.bz2", "pip", "1.0", ".tar.bz2"},
+		{"lzma-0.5.3.tar.xz", "lzma", "0.5.3", ".tar.xz"},
+		{"pycrypto-2.0.1.tgz", "pycrypto", "2.0.1", ".tgz"},
+		{"Twisted-8.2.0.tar.bz2", "Twisted", "8.2.0", ".tar.bz2"},
+		{"distribute-0.6.49.tar.gz", "distribute", "0.6.49", ".tar.gz"},
+		{"django-debug-toolbar-4.3.0.tar.gz", "django-debug-toolbar", "4.3.0", ".tar.gz"},
+		{"torch-2.0.0+cpu.tar.gz", "torch", "2.0.0+cpu", ".tar.gz"},
+		{"apache-airflow-2.8.3rc1.tar.gz", "apache-airflow", "2.8.3rc1", ".tar.gz"},
+		{"Pyrex-0.9.8.5.tar.Z", "Pyrex", "0.9.8.5", ".tar.Z"},
+		{"PIL-1.1.7.tar", "PIL", "1.1.7", ".tar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			got, err := Parse(tt.filename)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			want := File{Filename: tt.filename, Kind: KindSdist, Name: tt.name, Version: tt.version, Extension: tt.ext}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Parse(%q)\n got %+v\nwant %+v", tt.filename, got, want)
+			}
+		})
+	}
+}
+
+func TestParse_Egg(t *testing.T) {
+	tests := []struct {
+		filename, name, version, python, platform string
+	}{
+		{"setuptools-0.6c11-py2.7.egg", "setuptools", "0.6c11", "2.7", ""},
+		{"pyasn1-0.1.7-py3.3.egg", "pyasn1", "0.1.7", "3.3", ""},
+		{"simplejson-2.1.1-py2.6-macosx-10.6-universal.egg", "simplejson", "2.1.1", "2.6", "macosx-10.6-universal"},
+		{"pywin32-214-py2.6-win32.egg", "pywin32", "214", "2.6", "win32"},
+		{"foo-1.0.egg", "foo", "1.0", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			got, err := Parse(tt.filename)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			want := File{
+				Filename: tt.filename, Kind: KindEgg, Name: tt.name, Version: tt.version, Extension: ".egg",
+				PythonVersion: tt.python, Platform: tt.platform,
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Parse(%q)\n got %+v\nwant %+v", tt.filename, got, want)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, filename := range []string{
+		"",
+		"..",
+		"README.md",
+		"numpy.whl",
+		"numpy-1.26.4.whl",
+		"numpy-1.26.4-cp312-cp312.whl",
+		"numpy-1.26.4-x-y-cp312-cp312-linux_x86_64.whl",
+		"numpy-1.26.4-build-cp312-cp312-linux_x86_64.whl", // Build tag must start with a digit
+		"numpy--cp312-cp312-linux_x86_64.whl",
+		"numpy.tar.gz",
+		"numpy-.tar.gz",
+		"-1.0.tar.gz",
+		"foo.egg",
+		"foo-1.0-2.7.egg",
+		"numpy-1.26.4.tar.gz.metadata",
+	} {
+		if f, err := Parse(filename); err != ErrInvalid {
+			t.Errorf("Parse(%q) = %+v, %v; want ErrInvalid", filename, f, err)
+		}
+	}
+}
+
+func TestFile_Tags(t *testing.T) {
+	f, err := Parse("six-1.16.0-py2.py3-none-any.whl")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := []string{"py2-none-any", "py3-none-any"}
+	if got := f.Tags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Tags() = %v, want %v", got, want)
+	}
+	if !f.IsPure() {
+		t.Error("Expected py2.py3-none-any wheel to be pure")
+	}
+
+	f, _ = Parse("numpy-1.26.4-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl")
+	if f.IsPure() {
+		t.Error("Expected platform wheel not to be pure")
+	}
+	if got := f.Tags(); len(got) != 2 || got[1] != "cp312-cp312-manylinux2014_x86_64" {
+		t.Errorf("Unexpected expanded tags %v", got)
+	}
+
+	if sdist, _ := Parse("numpy-1.26.4.tar.gz"); len(sdist.Tags()) != 0 || sdist.IsPure() {
+		t.Error("Expected no tags for an sdist")
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := map[string]string{
+		"requests":         "requests",
+		"Django":           "django",
+		"pydantic_core":    "pydantic-core",
+		"zope.interface":   "zope-interface",
+		"Foo__Bar-.-baz":   "foo-bar-baz",
+		"python-dateutil":  "python-dateutil",
+		"_leading":         "leading",
+		"trailing_":        "trailing",
+		"Ruamel.Yaml.Clib": "ruamel-yaml-clib",
+	}
+	for name, want := range tests {
+		if got := NormalizeName(name); got != want {
+			t.Errorf("NormalizeName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package distfile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// specifierOperators are the PEP 440 comparison operators, longest first so
+// "<=" isn't read as "<"
+var specifierOperators = []string{"===", "~=", "==", "!=", "<=", ">=", "<", ">"}
+
+// Specifier is a single PEP 440 version clause, such as "<70" or "==1.2.*"
+type Specifier struct {
+	Op      string
+	Version string // Without the ".*" of a wildcard
+	Prefix  bool   // == or != with a trailing ".*"
+}
+
+// Specifiers is a comma-separated PEP 440 specifier set; a version must
+// satisfy every clause
+type Specifiers []Specifier
+
+// ParseSpecifiers parses a specifier set such as ">=1.20, <2"
+func ParseSpecifiers(s string) (Specifiers, error) {
+	var specs Specifiers
+	for _, clause := range strings.Split(s, ",") {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+		spec, err := parseSpecifier(clause)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("empty version specifier %q", s)
+	}
+	return specs, nil
+}
+
+func parseSpecifier(clause string) (Specifier, error) {
+	var spec Specifier
+	for _, op := range specifierOperators {
+		if strings.HasPrefix(clause, op) {
+			spec.Op = op
+			break
+		}
+	}
+	if spec.Op == "" {
+		return Specifier{}, fmt.Errorf("version specifier %q has no operator", clause)
+	}
+	spec.Version = strings.TrimSpace(strings.TrimPrefix(clause, spec.Op))
+
+	if spec.Op == "===" {
+		if spec.Version == "" {
+			return Specifier{}, fmt.Errorf("version specifier %q has no version", clause)
+		}
+		return spec, nil
+	}
+	if (spec.Op == "==" || spec.Op == "!=") && strings.HasSuffix(spec.Version, ".*") {
+		spec.Version, spec.Prefix = strings.TrimSuffix(spec.Version, ".*"), true
+	}
+	if _, ok := parseVersion(spec.Version); !ok {
+		return Specifier{}, fmt.Errorf("invalid version in specifier %q", clause)
+	}
+	if spec.Op == "~=" && len(releaseSegments(spec.Version)) < 2 {
+		return Specifier{}, fmt.Errorf("specifier %q needs a version with at least two release segments", clause)
+	}
+	return spec, nil
+}
+
+// String formats the set as it would be written in a requirement
+func (specs Specifiers) String() string {
+	clauses := make([]string, len(specs))
+	for i, spec := range specs {
+		clauses[i] = spec.String()
+	}
+	return strings.Join(clauses, ",")
+}
+
+// String formats the clause, e.g. "==1.2.*"
+func (spec Specifier) String() string {
+	if spec.Prefix {
+		return spec.Op + spec.Version + ".*"
+	}
+	return spec.Op + spec.Version
+}
+
+// Allows reports whether v satisfies every clause. Versions that aren't
+// valid PEP 440 can't be compared and are allowed, unless a === clause
+// names another version.
+func (specs Specifiers) Allows(v string) bool {
+	for _, spec := range specs {
+		if !spec.Allows(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Allows reports whether v satisfies the clause
+func (spec Specifier) Allows(v string) bool {
+	if spec.Op == "===" {
+		return strings.EqualFold(strings.TrimSpace(v), spec.Version)
+	}
+	parsed, ok := parseVersion(v)
+	if !ok {
+		return true
+	}
+	target, _ := parseVersion(spec.Version)
+
+	switch spec.Op {
+	case "==":
+		if spec.Prefix {
+			return matchesPrefix(parsed, v, spec.Version)
+		}
+		return compareIgnoringLocal(parsed, target, v, spec.Version) == 0
+	case "!=":
+		if spec.Prefix {
+			return !matchesPrefix(parsed, v, spec.Version)
+		}
+		return compareIgnoringLocal(parsed, target, v, spec.Version) != 0
+	case "<=":
+		return CompareVersions(v, spec.Version) <= 0
+	case ">=":
+		return CompareVersions(v, spec.Version) >= 0
+	case "<":
+		// <70 excludes 70.0rc1, unless the bound is a pre-release itself
+		if CompareVersions(v, spec.Version) >= 0 {
+			return false
+		}
+		return target.pre > 0 || target.dev || !(parsed.pre > 0 || parsed.dev) || !sameRelease(parsed, target)
+	case ">":
+		// >1.0 excludes 1.0.post1, unless the bound is a post-release itself
+		if CompareVersions(v, spec.Version) <= 0 {
+			return false
+		}
+		return target.post || !parsed.post || !sameRelease(parsed, target)
+	case "~=":
+		// ~=1.4.2 means >=1.4.2, ==1.4.*
+		release := releaseSegments(spec.Version)
+		prefix := strings.Join(release[:len(release)-1], ".")
+		if target.epoch != "" {
+			prefix = target.epoch + "!" + prefix
+		}
+		return CompareVersions(v, spec.Version) >= 0 && matchesPrefix(parsed, v, prefix)
+	}
+	return false
+}
+
+// compareIgnoringLocal compares a version with a specifier's, ignoring the
+// version's local label when the specifier has none: ==1.0 matches 1.0+cpu
+func compareIgnoringLocal(parsed, target version, v, want string) int {
+	if len(target.local) == 0 && len(parsed.local) > 0 {
+		v, _, _ = strings.Cut(v, "+")
+	}
+	return CompareVersions(v, want)
+}
+
+// matchesPrefix reports whether v's release starts with prefix's segments,
+// padding v with zeros: 1.2 matches 1.2.*, 1.20 doesn't
+func matchesPrefix(parsed version, v, prefix string) bool {
+	want, _ := parseVersion(prefix)
+	if compareNumbers(parsed.epoch, want.epoch) != 0 {
+		return false
+	}
+	release := releaseSegments(v)
+	for i, segment := range releaseSegments(prefix) {
+		got := "0"
+		if i < len(release) {
+			got = release[i]
+		}
+		if compareNumbers(got, segment) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// sameRelease reports whether two versions share epoch and release, e.g.
+// 70.0rc1 and 70
+func sameRelease(a, b version) bool {
+	if compareNumbers(a.epoch, b.epoch) != 0 {
+		return false
+	}
+	for i := 0; i < len(a.release) || i < len(b.release); i++ {
+		if compareNumbers(segment(a.release, i), segment(b.release, i)) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// releaseSegments returns v's release segments as written, without the
+// trailing zeros parseVersion drops
+func releaseSegments(v string) []string {
+	m := versionPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(v)))
+	if m == nil {
+		return nil
+	}
+	return strings.Split(m[2], ".")
+}
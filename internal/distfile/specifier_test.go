@@ -0,0 +1,58 @@
+package distfile
+
+import "testing"
+
+func TestSpecifiers_Allows(t *testing.T) {
+	tests := []struct {
+		specs   string
+		allowed []string
+		denied  []string
+	}{
+		{"<70", []string{"69.5.1", "69.0.0.post1", "1.0"}, []string{"70", "70.0.0", "70.0.0rc1", "70.0.dev1", "71"}},
+		{"<70rc2", []string{"70.0rc1"}, []string{"70.0rc2", "70.0"}},
+		{">=1.20, <2", []string{"1.20", "1.26.4"}, []string{"1.19.5", "2.0rc1", "2.0", "2.1"}},
+		{">1.0", []string{"1.0.1", "1.1"}, []string{"1.0", "1.0.post1", "0.9"}},
+		{"<=1.0", []string{"1.0", "1.0.0", "0.9"}, []string{"1.0.post1", "1.0.1"}},
+		{"==1.2.*", []string{"1.2", "1.2.0", "1.2.7", "1.2.7rc1"}, []string{"1.20", "1.3", "1.1.9"}},
+		{"!=1.2.*", []string{"1.3", "1.20"}, []string{"1.2.3"}},
+		{"==1.0", []string{"1.0.0", "1.0+cpu"}, []string{"1.0.1", "1.0.post1"}},
+		{"==1.0+cpu", []string{"1.0+cpu"}, []string{"1.0", "1.0+cu118"}},
+		{"!=1.5", []string{"1.4", "1.5.1"}, []string{"1.5", "1.5.0"}},
+		{"~=1.4.2", []string{"1.4.2", "1.4.9"}, []string{"1.4.1", "1.5.0"}},
+		{"~=1.0", []string{"1.0", "1.9"}, []string{"0.9", "2.0"}},
+		{"===1.0-custom", []string{"1.0-custom", "1.0-CUSTOM"}, []string{"1.0"}},
+		{"<2", []string{"not-a-version"}, nil},
+	}
+	for _, tt := range tests {
+		specs, err := ParseSpecifiers(tt.specs)
+		if err != nil {
+			t.Fatalf("ParseSpecifiers(%q): %v", tt.specs, err)
+		}
+		for _, v := range tt.allowed {
+			if !specs.Allows(v) {
+				t.Errorf("Expected %q to allow %s", tt.specs, v)
+			}
+		}
+		for _, v := range tt.denied {
+			if specs.Allows(v) {
+				t.Errorf("Expected %q to deny %s", tt.specs, v)
+			}
+		}
+	}
+}
+
+func TestParseSpecifiers(t *testing.T) {
+	specs, err := ParseSpecifiers(" >= 1.20 ,<2,!=1.24.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := specs.String(); got != ">=1.20,<2,!=1.24.*" {
+		t.Errorf("Unexpected specifiers %q", got)
+	}
+
+	for _, s := range []string{"", "1.0", "<", "<banana", "~=1", ">=1.*", "==1.*.2"} {
+		if _, err := ParseSpecifiers(s); err == nil {
+			t.Errorf("Expected ParseSpecifiers(%q) to fail", s)
+		}
+	}
+}
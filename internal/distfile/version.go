@@ -0,0 +1,204 @@
+package distfile
+
+import (
+	"regexp"
+	"strings"
+)
+
+// versionPattern matches PEP 440 versions, including the alternative
+// spellings normalization accepts (1.0-alpha1, 1.0.post-2, 1.0-1, ...)
+var versionPattern = regexp.MustCompile(`^v?(?:(\d+)!)?(\d+(?:\.\d+)*)` +
+	`(?:[-_.]?(a|alpha|b|beta|c|rc|pre|preview)[-_.]?(\d*))?` +
+	`(?:-(\d+)|[-_.]?(post|rev|r)[-_.]?(\d*))?` +
+	`(?:[-_.]?(dev)[-_.]?(\d*))?` +
+	`(?:\+([a-z0-9]+(?:[-_.][a-z0-9]+)*))?$`)
+
+// version is a parsed PEP 440 version. Numbers are kept as strings so
+// date-based or otherwise huge components cannot overflow.
+type version struct {
+	epoch   string
+	release []string
+	pre     int // Rank of the pre-release phase: a=1, b=2, rc=3; 0 = none
+	preN    string
+	post    bool
+	postN   string
+	dev     bool
+	devN    string
+	local   []string
+}
+
+func parseVersion(s string) (version, bool) {
+	m := versionPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return version{}, false
+	}
+
+	v := version{epoch: m[1], release: strings.Split(m[2], ".")}
+	switch m[3] {
+	case "a", "alpha":
+		v.pre = 1
+	case "b", "beta":
+		v.pre = 2
+	case "c", "rc", "pre", "preview":
+		v.pre = 3
+	}
+	v.preN = m[4]
+	if m[5] != "" {
+		v.post, v.postN = true, m[5]
+	} else if m[6] != "" {
+		v.post, v.postN = true, m[7]
+	}
+	if m[8] != "" {
+		v.dev, v.devN = true, m[9]
+	}
+	if m[10] != "" {
+		v.local = strings.FieldsFunc(m[10], func(r rune) bool { return r == '-' || r == '_' || r == '.' })
+	}
+
+	// Trailing zeros don't change a release: 1.0 == 1.0.0
+	for len(v.release) > 1 && compareNumbers(v.release[len(v.release)-1], "0") == 0 {
+		v.release = v.release[:len(v.release)-1]
+	}
+	return v, true
+}
+
+// CompareVersions orders two versions following PEP 440: it returns -1 if
+// a < b, 0 if they are equal and +1 if a > b. Versions that are not valid
+// PEP 440 sort before valid ones and are compared as plain strings.
+func CompareVersions(a, b string) int {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return strings.Compare(a, b)
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+
+	if c := compareNumbers(va.epoch, vb.epoch); c != 0 {
+		return c
+	}
+	for i := 0; i < len(va.release) || i < len(vb.release); i++ {
+		if c := compareNumbers(segment(va.release, i), segment(vb.release, i)); c != 0 {
+			return c
+		}
+	}
+
+	// 1.0.dev1 < 1.0a1 < 1.0 < 1.0.post1
+	if c := compareInts(va.preRank(), vb.preRank()); c != 0 {
+		return c
+	}
+	if va.pre > 0 {
+		if c := compareNumbers(va.preN, vb.preN); c != 0 {
+			return c
+		}
+	}
+	if c := compareBools(va.post, vb.post); c != 0 {
+		return c
+	}
+	if va.post {
+		if c := compareNumbers(va.postN, vb.postN); c != 0 {
+			return c
+		}
+	}
+	if c := compareBools(!va.dev, !vb.dev); c != 0 {
+		return c
+	}
+	if va.dev {
+		if c := compareNumbers(va.devN, vb.devN); c != 0 {
+			return c
+		}
+	}
+	return compareLocal(va.local, vb.local)
+}
+
+// IsPrerelease reports whether v is a pre-release or development release
+// (PEP 440), which installers skip unless asked for them. Invalid versions
+// are not pre-releases.
+func IsPrerelease(v string) bool {
+	parsed, ok := parseVersion(v)
+	return ok && (parsed.pre > 0 || parsed.dev)
+}
+
+// preRank places a final release after its pre-releases, and a dev release
+// of the final version before all of them
+func (v version) preRank() int {
+	switch {
+	case v.pre > 0:
+		return v.pre
+	case v.dev && !v.post:
+		return 0
+	default:
+		return 4
+	}
+}
+
+// compareLocal orders local labels segment by segment; numeric segments sort
+// after alphanumeric ones, and a longer label wins a shared prefix
+func compareLocal(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		numA, numB := isNumber(a[i]), isNumber(b[i])
+		var c int
+		switch {
+		case numA && numB:
+			c = compareNumbers(a[i], b[i])
+		case numA:
+			c = 1
+		case numB:
+			c = -1
+		default:
+			c = strings.Compare(a[i], b[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(a), len(b))
+}
+
+// compareNumbers compares non-negative decimal strings; empty is zero
+func compareNumbers(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if c := compareInts(len(a), len(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+func segment(release []string, i int) string {
+	if i < len(release) {
+		return release[i]
+	}
+	return ""
+}
+
+func isNumber(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
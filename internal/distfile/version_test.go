@@ -0,0 +1,98 @@
+package distfile
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestCompareVersions_Order(t *testing.T) {
+	// Ascending per PEP 440, including the spec's own ordering examples
+	ordered := []string{
+		"not-a-version",
+		"0.9",
+		"1.0.dev456",
+		"1.0a1",
+		"1.0a2.dev456",
+		"1.0a12.dev456",
+		"1.0a12",
+		"1.0b1.dev456",
+		"1.0b2",
+		"1.0b2.post345.dev456",
+		"1.0b2.post345",
+		"1.0rc1.dev456",
+		"1.0rc1",
+		"1.0",
+		"1.0+abc.5",
+		"1.0+abc.7",
+		"1.0+5",
+		"1.0.post456.dev34",
+		"1.0.post456",
+		"1.0.15",
+		"1.1.dev1",
+		"1.10",
+		"2.0.0+cpu",
+		"2024.1",
+		"20240101",
+		"1!0.1",
+	}
+
+	for i := 0; i < len(ordered)-1; i++ {
+		a, b := ordered[i], ordered[i+1]
+		if got := CompareVersions(a, b); got != -1 {
+			t.Errorf("CompareVersions(%q, %q) = %d, want -1", a, b, got)
+		}
+		if got := CompareVersions(b, a); got != 1 {
+			t.Errorf("CompareVersions(%q, %q) = %d, want 1", b, a, got)
+		}
+	}
+
+	shuffled := append([]string(nil), ordered...)
+	sort.Slice(shuffled, func(i, j int) bool { return shuffled[i] > shuffled[j] })
+	sort.Slice(shuffled, func(i, j int) bool { return CompareVersions(shuffled[i], shuffled[j]) < 0 })
+	for i := range ordered {
+		if shuffled[i] != ordered[i] {
+			t.Fatalf("Sorted order %v, want %v", shuffled, ordered)
+		}
+	}
+}
+
+func TestCompareVersions_Equal(t *testing.T) {
+	tests := [][2]string{
+		{"1.0", "1.0.0"},
+		{"1.0", "v1.0"},
+		{"1.0a1", "1.0-alpha1"},
+		{"1.0rc1", "1.0c1"},
+		{"1.0rc1", "1.0-pre1"},
+		{"1.0.post1", "1.0-1"},
+		{"1.0.post1", "1.0.rev1"},
+		{"1.0.post0", "1.0.post"},
+		{"1.0.dev0", "1.0-dev"},
+		{"01.02", "1.2"},
+		{"0!1.0", "1.0"},
+		{"1.0+Ubuntu-1", "1.0+ubuntu.1"},
+		{"1.0A1", "1.0a1"},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt[0], tt[1]); got != 0 {
+			t.Errorf("CompareVersions(%q, %q) = %d, want 0", tt[0], tt[1], got)
+		}
+	}
+}
+
+func TestIsPrerelease(t *testing.T) {
+	tests := map[string]bool{
+		"1.0":        false,
+		"1.0.post1":  false,
+		"1.0+local":  false,
+		"1.0a1":      true,
+		"1.0rc2":     true,
+		"1.0.dev3":   true,
+		"2.0b1.post": true,
+		"not-a-ver":  false,
+	}
+	for v, want := range tests {
+		if got := IsPrerelease(v); got != want {
+			t.Errorf("IsPrerelease(%q) = %v, want %v", v, got, want)
+		}
+	}
+}
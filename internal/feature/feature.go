@@ -0,0 +1,118 @@
+// Package feature gates experimental subsystems behind named flags, so a
+// risky change can be switched on for one instance at a time and switched
+// off again without a new build.
+package feature
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Flag names an experimental feature
+type Flag string
+
+// Experimental features
+const (
+	HTTP3              Flag = "http3"                // Serve HTTP/3 over QUIC
+	ParallelRangeFetch Flag = "parallel-range-fetch" // Fetch large files upstream as parallel byte ranges
+	PeerCache          Flag = "peer-cache"           // Ask peer groxpi instances for files before upstream
+)
+
+// Known lists every flag
+var Known = []Flag{HTTP3, ParallelRangeFetch, PeerCache}
+
+func known(flag Flag) bool {
+	for _, k := range Known {
+		if k == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Flags records which features are switched on. A nil Flags has every
+// feature off.
+type Flags map[Flag]bool
+
+// Set applies flag settings in order, so later ones win: "name" or
+// "name=true" switches a feature on, "-name" or "name=false" switches it
+// off. Unknown names are an error, so a typo doesn't silently leave a
+// feature off.
+func (f Flags) Set(settings ...string) error {
+	for _, setting := range settings {
+		setting = strings.TrimSpace(setting)
+		if setting == "" {
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(setting, "=")
+		on := true
+		if hasValue {
+			parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				return fmt.Errorf("invalid feature setting %q: expected name=true or name=false", setting)
+			}
+			on = parsed
+		} else if trimmed, ok := strings.CutPrefix(name, "-"); ok {
+			name, on = trimmed, false
+		}
+
+		flag := Flag(strings.ToLower(strings.TrimSpace(name)))
+		if !known(flag) {
+			return fmt.Errorf("unknown feature %q", flag)
+		}
+		f[flag] = on
+	}
+	return nil
+}
+
+// Enabled reports whether flag is switched on
+func (f Flags) Enabled(flag Flag) bool {
+	return f[flag]
+}
+
+// Status reports every known flag and whether it is on
+func (f Flags) Status() map[string]bool {
+	status := make(map[string]bool, len(Known))
+	for _, flag := range Known {
+		status[string(flag)] = f[flag]
+	}
+	return status
+}
+
+// List returns the names of the flags switched on, sorted
+func (f Flags) List() []string {
+	var names []string
+	for flag, on := range f {
+		if on {
+			names = append(names, string(flag))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadFile reads flag settings from a file, one or more per line separated
+// by commas. Blank lines and lines starting with '#' are ignored.
+func ReadFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var settings []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		settings = append(settings, strings.Split(line, ",")...)
+	}
+	return settings, scanner.Err()
+}
@@ -0,0 +1,61 @@
+package feature
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFlags_Set(t *testing.T) {
+	flags := Flags{}
+	if err := flags.Set("http3", " peer-cache=true ", "", "-peer-cache", "Parallel-Range-Fetch=1"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	expected := map[string]bool{"http3": true, "peer-cache": false, "parallel-range-fetch": true}
+	if status := flags.Status(); !reflect.DeepEqual(status, expected) {
+		t.Errorf("Expected %v, got %v", expected, status)
+	}
+	if list := flags.List(); !reflect.DeepEqual(list, []string{"http3", "parallel-range-fetch"}) {
+		t.Errorf("Expected enabled flags listed, got %v", list)
+	}
+}
+
+func TestFlags_SetInvalid(t *testing.T) {
+	for _, setting := range []string{"htttp3", "http3=maybe", "-unknown"} {
+		if err := (Flags{}).Set(setting); err == nil {
+			t.Errorf("Expected an error for %q", setting)
+		}
+	}
+}
+
+func TestFlags_Nil(t *testing.T) {
+	var flags Flags
+	if flags.Enabled(HTTP3) {
+		t.Error("Expected every feature off")
+	}
+	if status := flags.Status(); len(status) != len(Known) {
+		t.Errorf("Expected every known flag in status, got %v", status)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "features")
+	content := "# Rolled out to the canary first\nhttp3\n\npeer-cache=false, parallel-range-fetch\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	settings, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	flags := Flags{}
+	if err := flags.Set(settings...); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if !flags.Enabled(HTTP3) || flags.Enabled(PeerCache) || !flags.Enabled(ParallelRangeFetch) {
+		t.Errorf("Unexpected flags from file: %v", flags)
+	}
+}
@@ -0,0 +1,91 @@
+package flight
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultMaxInFlight bounds distinct concurrent fetches when no limit is configured
+const DefaultMaxInFlight = 1024
+
+// ErrTooManyInFlight is returned when starting a new fetch would exceed the
+// in-flight bound. Calls joining a fetch that is already running never fail
+// this way.
+var ErrTooManyInFlight = errors.New("too many concurrent upstream fetches in flight")
+
+var separatorRuns = regexp.MustCompile(`[-_.]+`)
+
+// Key builds a deduplication key qualified by index, so the same package
+// requested from different indexes never shares a result. The name is
+// normalized per PEP 503 so equivalent spellings do share one.
+func Key(indexURL, kind, name string) string {
+	indexURL = strings.TrimSuffix(indexURL, "/")
+	if name == "" {
+		return indexURL + "|" + kind
+	}
+	return indexURL + "|" + kind + ":" + separatorRuns.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+// Stats is a snapshot of group usage
+type Stats struct {
+	InFlight   int64 `json:"in_flight"`
+	MaxFlight  int64 `json:"max_in_flight"`
+	Calls      int64 `json:"calls"`
+	Executions int64 `json:"executions"`
+	Rejected   int64 `json:"rejected"`
+}
+
+// Group deduplicates concurrent calls like singleflight.Group while bounding
+// how many distinct keys may execute at once and counting its work
+type Group struct {
+	sf  singleflight.Group
+	max int64
+
+	inFlight   atomic.Int64
+	calls      atomic.Int64
+	executions atomic.Int64
+	rejected   atomic.Int64
+}
+
+// NewGroup creates a group allowing up to max distinct keys in flight
+// (DefaultMaxInFlight if max is not positive)
+func NewGroup(max int) *Group {
+	if max <= 0 {
+		max = DefaultMaxInFlight
+	}
+	return &Group{max: int64(max)}
+}
+
+// Do runs fn once per key among concurrent callers and returns its result
+// to all of them. shared reports whether the result went to more than one
+// caller.
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.calls.Add(1)
+
+	return g.sf.Do(key, func() (interface{}, error) {
+		if g.inFlight.Add(1) > g.max {
+			g.inFlight.Add(-1)
+			g.rejected.Add(1)
+			return nil, ErrTooManyInFlight
+		}
+		defer g.inFlight.Add(-1)
+
+		g.executions.Add(1)
+		return fn()
+	})
+}
+
+// Stats returns current usage
+func (g *Group) Stats() Stats {
+	return Stats{
+		InFlight:   g.inFlight.Load(),
+		MaxFlight:  g.max,
+		Calls:      g.calls.Load(),
+		Executions: g.executions.Load(),
+		Rejected:   g.rejected.Load(),
+	}
+}
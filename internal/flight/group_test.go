@@ -0,0 +1,94 @@
+package flight
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		index, kind, name string
+		want              string
+	}{
+		{"https://pypi.org/simple/", "package-list", "", "https://pypi.org/simple|package-list"},
+		{"https://pypi.org/simple", "package-files", "Foo_Bar", "https://pypi.org/simple|package-files:foo-bar"},
+		{"https://pypi.org/simple", "package-files", "foo..bar", "https://pypi.org/simple|package-files:foo-bar"},
+		{"https://internal/simple", "package-files", "foo-bar", "https://internal/simple|package-files:foo-bar"},
+	}
+
+	for _, tt := range tests {
+		if got := Key(tt.index, tt.kind, tt.name); got != tt.want {
+			t.Errorf("Key(%q, %q, %q) = %q, want %q", tt.index, tt.kind, tt.name, got, tt.want)
+		}
+	}
+
+	if Key("https://a/simple", "package-files", "numpy") == Key("https://b/simple", "package-files", "numpy") {
+		t.Error("Keys for different indexes must differ")
+	}
+}
+
+func TestGroup_DeduplicatesAndCounts(t *testing.T) {
+	g := NewGroup(0)
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err, _ := g.Do("k", func() (interface{}, error) {
+				<-release
+				return "value", nil
+			})
+			if err != nil || v != "value" {
+				t.Errorf("Do = %v, %v", v, err)
+			}
+		}()
+	}
+
+	// Wait until every caller has joined before letting the fetch finish
+	for g.Stats().Calls < 5 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond) // Calls are counted just before joining
+	close(release)
+	wg.Wait()
+
+	stats := g.Stats()
+	if stats.Executions != 1 || stats.InFlight != 0 || stats.MaxFlight != DefaultMaxInFlight {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestGroup_BoundsDistinctKeys(t *testing.T) {
+	g := NewGroup(1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _, _ = g.Do("a", func() (interface{}, error) {
+			close(started)
+			<-release
+			return nil, nil
+		})
+	}()
+	<-started
+
+	if _, err, _ := g.Do("b", func() (interface{}, error) { return nil, nil }); !errors.Is(err, ErrTooManyInFlight) {
+		t.Errorf("Expected ErrTooManyInFlight, got %v", err)
+	}
+
+	close(release)
+	<-done
+
+	if _, err, _ := g.Do("b", func() (interface{}, error) { return nil, nil }); err != nil {
+		t.Errorf("Expected success once the slot is free, got %v", err)
+	}
+	if stats := g.Stats(); stats.Rejected != 1 {
+		t.Errorf("Expected 1 rejection, got %+v", stats)
+	}
+}
@@ -0,0 +1,157 @@
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/phuslu/log"
+
+	"github.com/huyhandes/groxpi/internal/retention"
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// packagesPrefix limits collection to cached package files so bookkeeping
+// objects (mirror checkpoints, ...) are never touched
+const packagesPrefix = "packages/"
+
+// SampleSize bounds the keys listed in a report
+const SampleSize = 20
+
+// Options configures a collection run
+type Options struct {
+	MaxAge     time.Duration // Delete files not accessed for longer than this
+	TempMaxAge time.Duration // Delete partial writes older than this
+	DryRun     bool          // Report what would be deleted without deleting
+
+	// Retention deletes files of versions older than the newest ones kept
+	// per package, however recently they were used (nil = disabled)
+	Retention *retention.Policy
+}
+
+// Report summarizes a collection run
+type Report struct {
+	DryRun         bool          `json:"dry_run"`
+	Scanned        int           `json:"scanned"`
+	Deleted        int           `json:"deleted"`
+	Superseded     int           `json:"superseded"`
+	ReclaimedBytes int64         `json:"reclaimed_bytes"`
+	TempDeleted    int           `json:"temp_deleted"`
+	TempBytes      int64         `json:"temp_bytes"`
+	Failed         int           `json:"failed"`
+	Duration       time.Duration `json:"duration_ns"`
+
+	// Sample lists some of the deleted files (or the files a dry run
+	// would delete), up to SampleSize
+	Sample []string `json:"sample"`
+}
+
+// Run deletes cached files whose last access is older than opts.MaxAge,
+// files of versions superseded under opts.Retention and partial writes older
+// than opts.TempMaxAge. Access times come from the LRU
+// tracker where the backend has one and fall back to the object's
+// modification time otherwise.
+func Run(ctx context.Context, store storage.Storage, opts Options) (*Report, error) {
+	if opts.MaxAge <= 0 {
+		return nil, errors.New("gc max age must be positive")
+	}
+
+	walker, ok := store.(storage.Walker)
+	if !ok {
+		return nil, errors.New("storage backend does not support garbage collection")
+	}
+
+	start := time.Now()
+	report := &Report{DryRun: opts.DryRun, Sample: []string{}}
+	cutoff := start.Add(-opts.MaxAge)
+	tracker, _ := store.(storage.AccessTracker)
+
+	// Collect first and delete afterwards so deletions don't disturb the walk
+	var (
+		expired []*storage.ObjectInfo
+		fresh   []*storage.ObjectInfo
+	)
+	err := walker.Walk(ctx, packagesPrefix, func(obj *storage.ObjectInfo) error {
+		if !strings.HasPrefix(obj.Key, packagesPrefix) {
+			return nil
+		}
+		report.Scanned++
+
+		lastUsed := obj.LastModified
+		if tracker != nil {
+			if accessed, ok := tracker.LastAccessed(obj.Key); ok && accessed.After(lastUsed) {
+				lastUsed = accessed
+			}
+		}
+		if lastUsed.Before(cutoff) {
+			expired = append(expired, obj)
+		} else {
+			fresh = append(fresh, obj)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan storage: %w", err)
+	}
+
+	// Versions are ranked among the files surviving the age check, so an
+	// expired newest release doesn't take the one kept in its place with it
+	if opts.Retention != nil && len(fresh) > 0 {
+		keys := make([]string, 0, len(fresh))
+		for _, obj := range fresh {
+			keys = append(keys, obj.Key)
+		}
+		superseded := opts.Retention.Superseded(keys)
+		for _, obj := range fresh {
+			if superseded[obj.Key] {
+				expired = append(expired, obj)
+				report.Superseded++
+			}
+		}
+	}
+
+	for _, obj := range expired {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		if !opts.DryRun {
+			if err := store.Delete(ctx, obj.Key); err != nil {
+				log.Warn().Err(err).Str("key", obj.Key).Msg("GC failed to delete object")
+				report.Failed++
+				continue
+			}
+		}
+		report.Deleted++
+		report.ReclaimedBytes += obj.Size
+		if len(report.Sample) < SampleSize {
+			report.Sample = append(report.Sample, obj.Key)
+		}
+	}
+
+	if cleaner, ok := store.(storage.TempCleaner); ok && opts.TempMaxAge > 0 {
+		count, size, err := cleaner.CleanupTemp(ctx, opts.TempMaxAge, opts.DryRun)
+		report.TempDeleted = count
+		report.TempBytes = size
+		if err != nil {
+			return report, fmt.Errorf("failed to clean up temp objects: %w", err)
+		}
+	}
+
+	report.Duration = time.Since(start)
+
+	log.Info().
+		Bool("dry_run", report.DryRun).
+		Int("scanned", report.Scanned).
+		Int("deleted", report.Deleted).
+		Int("superseded", report.Superseded).
+		Int64("reclaimed_bytes", report.ReclaimedBytes).
+		Int("temp_deleted", report.TempDeleted).
+		Int64("temp_bytes", report.TempBytes).
+		Int("failed", report.Failed).
+		Dur("duration", report.Duration).
+		Msg("Garbage collection completed")
+
+	return report, nil
+}
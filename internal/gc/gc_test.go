@@ -0,0 +1,187 @@
+package gc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/retention"
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// seed writes files into dir with the given age
+func seed(t *testing.T, dir string, files map[string]time.Duration) {
+	t.Helper()
+
+	for key, age := range files {
+		path := filepath.Join(dir, key)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(strings.Repeat("x", 10)), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		mtime := time.Now().Add(-age)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("Chtimes failed: %v", err)
+		}
+	}
+}
+
+func exists(dir, key string) bool {
+	_, err := os.Stat(filepath.Join(dir, key))
+	return err == nil
+}
+
+func TestRun_DeletesStaleFilesAndTemps(t *testing.T) {
+	dir := t.TempDir()
+	seed(t, dir, map[string]time.Duration{
+		"packages/numpy/numpy-1.0.tar.gz":    60 * 24 * time.Hour,
+		"packages/numpy/numpy-2.0.tar.gz":    time.Hour,
+		"packages/numpy/.tmp-123456":         3 * time.Hour,
+		"packages/requests/.tmp-fresh":       time.Minute,
+		"mirror/state.json":                  90 * 24 * time.Hour,
+		"packages/requests/requests-1.0.zip": 45 * 24 * time.Hour,
+	})
+
+	store, err := storage.NewLocalStorage(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	report, err := Run(context.Background(), store, Options{MaxAge: 30 * 24 * time.Hour, TempMaxAge: time.Hour})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if report.Scanned != 3 || report.Deleted != 2 || report.ReclaimedBytes != 20 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if report.TempDeleted != 1 || report.TempBytes != 10 {
+		t.Errorf("Expected one stale temp file removed, got %+v", report)
+	}
+
+	for key, want := range map[string]bool{
+		"packages/numpy/numpy-1.0.tar.gz":    false,
+		"packages/requests/requests-1.0.zip": false,
+		"packages/numpy/numpy-2.0.tar.gz":    true,
+		"packages/numpy/.tmp-123456":         false,
+		"packages/requests/.tmp-fresh":       true,
+		"mirror/state.json":                  true,
+	} {
+		if got := exists(dir, key); got != want {
+			t.Errorf("%s: exists=%v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestRun_DryRun(t *testing.T) {
+	dir := t.TempDir()
+	seed(t, dir, map[string]time.Duration{
+		"packages/six/six-1.0.tar.gz": 60 * 24 * time.Hour,
+		"packages/six/.tmp-1":         3 * time.Hour,
+	})
+
+	store, err := storage.NewLocalStorage(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	report, err := Run(context.Background(), store, Options{MaxAge: 24 * time.Hour, TempMaxAge: time.Hour, DryRun: true})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if report.Deleted != 1 || report.TempDeleted != 1 || !report.DryRun {
+		t.Errorf("Unexpected dry-run report: %+v", report)
+	}
+	if len(report.Sample) != 1 || report.Sample[0] != "packages/six/six-1.0.tar.gz" {
+		t.Errorf("Expected the expired file in the sample, got %v", report.Sample)
+	}
+	if !exists(dir, "packages/six/six-1.0.tar.gz") || !exists(dir, "packages/six/.tmp-1") {
+		t.Error("Dry run must not delete anything")
+	}
+}
+
+func TestRun_UsesTrackedAccessTime(t *testing.T) {
+	dir := t.TempDir()
+	seed(t, dir, map[string]time.Duration{
+		"packages/six/six-1.0.tar.gz": 60 * 24 * time.Hour,
+	})
+
+	store, err := storage.NewLRULocalStorage(dir, 1024*1024, 0)
+	if err != nil {
+		t.Fatalf("NewLRULocalStorage failed: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	// Serving the file refreshes its access time even though mtime is old
+	if _, err := store.GetFilePath(context.Background(), "packages/six/six-1.0.tar.gz"); err != nil {
+		t.Fatalf("GetFilePath failed: %v", err)
+	}
+
+	report, err := Run(context.Background(), store, Options{MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Deleted != 0 {
+		t.Errorf("Recently accessed file should be kept, got %+v", report)
+	}
+}
+
+func TestRun_Retention(t *testing.T) {
+	dir := t.TempDir()
+	seed(t, dir, map[string]time.Duration{
+		"packages/numpy/numpy-2.0.tar.gz":                   time.Hour,
+		"packages/numpy/numpy-1.26.4.tar.gz":                time.Hour,
+		"packages/numpy/numpy-1.26.4-cp312-cp312-win32.whl": time.Hour,
+		"packages/numpy/numpy-1.9.tar.gz":                   time.Hour,
+		"packages/six/six-1.16.0.tar.gz":                    60 * 24 * time.Hour,
+		"packages/six/six-1.15.0.tar.gz":                    time.Hour,
+	})
+
+	store, err := storage.NewLocalStorage(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	report, err := Run(context.Background(), store, Options{
+		MaxAge:    30 * 24 * time.Hour,
+		Retention: retention.New(1, nil),
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// numpy keeps 2.0 only; six's newest release expired, so 1.15.0 is the
+	// version kept
+	if report.Deleted != 4 || report.Superseded != 3 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	for key, want := range map[string]bool{
+		"packages/numpy/numpy-2.0.tar.gz":                   true,
+		"packages/numpy/numpy-1.26.4.tar.gz":                false,
+		"packages/numpy/numpy-1.26.4-cp312-cp312-win32.whl": false,
+		"packages/numpy/numpy-1.9.tar.gz":                   false,
+		"packages/six/six-1.16.0.tar.gz":                    false,
+		"packages/six/six-1.15.0.tar.gz":                    true,
+	} {
+		if got := exists(dir, key); got != want {
+			t.Errorf("%s: exists=%v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestRun_RequiresMaxAge(t *testing.T) {
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	if _, err := Run(context.Background(), store, Options{}); err == nil {
+		t.Error("Expected error for zero max age")
+	}
+}
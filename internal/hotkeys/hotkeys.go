@@ -0,0 +1,256 @@
+// Package hotkeys tracks how often each package's index page is requested
+// and keeps the hottest ones warm, so the packages an organization's builds
+// depend on are never a cache miss, even right after their entry expires or
+// a restart.
+package hotkeys
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+// maxTracked bounds how many packages are tracked; the coldest are
+// forgotten beyond it
+const maxTracked = 10000
+
+// Config configures hot-key tracking
+type Config struct {
+	Size     int           // Hottest packages kept warm
+	HalfLife time.Duration // Request counts halve over this long, so the rate follows recent traffic (default 1h)
+	Interval time.Duration // How often the hot set is recomputed and refreshed (default 1m)
+
+	// Due reports whether a hot package's cached metadata needs refreshing
+	// (nil = always)
+	Due func(pkg string) bool
+
+	// Refresh fetches a hot package's metadata into the cache
+	Refresh func(ctx context.Context, pkg string) error
+}
+
+// Key is a tracked package
+type Key struct {
+	Package  string  `json:"package"`
+	Rate     float64 `json:"requests_per_hour"` // Recent request rate
+	Requests int64   `json:"requests"`          // Requests since it was first tracked
+}
+
+// Stats reports the hot set and the refreshes done for it
+type Stats struct {
+	Tracked   int   `json:"tracked"`
+	Hot       []Key `json:"hot"`
+	Refreshed int64 `json:"refreshed"`
+	Failed    int64 `json:"failed"`
+}
+
+type counter struct {
+	score    float64 // Decayed request count as of last
+	last     time.Time
+	requests int64
+}
+
+// Tracker counts requests per package. A nil tracker tracks nothing.
+type Tracker struct {
+	cfg Config
+
+	mu       sync.Mutex
+	counters map[string]*counter
+	hot      []Key
+	hotSet   map[string]bool
+
+	refreshed, failed atomic.Int64
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a tracker, or returns nil when cfg.Size is not positive
+func New(cfg Config) *Tracker {
+	if cfg.Size <= 0 {
+		return nil
+	}
+	if cfg.HalfLife <= 0 {
+		cfg.HalfLife = time.Hour
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	return &Tracker{
+		cfg:      cfg,
+		counters: make(map[string]*counter),
+		hotSet:   make(map[string]bool),
+	}
+}
+
+// Record counts a request for pkg
+func (t *Tracker) Record(pkg string) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.counters[pkg]
+	if !ok {
+		if len(t.counters) >= maxTracked {
+			t.forgetColdest(now)
+		}
+		c = &counter{last: now}
+		t.counters[pkg] = c
+	}
+	c.score = t.decayed(c, now) + 1
+	c.last = now
+	c.requests++
+}
+
+// Hot reports whether pkg was among the hottest packages when the hot set
+// was last computed
+func (t *Tracker) Hot(pkg string) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.hotSet[pkg]
+}
+
+// Start recomputes the hot set and refreshes its due packages every
+// interval, until Stop
+func (t *Tracker) Start() {
+	if t == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	t.done = make(chan struct{})
+
+	go func() {
+		defer close(t.done)
+
+		ticker := time.NewTicker(t.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				t.refresh(ctx)
+			}
+		}
+	}()
+
+	log.Info().
+		Int("size", t.cfg.Size).
+		Dur("half_life", t.cfg.HalfLife).
+		Dur("interval", t.cfg.Interval).
+		Msg("Hot package tracking enabled")
+}
+
+// Stop halts the loop started by Start
+func (t *Tracker) Stop() {
+	if t == nil || t.cancel == nil {
+		return
+	}
+	t.cancel()
+	<-t.done
+}
+
+// Stats reports the hot set as last computed
+func (t *Tracker) Stats() Stats {
+	if t == nil {
+		return Stats{Hot: []Key{}}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Stats{
+		Tracked:   len(t.counters),
+		Hot:       append([]Key{}, t.hot...),
+		Refreshed: t.refreshed.Load(),
+		Failed:    t.failed.Load(),
+	}
+}
+
+// refresh recomputes the hot set and refreshes the packages in it that are
+// due, hottest first
+func (t *Tracker) refresh(ctx context.Context) {
+	for _, key := range t.update() {
+		if ctx.Err() != nil {
+			return
+		}
+		if t.cfg.Refresh == nil || t.cfg.Due != nil && !t.cfg.Due(key.Package) {
+			continue
+		}
+		if err := t.cfg.Refresh(ctx, key.Package); err != nil {
+			if ctx.Err() == nil {
+				t.failed.Add(1)
+				log.Warn().Err(err).Str("package", key.Package).Msg("Failed to refresh hot package")
+			}
+			continue
+		}
+		t.refreshed.Add(1)
+	}
+}
+
+// update recomputes the hot set and returns it
+func (t *Tracker) update() []Key {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys := make([]Key, 0, len(t.counters))
+	for pkg, c := range t.counters {
+		keys = append(keys, Key{Package: pkg, Rate: t.rate(t.decayed(c, now)), Requests: c.requests})
+	}
+	slices.SortFunc(keys, func(a, b Key) int {
+		if a.Rate != b.Rate {
+			return cmp.Compare(b.Rate, a.Rate)
+		}
+		return cmp.Compare(a.Package, b.Package)
+	})
+	keys = keys[:min(len(keys), t.cfg.Size)]
+
+	t.hot = keys
+	t.hotSet = make(map[string]bool, len(keys))
+	for _, key := range keys {
+		t.hotSet[key.Package] = true
+	}
+	return keys
+}
+
+// forgetColdest drops the colder half of the tracked packages, keeping the
+// hot set
+func (t *Tracker) forgetColdest(now time.Time) {
+	type scored struct {
+		pkg   string
+		score float64
+	}
+	all := make([]scored, 0, len(t.counters))
+	for pkg, c := range t.counters {
+		all = append(all, scored{pkg, t.decayed(c, now)})
+	}
+	slices.SortFunc(all, func(a, b scored) int { return cmp.Compare(a.score, b.score) })
+	for _, s := range all[:len(all)/2] {
+		if !t.hotSet[s.pkg] {
+			delete(t.counters, s.pkg)
+		}
+	}
+}
+
+// decayed returns c's score as of now
+func (t *Tracker) decayed(c *counter, now time.Time) float64 {
+	return c.score * math.Exp2(-float64(now.Sub(c.last))/float64(t.cfg.HalfLife))
+}
+
+// rate converts a decayed score to requests per hour: with requests
+// arriving steadily, the score settles at rate × half-life / ln 2
+func (t *Tracker) rate(score float64) float64 {
+	return score * math.Ln2 / t.cfg.HalfLife.Hours()
+}
@@ -0,0 +1,84 @@
+package hotkeys
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	var refreshed []string
+	tracker := New(Config{
+		Size: 2,
+		Due:  func(pkg string) bool { return pkg != "numpy" },
+		Refresh: func(ctx context.Context, pkg string) error {
+			refreshed = append(refreshed, pkg)
+			if pkg == "requests" {
+				return errors.New("upstream down")
+			}
+			return nil
+		},
+	})
+	for _, pkg := range []string{"numpy", "six", "numpy", "requests", "numpy", "requests"} {
+		tracker.Record(pkg)
+	}
+	if tracker.Hot("numpy") {
+		t.Error("Expected no hot set before it is computed")
+	}
+
+	tracker.refresh(context.Background())
+
+	stats := tracker.Stats()
+	if stats.Tracked != 3 || len(stats.Hot) != 2 || stats.Hot[0].Package != "numpy" || stats.Hot[1].Package != "requests" {
+		t.Fatalf("Expected numpy and requests to be hot, got %+v", stats)
+	}
+	if stats.Hot[0].Requests != 3 || math.Abs(stats.Hot[0].Rate-3*math.Ln2) > 0.01 {
+		t.Errorf("Unexpected numpy counts %+v", stats.Hot[0])
+	}
+	if !tracker.Hot("numpy") || tracker.Hot("six") {
+		t.Error("Expected Hot to follow the computed hot set")
+	}
+	// numpy is not due and six is not hot
+	if len(refreshed) != 1 || refreshed[0] != "requests" || stats.Refreshed != 0 || stats.Failed != 1 {
+		t.Errorf("Expected one failed refresh of requests, got %v and %+v", refreshed, stats)
+	}
+}
+
+func TestTracker_Decay(t *testing.T) {
+	tracker := New(Config{Size: 1, HalfLife: time.Hour})
+	tracker.Record("six")
+	tracker.counters["six"].last = time.Now().Add(-2 * time.Hour) // Two half-lives ago
+	tracker.Record("numpy")
+	tracker.Record("numpy")
+
+	tracker.update()
+	if !tracker.Hot("numpy") {
+		t.Errorf("Expected recent requests to outrank old ones, got %+v", tracker.Stats())
+	}
+}
+
+func TestTracker_ForgetsColdest(t *testing.T) {
+	tracker := New(Config{Size: 1})
+	for i := 0; i < maxTracked; i++ {
+		tracker.Record(string(rune('a'+i%26)) + time.Duration(i).String())
+	}
+	tracker.Record("one-more")
+	if tracked := tracker.Stats().Tracked; tracked > maxTracked/2+1 {
+		t.Errorf("Expected the coldest half to be forgotten, still tracking %d", tracked)
+	}
+}
+
+func TestTracker_Nil(t *testing.T) {
+	tracker := New(Config{})
+	if tracker != nil {
+		t.Fatal("Expected no tracker without a size")
+	}
+	tracker.Record("six")
+	tracker.Start()
+	tracker.Stop()
+	if tracker.Hot("six") || tracker.Stats().Tracked != 0 {
+		t.Error("Expected a nil tracker to track nothing")
+	}
+}
@@ -0,0 +1,409 @@
+// Package jobs tracks long-running operations (cache warms, mirror passes,
+// garbage collection, exports) so they can be listed, polled and canceled
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phuslu/log"
+
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+const (
+	// storagePrefix is where job records are persisted
+	storagePrefix = "jobs/"
+
+	// maxJobs bounds how many finished jobs are kept
+	maxJobs = 100
+)
+
+// Job states
+const (
+	StateRunning     = "running"
+	StateCompleted   = "completed"
+	StateFailed      = "failed"
+	StateCanceled    = "canceled"
+	StateInterrupted = "interrupted" // Still running when the process stopped
+)
+
+var (
+	// ErrNotFound is returned for unknown job IDs
+	ErrNotFound = errors.New("job not found")
+
+	// ErrFinished is returned when canceling a job that already ended
+	ErrFinished = errors.New("job already finished")
+)
+
+// Job is a snapshot of a job
+type Job struct {
+	ID         string      `json:"id"`
+	Kind       string      `json:"kind"`
+	State      string      `json:"state"`
+	CreatedAt  time.Time   `json:"created_at"`
+	FinishedAt time.Time   `json:"finished_at,omitempty"`
+	Progress   interface{} `json:"progress,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+	Artifact   string      `json:"artifact,omitempty"` // Storage key of the job's output, removed with the job
+	Error      string      `json:"error,omitempty"`
+}
+
+// Finished reports whether the job has ended
+func (j *Job) Finished() bool {
+	return j.State != StateRunning
+}
+
+// Func is the work of a job. It should return promptly once ctx is
+// canceled; its result is reported with the job.
+type Func func(ctx context.Context, p *Progress) (interface{}, error)
+
+// Progress lets a running job publish how far it got
+type Progress struct {
+	jobID string
+
+	mu       sync.Mutex
+	report   func() interface{}
+	artifact string
+}
+
+// JobID returns the ID of the job, e.g. to name its artifact
+func (p *Progress) JobID() string {
+	return p.jobID
+}
+
+// Report registers fn to be called whenever the job is inspected
+func (p *Progress) Report(fn func() interface{}) {
+	p.mu.Lock()
+	p.report = fn
+	p.mu.Unlock()
+}
+
+// SetArtifact records the storage key of the job's output
+func (p *Progress) SetArtifact(key string) {
+	p.mu.Lock()
+	p.artifact = key
+	p.mu.Unlock()
+}
+
+func (p *Progress) snapshot() (interface{}, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.report == nil {
+		return nil, p.artifact
+	}
+	return p.report(), p.artifact
+}
+
+type entry struct {
+	job      Job
+	cancel   context.CancelFunc
+	progress *Progress
+}
+
+// Manager runs jobs and keeps the most recent ones for inspection
+type Manager struct {
+	store   storage.Storage // Holds job artifacts (nil = jobs have none)
+	persist bool            // Also keep job records in store
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu    sync.RWMutex
+	jobs  map[string]*entry
+	order []string // Job IDs, oldest first
+}
+
+// NewManager creates a job manager. With persist, job records are kept in
+// store under jobs/ so they survive restarts; jobs a previous process left
+// running are loaded as interrupted.
+func NewManager(store storage.Storage, persist bool) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		store:   store,
+		persist: persist && store != nil,
+		ctx:     ctx,
+		cancel:  cancel,
+		jobs:    make(map[string]*entry),
+	}
+	if m.persist {
+		m.load()
+	}
+	return m
+}
+
+// Start runs fn in the background as a job of the given kind
+func (m *Manager) Start(kind string, fn Func) Job {
+	e, ctx := m.register(m.ctx, kind)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.execute(ctx, e, fn)
+	}()
+
+	return m.snapshot(e)
+}
+
+// Run runs fn as a job of the given kind and waits for it, for work that
+// already runs on its own goroutine such as mirror passes
+func (m *Manager) Run(ctx context.Context, kind string, fn Func) (interface{}, error) {
+	e, jobCtx := m.register(ctx, kind)
+	m.wg.Add(1)
+	defer m.wg.Done()
+
+	m.execute(jobCtx, e, fn)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if e.job.State != StateCompleted {
+		if e.job.State == StateCanceled {
+			return e.job.Result, context.Canceled
+		}
+		return e.job.Result, errors.New(e.job.Error)
+	}
+	return e.job.Result, nil
+}
+
+// Get returns a job by ID
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.RLock()
+	e, ok := m.jobs[id]
+	m.mu.RUnlock()
+	if !ok {
+		return Job{}, false
+	}
+	return m.snapshot(e), true
+}
+
+// List returns the known jobs of a kind ("" = all), newest first
+func (m *Manager) List(kind string) []Job {
+	m.mu.RLock()
+	entries := make([]*entry, 0, len(m.order))
+	for i := len(m.order) - 1; i >= 0; i-- {
+		if e := m.jobs[m.order[i]]; kind == "" || e.job.Kind == kind {
+			entries = append(entries, e)
+		}
+	}
+	m.mu.RUnlock()
+
+	list := make([]Job, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, m.snapshot(e))
+	}
+	return list
+}
+
+// Cancel stops a running job
+func (m *Manager) Cancel(id string) error {
+	m.mu.RLock()
+	e, ok := m.jobs[id]
+	var finished bool
+	if ok {
+		finished = e.job.Finished()
+	}
+	m.mu.RUnlock()
+
+	if !ok {
+		return ErrNotFound
+	}
+	if finished || e.cancel == nil {
+		return ErrFinished
+	}
+	e.cancel()
+	return nil
+}
+
+// Stop cancels running jobs and waits for them to finish
+func (m *Manager) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+func (m *Manager) register(parent context.Context, kind string) (*entry, context.Context) {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+
+	id := hex.EncodeToString(b[:])
+	ctx, cancel := context.WithCancel(parent)
+	e := &entry{
+		job: Job{
+			ID:        id,
+			Kind:      kind,
+			State:     StateRunning,
+			CreatedAt: time.Now(),
+		},
+		cancel:   cancel,
+		progress: &Progress{jobID: id},
+	}
+
+	m.mu.Lock()
+	m.jobs[e.job.ID] = e
+	m.order = append(m.order, e.job.ID)
+	pruned := m.pruneLocked()
+	job := e.job
+	m.mu.Unlock()
+
+	m.remove(pruned)
+	m.save(job)
+
+	log.Info().Str("job", job.ID).Str("kind", kind).Msg("Job started")
+	return e, ctx
+}
+
+func (m *Manager) execute(ctx context.Context, e *entry, fn Func) {
+	result, err := fn(ctx, e.progress)
+	canceled := ctx.Err() != nil
+	e.cancel()
+	progress, artifact := e.progress.snapshot()
+
+	m.mu.Lock()
+	e.job.FinishedAt = time.Now()
+	e.job.Progress = progress
+	e.job.Artifact = artifact
+	e.job.Result = result
+	switch {
+	case err == nil:
+		e.job.State = StateCompleted
+	case canceled:
+		e.job.State = StateCanceled
+	default:
+		e.job.State = StateFailed
+		e.job.Error = err.Error()
+	}
+	job := e.job
+	m.mu.Unlock()
+
+	m.save(job)
+
+	log.Info().
+		Str("job", job.ID).
+		Str("kind", job.Kind).
+		Str("state", job.State).
+		Str("error", job.Error).
+		Dur("duration", job.FinishedAt.Sub(job.CreatedAt)).
+		Msg("Job finished")
+}
+
+// snapshot copies a job, polling the progress of running jobs
+func (m *Manager) snapshot(e *entry) Job {
+	m.mu.RLock()
+	job := e.job
+	m.mu.RUnlock()
+
+	if !job.Finished() {
+		job.Progress, job.Artifact = e.progress.snapshot()
+	}
+	return job
+}
+
+// pruneLocked drops the oldest finished jobs beyond maxJobs and returns them
+func (m *Manager) pruneLocked() []Job {
+	var pruned []Job
+	for i := 0; len(m.jobs) > maxJobs && i < len(m.order); {
+		e := m.jobs[m.order[i]]
+		if !e.job.Finished() {
+			i++
+			continue
+		}
+		pruned = append(pruned, e.job)
+		delete(m.jobs, e.job.ID)
+		m.order = append(m.order[:i], m.order[i+1:]...)
+	}
+	return pruned
+}
+
+// remove deletes pruned jobs and their artifacts from storage
+func (m *Manager) remove(pruned []Job) {
+	if m.store == nil {
+		return
+	}
+	for _, job := range pruned {
+		if m.persist {
+			_ = m.store.Delete(context.Background(), storagePrefix+job.ID+".json")
+		}
+		if job.Artifact != "" {
+			_ = m.store.Delete(context.Background(), job.Artifact)
+		}
+	}
+}
+
+func (m *Manager) save(job Job) {
+	if !m.persist {
+		return
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		log.Warn().Err(err).Str("job", job.ID).Msg("Failed to encode job")
+		return
+	}
+	if _, err := m.store.Put(context.Background(), storagePrefix+job.ID+".json", bytes.NewReader(data), int64(len(data)), "application/json"); err != nil {
+		log.Warn().Err(err).Str("job", job.ID).Msg("Failed to persist job")
+	}
+}
+
+// load restores persisted jobs, marking those left running as interrupted
+func (m *Manager) load() {
+	ctx := context.Background()
+	objects, err := m.store.List(ctx, storage.ListOptions{Prefix: storagePrefix})
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to list persisted jobs")
+		return
+	}
+
+	var loaded []*entry
+	for _, obj := range objects {
+		if !strings.HasSuffix(obj.Key, ".json") {
+			continue
+		}
+		reader, _, err := m.store.Get(ctx, obj.Key)
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil {
+			continue
+		}
+
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil || job.ID == "" {
+			log.Warn().Err(err).Str("key", obj.Key).Msg("Skipping unreadable persisted job")
+			continue
+		}
+		if !job.Finished() {
+			job.State = StateInterrupted
+			job.FinishedAt = time.Now()
+			m.save(job)
+		}
+		loaded = append(loaded, &entry{job: job, progress: &Progress{}})
+	}
+
+	sort.Slice(loaded, func(i, j int) bool {
+		return loaded[i].job.CreatedAt.Before(loaded[j].job.CreatedAt)
+	})
+
+	m.mu.Lock()
+	for _, e := range loaded {
+		m.jobs[e.job.ID] = e
+		m.order = append(m.order, e.job.ID)
+	}
+	pruned := m.pruneLocked()
+	m.mu.Unlock()
+	m.remove(pruned)
+
+	if len(loaded) > 0 {
+		log.Info().Int("jobs", len(loaded)).Msg("Loaded persisted jobs")
+	}
+}
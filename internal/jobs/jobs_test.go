@@ -0,0 +1,202 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+func waitForJob(t *testing.T, m *Manager, id string) Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := m.Get(id); ok && job.Finished() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish", id)
+	return Job{}
+}
+
+func TestManager_Start(t *testing.T) {
+	m := NewManager(nil, false)
+	defer m.Stop()
+
+	release := make(chan struct{})
+	job := m.Start("test", func(ctx context.Context, p *Progress) (interface{}, error) {
+		p.Report(func() interface{} { return "halfway" })
+		<-release
+		return 42, nil
+	})
+
+	if job.State != StateRunning || job.Kind != "test" || job.ID == "" {
+		t.Errorf("Unexpected initial job %+v", job)
+	}
+
+	// Progress is polled while the job runs
+	deadline := time.Now().Add(time.Second)
+	for {
+		running, _ := m.Get(job.ID)
+		if running.Progress == "halfway" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected running progress, got %v", running.Progress)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(release)
+	finished := waitForJob(t, m, job.ID)
+	if finished.State != StateCompleted || finished.Result != 42 || finished.FinishedAt.IsZero() {
+		t.Errorf("Unexpected finished job %+v", finished)
+	}
+}
+
+func TestManager_FailAndCancel(t *testing.T) {
+	m := NewManager(nil, false)
+	defer m.Stop()
+
+	failed := m.Start("test", func(ctx context.Context, p *Progress) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	if job := waitForJob(t, m, failed.ID); job.State != StateFailed || job.Error != "boom" {
+		t.Errorf("Expected failed job, got %+v", job)
+	}
+
+	blocked := m.Start("test", func(ctx context.Context, p *Progress) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err := m.Cancel(blocked.ID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if job := waitForJob(t, m, blocked.ID); job.State != StateCanceled {
+		t.Errorf("Expected canceled job, got %+v", job)
+	}
+
+	if err := m.Cancel(blocked.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("Expected ErrFinished, got %v", err)
+	}
+	if err := m.Cancel("nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestManager_Run(t *testing.T) {
+	m := NewManager(nil, false)
+	defer m.Stop()
+
+	result, err := m.Run(context.Background(), "sync", func(ctx context.Context, p *Progress) (interface{}, error) {
+		return "done", nil
+	})
+	if err != nil || result != "done" {
+		t.Errorf("Expected result, got %v, %v", result, err)
+	}
+
+	if _, err := m.Run(context.Background(), "sync", func(ctx context.Context, p *Progress) (interface{}, error) {
+		return nil, errors.New("boom")
+	}); err == nil || err.Error() != "boom" {
+		t.Errorf("Expected job error, got %v", err)
+	}
+}
+
+func TestManager_List(t *testing.T) {
+	m := NewManager(nil, false)
+	defer m.Stop()
+
+	noop := func(ctx context.Context, p *Progress) (interface{}, error) { return nil, nil }
+	first := m.Start("a", noop)
+	waitForJob(t, m, first.ID)
+	second := m.Start("b", noop)
+	waitForJob(t, m, second.ID)
+
+	all := m.List("")
+	if len(all) != 2 || all[0].ID != second.ID || all[1].ID != first.ID {
+		t.Errorf("Expected newest first, got %+v", all)
+	}
+	if only := m.List("a"); len(only) != 1 || only[0].ID != first.ID {
+		t.Errorf("Expected kind filter, got %+v", only)
+	}
+}
+
+func TestManager_Prune(t *testing.T) {
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+	m := NewManager(store, false)
+	defer m.Stop()
+
+	ctx := context.Background()
+	var firstArtifact string
+	for i := 0; i < maxJobs+1; i++ {
+		job := m.Start("export", func(ctx context.Context, p *Progress) (interface{}, error) {
+			key := fmt.Sprintf("exports/%d.tar", i)
+			if _, err := store.Put(ctx, key, strings.NewReader("tar"), 3, ""); err != nil {
+				return nil, err
+			}
+			p.SetArtifact(key)
+			return nil, nil
+		})
+		if finished := waitForJob(t, m, job.ID); i == 0 {
+			firstArtifact = finished.Artifact
+		}
+	}
+
+	// Registering one more job evicts the oldest finished one
+	last := m.Start("export", func(ctx context.Context, p *Progress) (interface{}, error) { return nil, nil })
+	waitForJob(t, m, last.ID)
+
+	if n := len(m.List("")); n != maxJobs {
+		t.Errorf("Expected %d jobs kept, got %d", maxJobs, n)
+	}
+	if exists, _ := store.Exists(ctx, firstArtifact); exists {
+		t.Error("Expected pruned job's artifact to be deleted")
+	}
+}
+
+func TestManager_Persist(t *testing.T) {
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	m := NewManager(store, true)
+	done := m.Start("gc", func(ctx context.Context, p *Progress) (interface{}, error) {
+		return map[string]int{"deleted": 3}, nil
+	})
+	waitForJob(t, m, done.ID)
+
+	// A job still running when the process stops is interrupted. Stop
+	// cancels it, so persist a running record directly to simulate a crash.
+	crashed := Job{ID: "crashed", Kind: "warm", State: StateRunning, CreatedAt: time.Now()}
+	m.save(crashed)
+	m.Stop()
+
+	restarted := NewManager(store, true)
+	defer restarted.Stop()
+
+	job, ok := restarted.Get(done.ID)
+	if !ok || job.State != StateCompleted || job.Kind != "gc" {
+		t.Fatalf("Expected completed job restored, got %+v (found %v)", job, ok)
+	}
+	if result, _ := job.Result.(map[string]interface{}); result["deleted"] != float64(3) {
+		t.Errorf("Expected result restored, got %v", job.Result)
+	}
+
+	job, ok = restarted.Get("crashed")
+	if !ok || job.State != StateInterrupted {
+		t.Errorf("Expected interrupted job, got %+v (found %v)", job, ok)
+	}
+	if err := restarted.Cancel("crashed"); !errors.Is(err, ErrFinished) {
+		t.Errorf("Expected interrupted job to be finished, got %v", err)
+	}
+}
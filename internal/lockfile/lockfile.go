@@ -0,0 +1,213 @@
+// Package lockfile extracts pinned requirements from requirements.txt,
+// poetry.lock and uv.lock files
+package lockfile
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Supported lockfile formats
+const (
+	FormatRequirements = "requirements"
+	FormatPoetry       = "poetry"
+	FormatUV           = "uv"
+)
+
+// Requirement is a package pinned by a lockfile
+type Requirement struct {
+	Name    string   `json:"name"`
+	Version string   `json:"version,omitempty"` // Empty if the lockfile does not pin it exactly
+	Hashes  []string `json:"hashes,omitempty"`  // Allowed SHA-256 digests (hex); empty = any file of Version
+}
+
+// Detect guesses the format of a lockfile from its content
+func Detect(data []byte) string {
+	if !bytes.Contains(data, []byte("[[package]]")) {
+		return FormatRequirements
+	}
+	// uv records a source for every package; Poetry only for non-PyPI ones
+	if bytes.Contains(data, []byte("\nsource = {")) {
+		return FormatUV
+	}
+	return FormatPoetry
+}
+
+// Parse extracts the requirements from a lockfile. An empty format is
+// detected from the content. Packages not installed from an index (git,
+// path and editable sources) are left out.
+func Parse(data []byte, format string) ([]Requirement, error) {
+	if format == "" {
+		format = Detect(data)
+	}
+
+	var reqs []Requirement
+	var err error
+	switch format {
+	case FormatRequirements:
+		reqs, err = parseRequirements(data)
+	case FormatPoetry, FormatUV:
+		reqs, err = parseTOMLLock(data)
+	default:
+		return nil, fmt.Errorf("unsupported lockfile format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(reqs) == 0 {
+		return nil, errors.New("lockfile lists no packages")
+	}
+	return reqs, nil
+}
+
+// parseRequirements reads pip requirements, honoring --hash options and
+// line continuations. Options, includes and direct URL references are
+// skipped.
+func parseRequirements(data []byte) ([]Requirement, error) {
+	var reqs []Requirement
+	var logical strings.Builder
+
+	flush := func() {
+		line := logical.String()
+		logical.Reset()
+		if req, ok := parseRequirementLine(line); ok {
+			reqs = append(reqs, req)
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			line = ""
+		}
+
+		if continued, ok := strings.CutSuffix(strings.TrimRight(line, " \t"), `\`); ok {
+			logical.WriteString(continued)
+			logical.WriteByte(' ')
+			continue
+		}
+		logical.WriteString(line)
+		flush()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read requirements: %w", err)
+	}
+	flush()
+
+	return reqs, nil
+}
+
+// parseRequirementLine parses one logical requirements line such as
+// "numpy[extra]==1.26.4 ; python_version >= '3.9' --hash=sha256:..."
+func parseRequirementLine(line string) (Requirement, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "-") {
+		return Requirement{}, false
+	}
+
+	var spec []string
+	var hashes []string
+	for _, field := range fields {
+		if value, ok := strings.CutPrefix(field, "--hash="); ok {
+			if sha, ok := strings.CutPrefix(value, "sha256:"); ok {
+				hashes = append(hashes, strings.ToLower(sha))
+			}
+			continue
+		}
+		if strings.HasPrefix(field, "--") {
+			continue
+		}
+		spec = append(spec, field)
+	}
+
+	requirement, _, _ := strings.Cut(strings.Join(spec, ""), ";")
+	if strings.Contains(requirement, "@") || strings.Contains(requirement, "://") {
+		return Requirement{}, false // Direct reference, not served by an index
+	}
+
+	name, version := requirement, ""
+	if i := strings.IndexAny(requirement, "=<>!~"); i >= 0 {
+		name = requirement[:i]
+		if pinned, ok := strings.CutPrefix(requirement[i:], "==="); ok {
+			version = pinned
+		} else if pinned, ok := strings.CutPrefix(requirement[i:], "=="); ok && !strings.ContainsAny(pinned, ",*") {
+			version = pinned
+		}
+	}
+	name, _, _ = strings.Cut(name, "[")
+	if name == "" {
+		return Requirement{}, false
+	}
+
+	return Requirement{Name: name, Version: version, Hashes: hashes}, true
+}
+
+// tomlLock covers the parts of poetry.lock and uv.lock needed to find files
+type tomlLock struct {
+	Package []struct {
+		Name    string                 `toml:"name"`
+		Version string                 `toml:"version"`
+		Source  map[string]interface{} `toml:"source"`
+		Sdist   *tomlArtifact          `toml:"sdist"`  // uv
+		Wheels  []tomlArtifact         `toml:"wheels"` // uv
+		Files   []tomlArtifact         `toml:"files"`  // Poetry
+	} `toml:"package"`
+}
+
+type tomlArtifact struct {
+	Hash string `toml:"hash"`
+}
+
+// parseTOMLLock reads poetry.lock and uv.lock, which share the [[package]]
+// layout and differ only in where they list artifacts
+func parseTOMLLock(data []byte) ([]Requirement, error) {
+	var lock tomlLock
+	if err := toml.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("invalid lockfile: %w", err)
+	}
+
+	var reqs []Requirement
+	for _, pkg := range lock.Package {
+		if pkg.Name == "" || !fromIndex(pkg.Source) {
+			continue
+		}
+
+		artifacts := append(pkg.Wheels, pkg.Files...)
+		if pkg.Sdist != nil {
+			artifacts = append(artifacts, *pkg.Sdist)
+		}
+
+		req := Requirement{Name: pkg.Name, Version: pkg.Version}
+		for _, artifact := range artifacts {
+			if sha, ok := strings.CutPrefix(artifact.Hash, "sha256:"); ok {
+				req.Hashes = append(req.Hashes, strings.ToLower(sha))
+			}
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// fromIndex reports whether a lock entry's source is a package index. Poetry
+// omits the source for PyPI and uses type "legacy" for other indexes; uv
+// always records a "registry" source.
+func fromIndex(source map[string]interface{}) bool {
+	if source == nil {
+		return true
+	}
+	if _, ok := source["registry"]; ok {
+		return true
+	}
+	kind, _ := source["type"].(string)
+	return kind == "legacy" || kind == "pypi"
+}
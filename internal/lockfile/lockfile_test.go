@@ -0,0 +1,127 @@
+package lockfile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse_Requirements(t *testing.T) {
+	data := `# Pinned for release
+--index-url https://pypi.org/simple/
+-r base.txt
+numpy==1.26.4 \
+    --hash=sha256:AAAA \
+    --hash=sha256:bbbb
+requests[socks]==2.31.0 ; python_version >= "3.8"
+flask>=2.0
+mypkg @ https://example.com/mypkg-1.0.tar.gz
+-e ./local
+`
+
+	reqs, err := Parse([]byte(data), "")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(reqs) != 3 {
+		t.Fatalf("Expected 3 requirements, got %+v", reqs)
+	}
+
+	if reqs[0].Name != "numpy" || reqs[0].Version != "1.26.4" || strings.Join(reqs[0].Hashes, ",") != "aaaa,bbbb" {
+		t.Errorf("Unexpected numpy requirement %+v", reqs[0])
+	}
+	if reqs[1].Name != "requests" || reqs[1].Version != "2.31.0" || len(reqs[1].Hashes) != 0 {
+		t.Errorf("Unexpected requests requirement %+v", reqs[1])
+	}
+	if reqs[2].Name != "flask" || reqs[2].Version != "" {
+		t.Errorf("Expected unpinned flask, got %+v", reqs[2])
+	}
+}
+
+func TestParse_Poetry(t *testing.T) {
+	data := `[[package]]
+name = "numpy"
+version = "1.26.4"
+description = "Fundamental package for array computing in Python"
+optional = false
+python-versions = ">=3.9"
+files = [
+    {file = "numpy-1.26.4-cp312-cp312-manylinux_2_17_x86_64.whl", hash = "sha256:aaaa"},
+    {file = "numpy-1.26.4.tar.gz", hash = "sha256:bbbb"},
+]
+
+[[package]]
+name = "internal-lib"
+version = "0.1.0"
+files = []
+
+[package.source]
+type = "git"
+url = "https://git.example/internal-lib.git"
+reference = "main"
+
+[metadata]
+lock-version = "2.0"
+`
+
+	if format := Detect([]byte(data)); format != FormatPoetry {
+		t.Errorf("Expected poetry format, got %q", format)
+	}
+
+	reqs, err := Parse([]byte(data), "")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(reqs) != 1 {
+		t.Fatalf("Expected git source to be skipped, got %+v", reqs)
+	}
+	if reqs[0].Name != "numpy" || reqs[0].Version != "1.26.4" || strings.Join(reqs[0].Hashes, ",") != "aaaa,bbbb" {
+		t.Errorf("Unexpected requirement %+v", reqs[0])
+	}
+}
+
+func TestParse_UV(t *testing.T) {
+	data := `version = 1
+requires-python = ">=3.12"
+
+[[package]]
+name = "myapp"
+version = "0.1.0"
+source = { editable = "." }
+
+[[package]]
+name = "numpy"
+version = "1.26.4"
+source = { registry = "https://pypi.org/simple" }
+sdist = { url = "https://files.pythonhosted.org/numpy-1.26.4.tar.gz", hash = "sha256:bbbb", size = 100 }
+wheels = [
+    { url = "https://files.pythonhosted.org/numpy-1.26.4-cp312-cp312-manylinux_2_17_x86_64.whl", hash = "sha256:aaaa", size = 200 },
+]
+`
+
+	if format := Detect([]byte(data)); format != FormatUV {
+		t.Errorf("Expected uv format, got %q", format)
+	}
+
+	reqs, err := Parse([]byte(data), FormatUV)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(reqs) != 1 {
+		t.Fatalf("Expected editable project to be skipped, got %+v", reqs)
+	}
+	if reqs[0].Name != "numpy" || strings.Join(reqs[0].Hashes, ",") != "aaaa,bbbb" {
+		t.Errorf("Unexpected requirement %+v", reqs[0])
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	if _, err := Parse([]byte("# nothing here\n"), ""); err == nil {
+		t.Error("Expected error for a lockfile without packages")
+	}
+	if _, err := Parse([]byte("numpy==1.0"), "pipfile"); err == nil {
+		t.Error("Expected error for an unsupported format")
+	}
+	if _, err := Parse([]byte("[[package]]\nname = "), FormatPoetry); err == nil {
+		t.Error("Expected error for invalid TOML")
+	}
+}
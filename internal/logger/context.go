@@ -0,0 +1,72 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/phuslu/log"
+)
+
+// requestKey is the context key for request-scoped logging data
+type requestKey struct{}
+
+// requestData holds the request ID, further fields added with WithFields
+// and a logger pre-tagged with them
+type requestData struct {
+	id     string
+	fields []string // Name/value pairs
+	logger *log.Logger
+}
+
+// WithRequestID returns a copy of ctx carrying requestID and a logger that
+// adds a request_id field to every line it emits
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestKey{}, newRequestData(requestID, nil))
+}
+
+// WithFields returns a copy of ctx whose request logger also adds the given
+// name/value pairs to every line it emits
+func WithFields(ctx context.Context, nameValues ...string) context.Context {
+	if len(nameValues) < 2 {
+		return ctx
+	}
+	var id string
+	var fields []string
+	if data, ok := ctx.Value(requestKey{}).(*requestData); ok {
+		id, fields = data.id, data.fields
+	}
+	fields = append(fields[:len(fields):len(fields)], nameValues[:len(nameValues)&^1]...)
+	return context.WithValue(ctx, requestKey{}, newRequestData(id, fields))
+}
+
+// newRequestData builds a logger tagged with the request ID and fields
+func newRequestData(id string, fields []string) *requestData {
+	entry := log.NewContext(nil)
+	if id != "" {
+		entry = entry.Str("request_id", id)
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		entry = entry.Str(fields[i], fields[i+1])
+	}
+	l := log.DefaultLogger
+	l.Context = entry.Value()
+	return &requestData{id: id, fields: fields, logger: &l}
+}
+
+// RequestID returns the request ID stored in ctx, or "" if there is none
+func RequestID(ctx context.Context) string {
+	if data, ok := ctx.Value(requestKey{}).(*requestData); ok {
+		return data.id
+	}
+	return ""
+}
+
+// FromContext returns the request-scoped logger stored in ctx, falling back
+// to the default logger for background work
+func FromContext(ctx context.Context) *log.Logger {
+	if ctx != nil {
+		if data, ok := ctx.Value(requestKey{}).(*requestData); ok {
+			return data.logger
+		}
+	}
+	return &log.DefaultLogger
+}
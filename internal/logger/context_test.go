@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/phuslu/log"
+)
+
+func TestWithRequestID(t *testing.T) {
+	original := log.DefaultLogger
+	defer func() { log.DefaultLogger = original }()
+
+	var buf bytes.Buffer
+	log.DefaultLogger = log.Logger{
+		Level:  log.InfoLevel,
+		Writer: &log.IOWriter{Writer: &buf},
+	}
+
+	ctx := WithRequestID(context.Background(), "req-123")
+
+	if got := RequestID(ctx); got != "req-123" {
+		t.Errorf("RequestID() = %q, want %q", got, "req-123")
+	}
+
+	FromContext(ctx).Info().Str("package", "numpy").Msg("handled")
+
+	output := buf.String()
+	if !strings.Contains(output, `"request_id":"req-123"`) {
+		t.Errorf("Expected request_id field in log output, got: %s", output)
+	}
+	if !strings.Contains(output, `"package":"numpy"`) {
+		t.Errorf("Expected package field in log output, got: %s", output)
+	}
+}
+
+func TestFromContext_Fallback(t *testing.T) {
+	if RequestID(context.Background()) != "" {
+		t.Error("Expected empty request ID for background context")
+	}
+
+	if FromContext(context.Background()) != &log.DefaultLogger {
+		t.Error("Expected default logger for context without request ID")
+	}
+}
+
+func TestWithFields(t *testing.T) {
+	original := log.DefaultLogger
+	defer func() { log.DefaultLogger = original }()
+
+	var buf bytes.Buffer
+	log.DefaultLogger = log.Logger{
+		Level:  log.InfoLevel,
+		Writer: &log.IOWriter{Writer: &buf},
+	}
+
+	ctx := WithRequestID(context.Background(), "req-123")
+	ctx = WithFields(ctx, "client", "pip")
+	ctx = WithFields(ctx, "team", "data", "dangling")
+	FromContext(ctx).Info().Msg("handled")
+
+	output := buf.String()
+	for _, field := range []string{`"request_id":"req-123"`, `"client":"pip"`, `"team":"data"`} {
+		if !strings.Contains(output, field) {
+			t.Errorf("Expected %s in log output, got: %s", field, output)
+		}
+	}
+	if strings.Contains(output, "dangling") {
+		t.Errorf("Expected a name without a value dropped, got: %s", output)
+	}
+	if RequestID(ctx) != "req-123" {
+		t.Error("Expected the request ID kept")
+	}
+}
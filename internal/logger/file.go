@@ -0,0 +1,132 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+// FileConfig configures the log file sink. Each file is named after Path
+// with the time it was opened, e.g. groxpi.2024-05-01T12-00-00.log, and
+// Path itself is a symlink to the one being written.
+type FileConfig struct {
+	Path           string        // Log file; empty disables the sink
+	MaxSize        int64         // Rotate once the file is larger than this many bytes (0 = no size limit)
+	RotateInterval time.Duration // Also rotate this often (0 = by size only)
+	MaxBackups     int           // Rotated files kept (0 = all)
+	Compress       bool          // Gzip rotated files
+}
+
+// openFile returns the log file sink, also rotated every RotateInterval, if
+// set, until stop is closed
+func openFile(cfg FileConfig, stop <-chan struct{}) *log.FileWriter {
+	writer := &log.FileWriter{
+		Filename:     cfg.Path,
+		MaxSize:      cfg.MaxSize,
+		MaxBackups:   cfg.MaxBackups,
+		LocalTime:    true,
+		EnsureFolder: true,
+	}
+	if cfg.Compress {
+		writer.Cleaner = compressBackups
+	}
+
+	if cfg.RotateInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(cfg.RotateInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					_ = writer.Rotate()
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+	return writer
+}
+
+// cleanMu keeps the cleanups of rotations in quick succession, which run
+// in the background, from compressing the same file twice
+var cleanMu sync.Mutex
+
+// compressBackups is the FileWriter cleaner used with compression: it gzips
+// the rotated files, then removes the oldest beyond maxBackups. matches are
+// the log files oldest first, including the one being written, which
+// filename links to.
+func compressBackups(filename string, maxBackups int, matches []os.FileInfo) {
+	cleanMu.Lock()
+	defer cleanMu.Unlock()
+
+	current, err := os.Readlink(filename)
+	if err != nil {
+		return
+	}
+	dir := filepath.Dir(filename)
+
+	var backups []string
+	for _, info := range matches {
+		name := info.Name()
+		if name == current {
+			continue
+		}
+		if !strings.HasSuffix(name, ".gz") {
+			if err := gzipFile(filepath.Join(dir, name), info.ModTime()); err != nil {
+				log.Warn().Err(err).Str("file", name).Msg("Failed to compress rotated log file")
+			} else {
+				name += ".gz"
+			}
+		}
+		backups = append(backups, name)
+	}
+
+	if maxBackups > 0 {
+		for len(backups) > maxBackups {
+			_ = os.Remove(filepath.Join(dir, backups[0]))
+			backups = backups[1:]
+		}
+	}
+}
+
+// gzipFile replaces path with path.gz, keeping its modification time so
+// backups stay in order
+func gzipFile(path string, modTime time.Time) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	dst, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(path + ".gz")
+		}
+	}()
+
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Chtimes(path+".gz", modTime, modTime); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,97 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+func TestInit_File(t *testing.T) {
+	original := log.DefaultLogger
+	defer func() { log.DefaultLogger = original }()
+
+	path := filepath.Join(t.TempDir(), "logs", "groxpi.log")
+	Init(LogConfig{
+		Level:    "INFO",
+		Format:   "json",
+		File:     FileConfig{Path: path},
+		NoStdout: true,
+	})
+	Logger.Info().Str("package", "numpy").Msg("file sink")
+	if err := Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if !strings.Contains(string(data), `"package":"numpy"`) {
+		t.Errorf("Expected the log line in the file, got: %s", data)
+	}
+}
+
+func TestCompressBackups(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "groxpi.log")
+	names := []string{"groxpi.1.log", "groxpi.2.log.gz", "groxpi.3.log", "groxpi.4.log"}
+	start := time.Now().Add(-time.Hour)
+	var matches []os.FileInfo
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := start.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matches = append(matches, info)
+	}
+	if err := os.Symlink("groxpi.4.log", link); err != nil {
+		t.Fatal(err)
+	}
+
+	compressBackups(link, 2, matches)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	want := []string{"groxpi.2.log.gz", "groxpi.3.log.gz", "groxpi.4.log", "groxpi.log"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+
+	// The compressed backup keeps its content and its place in the order
+	path := filepath.Join(dir, "groxpi.3.log.gz")
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := io.ReadAll(zr); string(content) != "groxpi.3.log" {
+		t.Errorf("Expected the original content, got %q", content)
+	}
+	if info, _ := os.Stat(path); !info.ModTime().Equal(matches[2].ModTime()) {
+		t.Errorf("Expected the modification time %s kept, got %s", matches[2].ModTime(), info.ModTime())
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package logger
+
+import (
+	"errors"
+
+	"github.com/phuslu/log"
+)
+
+// newJournalWriter fails, since journald only runs on Linux
+func newJournalWriter() (log.Writer, error) {
+	return nil, errors.New("journald is only available on Linux")
+}
@@ -0,0 +1,191 @@
+package logger
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+// levelState is the log level of each module, by Go package name (server,
+// storage, streaming, ...), and how many debug lines each call site may
+// log per second
+type levelState struct {
+	global      log.Level
+	modules     map[string]log.Level
+	debugSample int // 0 = every line
+}
+
+// minimum is the level entries must reach to be built at all
+func (st *levelState) minimum() log.Level {
+	level := st.global
+	for _, l := range st.modules {
+		level = min(level, l)
+	}
+	return level
+}
+
+var (
+	levels     atomic.Pointer[levelState]
+	levelsMu   sync.Mutex // Serializes SetLevel's read-modify-write
+	debugSites sync.Map   // Call site PC -> *siteCount
+)
+
+// selfPrefix is this package's function name prefix. Its frames, other
+// than tests', are skipped when looking for the line that logged an entry,
+// so Debug(msg) and friends count against their caller.
+var selfPrefix = strings.TrimSuffix(runtime.FuncForPC(reflect.ValueOf(Init).Pointer()).Name(), "Init")
+
+// LookupLevel returns the level of a name (DEBUG, INFO, WARN, ERROR or FATAL)
+func LookupLevel(name string) (log.Level, bool) {
+	switch strings.ToUpper(name) {
+	case "DEBUG":
+		return log.DebugLevel, true
+	case "INFO":
+		return log.InfoLevel, true
+	case "WARN", "WARNING":
+		return log.WarnLevel, true
+	case "ERROR":
+		return log.ErrorLevel, true
+	case "FATAL":
+		return log.FatalLevel, true
+	}
+	return log.InfoLevel, false
+}
+
+// applyLevels makes st the current levels and sets the loggers' level to
+// the lowest of them, so the filter sees every entry a module may want
+func applyLevels(st *levelState) {
+	levels.Store(st)
+	minimum := st.minimum()
+	Logger.SetLevel(minimum)
+	log.DefaultLogger.SetLevel(minimum)
+}
+
+// SetLevel changes the level of a module at runtime, or the global level
+// when module is empty. An empty level drops a module's own level, so it
+// follows the global one again. Request loggers pick the change up from
+// the next request.
+func SetLevel(module, level string) error {
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+
+	current := levels.Load()
+	st := &levelState{global: log.InfoLevel}
+	if current != nil {
+		st.global, st.debugSample = current.global, current.debugSample
+		st.modules = maps.Clone(current.modules)
+	}
+
+	if module != "" && level == "" {
+		delete(st.modules, module)
+		applyLevels(st)
+		return nil
+	}
+	parsed, ok := LookupLevel(level)
+	if !ok {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	if module == "" {
+		st.global = parsed
+	} else {
+		if st.modules == nil {
+			st.modules = make(map[string]log.Level)
+		}
+		st.modules[module] = parsed
+	}
+	applyLevels(st)
+	return nil
+}
+
+// Levels returns the global log level and the modules' own levels
+func Levels() (string, map[string]string) {
+	st := levels.Load()
+	if st == nil {
+		return levelName(Logger.Level), map[string]string{}
+	}
+	modules := make(map[string]string, len(st.modules))
+	for module, level := range st.modules {
+		modules[module] = levelName(level)
+	}
+	return levelName(st.global), modules
+}
+
+func levelName(level log.Level) string {
+	return strings.ToUpper(level.String())
+}
+
+// levelFilter drops entries below the level of the module that logged
+// them, and debug lines past the per-second budget of their call site.
+// Entries pass straight through unless module levels or debug sampling
+// are set, since finding the caller costs a stack walk.
+type levelFilter struct {
+	next log.Writer
+}
+
+func (f *levelFilter) WriteEntry(e *log.Entry) (int, error) {
+	st := levels.Load()
+	sampled := st != nil && st.debugSample > 0 && e.Level <= log.DebugLevel
+	if st == nil || (len(st.modules) == 0 && !sampled) {
+		return f.next.WriteEntry(e)
+	}
+
+	pc, module := callSite()
+	level, ok := st.modules[module]
+	if !ok {
+		level = st.global
+	}
+	if e.Level < level || (sampled && !allowDebug(pc, st.debugSample)) {
+		return 0, nil
+	}
+	return f.next.WriteEntry(e)
+}
+
+// callSite returns the program counter of the line that logged the entry
+// being written, and the name of its package
+func callSite() (uintptr, string) {
+	var pcs [32]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs[:])])
+	for {
+		frame, more := frames.Next()
+		internal := strings.HasPrefix(frame.Function, "github.com/phuslu/log.") ||
+			(strings.HasPrefix(frame.Function, selfPrefix) && !strings.HasSuffix(frame.File, "_test.go"))
+		if !internal {
+			name := frame.Function[strings.LastIndex(frame.Function, "/")+1:]
+			module, _, _ := strings.Cut(name, ".")
+			return frame.PC, module
+		}
+		if !more {
+			return 0, ""
+		}
+	}
+}
+
+// siteCount counts a call site's debug lines in the current second
+type siteCount struct {
+	mu     sync.Mutex
+	second int64
+	count  int
+}
+
+// allowDebug reports whether the call site at pc may log another debug
+// line this second
+func allowDebug(pc uintptr, perSecond int) bool {
+	value, _ := debugSites.LoadOrStore(pc, &siteCount{})
+	site := value.(*siteCount)
+	now := time.Now().Unix()
+
+	site.mu.Lock()
+	defer site.mu.Unlock()
+	if site.second != now {
+		site.second, site.count = now, 0
+	}
+	site.count++
+	return site.count <= perSecond
+}
@@ -0,0 +1,102 @@
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/phuslu/log"
+)
+
+// captureLevels starts the logger with cfg, writing JSON lines to the
+// returned buffer
+func captureLevels(t *testing.T, cfg LogConfig) *bytes.Buffer {
+	t.Helper()
+	original := log.DefaultLogger
+	t.Cleanup(func() {
+		log.DefaultLogger = original
+		levels.Store(nil)
+	})
+
+	Init(cfg)
+	var buf bytes.Buffer
+	Logger.Writer = &levelFilter{next: &log.IOWriter{Writer: &buf}}
+	return &buf
+}
+
+func TestLevels_Modules(t *testing.T) {
+	buf := captureLevels(t, LogConfig{Level: "WARN", Format: "json", Modules: map[string]string{"logger": "DEBUG"}})
+
+	// This file is in the logger module, other modules follow the global level
+	Logger.Debug().Msg("module debug")
+	if !strings.Contains(buf.String(), "module debug") {
+		t.Errorf("Expected the module's debug line, got %q", buf.String())
+	}
+	if Logger.Level != log.DebugLevel {
+		t.Errorf("Expected the logger level lowered to DEBUG, got %v", Logger.Level)
+	}
+
+	if err := SetLevel("logger", "ERROR"); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	Logger.Warn().Msg("module warn")
+	if buf.Len() != 0 {
+		t.Errorf("Expected the warning dropped at ERROR, got %q", buf.String())
+	}
+
+	// Without its own level the module follows the global one again
+	if err := SetLevel("logger", ""); err != nil {
+		t.Fatal(err)
+	}
+	Logger.Warn().Msg("global warn")
+	if !strings.Contains(buf.String(), "global warn") {
+		t.Errorf("Expected the warning at the global level, got %q", buf.String())
+	}
+
+	global, modules := Levels()
+	if global != "WARN" || len(modules) != 0 {
+		t.Errorf("Expected WARN and no module levels, got %s %v", global, modules)
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	captureLevels(t, LogConfig{Level: "INFO", Format: "json"})
+
+	if err := SetLevel("", "DEBUG"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetLevel("storage", "error"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetLevel("storage", "LOUD"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+
+	global, modules := Levels()
+	if global != "DEBUG" || modules["storage"] != "ERROR" {
+		t.Errorf("Expected DEBUG with storage=ERROR, got %s %v", global, modules)
+	}
+	if log.DefaultLogger.Level != log.DebugLevel {
+		t.Errorf("Expected the default logger at DEBUG, got %v", log.DefaultLogger.Level)
+	}
+}
+
+func TestLevels_DebugSample(t *testing.T) {
+	buf := captureLevels(t, LogConfig{Level: "DEBUG", Format: "json", DebugSample: 3})
+
+	for range 10 {
+		Logger.Debug().Msg("hot path")
+	}
+	for range 2 {
+		Logger.Info().Msg("not sampled")
+	}
+
+	if got := strings.Count(buf.String(), "hot path"); got != 3 && got != 6 {
+		// 6 if the loop crossed into the next second
+		t.Errorf("Expected 3 debug lines from the call site, got %d", got)
+	}
+	if got := strings.Count(buf.String(), "not sampled"); got != 2 {
+		t.Errorf("Expected every info line, got %d", got)
+	}
+}
@@ -19,6 +19,13 @@ type LogConfig struct {
 	Format     string // console, json
 	TimeFormat string // time format for console output
 	Color      bool   // enable color output for console
+	File       FileConfig
+	Syslog     SyslogConfig
+	Journald   bool // log to journald
+	NoStdout   bool // log only to the sinks above, not stdout
+
+	Modules     map[string]string // Levels of single modules by package name, e.g. storage=DEBUG
+	DebugSample int               // Debug lines each call site may log per second (0 = all)
 }
 
 // Init initializes the global logger
@@ -66,29 +73,43 @@ func Init(cfg LogConfig) {
 		}
 	}
 
+	// Also log to files, syslog or journald, or only to them
+	sinks, errs := openSinks(cfg)
+	if len(sinks) > 0 {
+		if cfg.File.Path != "" && strings.ToLower(cfg.Format) != "json" {
+			// A file's history spans days
+			Logger.TimeFormat = "2006-01-02 15:04:05.000"
+		}
+		if !cfg.NoStdout {
+			sinks = append(log.MultiEntryWriter{Logger.Writer}, sinks...)
+		}
+		Logger.Writer = &sinks
+	}
+
+	// Module levels and debug sampling are applied as entries are written
+	Logger.Writer = &levelFilter{next: Logger.Writer}
+	st := &levelState{global: level, modules: make(map[string]log.Level, len(cfg.Modules)), debugSample: cfg.DebugSample}
+	for module, name := range cfg.Modules {
+		st.modules[module] = ParseLevel(name)
+	}
+
 	// Set as default logger - this is crucial for log.Debug() calls throughout the codebase
 	log.DefaultLogger = Logger
 
 	// Also ensure the default logger level is set correctly
-	log.DefaultLogger.SetLevel(level)
+	levelsMu.Lock()
+	applyLevels(st)
+	levelsMu.Unlock()
+
+	for _, err := range errs {
+		Logger.Warn().Err(err).Msg("Log sink unavailable")
+	}
 }
 
 // parseLevel converts string level to log.Level
 func ParseLevel(level string) log.Level {
-	switch strings.ToUpper(level) {
-	case "DEBUG":
-		return log.DebugLevel
-	case "INFO":
-		return log.InfoLevel
-	case "WARN", "WARNING":
-		return log.WarnLevel
-	case "ERROR":
-		return log.ErrorLevel
-	case "FATAL":
-		return log.FatalLevel
-	default:
-		return log.InfoLevel
-	}
+	parsed, _ := LookupLevel(level)
+	return parsed
 }
 
 // isTerminal checks if stdout is a terminal
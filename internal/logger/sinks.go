@@ -0,0 +1,82 @@
+package logger
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/phuslu/log"
+)
+
+// sinks holds what Close has to release: the writers opened besides stdout
+// and the stop signal of the file's timed rotation
+var sinks struct {
+	mu      sync.Mutex
+	closers []io.Closer
+	stop    chan struct{}
+}
+
+// openSinks opens the sinks cfg asks for besides stdout, closing any
+// opened by an earlier Init. Sinks that can't be set up are left out and
+// their errors returned.
+func openSinks(cfg LogConfig) (log.MultiEntryWriter, []error) {
+	_ = Close()
+
+	sinks.mu.Lock()
+	defer sinks.mu.Unlock()
+
+	var writers log.MultiEntryWriter
+	var errs []error
+	if cfg.File.Path != "" {
+		sinks.stop = make(chan struct{})
+		file := openFile(cfg.File, sinks.stop)
+		sinks.closers = append(sinks.closers, file)
+		if strings.ToLower(cfg.Format) == "json" {
+			writers = append(writers, file)
+		} else {
+			writers = append(writers, &log.ConsoleWriter{
+				QuoteString:    true,
+				EndWithMessage: true,
+				Writer:         file,
+			})
+		}
+	}
+	if cfg.Syslog.Address != "" {
+		if syslog, err := newSyslogWriter(cfg.Syslog); err != nil {
+			errs = append(errs, err)
+		} else {
+			sinks.closers = append(sinks.closers, syslog)
+			writers = append(writers, syslog)
+		}
+	}
+	if cfg.Journald {
+		if journal, err := newJournalWriter(); err != nil {
+			errs = append(errs, err)
+		} else {
+			if closer, ok := journal.(io.Closer); ok {
+				sinks.closers = append(sinks.closers, closer)
+			}
+			writers = append(writers, journal)
+		}
+	}
+	return writers, errs
+}
+
+// Close closes the log sinks besides stdout. Call it before exiting so the
+// last lines reach the log file.
+func Close() error {
+	sinks.mu.Lock()
+	defer sinks.mu.Unlock()
+
+	if sinks.stop != nil {
+		close(sinks.stop)
+		sinks.stop = nil
+	}
+	var errs []error
+	for _, closer := range sinks.closers {
+		errs = append(errs, closer.Close())
+	}
+	sinks.closers = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,163 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+// SyslogConfig configures the syslog sink
+type SyslogConfig struct {
+	Address  string // udp://host:514, tcp://host:601 or a local socket such as /dev/log; empty disables the sink
+	Tag      string // APP-NAME of the messages
+	Facility string // Facility name, e.g. daemon or local0
+}
+
+// facilities are the syslog facility codes by name (RFC 5424, section 6.2.1)
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// ParseFacility returns the code of a syslog facility name
+func ParseFacility(name string) (int, bool) {
+	facility, ok := facilities[strings.ToLower(name)]
+	return facility, ok
+}
+
+// ParseSyslogAddress splits a syslog sink address into the network and
+// address to dial
+func ParseSyslogAddress(address string) (network, addr string, err error) {
+	switch {
+	case strings.HasPrefix(address, "udp://"):
+		return "udp", strings.TrimPrefix(address, "udp://"), nil
+	case strings.HasPrefix(address, "tcp://"):
+		return "tcp", strings.TrimPrefix(address, "tcp://"), nil
+	case strings.HasPrefix(address, "/"):
+		return "unixgram", address, nil
+	}
+	return "", "", fmt.Errorf("syslog address %q must be udp://host:port, tcp://host:port or a socket path", address)
+}
+
+// syslogTimeout bounds connecting and writing to the syslog server, so a
+// stalled server delays log lines rather than blocking them for good
+const syslogTimeout = 5 * time.Second
+
+// syslogWriter sends log entries to a syslog server as RFC 5424 messages
+// whose MSG is the entry's JSON record. Over TCP, messages are framed by
+// octet counting (RFC 6587).
+type syslogWriter struct {
+	network  string
+	address  string
+	tag      string
+	hostname string
+	facility int
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogWriter(cfg SyslogConfig) (*syslogWriter, error) {
+	network, address, err := ParseSyslogAddress(cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+	facility, ok := ParseFacility(cfg.Facility)
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", cfg.Facility)
+	}
+	tag := cfg.Tag
+	if tag == "" {
+		tag = "groxpi"
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &syslogWriter{network: network, address: address, tag: tag, hostname: hostname, facility: facility}, nil
+}
+
+// severity maps a log level to a syslog severity
+func severity(level log.Level) int {
+	switch level {
+	case log.TraceLevel, log.DebugLevel:
+		return 7
+	case log.WarnLevel:
+		return 4
+	case log.ErrorLevel:
+		return 3
+	case log.FatalLevel:
+		return 2
+	case log.PanicLevel:
+		return 1
+	}
+	return 6
+}
+
+// format builds an RFC 5424 message:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (w *syslogWriter) format(level log.Level, now time.Time, record []byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte('<')
+	b.WriteString(strconv.Itoa(w.facility*8 + severity(level)))
+	b.WriteString(">1 ")
+	b.WriteString(now.Format("2006-01-02T15:04:05.000000Z07:00"))
+	b.WriteByte(' ')
+	b.WriteString(w.hostname)
+	b.WriteByte(' ')
+	b.WriteString(w.tag)
+	b.WriteByte(' ')
+	b.WriteString(strconv.Itoa(os.Getpid()))
+	b.WriteString(" - - ")
+	b.Write(bytes.TrimRight(record, "\n"))
+	if w.network != "tcp" {
+		return b.Bytes()
+	}
+	return append([]byte(strconv.Itoa(b.Len())+" "), b.Bytes()...)
+}
+
+// WriteEntry implements log.Writer, reconnecting once if the connection
+// was lost
+func (w *syslogWriter) WriteEntry(e *log.Entry) (int, error) {
+	msg := w.format(e.Level, time.Now(), e.Value())
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		if w.conn == nil {
+			conn, err := net.DialTimeout(w.network, w.address, syslogTimeout)
+			if err != nil {
+				return 0, err
+			}
+			w.conn = conn
+		}
+		_ = w.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+		n, err := w.conn.Write(msg)
+		if err == nil || attempt > 0 {
+			return n, err
+		}
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// Close closes the connection to the syslog server
+func (w *syslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
@@ -0,0 +1,114 @@
+package logger
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+func TestInit_Syslog(t *testing.T) {
+	original := log.DefaultLogger
+	defer func() { log.DefaultLogger = original }()
+	defer func() { _ = Close() }()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	Init(LogConfig{
+		Level:    "INFO",
+		Syslog:   SyslogConfig{Address: "udp://" + conn.LocalAddr().String(), Tag: "groxpi", Facility: "daemon"},
+		NoStdout: true,
+	})
+	Logger.Warn().Str("package", "numpy").Msg("to syslog")
+
+	buf := make([]byte, 4096)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Expected a syslog message: %v", err)
+	}
+	msg := string(buf[:n])
+
+	// daemon (3) * 8 + warning (4)
+	if !strings.HasPrefix(msg, "<28>1 ") {
+		t.Errorf("Expected an RFC 5424 header with priority 28, got %q", msg)
+	}
+	fields := strings.SplitN(msg, " ", 8)
+	if len(fields) != 8 || fields[3] != "groxpi" || fields[5] != "-" || fields[6] != "-" {
+		t.Fatalf("Expected HOSTNAME APP-NAME PROCID MSGID SD, got %q", msg)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, fields[1]); err != nil {
+		t.Errorf("Expected an RFC 3339 timestamp, got %q", fields[1])
+	}
+	if !strings.HasPrefix(fields[7], "{") || !strings.Contains(fields[7], `"package":"numpy"`) || strings.HasSuffix(fields[7], "\n") {
+		t.Errorf("Expected the JSON record as MSG, got %q", fields[7])
+	}
+}
+
+func TestSyslogWriter_TCPFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	w, err := newSyslogWriter(SyslogConfig{Address: "tcp://" + ln.Addr().String(), Facility: "local0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = w.Close() }()
+	logger := log.Logger{Level: log.InfoLevel, Writer: w}
+	logger.Info().Msg("first")
+	logger.Error().Msg("second")
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	for _, want := range []string{"<134>1 ", "<131>1 "} {
+		length, err := reader.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil {
+			t.Fatalf("Expected an octet count, got %q", length)
+		}
+		msg := make([]byte, size)
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(msg), want) {
+			t.Errorf("Expected a message starting with %q, got %q", want, msg)
+		}
+	}
+}
+
+func TestParseSyslogAddress(t *testing.T) {
+	tests := []struct {
+		address, network, addr string
+	}{
+		{"udp://logs:514", "udp", "logs:514"},
+		{"tcp://logs:601", "tcp", "logs:601"},
+		{"/dev/log", "unixgram", "/dev/log"},
+		{"logs:514", "", ""},
+	}
+	for _, tt := range tests {
+		network, addr, err := ParseSyslogAddress(tt.address)
+		if network != tt.network || addr != tt.addr || (err != nil) != (tt.network == "") {
+			t.Errorf("ParseSyslogAddress(%q) = %q, %q, %v", tt.address, network, addr, err)
+		}
+	}
+}
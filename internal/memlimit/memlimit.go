@@ -0,0 +1,156 @@
+// Package memlimit tunes the Go garbage collector for the memory groxpi is
+// given and sheds downloads before the heap outgrows it, so a burst of large
+// concurrent downloads on a small node ends in 503s rather than an OOM kill.
+package memlimit
+
+import (
+	"context"
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+// Apply sets the soft memory limit (bytes) and GC percentage when they are
+// configured. A limit <= 0 or a percentage of 0 leaves the runtime's setting,
+// which honours GOMEMLIMIT and GOGC; a negative percentage turns the
+// proportional collector off, leaving only the memory limit to trigger GC.
+func Apply(limit int64, gcPercent int) {
+	if limit > 0 {
+		debug.SetMemoryLimit(limit)
+	}
+	if gcPercent != 0 {
+		debug.SetGCPercent(gcPercent)
+	}
+	if limit > 0 || gcPercent != 0 {
+		log.Info().Int64("memory_limit", limit).Int("gc_percent", gcPercent).Msg("Garbage collector tuned")
+	}
+}
+
+// resumeRatio is the share of the threshold the heap must drop below before
+// shedding stops, so it doesn't flap around the threshold
+const resumeRatio = 0.9
+
+// heapMetric is the memory occupied by heap objects, live or not yet swept.
+// Unlike runtime.ReadMemStats it can be read without stopping the world.
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// Stats is the state of a Watchdog
+type Stats struct {
+	HeapBytes  uint64 `json:"heap_bytes"`
+	Threshold  uint64 `json:"threshold_bytes"`
+	Overloaded bool   `json:"overloaded"`
+	Shed       int64  `json:"shed"` // Requests rejected while overloaded
+}
+
+// Watchdog samples heap usage and reports overload once it crosses a
+// threshold, until it falls back below 90% of it. A nil watchdog is never
+// overloaded.
+type Watchdog struct {
+	threshold uint64
+	interval  time.Duration
+	sample    []metrics.Sample
+
+	heap       atomic.Uint64
+	overloaded atomic.Bool
+	shed       atomic.Int64
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewWatchdog creates a watchdog shedding above threshold bytes of heap,
+// sampled every interval. It returns nil when threshold <= 0.
+func NewWatchdog(threshold int64, interval time.Duration) *Watchdog {
+	if threshold <= 0 {
+		return nil
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &Watchdog{
+		threshold: uint64(threshold),
+		interval:  interval,
+		sample:    []metrics.Sample{{Name: heapMetric}},
+	}
+}
+
+// Start samples the heap in the background until Stop
+func (w *Watchdog) Start() {
+	if w == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	w.check()
+
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				w.check()
+			}
+		}
+	}()
+}
+
+// Stop ends sampling
+func (w *Watchdog) Stop() {
+	if w == nil || w.cancel == nil {
+		return
+	}
+	w.cancel()
+	<-w.done
+}
+
+// check samples the heap and updates the overload state
+func (w *Watchdog) check() {
+	metrics.Read(w.sample)
+	if w.sample[0].Value.Kind() != metrics.KindUint64 {
+		return
+	}
+	w.observe(w.sample[0].Value.Uint64())
+}
+
+func (w *Watchdog) observe(heap uint64) {
+	w.heap.Store(heap)
+	switch {
+	case heap >= w.threshold && !w.overloaded.Load():
+		w.overloaded.Store(true)
+		log.Warn().Uint64("heap_bytes", heap).Uint64("threshold_bytes", w.threshold).Msg("Heap over threshold, shedding downloads")
+	case heap < uint64(math.Round(float64(w.threshold)*resumeRatio)) && w.overloaded.Load():
+		w.overloaded.Store(false)
+		log.Info().Uint64("heap_bytes", heap).Msg("Heap back under threshold, accepting downloads")
+	}
+}
+
+// Shed reports whether a new download should be rejected, counting it if so
+func (w *Watchdog) Shed() bool {
+	if w == nil || !w.overloaded.Load() {
+		return false
+	}
+	w.shed.Add(1)
+	return true
+}
+
+// Stats reports the last heap sample and the shedding state
+func (w *Watchdog) Stats() Stats {
+	if w == nil {
+		return Stats{}
+	}
+	return Stats{
+		HeapBytes:  w.heap.Load(),
+		Threshold:  w.threshold,
+		Overloaded: w.overloaded.Load(),
+		Shed:       w.shed.Load(),
+	}
+}
@@ -0,0 +1,62 @@
+package memlimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatchdog_Hysteresis(t *testing.T) {
+	w := NewWatchdog(1000, time.Second)
+
+	w.observe(999)
+	if w.Shed() {
+		t.Error("Expected no shedding under the threshold")
+	}
+
+	w.observe(1000)
+	if !w.Shed() || !w.Shed() {
+		t.Error("Expected shedding at the threshold")
+	}
+
+	// Still shedding between 90% of the threshold and the threshold
+	w.observe(950)
+	if !w.Shed() {
+		t.Error("Expected shedding until the heap drops below 90% of the threshold")
+	}
+
+	w.observe(899)
+	if w.Shed() {
+		t.Error("Expected shedding to stop below 90% of the threshold")
+	}
+
+	stats := w.Stats()
+	if stats.Shed != 3 || stats.HeapBytes != 899 || stats.Threshold != 1000 || stats.Overloaded {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestWatchdog_Start(t *testing.T) {
+	// Any running program has more than a byte of heap
+	w := NewWatchdog(1, 10*time.Millisecond)
+	w.Start()
+	defer w.Stop()
+
+	if stats := w.Stats(); !stats.Overloaded || stats.HeapBytes == 0 {
+		t.Errorf("Expected the first sample to be taken on Start, got %+v", stats)
+	}
+}
+
+func TestWatchdog_Disabled(t *testing.T) {
+	w := NewWatchdog(0, time.Second)
+	if w != nil {
+		t.Fatal("Expected no watchdog without a threshold")
+	}
+	w.Start()
+	w.Stop()
+	if w.Shed() {
+		t.Error("A nil watchdog must never shed")
+	}
+	if stats := w.Stats(); stats != (Stats{}) {
+		t.Errorf("Expected zero stats, got %+v", stats)
+	}
+}
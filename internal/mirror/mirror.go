@@ -0,0 +1,396 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/phuslu/log"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
+	"github.com/huyhandes/groxpi/internal/jobs"
+	"github.com/huyhandes/groxpi/internal/pypi"
+	"github.com/huyhandes/groxpi/internal/storage"
+	"github.com/huyhandes/groxpi/internal/streaming"
+)
+
+const (
+	// stateKey is where the sync checkpoint is persisted for resuming
+	stateKey = "mirror/state.json"
+
+	// checkpointEvery controls how many packages are synced between checkpoints
+	checkpointEvery = 50
+
+	// fileTimeout bounds a single file download; mirrors fetch large wheels
+	// that the interactive download timeout would cut off
+	fileTimeout = 30 * time.Minute
+)
+
+// Index is the subset of the PyPI client used to walk the upstream index
+type Index interface {
+	GetPackageListContext(ctx context.Context) ([]string, error)
+	GetPackageFilesContext(ctx context.Context, packageName string) ([]pypi.FileInfo, error)
+}
+
+// Config configures the mirror
+type Config struct {
+	Packages []string      // Packages to mirror (empty = entire index)
+	Interval time.Duration // Delay between sync passes (0 = single pass)
+	Workers  int           // Concurrent file downloads per package
+
+	// Keys is the storage key layout the server reads cached files from
+	// (nil = storage.DefaultKeyTemplate)
+	Keys *storage.KeyLayout
+
+	// Jobs records each background pass as a "mirror" job so it can be
+	// inspected and canceled (nil = passes are not tracked)
+	Jobs *jobs.Manager
+}
+
+// JobKind identifies mirror passes in the job manager
+const JobKind = "mirror"
+
+// Status reports sync progress
+type Status struct {
+	Running         bool      `json:"running"`
+	PassStartedAt   time.Time `json:"pass_started_at,omitempty"`
+	LastCompletedAt time.Time `json:"last_completed_at,omitempty"`
+	ResumedFrom     string    `json:"resumed_from,omitempty"`
+	CurrentPackage  string    `json:"current_package,omitempty"`
+	PackagesTotal   int       `json:"packages_total"`
+	PackagesDone    int       `json:"packages_done"`
+	FilesDownloaded int64     `json:"files_downloaded"`
+	FilesSkipped    int64     `json:"files_skipped"`
+	FilesFailed     int64     `json:"files_failed"`
+	BytesDownloaded int64     `json:"bytes_downloaded"`
+	LastError       string    `json:"last_error,omitempty"`
+}
+
+// state is the persisted checkpoint. Cursor is the last package (in sorted
+// order) fully synced during the pass that started at StartedAt.
+type state struct {
+	StartedAt   time.Time `json:"started_at"`
+	Cursor      string    `json:"cursor"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+}
+
+// Mirror walks the upstream simple index and copies every file into storage,
+// turning the pull-through cache into a complete mirror
+type Mirror struct {
+	cfg        Config
+	index      Index
+	storage    storage.Storage
+	downloader streaming.StreamingDownloader
+
+	mu     sync.RWMutex
+	status Status
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a mirror. Files are written through downloader, which must
+// store under the same keys the server reads from.
+func New(cfg Config, index Index, store storage.Storage, downloader streaming.StreamingDownloader) *Mirror {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.Keys == nil {
+		cfg.Keys, _ = storage.NewKeyLayout(storage.DefaultKeyTemplate)
+	}
+
+	return &Mirror{
+		cfg:        cfg,
+		index:      index,
+		storage:    store,
+		downloader: downloader,
+	}
+}
+
+// Start runs sync passes in the background until Stop is called
+func (m *Mirror) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.done = make(chan struct{})
+
+	go func() {
+		defer close(m.done)
+
+		for {
+			if err := m.pass(ctx); err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Msg("Mirror sync pass failed")
+			}
+
+			if m.cfg.Interval <= 0 {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(m.cfg.Interval):
+			}
+		}
+	}()
+
+	log.Info().
+		Int("packages", len(m.cfg.Packages)).
+		Dur("interval", m.cfg.Interval).
+		Int("workers", m.cfg.Workers).
+		Msg("Mirror started")
+}
+
+// Stop cancels the running pass and waits for it to checkpoint and exit
+func (m *Mirror) Stop() {
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	<-m.done
+	log.Info().Msg("Mirror stopped")
+}
+
+// pass runs one background Sync, as a job when a job manager is configured.
+// Canceling the job only ends the current pass.
+func (m *Mirror) pass(ctx context.Context) error {
+	if m.cfg.Jobs == nil {
+		return m.Sync(ctx)
+	}
+
+	_, err := m.cfg.Jobs.Run(ctx, JobKind, func(ctx context.Context, p *jobs.Progress) (interface{}, error) {
+		p.Report(func() interface{} { return m.Status() })
+		return nil, m.Sync(ctx)
+	})
+	return err
+}
+
+// Status returns a snapshot of sync progress
+func (m *Mirror) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status
+}
+
+// Sync performs one pass over the configured packages. An interrupted pass is
+// resumed from its last checkpoint; files already in storage are skipped.
+func (m *Mirror) Sync(ctx context.Context) error {
+	packages, err := m.packages(ctx)
+	if err != nil {
+		m.setError(err)
+		return err
+	}
+
+	st := m.loadState(ctx)
+	start := 0
+	if st.CompletedAt.IsZero() && st.Cursor != "" {
+		// Resume the unfinished pass after the last checkpointed package
+		start = sort.SearchStrings(packages, st.Cursor)
+		if start < len(packages) && packages[start] == st.Cursor {
+			start++
+		}
+		log.Info().Str("cursor", st.Cursor).Int("remaining", len(packages)-start).Msg("Resuming mirror pass")
+	} else {
+		st = state{StartedAt: time.Now()}
+	}
+
+	m.mu.Lock()
+	m.status = Status{
+		Running:         true,
+		PassStartedAt:   st.StartedAt,
+		LastCompletedAt: m.status.LastCompletedAt,
+		ResumedFrom:     st.Cursor,
+		PackagesTotal:   len(packages),
+		PackagesDone:    start,
+	}
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		m.status.Running = false
+		m.status.CurrentPackage = ""
+		m.mu.Unlock()
+	}()
+
+	for i := start; i < len(packages); i++ {
+		if ctx.Err() != nil {
+			// Persist progress so the next start resumes here
+			m.saveState(context.Background(), st)
+			return ctx.Err()
+		}
+
+		pkg := packages[i]
+		m.mu.Lock()
+		m.status.CurrentPackage = pkg
+		m.mu.Unlock()
+
+		if err := m.syncPackage(ctx, pkg); err != nil {
+			if ctx.Err() != nil {
+				m.saveState(context.Background(), st)
+				return ctx.Err()
+			}
+			// A broken package should not stall the whole mirror
+			log.Warn().Err(err).Str("package", pkg).Msg("Failed to mirror package")
+			m.setError(fmt.Errorf("%s: %w", pkg, err))
+		}
+
+		st.Cursor = pkg
+		m.mu.Lock()
+		m.status.PackagesDone = i + 1
+		m.mu.Unlock()
+
+		if (i+1)%checkpointEvery == 0 {
+			m.saveState(ctx, st)
+			s := m.Status()
+			log.Info().
+				Int("done", s.PackagesDone).
+				Int("total", s.PackagesTotal).
+				Int64("downloaded", s.FilesDownloaded).
+				Int64("skipped", s.FilesSkipped).
+				Int64("failed", s.FilesFailed).
+				Msg("Mirror progress")
+		}
+	}
+
+	st.CompletedAt = time.Now()
+	m.saveState(ctx, st)
+
+	m.mu.Lock()
+	m.status.LastCompletedAt = st.CompletedAt
+	s := m.status
+	m.mu.Unlock()
+
+	log.Info().
+		Int("packages", s.PackagesTotal).
+		Int64("downloaded", s.FilesDownloaded).
+		Int64("skipped", s.FilesSkipped).
+		Int64("failed", s.FilesFailed).
+		Int64("bytes", s.BytesDownloaded).
+		Dur("duration", st.CompletedAt.Sub(st.StartedAt)).
+		Msg("Mirror pass completed")
+
+	return nil
+}
+
+// packages returns the sorted, normalized package names to mirror
+func (m *Mirror) packages(ctx context.Context) ([]string, error) {
+	names := m.cfg.Packages
+	if len(names) == 0 {
+		var err error
+		names, err = m.index.GetPackageListContext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch package list: %w", err)
+		}
+	}
+
+	seen := make(map[string]struct{}, len(names))
+	packages := make([]string, 0, len(names))
+	for _, name := range names {
+		norm := cachekey.Package(name)
+		if _, ok := seen[norm]; ok || norm == "" {
+			continue
+		}
+		seen[norm] = struct{}{}
+		packages = append(packages, norm)
+	}
+	sort.Strings(packages)
+	return packages, nil
+}
+
+// syncPackage downloads every file of pkg that is missing from storage
+func (m *Mirror) syncPackage(ctx context.Context, pkg string) error {
+	files, err := m.index.GetPackageFilesContext(ctx, pkg)
+	if err != nil {
+		return err
+	}
+
+	sem := semaphore.NewWeighted(int64(m.cfg.Workers))
+	var wg sync.WaitGroup
+	for _, file := range files {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func(file pypi.FileInfo) {
+			defer wg.Done()
+			defer sem.Release(1)
+			m.syncFile(ctx, pkg, file)
+		}(file)
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+func (m *Mirror) syncFile(ctx context.Context, pkg string, file pypi.FileInfo) {
+	key := m.cfg.Keys.Key(pkg, file.Name)
+
+	if exists, err := m.storage.Exists(ctx, key); err == nil && exists {
+		m.mu.Lock()
+		m.status.FilesSkipped++
+		m.mu.Unlock()
+		return
+	}
+
+	fileCtx, cancel := context.WithTimeout(storage.WithMetadata(ctx, file.StorageMetadata(time.Now())), fileTimeout)
+	defer cancel()
+
+	result, err := m.downloader.DownloadAndStream(fileCtx, file.URL, key, io.Discard)
+	if err == nil && result.Error != nil {
+		err = fmt.Errorf("failed to store %s: %w", key, result.Error)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		if ctx.Err() == nil {
+			m.status.FilesFailed++
+			m.status.LastError = err.Error()
+			log.Warn().Err(err).Str("key", key).Msg("Failed to mirror file")
+		}
+		return
+	}
+	m.status.FilesDownloaded++
+	m.status.BytesDownloaded += result.Size
+}
+
+func (m *Mirror) loadState(ctx context.Context) state {
+	var st state
+
+	reader, _, err := m.storage.Get(ctx, stateKey)
+	if err != nil {
+		return st
+	}
+	defer func() { _ = reader.Close() }()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return st
+	}
+	if err := sonic.Unmarshal(data, &st); err != nil {
+		log.Warn().Err(err).Msg("Ignoring corrupt mirror checkpoint")
+		return state{}
+	}
+	return st
+}
+
+func (m *Mirror) saveState(ctx context.Context, st state) {
+	data, err := sonic.Marshal(st)
+	if err != nil {
+		return
+	}
+	if _, err := m.storage.Put(ctx, stateKey, bytes.NewReader(data), int64(len(data)), "application/json"); err != nil {
+		log.Warn().Err(err).Msg("Failed to save mirror checkpoint")
+	}
+}
+
+func (m *Mirror) setError(err error) {
+	m.mu.Lock()
+	m.status.LastError = err.Error()
+	m.mu.Unlock()
+}
@@ -0,0 +1,171 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/pypi"
+	"github.com/huyhandes/groxpi/internal/storage"
+	"github.com/huyhandes/groxpi/internal/streaming"
+)
+
+// fakeIndex serves a fixed set of packages whose files point at baseURL
+type fakeIndex struct {
+	baseURL  string
+	packages map[string][]string
+
+	mu      sync.Mutex
+	fetched []string
+}
+
+func (f *fakeIndex) GetPackageListContext(ctx context.Context) ([]string, error) {
+	names := make([]string, 0, len(f.packages))
+	for name := range f.packages {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (f *fakeIndex) GetPackageFilesContext(ctx context.Context, packageName string) ([]pypi.FileInfo, error) {
+	f.mu.Lock()
+	f.fetched = append(f.fetched, packageName)
+	f.mu.Unlock()
+
+	filenames, ok := f.packages[packageName]
+	if !ok {
+		return nil, fmt.Errorf("package %s not found", packageName)
+	}
+
+	files := make([]pypi.FileInfo, 0, len(filenames))
+	for _, name := range filenames {
+		files = append(files, pypi.FileInfo{Name: name, URL: f.baseURL + "/files/" + name})
+	}
+	return files, nil
+}
+
+type storageAdapter struct {
+	storage storage.Storage
+}
+
+func (sa *storageAdapter) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	_, err := sa.storage.Put(ctx, key, reader, size, contentType)
+	return err
+}
+
+func newTestMirror(t *testing.T, cfg Config) (*Mirror, *fakeIndex, storage.Storage) {
+	t.Helper()
+
+	fileServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "contents of %s", r.URL.Path)
+	}))
+	t.Cleanup(fileServer.Close)
+
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	index := &fakeIndex{
+		baseURL: fileServer.URL,
+		packages: map[string][]string{
+			"numpy":    {"numpy-1.26.4.tar.gz", "numpy-1.26.4-cp312-cp312-linux_x86_64.whl"},
+			"requests": {"requests-2.31.0.tar.gz"},
+			"six":      {"six-1.16.0-py2.py3-none-any.whl"},
+		},
+	}
+
+	downloader := streaming.NewTeeStreamingDownloader(&storageAdapter{store}, nil)
+	return New(cfg, index, store, downloader), index, store
+}
+
+func TestMirror_SyncDownloadsAndSkips(t *testing.T) {
+	m, _, store := newTestMirror(t, Config{Workers: 2})
+	ctx := context.Background()
+
+	if err := m.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	status := m.Status()
+	if status.FilesDownloaded != 4 || status.FilesFailed != 0 {
+		t.Errorf("Expected 4 downloads and no failures, got %+v", status)
+	}
+	if status.PackagesDone != 3 || status.LastCompletedAt.IsZero() || status.Running {
+		t.Errorf("Unexpected status after pass: %+v", status)
+	}
+
+	exists, err := store.Exists(ctx, "packages/numpy/numpy-1.26.4.tar.gz")
+	if err != nil || !exists {
+		t.Errorf("Expected mirrored file in storage (exists=%v, err=%v)", exists, err)
+	}
+
+	// A second pass finds everything already present
+	if err := m.Sync(ctx); err != nil {
+		t.Fatalf("Second sync failed: %v", err)
+	}
+	if status := m.Status(); status.FilesDownloaded != 0 || status.FilesSkipped != 4 {
+		t.Errorf("Expected second pass to skip all 4 files, got %+v", status)
+	}
+}
+
+func TestMirror_SyncSubset(t *testing.T) {
+	m, index, _ := newTestMirror(t, Config{Packages: []string{"Six", "six"}})
+
+	if err := m.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	if len(index.fetched) != 1 || index.fetched[0] != "six" {
+		t.Errorf("Expected only six to be synced, got %v", index.fetched)
+	}
+}
+
+func TestMirror_ResumesFromCheckpoint(t *testing.T) {
+	m, index, _ := newTestMirror(t, Config{})
+	ctx := context.Background()
+
+	// Simulate a pass interrupted after numpy
+	m.saveState(ctx, state{StartedAt: time.Now().Add(-time.Hour), Cursor: "numpy"})
+
+	if err := m.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	if fmt.Sprint(index.fetched) != "[requests six]" {
+		t.Errorf("Expected resume after numpy, fetched %v", index.fetched)
+	}
+	if status := m.Status(); status.ResumedFrom != "numpy" || status.PackagesDone != 3 {
+		t.Errorf("Unexpected status after resume: %+v", status)
+	}
+
+	// The completed pass clears the resume point
+	index.fetched = nil
+	if err := m.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(index.fetched) != 3 {
+		t.Errorf("Expected a full pass after completion, fetched %v", index.fetched)
+	}
+}
+
+func TestMirror_CancelCheckpoints(t *testing.T) {
+	m, _, _ := newTestMirror(t, Config{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := m.Sync(ctx); err == nil {
+		t.Fatal("Expected cancelled sync to return an error")
+	}
+
+	st := m.loadState(context.Background())
+	if st.StartedAt.IsZero() || !st.CompletedAt.IsZero() {
+		t.Errorf("Expected an unfinished checkpoint, got %+v", st)
+	}
+}
@@ -0,0 +1,83 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ErrNotCached is returned by Fetch when no peer has the file
+var ErrNotCached = errors.New("no peer has the file cached")
+
+// FilePath is the path, below an index's base path, at which an instance
+// serves its cached copy of a package file to peers
+func FilePath(pkg, file string) string {
+	return "/peer/files/" + url.PathEscape(pkg) + "/" + url.PathEscape(file)
+}
+
+// Fetch asks every peer at once whether it has path cached and GETs it from
+// the first that does. The caller closes the response body and must check
+// the bytes, e.g. with storage.Verify: peers are only as trusted as the LAN.
+func (d *Discovery) Fetch(ctx context.Context, path string) (*http.Response, error) {
+	peers := d.Peers()
+	if len(peers) == 0 {
+		return nil, ErrNotCached
+	}
+
+	askCtx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+	found := make(chan string, len(peers))
+	for _, p := range peers {
+		go func(base string) {
+			if d.has(askCtx, base+path) {
+				found <- base
+			} else {
+				found <- ""
+			}
+		}(p.URL)
+	}
+
+	for range peers {
+		select {
+		case base := <-found:
+			if base != "" {
+				return d.get(ctx, base+path)
+			}
+		case <-askCtx.Done():
+			return nil, ErrNotCached
+		}
+	}
+	return nil, ErrNotCached
+}
+
+// has reports whether the peer file at rawURL exists
+func (d *Discovery) has(ctx context.Context, rawURL string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return false
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func (d *Discovery) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch from peer: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("peer answered %s", resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,344 @@
+// Package peer lets groxpi instances on a LAN find each other over mDNS and
+// share their caches, so a package one laptop in an office downloaded is
+// copied from it by the others rather than fetched upstream again.
+package peer
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phuslu/log"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// serviceName is the DNS-SD service groxpi instances advertise
+const serviceName = "_groxpi._tcp.local."
+
+// mdnsGroup is the IPv4 mDNS multicast address
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Config configures peer discovery
+type Config struct {
+	Instance  string            // Name this instance is advertised under (default: hostname and port)
+	Port      int               // Port peers reach this instance's HTTP listener on
+	Scheme    string            // "http" or "https"
+	Interval  time.Duration     // Time between browses for peers
+	Timeout   time.Duration     // How long a peer may take to answer
+	Transport http.RoundTripper // Used for requests to peers (nil = a transport bounded by Timeout)
+}
+
+// Peer is another groxpi instance found on the LAN
+type Peer struct {
+	Instance string    `json:"instance"`
+	URL      string    `json:"url"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Discovery advertises this instance over mDNS and keeps track of the other
+// groxpi instances answering on the LAN. A nil Discovery knows no peers.
+type Discovery struct {
+	cfg    Config
+	self   string // Advertised instance name, lower case
+	ttl    uint32 // Seconds peers keep this instance after an answer
+	client *http.Client
+
+	mu    sync.Mutex
+	peers map[string]Peer // By instance name
+
+	conn *net.UDPConn
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// New creates discovery for cfg; Start joins the LAN
+func New(cfg Config) *Discovery {
+	if cfg.Instance == "" {
+		host, _ := os.Hostname()
+		cfg.Instance = fmt.Sprintf("%s-%d", host, cfg.Port)
+	}
+	if cfg.Scheme == "" {
+		cfg.Scheme = "http"
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	if cfg.Transport == nil {
+		cfg.Transport = &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: cfg.Timeout}).DialContext,
+			TLSHandshakeTimeout:   cfg.Timeout,
+			ResponseHeaderTimeout: cfg.Timeout,
+			MaxIdleConnsPerHost:   4,
+			IdleConnTimeout:       90 * time.Second,
+		}
+	}
+
+	return &Discovery{
+		cfg:  cfg,
+		self: instanceLabel(cfg.Instance),
+		// Peers drop an instance that misses a couple of browses
+		ttl:    uint32(3 * cfg.Interval / time.Second),
+		client: &http.Client{Transport: cfg.Transport},
+		peers:  make(map[string]Peer),
+	}
+}
+
+// instanceLabel turns name into a single DNS label
+func instanceLabel(name string) string {
+	label := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(name))
+	if len(label) > 63 {
+		label = label[:63]
+	}
+	return label
+}
+
+// Start joins the mDNS group, announces this instance and browses for peers
+// every interval until Stop
+func (d *Discovery) Start() error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return fmt.Errorf("failed to join mDNS group: %w", err)
+	}
+	d.conn = conn
+	d.stop = make(chan struct{})
+
+	d.done.Add(2)
+	go func() {
+		defer d.done.Done()
+		d.listen()
+	}()
+	go func() {
+		defer d.done.Done()
+		d.browse()
+	}()
+
+	log.Info().
+		Str("instance", d.self).
+		Int("port", d.cfg.Port).
+		Msg("📡 Peer discovery started")
+	return nil
+}
+
+// Stop tells peers this instance is leaving and stops discovery
+func (d *Discovery) Stop() {
+	if d == nil || d.conn == nil {
+		return
+	}
+	close(d.stop)
+	if goodbye, err := d.announcement(0); err == nil {
+		_, _ = d.conn.WriteToUDP(goodbye, mdnsGroup)
+	}
+	_ = d.conn.Close()
+	d.done.Wait()
+}
+
+// Peers returns the peers currently known, by instance name
+func (d *Discovery) Peers() []Peer {
+	if d == nil {
+		return nil
+	}
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	peers := make([]Peer, 0, len(d.peers))
+	for name, p := range d.peers {
+		if now.After(p.Expires) {
+			delete(d.peers, name)
+			continue
+		}
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Instance < peers[j].Instance })
+	return peers
+}
+
+// listen answers queries for groxpi instances and records the answers of
+// peers
+func (d *Discovery) listen() {
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := d.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-d.stop:
+				return
+			default:
+			}
+			log.Debug().Err(err).Msg("Failed to read mDNS packet")
+			continue
+		}
+		if reply := d.handle(buf[:n], from.IP, time.Now()); reply != nil {
+			if _, err := d.conn.WriteToUDP(reply, mdnsGroup); err != nil {
+				log.Debug().Err(err).Msg("Failed to answer mDNS query")
+			}
+		}
+	}
+}
+
+// browse announces this instance and asks for peers, then asks again every
+// interval
+func (d *Discovery) browse() {
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	if announcement, err := d.announcement(d.ttl); err == nil {
+		_, _ = d.conn.WriteToUDP(announcement, mdnsGroup)
+	}
+	for {
+		if query, err := d.query(); err == nil {
+			if _, err := d.conn.WriteToUDP(query, mdnsGroup); err != nil {
+				log.Debug().Err(err).Msg("Failed to send mDNS query")
+			}
+		}
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// handle processes an mDNS packet sent from ip and returns the reply to
+// multicast, if any
+func (d *Discovery) handle(packet []byte, ip net.IP, now time.Time) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(packet)
+	if err != nil {
+		return nil
+	}
+
+	if !header.Response {
+		questions, err := p.AllQuestions()
+		if err != nil {
+			return nil
+		}
+		for _, q := range questions {
+			if (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL) && strings.EqualFold(q.Name.String(), serviceName) {
+				reply, err := d.announcement(d.ttl)
+				if err != nil {
+					return nil
+				}
+				return reply
+			}
+		}
+		return nil
+	}
+
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil
+	}
+	answers, err := p.AllAnswers()
+	if err != nil {
+		return nil
+	}
+	if err := p.SkipAllAuthorities(); err != nil {
+		return nil
+	}
+	additionals, _ := p.AllAdditionals()
+
+	// An instance is described by its SRV record, with its scheme in TXT
+	srvs := make(map[string]dnsmessage.Resource)
+	schemes := make(map[string]string)
+	for _, r := range append(answers, additionals...) {
+		instance, ok := strings.CutSuffix(strings.ToLower(r.Header.Name.String()), "."+serviceName)
+		if !ok || instance == d.self {
+			continue
+		}
+		switch body := r.Body.(type) {
+		case *dnsmessage.SRVResource:
+			srvs[instance] = r
+		case *dnsmessage.TXTResource:
+			for _, txt := range body.TXT {
+				if scheme, ok := strings.CutPrefix(txt, "scheme="); ok && (scheme == "http" || scheme == "https") {
+					schemes[instance] = scheme
+				}
+			}
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for instance, r := range srvs {
+		if r.Header.TTL == 0 {
+			delete(d.peers, instance) // Goodbye
+			continue
+		}
+		scheme := schemes[instance]
+		if scheme == "" {
+			scheme = "http"
+		}
+		port := r.Body.(*dnsmessage.SRVResource).Port
+		d.peers[instance] = Peer{
+			Instance: instance,
+			URL:      scheme + "://" + net.JoinHostPort(ip.String(), strconv.Itoa(int(port))),
+			Expires:  now.Add(time.Duration(r.Header.TTL) * time.Second),
+		}
+	}
+	return nil
+}
+
+// query builds a question for every groxpi instance on the LAN
+func (d *Discovery) query() ([]byte, error) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(serviceName),
+		Type:  dnsmessage.TypePTR,
+		Class: dnsmessage.ClassINET,
+	}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// announcement builds the records describing this instance, valid for ttl
+// seconds (0 = leaving)
+func (d *Discovery) announcement(ttl uint32) ([]byte, error) {
+	service := dnsmessage.MustNewName(serviceName)
+	instance, err := dnsmessage.NewName(d.self + "." + serviceName)
+	if err != nil {
+		return nil, err
+	}
+	target, err := dnsmessage.NewName(d.self + ".local.")
+	if err != nil {
+		return nil, err
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+	b.EnableCompression()
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	header := func(name dnsmessage.Name) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: ttl}
+	}
+	if err := b.PTRResource(header(service), dnsmessage.PTRResource{PTR: instance}); err != nil {
+		return nil, err
+	}
+	if err := b.SRVResource(header(instance), dnsmessage.SRVResource{Port: uint16(d.cfg.Port), Target: target}); err != nil {
+		return nil, err
+	}
+	if err := b.TXTResource(header(instance), dnsmessage.TXTResource{TXT: []string{"scheme=" + d.cfg.Scheme}}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
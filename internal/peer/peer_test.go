@@ -0,0 +1,207 @@
+package peer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/storage"
+	"github.com/huyhandes/groxpi/internal/testsupport"
+)
+
+var lanIP = net.IPv4(192, 168, 1, 20)
+
+func TestDiscovery_AnswersQueries(t *testing.T) {
+	d := New(Config{Instance: "Alice's Laptop", Port: 5000, Interval: 10 * time.Second})
+	if d.self != "alice-s-laptop" {
+		t.Errorf("Expected a DNS-safe instance name, got %q", d.self)
+	}
+
+	query, err := New(Config{Instance: "bob", Port: 5000}).query()
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	reply := d.handle(query, lanIP, time.Now())
+	if reply == nil {
+		t.Fatal("Expected a query for groxpi instances to be answered")
+	}
+
+	// The answer describes this instance to whoever asked
+	bob := New(Config{Instance: "bob", Port: 5000})
+	now := time.Now()
+	if bob.handle(reply, lanIP, now) != nil {
+		t.Error("Expected answers not to be answered")
+	}
+	peers := bob.Peers()
+	if len(peers) != 1 || peers[0].Instance != "alice-s-laptop" || peers[0].URL != "http://192.168.1.20:5000" {
+		t.Fatalf("Expected the answering instance as a peer, got %+v", peers)
+	}
+	if want := now.Add(30 * time.Second); !peers[0].Expires.Equal(want) {
+		t.Errorf("Expected the peer to expire after three intervals, got %v", peers[0].Expires.Sub(now))
+	}
+
+	// Other services' queries are ignored
+	if d.handle([]byte("not dns"), lanIP, time.Now()) != nil {
+		t.Error("Expected a malformed packet to be ignored")
+	}
+}
+
+func TestDiscovery_IgnoresItself(t *testing.T) {
+	d := New(Config{Instance: "alice", Port: 5000})
+	announcement, _ := d.announcement(d.ttl)
+	d.handle(announcement, lanIP, time.Now())
+	if peers := d.Peers(); len(peers) != 0 {
+		t.Errorf("Expected an instance not to list itself, got %+v", peers)
+	}
+}
+
+func TestDiscovery_PeersLeaveAndExpire(t *testing.T) {
+	alice := New(Config{Instance: "alice", Port: 8443, Scheme: "https"})
+	bob := New(Config{Instance: "bob", Port: 5000})
+
+	hello, _ := alice.announcement(alice.ttl)
+	bob.handle(hello, lanIP, time.Now())
+	if peers := bob.Peers(); len(peers) != 1 || peers[0].URL != "https://192.168.1.20:8443" {
+		t.Fatalf("Expected alice over https, got %+v", peers)
+	}
+
+	goodbye, _ := alice.announcement(0)
+	bob.handle(goodbye, lanIP, time.Now())
+	if peers := bob.Peers(); len(peers) != 0 {
+		t.Errorf("Expected a goodbye to remove the peer, got %+v", peers)
+	}
+
+	// Announced long ago, so already expired
+	bob.handle(hello, lanIP, time.Now().Add(-time.Hour))
+	if peers := bob.Peers(); len(peers) != 0 {
+		t.Errorf("Expected an expired peer to be dropped, got %+v", peers)
+	}
+}
+
+// addPeer makes d know a peer serving from server
+func addPeer(t *testing.T, d *Discovery, instance string, server *httptest.Server) {
+	t.Helper()
+	u, _ := url.Parse(server.URL)
+	host, portStr, _ := net.SplitHostPort(u.Host)
+	port, _ := strconv.Atoi(portStr)
+
+	announcement, err := New(Config{Instance: instance, Port: port}).announcement(60)
+	if err != nil {
+		t.Fatalf("announcement failed: %v", err)
+	}
+	d.handle(announcement, net.ParseIP(host), time.Now())
+}
+
+func TestDiscovery_Fetch(t *testing.T) {
+	path := FilePath("six", "six-1.16.0-py2.py3-none-any.whl")
+	if path != "/peer/files/six/six-1.16.0-py2.py3-none-any.whl" {
+		t.Errorf("Unexpected peer file path %q", path)
+	}
+
+	var gets atomic.Int64
+	empty := httptest.NewServer(http.NotFoundHandler())
+	defer empty.Close()
+	cached := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+			_, _ = io.WriteString(w, "six wheel")
+		}
+	}))
+	defer cached.Close()
+
+	d := New(Config{Instance: "me", Port: 5000})
+	if _, err := d.Fetch(context.Background(), path); !errors.Is(err, ErrNotCached) {
+		t.Errorf("Expected ErrNotCached without peers, got %v", err)
+	}
+
+	addPeer(t, d, "empty", empty)
+	addPeer(t, d, "cached", cached)
+	resp, err := d.Fetch(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != "six wheel" || gets.Load() != 1 {
+		t.Errorf("Expected the file from the peer that has it, got %q after %d GETs", body, gets.Load())
+	}
+
+	if _, err := d.Fetch(context.Background(), FilePath("six", "six-1.16.0.tar.gz")); !errors.Is(err, ErrNotCached) {
+		t.Errorf("Expected ErrNotCached when no peer has the file, got %v", err)
+	}
+}
+
+func TestDiscovery_FetchTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	d := New(Config{Instance: "me", Port: 5000, Timeout: 50 * time.Millisecond})
+	addPeer(t, d, "slow", slow)
+
+	start := time.Now()
+	if _, err := d.Fetch(context.Background(), "/peer/files/six/six.whl"); !errors.Is(err, ErrNotCached) {
+		t.Errorf("Expected ErrNotCached from a slow peer, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected a slow peer to be given up on, waited %v", elapsed)
+	}
+}
+
+func TestVerify_BadPeerNotStoredInS3(t *testing.T) {
+	minio := testsupport.StartMinIO(t)
+	store, err := storage.NewS3Storage(&storage.S3Config{
+		Endpoint:        minio.Endpoint,
+		AccessKeyID:     minio.AccessKey,
+		SecretAccessKey: minio.SecretKey,
+		Region:          minio.Region,
+		Bucket:          minio.Bucket,
+		Prefix:          minio.Prefix,
+		ForcePathStyle:  true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Storage failed: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	// Small enough for the upload to read exactly the announced length
+	sum := sha256.Sum256([]byte("six wheel"))
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "six whee!")
+	}))
+	defer bad.Close()
+
+	d := New(Config{Instance: "me", Port: 5000})
+	addPeer(t, d, "bad", bad)
+	ctx := context.Background()
+	resp, err := d.Fetch(ctx, FilePath("six", "six.whl"))
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	key := "packages/six/six.whl"
+	if _, err := store.Put(ctx, key, storage.Verify(resp.Body, resp.ContentLength, hex.EncodeToString(sum[:])), resp.ContentLength, ""); !errors.Is(err, storage.ErrDigestMismatch) {
+		t.Errorf("Expected the upload to fail with ErrDigestMismatch, got %v", err)
+	}
+	if exists, _ := store.Exists(ctx, key); exists {
+		t.Error("Expected the bad copy not stored")
+	}
+}
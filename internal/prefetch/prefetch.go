@@ -0,0 +1,290 @@
+// Package prefetch downloads the file a client is most likely to ask for
+// after listing a package, so the download that follows is a cache hit
+package prefetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/phuslu/log"
+
+	"github.com/huyhandes/groxpi/internal/distfile"
+	"github.com/huyhandes/groxpi/internal/pypi"
+	"github.com/huyhandes/groxpi/internal/storage"
+	"github.com/huyhandes/groxpi/internal/streaming"
+)
+
+// fileTimeout bounds a single prefetch, like the mirror's
+const fileTimeout = 30 * time.Minute
+
+// Config configures prefetching
+type Config struct {
+	// Platforms are the wheel platform tags worth prefetching, most
+	// preferred first ("any" matches pure wheels)
+	Platforms []string
+
+	// PythonTags narrow the wheels to these Python tags, most preferred
+	// first (empty = any)
+	PythonTags []string
+
+	Workers   int           // Concurrent prefetches
+	QueueSize int           // Pending prefetches; more are dropped
+	Cooldown  time.Duration // Delay before a package is considered again
+
+	// Keys is the storage key layout the server reads cached files from
+	// (nil = storage.DefaultKeyTemplate)
+	Keys *storage.KeyLayout
+
+	// Claim registers a prefetch with the server's download coordination,
+	// so a request for the file arriving meanwhile waits for it instead of
+	// downloading it again. It returns false when the file is already being
+	// downloaded, and otherwise a function to call with the outcome.
+	// (nil = no coordination)
+	Claim func(pkg, filename string) (func(error), bool)
+}
+
+// Stats counts prefetches
+type Stats struct {
+	Queued          int64 `json:"queued"`
+	Downloaded      int64 `json:"downloaded"`
+	Skipped         int64 `json:"skipped"` // Already in storage or being downloaded
+	Dropped         int64 `json:"dropped"` // Queue full
+	Failed          int64 `json:"failed"`
+	BytesDownloaded int64 `json:"bytes_downloaded"`
+}
+
+type request struct {
+	pkg  string
+	file pypi.FileInfo
+}
+
+// Prefetcher downloads files in the background. A nil prefetcher ignores
+// everything submitted to it.
+type Prefetcher struct {
+	cfg        Config
+	storage    storage.Storage
+	downloader streaming.StreamingDownloader
+	queue      chan request
+
+	mu     sync.Mutex
+	recent map[string]time.Time // Package -> when it was last considered
+
+	queued, downloaded, skipped, dropped, failed, bytes atomic.Int64
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a prefetcher. Files are written through downloader, which
+// must store under the same keys the server reads from.
+func New(cfg Config, store storage.Storage, downloader streaming.StreamingDownloader) *Prefetcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 2
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 100
+	}
+	if len(cfg.Platforms) == 0 {
+		cfg.Platforms = []string{"any"}
+	}
+	if cfg.Keys == nil {
+		cfg.Keys, _ = storage.NewKeyLayout(storage.DefaultKeyTemplate)
+	}
+
+	return &Prefetcher{
+		cfg:        cfg,
+		storage:    store,
+		downloader: downloader,
+		queue:      make(chan request, cfg.QueueSize),
+		recent:     make(map[string]time.Time),
+	}
+}
+
+// Start runs the prefetch workers until Stop
+func (p *Prefetcher) Start() {
+	if p == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	for i := 0; i < p.cfg.Workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case req := <-p.queue:
+					p.fetch(ctx, req)
+				}
+			}
+		}()
+	}
+
+	log.Info().
+		Strs("platforms", p.cfg.Platforms).
+		Strs("python_tags", p.cfg.PythonTags).
+		Int("workers", p.cfg.Workers).
+		Msg("Prefetching enabled")
+}
+
+// Stop cancels running prefetches and waits for the workers to exit
+func (p *Prefetcher) Stop() {
+	if p == nil || p.cancel == nil {
+		return
+	}
+	p.cancel()
+	p.wg.Wait()
+}
+
+// Submit queues the most likely download among pkg's files, unless pkg was
+// considered within the cooldown or no file matches. It never blocks.
+func (p *Prefetcher) Submit(pkg string, files []pypi.FileInfo) {
+	if p == nil || !p.consider(pkg) {
+		return
+	}
+
+	file, ok := Pick(files, p.cfg.Platforms, p.cfg.PythonTags)
+	if !ok {
+		return
+	}
+
+	select {
+	case p.queue <- request{pkg: pkg, file: file}:
+		p.queued.Add(1)
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+// consider reports whether pkg is out of its cooldown, starting a new one
+func (p *Prefetcher) consider(pkg string) bool {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if last, ok := p.recent[pkg]; ok && now.Sub(last) < p.cfg.Cooldown {
+		return false
+	}
+	p.recent[pkg] = now
+
+	// Forget packages out of their cooldown so the map stays small
+	if len(p.recent) > 10000 {
+		for name, last := range p.recent {
+			if now.Sub(last) >= p.cfg.Cooldown {
+				delete(p.recent, name)
+			}
+		}
+	}
+	return true
+}
+
+func (p *Prefetcher) fetch(ctx context.Context, req request) {
+	key := p.cfg.Keys.Key(req.pkg, req.file.Name)
+	if exists, err := p.storage.Exists(ctx, key); err == nil && exists {
+		p.skipped.Add(1)
+		return
+	}
+
+	done := func(error) {}
+	if p.cfg.Claim != nil {
+		var ok bool
+		if done, ok = p.cfg.Claim(req.pkg, req.file.Name); !ok {
+			p.skipped.Add(1)
+			return
+		}
+	}
+
+	fileCtx, cancel := context.WithTimeout(storage.WithMetadata(ctx, req.file.StorageMetadata(time.Now())), fileTimeout)
+	defer cancel()
+
+	result, err := p.downloader.DownloadAndStream(fileCtx, req.file.URL, key, io.Discard)
+	if err == nil && result.Error != nil {
+		err = fmt.Errorf("failed to store %s: %w", key, result.Error)
+	}
+	done(err)
+
+	if err != nil {
+		if ctx.Err() == nil {
+			p.failed.Add(1)
+			log.Warn().Err(err).Str("key", key).Msg("Failed to prefetch file")
+		}
+		return
+	}
+	p.downloaded.Add(1)
+	p.bytes.Add(result.Size)
+	log.Debug().Str("package", req.pkg).Str("file", req.file.Name).Int64("size", result.Size).Msg("Prefetched file")
+}
+
+// Stats reports prefetch counts
+func (p *Prefetcher) Stats() Stats {
+	if p == nil {
+		return Stats{}
+	}
+	return Stats{
+		Queued:          p.queued.Load(),
+		Downloaded:      p.downloaded.Load(),
+		Skipped:         p.skipped.Load(),
+		Dropped:         p.dropped.Load(),
+		Failed:          p.failed.Load(),
+		BytesDownloaded: p.bytes.Load(),
+	}
+}
+
+// Pick returns the wheel of the latest final release supporting one of
+// platforms (and one of pythonTags, when given), preferring the tags listed
+// first. Yanked files and pre-releases are skipped, as installers do.
+func Pick(files []pypi.FileInfo, platforms, pythonTags []string) (pypi.FileInfo, bool) {
+	var (
+		best                 pypi.FileInfo
+		bestVersion          string
+		bestPlatform, bestPy int
+		found                bool
+	)
+	for _, file := range files {
+		if file.IsYanked() {
+			continue
+		}
+		parsed, err := distfile.Parse(file.Name)
+		if err != nil || parsed.Kind != distfile.KindWheel || distfile.IsPrerelease(parsed.Version) {
+			continue
+		}
+
+		platform := rank(parsed.PlatformTags, platforms)
+		py := 0
+		if len(pythonTags) > 0 {
+			py = rank(parsed.PythonTags, pythonTags)
+		}
+		if platform < 0 || py < 0 {
+			continue
+		}
+
+		if found {
+			c := distfile.CompareVersions(parsed.Version, bestVersion)
+			if c < 0 || c == 0 && (platform > bestPlatform || platform == bestPlatform && py >= bestPy) {
+				continue
+			}
+		}
+		best, bestVersion, bestPlatform, bestPy, found = file, parsed.Version, platform, py, true
+	}
+	return best, found
+}
+
+// rank returns the position in preferred of the first tag found there, or
+// -1 if none is
+func rank(tags, preferred []string) int {
+	for i, want := range preferred {
+		for _, tag := range tags {
+			if tag == want {
+				return i
+			}
+		}
+	}
+	return -1
+}
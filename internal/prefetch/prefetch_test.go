@@ -0,0 +1,154 @@
+package prefetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/pypi"
+	"github.com/huyhandes/groxpi/internal/storage"
+	"github.com/huyhandes/groxpi/internal/streaming"
+)
+
+func files(names ...string) []pypi.FileInfo {
+	out := make([]pypi.FileInfo, 0, len(names))
+	for _, name := range names {
+		out = append(out, pypi.FileInfo{Name: name, URL: "https://files.example/" + name})
+	}
+	return out
+}
+
+func TestPick(t *testing.T) {
+	numpy := files(
+		"numpy-1.26.4.tar.gz",
+		"numpy-1.26.4-cp311-cp311-manylinux_2_17_x86_64.manylinux2014_x86_64.whl",
+		"numpy-1.26.4-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl",
+		"numpy-1.26.4-cp312-cp312-macosx_11_0_arm64.whl",
+		"numpy-2.0.0rc1-cp312-cp312-manylinux_2_17_x86_64.whl",
+		"numpy-1.25.2-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl",
+	)
+
+	tests := []struct {
+		name       string
+		files      []pypi.FileInfo
+		platforms  []string
+		pythonTags []string
+		want       string
+	}{
+		{
+			name:       "latest final release for the platform",
+			files:      numpy,
+			platforms:  []string{"manylinux2014_x86_64"},
+			pythonTags: []string{"cp312"},
+			want:       "numpy-1.26.4-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl",
+		},
+		{
+			name:       "platforms in order of preference",
+			files:      numpy,
+			platforms:  []string{"macosx_11_0_arm64", "manylinux2014_x86_64"},
+			pythonTags: []string{"cp312"},
+			want:       "numpy-1.26.4-cp312-cp312-macosx_11_0_arm64.whl",
+		},
+		{
+			name:      "first python tag wins without a filter",
+			files:     numpy,
+			platforms: []string{"manylinux2014_x86_64"},
+			want:      "numpy-1.26.4-cp311-cp311-manylinux_2_17_x86_64.manylinux2014_x86_64.whl",
+		},
+		{
+			name:      "pure wheels",
+			files:     files("six-1.15.0-py2.py3-none-any.whl", "six-1.16.0-py2.py3-none-any.whl", "six-1.16.0.tar.gz"),
+			platforms: []string{"any"},
+			want:      "six-1.16.0-py2.py3-none-any.whl",
+		},
+		{
+			name:      "no matching wheel",
+			files:     files("requests-2.31.0.tar.gz"),
+			platforms: []string{"any"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, ok := Pick(tt.files, tt.platforms, tt.pythonTags)
+			if ok != (tt.want != "") || file.Name != tt.want {
+				t.Errorf("Pick() = %q, %v; want %q", file.Name, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestPick_SkipsYanked(t *testing.T) {
+	six := files("six-1.15.0-py2.py3-none-any.whl", "six-1.16.0-py2.py3-none-any.whl")
+	six[1].Yanked = true
+
+	file, ok := Pick(six, []string{"any"}, nil)
+	if !ok || file.Name != "six-1.15.0-py2.py3-none-any.whl" {
+		t.Errorf("Expected the latest unyanked wheel, got %q", file.Name)
+	}
+}
+
+type storageAdapter struct {
+	storage storage.Storage
+}
+
+func (sa *storageAdapter) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	_, err := sa.storage.Put(ctx, key, reader, size, contentType)
+	return err
+}
+
+func TestPrefetcher_Submit(t *testing.T) {
+	var requests atomic.Int64
+	fileServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = fmt.Fprintf(w, "contents of %s", r.URL.Path)
+	}))
+	defer fileServer.Close()
+
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	var claimed atomic.Int64
+	p := New(Config{
+		Cooldown: time.Hour,
+		Claim: func(pkg, filename string) (func(error), bool) {
+			claimed.Add(1)
+			return func(error) {}, true
+		},
+	}, store, streaming.NewTeeStreamingDownloader(&storageAdapter{store}, nil))
+	p.Start()
+	defer p.Stop()
+
+	six := []pypi.FileInfo{{Name: "six-1.16.0-py2.py3-none-any.whl", URL: fileServer.URL + "/six.whl"}}
+	p.Submit("six", six)
+	p.Submit("six", six) // Within the cooldown
+
+	ctx := context.Background()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Stats().Downloaded == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if exists, _ := store.Exists(ctx, "packages/six/six-1.16.0-py2.py3-none-any.whl"); !exists {
+		t.Fatalf("Expected prefetched file in storage, stats %+v", p.Stats())
+	}
+	if stats := p.Stats(); stats.Queued != 1 || stats.Downloaded != 1 || requests.Load() != 1 || claimed.Load() != 1 {
+		t.Errorf("Expected one prefetch, got %+v after %d requests", stats, requests.Load())
+	}
+}
+
+func TestPrefetcher_Nil(t *testing.T) {
+	var p *Prefetcher
+	p.Start()
+	p.Submit("six", files("six-1.16.0-py2.py3-none-any.whl"))
+	p.Stop()
+	if p.Stats() != (Stats{}) {
+		t.Error("Expected empty stats from a nil prefetcher")
+	}
+}
@@ -3,24 +3,45 @@ package pypi
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bytedance/sonic"
+	"github.com/huyhandes/groxpi/internal/chaos"
 	"github.com/huyhandes/groxpi/internal/config"
-	"golang.org/x/sync/singleflight"
+	"github.com/huyhandes/groxpi/internal/flight"
+	"github.com/huyhandes/groxpi/internal/logger"
+	"github.com/huyhandes/groxpi/internal/storage"
+	"github.com/huyhandes/groxpi/internal/upstream"
 )
 
 type Client struct {
 	config     *config.Config
 	httpClient *http.Client
-	sf         singleflight.Group // For deduplicating concurrent requests
+	sf         *flight.Group    // For deduplicating concurrent requests
+	prober     *upstream.Prober // Picks the healthiest of the index and its mirrors (nil = index only)
+	quirks     Quirks           // Deviations from the simple API the index is known to have
+	userAgent  string
+
+	lastRequest atomic.Int64 // Unix nanoseconds of the last index request, for Keepalive
+
+	encodings     []string // Content encodings asked of the index (empty = identity)
+	encodingStats encodingStats
+
+	// Set after a 429/503 so requests fail fast instead of hammering upstream
+	backoffMu     sync.Mutex
+	backoffUntil  time.Time
+	backoffStatus int
 }
 
 type FileInfo struct {
@@ -32,6 +53,67 @@ type FileInfo struct {
 	UploadTime     string            `json:"upload-time,omitempty"`
 	Yanked         interface{}       `json:"yanked,omitempty"` // Can be bool or string
 	YankedReason   string            `json:"yanked-reason,omitempty"`
+	Provenance     string            `json:"provenance,omitempty"`    // PEP 740 attestation URL
+	CoreMetadata   interface{}       `json:"core-metadata,omitempty"` // PEP 714: bool or hashes
+
+	// Extra holds the fields of a PEP 691 file that are not decoded above,
+	// such as gpg-sig or ones added by newer standards, as upstream sent them
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// decodedFileFields are the PEP 691 file keys FileInfo decodes. The PEP
+// 658/714 metadata keys are listed under their old names too: groxpi does
+// not serve .metadata files, so announcing them would send installers to
+// files it can't provide.
+var decodedFileFields = map[string]bool{
+	"filename":                true,
+	"url":                     true,
+	"hashes":                  true,
+	"requires-python":         true,
+	"size":                    true,
+	"upload-time":             true,
+	"yanked":                  true,
+	"yanked-reason":           true,
+	"provenance":              true,
+	"core-metadata":           true,
+	"dist-info-metadata":      true,
+	"data-dist-info-metadata": true,
+}
+
+// UnmarshalJSON decodes a PEP 691 file, keeping the fields FileInfo has no
+// place for in Extra
+func (f *FileInfo) UnmarshalJSON(data []byte) error {
+	type fileInfo FileInfo // Without this method
+	if err := sonic.ConfigFastest.Unmarshal(data, (*fileInfo)(f)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := sonic.ConfigFastest.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for key, value := range fields {
+		if decodedFileFields[key] {
+			continue
+		}
+		if f.Extra == nil {
+			f.Extra = make(map[string]json.RawMessage)
+		}
+		// The response buffer is reused once parsed
+		f.Extra[strings.Clone(key)] = slices.Clone(value)
+	}
+	return nil
+}
+
+// Project is a package's detail page, including the PEP 700/708 fields when
+// upstream provides them
+type Project struct {
+	Name               string
+	APIVersion         string   // Upstream meta.api-version ("" if it served HTML without one)
+	Tracks             []string // PEP 708 meta.tracks
+	AlternateLocations []string // PEP 708 alternate-locations
+	Versions           []string // PEP 700 versions
+	Files              []FileInfo
 }
 
 // IsYanked returns true if the file is yanked
@@ -60,15 +142,50 @@ func (f *FileInfo) GetYankedReason() string {
 	return ""
 }
 
+// SHA256 returns the file's published SHA-256, if any. HTML pages carry it
+// in the URL fragment instead of a hashes field.
+func (f *FileInfo) SHA256() string {
+	if sha := f.Hashes["sha256"]; sha != "" {
+		return sha
+	}
+	_, fragment, _ := strings.Cut(f.URL, "#")
+	if sha, ok := strings.CutPrefix(fragment, "sha256="); ok {
+		return sha
+	}
+	return ""
+}
+
+// StorageMetadata returns the metadata to store with the cached file
+func (f *FileInfo) StorageMetadata(fetchedAt time.Time) map[string]string {
+	fileURL, _, _ := strings.Cut(f.URL, "#")
+	metadata := map[string]string{
+		storage.MetaUpstreamURL: fileURL,
+		storage.MetaFetchedAt:   fetchedAt.UTC().Format(time.RFC3339),
+	}
+	if sha := f.SHA256(); sha != "" {
+		metadata[storage.MetaSHA256] = sha
+	}
+	if f.UploadTime != "" {
+		metadata[storage.MetaUploadTime] = f.UploadTime
+	}
+	if f.RequiresPython != "" {
+		metadata[storage.MetaRequiresPython] = f.RequiresPython
+	}
+	return metadata
+}
+
 type PyPISimpleResponse struct {
 	Meta struct {
-		APIVersion string `json:"api-version"`
+		APIVersion string   `json:"api-version"`
+		Tracks     []string `json:"tracks,omitempty"`
 	} `json:"meta"`
 	Projects []struct {
 		Name string `json:"name"`
 	} `json:"projects,omitempty"`
-	Name  string     `json:"name,omitempty"`
-	Files []FileInfo `json:"files,omitempty"`
+	Name               string     `json:"name,omitempty"`
+	Versions           []string   `json:"versions,omitempty"`
+	AlternateLocations []string   `json:"alternate-locations,omitempty"`
+	Files              []FileInfo `json:"files,omitempty"`
 }
 
 // Buffer pool for reducing allocations
@@ -130,8 +247,13 @@ func NewClient(cfg *config.Config) *Client {
 		DisableCompression:    false, // Let transport handle compression
 	}
 
+	// Routed packages come from indexes with credentials of their own
+	auth := upstream.BasicAuth(transport, cfg.IndexURL, cfg.IndexUsername, cfg.IndexPassword)
+	for _, route := range cfg.IndexRoutes {
+		auth = upstream.BasicAuth(auth, route.IndexURL, route.Username, route.Password)
+	}
 	httpClient := &http.Client{
-		Transport: transport,
+		Transport: auth,
 		Timeout:   60 * time.Second, // Increased for large responses
 	}
 
@@ -142,16 +264,85 @@ func NewClient(cfg *config.Config) *Client {
 		}
 	}
 
+	// Unknown quirks and encodings are rejected when the server starts
+	quirks, _ := ParseQuirks(cfg.IndexQuirks)
+	encodings := DefaultEncodings
+	if len(cfg.IndexEncodings) > 0 {
+		encodings, _ = ParseEncodings(cfg.IndexEncodings)
+	}
+
 	return &Client{
 		config:     cfg,
 		httpClient: httpClient,
+		sf:         flight.NewGroup(cfg.MaxInFlightFetches),
+		quirks:     quirks,
+		userAgent:  cfg.UserAgent(),
+		encodings:  encodings,
 	}
 }
 
+// FlightStats reports request deduplication activity
+func (c *Client) FlightStats() flight.Stats {
+	return c.sf.Stats()
+}
+
+// UseChaos lets injector inject faults into the client's upstream
+// requests. Call it before the other Use methods so injected faults look
+// like upstream failures to them.
+func (c *Client) UseChaos(injector *chaos.Injector) {
+	c.httpClient.Transport = injector.Transport(chaos.Upstream, c.httpClient.Transport)
+}
+
+// UseLimiter routes the client's upstream requests through limiter so they
+// share its concurrency budget
+func (c *Client) UseLimiter(limiter *upstream.Limiter) {
+	c.httpClient.Transport = limiter.Transport(c.httpClient.Transport)
+}
+
+// UseTracer records the connection timings of the client's upstream
+// requests in tracer
+func (c *Client) UseTracer(tracer *upstream.Tracer) {
+	c.httpClient.Transport = tracer.Transport(c.httpClient.Transport)
+}
+
+// UseHealth reports the outcome of the client's upstream requests to health.
+// Call it before UseLimiter so requests that never got a slot don't count
+// as upstream failures.
+func (c *Client) UseHealth(health *upstream.Health) {
+	c.httpClient.Transport = health.Transport(c.httpClient.Transport)
+}
+
+// UseProber sends index requests to whichever of the index and its mirrors
+// prober currently prefers
+func (c *Client) UseProber(prober *upstream.Prober) {
+	c.prober = prober
+}
+
+// indexURL returns the index requests currently go to
+func (c *Client) indexURL() string {
+	return c.prober.Resolve(c.config.IndexURL)
+}
+
+// projectIndexURL returns the index packageName's page is fetched from: the
+// index of the first route matching it, or else the index requests currently
+// go to. A routed package is never looked up anywhere else, even when its
+// index doesn't have it.
+func (c *Client) projectIndexURL(packageName string) string {
+	if route, ok := c.config.RouteFor(packageName); ok {
+		return route.IndexURL
+	}
+	return c.indexURL()
+}
+
 func (c *Client) GetPackageList() ([]string, error) {
+	return c.GetPackageListContext(context.Background())
+}
+
+// GetPackageListContext fetches the package list, logging with the request ID in ctx
+func (c *Client) GetPackageListContext(ctx context.Context) ([]string, error) {
 	// Use singleflight to deduplicate concurrent requests
-	result, err, _ := c.sf.Do("package-list", func() (interface{}, error) {
-		return c.getPackageListInternal()
+	result, err, _ := c.sf.Do(flight.Key(c.config.IndexURL, "package-list", ""), func() (interface{}, error) {
+		return c.getPackageListInternal(ctx)
 	})
 
 	if err != nil {
@@ -161,11 +352,11 @@ func (c *Client) GetPackageList() ([]string, error) {
 	return result.([]string), nil
 }
 
-func (c *Client) getPackageListInternal() ([]string, error) {
-	url := strings.TrimSuffix(c.config.IndexURL, "/")
+func (c *Client) getPackageListInternal(ctx context.Context) ([]string, error) {
+	url := strings.TrimSuffix(c.indexURL(), "/")
 
 	// Try JSON first
-	resp, err := c.makeRequest(url, "application/vnd.pypi.simple.v1+json")
+	resp, err := c.makeRequest(ctx, url, c.quirks.accept())
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch package list: %w", err)
 	}
@@ -181,34 +372,48 @@ func (c *Client) getPackageListInternal() ([]string, error) {
 	}
 
 	// Check if response is JSON
-	contentType := resp.Header.Get("Content-Type")
-	if strings.Contains(contentType, "json") {
-		return c.parseJSONPackageList(resp.Body)
+	body := bufio.NewReaderSize(resp.Body, 64*1024)
+	if c.quirks.isJSON(resp.Header.Get("Content-Type"), body) {
+		return c.parseJSONPackageList(body)
 	}
 
 	// Fall back to HTML parsing
-	return c.parseHTMLPackageList(resp.Body)
+	return c.parseHTMLPackageList(body)
 }
 
 func (c *Client) GetPackageFiles(packageName string) ([]FileInfo, error) {
+	return c.GetPackageFilesContext(context.Background(), packageName)
+}
+
+// GetPackageFilesContext fetches a package's files, logging with the request ID in ctx
+func (c *Client) GetPackageFilesContext(ctx context.Context, packageName string) ([]FileInfo, error) {
+	project, err := c.GetProjectContext(ctx, packageName)
+	if err != nil {
+		return nil, err
+	}
+	return project.Files, nil
+}
+
+// GetProjectContext fetches a package's detail page, logging with the request ID in ctx
+func (c *Client) GetProjectContext(ctx context.Context, packageName string) (*Project, error) {
 	// Use singleflight to deduplicate concurrent requests for the same package
-	key := "package-files:" + packageName
+	key := flight.Key(c.config.IndexURL, "package-files", packageName)
 	result, err, _ := c.sf.Do(key, func() (interface{}, error) {
-		return c.getPackageFilesInternal(packageName)
+		return c.getProjectInternal(ctx, packageName)
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return result.([]FileInfo), nil
+	return result.(*Project), nil
 }
 
-func (c *Client) getPackageFilesInternal(packageName string) ([]FileInfo, error) {
-	url := strings.TrimSuffix(c.config.IndexURL, "/") + "/" + packageName + "/"
+func (c *Client) getProjectInternal(ctx context.Context, packageName string) (*Project, error) {
+	url := strings.TrimSuffix(c.projectIndexURL(packageName), "/") + "/" + packageName + "/"
 
 	// Try JSON first
-	resp, err := c.makeRequest(url, "application/vnd.pypi.simple.v1+json")
+	resp, err := c.makeRequest(ctx, url, c.quirks.accept())
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch package files for %s: %w", packageName, err)
 	}
@@ -228,46 +433,102 @@ func (c *Client) getPackageFilesInternal(packageName string) ([]FileInfo, error)
 	}
 
 	// Check if response is JSON
-	contentType := resp.Header.Get("Content-Type")
-	if strings.Contains(contentType, "json") {
-		return c.parseJSONPackageFiles(resp.Body)
+	var project *Project
+	body := bufio.NewReaderSize(resp.Body, 64*1024)
+	if c.quirks.isJSON(resp.Header.Get("Content-Type"), body) {
+		project, err = c.parseJSONProject(body)
+	} else {
+		// Fall back to HTML parsing
+		project, err = c.parseHTMLProject(body)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Fall back to HTML parsing
-	return c.parseHTMLPackageFiles(resp.Body)
+	// Redirects (devpi sends one for unnormalized names) move the page that
+	// relative links are resolved against
+	fixProject(project, packageName, resp.Request.URL.String())
+	return project, nil
 }
 
-func (c *Client) DownloadFile(url string, dest string) error {
-	resp, err := c.httpClient.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to download %s: %w", url, err)
+func (c *Client) makeRequest(ctx context.Context, url, accept string) (*http.Response, error) {
+	if err := c.checkBackoff(url); err != nil {
+		return nil, err
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			// Log error but don't fail the operation
-			_ = err
-		}
-	}()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP %d from %s", resp.StatusCode, url)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	// TODO: Implement actual file download to dest
-	// For now, this is a placeholder
-	return nil
-}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Accept-Encoding", acceptEncoding(c.encodings))
+	req.Header.Set("User-Agent", c.userAgent)
 
-func (c *Client) makeRequest(url, accept string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
+	// Forward the request ID so upstream indices (devpi, Artifactory) can correlate
+	if requestID := logger.RequestID(ctx); requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+
+	start := time.Now()
+	c.lastRequest.Store(start.UnixNano())
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		logger.FromContext(ctx).Debug().Err(err).Str("url", url).Dur("duration", time.Since(start)).Msg("Upstream index request failed")
 		return nil, err
 	}
 
-	req.Header.Set("Accept", accept)
-	req.Header.Set("User-Agent", "groxpi/1.0.0")
+	logger.FromContext(ctx).Debug().
+		Str("url", url).
+		Int("status", resp.StatusCode).
+		Str("encoding", resp.Header.Get("Content-Encoding")).
+		Dur("duration", time.Since(start)).
+		Msg("Upstream index request completed")
+
+	if err := c.decodeBody(resp); err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		_ = resp.Body.Close()
+		c.startBackoff(resp.StatusCode, retryAfter)
+
+		logger.FromContext(ctx).Warn().
+			Str("url", url).
+			Int("status", resp.StatusCode).
+			Dur("retry_after", retryAfter).
+			Msg("Upstream index throttled, backing off")
+
+		return nil, &ThrottledError{URL: url, StatusCode: resp.StatusCode, RetryAfter: retryAfter}
+	}
+
+	return resp, nil
+}
 
-	return c.httpClient.Do(req)
+// checkBackoff returns a ThrottledError while a previous 429/503 response
+// asked us to wait
+func (c *Client) checkBackoff(url string) error {
+	c.backoffMu.Lock()
+	defer c.backoffMu.Unlock()
+
+	if remaining := time.Until(c.backoffUntil); remaining > 0 {
+		return &ThrottledError{URL: url, StatusCode: c.backoffStatus, RetryAfter: remaining}
+	}
+	return nil
+}
+
+// startBackoff pauses upstream requests for d, never shortening a longer
+// backoff already in effect
+func (c *Client) startBackoff(status int, d time.Duration) {
+	c.backoffMu.Lock()
+	defer c.backoffMu.Unlock()
+
+	if until := time.Now().Add(d); until.After(c.backoffUntil) {
+		c.backoffUntil = until
+		c.backoffStatus = status
+	}
 }
 
 func (c *Client) parseJSONPackageList(body io.Reader) ([]string, error) {
@@ -295,7 +556,15 @@ func (c *Client) parseJSONPackageList(body io.Reader) ([]string, error) {
 }
 
 func (c *Client) parseJSONPackageFiles(body io.Reader) ([]FileInfo, error) {
-	var files []FileInfo
+	project, err := c.parseJSONProject(body)
+	if err != nil {
+		return nil, err
+	}
+	return project.Files, nil
+}
+
+func (c *Client) parseJSONProject(body io.Reader) (*Project, error) {
+	var project *Project
 
 	err := withBuffers(func(buf *bytes.Buffer) error {
 		// Use buffered reader for better performance
@@ -311,120 +580,16 @@ func (c *Client) parseJSONPackageFiles(body io.Reader) ([]FileInfo, error) {
 			return fmt.Errorf("failed to parse JSON response: %w", err)
 		}
 
-		files = response.Files
-		return nil
-	})
-
-	return files, err
-}
-
-func (c *Client) parseHTMLPackageList(body io.Reader) ([]string, error) {
-	var packages []string
-
-	err := withBuffers(func(buf *bytes.Buffer) error {
-		if err := copyToBuffer(buf, body); err != nil {
-			return err
-		}
-
-		html := buf.String()
-		packages = make([]string, 0, 1000)
-
-		// Simple HTML parsing for package list
-		lines := strings.Split(html, "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if !strings.HasPrefix(line, "<a ") {
-				continue
-			}
-
-			// Extract package name from anchor text
-			textStart := strings.Index(line, ">")
-			textEnd := strings.Index(line, "</a>")
-			if textStart == -1 || textEnd == -1 || textStart >= textEnd {
-				continue
-			}
-			packageName := line[textStart+1 : textEnd]
-			packages = append(packages, packageName)
+		project = &Project{
+			Name:               response.Name,
+			APIVersion:         response.Meta.APIVersion,
+			Tracks:             response.Meta.Tracks,
+			AlternateLocations: response.AlternateLocations,
+			Versions:           response.Versions,
+			Files:              response.Files,
 		}
-
-		return nil
-	})
-
-	return packages, err
-}
-
-func (c *Client) parseHTMLPackageFiles(body io.Reader) ([]FileInfo, error) {
-	var files []FileInfo
-
-	err := withBuffers(func(buf *bytes.Buffer) error {
-		if err := copyToBuffer(buf, body); err != nil {
-			return err
-		}
-
-		html := buf.String()
-		files = make([]FileInfo, 0, 50)
-
-		// Simple HTML parsing for package files
-		lines := strings.Split(html, "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if !strings.HasPrefix(line, "<a ") {
-				continue
-			}
-
-			// Extract href
-			hrefStart := strings.Index(line, `href="`)
-			if hrefStart == -1 {
-				continue
-			}
-			hrefStart += 6
-			hrefEnd := strings.Index(line[hrefStart:], `"`)
-			if hrefEnd == -1 {
-				continue
-			}
-			url := line[hrefStart : hrefStart+hrefEnd]
-
-			// Extract filename from anchor text
-			textStart := strings.Index(line, ">")
-			textEnd := strings.Index(line, "</a>")
-			if textStart == -1 || textEnd == -1 || textStart >= textEnd {
-				continue
-			}
-			filename := line[textStart+1 : textEnd]
-
-			// Extract data-requires-python if present
-			var requiresPython string
-			if rpStart := strings.Index(line, `data-requires-python="`); rpStart != -1 {
-				rpStart += 22
-				if rpEnd := strings.Index(line[rpStart:], `"`); rpEnd != -1 {
-					requiresPython = line[rpStart : rpStart+rpEnd]
-				}
-			}
-
-			// Extract data-yanked if present
-			var yanked interface{}
-			if yankStart := strings.Index(line, `data-yanked="`); yankStart != -1 {
-				yankStart += 13
-				if yankEnd := strings.Index(line[yankStart:], `"`); yankEnd != -1 {
-					yankedStr := line[yankStart : yankStart+yankEnd]
-					if yankedStr == "" {
-						yanked = true
-					} else {
-						yanked = yankedStr
-					}
-				}
-			}
-
-			files = append(files, FileInfo{
-				Name:           filename,
-				URL:            url,
-				RequiresPython: requiresPython,
-				Yanked:         yanked,
-			})
-		}
-
 		return nil
 	})
 
-	return files, err
+	return project, err
 }
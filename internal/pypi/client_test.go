@@ -1,8 +1,15 @@
 package pypi
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -10,6 +17,7 @@ import (
 	"time"
 
 	"github.com/huyhandes/groxpi/internal/config"
+	"github.com/huyhandes/groxpi/internal/version"
 )
 
 func TestNewClient(t *testing.T) {
@@ -53,8 +61,8 @@ func TestClient_MakeRequest(t *testing.T) {
 			t.Errorf("Expected Accept header to be 'application/vnd.pypi.simple.v1+json', got '%s'", r.Header.Get("Accept"))
 		}
 
-		if r.Header.Get("User-Agent") != "groxpi/1.0.0" {
-			t.Errorf("Expected User-Agent to be 'groxpi/1.0.0', got '%s'", r.Header.Get("User-Agent"))
+		if want := version.UserAgent("ops@example.com"); r.Header.Get("User-Agent") != want {
+			t.Errorf("Expected User-Agent to be '%s', got '%s'", want, r.Header.Get("User-Agent"))
 		}
 
 		w.Header().Set("Content-Type", "application/vnd.pypi.simple.v1+json")
@@ -63,10 +71,10 @@ func TestClient_MakeRequest(t *testing.T) {
 	}))
 	defer server.Close()
 
-	cfg := &config.Config{IndexURL: server.URL}
+	cfg := &config.Config{IndexURL: server.URL, UserAgentContact: "ops@example.com"}
 	client := NewClient(cfg)
 
-	resp, err := client.makeRequest(server.URL, "application/vnd.pypi.simple.v1+json")
+	resp, err := client.makeRequest(context.Background(), server.URL, "application/vnd.pypi.simple.v1+json")
 	if err != nil {
 		t.Fatalf("makeRequest failed: %v", err)
 	}
@@ -169,6 +177,85 @@ func TestClient_ParseJSONPackageFiles(t *testing.T) {
 	}
 }
 
+func TestClient_ParseJSONProject(t *testing.T) {
+	client := NewClient(&config.Config{})
+
+	jsonResponse := `{
+		"meta": {"api-version": "1.2", "tracks": ["https://pypi.org/simple/numpy/"]},
+		"name": "numpy",
+		"versions": ["1.21.0", "1.22.0"],
+		"alternate-locations": ["https://mirror.example.com/simple/numpy/"],
+		"files": [
+			{
+				"filename": "numpy-1.21.0.tar.gz",
+				"url": "https://files.pythonhosted.org/packages/.../numpy-1.21.0.tar.gz",
+				"size": 1024,
+				"upload-time": "2021-06-22T17:00:00.000000Z",
+				"provenance": "https://pypi.org/integrity/numpy/1.21.0/numpy-1.21.0.tar.gz/provenance",
+				"gpg-sig": true,
+				"core-metadata": {"sha256": "abc"},
+				"x-scan": {"status": "clean"}
+			}
+		]
+	}`
+
+	project, err := client.parseJSONProject(strings.NewReader(jsonResponse))
+	if err != nil {
+		t.Fatalf("parseJSONProject failed: %v", err)
+	}
+
+	if project.APIVersion != "1.2" {
+		t.Errorf("Expected api-version 1.2, got %q", project.APIVersion)
+	}
+	if len(project.Versions) != 2 || project.Versions[1] != "1.22.0" {
+		t.Errorf("Unexpected versions: %v", project.Versions)
+	}
+	if len(project.Tracks) != 1 || len(project.AlternateLocations) != 1 {
+		t.Errorf("Expected tracks and alternate-locations, got %v and %v", project.Tracks, project.AlternateLocations)
+	}
+	if len(project.Files) != 1 || project.Files[0].Size != 1024 || project.Files[0].Provenance == "" {
+		t.Errorf("Unexpected files: %+v", project.Files)
+	}
+	extra := project.Files[0].Extra
+	if len(extra) != 2 || string(extra["gpg-sig"]) != "true" || string(extra["x-scan"]) != `{"status": "clean"}` {
+		t.Errorf("Expected the undecoded fields to be kept as sent, got %v", extra)
+	}
+}
+
+func TestClient_ParseHTMLProject(t *testing.T) {
+	client := NewClient(&config.Config{})
+
+	htmlResponse := `<!DOCTYPE html>
+<html>
+<head>
+	<meta name="pypi:repository-version" content="1.2">
+	<meta name="pypi:tracks" content="https://pypi.org/simple/numpy/">
+	<meta name="pypi:alternate-locations" content="https://mirror.example.com/simple/numpy/">
+</head>
+<body>
+	<a href="https://files.pythonhosted.org/packages/.../numpy-1.21.0.tar.gz">numpy-1.21.0.tar.gz</a>
+</body>
+</html>`
+
+	project, err := client.parseHTMLProject(strings.NewReader(htmlResponse))
+	if err != nil {
+		t.Fatalf("parseHTMLProject failed: %v", err)
+	}
+
+	if project.APIVersion != "1.2" {
+		t.Errorf("Expected api-version 1.2, got %q", project.APIVersion)
+	}
+	if len(project.Tracks) != 1 || project.Tracks[0] != "https://pypi.org/simple/numpy/" {
+		t.Errorf("Unexpected tracks: %v", project.Tracks)
+	}
+	if len(project.AlternateLocations) != 1 {
+		t.Errorf("Unexpected alternate-locations: %v", project.AlternateLocations)
+	}
+	if len(project.Files) != 1 {
+		t.Errorf("Expected 1 file, got %d", len(project.Files))
+	}
+}
+
 func TestClient_GetPackageList(t *testing.T) {
 	// Create test server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -291,6 +378,59 @@ func TestClient_GetPackageList_HTTPError(t *testing.T) {
 	}
 }
 
+func TestClient_ThrottledBacksOff(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{IndexURL: server.URL}
+	client := NewClient(cfg)
+
+	_, err := client.GetPackageFiles("numpy")
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) {
+		t.Fatalf("Expected ThrottledError, got %v", err)
+	}
+	if throttled.StatusCode != http.StatusTooManyRequests || throttled.RetryAfter != 120*time.Second {
+		t.Errorf("Unexpected throttle details: %+v", throttled)
+	}
+
+	// While backing off, requests fail fast without reaching upstream
+	_, err = client.GetPackageList()
+	if !errors.As(err, &throttled) {
+		t.Fatalf("Expected ThrottledError during backoff, got %v", err)
+	}
+	if throttled.RetryAfter <= 0 || throttled.RetryAfter > 120*time.Second {
+		t.Errorf("Expected remaining backoff within 120s, got %v", throttled.RetryAfter)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("Expected 1 upstream request, got %d", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]time.Duration{
+		"":                              defaultRetryAfter,
+		"30":                            30 * time.Second,
+		"0":                             time.Second,
+		"86400":                         maxRetryAfter,
+		"Mon, 01 Jan 2024 12:01:00 GMT": time.Minute,
+		"garbage":                       defaultRetryAfter,
+	}
+
+	for value, want := range tests {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
 func TestClient_ParseJSONInvalidData(t *testing.T) {
 	cfg := &config.Config{}
 	client := NewClient(cfg)
@@ -332,10 +472,70 @@ func TestClient_DownloadFile(t *testing.T) {
 	cfg := &config.Config{}
 	client := NewClient(cfg)
 
-	err := client.DownloadFile(server.URL, "/tmp/test-file")
+	dest := filepath.Join(t.TempDir(), "test-file")
+	err := client.DownloadFile(server.URL, dest)
 	if err != nil {
 		t.Errorf("DownloadFile failed: %v", err)
 	}
+	if data, _ := os.ReadFile(dest); string(data) != "fake file content" {
+		t.Errorf("Expected the body in dest, got %q", data)
+	}
+}
+
+func TestClient_DownloadFileContext(t *testing.T) {
+	content := strings.Repeat("wheel bytes ", 1000)
+	sum := sha256.Sum256([]byte(content))
+	digest := hex.EncodeToString(sum[:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/truncated" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write([]byte(content[:100]))
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	client := NewClient(&config.Config{})
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "demo-1.0-py3-none-any.whl")
+
+	var calls int
+	var last int64
+	download, err := client.DownloadFileContext(context.Background(), server.URL+"/file", dest, DownloadOptions{
+		BufferSize:     512,
+		ExpectedSHA256: strings.ToUpper(digest),
+		Progress: func(written, total int64) {
+			calls++
+			last = written
+		},
+	})
+	if err != nil {
+		t.Fatalf("DownloadFileContext failed: %v", err)
+	}
+	if download.Size != int64(len(content)) || download.SHA256 != digest || download.ContentType != "application/zip" {
+		t.Errorf("Unexpected download %+v", download)
+	}
+	if calls < len(content)/512 || last != int64(len(content)) {
+		t.Errorf("Expected progress per buffer up to the full size, got %d calls ending at %d", calls, last)
+	}
+
+	// A digest mismatch or a short body leaves dest untouched and no temp
+	// files behind
+	_, err = client.DownloadFileContext(context.Background(), server.URL+"/file", filepath.Join(dir, "bad"), DownloadOptions{ExpectedSHA256: "00"})
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) || checksumErr.Actual != digest {
+		t.Errorf("Expected a checksum error, got %v", err)
+	}
+	if _, err := client.DownloadFileContext(context.Background(), server.URL+"/truncated", filepath.Join(dir, "short"), DownloadOptions{}); err == nil {
+		t.Error("Expected a truncated body to fail")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "demo-1.0-py3-none-any.whl" {
+		t.Errorf("Expected only the completed download, got %v", entries)
+	}
 }
 
 func TestClient_DownloadFile_HTTPError(t *testing.T) {
@@ -348,7 +548,7 @@ func TestClient_DownloadFile_HTTPError(t *testing.T) {
 	cfg := &config.Config{}
 	client := NewClient(cfg)
 
-	err := client.DownloadFile(server.URL, "/tmp/test-file")
+	err := client.DownloadFile(server.URL, filepath.Join(t.TempDir(), "test-file"))
 	if err == nil {
 		t.Error("Expected error for HTTP 404")
 	}
@@ -713,6 +913,49 @@ func TestFileInfo_GetYankedReason(t *testing.T) {
 	}
 }
 
+func TestFileInfo_StorageMetadata(t *testing.T) {
+	fetchedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("JSON file", func(t *testing.T) {
+		file := &FileInfo{
+			URL:            "https://files.example/numpy-1.26.4.tar.gz",
+			Hashes:         map[string]string{"sha256": "abc123"},
+			UploadTime:     "2024-02-05T21:00:00.000000Z",
+			RequiresPython: ">=3.9",
+		}
+		got := file.StorageMetadata(fetchedAt)
+		expected := map[string]string{
+			"upstream-url":    "https://files.example/numpy-1.26.4.tar.gz",
+			"sha256":          "abc123",
+			"upload-time":     "2024-02-05T21:00:00.000000Z",
+			"requires-python": ">=3.9",
+			"fetched-at":      "2024-03-01T12:00:00Z",
+		}
+		if len(got) != len(expected) {
+			t.Fatalf("Expected %v, got %v", expected, got)
+		}
+		for k, v := range expected {
+			if got[k] != v {
+				t.Errorf("%s = %q, expected %q", k, got[k], v)
+			}
+		}
+	})
+
+	t.Run("HTML file with hash fragment", func(t *testing.T) {
+		file := &FileInfo{URL: "https://files.example/numpy-1.26.4.tar.gz#sha256=def456"}
+		got := file.StorageMetadata(fetchedAt)
+		if got["upstream-url"] != "https://files.example/numpy-1.26.4.tar.gz" {
+			t.Errorf("Expected fragment stripped from URL, got %q", got["upstream-url"])
+		}
+		if got["sha256"] != "def456" {
+			t.Errorf("Expected sha256 from fragment, got %q", got["sha256"])
+		}
+		if _, ok := got["upload-time"]; ok {
+			t.Error("Expected no upload-time when upstream has none")
+		}
+	})
+}
+
 // TestClient_ParseHTMLPackageList tests HTML parsing fallback
 func TestClient_ParseHTMLPackageList(t *testing.T) {
 	client := &Client{}
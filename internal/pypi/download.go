@@ -0,0 +1,144 @@
+package pypi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/huyhandes/groxpi/internal/logger"
+)
+
+// defaultDownloadBufferSize is the copy buffer size when DownloadOptions
+// doesn't set one
+const defaultDownloadBufferSize = 32 * 1024
+
+// DownloadOptions tunes DownloadFileContext
+type DownloadOptions struct {
+	BufferSize     int                        // Copy buffer size (0 = 32 KiB)
+	ExpectedSHA256 string                     // Digest the file must have ("" = not checked)
+	Progress       func(written, total int64) // Called after each write; total is -1 when unknown
+}
+
+// Download describes a file DownloadFileContext wrote
+type Download struct {
+	Path        string
+	Size        int64
+	SHA256      string // Hex digest of what was written
+	ContentType string
+}
+
+// DownloadFile downloads url to dest
+func (c *Client) DownloadFile(url string, dest string) error {
+	_, err := c.DownloadFileContext(context.Background(), url, dest, DownloadOptions{})
+	return err
+}
+
+// DownloadFileContext downloads url to dest. The body is written to a temp
+// file next to dest, synced, checked against the expected digest and
+// length, and only then renamed over dest, so dest is never left partial.
+// Downloads are bounded by ctx rather than the client's index timeout.
+func (c *Client) DownloadFileContext(ctx context.Context, url, dest string, opts DownloadOptions) (*Download, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	if requestID := logger.RequestID(ctx); requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+
+	client := *c.httpClient
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d from %s", resp.StatusCode, url)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	bufferSize := opts.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultDownloadBufferSize
+	}
+	hasher := sha256.New()
+	out := &progressWriter{w: io.MultiWriter(tmp, hasher), total: resp.ContentLength, progress: opts.Progress}
+	// Hide any WriteTo on the body so copies use the configured buffer
+	written, err := io.CopyBuffer(out, struct{ io.Reader }{resp.Body}, make([]byte, bufferSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if resp.ContentLength >= 0 && written != resp.ContentLength {
+		return nil, fmt.Errorf("failed to download %s: got %d of %d bytes", url, written, resp.ContentLength)
+	}
+
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if opts.ExpectedSHA256 != "" && !strings.EqualFold(sum, opts.ExpectedSHA256) {
+		return nil, &ChecksumError{URL: url, Expected: strings.ToLower(opts.ExpectedSHA256), Actual: sum}
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return nil, fmt.Errorf("failed to move download to %s: %w", dest, err)
+	}
+	committed = true
+	syncDir(filepath.Dir(dest))
+
+	return &Download{
+		Path:        dest,
+		Size:        written,
+		SHA256:      sum,
+		ContentType: resp.Header.Get("Content-Type"),
+	}, nil
+}
+
+// progressWriter reports the running byte count after each write
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress func(written, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	if p.progress != nil && n > 0 {
+		p.progress(p.written, p.total)
+	}
+	return n, err
+}
+
+// syncDir makes a rename in dir durable. It is best effort: not every
+// platform can sync a directory.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
@@ -0,0 +1,174 @@
+package pypi
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Index pages are compressed on the wire with one of these
+const (
+	EncodingZstd     = "zstd"
+	EncodingGzip     = "gzip"
+	EncodingIdentity = "identity"
+)
+
+// DefaultEncodings are asked for when the configuration names none
+var DefaultEncodings = []string{EncodingZstd, EncodingGzip}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ParseEncodings validates the content encodings to ask the index for, in
+// order of preference. "identity" (or nothing) asks for uncompressed pages.
+func ParseEncodings(names []string) ([]string, error) {
+	var encodings []string
+	for _, name := range names {
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case "", EncodingIdentity:
+		case EncodingZstd, EncodingGzip:
+			encodings = append(encodings, name)
+		default:
+			return nil, fmt.Errorf("unknown index encoding %q (want zstd, gzip or identity)", name)
+		}
+	}
+	return encodings, nil
+}
+
+// acceptEncoding returns the Accept-Encoding header for index requests.
+// Setting it, even to identity, stops the transport from negotiating and
+// decoding gzip behind our back.
+func acceptEncoding(encodings []string) string {
+	if len(encodings) == 0 {
+		return EncodingIdentity
+	}
+	return strings.Join(encodings, ", ")
+}
+
+// EncodingStats counts index response bytes as received and as decoded
+type EncodingStats struct {
+	Responses    int64 `json:"responses"`
+	WireBytes    int64 `json:"wire_bytes"`
+	DecodedBytes int64 `json:"decoded_bytes"`
+}
+
+// encodingStats tracks EncodingStats per content encoding
+type encodingStats struct {
+	mu    sync.Mutex
+	stats map[string]*EncodingStats
+}
+
+func (s *encodingStats) add(encoding string, wire, decoded int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats == nil {
+		s.stats = make(map[string]*EncodingStats)
+	}
+	st := s.stats[encoding]
+	if st == nil {
+		st = &EncodingStats{}
+		s.stats[encoding] = st
+	}
+	st.Responses++
+	st.WireBytes += wire
+	st.DecodedBytes += decoded
+}
+
+func (s *encodingStats) snapshot() map[string]EncodingStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := make(map[string]EncodingStats, len(s.stats))
+	for encoding, st := range s.stats {
+		snapshot[encoding] = *st
+	}
+	return snapshot
+}
+
+// EncodingStats reports index response bytes by content encoding
+func (c *Client) EncodingStats() map[string]EncodingStats {
+	return c.encodingStats.snapshot()
+}
+
+// decodeBody replaces resp.Body with its decoded content, streaming. The
+// encoding is taken from the body's magic bytes rather than trusted from
+// Content-Encoding, since proxies in between are known to strip the header
+// from compressed bodies or keep it on bodies they already decoded.
+func (c *Client) decodeBody(resp *http.Response) error {
+	wire := &countingReader{r: resp.Body}
+	buffered := bufio.NewReader(wire)
+	magic, _ := buffered.Peek(len(zstdMagic))
+
+	var decoded io.Reader = buffered
+	var closeDecoder func()
+	encoding := EncodingIdentity
+	switch {
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(buffered, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("failed to decode zstd response: %w", err)
+		}
+		decoded, closeDecoder, encoding = decoder, decoder.Close, EncodingZstd
+	case bytes.HasPrefix(magic, gzipMagic):
+		decoder, err := gzip.NewReader(buffered)
+		if err != nil {
+			return fmt.Errorf("failed to decode gzip response: %w", err)
+		}
+		decoded, closeDecoder, encoding = decoder, func() { _ = decoder.Close() }, EncodingGzip
+	}
+
+	resp.Body = &decodedBody{
+		countingReader: countingReader{r: decoded},
+		wire:           wire,
+		raw:            resp.Body,
+		closeDecoder:   closeDecoder,
+		done:           func(wire, decoded int64) { c.encodingStats.add(encoding, wire, decoded) },
+	}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	return nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decodedBody is a decoded response body that records its wire and decoded
+// sizes when closed
+type decodedBody struct {
+	countingReader
+	wire         *countingReader
+	raw          io.Closer
+	closeDecoder func()
+	done         func(wire, decoded int64)
+	closed       bool
+}
+
+func (b *decodedBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	if b.closeDecoder != nil {
+		b.closeDecoder()
+	}
+	b.done(b.wire.n, b.n)
+	return b.raw.Close()
+}
@@ -0,0 +1,95 @@
+package pypi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/huyhandes/groxpi/internal/config"
+)
+
+func TestParseEncodings(t *testing.T) {
+	if encodings, err := ParseEncodings([]string{" ZSTD ", "gzip"}); err != nil || len(encodings) != 2 || encodings[0] != "zstd" {
+		t.Errorf("Expected zstd then gzip, got %v, %v", encodings, err)
+	}
+	if encodings, err := ParseEncodings([]string{"identity"}); err != nil || len(encodings) != 0 {
+		t.Errorf("Expected no encodings, got %v, %v", encodings, err)
+	}
+	if _, err := ParseEncodings([]string{"br"}); err == nil {
+		t.Error("Expected an unknown encoding to be rejected")
+	}
+}
+
+func TestClient_IndexEncodings(t *testing.T) {
+	page := `{"meta": {"api-version": "1.0"}, "name": "numpy", "files": [` +
+		strings.Repeat(`{"filename": "numpy-1.26.4.tar.gz", "url": "https://example.com/numpy-1.26.4.tar.gz"},`, 50) +
+		`{"filename": "numpy-1.26.4.tar.gz", "url": "https://example.com/numpy-1.26.4.tar.gz"}]}`
+
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, _ = gz.Write([]byte(page))
+	_ = gz.Close()
+	encoder, _ := zstd.NewWriter(nil)
+	zstded := encoder.EncodeAll([]byte(page), nil)
+
+	var accept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Type", "application/vnd.pypi.simple.v1+json")
+		switch r.URL.Path {
+		case "/stripped/numpy/":
+			// A proxy dropped Content-Encoding but kept the compressed body
+			_, _ = w.Write(gzipped.Bytes())
+		case "/stale/numpy/":
+			// A proxy decoded the body but kept Content-Encoding
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write([]byte(page))
+		default:
+			switch {
+			case strings.HasPrefix(accept, "zstd"):
+				w.Header().Set("Content-Encoding", "zstd")
+				_, _ = w.Write(zstded)
+			case strings.HasPrefix(accept, "gzip"):
+				w.Header().Set("Content-Encoding", "gzip")
+				_, _ = w.Write(gzipped.Bytes())
+			default:
+				_, _ = w.Write([]byte(page))
+			}
+		}
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		path      string
+		encodings []string
+		accept    string
+		encoding  string
+		wire      int
+	}{
+		{"/simple/", nil, "zstd, gzip", "zstd", len(zstded)},
+		{"/simple/", []string{"gzip"}, "gzip", "gzip", gzipped.Len()},
+		{"/simple/", []string{"identity"}, "identity", "identity", len(page)},
+		{"/stripped/", []string{"identity"}, "identity", "gzip", gzipped.Len()},
+		{"/stale/", []string{"gzip"}, "gzip", "identity", len(page)},
+	} {
+		client := NewClient(&config.Config{IndexURL: server.URL + tc.path, IndexEncodings: tc.encodings})
+		files, err := client.GetPackageFilesContext(context.Background(), "numpy")
+		if err != nil || len(files) != 51 {
+			t.Errorf("%s %v: expected 51 files, got %d, %v", tc.path, tc.encodings, len(files), err)
+			continue
+		}
+		if accept != tc.accept {
+			t.Errorf("%s %v: expected Accept-Encoding %q, got %q", tc.path, tc.encodings, tc.accept, accept)
+		}
+		stats := client.EncodingStats()[tc.encoding]
+		if stats.Responses != 1 || stats.WireBytes != int64(tc.wire) || stats.DecodedBytes != int64(len(page)) {
+			t.Errorf("%s %v: unexpected %s stats %+v", tc.path, tc.encodings, tc.encoding, client.EncodingStats())
+		}
+	}
+}
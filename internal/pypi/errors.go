@@ -0,0 +1,69 @@
+package pypi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultRetryAfter is used when a throttling response has no usable
+	// Retry-After header
+	defaultRetryAfter = 10 * time.Second
+
+	// maxRetryAfter caps how long a single response can pause upstream requests
+	maxRetryAfter = 10 * time.Minute
+)
+
+// ThrottledError is returned when the upstream index answered 429 or 503, or
+// while the client is still backing off after such a response
+type ThrottledError struct {
+	URL        string
+	StatusCode int
+	RetryAfter time.Duration // Remaining time until upstream may be retried
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("upstream throttled (HTTP %d from %s), retry after %s",
+		e.StatusCode, e.URL, e.RetryAfter.Round(time.Second))
+}
+
+// ChecksumError is returned when a downloaded file doesn't have the digest
+// the index published for it
+type ChecksumError struct {
+	URL      string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("sha256 mismatch for %s: expected %s, got %s", e.URL, e.Expected, e.Actual)
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as
+// an HTTP date, falling back to defaultRetryAfter
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultRetryAfter
+	}
+
+	var d time.Duration
+	if secs, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = t.Sub(now)
+	} else {
+		return defaultRetryAfter
+	}
+
+	if d <= 0 {
+		return time.Second
+	}
+	if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
+}
@@ -0,0 +1,60 @@
+package pypi
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/huyhandes/groxpi/internal/distfile"
+)
+
+// FileVersion extracts the version from a wheel, sdist or egg filename
+func FileVersion(filename string) string {
+	f, err := distfile.Parse(filename)
+	if err != nil {
+		return ""
+	}
+	return f.Version
+}
+
+// FilePackage extracts the project name from a wheel, sdist or egg filename
+func FilePackage(filename string) string {
+	f, err := distfile.Parse(filename)
+	if err != nil {
+		return ""
+	}
+	return f.Name
+}
+
+// EscapeFileName escapes a file name as one URL path segment. The '+' of a
+// PEP 440 local version (torch-2.0.0+cpu) is escaped too, though paths may
+// hold it: hosts backed by S3 read a bare '+' as a space. pip escapes it
+// the same way.
+func EscapeFileName(name string) string {
+	return strings.ReplaceAll(url.PathEscape(name), "+", "%2B")
+}
+
+// UnescapeFileName decodes a file name an index listed percent-encoded, as
+// some write link text the way they write hrefs. File names never contain
+// '%' themselves, so a name that doesn't decode is kept as it is.
+func UnescapeFileName(name string) string {
+	if !strings.Contains(name, "%") {
+		return name
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil && !strings.ContainsAny(unescaped, `/\`) {
+		return unescaped
+	}
+	return name
+}
+
+// EscapeFileURL escapes the file name ending a URL's path like
+// EscapeFileName, so a file with a local version reaches S3-backed hosts
+// intact. The rest of the path is left as it is: devpi serves files under
+// /+f/.
+func EscapeFileURL(u *url.URL) {
+	escaped := u.EscapedPath()
+	dir := escaped[:strings.LastIndex(escaped, "/")+1]
+	if name := path.Base(u.Path); strings.Contains(name, "+") {
+		u.RawPath = dir + EscapeFileName(name)
+	}
+}
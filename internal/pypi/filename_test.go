@@ -0,0 +1,82 @@
+package pypi
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestFileVersion(t *testing.T) {
+	tests := map[string]string{
+		"numpy-1.26.4-cp312-cp312-manylinux_2_17_x86_64.whl": "1.26.4",
+		"requests-2.31.0.tar.gz":                             "2.31.0",
+		"python-dateutil-2.8.2.tar.gz":                       "2.8.2",
+		"pytz-2024.1.zip":                                    "2024.1",
+		"README.txt":                                         "",
+	}
+
+	for filename, want := range tests {
+		if got := FileVersion(filename); got != want {
+			t.Errorf("FileVersion(%q) = %q, want %q", filename, got, want)
+		}
+	}
+}
+
+func TestFilePackage(t *testing.T) {
+	tests := map[string]string{
+		"numpy-1.26.4-cp312-cp312-manylinux_2_17_x86_64.whl": "numpy",
+		"numpy-1.26.4.tar.gz":                                "numpy",
+		"zope.interface-6.0.zip":                             "zope.interface",
+		"legacy-name-1.0.tar.gz":                             "legacy-name",
+		"README.md":                                          "",
+		"..":                                                 "",
+	}
+
+	for filename, want := range tests {
+		if got := FilePackage(filename); got != want {
+			t.Errorf("FilePackage(%q) = %q, want %q", filename, got, want)
+		}
+	}
+}
+
+func TestEscapeFileName(t *testing.T) {
+	tests := map[string]string{
+		"torch-2.0.0+cpu-cp311-cp311-linux_x86_64.whl":                      "torch-2.0.0%2Bcpu-cp311-cp311-linux_x86_64.whl",
+		"jaxlib-0.4.13+cuda12.cudnn89-cp311-cp311-manylinux2014_x86_64.whl": "jaxlib-0.4.13%2Bcuda12.cudnn89-cp311-cp311-manylinux2014_x86_64.whl",
+		"numpy-1.26.4.tar.gz": "numpy-1.26.4.tar.gz",
+	}
+
+	for name, want := range tests {
+		if got := EscapeFileName(name); got != want {
+			t.Errorf("EscapeFileName(%q) = %q, want %q", name, got, want)
+		}
+		if got := UnescapeFileName(want); got != name {
+			t.Errorf("UnescapeFileName(%q) = %q, want %q", want, got, name)
+		}
+	}
+
+	for _, name := range []string{"torch-2.0.0+cpu.whl", "odd%zz.tar.gz", "..%2Fetc%2Fpasswd"} {
+		if got := UnescapeFileName(name); got != name {
+			t.Errorf("UnescapeFileName(%q) = %q, want it unchanged", name, got)
+		}
+	}
+}
+
+func TestEscapeFileURL(t *testing.T) {
+	tests := map[string]string{
+		"https://download.pytorch.org/whl/cpu/torch-2.0.0+cpu-cp311-cp311-linux_x86_64.whl":   "https://download.pytorch.org/whl/cpu/torch-2.0.0%2Bcpu-cp311-cp311-linux_x86_64.whl",
+		"https://download.pytorch.org/whl/cpu/torch-2.0.0%2Bcpu-cp311-cp311-linux_x86_64.whl": "https://download.pytorch.org/whl/cpu/torch-2.0.0%2Bcpu-cp311-cp311-linux_x86_64.whl",
+		"https://devpi.example/root/pypi/+f/3a1/b2c/torch-2.0.0+cpu.whl#sha256=ab":            "https://devpi.example/root/pypi/+f/3a1/b2c/torch-2.0.0%2Bcpu.whl#sha256=ab",
+		"https://devpi.example/root/pypi/+f/3a1/b2c/numpy-1.26.4.tar.gz":                      "https://devpi.example/root/pypi/+f/3a1/b2c/numpy-1.26.4.tar.gz",
+	}
+
+	for raw, want := range tests {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", raw, err)
+		}
+		EscapeFileURL(u)
+		if got := u.String(); got != want {
+			t.Errorf("EscapeFileURL(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
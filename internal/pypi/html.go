@@ -0,0 +1,195 @@
+package pypi
+
+import (
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlLink is an <a> tag on a simple API page
+type htmlLink struct {
+	attrs map[string]string // Lower-case names, decoded values
+	text  string            // Decoded text with whitespace collapsed
+}
+
+// scanHTML tokenizes a simple API page, returning its links and passing the
+// attributes of each <meta> tag to meta (if not nil). The tokenizer copes
+// with what real index pages do: upper-case tags, links wrapped across
+// lines or several on one line, unquoted or valueless attributes, unclosed
+// tags and character references.
+func scanHTML(body io.Reader, meta func(attrs map[string]string)) ([]htmlLink, error) {
+	z := html.NewTokenizer(body)
+
+	var links []htmlLink
+	var link *htmlLink
+	var text strings.Builder
+	finish := func() {
+		if link != nil {
+			link.text = strings.Join(strings.Fields(text.String()), " ")
+			links = append(links, *link)
+			link = nil
+		}
+		text.Reset()
+	}
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			finish()
+			return links, nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.A:
+				// An unclosed link ends where the next one starts
+				finish()
+				link = &htmlLink{attrs: tagAttrs(z, hasAttr)}
+			case atom.Meta:
+				if meta != nil {
+					meta(tagAttrs(z, hasAttr))
+				}
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); atom.Lookup(name) == atom.A {
+				finish()
+			}
+		case html.TextToken:
+			if link != nil {
+				text.Write(z.Text())
+			}
+		}
+	}
+}
+
+// tagAttrs collects the attributes of the current tag. A repeated attribute
+// keeps its first value, as browsers do.
+func tagAttrs(z *html.Tokenizer, hasAttr bool) map[string]string {
+	attrs := make(map[string]string)
+	for hasAttr {
+		var key, value []byte
+		key, value, hasAttr = z.TagAttr()
+		if _, ok := attrs[string(key)]; !ok {
+			attrs[string(key)] = string(value)
+		}
+	}
+	return attrs
+}
+
+func (c *Client) parseHTMLPackageList(body io.Reader) ([]string, error) {
+	links, err := scanHTML(body, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	packages := make([]string, 0, len(links))
+	for _, link := range links {
+		if link.text != "" {
+			packages = append(packages, link.text)
+		}
+	}
+	return packages, nil
+}
+
+// parseHTMLProject parses a PEP 503 detail page along with the PEP 629/708
+// <meta> tags (pypi:repository-version, pypi:tracks, pypi:alternate-locations)
+func (c *Client) parseHTMLProject(body io.Reader) (*Project, error) {
+	project := &Project{}
+	links, err := scanHTML(body, func(attrs map[string]string) {
+		content := attrs["content"]
+		switch attrs["name"] {
+		case "pypi:repository-version":
+			project.APIVersion = content
+		case "pypi:tracks":
+			project.Tracks = append(project.Tracks, content)
+		case "pypi:alternate-locations":
+			project.AlternateLocations = append(project.AlternateLocations, content)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	project.Files = htmlFiles(links)
+	return project, nil
+}
+
+func (c *Client) parseHTMLPackageFiles(body io.Reader) ([]FileInfo, error) {
+	links, err := scanHTML(body, nil)
+	if err != nil {
+		return nil, err
+	}
+	return htmlFiles(links), nil
+}
+
+// htmlFiles turns a detail page's links into files, with the PEP
+// 503/592/714/740 data attributes. Links without an href are skipped, links
+// without text are named after their URL, and text prefixed with an index
+// path (devpi writes "root/pypi/<file>") is cut down to the file name.
+// Percent-encoded text is decoded, like the URL.
+func htmlFiles(links []htmlLink) []FileInfo {
+	files := make([]FileInfo, 0, len(links))
+	for _, link := range links {
+		href, ok := link.attrs["href"]
+		if !ok || href == "" {
+			continue
+		}
+		name := UnescapeFileName(path.Base(link.text))
+		if link.text == "" {
+			name = linkFileName(href)
+		}
+		if name == "" {
+			continue
+		}
+
+		file := FileInfo{
+			Name:           name,
+			URL:            href,
+			RequiresPython: link.attrs["data-requires-python"],
+			Provenance:     link.attrs["data-provenance"], // PEP 740
+		}
+		// data-yanked may be valueless; its value is the reason
+		if reason, ok := link.attrs["data-yanked"]; ok {
+			if reason == "" {
+				file.Yanked = true
+			} else {
+				file.Yanked = reason
+			}
+		}
+		// PEP 714 renamed data-dist-info-metadata, which older indexes still send
+		if value, ok := link.attrs["data-core-metadata"]; ok {
+			file.CoreMetadata = coreMetadata(value)
+		} else if value, ok := link.attrs["data-dist-info-metadata"]; ok {
+			file.CoreMetadata = coreMetadata(value)
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// linkFileName returns the last path segment of a file URL
+func linkFileName(href string) string {
+	u, err := url.Parse(href)
+	if err != nil || u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		return ""
+	}
+	return path.Base(u.Path)
+}
+
+// coreMetadata converts a data-core-metadata value to its JSON form: the
+// hashes for "<hashname>=<hashvalue>", nil for "false", else true
+func coreMetadata(value string) interface{} {
+	if strings.EqualFold(value, "false") {
+		return nil
+	}
+	if name, hash, ok := strings.Cut(value, "="); ok && name != "" && hash != "" {
+		return map[string]interface{}{strings.ToLower(name): hash}
+	}
+	return true
+}
@@ -0,0 +1,185 @@
+package pypi
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func openFixture(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "html", name))
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+// TestParseHTMLProject_Corpus parses detail pages as served by the index
+// servers found in the wild
+func TestParseHTMLProject_Corpus(t *testing.T) {
+	client := &Client{}
+
+	testCases := []struct {
+		fixture    string
+		apiVersion string
+		files      []FileInfo
+	}{
+		{
+			fixture:    "pypi-numpy.html",
+			apiVersion: "1.3",
+			files: []FileInfo{
+				{
+					Name:           "numpy-1.26.4.tar.gz",
+					URL:            "https://files.pythonhosted.org/packages/65/6e/09db70a523a96d25e115e71cc56a6f9031e7b8cd166c1ac8438307c14058/numpy-1.26.4.tar.gz#sha256=2a02aba9ed12e4ac4eb3ea9421c420301a0c6460d9830d74a9df87efa4912010",
+					RequiresPython: ">=3.9",
+					CoreMetadata:   map[string]interface{}{"sha256": "8ec1ee6e7ac4ffcd5e7a2f0cd7a1ab0a0e0e8b3b2d0b8d4bfee7a0d0a3f5e6c1"},
+				},
+				{
+					Name:           "numpy-1.26.4-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl",
+					URL:            "https://files.pythonhosted.org/packages/3a/d0/edc009c27b406c4f9cbc79274d6e46d634d139075492ad055e3d68445925/numpy-1.26.4-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl#sha256=f870204a840a60da0b12273ef34f7051e98c3b5961b61b0c2c1be6dfd64fbcd3",
+					RequiresPython: ">=3.9",
+					CoreMetadata:   true,
+				},
+				{
+					Name:           "numpy-1.25.0.tar.gz",
+					URL:            "https://files.pythonhosted.org/packages/8b/1f/a7e1ad5c64a3f4ec9e5d4e7c1e3ae8ef0f6c0f1b4e1c0f4d0ed6c5b8d0a6e1/numpy-1.25.0.tar.gz#sha256=f1accae9a28dc3cda46a91de86acf69de0d1b5f4edd44a9b0c3ceb8036dfff19",
+					RequiresPython: ">=3.9",
+					Yanked:         `Broken on "musllinux" & arm64`,
+				},
+			},
+		},
+		{
+			fixture: "devpi-requests.html",
+			files: []FileInfo{
+				{
+					Name:           "requests-2.31.0.tar.gz",
+					URL:            "../../root/pypi/+f/942/c5a758f98d790/requests-2.31.0.tar.gz#sha256=942c5a758f98d790eaed1a29cb6eefc7ffb0d1cf7af05c3d2791656dbd6ad1e1",
+					RequiresPython: ">=3.7",
+				},
+				{
+					Name:           "requests-2.31.0-py3-none-any.whl",
+					URL:            "../../root/pypi/+f/58c/d2187c01e7051/requests-2.31.0-py3-none-any.whl#sha256=58cd2187c01e70e6e26505bca751777aa9f2ee0b7f4300988b709f44e013003f",
+					RequiresPython: ">=3.7",
+				},
+				{
+					Name:           "requests-2.30.0-py3-none-any.whl",
+					URL:            "../../root/pypi/+f/27e/7c8d8a4f2b1bc/requests-2.30.0-py3-none-any.whl#sha256=27e7c8d8a4f2b1bc87f2c6ffa0b0b8e7d7ff2dd56cd0bd26be7b47aa47e3bb4b",
+					RequiresPython: ">=3.7",
+					Yanked:         true,
+				},
+			},
+		},
+		{
+			fixture: "artifactory-flask.html",
+			files: []FileInfo{
+				{
+					Name:           "flask-3.0.0.tar.gz",
+					URL:            "../../flask/3.0.0/flask-3.0.0.tar.gz#sha256=cfadcdb638b609361d29ec22360d6070a77d7463dcb3ab08d2c2f2f168845f58",
+					RequiresPython: ">=3.8",
+				},
+				{
+					Name:           "flask-3.0.0-py3-none-any.whl",
+					URL:            "../../flask/3.0.0/flask-3.0.0-py3-none-any.whl#sha256=21128f47e4e3b9d597a3e8521a329bf56909b690fcc3fa3e477725aa81367638",
+					RequiresPython: ">=3.8",
+				},
+				{
+					Name: "flask-2.3.3.tar.gz",
+					URL:  "../../flask/2.3.3/flask-2.3.3.tar.gz?checksum=sha1&download=true#sha256=09c347a92aa7ff4a8e7f3206795f30d826654baf38b873d0744cd571ca609efc",
+				},
+			},
+		},
+		{
+			fixture: "nexus-six.html",
+			files: []FileInfo{
+				{
+					Name:           "six-1.16.0-py2.py3-none-any.whl",
+					URL:            "../../packages/six/1.16.0/six-1.16.0-py2.py3-none-any.whl#sha256=8abb2f1d86890a2dfb989f9a77cfcfd3e47c2a354b01111771326f8aa26e0254",
+					RequiresPython: ">=2.7, !=3.0.*, !=3.1.*, !=3.2.*",
+				},
+				{
+					Name:           "six-1.16.0.tar.gz",
+					URL:            "../../packages/six/1.16.0/six-1.16.0.tar.gz#sha256=1e61c37477a1626458e36f7b1d82aa5c9b094fa4802892072e49de9c60c4c926",
+					RequiresPython: ">=2.7",
+				},
+			},
+		},
+		{
+			fixture: "gitlab-mypkg.html",
+			files: []FileInfo{
+				{
+					Name:           "mypkg-0.2.0-py3-none-any.whl",
+					URL:            "https://gitlab.example.com/api/v4/projects/42/packages/pypi/files/5d9c2ba0d2b34ed35ed6b4dde1cfde1e9a2fb3e64d4f5a5e0c0f6ba1c0d0f4a2/mypkg-0.2.0-py3-none-any.whl#sha256=5d9c2ba0d2b34ed35ed6b4dde1cfde1e9a2fb3e64d4f5a5e0c0f6ba1c0d0f4a2",
+					RequiresPython: ">=3.10",
+				},
+				{
+					Name: "mypkg-0.1.0.tar.gz",
+					URL:  "https://gitlab.example.com/api/v4/projects/42/packages/pypi/files/0b8e2cbcd0a41a7b0c5b3c8c0c7e7ba0a5e0e9e5d4a8f1d3c4b2a1f0e9d8c7b6/mypkg-0.1.0.tar.gz#sha256=0b8e2cbcd0a41a7b0c5b3c8c0c7e7ba0a5e0e9e5d4a8f1d3c4b2a1f0e9d8c7b6",
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.fixture, func(t *testing.T) {
+			project, err := client.parseHTMLProject(openFixture(t, tc.fixture))
+			if err != nil {
+				t.Fatalf("parseHTMLProject failed: %v", err)
+			}
+			if project.APIVersion != tc.apiVersion {
+				t.Errorf("Expected api-version %q, got %q", tc.apiVersion, project.APIVersion)
+			}
+			if len(project.Files) != len(tc.files) {
+				t.Fatalf("Expected %d files, got %+v", len(tc.files), project.Files)
+			}
+			for i, file := range project.Files {
+				if !reflect.DeepEqual(file, tc.files[i]) {
+					t.Errorf("File %d: expected %+v, got %+v", i, tc.files[i], file)
+				}
+			}
+		})
+	}
+}
+
+func TestParseHTMLPackageList_Corpus(t *testing.T) {
+	client := &Client{}
+
+	packages, err := client.parseHTMLPackageList(openFixture(t, "pypi-root.html"))
+	if err != nil {
+		t.Fatalf("parseHTMLPackageList failed: %v", err)
+	}
+	expected := []string{"numpy", "requests", "zope.interface", "pkg-with-amp"}
+	if !reflect.DeepEqual(packages, expected) {
+		t.Errorf("Expected %v, got %v", expected, packages)
+	}
+}
+
+func TestParseHTMLPackageFiles_Tolerance(t *testing.T) {
+	client := &Client{}
+
+	files, err := client.parseHTMLPackageFiles(strings.NewReader(`<body>
+<a href=/files/a-1.0.tar.gz data-yanked>a-1.0.tar.gz
+<a href="/files/a-1.1.tar.gz" data-core-metadata="false"></a>
+<a name="top">Top</a>
+<a href="/files/a-1.2.tar.gz" href="/elsewhere/a-1.2.tar.gz" data-dist-info-metadata="SHA256=abc">  a-1.2.tar.gz
+</a>`))
+	if err != nil {
+		t.Fatalf("parseHTMLPackageFiles failed: %v", err)
+	}
+
+	expected := []FileInfo{
+		// An unclosed link ends at the next one
+		{Name: "a-1.0.tar.gz", URL: "/files/a-1.0.tar.gz", Yanked: true},
+		// A link without text is named after its URL
+		{Name: "a-1.1.tar.gz", URL: "/files/a-1.1.tar.gz"},
+		// The first of repeated attributes wins, and the legacy metadata
+		// attribute is understood
+		{Name: "a-1.2.tar.gz", URL: "/files/a-1.2.tar.gz", CoreMetadata: map[string]interface{}{"sha256": "abc"}},
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, files)
+	}
+}
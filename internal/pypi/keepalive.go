@@ -0,0 +1,101 @@
+package pypi
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+// keepaliveTimeout bounds a single keepalive request
+const keepaliveTimeout = 10 * time.Second
+
+// Keepalive sends a HEAD request to the index whenever the client has been
+// idle for an interval, so a pooled connection with a finished TLS
+// handshake is still open when the next interactive request arrives. A nil
+// Keepalive does nothing.
+type Keepalive struct {
+	client   *Client
+	interval time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewKeepalive creates a keepalive for client. It returns nil when interval
+// is not positive.
+func NewKeepalive(client *Client, interval time.Duration) *Keepalive {
+	if interval <= 0 {
+		return nil
+	}
+	return &Keepalive{client: client, interval: interval}
+}
+
+// Start pings every interval the client spent idle, until Stop
+func (k *Keepalive) Start() {
+	if k == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	k.cancel = cancel
+	k.done = make(chan struct{})
+
+	go func() {
+		defer close(k.done)
+
+		ticker := time.NewTicker(k.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if k.client.idleFor() < k.interval {
+				continue
+			}
+			if err := k.client.ping(ctx); err != nil && ctx.Err() == nil {
+				log.Debug().Err(err).Msg("Upstream keepalive failed")
+			}
+		}
+	}()
+}
+
+// Stop ends the pings
+func (k *Keepalive) Stop() {
+	if k == nil || k.cancel == nil {
+		return
+	}
+	k.cancel()
+	<-k.done
+}
+
+// idleFor returns how long ago the client last sent an index request
+func (c *Client) idleFor() time.Duration {
+	return time.Since(time.Unix(0, c.lastRequest.Load()))
+}
+
+// ping sends a HEAD request for the index root, skipped while upstream has
+// asked us to back off
+func (c *Client) ping(ctx context.Context) error {
+	url := c.indexURL()
+	if err := c.checkBackoff(url); err != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, keepaliveTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+
+	c.lastRequest.Store(time.Now().UnixNano())
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
@@ -0,0 +1,49 @@
+package pypi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/config"
+)
+
+func TestKeepalive(t *testing.T) {
+	if NewKeepalive(nil, 0) != nil {
+		t.Error("Expected no keepalive without an interval")
+	}
+
+	var pings atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead && r.URL.Path == "/simple/" {
+			pings.Add(1)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(&config.Config{IndexURL: server.URL + "/simple/"})
+	k := NewKeepalive(client, 20*time.Millisecond)
+	k.Start()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for pings.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the idle client to ping the index")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	k.Stop()
+
+	// A busy client isn't pinged
+	client.lastRequest.Store(time.Now().Add(time.Hour).UnixNano())
+	k = NewKeepalive(client, 10*time.Millisecond)
+	k.Start()
+	before := pings.Load()
+	time.Sleep(50 * time.Millisecond)
+	k.Stop()
+	if pings.Load() != before {
+		t.Error("Expected no pings while the client is in use")
+	}
+}
@@ -0,0 +1,45 @@
+package pypi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ProvenanceContentType is the media type of PEP 740 provenance documents
+const ProvenanceContentType = "application/vnd.pypi.integrity.v1+json"
+
+// maxProvenanceSize bounds a provenance document; real ones are a few KB
+const maxProvenanceSize = 4 * 1024 * 1024
+
+// ErrProvenanceNotFound is returned when upstream has no provenance at the
+// URL its index listed
+var ErrProvenanceNotFound = errors.New("provenance not found")
+
+// GetProvenanceContext fetches the PEP 740 provenance document a file's
+// provenance field points at
+func (c *Client) GetProvenanceContext(ctx context.Context, url string) ([]byte, error) {
+	resp, err := c.makeRequest(ctx, url, ProvenanceContentType+", application/json;q=0.9")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch provenance: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrProvenanceNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d from %s", resp.StatusCode, url)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxProvenanceSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provenance: %w", err)
+	}
+	if len(data) > maxProvenanceSize {
+		return nil, fmt.Errorf("provenance from %s exceeds %d bytes", url, maxProvenanceSize)
+	}
+	return data, nil
+}
@@ -0,0 +1,50 @@
+package pypi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/huyhandes/groxpi/internal/config"
+)
+
+func TestClient_GetProvenance(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/simple/demo/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<a href="/files/demo-1.0.tar.gz" data-provenance="../../integrity/demo/1.0/demo-1.0.tar.gz/provenance">demo-1.0.tar.gz</a>`))
+		case "/integrity/demo/1.0/demo-1.0.tar.gz/provenance":
+			if !strings.Contains(r.Header.Get("Accept"), ProvenanceContentType) {
+				w.WriteHeader(http.StatusNotAcceptable)
+				return
+			}
+			_, _ = w.Write([]byte(`{"version": 1, "attestation_bundles": []}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(&config.Config{IndexURL: server.URL + "/simple/"})
+	files, err := client.GetPackageFilesContext(context.Background(), "demo")
+	if err != nil {
+		t.Fatalf("GetPackageFilesContext failed: %v", err)
+	}
+	// Resolved against the page, as file URLs are
+	if len(files) != 1 || files[0].Provenance != server.URL+"/integrity/demo/1.0/demo-1.0.tar.gz/provenance" {
+		t.Fatalf("Unexpected files %+v", files)
+	}
+
+	data, err := client.GetProvenanceContext(context.Background(), files[0].Provenance)
+	if err != nil || string(data) != `{"version": 1, "attestation_bundles": []}` {
+		t.Errorf("Unexpected provenance %q, %v", data, err)
+	}
+
+	if _, err := client.GetProvenanceContext(context.Background(), server.URL+"/integrity/missing/provenance"); !errors.Is(err, ErrProvenanceNotFound) {
+		t.Errorf("Expected ErrProvenanceNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package pypi
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Quirks are deviations from the simple API that some private indexes
+// (devpi, Artifactory, Nexus) are known to have. Deviations that can be
+// handled without guessing are always tolerated: relative file URLs are
+// resolved against the page they came from, JSON served under another
+// content type is recognized by its first byte, a JSON page without a
+// name takes the requested one, and HTML pages are tokenized rather than
+// read line by line. The rest need to be switched on per index.
+type Quirks struct {
+	// HTMLOnly asks for and parses HTML pages only, for indexes that
+	// answer the PEP 691 Accept header with JSON of their own
+	HTMLOnly bool
+}
+
+// quirkPresets name the quirks of common index servers
+var quirkPresets = map[string]Quirks{
+	"devpi":       {},
+	"artifactory": {HTMLOnly: true},
+}
+
+// ParseQuirks parses quirk flags ("html-only") and presets ("devpi",
+// "artifactory"), combining them. "loose-html" is accepted for existing
+// configurations; every HTML page is now parsed that way.
+func ParseQuirks(names []string) (Quirks, error) {
+	var q Quirks
+	for _, name := range names {
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case "", "loose-html":
+		case "html-only":
+			q.HTMLOnly = true
+		default:
+			preset, ok := quirkPresets[name]
+			if !ok {
+				return Quirks{}, fmt.Errorf("unknown index quirk %q (want html-only, devpi or artifactory)", name)
+			}
+			q.HTMLOnly = q.HTMLOnly || preset.HTMLOnly
+		}
+	}
+	return q, nil
+}
+
+// accept returns the Accept header for index requests
+func (q Quirks) accept() string {
+	if q.HTMLOnly {
+		return "text/html"
+	}
+	return "application/vnd.pypi.simple.v1+json"
+}
+
+// isJSON reports whether a response body should be parsed as JSON, peeking
+// at its first byte when the content type claims neither JSON nor HTML
+func (q Quirks) isJSON(contentType string, body *bufio.Reader) bool {
+	switch {
+	case q.HTMLOnly:
+		return false
+	case strings.Contains(contentType, "json"):
+		return true
+	case strings.Contains(contentType, "html"):
+		return false
+	}
+	for i := 1; ; i++ {
+		peeked, err := body.Peek(i)
+		if len(peeked) < i {
+			return false
+		}
+		switch peeked[i-1] {
+		case ' ', '\t', '\r', '\n':
+			if err != nil {
+				return false
+			}
+			continue
+		}
+		return peeked[i-1] == '{'
+	}
+}
+
+// fixProject fills in what a project page left out: the requested name,
+// and absolute file and provenance URLs resolved against the page's URL,
+// with their file names escaped as pip would
+func fixProject(project *Project, packageName, pageURL string) {
+	if project.Name == "" {
+		project.Name = packageName
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return
+	}
+	resolve := func(link string) string {
+		if link == "" {
+			return link
+		}
+		ref, err := url.Parse(link)
+		if err != nil {
+			return link
+		}
+		if !ref.IsAbs() {
+			ref = base.ResolveReference(ref)
+		}
+		EscapeFileURL(ref)
+		return ref.String()
+	}
+	for i := range project.Files {
+		project.Files[i].URL = resolve(project.Files[i].URL)
+		project.Files[i].Provenance = resolve(project.Files[i].Provenance)
+	}
+}
@@ -0,0 +1,79 @@
+package pypi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/huyhandes/groxpi/internal/config"
+)
+
+func TestParseQuirks(t *testing.T) {
+	q, err := ParseQuirks([]string{"devpi", " HTML-Only "})
+	if err != nil || !q.HTMLOnly {
+		t.Errorf("Expected html-only, got %+v, %v", q, err)
+	}
+	// loose-html is what every HTML page gets now, but is still accepted
+	if q, err := ParseQuirks([]string{"loose-html"}); err != nil || q != (Quirks{}) {
+		t.Errorf("Expected loose-html to be accepted, got %+v, %v", q, err)
+	}
+	if q, err := ParseQuirks(nil); err != nil || q != (Quirks{}) {
+		t.Errorf("Expected no quirks, got %+v, %v", q, err)
+	}
+	if _, err := ParseQuirks([]string{"nexus"}); err == nil {
+		t.Error("Expected an unknown quirk to be rejected")
+	}
+}
+
+func TestClient_QuirkyIndexes(t *testing.T) {
+	var accept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		switch r.URL.Path {
+		case "/json/numpy/":
+			// JSON under a generic content type, without a name, linking
+			// relative to the page
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte(` {"meta": {}, "files": [{"filename": "numpy-1.26.4.tar.gz", "url": "../../+f/abc/numpy-1.26.4.tar.gz#sha256=abc"}]}`))
+		case "/html/numpy/":
+			// Several links on a line, one wrapped across lines, upper-case tags
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><body><A HREF="/files/numpy-1.26.4.tar.gz">numpy-1.26.4.tar.gz</A><br/><a
+				href="https://cdn.example/numpy-1.26.4-py3-none-any.whl" data-requires-python="&gt;=3.9">numpy-1.26.4-py3-none-any.whl</a></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(&config.Config{IndexURL: server.URL + "/json/"})
+	project, err := client.GetProjectContext(context.Background(), "numpy")
+	if err != nil {
+		t.Fatalf("GetProjectContext failed: %v", err)
+	}
+	if project.Name != "numpy" || len(project.Files) != 1 || project.Files[0].URL != server.URL+"/+f/abc/numpy-1.26.4.tar.gz#sha256=abc" {
+		t.Errorf("Unexpected project %+v", project)
+	}
+
+	// Messy HTML needs no quirk
+	client = NewClient(&config.Config{IndexURL: server.URL + "/html/"})
+	if files, err := client.GetPackageFilesContext(context.Background(), "numpy"); err != nil || len(files) != 2 {
+		t.Errorf("Expected both links, got %+v, %v", files, err)
+	}
+	if accept == "text/html" {
+		t.Error("Expected JSON to be asked for without html-only")
+	}
+
+	client = NewClient(&config.Config{IndexURL: server.URL + "/html/", IndexQuirks: []string{"artifactory"}})
+	files, err := client.GetPackageFilesContext(context.Background(), "numpy")
+	if err != nil || len(files) != 2 {
+		t.Fatalf("Expected both links, got %+v, %v", files, err)
+	}
+	if accept != "text/html" {
+		t.Errorf("Expected an HTML-only request, got Accept %q", accept)
+	}
+	if files[0].URL != server.URL+"/files/numpy-1.26.4.tar.gz" || files[1].Name != "numpy-1.26.4-py3-none-any.whl" || files[1].RequiresPython != ">=3.9" {
+		t.Errorf("Unexpected files %+v", files)
+	}
+}
@@ -0,0 +1,78 @@
+// Package quarantine holds back files uploaded to the index too recently,
+// so a malicious release has time to be noticed and removed upstream before
+// installers behind the proxy can pick it up.
+package quarantine
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/distfile"
+)
+
+// Policy hides files for Window after their upload, except those of
+// packages whose normalized name matches an Exempt glob. Files that can't be
+// dated are hidden too, unless AllowUnknown is set.
+type Policy struct {
+	Window       time.Duration
+	Exempt       []string
+	AllowUnknown bool
+}
+
+// New returns a policy, or nil when window is not positive. A nil policy
+// hides nothing.
+func New(window time.Duration, exempt []string, allowUnknown bool) *Policy {
+	if window <= 0 {
+		return nil
+	}
+	return &Policy{Window: window, Exempt: exempt, AllowUnknown: allowUnknown}
+}
+
+// HidesUnknown reports whether a file of pkg that can't be dated, because
+// its upload time or the package's file list is missing, is hidden
+func (p *Policy) HidesUnknown(pkg string) bool {
+	return !p.Exempted(pkg) && !p.AllowUnknown
+}
+
+// Exempted reports whether pkg's files are never quarantined
+func (p *Policy) Exempted(pkg string) bool {
+	if p == nil {
+		return true
+	}
+	name := distfile.NormalizeName(pkg)
+	for _, pattern := range p.Exempt {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Hides reports whether a file of pkg uploaded at uploadTime, a PEP 700
+// upload-time timestamp, is still quarantined at now. Files without a
+// parseable upload time can't be dated and are hidden as HidesUnknown says.
+func (p *Policy) Hides(pkg, uploadTime string, now time.Time) bool {
+	if p.Exempted(pkg) {
+		return false
+	}
+	uploaded, ok := ParseUploadTime(uploadTime)
+	if !ok {
+		return p.HidesUnknown(pkg)
+	}
+	return now.Before(uploaded.Add(p.Window))
+}
+
+// ParseUploadTime parses a PEP 700 upload-time, an ISO 8601 UTC timestamp
+// such as 2024-05-01T12:00:00.123456Z
+func ParseUploadTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
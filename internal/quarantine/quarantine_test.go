@@ -0,0 +1,53 @@
+package quarantine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicy_Hides(t *testing.T) {
+	now := time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC)
+	p := New(48*time.Hour, []string{"internal-*", "certifi"}, false)
+
+	tests := []struct {
+		pkg, uploadTime string
+		want            bool
+	}{
+		{"requests", "2024-05-02T12:00:00.000000Z", true},
+		{"requests", "2024-05-01T12:00:01Z", true},
+		{"requests", "2024-05-01T12:00:00Z", false},
+		{"requests", "2023-01-01T00:00:00Z", false},
+		{"requests", "", true},
+		{"requests", "yesterday", true},
+		{"Internal_Tools", "2024-05-03T11:00:00Z", false},
+		{"internal-tools", "", false},
+		{"certifi", "2024-05-03T11:00:00Z", false},
+	}
+	for _, tt := range tests {
+		if got := p.Hides(tt.pkg, tt.uploadTime, now); got != tt.want {
+			t.Errorf("Hides(%q, %q) = %v, want %v", tt.pkg, tt.uploadTime, got, tt.want)
+		}
+	}
+
+	// Allowing unknown files lets undated ones through
+	p.AllowUnknown = true
+	if p.Hides("requests", "", now) || p.HidesUnknown("requests") {
+		t.Error("Expected undated files served when unknown files are allowed")
+	}
+	if !p.Hides("requests", "2024-05-02T12:00:00Z", now) {
+		t.Error("Expected dated files still quarantined when unknown files are allowed")
+	}
+}
+
+func TestPolicy_Nil(t *testing.T) {
+	p := New(0, nil, false)
+	if p != nil {
+		t.Fatalf("Expected no policy without a window, got %+v", p)
+	}
+	if p.Hides("requests", time.Now().UTC().Format(time.RFC3339), time.Now()) {
+		t.Error("Expected a nil policy to hide nothing")
+	}
+	if p.HidesUnknown("requests") {
+		t.Error("Expected a nil policy to hide undated files")
+	}
+}
@@ -0,0 +1,406 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/phuslu/log"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+const (
+	// MetaHeaderPrefix prefixes the headers carrying an object's storage
+	// metadata (upstream URL, hashes, ...) when a standby fetches it
+	MetaHeaderPrefix = "X-Groxpi-Meta-"
+
+	// pollWait is how long the primary holds a poll open without events
+	pollWait = 30 * time.Second
+
+	// retryDelay is the pause after a failed poll, resync or copy
+	retryDelay = 5 * time.Second
+
+	// fileTimeout bounds copying a single file
+	fileTimeout = 30 * time.Minute
+)
+
+// errGone is returned for files the primary no longer has, e.g. evicted
+// since they were announced
+var errGone = errors.New("object no longer on the primary")
+
+// Object describes a file in the primary's object listing
+type Object struct {
+	Key     string `json:"key"`
+	Package string `json:"package"`
+	File    string `json:"file"`
+	Size    int64  `json:"size"`
+}
+
+// Config configures a standby
+type Config struct {
+	Source  string       // Base URL of the primary index, e.g. http://primary:5000 or http://primary:5000/prod
+	Token   string       // Token presented to the primary (empty = none)
+	Workers int          // Concurrent file copies
+	Client  *http.Client // Client for requests to the primary (nil = http.DefaultClient)
+
+	// Keys is the storage key layout the standby serves files from
+	// (nil = storage.DefaultKeyTemplate)
+	Keys *storage.KeyLayout
+}
+
+// Status reports replication progress
+type Status struct {
+	Source       string    `json:"source"`
+	Connected    bool      `json:"connected"`
+	Epoch        string    `json:"epoch,omitempty"`
+	Cursor       uint64    `json:"cursor"`
+	LastResyncAt time.Time `json:"last_resync_at,omitempty"`
+	LastEventAt  time.Time `json:"last_event_at,omitempty"`
+	FilesCopied  int64     `json:"files_copied"`
+	FilesSkipped int64     `json:"files_skipped"`
+	FilesFailed  int64     `json:"files_failed"`
+	BytesCopied  int64     `json:"bytes_copied"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// Follower keeps a standby's storage in step with a primary: it copies
+// everything the primary holds on first contact (and whenever it lost track,
+// e.g. after the primary restarted), then every file the primary announces
+type Follower struct {
+	cfg     Config
+	storage storage.Storage
+
+	mu     sync.RWMutex
+	status Status
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewFollower creates a follower copying files from cfg.Source into store
+func NewFollower(cfg Config, store storage.Storage) *Follower {
+	cfg.Source = strings.TrimSuffix(cfg.Source, "/")
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Keys == nil {
+		cfg.Keys, _ = storage.NewKeyLayout(storage.DefaultKeyTemplate)
+	}
+
+	return &Follower{
+		cfg:     cfg,
+		storage: store,
+		status:  Status{Source: cfg.Source},
+	}
+}
+
+// Start follows the primary in the background until Stop is called
+func (f *Follower) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	f.done = make(chan struct{})
+
+	go func() {
+		defer close(f.done)
+		f.run(ctx)
+	}()
+
+	log.Info().
+		Str("source", f.cfg.Source).
+		Int("workers", f.cfg.Workers).
+		Msg("Replication standby started")
+}
+
+// Stop cancels replication and waits for in-flight copies to end
+func (f *Follower) Stop() {
+	if f.cancel == nil {
+		return
+	}
+	f.cancel()
+	<-f.done
+	log.Info().Msg("Replication standby stopped")
+}
+
+// Status returns a snapshot of replication progress
+func (f *Follower) Status() Status {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.status
+}
+
+func (f *Follower) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := f.step(ctx); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Str("source", f.cfg.Source).Msg("Replication failed, retrying")
+			f.mu.Lock()
+			f.status.Connected = false
+			f.status.LastError = err.Error()
+			f.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryDelay):
+			}
+		}
+	}
+}
+
+// step polls the primary once and applies the answer. The cursor only
+// advances once every announced file is copied, so a failure retries the
+// same batch.
+func (f *Follower) step(ctx context.Context) error {
+	status := f.Status()
+	batch, err := f.poll(ctx, status.Epoch, status.Cursor)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.status.Connected = true
+	f.mu.Unlock()
+
+	if batch.Reset {
+		// Files stored from here on are announced after batch.Next, so
+		// nothing falls between the listing and the next poll
+		if err := f.resync(ctx); err != nil {
+			return err
+		}
+		f.mu.Lock()
+		f.status.Epoch = batch.Epoch
+		f.status.Cursor = batch.Next
+		f.status.LastResyncAt = time.Now()
+		f.mu.Unlock()
+		return nil
+	}
+
+	if len(batch.Events) == 0 {
+		return nil
+	}
+	objects := make([]Object, len(batch.Events))
+	for i, event := range batch.Events {
+		objects[i] = Object{Key: event.Key, Package: event.Package, File: event.File, Size: event.Size}
+	}
+	if err := f.copyAll(ctx, objects); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.status.Cursor = batch.Next
+	f.status.LastEventAt = time.Now()
+	f.mu.Unlock()
+	return nil
+}
+
+// poll long-polls the primary for events after cursor
+func (f *Follower) poll(ctx context.Context, epoch string, cursor uint64) (*Batch, error) {
+	ctx, cancel := context.WithTimeout(ctx, pollWait+time.Minute)
+	defer cancel()
+
+	query := url.Values{
+		"epoch": {epoch},
+		"after": {strconv.FormatUint(cursor, 10)},
+		"wait":  {strconv.Itoa(int(pollWait.Seconds()))},
+	}
+	var batch Batch
+	if err := f.getJSON(ctx, "/replication/events?"+query.Encode(), &batch); err != nil {
+		return nil, fmt.Errorf("failed to poll events: %w", err)
+	}
+	return &batch, nil
+}
+
+// resync copies every file the primary holds that the standby lacks
+func (f *Follower) resync(ctx context.Context) error {
+	var listing struct {
+		Objects []Object `json:"objects"`
+	}
+	if err := f.getJSON(ctx, "/replication/objects", &listing); err != nil {
+		return fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	log.Info().
+		Str("source", f.cfg.Source).
+		Int("objects", len(listing.Objects)).
+		Msg("Resyncing from replication primary")
+
+	return f.copyAll(ctx, listing.Objects)
+}
+
+// copyAll copies objects missing from storage, returning an error if any
+// could not be copied
+func (f *Follower) copyAll(ctx context.Context, objects []Object) error {
+	sem := semaphore.NewWeighted(int64(f.cfg.Workers))
+	var wg sync.WaitGroup
+	var failed sync.Once
+	var firstErr error
+	for _, obj := range objects {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func(obj Object) {
+			defer wg.Done()
+			defer sem.Release(1)
+			if err := f.copyObject(ctx, obj); err != nil {
+				failed.Do(func() { firstErr = err })
+			}
+		}(obj)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+// copyObject copies one file unless the standby already has it
+func (f *Follower) copyObject(ctx context.Context, obj Object) error {
+	if !ValidKey(obj.Key) || obj.Package == "" || obj.File == "" {
+		f.count(0, fmt.Errorf("refusing invalid key %q", obj.Key))
+		return nil
+	}
+	key := f.cfg.Keys.Key(obj.Package, obj.File)
+
+	if exists, err := f.storage.Exists(ctx, key); err == nil && exists {
+		f.mu.Lock()
+		f.status.FilesSkipped++
+		f.mu.Unlock()
+		return nil
+	}
+
+	size, err := f.fetch(ctx, obj.Key, key)
+	if errors.Is(err, errGone) {
+		f.mu.Lock()
+		f.status.FilesSkipped++
+		f.mu.Unlock()
+		return nil
+	}
+	if err != nil && ctx.Err() == nil {
+		err = fmt.Errorf("failed to copy %s: %w", obj.Key, err)
+		log.Warn().Err(err).Str("key", key).Msg("Failed to replicate file")
+	}
+	f.count(size, err)
+	return err
+}
+
+// fetch downloads the primary's object src and stores it under dst
+func (f *Follower) fetch(ctx context.Context, src, dst string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, fileTimeout)
+	defer cancel()
+
+	resp, err := f.get(ctx, "/replication/objects/"+escapeKey(src))
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	metadata := make(map[string]string)
+	for name, values := range resp.Header {
+		if meta, ok := strings.CutPrefix(name, MetaHeaderPrefix); ok && len(values) > 0 {
+			metadata[strings.ToLower(meta)] = values[0]
+		}
+	}
+
+	info, err := f.storage.Put(storage.WithMetadata(ctx, metadata), dst, resp.Body, resp.ContentLength, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return 0, err
+	}
+	if info != nil {
+		return info.Size, nil
+	}
+	return resp.ContentLength, nil
+}
+
+// getJSON fetches a success envelope from the primary and decodes its data
+func (f *Follower) getJSON(ctx context.Context, path string, data interface{}) error {
+	resp, err := f.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	envelope := struct {
+		Data interface{} `json:"data"`
+	}{Data: data}
+	return sonic.Unmarshal(body, &envelope)
+}
+
+// get sends an authenticated request to the primary, failing on anything
+// but 200
+func (f *Follower) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.cfg.Source+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if f.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.cfg.Token)
+	}
+	// Package files are stored as is; a compressed response would lose
+	// its length
+	req.Header.Set("Accept-Encoding", "identity")
+
+	resp, err := f.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound && strings.HasPrefix(path, "/replication/objects/") {
+			return nil, errGone
+		}
+		return nil, fmt.Errorf("primary returned %s", resp.Status)
+	}
+	return resp, nil
+}
+
+func (f *Follower) count(size int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		f.status.FilesFailed++
+		f.status.LastError = err.Error()
+		return
+	}
+	f.status.FilesCopied++
+	f.status.BytesCopied += size
+}
+
+// ValidKey reports whether key may be replicated: only package files are,
+// and their keys must not escape the packages/ tree
+func ValidKey(key string) bool {
+	if !strings.HasPrefix(key, storage.PackagesPrefix) || strings.Contains(key, `\`) {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// escapeKey escapes each path segment of key
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
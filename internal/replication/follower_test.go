@@ -0,0 +1,153 @@
+package replication
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// fakePrimary serves the replication endpoints from an in-memory set of
+// objects
+type fakePrimary struct {
+	log *Log
+
+	mu      sync.Mutex
+	objects map[string]string
+	auth    []string
+}
+
+func (p *fakePrimary) store(key, pkg, file, content string) {
+	p.mu.Lock()
+	p.objects[key] = content
+	p.mu.Unlock()
+	p.log.Append(key, pkg, file, int64(len(content)))
+}
+
+func (p *fakePrimary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.auth = append(p.auth, r.Header.Get("Authorization"))
+	p.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/replication/events":
+		after, _ := strconv.ParseUint(r.URL.Query().Get("after"), 10, 64)
+		batch := p.log.Poll(r.Context(), r.URL.Query().Get("epoch"), after, 100*time.Millisecond)
+		writeData(w, batch)
+	case r.URL.Path == "/replication/objects":
+		p.mu.Lock()
+		var objects []Object
+		for key, content := range p.objects {
+			parts := strings.Split(key, "/")
+			objects = append(objects, Object{Key: key, Package: parts[1], File: parts[2], Size: int64(len(content))})
+		}
+		p.mu.Unlock()
+		writeData(w, map[string]interface{}{"objects": objects})
+	case strings.HasPrefix(r.URL.Path, "/replication/objects/"):
+		p.mu.Lock()
+		content, ok := p.objects[strings.TrimPrefix(r.URL.Path, "/replication/objects/")]
+		p.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set(MetaHeaderPrefix+"Sha256", "abc123")
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, _ = io.WriteString(w, content)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeData(w http.ResponseWriter, data interface{}) {
+	body, _ := sonic.Marshal(map[string]interface{}{"status": "success", "data": data})
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func readObject(t *testing.T, store storage.Storage, key string) (string, *storage.ObjectInfo) {
+	t.Helper()
+	reader, info, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%q) failed: %v", key, err)
+	}
+	defer func() { _ = reader.Close() }()
+	data, _ := io.ReadAll(reader)
+	return string(data), info
+}
+
+func TestFollower_ResyncAndFollow(t *testing.T) {
+	primary := &fakePrimary{log: NewLog(0), objects: map[string]string{}}
+	primary.store("packages/numpy/numpy-1.26.4.tar.gz", "numpy", "numpy-1.26.4.tar.gz", "numpy sdist")
+	server := httptest.NewServer(primary)
+	defer server.Close()
+
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+	keys, err := storage.NewKeyLayout("packages/{hash2}/{package}/{file}")
+	if err != nil {
+		t.Fatalf("NewKeyLayout failed: %v", err)
+	}
+
+	f := NewFollower(Config{Source: server.URL + "/", Token: "standby", Keys: keys}, store)
+	f.Start()
+	defer f.Stop()
+
+	// Files the primary already has arrive through the initial resync,
+	// under the standby's own key layout
+	numpyKey := keys.Key("numpy", "numpy-1.26.4.tar.gz")
+	waitFor(t, "the resync", func() bool { return !f.Status().LastResyncAt.IsZero() })
+	content, info := readObject(t, store, numpyKey)
+	if content != "numpy sdist" || info.Metadata[storage.MetaSHA256] != "abc123" {
+		t.Errorf("Unexpected copy %q with metadata %v", content, info.Metadata)
+	}
+
+	// Later files arrive through events
+	primary.store("packages/six/six-1.16.0-py2.py3-none-any.whl", "six", "six-1.16.0-py2.py3-none-any.whl", "six wheel")
+	sixKey := keys.Key("six", "six-1.16.0-py2.py3-none-any.whl")
+	waitFor(t, "the announced file", func() bool {
+		exists, _ := store.Exists(context.Background(), sixKey)
+		return exists
+	})
+
+	// Files evicted before the standby got to them are skipped, and keys
+	// outside packages/ are refused
+	primary.log.Append("packages/gone/gone-1.0.tar.gz", "gone", "gone-1.0.tar.gz", 1)
+	primary.log.Append("packages/../jobs/x.json", "x", "x.json", 1)
+	waitFor(t, "the cursor to advance", func() bool { return f.Status().Cursor == 4 })
+
+	status := f.Status()
+	if !status.Connected || status.FilesCopied != 2 || status.FilesSkipped != 1 || status.FilesFailed != 1 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	primary.mu.Lock()
+	defer primary.mu.Unlock()
+	for _, auth := range primary.auth {
+		if auth != "Bearer standby" {
+			t.Fatalf("Expected every request to carry the token, got %q", auth)
+		}
+	}
+}
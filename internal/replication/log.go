@@ -0,0 +1,142 @@
+// Package replication lets a standby groxpi keep a copy of a primary's
+// cached files. The primary records every file it stores in a Log that
+// standbys long-poll; a Follower on the standby copies each announced file
+// into its own storage, so it can take over with a warm cache.
+package replication
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLogSize is how many events a primary keeps for standbys that
+	// fall behind; older cursors trigger a full resync
+	DefaultLogSize = 10000
+
+	// maxBatch caps the events returned by one poll
+	maxBatch = 1000
+)
+
+// Event announces a file stored on the primary
+type Event struct {
+	Seq     uint64 `json:"seq"`
+	Key     string `json:"key"`     // Storage key on the primary
+	Package string `json:"package"` // Package and file the key was parsed into, so a
+	File    string `json:"file"`    // standby can store it under its own key layout
+	Size    int64  `json:"size"`
+}
+
+// Batch answers a standby's poll
+type Batch struct {
+	// Epoch identifies the primary process; events don't survive a
+	// restart, so a new epoch means the standby must resync
+	Epoch  string  `json:"epoch"`
+	Events []Event `json:"events"`
+	Next   uint64  `json:"next"` // Cursor to poll with next
+
+	// Reset is set when the standby's cursor is unknown or too old: it
+	// must copy everything from the object listing, then poll from Next
+	Reset bool `json:"reset"`
+}
+
+// Log is the primary's in-memory record of recently stored files. A nil
+// Log records nothing, so callers needn't check whether replication is on.
+type Log struct {
+	mu      sync.Mutex
+	epoch   string
+	size    int
+	events  []Event       // Ring buffer; event seq lives at (seq-1) % size
+	last    uint64        // Seq of the newest event (0 = none yet)
+	updated chan struct{} // Closed and replaced on every Append
+}
+
+// NewLog creates a log keeping the last size events (DefaultLogSize if
+// size <= 0)
+func NewLog(size int) *Log {
+	if size <= 0 {
+		size = DefaultLogSize
+	}
+	epoch := make([]byte, 8)
+	_, _ = rand.Read(epoch)
+
+	return &Log{
+		epoch:   hex.EncodeToString(epoch),
+		size:    size,
+		events:  make([]Event, 0, size),
+		updated: make(chan struct{}),
+	}
+}
+
+// Epoch returns the identifier standbys use to detect a restarted primary
+func (l *Log) Epoch() string {
+	return l.epoch
+}
+
+// Append records that the file pkg/file was stored under key with size bytes
+func (l *Log) Append(key, pkg, file string, size int64) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.last++
+	event := Event{Seq: l.last, Key: key, Package: pkg, File: file, Size: size}
+	if len(l.events) < l.size {
+		l.events = append(l.events, event)
+	} else {
+		l.events[(l.last-1)%uint64(l.size)] = event
+	}
+
+	close(l.updated)
+	l.updated = make(chan struct{})
+}
+
+// Poll returns the events after cursor after of epoch epoch, waiting up to
+// wait for new ones when there are none yet
+func (l *Log) Poll(ctx context.Context, epoch string, after uint64, wait time.Duration) Batch {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		l.mu.Lock()
+		batch, updated := l.batch(epoch, after)
+		l.mu.Unlock()
+
+		if batch.Reset || len(batch.Events) > 0 {
+			return batch
+		}
+		select {
+		case <-updated:
+		case <-timer.C:
+			return batch
+		case <-ctx.Done():
+			return batch
+		}
+	}
+}
+
+// batch builds the answer to a poll; l.mu must be held
+func (l *Log) batch(epoch string, after uint64) (Batch, chan struct{}) {
+	batch := Batch{Epoch: l.epoch, Next: l.last, Events: []Event{}}
+
+	// A cursor from another run, from the future, or from before the
+	// oldest event kept means events were missed
+	oldest := l.last - uint64(len(l.events)) + 1
+	if epoch != l.epoch || after > l.last || after+1 < oldest {
+		batch.Reset = true
+		return batch, l.updated
+	}
+
+	end := min(l.last, after+maxBatch)
+	for seq := after + 1; seq <= end; seq++ {
+		batch.Events = append(batch.Events, l.events[(seq-1)%uint64(l.size)])
+	}
+	batch.Next = end
+	return batch, l.updated
+}
@@ -0,0 +1,68 @@
+package replication
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLog_Poll(t *testing.T) {
+	l := NewLog(3)
+
+	// An unknown epoch always resets, pointing at the newest event
+	l.Append("packages/a/a-1.0.tar.gz", "a", "a-1.0.tar.gz", 1)
+	batch := l.Poll(context.Background(), "", 0, 0)
+	if !batch.Reset || batch.Epoch != l.Epoch() || batch.Next != 1 {
+		t.Fatalf("Expected a reset at cursor 1, got %+v", batch)
+	}
+
+	l.Append("packages/b/b-1.0.tar.gz", "b", "b-1.0.tar.gz", 2)
+	l.Append("packages/c/c-1.0.tar.gz", "c", "c-1.0.tar.gz", 3)
+	batch = l.Poll(context.Background(), l.Epoch(), 1, 0)
+	if batch.Reset || len(batch.Events) != 2 || batch.Events[0].Package != "b" || batch.Next != 3 {
+		t.Fatalf("Expected events 2 and 3, got %+v", batch)
+	}
+
+	// Once event 2 is overwritten, cursor 1 can't be continued
+	l.Append("packages/d/d-1.0.tar.gz", "d", "d-1.0.tar.gz", 4)
+	l.Append("packages/e/e-1.0.tar.gz", "e", "e-1.0.tar.gz", 5)
+	if batch = l.Poll(context.Background(), l.Epoch(), 1, 0); !batch.Reset {
+		t.Errorf("Expected a reset for a cursor older than the log, got %+v", batch)
+	}
+	batch = l.Poll(context.Background(), l.Epoch(), 2, 0)
+	if batch.Reset || len(batch.Events) != 3 || batch.Events[2].Key != "packages/e/e-1.0.tar.gz" {
+		t.Errorf("Expected events 3 to 5, got %+v", batch)
+	}
+
+	if batch = l.Poll(context.Background(), l.Epoch(), 9, 0); !batch.Reset {
+		t.Errorf("Expected a reset for a cursor from the future, got %+v", batch)
+	}
+}
+
+func TestLog_PollWaits(t *testing.T) {
+	l := NewLog(0)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		l.Append("packages/a/a-1.0.tar.gz", "a", "a-1.0.tar.gz", 1)
+	}()
+
+	start := time.Now()
+	batch := l.Poll(context.Background(), l.Epoch(), 0, 5*time.Second)
+	if len(batch.Events) != 1 || batch.Next != 1 {
+		t.Fatalf("Expected the appended event, got %+v", batch)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("Expected the poll to return as soon as an event was appended")
+	}
+
+	// Without events the poll gives up after wait
+	if batch = l.Poll(context.Background(), l.Epoch(), 1, 10*time.Millisecond); batch.Reset || len(batch.Events) != 0 || batch.Next != 1 {
+		t.Errorf("Expected an empty batch, got %+v", batch)
+	}
+}
+
+func TestLog_Nil(t *testing.T) {
+	var l *Log
+	l.Append("packages/a/a-1.0.tar.gz", "a", "a-1.0.tar.gz", 1)
+}
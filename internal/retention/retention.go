@@ -0,0 +1,104 @@
+// Package retention decides which cached files belong to versions a package
+// no longer needs, so eviction and garbage collection can drop old releases
+// before the ones CI keeps installing.
+package retention
+
+import (
+	"path"
+	"sort"
+
+	"github.com/huyhandes/groxpi/internal/distfile"
+)
+
+// Rule overrides how many versions are kept for packages whose normalized
+// name matches Pattern (a path.Match glob such as "torch*")
+type Rule struct {
+	Pattern string
+	Keep    int
+}
+
+// Policy keeps the newest Keep versions of every package; the first matching
+// rule overrides Keep for that package. A keep of 0 retains every version.
+type Policy struct {
+	Keep  int
+	Rules []Rule
+}
+
+// New returns a policy, or nil when neither the default nor any rule limits
+// versions. A nil policy supersedes nothing.
+func New(keep int, rules []Rule) *Policy {
+	limited := keep > 0
+	for _, rule := range rules {
+		limited = limited || rule.Keep > 0
+	}
+	if !limited {
+		return nil
+	}
+	return &Policy{Keep: keep, Rules: rules}
+}
+
+// KeepFor returns how many versions of pkg are kept (0 = all)
+func (p *Policy) KeepFor(pkg string) int {
+	if p == nil {
+		return 0
+	}
+	name := distfile.NormalizeName(pkg)
+	for _, rule := range p.Rules {
+		if ok, _ := path.Match(rule.Pattern, name); ok {
+			return rule.Keep
+		}
+	}
+	return p.Keep
+}
+
+// Superseded returns the keys that belong to a version older than the
+// newest ones kept for their package. A package's files are the keys sharing
+// a directory, as every storage key layout places them; files whose name
+// doesn't parse are never superseded.
+func (p *Policy) Superseded(keys []string) map[string]bool {
+	if p == nil {
+		return nil
+	}
+
+	type group struct {
+		name     string
+		versions map[string][]string
+	}
+	byDir := make(map[string]*group)
+	for _, key := range keys {
+		f, err := distfile.Parse(path.Base(key))
+		if err != nil {
+			continue
+		}
+		dir := path.Dir(key)
+		g := byDir[dir]
+		if g == nil {
+			g = &group{name: f.Name, versions: make(map[string][]string)}
+			byDir[dir] = g
+		}
+		g.versions[f.Version] = append(g.versions[f.Version], key)
+	}
+
+	superseded := make(map[string]bool)
+	for _, g := range byDir {
+		versions := g.versions
+		keep := p.KeepFor(g.name)
+		if keep <= 0 || len(versions) <= keep {
+			continue
+		}
+
+		ordered := make([]string, 0, len(versions))
+		for v := range versions {
+			ordered = append(ordered, v)
+		}
+		sort.Slice(ordered, func(i, j int) bool {
+			return distfile.CompareVersions(ordered[i], ordered[j]) > 0
+		})
+		for _, v := range ordered[keep:] {
+			for _, key := range versions[v] {
+				superseded[key] = true
+			}
+		}
+	}
+	return superseded
+}
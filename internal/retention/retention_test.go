@@ -0,0 +1,77 @@
+package retention
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNew_Disabled(t *testing.T) {
+	if p := New(0, []Rule{{Pattern: "torch", Keep: 0}}); p != nil {
+		t.Fatalf("Expected nil policy without limits, got %+v", p)
+	}
+
+	var p *Policy
+	if p.KeepFor("numpy") != 0 || p.Superseded([]string{"packages/numpy/numpy-1.0.tar.gz"}) != nil {
+		t.Error("Nil policy should keep everything")
+	}
+}
+
+func TestPolicy_KeepFor(t *testing.T) {
+	p := New(3, []Rule{
+		{Pattern: "torch*", Keep: 1},
+		{Pattern: "numpy", Keep: 0},
+		{Pattern: "*", Keep: 5}, // Shadowed by the earlier rules
+	})
+
+	tests := map[string]int{
+		"torch":       1,
+		"torchvision": 1,
+		"numpy":       0,
+		"requests":    5,
+		"Torch_Audio": 1,
+	}
+	for pkg, want := range tests {
+		if got := p.KeepFor(pkg); got != want {
+			t.Errorf("KeepFor(%q) = %d, want %d", pkg, got, want)
+		}
+	}
+}
+
+func TestPolicy_Superseded(t *testing.T) {
+	p := New(2, []Rule{{Pattern: "torch", Keep: 1}, {Pattern: "pinned", Keep: 0}})
+
+	keys := []string{
+		"packages/requests/requests-2.31.0-py3-none-any.whl",
+		"packages/requests/requests-2.31.0.tar.gz",
+		"packages/requests/requests-2.30.0-py3-none-any.whl",
+		"packages/requests/requests-2.9.0.tar.gz",
+		"packages/requests/requests-2.32.0rc1.tar.gz",
+		"packages/requests/README.txt",
+		"packages/torch/torch-2.1.0+cpu-cp311-cp311-linux_x86_64.whl",
+		"packages/torch/torch-2.1.0+cu118-cp311-cp311-linux_x86_64.whl",
+		"packages/torch/torch-2.0.1-cp311-cp311-linux_x86_64.whl",
+		"packages/pinned/pinned-1.0.tar.gz",
+		"packages/pinned/pinned-0.9.tar.gz",
+		"packages/pinned/pinned-0.8.tar.gz",
+		"packages/six/six-1.16.0-py2.py3-none-any.whl",
+	}
+
+	got := make([]string, 0)
+	for key := range p.Superseded(keys) {
+		got = append(got, key)
+	}
+	sort.Strings(got)
+
+	// Pre-releases count as versions; the newest two requests versions are
+	// 2.32.0rc1 and 2.31.0. Local variants of torch are distinct versions.
+	want := []string{
+		"packages/requests/requests-2.30.0-py3-none-any.whl",
+		"packages/requests/requests-2.9.0.tar.gz",
+		"packages/torch/torch-2.0.1-cp311-cp311-linux_x86_64.whl",
+		"packages/torch/torch-2.1.0+cpu-cp311-cp311-linux_x86_64.whl",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Superseded() = %v, want %v", got, want)
+	}
+}
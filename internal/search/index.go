@@ -0,0 +1,288 @@
+package search
+
+import (
+	"sort"
+	"strings"
+)
+
+// MatchType describes how a package name matched the query
+type MatchType string
+
+const (
+	MatchExact     MatchType = "exact"
+	MatchPrefix    MatchType = "prefix"
+	MatchSubstring MatchType = "substring"
+	MatchFuzzy     MatchType = "fuzzy"
+)
+
+// Result is a single search hit
+type Result struct {
+	Name  string    `json:"name"`
+	Match MatchType `json:"match"`
+
+	rank     int // lower is better: match type first, then edit distance
+	distance int
+}
+
+// Index is an immutable trigram index over package names. It is built once
+// per package-list refresh and is safe for concurrent searches.
+type Index struct {
+	names      []string           // original names as returned by the index
+	normalized []string           // PEP 503 normalized names, same order as names
+	trigrams   map[string][]int32 // trigram -> ascending positions in names
+}
+
+// NewIndex builds a search index over the given package names
+func NewIndex(names []string) *Index {
+	idx := &Index{
+		names:      make([]string, len(names)),
+		normalized: make([]string, len(names)),
+		trigrams:   make(map[string][]int32),
+	}
+	copy(idx.names, names)
+
+	for i, name := range idx.names {
+		norm := Normalize(name)
+		idx.normalized[i] = norm
+		for _, tri := range uniqueTrigrams(norm) {
+			idx.trigrams[tri] = append(idx.trigrams[tri], int32(i))
+		}
+	}
+
+	return idx
+}
+
+// Len returns the number of indexed package names
+func (idx *Index) Len() int {
+	return len(idx.names)
+}
+
+// Search returns up to limit names matching query, best matches first.
+// Exact matches rank above prefix matches, which rank above substring
+// matches; fuzzy (typo-tolerant) matches fill any remaining slots.
+func (idx *Index) Search(query string, limit int) []Result {
+	q := Normalize(query)
+	if q == "" || limit <= 0 {
+		return nil
+	}
+
+	var results []Result
+	seen := make(map[int32]struct{})
+
+	for _, i := range idx.substringCandidates(q) {
+		norm := idx.normalized[i]
+		var match MatchType
+		switch {
+		case norm == q:
+			match = MatchExact
+		case strings.HasPrefix(norm, q):
+			match = MatchPrefix
+		case strings.Contains(norm, q):
+			match = MatchSubstring
+		default:
+			continue
+		}
+		seen[i] = struct{}{}
+		results = append(results, Result{Name: idx.names[i], Match: match, rank: matchRank(match)})
+	}
+
+	if len(results) < limit {
+		results = append(results, idx.fuzzyMatches(q, seen)...)
+	}
+
+	sort.Slice(results, func(a, b int) bool {
+		ra, rb := results[a], results[b]
+		if ra.rank != rb.rank {
+			return ra.rank < rb.rank
+		}
+		if ra.distance != rb.distance {
+			return ra.distance < rb.distance
+		}
+		if len(ra.Name) != len(rb.Name) {
+			return len(ra.Name) < len(rb.Name)
+		}
+		return ra.Name < rb.Name
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// substringCandidates returns positions that may contain q. Queries shorter
+// than a trigram fall back to a linear scan.
+func (idx *Index) substringCandidates(q string) []int32 {
+	if len(q) < 3 {
+		all := make([]int32, len(idx.names))
+		for i := range all {
+			all[i] = int32(i)
+		}
+		return all
+	}
+
+	tris := uniqueTrigrams(q)
+	lists := make([][]int32, 0, len(tris))
+	for _, tri := range tris {
+		postings, ok := idx.trigrams[tri]
+		if !ok {
+			return nil
+		}
+		lists = append(lists, postings)
+	}
+
+	// Intersect starting from the rarest trigram
+	sort.Slice(lists, func(a, b int) bool { return len(lists[a]) < len(lists[b]) })
+	candidates := lists[0]
+	for _, postings := range lists[1:] {
+		candidates = intersect(candidates, postings)
+		if len(candidates) == 0 {
+			return nil
+		}
+	}
+	return candidates
+}
+
+// fuzzyMatches finds names within a small edit distance of q that share at
+// least one trigram with it and were not already matched
+func (idx *Index) fuzzyMatches(q string, seen map[int32]struct{}) []Result {
+	if len(q) < 3 {
+		return nil
+	}
+
+	maxEdits := 1
+	if len(q) > 5 {
+		maxEdits = 2
+	}
+
+	checked := make(map[int32]struct{})
+	var results []Result
+	for _, tri := range uniqueTrigrams(q) {
+		for _, i := range idx.trigrams[tri] {
+			if _, ok := seen[i]; ok {
+				continue
+			}
+			if _, ok := checked[i]; ok {
+				continue
+			}
+			checked[i] = struct{}{}
+
+			norm := idx.normalized[i]
+			if abs(len(norm)-len(q)) > maxEdits {
+				continue
+			}
+			if d := levenshtein(q, norm, maxEdits); d <= maxEdits {
+				results = append(results, Result{
+					Name:     idx.names[i],
+					Match:    MatchFuzzy,
+					rank:     matchRank(MatchFuzzy),
+					distance: d,
+				})
+			}
+		}
+	}
+	return results
+}
+
+// Normalize applies PEP 503 name normalization so that searches are
+// insensitive to case and to '-', '_' and '.' separators
+func Normalize(name string) string {
+	var sb strings.Builder
+	sb.Grow(len(name))
+	lastSep := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if r == '-' || r == '_' || r == '.' {
+			if !lastSep {
+				sb.WriteByte('-')
+			}
+			lastSep = true
+			continue
+		}
+		sb.WriteRune(r)
+		lastSep = false
+	}
+	return sb.String()
+}
+
+func matchRank(m MatchType) int {
+	switch m {
+	case MatchExact:
+		return 0
+	case MatchPrefix:
+		return 1
+	case MatchSubstring:
+		return 2
+	default:
+		return 3
+	}
+}
+
+func uniqueTrigrams(s string) []string {
+	if len(s) < 3 {
+		return nil
+	}
+	seen := make(map[string]struct{}, len(s)-2)
+	tris := make([]string, 0, len(s)-2)
+	for i := 0; i+3 <= len(s); i++ {
+		tri := s[i : i+3]
+		if _, ok := seen[tri]; ok {
+			continue
+		}
+		seen[tri] = struct{}{}
+		tris = append(tris, tri)
+	}
+	return tris
+}
+
+// intersect merges two ascending posting lists
+func intersect(a, b []int32) []int32 {
+	out := make([]int32, 0, min(len(a), len(b)))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, a[i])
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return out
+}
+
+// levenshtein returns the edit distance between a and b, stopping early
+// with maxEdits+1 once every cell in a row exceeds maxEdits
+func levenshtein(a, b string, maxEdits int) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > maxEdits {
+			return maxEdits + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,150 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+)
+
+var testNames = []string{
+	"requests",
+	"requests-oauthlib",
+	"types-requests",
+	"numpy",
+	"numpy-quaternion",
+	"Flask",
+	"flask_sqlalchemy",
+	"zope.interface",
+	"django",
+}
+
+func names(results []Result) []string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		out[i] = r.Name
+	}
+	return out
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"Flask":            "flask",
+		"flask_sqlalchemy": "flask-sqlalchemy",
+		"zope.interface":   "zope-interface",
+		"a-_.b":            "a-b",
+		"  NumPy ":         "numpy",
+	}
+
+	for in, want := range tests {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestIndex_SearchRanking(t *testing.T) {
+	idx := NewIndex(testNames)
+
+	results := idx.Search("requests", 10)
+	got := names(results)
+	want := []string{"requests", "requests-oauthlib", "types-requests"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("Search(requests) = %v, want %v", got, want)
+	}
+
+	wantMatches := []MatchType{MatchExact, MatchPrefix, MatchSubstring}
+	for i, r := range results {
+		if r.Match != wantMatches[i] {
+			t.Errorf("Result %s: expected match %s, got %s", r.Name, wantMatches[i], r.Match)
+		}
+	}
+}
+
+func TestIndex_SearchNormalizesQuery(t *testing.T) {
+	idx := NewIndex(testNames)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"FLASK", "Flask"},
+		{"flask-sqlalchemy", "flask_sqlalchemy"},
+		{"zope_interface", "zope.interface"},
+	}
+
+	for _, tt := range tests {
+		results := idx.Search(tt.query, 1)
+		if len(results) != 1 || results[0].Name != tt.want {
+			t.Errorf("Search(%q) = %v, want [%s]", tt.query, names(results), tt.want)
+		}
+	}
+}
+
+func TestIndex_SearchShortQuery(t *testing.T) {
+	idx := NewIndex(testNames)
+
+	got := names(idx.Search("nu", 10))
+	want := []string{"numpy", "numpy-quaternion"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Search(nu) = %v, want %v", got, want)
+	}
+}
+
+func TestIndex_SearchFuzzy(t *testing.T) {
+	idx := NewIndex(testNames)
+
+	results := idx.Search("reqests", 10)
+	if len(results) == 0 || results[0].Name != "requests" || results[0].Match != MatchFuzzy {
+		t.Errorf("Expected fuzzy match on requests, got %+v", results)
+	}
+
+	results = idx.Search("djagno", 10)
+	if len(results) == 0 || results[0].Name != "django" {
+		t.Errorf("Expected fuzzy match on django, got %+v", results)
+	}
+}
+
+func TestIndex_SearchLimitAndEmpty(t *testing.T) {
+	idx := NewIndex(testNames)
+
+	if got := idx.Search("requests", 2); len(got) != 2 {
+		t.Errorf("Expected 2 results with limit 2, got %d", len(got))
+	}
+	if got := idx.Search("   ", 10); got != nil {
+		t.Errorf("Expected no results for blank query, got %v", got)
+	}
+	if got := idx.Search("zzzzzz", 10); len(got) != 0 {
+		t.Errorf("Expected no results, got %v", names(got))
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		maxEdits int
+		want     int
+	}{
+		{"kitten", "sitting", 5, 3},
+		{"numpy", "numpy", 1, 0},
+		{"numpy", "nmupy", 2, 2},
+		{"abc", "xyz", 1, 2}, // early exit returns maxEdits+1
+	}
+
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b, tt.maxEdits); got != tt.want {
+			t.Errorf("levenshtein(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.maxEdits, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkIndex_Search(b *testing.B) {
+	pkgs := make([]string, 0, 100000)
+	for i := 0; i < 100000; i++ {
+		pkgs = append(pkgs, fmt.Sprintf("package-%d-%s", i, testNames[i%len(testNames)]))
+	}
+	idx := NewIndex(pkgs)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.Search("reqeusts", 50)
+	}
+}
@@ -0,0 +1,144 @@
+package selftest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/pypi"
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// probePrefix keeps probe objects out of packages/, so scans of cached
+// files never see one left behind by an interrupted run
+const probePrefix = "selftest/"
+
+// DefaultPackage is a small, long-lived package every PyPI mirror carries
+const DefaultPackage = "six"
+
+// Options configures a self-test run
+type Options struct {
+	Storage  storage.Storage // Storage to probe (nil = skip)
+	Upstream *pypi.Client    // Index to query (nil = skip)
+	Package  string          // Package whose metadata is fetched (default: DefaultPackage)
+}
+
+// Check is the outcome of one step of a run
+type Check struct {
+	Name    string        `json:"name"`
+	OK      bool          `json:"ok"`
+	Latency time.Duration `json:"latency_ns"`
+	Detail  string        `json:"detail,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// Report summarizes a self-test run
+type Report struct {
+	Checks   []Check       `json:"checks"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Failed returns how many checks failed
+func (r *Report) Failed() int {
+	failed := 0
+	for _, check := range r.Checks {
+		if !check.OK {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Run writes, reads back and deletes a probe object in opts.Storage, then
+// fetches opts.Package's metadata from opts.Upstream, timing each step. A
+// failed step is recorded and the run continues where it still can, so one
+// run reports every problem.
+func Run(ctx context.Context, opts Options) *Report {
+	start := time.Now()
+	report := &Report{}
+	step := func(name string, fn func() (string, error)) bool {
+		began := time.Now()
+		detail, err := fn()
+		check := Check{Name: name, OK: err == nil, Latency: time.Since(began), Detail: detail}
+		if err != nil {
+			check.Error = err.Error()
+		}
+		report.Checks = append(report.Checks, check)
+		return err == nil
+	}
+
+	if opts.Storage != nil {
+		probeStorage(ctx, opts.Storage, step)
+	}
+
+	if opts.Upstream != nil {
+		pkg := opts.Package
+		if pkg == "" {
+			pkg = DefaultPackage
+		}
+		step("upstream metadata", func() (string, error) {
+			files, err := opts.Upstream.GetPackageFilesContext(ctx, pkg)
+			if err != nil {
+				return "", err
+			}
+			if len(files) == 0 {
+				return "", fmt.Errorf("package %s lists no files", pkg)
+			}
+			return fmt.Sprintf("%s: %d files", pkg, len(files)), nil
+		})
+	}
+
+	report.Duration = time.Since(start)
+	return report
+}
+
+// probeStorage runs the storage steps against a fresh probe object
+func probeStorage(ctx context.Context, store storage.Storage, step func(string, func() (string, error)) bool) {
+	token := make([]byte, 8)
+	_, _ = rand.Read(token)
+	key := probePrefix + hex.EncodeToString(token)
+	payload := []byte("groxpi self-test " + key)
+
+	written := step("storage write", func() (string, error) {
+		_, err := store.Put(ctx, key, bytes.NewReader(payload), int64(len(payload)), "text/plain")
+		return key, err
+	})
+	if !written {
+		return
+	}
+
+	step("storage read", func() (string, error) {
+		reader, _, err := store.Get(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = reader.Close() }()
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return "", err
+		}
+		if !bytes.Equal(data, payload) {
+			return "", errors.New("read back different content than was written")
+		}
+		return fmt.Sprintf("%d bytes", len(data)), nil
+	})
+
+	step("storage delete", func() (string, error) {
+		if err := store.Delete(ctx, key); err != nil {
+			return "", err
+		}
+		exists, err := store.Exists(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return "", errors.New("probe object still exists after delete")
+		}
+		return "", nil
+	})
+}
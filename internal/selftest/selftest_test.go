@@ -0,0 +1,70 @@
+package selftest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/huyhandes/groxpi/internal/config"
+	"github.com/huyhandes/groxpi/internal/pypi"
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+func TestRun(t *testing.T) {
+	index := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/simple/six/" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, `<a href="https://files.example/six-1.16.0.tar.gz">six-1.16.0.tar.gz</a>`)
+	}))
+	defer index.Close()
+
+	dir := t.TempDir()
+	store, err := storage.NewLocalStorage(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+	client := pypi.NewClient(&config.Config{IndexURL: index.URL + "/simple/"})
+
+	report := Run(context.Background(), Options{Storage: store, Upstream: client})
+	if report.Failed() != 0 || len(report.Checks) != 4 {
+		t.Fatalf("Expected 4 passing checks, got %+v", report.Checks)
+	}
+	if report.Checks[3].Detail != "six: 1 files" {
+		t.Errorf("Unexpected upstream detail %q", report.Checks[3].Detail)
+	}
+
+	// The probe object is cleaned up
+	entries, _ := os.ReadDir(filepath.Join(dir, "selftest"))
+	if len(entries) != 0 {
+		t.Errorf("Expected no probe objects left, got %d", len(entries))
+	}
+
+	// A package the index doesn't have fails the upstream check only
+	report = Run(context.Background(), Options{Storage: store, Upstream: client, Package: "missing"})
+	if report.Failed() != 1 || report.Checks[3].OK || report.Checks[3].Error == "" {
+		t.Errorf("Expected only the upstream check to fail, got %+v", report.Checks)
+	}
+}
+
+func TestRun_StorageFailure(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewLocalStorage(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+	// A file where the probe directory should be makes every write fail
+	if err := os.WriteFile(filepath.Join(dir, "selftest"), nil, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	report := Run(context.Background(), Options{Storage: store})
+	if report.Failed() != 1 || len(report.Checks) != 1 || report.Checks[0].Name != "storage write" {
+		t.Errorf("Expected the run to stop after the failed write, got %+v", report.Checks)
+	}
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/bundle"
+	"github.com/huyhandes/groxpi/internal/cachekey"
+	"github.com/huyhandes/groxpi/internal/distfile"
+	"github.com/huyhandes/groxpi/internal/jobs"
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// handleCacheExport streams the selected cached packages as a tar bundle
+func (s *Server) handleCacheExport(c *gin.Context) {
+	packages := exportPackages(c)
+	if len(packages) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Query parameter 'packages' required",
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("groxpi-bundle-%s.tar", time.Now().UTC().Format("20060102-150405"))
+	c.Header("Content-Type", "application/x-tar")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	// Headers are already sent once streaming starts, so a failure can only be
+	// logged; the truncated archive is rejected on import for lack of a manifest
+	if _, err := bundle.Export(requestContext(c), s.storage, s.keys, packages, c.Writer); err != nil {
+		requestLog(c).Error().Err(err).Strs("packages", packages).Msg("Cache export failed")
+	}
+}
+
+// handlePackageBundle streams a package's cached files as a tar bundle with
+// a manifest of their hashes, for handing a vendored snapshot to an
+// air-gapped build. ?versions=1.0,2.0 limits it to the files of those
+// versions, all of which must be cached.
+func (s *Server) handlePackageBundle(c *gin.Context) {
+	packageName := cachekey.Package(c.Param("package"))
+	if !s.checkIndexRequest(c, packageName) {
+		return
+	}
+	var versions []string
+	for _, version := range strings.Split(c.Query("versions"), ",") {
+		if version = strings.TrimSpace(version); version != "" {
+			versions = append(versions, version)
+		}
+	}
+
+	objects, err := storage.PackageObjects(requestContext(c), s.storage, s.keys, packageName)
+	if err != nil {
+		requestLog(c).Error().Err(err).Str("package", packageName).Msg("Failed to list cached files")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Failed to list cached files",
+		})
+		return
+	}
+
+	// Select the files up front, so a missing version is answered with 404
+	// rather than an archive missing it
+	selected := make(map[string]bool)
+	matched := make([]bool, len(versions))
+	for _, obj := range objects {
+		file := path.Base(obj.Key)
+		if !s.constraints.AllowsFile(packageName, file) {
+			continue
+		}
+		if len(versions) == 0 {
+			selected[file] = true
+			continue
+		}
+		parsed, err := distfile.Parse(file)
+		if err != nil {
+			continue
+		}
+		for i, version := range versions {
+			if distfile.CompareVersions(parsed.Version, version) == 0 {
+				selected[file] = true
+				matched[i] = true
+			}
+		}
+	}
+	var missing []string
+	for i, version := range versions {
+		if !matched[i] {
+			missing = append(missing, version)
+		}
+	}
+	if len(selected) == 0 || len(missing) > 0 {
+		message := fmt.Sprintf("No cached files of %s", packageName)
+		if len(missing) > 0 {
+			message = fmt.Sprintf("No cached files of %s %s", packageName, strings.Join(missing, ", "))
+		}
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": message,
+		})
+		return
+	}
+
+	name := packageName
+	if len(versions) > 0 {
+		name += "-" + strings.Join(versions, "_")
+	}
+	c.Header("Content-Type", "application/x-tar")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-bundle.tar"`, name))
+	c.Status(http.StatusOK)
+
+	keep := func(_, file string) bool { return selected[file] }
+	if _, err := bundle.ExportSelected(requestContext(c), s.storage, s.keys, []string{packageName}, keep, c.Writer); err != nil {
+		requestLog(c).Error().Err(err).Str("package", packageName).Strs("versions", versions).Msg("Package bundle failed")
+	}
+}
+
+// handleCacheExportJob writes a bundle into storage in the background as an
+// "export" job, for bundles too large to stream within a request. The
+// archive is downloaded from GET /jobs/:id/artifact once the job completes.
+func (s *Server) handleCacheExportJob(c *gin.Context) {
+	packages := exportPackages(c)
+	if len(packages) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Query parameter 'packages' required",
+		})
+		return
+	}
+
+	job := s.jobs.Start("export", func(ctx context.Context, p *jobs.Progress) (interface{}, error) {
+		key := "exports/" + p.JobID() + ".tar"
+
+		pr, pw := io.Pipe()
+		var manifest *bundle.Manifest
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			var err error
+			manifest, err = bundle.Export(ctx, s.storage, s.keys, packages, pw)
+			_ = pw.CloseWithError(err)
+		}()
+
+		// The archive size is unknown up front; streaming puts handle that
+		// without buffering small objects for async upload
+		var err error
+		if ss, ok := s.storage.(storage.StreamingStorage); ok {
+			_, err = ss.StreamingPut(ctx, key, pr, -1, "application/x-tar")
+		} else {
+			_, err = s.storage.Put(ctx, key, pr, -1, "application/x-tar")
+		}
+		_ = pr.CloseWithError(err) // Unblocks the exporter if storage gave up early
+		<-done
+		if err != nil {
+			_ = s.storage.Delete(context.Background(), key)
+			return nil, err
+		}
+		p.SetArtifact(key)
+		return manifest, nil
+	})
+
+	s.acceptJob(c, job)
+}
+
+// exportPackages returns the normalized names in ?packages=a,b,c
+func exportPackages(c *gin.Context) []string {
+	var packages []string
+	for _, name := range strings.Split(c.Query("packages"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			packages = append(packages, cachekey.Package(name))
+		}
+	}
+	return packages
+}
+
+// handleCacheImport loads a tar bundle from the request body into storage.
+// It writes straight into the cache, so it takes an admin token.
+func (s *Server) handleCacheImport(c *gin.Context) {
+	if !s.authorizeAdmin(c) {
+		return
+	}
+	overwrite := c.Query("overwrite") == "true"
+
+	result, err := bundle.Import(requestContext(c), s.storage, s.keys, c.Request.Body, overwrite)
+	if err != nil {
+		requestLog(c).Error().Err(err).Msg("Cache import failed")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   result,
+	})
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+const (
+	// cacheHeader tells where a response came from. Files: HIT-L1 (local
+	// disk or memory), HIT-L2 (S3 or WebDAV), PEER (another groxpi on the
+	// LAN) or MISS (upstream). Index pages: HIT, MISS, or STALE when served
+	// past their TTL because upstream failed.
+	cacheHeader = "X-Cache"
+
+	cacheHit   = "HIT"
+	cacheMiss  = "MISS"
+	cacheStale = "STALE"
+	cachePeer  = "PEER"
+
+	// indexMissKey marks a request that fetched its index page from upstream
+	indexMissKey = "index_miss"
+)
+
+// storedCacheHit returns the X-Cache value for a file served from storage
+func (s *Server) storedCacheHit(ctx context.Context, key string) string {
+	if locator, ok := s.storage.(storage.Locator); ok {
+		return cacheHit + "-" + locator.Locate(ctx, key)
+	}
+	switch s.config.StorageType {
+	case "s3", "webdav":
+		return cacheHit + "-" + storage.TierRemote
+	}
+	return cacheHit + "-" + storage.TierLocal
+}
+
+// setCacheHeader sets X-Cache unless a path that handed the file over, such
+// as a peer copy, already told where it came from
+func setCacheHeader(c *gin.Context, value string) {
+	if c.Writer.Header().Get(cacheHeader) == "" {
+		c.Header(cacheHeader, value)
+	}
+}
+
+// setAgeHeader sets Age to how long ago a cached response was stored
+func setAgeHeader(c *gin.Context, age time.Duration) {
+	c.Header("Age", strconv.FormatInt(int64(max(age, 0)/time.Second), 10))
+}
+
+// setIndexCacheHeaders sets X-Cache and Age on a package's page, or on the
+// package list when packageName is empty, from its index cache entry
+func (s *Server) setIndexCacheHeaders(c *gin.Context, packageName string) {
+	if c.GetBool(indexMissKey) {
+		c.Header(cacheHeader, cacheMiss)
+		return
+	}
+
+	age, cached := s.indexCache.Age(cachekey.PackageList)
+	_, fresh := s.indexCache.Get(cachekey.PackageList)
+	if packageName != "" {
+		age, cached = s.indexCache.PackageAge(packageName)
+		_, fresh = s.indexCache.GetPackage(packageName)
+	}
+	status := cacheHit
+	if cached && (!fresh || c.GetBool(degradedKey)) {
+		status = cacheStale
+	}
+	c.Header(cacheHeader, status)
+	// An entry dropped since its response was cached, e.g. by a refresh,
+	// has no age to tell
+	if cached {
+		setAgeHeader(c, age)
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// capacitySummary describes the local cache's utilization trend for the
+// home page, e.g. "12.3 of 50.0 GB (25%), growing 1.2 GB/day, full in about
+// 31 days"; empty without a size-limited cache
+func (s *Server) capacitySummary() string {
+	if s.capacity == nil {
+		return ""
+	}
+	forecast := s.capacity.Forecast()
+	summary := fmt.Sprintf("%s of %s (%.0f%%)", formatGB(forecast.UsedBytes), formatGB(forecast.QuotaBytes), forecast.Utilization*100)
+	if forecast.GrowthPerDay != 0 {
+		summary += fmt.Sprintf(", growing %s/day", formatGB(forecast.GrowthPerDay))
+	}
+	switch {
+	case !forecast.Projected:
+	case forecast.FullInSeconds == 0:
+		summary += ", full"
+	case forecast.FullIn() < 48*time.Hour:
+		summary += fmt.Sprintf(", full in about %.0f hours", forecast.FullIn().Hours())
+	default:
+		summary += fmt.Sprintf(", full in about %.0f days", forecast.FullIn().Hours()/24)
+	}
+	if forecast.Alerting {
+		summary += " ⚠️"
+	}
+	return summary
+}
+
+func formatGB(bytes int64) string {
+	return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+}
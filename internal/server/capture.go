@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/capture"
+)
+
+// replayableRoutes are the routes captured for replay: what installers and
+// browsers read. Admin, replication and monitoring routes are left out, as
+// replaying them would change the target or measure nothing of interest.
+var replayableRoutes = map[string]bool{
+	"/":                          true,
+	"/simple/":                   true,
+	"/simple/:package/":          true,
+	"/simple/:package/:file":     true,
+	"/index/":                    true,
+	"/index/:package":            true,
+	"/index/:package/:file":      true,
+	"/search":                    true,
+	"/package/:package":          true,
+	"/files/*url":                true,
+	"/provenance/:package/:file": true,
+}
+
+// captureMiddleware records the replayable requests the server answers
+// when capturing is enabled
+func (s *Server) captureMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		if s.capture == nil || method != http.MethodGet && method != http.MethodHead || !replayableRoutes[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		s.capture.Record(capture.Record{
+			Time:     start,
+			Method:   method,
+			Route:    c.FullPath(),
+			Path:     s.capturePrefix + c.Request.URL.RequestURI(),
+			Accept:   c.GetHeader("Accept"),
+			Package:  c.Param("package"),
+			File:     c.Param("file"),
+			Status:   c.Writer.Status(),
+			Bytes:    int64(max(c.Writer.Size(), 0)),
+			Duration: time.Since(start),
+		})
+	}
+}
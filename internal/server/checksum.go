@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// setChecksumHeaders announces a file's SHA-256 as RFC 9530 digests and as
+// the X-Checksum-Sha256 header Artifactory clients read, so downstream tools
+// can verify downloads without a hash lookup. Digests that aren't valid hex
+// SHA-256 are ignored.
+func setChecksumHeaders(c *gin.Context, sha256Hex string) {
+	sum, err := hex.DecodeString(sha256Hex)
+	if err != nil || len(sum) != 32 {
+		return
+	}
+	digest := "sha-256=:" + base64.StdEncoding.EncodeToString(sum) + ":"
+
+	// Repr-Digest covers the whole file; Content-Digest covers the body sent,
+	// which is only the whole file when no range was requested
+	c.Header("Repr-Digest", digest)
+	if c.GetHeader("Range") == "" {
+		c.Header("Content-Digest", digest)
+	}
+	c.Header("X-Checksum-Sha256", hex.EncodeToString(sum))
+}
+
+// clearFileHeaders removes checksum, resume and cache headers set for a
+// body that will not be sent, e.g. when a failed stream falls back to a
+// redirect
+func clearFileHeaders(c *gin.Context) {
+	c.Writer.Header().Del("Repr-Digest")
+	c.Writer.Header().Del("Content-Digest")
+	c.Writer.Header().Del("X-Checksum-Sha256")
+	c.Writer.Header().Del("Accept-Ranges")
+	c.Writer.Header().Del("ETag")
+	c.Writer.Header().Del(cacheHeader)
+	c.Writer.Header().Del("Age")
+}
+
+// setStoredHeaders sets the checksum, resume and Age headers from the info
+// of the object stored under key, for serving paths that write the body
+// before the object info is known. It returns that info, or nil if the
+// object could not be looked up.
+func (s *Server) setStoredHeaders(ctx context.Context, c *gin.Context, key string) *storage.ObjectInfo {
+	info, err := s.storage.Stat(ctx, key)
+	if err != nil {
+		return nil
+	}
+	setChecksumHeaders(c, info.Metadata[storage.MetaSHA256])
+	setResumeHeaders(c, info)
+	if !info.LastModified.IsZero() {
+		setAgeHeader(c, time.Since(info.LastModified))
+	}
+	return info
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/clientid"
+	"github.com/huyhandes/groxpi/internal/logger"
+)
+
+const clientKey = "client"
+
+// downloadRoutes serve package files, whose bytes are attributed to clients
+var downloadRoutes = map[string]bool{
+	"/simple/:package/:file": true,
+	"/index/:package/:file":  true,
+	"/files/*url":            true,
+}
+
+// clientMiddleware identifies the client from its User-Agent and the team
+// header, tags the request's log lines with it and counts its traffic
+func clientMiddleware(teamHeader string, stats *clientid.Stats) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var team string
+		if teamHeader != "" {
+			team = c.GetHeader(teamHeader)
+		}
+		id := clientid.Parse(c.GetHeader("User-Agent"), team)
+		c.Set(clientKey, id)
+
+		fields := []string{"client", id.Installer}
+		if id.Version != "" {
+			fields = append(fields, "client_version", id.Version)
+		}
+		if id.CI {
+			fields = append(fields, "ci", strconv.FormatBool(id.CI))
+		}
+		if id.Team != "" {
+			fields = append(fields, "team", id.Team)
+		}
+		c.Request = c.Request.WithContext(logger.WithFields(c.Request.Context(), fields...))
+
+		c.Next()
+
+		download := downloadRoutes[c.FullPath()] && c.Writer.Status() < 400
+		stats.Record(id, download, int64(c.Writer.Size()))
+	}
+}
+
+// clientIdentity returns the identity clientMiddleware attached to the
+// request
+func clientIdentity(c *gin.Context) clientid.Identity {
+	if id, ok := c.Value(clientKey).(clientid.Identity); ok {
+		return id
+	}
+	return clientid.Identity{Installer: clientid.Unknown}
+}
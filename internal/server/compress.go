@@ -0,0 +1,91 @@
+package server
+
+import (
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/config"
+)
+
+// archiveContentTypes maps distribution and archive extensions, which the
+// system MIME table often lacks, to their content types
+var archiveContentTypes = map[string]string{
+	".whl": "application/zip",
+	".egg": "application/zip",
+	".zip": "application/zip",
+	".gz":  "application/gzip",
+	".tgz": "application/gzip",
+	".bz2": "application/x-bzip2",
+	".tbz": "application/x-bzip2",
+	".xz":  "application/x-xz",
+	".zst": "application/zstd",
+	".tar": "application/x-tar",
+}
+
+// gzipFilter decides before a handler runs whether its response is gzipped.
+// Package files are already compressed, so gzipping them again only burns
+// CPU on large downloads.
+type gzipFilter struct {
+	extensions []string
+	types      map[string]bool
+}
+
+func newGzipFilter(cfg *config.Config) *gzipFilter {
+	f := &gzipFilter{types: make(map[string]bool, len(cfg.GzipExcludedTypes))}
+	for _, ext := range cfg.GzipExcludedExtensions {
+		f.extensions = append(f.extensions, strings.ToLower(ext))
+	}
+	for _, t := range cfg.GzipExcludedTypes {
+		f.types[strings.ToLower(t)] = true
+	}
+	return f
+}
+
+// shouldCompress reports whether the response to c may be gzipped
+func (f *gzipFilter) shouldCompress(c *gin.Context) bool {
+	if !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") ||
+		strings.Contains(c.GetHeader("Connection"), "Upgrade") {
+		return false
+	}
+
+	urlPath := strings.ToLower(c.Request.URL.Path)
+	for _, ext := range f.extensions {
+		if strings.HasSuffix(urlPath, ext) {
+			return false
+		}
+	}
+
+	contentType := servedContentType(c)
+	return contentType == "" || !f.types[contentType]
+}
+
+// servedContentType returns the content type of a file-serving route, judged
+// from the file name since the handler hasn't run yet, or "" for pages and
+// API responses
+func servedContentType(c *gin.Context) string {
+	switch c.FullPath() {
+	case "/simple/:package/:file", "/index/:package/:file", "/files/*url":
+		return contentTypeByName(path.Base(c.Request.URL.Path))
+	case "/cache/export", "/bundle/:package":
+		return "application/x-tar"
+	case "/jobs/:id/artifact":
+		return "application/octet-stream"
+	}
+	return ""
+}
+
+// contentTypeByName guesses a file's content type from its extension,
+// falling back to application/octet-stream as file downloads do
+func contentTypeByName(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if t, ok := archiveContentTypes[ext]; ok {
+		return t
+	}
+	if t, _, err := mime.ParseMediaType(mime.TypeByExtension(ext)); err == nil {
+		return t
+	}
+	return "application/octet-stream"
+}
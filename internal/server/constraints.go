@@ -0,0 +1,29 @@
+package server
+
+import "github.com/huyhandes/groxpi/internal/pypi"
+
+// constrainProject returns a copy of project without the files and versions
+// the version constraints exclude, so installers resolve within policy even
+// without a constraints file of their own. Unconstrained packages are
+// returned as is; the fetched project may be shared with other callers, so
+// it is never modified.
+func (s *Server) constrainProject(packageName string, project *pypi.Project) *pypi.Project {
+	if s.constraints.Specifiers(packageName) == nil {
+		return project
+	}
+
+	constrained := *project
+	constrained.Files = make([]pypi.FileInfo, 0, len(project.Files))
+	for _, file := range project.Files {
+		if s.constraints.AllowsFile(packageName, file.Name) {
+			constrained.Files = append(constrained.Files, file)
+		}
+	}
+	constrained.Versions = make([]string, 0, len(project.Versions))
+	for _, version := range project.Versions {
+		if s.constraints.Allows(packageName, version) {
+			constrained.Versions = append(constrained.Versions, version)
+		}
+	}
+	return &constrained
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/config"
+)
+
+const deadlineKey = "deadline"
+
+// Route classes, each with its own deadline
+const (
+	routeIndex    = "index"    // Index pages, search and status: short
+	routeDownload = "download" // Package files and bulk transfers: long
+	routeAdmin    = "admin"    // Cache management, GC, jobs and anything else
+	routeNone     = "none"     // Long polls that bound their own wait
+)
+
+// routeClasses assigns the routes that are not admin routes to a class,
+// keyed by gin's route pattern
+var routeClasses = map[string]string{
+	"/":                          routeIndex,
+	"/simple/":                   routeIndex,
+	"/simple/:package/":          routeIndex,
+	"/index/":                    routeIndex,
+	"/index/:package":            routeIndex,
+	"/search":                    routeIndex,
+	"/package/:package":          routeIndex,
+	"/health":                    routeIndex,
+	"/metrics":                   routeIndex,
+	"/version":                   routeIndex,
+	"/stats":                     routeIndex,
+	"/signing-key":               routeIndex,
+	"/provenance/:package/:file": routeIndex,
+	"/simple/:package/:file":     routeDownload,
+	"/index/:package/:file":      routeDownload,
+	"/files/*url":                routeDownload,
+	"/jobs/:id/artifact":         routeDownload,
+	"/cache/export":              routeDownload,
+	"/bundle/:package":           routeDownload,
+	"/cache/import":              routeDownload,
+	"/replication/objects/*key":  routeDownload,
+	"/replication/events":        routeNone,
+}
+
+// routeTimeout returns the deadline for requests to the route pattern
+// (0 = none)
+func routeTimeout(cfg *config.Config, pattern string) (string, time.Duration) {
+	class, ok := routeClasses[pattern]
+	if !ok {
+		class = routeAdmin
+	}
+	switch class {
+	case routeIndex:
+		return class, cfg.IndexRequestTimeout
+	case routeDownload:
+		return class, cfg.DownloadRequestTimeout
+	case routeAdmin:
+		return class, cfg.AdminRequestTimeout
+	}
+	return class, 0
+}
+
+// requestDeadline is the deadline of one request. Contexts detached from
+// the client's cancellation by requestContext still end at it; their
+// timers are released when the request completes.
+type requestDeadline struct {
+	deadline time.Time
+
+	mu      sync.Mutex
+	cancels []context.CancelFunc
+}
+
+// bind returns ctx ending at the request deadline
+func (d *requestDeadline) bind(ctx context.Context) context.Context {
+	ctx, cancel := context.WithDeadline(ctx, d.deadline)
+	d.mu.Lock()
+	d.cancels = append(d.cancels, cancel)
+	d.mu.Unlock()
+	return ctx
+}
+
+func (d *requestDeadline) release() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, cancel := range d.cancels {
+		cancel()
+	}
+	d.cancels = nil
+}
+
+// deadlineMiddleware bounds every request by the deadline of its route
+// class. The deadline reaches index fetches, upstream downloads and storage
+// calls through the request context, so no handler can hang indefinitely.
+func deadlineMiddleware(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, timeout := routeTimeout(cfg, c.FullPath())
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		deadline := &requestDeadline{deadline: time.Now().Add(timeout)}
+		ctx, cancel := context.WithDeadline(c.Request.Context(), deadline.deadline)
+		defer cancel()
+		defer deadline.release()
+		c.Request = c.Request.WithContext(ctx)
+		c.Set(deadlineKey, deadline)
+
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			requestLog(c).Warn().
+				Str("route", c.FullPath()).
+				Str("class", class).
+				Dur("timeout", timeout).
+				Msg("Request deadline exceeded")
+		}
+	}
+}
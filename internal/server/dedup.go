@@ -0,0 +1,44 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// serveByHash serves a file already cached with the given SHA-256 digest,
+// under another key or by another index of this groxpi, instead of
+// downloading the same bytes again. It reports whether it answered.
+func (s *Server) serveByHash(c *gin.Context, sha256 string) bool {
+	if sha256 == "" {
+		return false
+	}
+
+	ctx := requestContext(c)
+	peers := s.hashPeers
+	if peers == nil {
+		peers = []*Server{s}
+	}
+	for _, peer := range peers {
+		if peer.catalog == nil {
+			continue
+		}
+		key, ok := peer.catalog.KeyForHash(sha256)
+		if !ok {
+			continue
+		}
+		if exists, _ := peer.storage.Exists(ctx, key); !exists {
+			continue
+		}
+
+		requestLog(c).Info().
+			Str("sha256", sha256).
+			Str("storage_key", key).
+			Str("index", peer.config.BasePath+"/").
+			Msg("✅ Serving identical file cached under another name")
+		s.dedupHits.Add(1)
+		if err := peer.serveFromStorageOptimized(c, key); err != nil {
+			requestLog(c).Error().Err(err).Str("storage_key", key).Msg("Failed to serve from storage")
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/pypi"
+)
+
+const (
+	// serialHeader carries a package page's serial: the upload time of its
+	// newest file, in microseconds since the epoch
+	serialHeader = "X-Groxpi-Serial"
+
+	// sinceHeader asks for only the files uploaded after a serial; the
+	// since query parameter does the same
+	sinceHeader = "X-Groxpi-Since"
+
+	deltaKey = "delta"
+)
+
+// projectSerial returns the serial of a package's files, 0 when upstream
+// gave none of them an upload time
+func projectSerial(files []pypi.FileInfo) int64 {
+	var serial int64
+	for i := range files {
+		if uploaded, ok := uploadTime(&files[i]); ok {
+			serial = max(serial, uploaded.UnixMicro())
+		}
+	}
+	return serial
+}
+
+func uploadTime(file *pypi.FileInfo) (time.Time, bool) {
+	if file.UploadTime == "" {
+		return time.Time{}, false
+	}
+	uploaded, err := time.Parse(time.RFC3339Nano, file.UploadTime)
+	return uploaded, err == nil
+}
+
+// requestedSince returns the serial a client wants the files since, from
+// X-Groxpi-Since or the since query parameter, and whether it asked
+func requestedSince(c *gin.Context) (int64, bool, error) {
+	value := c.GetHeader(sinceHeader)
+	if value == "" {
+		value = c.Query("since")
+	}
+	if value == "" {
+		return 0, false, nil
+	}
+	serial, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || serial < 0 {
+		return 0, false, fmt.Errorf("invalid serial %q", value)
+	}
+	return serial, true, nil
+}
+
+// projectSince returns a copy of project listing only the files uploaded
+// after serial. Files without an upload time can't be placed, so they are
+// always listed. Yanks of older files are not reflected.
+func projectSince(project *pypi.Project, serial int64) *pypi.Project {
+	delta := *project
+	delta.Files = nil
+	for i := range project.Files {
+		if uploaded, ok := uploadTime(&project.Files[i]); ok && uploaded.UnixMicro() <= serial {
+			continue
+		}
+		delta.Files = append(delta.Files, project.Files[i])
+	}
+	return &delta
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/storage"
+	"github.com/huyhandes/groxpi/internal/streaming"
+)
+
+// downloadContext is the context a file is streamed from upstream under:
+// it carries the file's metadata to storage, and lets a download whose
+// client disconnects late finish into the cache rather than be wasted.
+// ctx, from requestContext, outlives the request, so the disconnect is
+// watched for on the request's own context.
+func (s *Server) downloadContext(c *gin.Context, ctx context.Context, metadata map[string]string) context.Context {
+	ctx = storage.WithMetadata(ctx, metadata)
+	ctx = streaming.WithClient(ctx, c.Request.Context())
+	return streaming.WithCompletionThreshold(ctx, s.config.DisconnectCompleteThreshold)
+}
+
+// logClientGone records a download whose client disconnected mid-stream,
+// with result set when it was finished into storage regardless. There is no
+// one left to answer, so only an aborted download is returned as an error.
+func (s *Server) logClientGone(c *gin.Context, packageName, fileName string, result *streaming.StreamResult, err error) error {
+	if result == nil {
+		requestLog(c).Info().
+			Err(err).
+			Str("package", packageName).
+			Str("file", fileName).
+			Msg("Client disconnected early, upstream download aborted")
+		return err
+	}
+
+	event := requestLog(c).Info()
+	if result.Error != nil {
+		event = requestLog(c).Warn().Err(result.Error)
+	}
+	event.
+		Str("package", packageName).
+		Str("file", fileName).
+		Int64("size", result.Size).
+		Bool("cached", result.Error == nil).
+		Msg("Client disconnected late, finished download into the cache")
+	return nil
+}
@@ -232,6 +232,32 @@ func TestServer_DownloadCoordinator_Cleanup(t *testing.T) {
 }
 
 // TestServer_CalculateDynamicTimeout tests timeout calculation for various file sizes
+// TestDownloadCoordinator_Claim tests that a claimed download blocks a
+// second claim until its outcome is reported
+func TestDownloadCoordinator_Claim(t *testing.T) {
+	coord := newDownloadCoordinator()
+
+	done, ok := coord.claim("six/six.whl", "packages/six/six.whl")
+	if !ok {
+		t.Fatal("Expected first claim to succeed")
+	}
+	if _, ok := coord.claim("six/six.whl", "packages/six/six.whl"); ok {
+		t.Error("Expected second claim to fail while the first is running")
+	}
+
+	coord.mu.RLock()
+	status := coord.downloads["six/six.whl"]
+	coord.mu.RUnlock()
+
+	done(nil)
+	status.waitGroup.Wait()
+	status.mu.RLock()
+	defer status.mu.RUnlock()
+	if !status.completed || status.inProgress || status.error != nil {
+		t.Errorf("Expected a completed download, got completed=%v inProgress=%v err=%v", status.completed, status.inProgress, status.error)
+	}
+}
+
 func TestServer_CalculateDynamicTimeout(t *testing.T) {
 	cfg := &config.Config{
 		IndexURL:        "https://pypi.org/simple/",
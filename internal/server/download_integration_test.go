@@ -1,6 +1,8 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,6 +16,7 @@ import (
 	"github.com/bytedance/sonic"
 	"github.com/gin-gonic/gin"
 	"github.com/huyhandes/groxpi/internal/config"
+	"github.com/huyhandes/groxpi/internal/testsupport"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -298,3 +301,96 @@ func TestServer_DownloadCoordination_RealWorld(t *testing.T) {
 			numClients, duration)
 	})
 }
+
+// TestServer_DownloadCacheServe_Integration covers the path from a client
+// request through the upstream index and download into storage and back
+// out of the cache, against a fake index with injected faults
+func TestServer_DownloadCacheServe_Integration(t *testing.T) {
+	t.Run("local", func(t *testing.T) {
+		testDownloadCacheServe(t, func(cfg *config.Config) {})
+	})
+
+	t.Run("hybrid", func(t *testing.T) {
+		minio := testsupport.StartMinIO(t)
+		testDownloadCacheServe(t, func(cfg *config.Config) {
+			cfg.StorageType = "hybrid"
+			cfg.LocalCacheDir = t.TempDir()
+			cfg.LocalCacheSize = 10 * 1024 * 1024
+			cfg.S3Endpoint = minio.Endpoint
+			cfg.S3AccessKeyID = minio.AccessKey
+			cfg.S3SecretAccessKey = minio.SecretKey
+			cfg.S3Region = minio.Region
+			cfg.S3Bucket = minio.Bucket
+			cfg.S3Prefix = minio.Prefix
+			cfg.S3ForcePathStyle = true
+		})
+		assert.Contains(t, minio.Keys(t), "packages/six/six-1.16.0-py2.py3-none-any.whl", "Expected the download stored in S3")
+	})
+}
+
+func testDownloadCacheServe(t *testing.T, configure func(cfg *config.Config)) {
+	const (
+		pkg       = "six"
+		filename  = "six-1.16.0-py2.py3-none-any.whl"
+		truncated = "six-1.16.0.tar.gz"
+	)
+	content := bytes.Repeat([]byte("six wheel "), 10000)
+
+	index := testsupport.NewFakeIndex(t)
+	index.AddFile(pkg, filename, content)
+	index.AddFile(pkg, truncated, content)
+
+	cfg := &config.Config{
+		IndexURL:        index.IndexURL,
+		CacheDir:        t.TempDir(),
+		DownloadTimeout: 10 * time.Second,
+		LogLevel:        "ERROR",
+	}
+	configure(cfg)
+	srv, err := Open(cfg)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer srv.Close()
+	router := srv.Router()
+
+	get := func(path string) (int, []byte) {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "application/vnd.pypi.simple.v1+json")
+		resp := testRequestIntegration(router, req)
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, body
+	}
+
+	// A throttled index turns into 503 until its Retry-After passes
+	index.Inject(index.PagePath(pkg), testsupport.Fault{Status: http.StatusTooManyRequests, RetryAfter: time.Second})
+	if status, _ := get("/simple/" + pkg + "/"); status != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 while throttled, got %d", status)
+	}
+	assert.Eventually(t, func() bool {
+		status, body := get("/simple/" + pkg + "/")
+		return status == http.StatusOK && bytes.Contains(body, []byte(filename))
+	}, 5*time.Second, 100*time.Millisecond, "Expected the file list once the backoff passed")
+
+	// A download cut off mid-body is not cached
+	index.Inject(index.FilePath(pkg, truncated), testsupport.Fault{Latency: 20 * time.Millisecond, Truncate: 1000})
+	if status, body := get("/simple/" + pkg + "/" + truncated); status == http.StatusOK && bytes.Equal(body, content) {
+		t.Fatal("Expected the truncated download to fail")
+	}
+	if exists, _ := srv.storage.Exists(context.Background(), srv.keys.Key(pkg, truncated)); exists {
+		t.Error("Expected the truncated download not to be stored")
+	}
+
+	// A complete download is cached and served from storage afterwards
+	for i := 0; i < 3; i++ {
+		status, body := get("/simple/" + pkg + "/" + filename)
+		if status != http.StatusOK || !bytes.Equal(body, content) {
+			t.Fatalf("Request %d: expected the full file, got %d with %d bytes", i, status, len(body))
+		}
+	}
+	if requests := index.Requests(index.FilePath(pkg, filename)); requests != 1 {
+		t.Errorf("Expected one upstream download, got %d", requests)
+	}
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/config"
+	"github.com/huyhandes/groxpi/internal/storage"
+	"github.com/huyhandes/groxpi/internal/testsupport"
+)
+
+// The download path benchmarks serve files through a real listener, so the
+// storage, streaming and response writing code runs as in production. Run
+// them with
+//
+//	go test -run '^$' -bench BenchmarkDownloadPath -benchmem ./internal/server/
+//
+// and compare runs with benchstat. The warm_l2 scenario needs MinIO, as the
+// integration tests do, and is skipped without it.
+
+const (
+	downloadBenchFileSize    = 1024 * 1024
+	downloadBenchConcurrency = 16
+)
+
+// downloadBench is a server with a fake index behind it
+type downloadBench struct {
+	index  *testsupport.FakeIndex
+	srv    *Server
+	url    string
+	client *http.Client
+	data   []byte
+}
+
+func newDownloadBench(b *testing.B, configure func(cfg *config.Config)) *downloadBench {
+	b.Helper()
+
+	// The request log would dominate the profile
+	writer := gin.DefaultWriter
+	gin.DefaultWriter = io.Discard
+	b.Cleanup(func() { gin.DefaultWriter = writer })
+
+	d := &downloadBench{
+		index: testsupport.NewFakeIndex(b),
+		data:  bytes.Repeat([]byte("groxpi benchmark "), downloadBenchFileSize/17+1)[:downloadBenchFileSize],
+	}
+	cfg := &config.Config{
+		IndexURL:        d.index.IndexURL,
+		CacheDir:        b.TempDir(),
+		DownloadTimeout: 30 * time.Second,
+		LogLevel:        "ERROR",
+	}
+	configure(cfg)
+
+	srv, err := Open(cfg)
+	if err != nil {
+		b.Fatalf("Open failed: %v", err)
+	}
+	b.Cleanup(srv.Close)
+	d.srv = srv
+
+	listener := httptest.NewServer(srv.Handler())
+	b.Cleanup(listener.Close)
+	d.url = listener.URL
+	d.client = &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: downloadBenchConcurrency}}
+	return d
+}
+
+// add publishes a new file, returning its package and name
+func (d *downloadBench) add(i int) (string, string) {
+	pkg := fmt.Sprintf("bench-%d", i)
+	filename := pkg + "-1.0.0-py3-none-any.whl"
+	d.index.AddFile(pkg, filename, d.data)
+	return pkg, filename
+}
+
+// get downloads a file in full
+func (d *downloadBench) get(b *testing.B, pkg, filename string) {
+	resp, err := d.client.Get(d.url + "/simple/" + pkg + "/" + filename)
+	if err != nil {
+		b.Errorf("Download failed: %v", err)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	n, err := io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK || err != nil || n != int64(len(d.data)) {
+		b.Errorf("Expected the full file, got %d with %d bytes (%v)", resp.StatusCode, n, err)
+	}
+}
+
+// forget deletes a file from storage so disk use stays flat however many
+// iterations run
+func (d *downloadBench) forget(b *testing.B, pkg, filename string) {
+	if err := d.srv.storage.Delete(context.Background(), d.srv.keys.Key(pkg, filename)); err != nil {
+		b.Fatalf("Failed to delete %s: %v", filename, err)
+	}
+}
+
+// BenchmarkDownloadPath measures a download end to end in each cache state
+// a request can find a file in
+func BenchmarkDownloadPath(b *testing.B) {
+	// Nothing cached: the file is listed, downloaded from the index and
+	// streamed to the client while it is stored
+	b.Run("cold_miss", func(b *testing.B) {
+		d := newDownloadBench(b, func(cfg *config.Config) {})
+		b.SetBytes(downloadBenchFileSize)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			pkg, filename := d.add(i)
+			b.StartTimer()
+
+			d.get(b, pkg, filename)
+
+			b.StopTimer()
+			d.forget(b, pkg, filename)
+			b.StartTimer()
+		}
+	})
+
+	// Cached on local disk, the only tier of local storage and the L1 tier
+	// of hybrid storage
+	b.Run("warm_l1", func(b *testing.B) {
+		d := newDownloadBench(b, func(cfg *config.Config) {})
+		pkg, filename := d.add(0)
+		d.get(b, pkg, filename)
+
+		b.SetBytes(downloadBenchFileSize)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			d.get(b, pkg, filename)
+		}
+	})
+
+	// Cached in memory storage: the handler path without disk or network
+	b.Run("warm_memory", func(b *testing.B) {
+		d := newDownloadBench(b, func(cfg *config.Config) {
+			cfg.StorageType = "memory"
+			cfg.CacheSize = 64 * 1024 * 1024
+		})
+		pkg, filename := d.add(0)
+		d.get(b, pkg, filename)
+
+		b.SetBytes(downloadBenchFileSize)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			d.get(b, pkg, filename)
+		}
+	})
+
+	// Cached in S3 only, as after a restart on a fresh node: served from the
+	// L2 tier and copied into L1
+	b.Run("warm_l2", func(b *testing.B) {
+		minio := testsupport.StartMinIO(b)
+		d := newDownloadBench(b, func(cfg *config.Config) {
+			cfg.StorageType = "hybrid"
+			cfg.LocalCacheDir = b.TempDir()
+			cfg.LocalCacheSize = 1024 * 1024 * 1024
+			cfg.S3Endpoint = minio.Endpoint
+			cfg.S3AccessKeyID = minio.AccessKey
+			cfg.S3SecretAccessKey = minio.SecretKey
+			cfg.S3Region = minio.Region
+			cfg.S3Bucket = minio.Bucket
+			cfg.S3Prefix = minio.Prefix
+			cfg.S3ForcePathStyle = true
+		})
+		l2, err := storage.NewS3Storage(&storage.S3Config{
+			Endpoint:        minio.Endpoint,
+			AccessKeyID:     minio.AccessKey,
+			SecretAccessKey: minio.SecretKey,
+			Region:          minio.Region,
+			Bucket:          minio.Bucket,
+			Prefix:          minio.Prefix,
+			ForcePathStyle:  true,
+		})
+		if err != nil {
+			b.Fatalf("Failed to open S3 storage: %v", err)
+		}
+		b.Cleanup(func() { _ = l2.Close() })
+
+		b.SetBytes(downloadBenchFileSize)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			pkg, filename := d.add(i)
+			if _, err := l2.Put(context.Background(), d.srv.keys.Key(pkg, filename), bytes.NewReader(d.data), int64(len(d.data)), "application/octet-stream"); err != nil {
+				b.Fatalf("Failed to seed S3: %v", err)
+			}
+			b.StartTimer()
+
+			d.get(b, pkg, filename)
+
+			b.StopTimer()
+			d.forget(b, pkg, filename)
+			b.StartTimer()
+		}
+		b.StopTimer()
+		if requests := d.index.Requests(d.index.FilePath("bench-0", "bench-0-1.0.0-py3-none-any.whl")); requests != 0 {
+			b.Errorf("Expected files to be served from S3, got %d upstream downloads", requests)
+		}
+	})
+
+	// Many clients asking for the same uncached file at once: one upstream
+	// download shared by all of them
+	b.Run("concurrent_same_file", func(b *testing.B) {
+		d := newDownloadBench(b, func(cfg *config.Config) {})
+		var upstream int
+		b.SetBytes(downloadBenchFileSize * downloadBenchConcurrency)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			pkg, filename := d.add(i)
+			b.StartTimer()
+
+			var wg sync.WaitGroup
+			for range downloadBenchConcurrency {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					d.get(b, pkg, filename)
+				}()
+			}
+			wg.Wait()
+
+			b.StopTimer()
+			upstream += d.index.Requests(d.index.FilePath(pkg, filename))
+			d.forget(b, pkg, filename)
+			b.StartTimer()
+		}
+		b.ReportMetric(float64(upstream)/float64(b.N), "upstream/op")
+	})
+}
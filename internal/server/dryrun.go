@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/gc"
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// dryRun parses the dry_run query parameter of destructive endpoints,
+// answering 400 and reporting false as ok when it is not a boolean
+func dryRun(c *gin.Context) (dry, ok bool) {
+	raw := c.Query("dry_run")
+	if raw == "" {
+		return false, true
+	}
+	dry, err := strconv.ParseBool(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Query parameter 'dry_run' must be true or false",
+		})
+		return false, false
+	}
+	return dry, true
+}
+
+// previewPackageFiles reports the cached files a purge of packageName would
+// remove, under the current key layout and the fallback one, without
+// touching them
+func (s *Server) previewPackageFiles(ctx context.Context, packageName string) (gin.H, error) {
+	prefixes := []string{s.keys.PackagePrefix(packageName)}
+	if s.fallbackKeys != nil {
+		if prefix := s.fallbackKeys.PackagePrefix(packageName); prefix != prefixes[0] {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	files := 0
+	var size int64
+	sample := []string{}
+	for _, prefix := range prefixes {
+		objects, err := s.storage.List(ctx, storage.ListOptions{Prefix: prefix})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list cached files: %w", err)
+		}
+		for _, obj := range objects {
+			files++
+			size += obj.Size
+			if len(sample) < gc.SampleSize {
+				sample = append(sample, obj.Key)
+			}
+		}
+	}
+
+	return gin.H{"package": packageName, "files": files, "bytes": size, "sample": sample}, nil
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
+	"github.com/huyhandes/groxpi/internal/pypi"
+	"github.com/huyhandes/groxpi/internal/storage"
+	"github.com/huyhandes/groxpi/internal/streaming"
+)
+
+// handleFilesProxy serves an absolute upstream file URL, such as a
+// files.pythonhosted.org link pinned in an old lockfile, through the cache.
+// The URL follows /files/ either as is (/files/https://host/path),
+// percent-encoded, or without its scheme (/files/host/path, https implied).
+// Only files the index lists are served: they are fetched from the URL the
+// index gives, checked against its SHA-256, and cached under the same key as
+// when requested through the index.
+func (s *Server) handleFilesProxy(c *gin.Context) {
+	fileURL, ok := s.passthroughURL(c.Param("url"))
+	if !ok {
+		c.String(http.StatusForbidden, "URL not allowed")
+		return
+	}
+
+	fileName := path.Base(fileURL.Path)
+	packageName := cachekey.Package(pypi.FilePackage(fileName))
+	if packageName == "" {
+		c.String(http.StatusNotFound, "Not a package file")
+		return
+	}
+	// A routed package comes from its own index only, never from a URL that
+	// may point at a public copy of the name
+	if _, routed := s.config.RouteFor(packageName); routed {
+		requestLog(c).Info().Str("package", packageName).Str("url", fileURL.String()).Msg("Passthrough request rejected for a routed package")
+		c.String(http.StatusForbidden, "Package is served from its routed index only")
+		return
+	}
+	if !s.checkFileRequest(c, packageName, fileName) {
+		return
+	}
+	defer measureDownload(c, packageName, fileName)()
+
+	ctx := requestContext(c)
+	storageKey := s.keys.Key(packageName, fileName)
+	if s.isCached(ctx, packageName, fileName) {
+		requestLog(c).Debug().Str("url", fileURL.String()).Msg("✅ Serving passthrough file from storage cache")
+		if err := s.serveFromStorageOptimized(c, storageKey); err != nil {
+			requestLog(c).Error().Err(err).Str("storage_key", storageKey).Msg("Failed to serve from storage")
+			c.String(http.StatusInternalServerError, "Failed to serve file")
+		}
+		return
+	}
+
+	// Only files the index lists are fetched, with its size and hashes, so
+	// the passthrough can't bring in what the constraints or the quarantine
+	// hold back
+	files, err := s.getPackageFiles(c, packageName)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.String(http.StatusNotFound, "Package not found")
+			return
+		}
+		requestLog(c).Error().Err(err).Str("package", packageName).Msg("Failed to fetch package files")
+		respondUpstreamError(c, err, "Error fetching package")
+		return
+	}
+	i := slices.IndexFunc(files, func(f pypi.FileInfo) bool { return f.Name == fileName })
+	if i < 0 {
+		c.String(http.StatusNotFound, "File not found")
+		return
+	}
+	// The requested URL only names the file; the index's URL is fetched, so
+	// a path on an allowed host can't be used to cache other content
+	file := files[i]
+
+	if s.config.DownloadTimeout <= 0 {
+		c.Redirect(http.StatusFound, file.URL)
+		return
+	}
+	if s.memory.Shed() {
+		respondOverloaded(c)
+		return
+	}
+
+	metadata := file.StorageMetadata(time.Now())
+	if s.serveByHash(c, metadata[storage.MetaSHA256]) {
+		return
+	}
+	if s.config.RedirectsDownload(packageName, file.Size) {
+		c.Redirect(http.StatusFound, file.URL)
+		return
+	}
+
+	downloadCtx := withDigestCheck(s.downloadContext(c, ctx, metadata), metadata[storage.MetaSHA256])
+	downloadCtx, cancel := context.WithTimeout(downloadCtx, s.calculateDynamicTimeout(file.Size))
+	defer cancel()
+
+	requestLog(c).Info().
+		Str("package", packageName).
+		Str("file", fileName).
+		Str("url", file.URL).
+		Msg("🚀 Streaming passthrough file with simultaneous cache")
+
+	c.Header(cacheHeader, cacheMiss)
+	setChecksumHeaders(c, metadata[storage.MetaSHA256])
+	setDigestResumeHeaders(c, metadata[storage.MetaSHA256])
+	result, err := s.streamDownloader.DownloadAndStream(downloadCtx, file.URL, storageKey, c.Writer)
+	if errors.Is(err, streaming.ErrClientGone) {
+		_ = s.logClientGone(c, packageName, fileName, result, err)
+		return
+	}
+	if err != nil {
+		clearFileHeaders(c)
+		requestLog(c).Error().Err(err).Str("url", file.URL).Msg("Failed to stream passthrough file, redirecting upstream")
+		c.Redirect(http.StatusFound, file.URL)
+		return
+	}
+
+	requestLog(c).Info().
+		Str("package", packageName).
+		Str("file", fileName).
+		Int64("size", result.Size).
+		Bool("cached", result.Error == nil).
+		Msg("✅ Successfully streamed passthrough file to client")
+}
+
+// passthroughURL parses the URL following /files/ and checks its host
+// against the allow-list
+func (s *Server) passthroughURL(raw string) (*url.URL, bool) {
+	raw = strings.TrimPrefix(raw, "/")
+	if unescaped, err := url.PathUnescape(raw); err == nil {
+		raw = unescaped
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	fileURL, err := url.Parse(raw)
+	if err != nil || fileURL.Scheme != "https" || fileURL.User != nil {
+		return nil, false
+	}
+	if !slices.Contains(s.config.FilesProxyHosts, fileURL.Host) {
+		return nil, false
+	}
+	if fileURL.Path == "" || strings.HasSuffix(fileURL.Path, "/") {
+		return nil, false
+	}
+	return fileURL, true
+}
+
+type digestCheckKey struct{}
+
+// withDigestCheck makes storageAdapter.Put refuse to store content whose
+// SHA-256 isn't sha256Hex. An empty digest checks nothing.
+func withDigestCheck(ctx context.Context, sha256Hex string) context.Context {
+	if sha256Hex == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, digestCheckKey{}, sha256Hex)
+}
+
+// digestCheckFrom returns the digest attached by withDigestCheck, if any
+func digestCheckFrom(ctx context.Context) string {
+	sha256Hex, _ := ctx.Value(digestCheckKey{}).(string)
+	return sha256Hex
+}
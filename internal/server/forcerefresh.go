@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
+	"github.com/huyhandes/groxpi/internal/tenant"
+)
+
+// refreshHeader carries a refresh token on a package page or file request
+// whose answer must come from upstream, e.g. to check a release published
+// moments ago
+const refreshHeader = "X-Groxpi-Refresh"
+
+// forceRefresh drops what is cached for a request carrying a valid refresh
+// token: the package's page. A file request (fileName set) is then answered
+// from upstream rather than the cache, and its download replaces the cached
+// copy once complete, so a failed refresh leaves the old one in place.
+// Nothing else is purged. It answers 403 for a header without a valid token
+// and reports whether the request refreshes and whether it may go on.
+func (s *Server) forceRefresh(c *gin.Context, packageName, fileName string) (refresh, ok bool) {
+	token := c.GetHeader(refreshHeader)
+	if token == "" {
+		return false, true
+	}
+	if !tenant.Tokens(s.config.RefreshTokens).Has(token) {
+		c.String(http.StatusForbidden, "Invalid refresh token")
+		return false, false
+	}
+
+	s.indexCache.InvalidatePackage(packageName)
+	s.responseCache.Invalidate(cachekey.ProjectResponse(packageName))
+	if fileName != "" {
+		s.downloadCoord.forget(cachekey.Download(packageName, fileName))
+	}
+
+	requestLog(c).Info().
+		Str("package", packageName).
+		Str("file", fileName).
+		Msg("🔄 Refreshing from upstream on request")
+	return true, true
+}
+
+// dropFallbackCopy removes the copy of a refreshed file still stored under
+// the fallback key layout, which would otherwise outlive the new download
+func (s *Server) dropFallbackCopy(c *gin.Context, packageName, fileName string) {
+	if s.fallbackKeys == nil {
+		return
+	}
+	key := s.fallbackKeys.Key(packageName, fileName)
+	if err := s.storage.Delete(requestContext(c), key); err != nil {
+		requestLog(c).Warn().Err(err).Str("storage_key", key).Msg("Failed to drop the fallback copy of a refreshed file")
+	}
+}
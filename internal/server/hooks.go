@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/clientid"
+)
+
+// Hooks lets programs embedding groxpi apply their own policy (license
+// checks, tagging, auditing) at points of the request lifecycle without
+// changing handler code. Embed NopHooks to implement only some methods.
+// Hooks run on the request path and must be safe for concurrent use.
+type Hooks interface {
+	// OnIndexRequest runs before a package's file list is served. Returning
+	// an error rejects the request with 403 Forbidden and the error message.
+	OnIndexRequest(ctx context.Context, req IndexRequest) error
+
+	// OnFileRequest runs before a package file is served, whether cached or
+	// not. Returning an error rejects the request with 403 Forbidden.
+	OnFileRequest(ctx context.Context, req FileRequest) error
+
+	// OnFileCached runs after a file has been written to storage, including
+	// files fetched by mirroring and cache warming
+	OnFileCached(ctx context.Context, event FileCached)
+
+	// OnUpstreamError runs when fetching index metadata from upstream fails
+	OnUpstreamError(ctx context.Context, event UpstreamError)
+}
+
+// IndexRequest describes a request for a package's file list
+type IndexRequest struct {
+	Index   string // Upstream index URL, telling mounted indexes apart
+	Package string // Normalized package name
+	Client  clientid.Identity
+	Request *http.Request
+}
+
+// FileRequest describes a request for a package file
+type FileRequest struct {
+	Index   string
+	Package string
+	File    string
+	Client  clientid.Identity
+	Request *http.Request
+}
+
+// FileCached describes a file written to storage
+type FileCached struct {
+	Index   string
+	Package string
+	File    string
+	Key     string // Storage key
+	Size    int64
+}
+
+// UpstreamError describes a failed upstream index fetch
+type UpstreamError struct {
+	Index   string
+	Package string // Empty for the package list
+	Err     error
+}
+
+// NopHooks implements every hook as a no-op
+type NopHooks struct{}
+
+func (NopHooks) OnIndexRequest(context.Context, IndexRequest) error { return nil }
+func (NopHooks) OnFileRequest(context.Context, FileRequest) error   { return nil }
+func (NopHooks) OnFileCached(context.Context, FileCached)           {}
+func (NopHooks) OnUpstreamError(context.Context, UpstreamError)     {}
+
+// hookList runs registered hooks in order; the first error rejects
+type hookList []Hooks
+
+func (hl hookList) indexRequest(ctx context.Context, req IndexRequest) error {
+	for _, h := range hl {
+		if err := h.OnIndexRequest(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (hl hookList) fileRequest(ctx context.Context, req FileRequest) error {
+	for _, h := range hl {
+		if err := h.OnFileRequest(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (hl hookList) fileCached(ctx context.Context, event FileCached) {
+	for _, h := range hl {
+		h.OnFileCached(ctx, event)
+	}
+}
+
+func (hl hookList) upstreamError(ctx context.Context, event UpstreamError) {
+	for _, h := range hl {
+		h.OnUpstreamError(ctx, event)
+	}
+}
+
+// checkIndexRequest runs the index request hooks and answers 403 when one
+// rejects; it reports whether the request may proceed
+func (s *Server) checkIndexRequest(c *gin.Context, packageName string) bool {
+	if len(s.hooks) == 0 {
+		return true
+	}
+	err := s.hooks.indexRequest(requestContext(c), IndexRequest{
+		Index:   s.config.IndexURL,
+		Package: packageName,
+		Client:  clientIdentity(c),
+		Request: c.Request,
+	})
+	if err != nil {
+		requestLog(c).Info().Err(err).Str("package", packageName).Msg("Index request rejected by hook")
+		respondForbidden(c, err)
+		return false
+	}
+	return true
+}
+
+// checkFileRequest enforces the version constraints and the quarantine and
+// runs the file request hooks, answering 403 when any rejects; it reports
+// whether the request may proceed
+func (s *Server) checkFileRequest(c *gin.Context, packageName, fileName string) bool {
+	if !s.constraints.AllowsFile(packageName, fileName) {
+		requestLog(c).Info().Str("package", packageName).Str("file", fileName).Msg("File request rejected by version constraints")
+		respondForbidden(c, fmt.Errorf("%s is excluded by the version constraint %s%s", fileName, packageName, s.constraints.Specifiers(packageName)))
+		return false
+	}
+	if s.quarantinedFile(requestContext(c), packageName, fileName) {
+		requestLog(c).Info().Str("package", packageName).Str("file", fileName).Msg("File request rejected by quarantine")
+		respondForbidden(c, fmt.Errorf("%s is quarantined for %s after its upload", fileName, s.quarantine.Window))
+		return false
+	}
+	if len(s.hooks) == 0 {
+		return true
+	}
+	err := s.hooks.fileRequest(requestContext(c), FileRequest{
+		Index:   s.config.IndexURL,
+		Package: packageName,
+		File:    fileName,
+		Client:  clientIdentity(c),
+		Request: c.Request,
+	})
+	if err != nil {
+		requestLog(c).Info().Err(err).Str("package", packageName).Str("file", fileName).Msg("File request rejected by hook")
+		respondForbidden(c, err)
+		return false
+	}
+	return true
+}
+
+func respondForbidden(c *gin.Context, err error) {
+	if wantsJSON(c) || strings.Contains(c.GetHeader("Accept"), "application/json") {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+	c.String(http.StatusForbidden, err.Error())
+}
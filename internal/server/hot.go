@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
+	"github.com/huyhandes/groxpi/internal/cadence"
+	"github.com/huyhandes/groxpi/internal/pypi"
+)
+
+// projectTTL is how long a package's files stay cached. Hot packages are
+// kept longer, as they are refreshed in the background well before then;
+// the extra time only matters while upstream is failing.
+func (s *Server) projectTTL(packageName string) time.Duration {
+	ttl := s.packageTTL(packageName)
+	if s.hot.Hot(packageName) && s.config.HotTTLFactor > 1 {
+		return time.Duration(float64(ttl) * s.config.HotTTLFactor)
+	}
+	return ttl
+}
+
+// packageTTL is how long a package's files are fresh: the index TTL, or with
+// adaptive TTLs, what the package's release cadence so far allows
+func (s *Server) packageTTL(packageName string) time.Duration {
+	if ttl, ok := s.cadence.TTL(packageName); ok {
+		return ttl
+	}
+	return s.config.IndexTTL
+}
+
+// fileListFingerprint identifies a package's files and their yanked state,
+// so adaptive TTLs notice releases and yanks but not reordered metadata
+func fileListFingerprint(project *pypi.Project) uint64 {
+	names := make([]string, len(project.Files))
+	yanked := make([]bool, len(project.Files))
+	for i := range project.Files {
+		names[i] = project.Files[i].Name
+		yanked[i] = project.Files[i].IsYanked()
+	}
+	return cadence.Fingerprint(names, yanked)
+}
+
+// hotPackageDue reports whether a hot package's cached files would go stale
+// before the next refresh round, or aren't cached at all
+func (s *Server) hotPackageDue(packageName string) bool {
+	age, cached := s.indexCache.PackageAge(packageName)
+	return !cached || age >= s.packageTTL(packageName)-s.config.HotRefreshInterval
+}
+
+// refreshHotPackage fetches a hot package's files into the index cache and
+// drops its rendered response
+func (s *Server) refreshHotPackage(ctx context.Context, packageName string) error {
+	if _, err := s.fetchProject(ctx, packageName); err != nil {
+		return err
+	}
+	s.responseCache.Invalidate(cachekey.ProjectResponse(packageName))
+	return nil
+}
+
+func (s *Server) handleStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"hot_packages": s.hot.Stats(),
+			"adaptive_ttl": s.cadence.Stats(),
+			"clients":      s.clientStats.Snapshot(),
+		},
+	})
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/jobs"
+)
+
+// acceptJob answers a request that started a background job
+func (s *Server) acceptJob(c *gin.Context, job jobs.Job) {
+	c.Header("Location", s.config.BasePath+"/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, gin.H{
+		"status": "success",
+		"data":   job,
+	})
+}
+
+// handleListJobs lists recent jobs, newest first, optionally filtered by
+// ?kind=warm|mirror|gc|export
+func (s *Server) handleListJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   s.jobs.List(c.Query("kind")),
+	})
+}
+
+// handleGetJob reports a job's state and progress
+func (s *Server) handleGetJob(c *gin.Context) {
+	job, ok := s.jobs.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Job not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   job,
+	})
+}
+
+// handleCancelJob stops a running job. Work already done is kept.
+func (s *Server) handleCancelJob(c *gin.Context) {
+	err := s.jobs.Cancel(c.Param("id"))
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Job not found",
+		})
+		return
+	case errors.Is(err, jobs.ErrFinished):
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  "error",
+			"message": "Job already finished",
+		})
+		return
+	}
+
+	job, _ := s.jobs.Get(c.Param("id"))
+	c.JSON(http.StatusAccepted, gin.H{
+		"status": "success",
+		"data":   job,
+	})
+}
+
+// handleJobArtifact downloads the output of a completed job, such as the
+// archive written by POST /cache/export
+func (s *Server) handleJobArtifact(c *gin.Context) {
+	job, ok := s.jobs.Get(c.Param("id"))
+	if !ok || job.Artifact == "" || job.State != jobs.StateCompleted {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Job has no artifact",
+		})
+		return
+	}
+
+	reader, info, err := s.storage.Get(requestContext(c), job.Artifact)
+	if err != nil {
+		requestLog(c).Warn().Err(err).Str("job", job.ID).Msg("Failed to open job artifact")
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Job artifact unavailable",
+		})
+		return
+	}
+	defer func() { _ = reader.Close() }()
+
+	c.DataFromReader(http.StatusOK, info.Size, info.ContentType, reader, map[string]string{
+		"Content-Disposition": `attachment; filename="groxpi-` + job.Kind + `-` + job.ID + `.tar"`,
+	})
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// limitsMiddleware rejects oversized request URLs before any handler or
+// upstream lookup runs, and caps request bodies. A zero limit disables that
+// check.
+func limitsMiddleware(maxURLLength int, maxBodyBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxURLLength > 0 && len(c.Request.RequestURI) > maxURLLength {
+			c.String(http.StatusRequestURITooLong, "Request URL too long")
+			c.Abort()
+			return
+		}
+
+		if maxBodyBytes > 0 && c.Request.Body != nil {
+			if c.Request.ContentLength > maxBodyBytes {
+				c.String(http.StatusRequestEntityTooLarge, "Request body too large")
+				c.Abort()
+				return
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes)
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/logger"
+	"github.com/huyhandes/groxpi/internal/tenant"
+)
+
+// adminTokenHeader carries an admin token. It is separate from the
+// Authorization header, which holds the client token when AuthTokens is set.
+const adminTokenHeader = "X-Groxpi-Admin-Token"
+
+// logLevelRequest changes the level of one module, e.g. storage or
+// streaming, or the global level when Module is empty
+type logLevelRequest struct {
+	Module string `json:"module"`
+	Level  string `json:"level"` // Empty drops the module's own level
+}
+
+// authorizeAdmin answers 404 while no admin tokens are configured and 403
+// for a missing or invalid token, and reports whether the request may go on
+func (s *Server) authorizeAdmin(c *gin.Context) bool {
+	if len(s.config.AdminTokens) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Admin endpoints are not enabled",
+		})
+		return false
+	}
+	if token := c.GetHeader(adminTokenHeader); token == "" || !tenant.Tokens(s.config.AdminTokens).Has(token) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  "error",
+			"message": "Invalid admin token",
+		})
+		return false
+	}
+	return true
+}
+
+// handleGetLogLevel reports the global log level and the modules' own levels
+func (s *Server) handleGetLogLevel(c *gin.Context) {
+	if !s.authorizeAdmin(c) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   logLevels(),
+	})
+}
+
+// handleSetLogLevel changes a log level until the next restart
+func (s *Server) handleSetLogLevel(c *gin.Context) {
+	if !s.authorizeAdmin(c) {
+		return
+	}
+	var req logLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Module == "" && req.Level == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": `Expected {"module": "...", "level": "DEBUG|INFO|WARN|ERROR"}`,
+		})
+		return
+	}
+	if err := logger.SetLevel(req.Module, req.Level); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	requestLog(c).Warn().
+		Str("module", req.Module).
+		Str("level", req.Level).
+		Msg("Log level changed")
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   logLevels(),
+	})
+}
+
+func logLevels() gin.H {
+	level, modules := logger.Levels()
+	return gin.H{"level": level, "modules": modules}
+}
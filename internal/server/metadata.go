@@ -0,0 +1,41 @@
+package server
+
+import (
+	"github.com/huyhandes/groxpi/internal/config"
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// defaultResponseCacheSize is the memory for rendered index pages when the
+// configuration leaves it unset
+const defaultResponseCacheSize = 50 * 1024 * 1024
+
+// responseCacheSize returns the memory budget for rendered index pages
+func responseCacheSize(cfg *config.Config) int {
+	if cfg.ResponseCacheSize <= 0 {
+		return defaultResponseCacheSize
+	}
+	return int(cfg.ResponseCacheSize)
+}
+
+// initMetadataStorage opens the local LRU cache metadata documents are kept
+// in under their own size budget, or returns nil to keep them with the
+// package files
+func initMetadataStorage(cfg *config.Config) (storage.Storage, error) {
+	if cfg.MetadataCacheDir == "" {
+		return nil, nil
+	}
+	local, err := storage.NewLRULocalStorage(cfg.MetadataCacheDir, cfg.MetadataCacheSize, 0)
+	if err != nil {
+		return nil, err
+	}
+	return local, nil
+}
+
+// metadata returns the storage metadata documents such as provenance are
+// kept in
+func (s *Server) metadata() storage.Storage {
+	if s.metadataStorage != nil {
+		return s.metadataStorage
+	}
+	return s.storage
+}
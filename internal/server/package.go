@@ -0,0 +1,256 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
+	"github.com/huyhandes/groxpi/internal/distfile"
+	"github.com/huyhandes/groxpi/internal/pypi"
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// packageFileDetail describes one distribution file of a package and whether
+// groxpi currently holds it in storage
+type packageFileDetail struct {
+	Filename     string            `json:"filename"`
+	Version      string            `json:"version,omitempty"`
+	Kind         distfile.Kind     `json:"kind,omitempty"`
+	BuildTag     string            `json:"build_tag,omitempty"`
+	PythonTags   []string          `json:"python_tags,omitempty"`
+	ABITags      []string          `json:"abi_tags,omitempty"`
+	PlatformTags []string          `json:"platform_tags,omitempty"`
+	Size         int64             `json:"size,omitempty"`
+	Hashes       map[string]string `json:"hashes,omitempty"`
+	Yanked       bool              `json:"yanked,omitempty"`
+	Upstream     bool              `json:"upstream"`
+	Cached       bool              `json:"cached"`
+	CachedAt     *time.Time        `json:"cached_at,omitempty"`
+	LastAccessed *time.Time        `json:"last_accessed,omitempty"`
+	Hits         int64             `json:"hits,omitempty"`
+}
+
+// newPackageFileDetail fills in what the filename says about a file; names
+// that do not parse are still listed, just without version or tags
+func newPackageFileDetail(filename string) packageFileDetail {
+	d := packageFileDetail{Filename: filename}
+	if f, err := distfile.Parse(filename); err == nil {
+		d.Version = f.Version
+		d.Kind = f.Kind
+		d.BuildTag = f.BuildTag
+		d.PythonTags = f.PythonTags
+		d.ABITags = f.ABITags
+		d.PlatformTags = f.PlatformTags
+	}
+	return d
+}
+
+func (s *Server) handlePackageDetail(c *gin.Context) {
+	packageName := cachekey.Package(c.Param("package"))
+	if !s.checkIndexRequest(c, packageName) {
+		return
+	}
+
+	// Upstream metadata is best-effort: a package that has been removed from the
+	// index (or an unreachable index) should still show what is cached
+	files, upstreamErr := s.getPackageFiles(c, packageName)
+	if upstreamErr != nil {
+		requestLog(c).Warn().Err(upstreamErr).Str("package", packageName).Msg("Package detail without upstream metadata")
+	}
+
+	objects, err := s.storage.List(requestContext(c), storage.ListOptions{Prefix: s.keys.PackagePrefix(packageName)})
+	if err != nil {
+		requestLog(c).Error().Err(err).Str("package", packageName).Msg("Failed to list cached files")
+		c.String(http.StatusInternalServerError, "Storage error")
+		return
+	}
+
+	// Files not yet moved from the fallback key layout are cached all the same
+	if s.fallbackKeys != nil {
+		previous, err := storage.PackageObjects(requestContext(c), s.storage, s.fallbackKeys, packageName)
+		if err != nil {
+			requestLog(c).Warn().Err(err).Str("package", packageName).Msg("Failed to list files under the fallback key layout")
+		}
+		listed := make(map[string]bool, len(objects))
+		for _, obj := range objects {
+			listed[path.Base(obj.Key)] = true
+		}
+		for _, obj := range previous {
+			if !listed[path.Base(obj.Key)] {
+				objects = append(objects, obj)
+			}
+		}
+	}
+
+	if upstreamErr != nil && len(objects) == 0 {
+		if strings.Contains(upstreamErr.Error(), "not found") {
+			c.String(http.StatusNotFound, "Package not found")
+			return
+		}
+		respondUpstreamError(c, upstreamErr, "Error fetching package")
+		return
+	}
+
+	cached := make(map[string]*storage.ObjectInfo, len(objects))
+	for _, obj := range objects {
+		cached[path.Base(obj.Key)] = obj
+	}
+
+	tracker, _ := s.storage.(storage.AccessTracker)
+	details := make([]packageFileDetail, 0, len(files)+len(objects))
+	var cachedFiles int
+	var cachedBytes int64
+
+	addCached := func(d *packageFileDetail, obj *storage.ObjectInfo) {
+		d.Cached = true
+		d.Size = obj.Size
+		modified := obj.LastModified
+		d.CachedAt = &modified
+		if tracker != nil {
+			if accessed, ok := tracker.LastAccessed(obj.Key); ok {
+				d.LastAccessed = &accessed
+			}
+		}
+		if s.catalog != nil {
+			if e, ok := s.catalog.Get(obj.Key); ok {
+				d.Hits = e.Hits
+			}
+		}
+		cachedFiles++
+		cachedBytes += obj.Size
+	}
+
+	for _, file := range files {
+		d := newPackageFileDetail(file.Name)
+		d.Size = file.Size
+		d.Hashes = file.Hashes
+		d.Yanked = file.IsYanked()
+		d.Upstream = true
+		if obj, ok := cached[file.Name]; ok {
+			addCached(&d, obj)
+			delete(cached, file.Name)
+		}
+		details = append(details, d)
+	}
+
+	// Files still in storage but no longer listed upstream
+	for _, obj := range objects {
+		name := path.Base(obj.Key)
+		if _, ok := cached[name]; !ok {
+			continue
+		}
+		d := newPackageFileDetail(name)
+		addCached(&d, obj)
+		details = append(details, d)
+	}
+
+	if wantsJSON(c) || strings.Contains(c.GetHeader("Accept"), "application/json") {
+		data := gin.H{
+			"name":         packageName,
+			"total_files":  len(details),
+			"cached_files": cachedFiles,
+			"cached_bytes": cachedBytes,
+			"files":        details,
+		}
+		if upstreamErr != nil {
+			data["upstream_error"] = upstreamErr.Error()
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   data,
+		})
+		return
+	}
+
+	s.renderPackageDetail(c, packageName, details, cachedFiles, cachedBytes, upstreamErr)
+}
+
+func (s *Server) renderPackageDetail(c *gin.Context, packageName string, details []packageFileDetail, cachedFiles int, cachedBytes int64, upstreamErr error) {
+	var sb strings.Builder
+	sb.Grow(1024 + len(details)*300)
+
+	name := html.EscapeString(packageName)
+	sb.WriteString(`<!DOCTYPE html>
+<html>
+<head><title>`)
+	sb.WriteString(name)
+	sb.WriteString(` - groxpi</title></head>
+<body>
+	<h1>`)
+	sb.WriteString(name)
+	sb.WriteString(`</h1>
+`)
+	sb.WriteString(fmt.Sprintf(`	<p>%d of %d files cached (%s). <a href="%s/simple/%s/">Simple index</a></p>
+`, cachedFiles, len(details), formatBytes(cachedBytes), s.config.BasePath, name))
+
+	if upstreamErr != nil {
+		sb.WriteString(`	<p><strong>Upstream index unavailable:</strong> `)
+		sb.WriteString(html.EscapeString(upstreamErr.Error()))
+		sb.WriteString(`</p>
+`)
+	}
+
+	sb.WriteString(`	<table>
+		<tr><th>File</th><th>Version</th><th>Type</th><th>Size</th><th>Status</th><th>Last access</th><th>SHA256</th></tr>
+`)
+	for _, d := range details {
+		status := "upstream"
+		switch {
+		case d.Cached && !d.Upstream:
+			status = "cached (not upstream)"
+		case d.Cached:
+			status = "cached"
+		}
+		if d.Yanked {
+			status += ", yanked"
+		}
+
+		lastAccess := ""
+		if d.LastAccessed != nil {
+			lastAccess = d.LastAccessed.UTC().Format(time.RFC3339)
+		} else if d.CachedAt != nil {
+			lastAccess = d.CachedAt.UTC().Format(time.RFC3339)
+		}
+
+		kind := string(d.Kind)
+		if d.Kind == distfile.KindWheel {
+			kind = strings.Join(d.PythonTags, ".") + " " + strings.Join(d.PlatformTags, ".")
+		}
+
+		sb.WriteString(fmt.Sprintf(`		<tr><td><a href="%s/simple/%s/%s">%s</a></td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td><code>%s</code></td></tr>
+`,
+			s.config.BasePath, name, html.EscapeString(pypi.EscapeFileName(d.Filename)), html.EscapeString(d.Filename),
+			html.EscapeString(d.Version), html.EscapeString(kind), formatBytes(d.Size), status, lastAccess,
+			html.EscapeString(d.Hashes["sha256"])))
+	}
+	sb.WriteString(`	</table>
+	<p><a href="` + s.config.BasePath + `/">← Back to home</a></p>
+</body>
+</html>`)
+
+	c.Header("Content-Type", "text/html")
+	c.String(http.StatusOK, sb.String())
+}
+
+// formatBytes renders a byte count for humans
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n <= 0 {
+		return "-"
+	}
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/huyhandes/groxpi/internal/cachekey"
+)
+
+const (
+	// packageListFlushBytes is how much HTML is buffered before it is sent,
+	// so a full index streams in chunks instead of one tens-of-MB write
+	packageListFlushBytes     = 64 * 1024
+	maxPackageListPerPage     = 10000
+	defaultPackageListPerPage = 1000
+)
+
+// packageListPage is the slice of the package list requested with the
+// prefix, page and page_size (or per_page) query parameters; PerPage 0
+// means the whole list
+type packageListPage struct {
+	Prefix  string // Normalized, so it matches every spelling of a name
+	Page    int
+	PerPage int
+
+	rawPrefix string
+	sizeParam string // The page size parameter the client used, for links
+}
+
+// packageListPageInfo is the pagination of a JSON package list. PEP 691
+// reserves keys starting with an underscore for index servers, so it is
+// sent under _groxpi where clients that don't know it ignore it.
+type packageListPageInfo struct {
+	Prefix   string `json:"prefix,omitempty"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+	Total    int    `json:"total"`
+	Previous string `json:"previous,omitempty"`
+	Next     string `json:"next,omitempty"`
+}
+
+// parsePackageListPage reads the optional pagination and filter query
+// parameters. A page or prefix without a page size gets
+// defaultPackageListPerPage, so filtering a mirrored index doesn't return
+// all of it.
+func parsePackageListPage(c *gin.Context) (packageListPage, error) {
+	p := packageListPage{Page: 1, sizeParam: "page_size"}
+	raw := c.Query("page_size")
+	if raw == "" && c.Query("per_page") != "" {
+		raw, p.sizeParam = c.Query("per_page"), "per_page"
+	}
+	if raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return p, fmt.Errorf("query parameter '%s' must be a positive integer", p.sizeParam)
+		}
+		p.PerPage = min(n, maxPackageListPerPage)
+	}
+	if raw := c.Query("page"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return p, fmt.Errorf("query parameter 'page' must be a positive integer")
+		}
+		p.Page = n
+	}
+	if p.rawPrefix = strings.TrimSpace(c.Query("prefix")); p.rawPrefix != "" {
+		p.Prefix = cachekey.Package(p.rawPrefix)
+		// "flask-" must not match flasky
+		if p.Prefix != "" && strings.ContainsAny(p.rawPrefix[len(p.rawPrefix)-1:], "-_.") {
+			p.Prefix += "-"
+		}
+	}
+	if p.PerPage == 0 && (c.Query("page") != "" || p.rawPrefix != "") {
+		p.PerPage = defaultPackageListPerPage
+	}
+	return p, nil
+}
+
+// whole reports whether the whole, unfiltered list was requested
+func (p packageListPage) whole() bool {
+	return p.PerPage == 0 && p.rawPrefix == ""
+}
+
+// filter returns the packages whose normalized name starts with the prefix
+func (p packageListPage) filter(packages []string) []string {
+	if p.Prefix == "" {
+		return packages
+	}
+	var matched []string
+	for _, pkg := range packages {
+		if strings.HasPrefix(cachekey.Package(pkg), p.Prefix) {
+			matched = append(matched, pkg)
+		}
+	}
+	return matched
+}
+
+// bounds returns the range of a list of n packages on this page
+func (p packageListPage) bounds(n int) (start, end int) {
+	if p.PerPage == 0 {
+		return 0, n
+	}
+	start = min((p.Page-1)*p.PerPage, n)
+	end = min(start+p.PerPage, n)
+	return start, end
+}
+
+// packageListLink returns the URL of another page of the same list
+func (s *Server) packageListLink(p packageListPage, page int) string {
+	query := fmt.Sprintf("page=%d&%s=%d", page, p.sizeParam, p.PerPage)
+	if p.rawPrefix != "" {
+		query += "&prefix=" + url.QueryEscape(p.rawPrefix)
+	}
+	return s.config.BasePath + "/simple/?" + query
+}
+
+// packageListPageInfo describes a page of a list of n packages
+func (s *Server) packageListPageInfo(p packageListPage, n int) packageListPageInfo {
+	start, end := p.bounds(n)
+	info := packageListPageInfo{Prefix: p.Prefix, Page: p.Page, PageSize: p.PerPage, Total: n}
+	if start > 0 {
+		info.Previous = s.packageListLink(p, p.Page-1)
+	}
+	if end < n {
+		info.Next = s.packageListLink(p, p.Page+1)
+	}
+	return info
+}
+
+// streamPackageListHTML writes the simple index page with chunked transfer
+// encoding, flushing every packageListFlushBytes, and stops early when the
+// client goes away
+func (s *Server) streamPackageListHTML(c *gin.Context, packages []string, page packageListPage) {
+	start, end := page.bounds(len(packages))
+
+	c.Header("Content-Type", "text/html")
+	c.Status(http.StatusOK)
+
+	w := bufio.NewWriterSize(c.Writer, packageListFlushBytes)
+	flush := func() bool {
+		if err := w.Flush(); err != nil {
+			return false
+		}
+		c.Writer.Flush()
+		return true
+	}
+
+	_, _ = w.WriteString(`<!DOCTYPE html>
+<html>
+<head><title>Package Index</title></head>
+<body>
+	<h1>Simple index</h1>
+`)
+	switch {
+	case len(packages) == 0 && page.rawPrefix != "":
+		_, _ = fmt.Fprintf(w, "\t<p>No packages start with %s.</p>\n", html.EscapeString(page.rawPrefix))
+	case len(packages) == 0:
+		_, _ = w.WriteString(`	<p>No packages cached yet. Install a package to populate the cache.</p>
+`)
+	}
+
+	ctx := requestContext(c)
+	for _, pkg := range packages[start:end] {
+		name := html.EscapeString(pkg)
+		_, _ = fmt.Fprintf(w, "\t<a href=\"%s/simple/%s/\">%s</a><br/>\n", s.config.BasePath, name, name)
+		if w.Available() < 1024 {
+			if ctx.Err() != nil || !flush() {
+				requestLog(c).Debug().Msg("Package list stream aborted")
+				return
+			}
+		}
+	}
+
+	if page.PerPage > 0 {
+		_, _ = fmt.Fprintf(w, "\t<p>Packages %d-%d of %d.", min(start+1, end), end, len(packages))
+		if start > 0 {
+			_, _ = fmt.Fprintf(w, ` <a href="%s">Previous</a>`, html.EscapeString(s.packageListLink(page, page.Page-1)))
+		}
+		if end < len(packages) {
+			_, _ = fmt.Fprintf(w, ` <a href="%s">Next</a>`, html.EscapeString(s.packageListLink(page, page.Page+1)))
+		}
+		_, _ = w.WriteString("</p>\n")
+	}
+
+	_, _ = fmt.Fprintf(w, `	<p><a href="%s/">← Back to home</a></p>
+</body>
+</html>`, s.config.BasePath)
+	flush()
+}
+
+// writePackageListPageJSON writes a filtered or paginated JSON package list.
+// Pages are sliced from the cached list on each request rather than cached
+// themselves, as their combinations are endless.
+func (s *Server) writePackageListPageJSON(c *gin.Context, packages []string, page packageListPage) {
+	start, end := page.bounds(len(packages))
+	projects := make([]map[string]string, 0, end-start)
+	for _, pkg := range packages[start:end] {
+		projects = append(projects, map[string]string{"name": pkg})
+	}
+
+	data, err := s.jsonAPI().Marshal(map[string]interface{}{
+		"meta": map[string]interface{}{
+			"api-version": "1.0",
+		},
+		"projects": projects,
+		"_groxpi":  s.packageListPageInfo(page, len(packages)),
+	})
+	if err != nil {
+		c.String(http.StatusInternalServerError, "JSON encoding error")
+		return
+	}
+	c.Data(http.StatusOK, "application/vnd.pypi.simple.v1+json", data)
+}
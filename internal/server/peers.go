@@ -0,0 +1,85 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
+	"github.com/huyhandes/groxpi/internal/peer"
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// fetchFromPeer copies a file another groxpi on the LAN has cached into
+// storage and serves it. Only files listed with a SHA-256 are asked for, and
+// a copy that doesn't match is dropped before it is stored, so peers can't
+// hand out anything the index didn't publish. It reports whether it
+// answered.
+func (s *Server) fetchFromPeer(c *gin.Context, packageName, fileName, storageKey string, metadata map[string]string) bool {
+	sha256 := metadata[storage.MetaSHA256]
+	if s.peers == nil || sha256 == "" {
+		return false
+	}
+
+	ctx := requestContext(c)
+	resp, err := s.peers.Fetch(ctx, s.config.BasePath+peer.FilePath(packageName, fileName))
+	if err != nil {
+		if !errors.Is(err, peer.ErrNotCached) {
+			requestLog(c).Warn().Err(err).Str("package", packageName).Str("file", fileName).Msg("Failed to fetch file from peer")
+		}
+		return false
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if err := s.files.Put(storage.WithMetadata(ctx, metadata), storageKey, storage.Verify(resp.Body, resp.ContentLength, sha256), resp.ContentLength, resp.Header.Get("Content-Type")); err != nil {
+		requestLog(c).Warn().
+			Err(err).
+			Str("package", packageName).
+			Str("file", fileName).
+			Str("peer", resp.Request.URL.Host).
+			Msg("Failed to copy file from peer, fetching upstream")
+		return false
+	}
+
+	requestLog(c).Info().
+		Str("package", packageName).
+		Str("file", fileName).
+		Str("peer", resp.Request.URL.Host).
+		Msg("✅ Copied file from a peer on the LAN")
+	s.peerHits.Add(1)
+	c.Header(cacheHeader, cachePeer)
+	if err := s.serveFromStorageOptimized(c, storageKey); err != nil {
+		requestLog(c).Error().Err(err).Str("storage_key", storageKey).Msg("Failed to serve from storage")
+	}
+	return true
+}
+
+// handlePeerFile serves a package file to another groxpi on the LAN from the
+// cache only. A peer that doesn't have the file answers 404 rather than
+// fetching it, so requests never bounce between peers.
+func (s *Server) handlePeerFile(c *gin.Context) {
+	if s.peers == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Peer cache sharing is not enabled",
+		})
+		return
+	}
+
+	key := s.keys.Key(cachekey.Package(c.Param("package")), c.Param("file"))
+	ctx := requestContext(c)
+	if exists, _ := s.storage.Exists(ctx, key); !exists {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if c.Request.Method == http.MethodHead {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	if err := s.serveFromStorageOptimized(c, key); err != nil {
+		requestLog(c).Error().Err(err).Str("storage_key", key).Msg("Failed to serve file to peer")
+		c.String(http.StatusInternalServerError, "Failed to serve file")
+	}
+}
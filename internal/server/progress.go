@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Trailers sent after a file's body. HTTP/1.1 only carries them on chunked
+// responses, so files of known length get them over HTTP/2 only; the
+// download log event has the same figures either way.
+const (
+	bytesTrailer    = "X-Groxpi-Bytes"    // Bytes served
+	durationTrailer = "X-Groxpi-Duration" // Seconds taken
+	speedTrailer    = "X-Groxpi-Speed"    // Bytes per second
+)
+
+// measureDownload times a file download. The returned function, called
+// once the response is written, sends the bytes served, duration and
+// effective speed as trailers and logs them.
+func measureDownload(c *gin.Context, packageName, fileName string) func() {
+	start := time.Now()
+	return func() {
+		status := c.Writer.Status()
+		size := c.Writer.Size()
+		if size <= 0 || (status != http.StatusOK && status != http.StatusPartialContent) {
+			return
+		}
+
+		elapsed := time.Since(start)
+		speed := float64(size) / max(elapsed.Seconds(), 1e-6)
+		header := c.Writer.Header()
+		header.Set(http.TrailerPrefix+bytesTrailer, strconv.Itoa(size))
+		header.Set(http.TrailerPrefix+durationTrailer, strconv.FormatFloat(elapsed.Seconds(), 'f', 3, 64))
+		header.Set(http.TrailerPrefix+speedTrailer, strconv.FormatFloat(speed, 'f', 0, 64))
+
+		requestLog(c).Info().
+			Str("package", packageName).
+			Str("file", fileName).
+			Str("cache", header.Get(cacheHeader)).
+			Int("status", status).
+			Int("bytes", size).
+			Dur("duration", elapsed).
+			Float64("bytes_per_second", speed).
+			Msg("📊 File download served")
+	}
+}
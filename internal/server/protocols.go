@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// protocols returns the HTTP versions served on TCP listeners: HTTP/1.1,
+// HTTP/2 negotiated over TLS, and HTTP/2 with prior knowledge on plain
+// listeners when h2c is enabled
+func (s *Server) protocols() *http.Protocols {
+	p := new(http.Protocols)
+	p.SetHTTP1(true)
+	p.SetHTTP2(true)
+	p.SetUnencryptedHTTP2(s.config.H2C)
+	return p
+}
+
+// HTTP3Server returns the HTTP/3 server for Handler, or nil when HTTP/3 is
+// disabled. The caller starts it with ListenAndServeTLS using the configured
+// certificate and shuts it down alongside HTTPServer.
+func (s *Server) HTTP3Server() *http3.Server {
+	if !s.config.HTTP3 {
+		return nil
+	}
+	s.http3Once.Do(func() {
+		s.http3 = &http3.Server{
+			Addr:           s.config.HTTP3Addr,
+			Handler:        s.Handler(),
+			MaxHeaderBytes: s.config.MaxHeaderBytes,
+			IdleTimeout:    s.config.KeepAliveTimeout,
+		}
+	})
+	return s.http3
+}
+
+// advertiseHTTP3 adds the Alt-Svc header that lets clients connected over
+// TCP switch to HTTP/3 for later requests
+func (s *Server) advertiseHTTP3(next http.Handler) http.Handler {
+	h3 := s.HTTP3Server()
+	if h3 == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = h3.SetQUICHeaders(w.Header()) // Fails only until the QUIC listener is up
+		next.ServeHTTP(w, r)
+	})
+}
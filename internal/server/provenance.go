@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
+	"github.com/huyhandes/groxpi/internal/flight"
+	"github.com/huyhandes/groxpi/internal/pypi"
+)
+
+// provenanceSuffix is appended to a file's name to key its provenance. Kept
+// with the package files, provenance is trashed, exported and replicated with
+// the package; GROXPI_METADATA_CACHE_DIR moves it to a budget of its own.
+const provenanceSuffix = ".provenance"
+
+// fileURL returns the URL a listed file is downloaded from through groxpi
+func (s *Server) fileURL(packageName, fileName string) string {
+	return fmt.Sprintf("%s/simple/%s/%s", s.config.BasePath, packageName, pypi.EscapeFileName(fileName))
+}
+
+// provenanceURL returns the URL a file's PEP 740 provenance is served at
+func (s *Server) provenanceURL(packageName, fileName string) string {
+	return fmt.Sprintf("%s/provenance/%s/%s", s.config.BasePath, packageName, pypi.EscapeFileName(fileName))
+}
+
+// handleProvenance serves the PEP 740 provenance of a listed file from
+// storage, fetching it from the URL upstream listed on a miss. Provenance
+// never changes once published, so cached documents are not refetched.
+func (s *Server) handleProvenance(c *gin.Context) {
+	packageName := cachekey.Package(c.Param("package"))
+	fileName := c.Param("file")
+	if !s.checkFileRequest(c, packageName, fileName) {
+		return
+	}
+
+	ctx := requestContext(c)
+	storageKey := s.keys.Key(packageName, fileName+provenanceSuffix)
+	if data, ok := s.cachedProvenance(ctx, storageKey); ok {
+		c.Data(http.StatusOK, pypi.ProvenanceContentType, data)
+		return
+	}
+
+	files, err := s.getPackageFiles(c, packageName)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.String(http.StatusNotFound, "Package not found")
+			return
+		}
+		requestLog(c).Error().Err(err).Str("package", packageName).Msg("Failed to fetch package files")
+		respondUpstreamError(c, err, "Error fetching package")
+		return
+	}
+	var provenance string
+	for _, file := range files {
+		if file.Name == fileName {
+			provenance = file.Provenance
+			break
+		}
+	}
+	if provenance == "" {
+		c.String(http.StatusNotFound, "No provenance for file")
+		return
+	}
+
+	result, err, _ := s.sf.Do(flight.Key(s.config.IndexURL, "provenance", packageName+"/"+fileName), func() (interface{}, error) {
+		data, err := s.pypiClient.GetProvenanceContext(ctx, provenance)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.metadata().Put(ctx, storageKey, bytes.NewReader(data), int64(len(data)), pypi.ProvenanceContentType); err != nil {
+			requestLog(c).Warn().Err(err).Str("storage_key", storageKey).Msg("Failed to cache provenance")
+		}
+		return data, nil
+	})
+	if err != nil {
+		if errors.Is(err, pypi.ErrProvenanceNotFound) {
+			c.String(http.StatusNotFound, "No provenance for file")
+			return
+		}
+		requestLog(c).Error().Err(err).Str("package", packageName).Str("file", fileName).Msg("Failed to fetch provenance")
+		respondUpstreamError(c, err, "Error fetching provenance")
+		return
+	}
+	c.Data(http.StatusOK, pypi.ProvenanceContentType, result.([]byte))
+}
+
+// cachedProvenance reads a stored provenance document
+func (s *Server) cachedProvenance(ctx context.Context, storageKey string) ([]byte, bool) {
+	reader, _, err := s.metadata().Get(ctx, storageKey)
+	if err != nil {
+		return nil, false
+	}
+	defer func() { _ = reader.Close() }()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
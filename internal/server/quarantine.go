@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
+	"github.com/huyhandes/groxpi/internal/pypi"
+)
+
+// listedProject returns the part of project the index lists: the files and
+// versions within the version constraints and out of quarantine
+func (s *Server) listedProject(packageName string, project *pypi.Project) *pypi.Project {
+	return s.quarantineProject(packageName, s.constrainProject(packageName, project), time.Now())
+}
+
+// quarantineProject returns a copy of project without the files uploaded
+// within the quarantine window, and without the versions all of whose files
+// are hidden. Projects with nothing to hide are returned as is.
+func (s *Server) quarantineProject(packageName string, project *pypi.Project, now time.Time) *pypi.Project {
+	if s.quarantine.Exempted(packageName) {
+		return project
+	}
+
+	hidden := make(map[string]bool)
+	visible := make(map[string]bool)
+	files := make([]pypi.FileInfo, 0, len(project.Files))
+	for _, file := range project.Files {
+		version := pypi.FileVersion(file.Name)
+		if s.quarantine.Hides(packageName, file.UploadTime, now) {
+			hidden[version] = true
+			continue
+		}
+		visible[version] = true
+		files = append(files, file)
+	}
+	if len(hidden) == 0 {
+		return project
+	}
+
+	quarantined := *project
+	quarantined.Files = files
+	quarantined.Versions = make([]string, 0, len(project.Versions))
+	for _, version := range project.Versions {
+		if !hidden[version] || visible[version] {
+			quarantined.Versions = append(quarantined.Versions, version)
+		}
+	}
+	return &quarantined
+}
+
+// quarantinedFile reports whether a file of packageName is held back by the
+// quarantine, looking its upload time up in the package's file list. Files
+// that list can't be had for, or that it doesn't mention, can't be dated and
+// are held back unless the quarantine allows unknown files.
+func (s *Server) quarantinedFile(ctx context.Context, packageName, fileName string) bool {
+	if s.quarantine.Exempted(packageName) {
+		return false
+	}
+	cached, found := s.indexCache.GetPackage(packageName)
+	project, ok := cached.(*pypi.Project)
+	if !found || !ok {
+		var err error
+		if project, err = s.fetchProject(ctx, packageName); err != nil {
+			stale, _ := s.indexCache.GetPackageStale(packageName)
+			if project, ok = stale.(*pypi.Project); !ok {
+				return s.quarantine.HidesUnknown(packageName)
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, file := range project.Files {
+		if file.Name == fileName {
+			return s.quarantine.Hides(packageName, file.UploadTime, now)
+		}
+	}
+	return s.quarantine.HidesUnknown(packageName)
+}
+
+// listedIndex is the upstream index as the server lists it, so mirroring
+// and cache warming only fetch files clients can be served
+type listedIndex struct {
+	*pypi.Client
+	s *Server
+}
+
+// GetPackageFilesContext returns the listed files of a package
+func (li listedIndex) GetPackageFilesContext(ctx context.Context, packageName string) ([]pypi.FileInfo, error) {
+	project, err := li.GetProjectContext(ctx, packageName)
+	if err != nil {
+		return nil, err
+	}
+	return li.s.listedProject(cachekey.Package(packageName), project).Files, nil
+}
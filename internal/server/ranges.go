@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// digestETag returns the strong entity tag for a file with the given
+// SHA-256, or "" if the digest isn't valid hex SHA-256. The tag depends
+// only on the content, so the response that streams a file from upstream
+// and every later response from any tier or instance carry the same one,
+// and clients can resume either with If-Range.
+func digestETag(sha256Hex string) string {
+	if sum, err := hex.DecodeString(sha256Hex); err != nil || len(sum) != 32 {
+		return ""
+	}
+	return `"sha256-` + strings.ToLower(sha256Hex) + `"`
+}
+
+// objectETag returns a strong entity tag for a stored object: its digest
+// when the metadata records one, else the backend's own tag, else its size
+// and modification time. Each stays the same for as long as the object is
+// not rewritten.
+func objectETag(info *storage.ObjectInfo) string {
+	if etag := digestETag(info.Metadata[storage.MetaSHA256]); etag != "" {
+		return etag
+	}
+	if etag := strings.Trim(info.ETag, `"`); etag != "" {
+		return `"` + etag + `"`
+	}
+	return `"` + strconv.FormatInt(info.Size, 16) + "-" + strconv.FormatInt(info.LastModified.UnixNano(), 16) + `"`
+}
+
+// setResumeHeaders advertises that a stored file can be fetched in ranges
+// and tags it so a client can resume an interrupted download
+func setResumeHeaders(c *gin.Context, info *storage.ObjectInfo) {
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("ETag", objectETag(info))
+}
+
+// setDigestResumeHeaders tags a file streamed from upstream with the ETag
+// its cached copy will have, so a client can resume an interrupted download
+// against the cache. Files without a known digest are left untagged.
+func setDigestResumeHeaders(c *gin.Context, sha256Hex string) {
+	if etag := digestETag(sha256Hex); etag != "" {
+		c.Header("Accept-Ranges", "bytes")
+		c.Header("ETag", etag)
+	}
+}
+
+// serveStoredRange answers a request carrying a Range header from storage.
+// http.ServeContent checks If-Range against the ETag already set and
+// handles single, multiple and unsatisfiable ranges; the object is read
+// from the first requested byte rather than from the start.
+func (s *Server) serveStoredRange(c *gin.Context, key string, info *storage.ObjectInfo) error {
+	content := &storageSeeker{ctx: requestContext(c), store: s.storage, key: key, size: info.Size}
+	defer content.Close()
+
+	if c.Writer.Header().Get("Content-Type") == "" {
+		c.Header("Content-Type", "application/octet-stream")
+	}
+	http.ServeContent(c.Writer, c.Request, "", info.LastModified, content)
+	return content.err
+}
+
+// storageSeeker is an io.ReadSeeker over a stored object. Seeking only
+// moves the offset; the next Read opens a ranged read from there.
+type storageSeeker struct {
+	ctx    context.Context
+	store  storage.Storage
+	key    string
+	size   int64
+	offset int64
+	reader io.ReadCloser
+	err    error // First error reading the object
+}
+
+func (r *storageSeeker) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.reader == nil {
+		reader, _, err := r.store.GetRange(r.ctx, r.key, r.offset, r.size-r.offset)
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+		r.reader = reader
+	}
+
+	n, err := r.reader.Read(p)
+	r.offset += int64(n)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *storageSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before start of object")
+	}
+	if offset != r.offset {
+		r.Close()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+// Close releases the open ranged read, if any
+func (r *storageSeeker) Close() {
+	if r.reader != nil {
+		_ = r.reader.Close()
+		r.reader = nil
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/phuslu/log"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
+)
+
+// earlyRefreshTimeout bounds a background refresh of an index page
+const earlyRefreshTimeout = 2 * time.Minute
+
+// refreshListEarly refreshes the cached package list in the background when
+// the index cache picks it for early refresh
+func (s *Server) refreshListEarly() {
+	if !s.indexCache.RefreshDue(cachekey.PackageList) {
+		return
+	}
+	s.refreshEarly(cachekey.PackageList, cachekey.PackageListResponse, func(ctx context.Context) error {
+		_, err := s.fetchPackageList(ctx)
+		return err
+	})
+}
+
+// refreshProjectEarly refreshes a package's cached files in the background
+// when the index cache picks them for early refresh
+func (s *Server) refreshProjectEarly(packageName string) {
+	if !s.indexCache.PackageRefreshDue(packageName) {
+		return
+	}
+	s.refreshEarly(cachekey.Project(packageName), cachekey.ProjectResponse(packageName), func(ctx context.Context) error {
+		_, err := s.fetchProject(ctx, packageName)
+		return err
+	})
+}
+
+// refreshEarly runs fetch off the request path, once per key at a time, and
+// drops the rendered response so the next request sees the new data. The
+// cached entry keeps being served meanwhile, and still is if fetch fails.
+func (s *Server) refreshEarly(key, responseKey string, fetch func(ctx context.Context) error) {
+	if _, running := s.refreshing.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+	s.earlyRefreshes.Add(1)
+
+	go func() {
+		defer s.refreshing.Delete(key)
+
+		ctx, cancel := context.WithTimeout(context.Background(), earlyRefreshTimeout)
+		defer cancel()
+		if err := fetch(ctx); err != nil {
+			log.Debug().Err(err).Str("key", key).Msg("Early index refresh failed")
+			return
+		}
+		s.responseCache.Invalidate(responseKey)
+	}()
+}
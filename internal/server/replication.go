@@ -0,0 +1,134 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/replication"
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// maxReplicationWait caps how long a standby's poll is held open
+const maxReplicationWait = 60 * time.Second
+
+// replicationPrimaryOnly answers 404 unless this instance is a replication
+// primary
+func (s *Server) replicationPrimaryOnly(c *gin.Context) bool {
+	if s.replicationLog == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Replication primary mode is not enabled",
+		})
+		return false
+	}
+	return true
+}
+
+// handleReplicationEvents long-polls for files stored after the standby's
+// cursor
+func (s *Server) handleReplicationEvents(c *gin.Context) {
+	if !s.replicationPrimaryOnly(c) {
+		return
+	}
+
+	after, _ := strconv.ParseUint(c.Query("after"), 10, 64)
+	wait, _ := strconv.Atoi(c.Query("wait"))
+	batch := s.replicationLog.Poll(c.Request.Context(), c.Query("epoch"), after, min(time.Duration(wait)*time.Second, maxReplicationWait))
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   batch,
+	})
+}
+
+// handleReplicationObjects lists every cached package file, for standbys
+// that need a full resync
+func (s *Server) handleReplicationObjects(c *gin.Context) {
+	if !s.replicationPrimaryOnly(c) {
+		return
+	}
+	walker, ok := s.storage.(storage.Walker)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"status":  "error",
+			"message": "Storage backend cannot list every object",
+		})
+		return
+	}
+
+	objects := []replication.Object{}
+	err := walker.Walk(requestContext(c), storage.PackagesPrefix, func(obj *storage.ObjectInfo) error {
+		if pkg, file, ok := s.keys.Parse(obj.Key); ok {
+			objects = append(objects, replication.Object{Key: obj.Key, Package: pkg, File: file, Size: obj.Size})
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to list objects: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   gin.H{"objects": objects},
+	})
+}
+
+// handleReplicationObject streams one cached package file as stored, with
+// its storage metadata in X-Groxpi-Meta-* headers
+func (s *Server) handleReplicationObject(c *gin.Context) {
+	if !s.replicationPrimaryOnly(c) {
+		return
+	}
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if !replication.ValidKey(key) {
+		c.String(http.StatusBadRequest, "Invalid key")
+		return
+	}
+
+	reader, info, err := s.storage.Get(requestContext(c), key)
+	if err != nil {
+		if exists, existsErr := s.storage.Exists(requestContext(c), key); existsErr == nil && !exists {
+			c.String(http.StatusNotFound, "Not Found")
+			return
+		}
+		c.String(http.StatusInternalServerError, "Failed to read object")
+		return
+	}
+	defer func() { _ = reader.Close() }()
+
+	for name, value := range info.Metadata {
+		c.Header(replication.MetaHeaderPrefix+name, value)
+	}
+	c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+	c.Header("Content-Type", info.ContentType)
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		requestLog(c).Warn().Err(err).Str("key", key).Msg("Failed to send object to standby")
+	}
+}
+
+// handleReplicationStatus reports a standby's progress
+func (s *Server) handleReplicationStatus(c *gin.Context) {
+	if s.follower == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Replication standby mode is not enabled",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   s.follower.Status(),
+	})
+}
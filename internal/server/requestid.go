@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phuslu/log"
+
+	"github.com/huyhandes/groxpi/internal/logger"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+	degradedKey     = "degraded"
+
+	// maxRequestIDLength caps honored incoming IDs to keep log lines bounded
+	maxRequestIDLength = 128
+)
+
+// requestIDMiddleware honors a well-formed incoming X-Request-ID or generates
+// a new one, echoes it in the response and attaches it to the request context
+// so every log line emitted while handling the request carries it
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Set(requestIDKey, requestID)
+		c.Header(requestIDHeader, requestID)
+		c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), requestID))
+
+		c.Next()
+	}
+}
+
+// newRequestID returns a random 128-bit hex identifier
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID reports whether an incoming ID is safe to log and echo back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		ch := id[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		case ch == '-', ch == '_', ch == '.', ch == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// requestLog returns the logger tagged with the current request ID
+func requestLog(c *gin.Context) *log.Logger {
+	return logger.FromContext(c.Request.Context())
+}
+
+// requestContext returns a context carrying the request's logging values but
+// not its cancellation, so cache writes finish even if the client goes away.
+// It still ends at the route's deadline.
+func requestContext(c *gin.Context) context.Context {
+	ctx := context.WithoutCancel(c.Request.Context())
+	if deadline, ok := c.Value(deadlineKey).(*requestDeadline); ok {
+		return deadline.bind(ctx)
+	}
+	return ctx
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/phuslu/log"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
+)
+
+// loadResponseCache loads the rendered pages saved by the last run. The
+// project list is loaded even when it has expired, and seeds the package
+// list, so clients reaching a restarted instance get the index from disk
+// while one background fetch refreshes it, instead of all waiting on
+// upstream.
+func (s *Server) loadResponseCache() {
+	start := time.Now()
+	loaded, stale, err := s.responseStore.Load(earlyRefreshTimeout, func(key string) bool {
+		return key == cachekey.PackageListResponse
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("dir", s.config.ResponseCacheDir).Msg("Failed to load saved responses")
+		return
+	}
+	if loaded == 0 {
+		return
+	}
+	log.Info().
+		Int("responses", loaded).
+		Int("stale", len(stale)).
+		Dur("duration", time.Since(start)).
+		Msg("Loaded saved responses")
+
+	expiresAt, found := s.responseCache.Expiry(cachekey.PackageListResponse)
+	data, _ := s.responseCache.Get(cachekey.PackageListResponse)
+	if !found || data == nil {
+		return
+	}
+	var list struct {
+		Projects []struct {
+			Name string `json:"name"`
+		} `json:"projects"`
+	}
+	if err := s.jsonAPI().Unmarshal(data, &list); err != nil || len(list.Projects) == 0 {
+		log.Warn().Err(err).Msg("Dropping unreadable saved package list")
+		s.responseCache.Invalidate(cachekey.PackageListResponse)
+		return
+	}
+	packages := make([]string, len(list.Projects))
+	for i, project := range list.Projects {
+		packages[i] = project.Name
+	}
+	s.indexCache.Set(cachekey.PackageList, packages, time.Until(expiresAt))
+	go s.rebuildSearchIndex(packages)
+
+	if len(stale) > 0 {
+		s.refreshEarly(cachekey.PackageList, cachekey.PackageListResponse, func(ctx context.Context) error {
+			_, err := s.fetchPackageList(ctx)
+			return err
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/phuslu/log"
+
+	"github.com/huyhandes/groxpi/internal/search"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+)
+
+// rebuildSearchIndex replaces the search index with one built from packages
+func (s *Server) rebuildSearchIndex(packages []string) {
+	start := time.Now()
+	idx := search.NewIndex(packages)
+	s.searchIndex.Store(idx)
+
+	log.Debug().
+		Int("packages", idx.Len()).
+		Dur("duration", time.Since(start)).
+		Msg("Search index rebuilt")
+}
+
+// getSearchIndex returns the current search index, building it synchronously
+// from the package list if no refresh has populated it yet
+func (s *Server) getSearchIndex(c *gin.Context) (*search.Index, error) {
+	packages, err := s.getPackageList(c)
+	if err != nil {
+		// Serve from a stale index rather than failing outright
+		if idx := s.searchIndex.Load(); idx != nil {
+			requestLog(c).Warn().Err(err).Msg("Package list refresh failed, searching stale index")
+			return idx, nil
+		}
+		return nil, err
+	}
+
+	if idx := s.searchIndex.Load(); idx != nil {
+		return idx, nil
+	}
+
+	idx := search.NewIndex(packages)
+	s.searchIndex.CompareAndSwap(nil, idx)
+	return idx, nil
+}
+
+func (s *Server) handleSearch(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Query parameter 'q' required",
+		})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Query parameter 'limit' must be a positive integer",
+			})
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	idx, err := s.getSearchIndex(c)
+	if err != nil {
+		requestLog(c).Error().Err(err).Str("query", query).Msg("Failed to load package list for search")
+		respondUpstreamError(c, err, "Error fetching package list")
+		return
+	}
+
+	results := idx.Search(query, limit)
+	if results == nil {
+		results = []search.Result{}
+	}
+
+	if wantsJSON(c) || strings.Contains(c.GetHeader("Accept"), "application/json") {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data": gin.H{
+				"query":   query,
+				"total":   len(results),
+				"results": results,
+			},
+		})
+		return
+	}
+
+	var sb strings.Builder
+	sb.Grow(512 + len(results)*100)
+
+	escaped := html.EscapeString(query)
+	sb.WriteString(`<!DOCTYPE html>
+<html>
+<head><title>Search results for `)
+	sb.WriteString(escaped)
+	sb.WriteString(`</title></head>
+<body>
+	<h1>Search results for `)
+	sb.WriteString(escaped)
+	sb.WriteString(`</h1>
+	<form action="/search" method="get">
+		<input type="search" name="q" value="`)
+	sb.WriteString(escaped)
+	sb.WriteString(`">
+		<button type="submit">Search</button>
+	</form>
+`)
+
+	if len(results) == 0 {
+		sb.WriteString(`	<p>No matching packages.</p>
+`)
+	}
+
+	for _, r := range results {
+		sb.WriteString(fmt.Sprintf(`	<a href="%s/simple/%s/" data-match="%s">%s</a><br>
+`, s.config.BasePath, url.PathEscape(r.Name), r.Match, html.EscapeString(r.Name)))
+	}
+
+	sb.WriteString(`	<p><a href="` + s.config.BasePath + `/">← Back to home</a></p>
+</body>
+</html>`)
+	c.Header("Content-Type", "text/html")
+	c.String(http.StatusOK, sb.String())
+}
@@ -3,25 +3,59 @@ package server
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"html"
 	"io"
+	"maps"
+	"math"
 	"net/http"
 	"path"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/bytedance/sonic"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
 	"github.com/phuslu/log"
-	"golang.org/x/sync/singleflight"
+	"github.com/quic-go/quic-go/http3"
 
 	"github.com/huyhandes/groxpi/internal/cache"
+	"github.com/huyhandes/groxpi/internal/cachekey"
+	"github.com/huyhandes/groxpi/internal/cadence"
+	"github.com/huyhandes/groxpi/internal/capacity"
+	"github.com/huyhandes/groxpi/internal/capture"
+	"github.com/huyhandes/groxpi/internal/catalog"
+	"github.com/huyhandes/groxpi/internal/cdn"
+	"github.com/huyhandes/groxpi/internal/chaos"
+	"github.com/huyhandes/groxpi/internal/clientid"
 	"github.com/huyhandes/groxpi/internal/config"
+	"github.com/huyhandes/groxpi/internal/constraint"
+	"github.com/huyhandes/groxpi/internal/flight"
+	"github.com/huyhandes/groxpi/internal/gc"
+	"github.com/huyhandes/groxpi/internal/hotkeys"
+	"github.com/huyhandes/groxpi/internal/jobs"
+	"github.com/huyhandes/groxpi/internal/memlimit"
+	"github.com/huyhandes/groxpi/internal/mirror"
+	"github.com/huyhandes/groxpi/internal/peer"
+	"github.com/huyhandes/groxpi/internal/prefetch"
 	"github.com/huyhandes/groxpi/internal/pypi"
+	"github.com/huyhandes/groxpi/internal/quarantine"
+	"github.com/huyhandes/groxpi/internal/replication"
+	"github.com/huyhandes/groxpi/internal/retention"
+	"github.com/huyhandes/groxpi/internal/search"
+	"github.com/huyhandes/groxpi/internal/signing"
 	"github.com/huyhandes/groxpi/internal/storage"
 	"github.com/huyhandes/groxpi/internal/streaming"
+	"github.com/huyhandes/groxpi/internal/tenant"
+	"github.com/huyhandes/groxpi/internal/trash"
+	"github.com/huyhandes/groxpi/internal/upstream"
+	"github.com/huyhandes/groxpi/internal/version"
+	"github.com/huyhandes/groxpi/internal/warm"
+	"github.com/huyhandes/groxpi/internal/webhook"
 )
 
 // Response buffer pool for reducing allocations
@@ -55,6 +89,63 @@ func newDownloadCoordinator() *downloadCoordinator {
 	}
 }
 
+// claim registers a download of key made outside a request, such as a
+// prefetch, so requests for the file wait for it instead of downloading it
+// again. It returns false when the file is already being downloaded, and
+// otherwise a function reporting the outcome to waiting requests.
+func (d *downloadCoordinator) claim(key, storageKey string) (func(error), bool) {
+	d.mu.Lock()
+	if _, exists := d.downloads[key]; exists {
+		d.mu.Unlock()
+		return nil, false
+	}
+	status := &downloadStatus{
+		storageKey: storageKey,
+		startTime:  time.Now(),
+		inProgress: true,
+	}
+	status.waitGroup.Add(1)
+	d.downloads[key] = status
+	d.mu.Unlock()
+
+	return func(err error) {
+		status.mu.Lock()
+		status.inProgress = false
+		status.completed = true
+		status.error = err
+		status.mu.Unlock()
+		status.waitGroup.Done()
+
+		// Clean up after a delay, as for requests
+		time.AfterFunc(30*time.Second, func() { d.release(key, status) })
+	}, true
+}
+
+// release drops status, the finished download of key, unless a newer
+// download of key has replaced it
+func (d *downloadCoordinator) release(key string, status *downloadStatus) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.downloads[key] == status {
+		delete(d.downloads, key)
+	}
+}
+
+// forget drops the finished download of key, so the next request for the
+// file downloads it again rather than serving the outcome of the last one
+func (d *downloadCoordinator) forget(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if status, exists := d.downloads[key]; exists {
+		status.mu.RLock()
+		completed := status.completed
+		status.mu.RUnlock()
+		if completed {
+			delete(d.downloads, key)
+		}
+	}
+}
+
 // calculateDynamicTimeout calculates appropriate timeout based on file size
 func (s *Server) calculateDynamicTimeout(expectedSize int64) time.Duration {
 	if expectedSize <= 0 {
@@ -94,15 +185,72 @@ type Server struct {
 	indexCache       *cache.IndexCache
 	fileCache        *cache.FileCache
 	responseCache    *cache.ResponseCache
+	responseStore    *cache.ResponseStore // Saves responseCache across restarts (nil = memory only)
 	pypiClient       *pypi.Client
 	storage          storage.Storage
+	metadataStorage  storage.Storage    // Metadata documents' own storage (nil = kept in storage)
+	catalog          *catalog.Catalog   // Persistent cache bookkeeping (nil = memory only)
+	keys             *storage.KeyLayout // Storage key layout for package files
+	fallbackKeys     *storage.KeyLayout // Layout files are being migrated from (nil = none)
 	router           *gin.Engine
-	sf               singleflight.Group // For deduplicating concurrent requests
+	sf               *flight.Group // For deduplicating concurrent requests
 	streamDownloader streaming.StreamingDownloader
-	downloadCoord    *downloadCoordinator // For coordinating concurrent downloads
+	downloadCoord    *downloadCoordinator         // For coordinating concurrent downloads
+	cdnSigner        cdn.Signer                   // Signs CDN redirect URLs (nil = serve directly)
+	searchIndex      atomic.Pointer[search.Index] // Built from the package list after each refresh
+	mirror           *mirror.Mirror               // Background index mirroring (nil = pull-through only)
+	warmer           *warm.Warmer                 // Lockfile-driven cache warming jobs
+	prefetcher       *prefetch.Prefetcher         // Downloads the likely next file after a listing (nil = disabled)
+	hot              *hotkeys.Tracker             // Keeps the most requested packages' files cached (nil = disabled)
+	cadence          *cadence.Tracker             // Adapts package TTLs to how often their files change (nil = disabled)
+	chaos            *chaos.Injector              // Injects faults into upstream and storage requests (nil = disabled)
+	capture          *capture.Recorder            // Records requests for replay (nil = disabled); shared with mounts
+	capturePrefix    string                       // Prepended to captured paths: /<name> for a mount
+	jobs             *jobs.Manager                // Long-running operations (warms, mirror passes, GC, exports)
+	trash            *trash.Trash                 // Soft-deleted packages (nil = disabled)
+	upstreamLimiter  *upstream.Limiter            // Bounds concurrent upstream requests (nil = unlimited)
+	mounts           map[string]*Server           // Logical indexes served under /<name>/
+	hashPeers        []*Server                    // Indexes whose files are reused by digest, this one first (nil = this one only)
+	dedupHits        atomic.Int64                 // Downloads answered with a file cached under another name
+	peers            *peer.Discovery              // Other groxpi instances on the LAN (nil = disabled); shared with mounts
+	peerHits         atomic.Int64                 // Downloads copied from a peer instead of upstream
+	files            *storageAdapter              // Stores downloaded files and announces them
+	refreshing       sync.Map                     // Index cache keys being refreshed early
+	earlyRefreshes   atomic.Int64                 // Index pages refreshed before they expired
+	spotChecks       atomic.Int64                 // Served files re-hashed against their stored SHA-256
+	corruptFiles     atomic.Int64                 // Spot-checked files that failed and were evicted
+	tenantStats      *tenant.Stats                // Traffic counters for metrics and chargeback
+	clientStats      *clientid.Stats              // Traffic per installer and team
+	webhooks         *webhook.Notifier            // Cache event notifications (nil = disabled)
+	retention        *retention.Policy            // Newest versions kept per package (nil = keep all)
+	constraints      *constraint.Policy           // Versions file lists are limited to (nil = unconstrained)
+	quarantine       *quarantine.Policy           // Hides newly uploaded files (nil = disabled)
+	signer           *signing.Signer              // Signs index responses (nil = unsigned)
+	prober           *upstream.Prober             // Chooses between the index and its mirrors (nil = index only)
+	tracer           *upstream.Tracer             // Connection timings of upstream requests
+	keepalive        *pypi.Keepalive              // Keeps an index connection open while idle (nil = disabled)
+	memory           *memlimit.Watchdog           // Sheds downloads while the heap is over its threshold (nil = never)
+	capacity         *capacity.Forecaster         // Projects when the local cache fills up (nil = no size-limited cache)
+	replicationLog   *replication.Log             // Files announced to standbys (nil = not a primary)
+	follower         *replication.Follower        // Copies files from the primary (nil = not a standby)
+	hooks            hookList                     // Embedder policy run during the request lifecycle
+	http3            *http3.Server                // Built on first use when HTTP/3 is enabled
+	http3Once        sync.Once
 }
 
-func New(cfg *config.Config) *Server {
+// New creates a server for cfg, exiting the process if it cannot be set up
+func New(cfg *config.Config, hooks ...Hooks) *Server {
+	s, err := Open(cfg, hooks...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize server")
+	}
+	return s
+}
+
+// Open creates a server for cfg and starts its background work (mirroring,
+// probing, trash expiry, ...), which Close stops. Hooks run in order for the
+// server and every mounted index.
+func Open(cfg *config.Config, hooks ...Hooks) (*Server, error) {
 	// Set Gin mode based on log level
 	if cfg.LogLevel == "DEBUG" {
 		gin.SetMode(gin.DebugMode)
@@ -115,26 +263,103 @@ func New(cfg *config.Config) *Server {
 
 	// Add middleware
 	router.Use(gin.Recovery())
+	router.Use(requestIDMiddleware())
+	router.Use(limitsMiddleware(cfg.MaxURLLength, cfg.MaxBodyBytes))
+	router.Use(validateParamsMiddleware(cfg.MaxParamLength))
+	router.Use(deadlineMiddleware(cfg))
 	router.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		return fmt.Sprintf("[%s] %d - %v %s %s\n",
+		return fmt.Sprintf("[%s] %d - %v %s %s request_id=%v\n",
 			param.TimeStamp.Format(time.RFC3339),
 			param.StatusCode,
 			param.Latency,
 			param.Method,
 			param.Path,
+			param.Keys[requestIDKey],
 		)
 	}))
 
-	// Add compression middleware
-	router.Use(gzip.Gzip(gzip.BestSpeed))
+	// Tenant access control and accounting run before compression so byte
+	// counts reflect what is sent on the wire
+	tenantStats := &tenant.Stats{}
+	rateLimiter := tenant.NewRateLimiter(cfg.RateLimit, cfg.RateBurst)
+	router.Use(tenantMiddleware(tenant.Tokens(cfg.AuthTokens), rateLimiter, tenantStats))
+	clientStats := clientid.NewStats()
+	router.Use(clientMiddleware(cfg.ClientTeamHeader, clientStats))
+
+	// Add compression middleware, skipping files that are already compressed
+	router.Use(gzip.Gzip(gzip.BestSpeed, gzip.WithCustomShouldCompressFn(newGzipFilter(cfg).shouldCompress)))
 
 	// Note: Templates are not currently used - handlers generate HTML inline
 	// This avoids issues with template syntax differences between frameworks
 
+	// Reject misspelled index quirks rather than parse pages wrongly
+	if _, err := pypi.ParseQuirks(cfg.IndexQuirks); err != nil {
+		return nil, err
+	}
+	if _, err := pypi.ParseEncodings(cfg.IndexEncodings); err != nil {
+		return nil, err
+	}
+
 	// Initialize storage backend
-	storageBackend, err := initStorage(cfg)
+	keys, err := storage.NewKeyLayout(cfg.StorageKeyTemplate)
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to initialize storage")
+		return nil, fmt.Errorf("invalid storage key template: %w", err)
+	}
+	var fallbackKeys *storage.KeyLayout
+	if cfg.StorageKeyFallback != "" {
+		if fallbackKeys, err = storage.NewKeyLayout(cfg.StorageKeyFallback); err != nil {
+			return nil, fmt.Errorf("invalid fallback storage key template: %w", err)
+		}
+	}
+	var cdnSigner cdn.Signer
+	if cfg.CDNURL != "" {
+		cdnSigner, err = cdn.NewSigner(&cdn.Config{
+			BaseURL:        cfg.CDNURL,
+			Provider:       cfg.CDNProvider,
+			KeyPairID:      cfg.CDNKeyPairID,
+			PrivateKeyPath: cfg.CDNPrivateKeyPath,
+			SigningSecret:  cfg.CDNSigningSecret,
+			URLTTL:         cfg.CDNURLTTL,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize CDN signer: %w", err)
+		}
+	}
+	var signer *signing.Signer
+	if cfg.SigningKeyFile != "" {
+		if signer, err = signing.LoadSigner(cfg.SigningKeyFile); err != nil {
+			return nil, fmt.Errorf("failed to initialize response signing: %w", err)
+		}
+	}
+	// Fault injection is for game-days and only ever explicitly enabled
+	var injector *chaos.Injector
+	if cfg.ChaosEnabled {
+		injector, err = chaos.New(chaos.Config{
+			Faults:     cfg.ChaosFaults,
+			Boundaries: cfg.ChaosBoundaries,
+			Rate:       cfg.ChaosRate,
+			MaxDelay:   cfg.ChaosMaxDelay,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid fault injection settings: %w", err)
+		}
+	}
+	storageBackend, err := initStorage(cfg, injector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	metadataDB, err := OpenCatalog(cfg, storageBackend)
+	if err != nil {
+		_ = storageBackend.Close()
+		return nil, err
+	}
+	metadataStorage, err := initMetadataStorage(cfg)
+	if err != nil {
+		_ = storageBackend.Close()
+		if metadataDB != nil {
+			_ = metadataDB.Close()
+		}
+		return nil, fmt.Errorf("failed to initialize metadata storage: %w", err)
 	}
 
 	// Create HTTP client for streaming downloader with configured timeout
@@ -142,31 +367,379 @@ func New(cfg *config.Config) *Server {
 	if streamTimeout <= 0 {
 		streamTimeout = 5 * time.Minute // Default 5 minutes for large files
 	}
+	// Index and file requests share one budget of upstream connections
+	limiter := upstream.NewLimiter(cfg.UpstreamMaxConcurrency, cfg.UpstreamQueueTimeout)
+
+	webhooks := webhook.New(webhook.Config{
+		URLs:    cfg.WebhookURLs,
+		Secret:  cfg.WebhookSecret,
+		Events:  cfg.WebhookEvents,
+		Timeout: cfg.WebhookTimeout,
+	})
+	var health *upstream.Health
+	if webhooks != nil {
+		health = upstream.NewHealth(cfg.UpstreamFailureThreshold, upstreamHealthNotifier(webhooks, cfg.IndexURL))
+		if en, ok := storageBackend.(storage.EvictionNotifier); ok {
+			en.OnEvict(func(key string, size int64) {
+				webhooks.Notify(webhook.EventCacheEvicted, cacheEventData(cfg.IndexURL, keys, key, size))
+			})
+		}
+	}
+	var replicationLog *replication.Log
+	if cfg.ReplicationPrimary {
+		replicationLog = replication.NewLog(replication.DefaultLogSize)
+	}
+	files := &storageAdapter{storage: storageBackend, webhooks: webhooks, hooks: hooks, keys: keys, indexURL: cfg.IndexURL, replication: replicationLog}
+
+	// Old releases of a package go before anything CI still installs
+	retentionPolicy := retention.New(cfg.RetentionKeepVersions, cfg.RetentionRules)
+	if ep, ok := storageBackend.(storage.EvictionPrioritizer); ok && retentionPolicy != nil {
+		ep.PrioritizeEviction(retentionPolicy.Superseded)
+	}
+
+	// Private indexes often serve files from their own host, which needs
+	// the index credentials too, as do the indexes packages are routed to
+	tracer := upstream.NewTracer()
+	auth := upstream.BasicAuth(injector.Transport(chaos.Upstream, nil), cfg.IndexURL, cfg.IndexUsername, cfg.IndexPassword)
+	for _, route := range cfg.IndexRoutes {
+		auth = upstream.BasicAuth(auth, route.IndexURL, route.Username, route.Password)
+	}
+	indexTransport := tracer.Transport(health.Transport(upstream.UserAgent(auth, cfg.UserAgent())))
+
 	streamClient := &http.Client{
-		Timeout: streamTimeout,
+		Timeout:   streamTimeout,
+		Transport: limiter.Transport(indexTransport),
 	}
 
+	// Geo-distributed runners may be better served by a regional mirror of
+	// the index; probes run outside the limiter and health tracking
+	prober := upstream.NewProber(upstream.ProberConfig{
+		URLs:         append([]string{cfg.IndexURL}, cfg.IndexMirrors...),
+		Path:         cfg.ProbePath,
+		Interval:     cfg.ProbeInterval,
+		Timeout:      cfg.ProbeTimeout,
+		Transport:    upstream.UserAgent(upstream.BasicAuth(nil, cfg.IndexURL, cfg.IndexUsername, cfg.IndexPassword), cfg.UserAgent()),
+		Threshold:    cfg.ProbeThreshold,
+		SwitchMargin: cfg.ProbeSwitchMargin,
+		SwitchRounds: cfg.ProbeSwitchRounds,
+	})
+	prober.Start()
+
+	pypiClient := pypi.NewClient(cfg)
+	pypiClient.UseChaos(injector)
+	pypiClient.UseTracer(tracer)
+	pypiClient.UseHealth(health)
+	pypiClient.UseLimiter(limiter)
+	pypiClient.UseProber(prober)
+
+	keepalive := pypi.NewKeepalive(pypiClient, cfg.UpstreamKeepaliveInterval)
+	keepalive.Start()
+
+	memory := memlimit.NewWatchdog(cfg.MemoryShedThreshold, time.Second)
+	memory.Start()
+
 	s := &Server{
 		config:           cfg,
 		indexCache:       cache.NewIndexCache(),
 		fileCache:        cache.NewFileCache(cfg.CacheDir, cfg.CacheSize),
-		responseCache:    cache.NewResponseCache(50 * 1024 * 1024), // 50MB response cache
-		pypiClient:       pypi.NewClient(cfg),
+		responseCache:    cache.NewResponseCache(responseCacheSize(cfg)),
+		pypiClient:       pypiClient,
 		storage:          storageBackend,
+		metadataStorage:  metadataStorage,
+		catalog:          metadataDB,
+		keys:             keys,
+		fallbackKeys:     fallbackKeys,
 		router:           router,
-		streamDownloader: streaming.NewTeeStreamingDownloader(&storageAdapter{storageBackend}, streamClient),
+		streamDownloader: streaming.NewTeeStreamingDownloader(files, streamClient),
+		sf:               flight.NewGroup(cfg.MaxInFlightFetches),
 		downloadCoord:    newDownloadCoordinator(),
+		upstreamLimiter:  limiter,
+		tenantStats:      tenantStats,
+		clientStats:      clientStats,
+		webhooks:         webhooks,
+		retention:        retentionPolicy,
+		constraints:      constraint.New(cfg.Constraints),
+		quarantine:       quarantine.New(cfg.QuarantineWindow, cfg.QuarantineExempt, cfg.QuarantineUnknown == "allow"),
+		signer:           signer,
+		prober:           prober,
+		tracer:           tracer,
+		keepalive:        keepalive,
+		memory:           memory,
+		replicationLog:   replicationLog,
+		hooks:            hooks,
+		cdnSigner:        cdnSigner,
+		chaos:            injector,
+		files:            files,
+	}
+	s.indexCache.SetEarlyRefresh(cfg.IndexEarlyRefresh)
+
+	// Mirror downloads are bounded per file rather than by the short
+	// interactive download timeout
+	backgroundDownloader := streaming.NewTeeStreamingDownloader(files, &http.Client{Transport: limiter.Transport(indexTransport)})
+
+	s.jobs = jobs.NewManager(storageBackend, cfg.JobsPersist)
+
+	if cfg.MirrorEnabled {
+		s.mirror = mirror.New(mirror.Config{
+			Packages: cfg.MirrorPackages,
+			Interval: cfg.MirrorInterval,
+			Workers:  cfg.MirrorWorkers,
+			Keys:     keys,
+			Jobs:     s.jobs,
+		}, listedIndex{s.pypiClient, s}, storageBackend, backgroundDownloader)
+		s.mirror.Start()
+	}
+
+	if cfg.ReplicationSource != "" {
+		s.follower = replication.NewFollower(replication.Config{
+			Source:  cfg.ReplicationSource,
+			Token:   cfg.ReplicationToken,
+			Workers: cfg.ReplicationWorkers,
+			Keys:    keys,
+		}, storageBackend)
+		s.follower.Start()
+	}
+
+	s.warmer = warm.New(warm.Config{
+		Workers: cfg.WarmWorkers,
+		Keys:    keys,
+		Jobs:    s.jobs,
+	}, listedIndex{s.pypiClient, s}, storageBackend, files)
+
+	if cfg.PrefetchEnabled {
+		s.prefetcher = prefetch.New(prefetch.Config{
+			Platforms:  cfg.PrefetchPlatforms,
+			PythonTags: cfg.PrefetchPythonTags,
+			Workers:    cfg.PrefetchWorkers,
+			Cooldown:   cfg.PrefetchCooldown,
+			Keys:       keys,
+			Claim: func(pkg, filename string) (func(error), bool) {
+				// Prefetches are optional; leave the memory to requests
+				if s.memory.Stats().Overloaded {
+					return nil, false
+				}
+				return s.downloadCoord.claim(cachekey.Download(pkg, filename), keys.Key(pkg, filename))
+			},
+		}, storageBackend, backgroundDownloader)
+		s.prefetcher.Start()
+	}
+
+	s.hot = hotkeys.New(hotkeys.Config{
+		Size:     cfg.HotPackages,
+		HalfLife: cfg.HotHalfLife,
+		Interval: cfg.HotRefreshInterval,
+		Due:      s.hotPackageDue,
+		Refresh:  s.refreshHotPackage,
+	})
+	s.hot.Start()
+
+	if cfg.AdaptiveTTL {
+		s.cadence = cadence.New(cadence.Config{
+			Initial: cfg.IndexTTL,
+			Min:     cfg.AdaptiveTTLMin,
+			Max:     cfg.AdaptiveTTLMax,
+		})
+	}
+
+	// Size-limited caches report when they are projected to fill up
+	if _, _, ok := s.cacheUsage(); ok {
+		s.capacity = capacity.New(capacity.Config{
+			Usage:    s.cacheUsage,
+			Interval: cfg.CapacitySampleInterval,
+			Window:   cfg.CapacityWindow,
+			Horizon:  time.Duration(cfg.CapacityAlertDays) * 24 * time.Hour,
+			OnAlert: func(forecast capacity.Forecast) {
+				webhooks.Notify(webhook.EventCacheCapacity, capacityEventData(cfg.IndexURL, forecast))
+			},
+		})
+		s.capacity.Start()
+	}
+
+	// Pages rendered by the last run are served while they refresh
+	if cfg.ResponseCacheDir != "" {
+		s.responseStore = cache.NewResponseStore(s.responseCache, cfg.ResponseCacheDir, cfg.ResponseCacheEncoding, cfg.ResponseCacheSaveInterval)
+		s.loadResponseCache()
+		s.responseStore.Start()
+	}
+
+	if cfg.TrashRetention > 0 {
+		s.trash = trash.New(storageBackend, keys, cfg.TrashRetention)
+		s.trash.Start(time.Hour)
+	}
+
+	if cfg.CaptureFile != "" {
+		if s.capture, err = capture.Open(cfg.CaptureFile); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	// Other groxpi instances on the LAN may have files cached already
+	if cfg.PeerCache {
+		scheme := "http"
+		if cfg.TLSCertFile != "" {
+			scheme = "https"
+		}
+		peers := peer.New(peer.Config{
+			Instance: cfg.PeerInstance,
+			Port:     cfg.PeerPort,
+			Scheme:   scheme,
+			Interval: cfg.PeerInterval,
+			Timeout:  cfg.PeerTimeout,
+		})
+		if err := peers.Start(); err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.peers = peers
+	}
+
+	if len(cfg.Mounts) > 0 {
+		s.mounts = make(map[string]*Server, len(cfg.Mounts))
+		for name := range cfg.Mounts {
+			mount, err := Open(cfg.ForMount(name), hooks...)
+			if err != nil {
+				s.Close()
+				return nil, fmt.Errorf("failed to mount %s: %w", name, err)
+			}
+			mount.memory = s.memory
+			mount.capture = s.capture
+			mount.peers = s.peers
+			mount.capturePrefix = "/" + name
+			s.mounts[name] = mount
+			log.Info().
+				Str("mount", "/"+name+"/").
+				Str("index_url", cfg.Mounts[name].IndexURL).
+				Msg("🗂️  Mounted index")
+		}
+	}
+
+	// Indexes of the same groxpi serve each other's copies of a file
+	if len(s.mounts) > 0 {
+		s.hashPeers = []*Server{s}
+		for _, name := range slices.Sorted(maps.Keys(s.mounts)) {
+			s.hashPeers = append(s.hashPeers, s.mounts[name])
+		}
+		for _, mount := range s.mounts {
+			peers := []*Server{mount}
+			for _, peer := range s.hashPeers {
+				if peer != mount {
+					peers = append(peers, peer)
+				}
+			}
+			mount.hashPeers = peers
+		}
 	}
 
 	s.setupRoutes()
-	return s
+	return s, nil
+}
+
+// Close stops background work started by New or Open and closes storage
+func (s *Server) Close() {
+	if s.mirror != nil {
+		s.mirror.Stop()
+	}
+	if s.follower != nil {
+		s.follower.Stop()
+	}
+	if s.warmer != nil {
+		s.warmer.Stop()
+	}
+	s.prefetcher.Stop()
+	s.hot.Stop()
+	if s.jobs != nil {
+		s.jobs.Stop()
+	}
+	s.webhooks.Close()
+	s.prober.Stop()
+	s.keepalive.Stop()
+	s.memory.Stop()
+	s.capacity.Stop()
+	s.responseStore.Stop()
+	if s.trash != nil {
+		s.trash.Stop()
+	}
+	for _, mount := range s.mounts {
+		mount.Close()
+	}
+	if s.config.PeerCache { // Mounts share the root's peer discovery
+		s.peers.Stop()
+	}
+	if s.config.CaptureFile != "" { // Mounts share the root's capture file
+		if err := s.capture.Close(); err != nil {
+			log.Warn().Err(err).Msg("Failed to close capture file")
+		}
+	}
+	if err := s.storage.Close(); err != nil {
+		log.Warn().Err(err).Msg("Failed to close storage")
+	}
+	if s.metadataStorage != nil {
+		if err := s.metadataStorage.Close(); err != nil {
+			log.Warn().Err(err).Msg("Failed to close metadata storage")
+		}
+	}
+	// Closed after storage so eviction can't record into a closed catalog
+	if s.catalog != nil {
+		if err := s.catalog.Close(); err != nil {
+			log.Warn().Err(err).Msg("Failed to close metadata database")
+		}
+	}
 }
 
 func (s *Server) Router() *gin.Engine {
 	return s.router
 }
 
+// Handler returns the HTTP handler serving the root index and every mounted
+// index. Requests under /<name>/ go to that mount's own router with the
+// prefix stripped.
+func (s *Server) Handler() http.Handler {
+	if len(s.mounts) == 0 {
+		return s.router
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, _, hasSlash := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		mount, ok := s.mounts[name]
+		if !ok {
+			s.router.ServeHTTP(w, r)
+			return
+		}
+		if !hasSlash {
+			http.Redirect(w, r, "/"+name+"/", http.StatusMovedPermanently)
+			return
+		}
+		http.StripPrefix("/"+name, mount.router).ServeHTTP(w, r)
+	})
+}
+
+// HTTPServer returns an http.Server for Handler with the configured
+// keep-alive, timeout, header size, protocol and HTTP/2 stream settings
+// applied. Serve it with ServeTLS when a certificate is configured.
+func (s *Server) HTTPServer() *http.Server {
+	httpServer := &http.Server{
+		Handler:           s.advertiseHTTP3(s.Handler()),
+		IdleTimeout:       s.config.KeepAliveTimeout,
+		ReadHeaderTimeout: s.config.ReadHeaderTimeout,
+		ReadTimeout:       s.config.ServerReadTimeout,
+		WriteTimeout:      s.config.ServerWriteTimeout,
+		MaxHeaderBytes:    s.config.MaxHeaderBytes,
+		Protocols:         s.protocols(),
+		HTTP2: &http.HTTP2Config{
+			MaxConcurrentStreams: s.config.MaxConcurrentStreams,
+		},
+	}
+	if s.config.KeepAliveTimeout <= 0 {
+		httpServer.SetKeepAlivesEnabled(false)
+	}
+	return httpServer
+}
+
 func (s *Server) setupRoutes() {
+	s.router.Use(s.captureMiddleware())
+	s.router.Use(s.signingMiddleware())
+
 	// Home page
 	s.router.GET("/", s.handleHome)
 
@@ -179,6 +752,14 @@ func (s *Server) setupRoutes() {
 	s.router.GET("/index/:package", s.handleListFiles)
 	s.router.GET("/index/:package/:file", s.handleDownloadFile)
 
+	// PEP 740 provenance of the files listed above
+	s.router.GET("/provenance/:package/:file", s.handleProvenance)
+
+	// Absolute upstream file URLs from old lockfiles, for allow-listed hosts
+	if len(s.config.FilesProxyHosts) > 0 {
+		s.router.GET("/files/*url", s.handleFilesProxy)
+	}
+
 	// Cache management
 	s.router.DELETE("/cache/list", s.handleCacheList)
 	// Explicit method handlers for unsupported methods (Gin doesn't allow Any after DELETE)
@@ -190,9 +771,67 @@ func (s *Server) setupRoutes() {
 	s.router.OPTIONS("/cache/list", s.handleCacheListMethodNotAllowed)
 	s.router.DELETE("/cache/:package", s.handleCachePackage)
 
+	// Soft-deleted packages
+	s.router.GET("/cache/trash", s.handleTrashList)
+	s.router.POST("/cache/:package/restore", s.handleTrashRestore)
+
+	// Cache bundles for seeding air-gapped instances
+	s.router.GET("/cache/export", s.handleCacheExport)
+	s.router.POST("/cache/export", s.handleCacheExportJob)
+	s.router.POST("/cache/import", s.handleCacheImport)
+	s.router.GET("/bundle/:package", s.handlePackageBundle)
+
+	// Offline garbage collection of stale and partial objects
+	s.router.POST("/cache/gc", s.handleCacheGC)
+
+	// Lockfile-driven cache warming
+	s.router.POST("/warm", s.handleWarm)
+	s.router.GET("/warm/:id", s.handleWarmStatus)
+
+	// Long-running operations
+	s.router.GET("/jobs", s.handleListJobs)
+	s.router.GET("/jobs/:id", s.handleGetJob)
+	s.router.POST("/jobs/:id/cancel", s.handleCancelJob)
+	s.router.GET("/jobs/:id/artifact", s.handleJobArtifact)
+
+	// Package search over the cached index
+	s.router.GET("/search", s.handleSearch)
+
+	// Per-package cache detail (cached vs upstream-only files)
+	s.router.GET("/package/:package", s.handlePackageDetail)
+
+	// Mirror progress
+	s.router.GET("/mirror/status", s.handleMirrorStatus)
+
+	// Warm standby replication
+	s.router.GET("/replication/events", s.handleReplicationEvents)
+	s.router.GET("/replication/objects", s.handleReplicationObjects)
+	s.router.GET("/replication/objects/*key", s.handleReplicationObject)
+	s.router.GET("/replication/status", s.handleReplicationStatus)
+
+	// Cached files for other groxpi instances on the LAN
+	s.router.GET("/peer/files/:package/:file", s.handlePeerFile)
+	s.router.HEAD("/peer/files/:package/:file", s.handlePeerFile)
+
 	// Health check
 	s.router.GET("/health", s.handleHealth)
 
+	// Request statistics
+	s.router.GET("/stats", s.handleStats)
+
+	// Build details
+	s.router.GET("/version", s.handleVersion)
+
+	// Public key of signed index responses
+	s.router.GET("/signing-key", s.handleSigningKey)
+
+	// Per-tenant metrics in the Prometheus text format
+	s.router.GET("/metrics", s.handleMetrics)
+
+	// Runtime log levels, for admin token holders
+	s.router.GET("/admin/loglevel", s.handleGetLogLevel)
+	s.router.POST("/admin/loglevel", s.handleSetLogLevel)
+
 	// 404 handler
 	s.router.NoRoute(func(c *gin.Context) {
 		c.String(http.StatusNotFound, "Not Found")
@@ -200,8 +839,13 @@ func (s *Server) setupRoutes() {
 }
 
 func (s *Server) handleHome(c *gin.Context) {
+	var usage string
+	if summary := s.capacitySummary(); summary != "" {
+		usage = "\n\t\t<li>Cache Usage: " + html.EscapeString(summary) + "</li>"
+	}
+
 	// For now, return simple HTML without layout
-	html := fmt.Sprintf(`<!DOCTYPE html>
+	page := fmt.Sprintf(`<!DOCTYPE html>
 <html>
 <head><title>groxpi - PyPI Cache</title></head>
 <body>
@@ -209,52 +853,55 @@ func (s *Server) handleHome(c *gin.Context) {
 	<p>High-performance PyPI caching proxy server written in Go.</p>
 	<ul>
 		<li>Index URL: %s</li>
-		<li>Cache Size: %d MB</li>
-		<li>Index TTL: %s</li>
-		<li>Version: 1.0.0</li>
+		<li>Cache Size: %d MB</li>%[6]s
+		<li>Index TTL: %[3]s</li>
+		<li>Version: %[5]s</li>
 	</ul>
-	<p><a href="/index/">Browse packages</a> | <a href="/health">Health Check</a></p>
+	<form action="%[4]s/search" method="get">
+		<input type="search" name="q" placeholder="Search packages">
+		<button type="submit">Search</button>
+	</form>
+	<p><a href="%[4]s/index/">Browse packages</a> | <a href="%[4]s/health">Health Check</a></p>
 </body>
-</html>`, s.config.IndexURL, s.config.CacheSize/(1024*1024), s.config.IndexTTL.String())
+</html>`, s.config.IndexURL, s.config.CacheSize/(1024*1024), s.config.IndexTTL.String(), s.config.BasePath, html.EscapeString(version.Get()), usage)
 
 	c.Header("Content-Type", "text/html")
-	c.String(http.StatusOK, html)
+	c.String(http.StatusOK, page)
 }
 
 func (s *Server) handleListPackages(c *gin.Context) {
-	// Check response cache first for JSON requests
-	if wantsJSON(c) {
-		cacheKey := "json:package-list"
+	page, err := parsePackageListPage(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Check response cache first for JSON requests of the whole list
+	if wantsJSON(c) && page.whole() {
+		cacheKey := cachekey.PackageListResponse
 		if cachedJSON, found := s.responseCache.Get(cacheKey); found {
+			s.refreshListEarly()
+			s.setIndexCacheHeaders(c, "")
 			c.Data(http.StatusOK, "application/vnd.pypi.simple.v1+json", cachedJSON)
 			return
 		}
 	}
 
-	// Check cache for parsed data
-	var packages []string
-	if cachedData, found := s.indexCache.Get("package-list"); found {
-		if cachedPackages, ok := cachedData.([]string); ok {
-			packages = cachedPackages
-		}
+	// An upstream failure must not look like an empty index: pip would report
+	// that no packages exist, and the empty response would be cached
+	packages, err := s.getPackageList(c)
+	if err != nil {
+		requestLog(c).Error().Err(err).Msg("Failed to fetch package list")
+		respondUpstreamError(c, err, "Error fetching package list")
+		return
 	}
+	s.setIndexCacheHeaders(c, "")
+	packages = page.filter(packages)
 
-	if len(packages) == 0 {
-		// Use singleflight to deduplicate concurrent requests
-		result, err, _ := s.sf.Do("package-list", func() (interface{}, error) {
-			return s.pypiClient.GetPackageList()
-		})
-
-		if err != nil {
-			log.Error().Err(err).Msg("Failed to fetch package list")
-			packages = []string{} // Use empty list on error
-		} else {
-			packages = result.([]string)
-			// Cache the result
-			s.indexCache.Set("package-list", packages, s.config.IndexTTL)
-		}
+	if wantsJSON(c) && !page.whole() {
+		s.writePackageListPageJSON(c, packages, page)
+		return
 	}
-
 	if wantsJSON(c) {
 		// Pre-allocate with exact capacity
 		projects := make([]map[string]string, 0, len(packages))
@@ -276,7 +923,7 @@ func (s *Server) handleListPackages(c *gin.Context) {
 			responseBufferPool.Put(buf)
 		}()
 
-		encoder := sonic.ConfigFastest.NewEncoder(buf)
+		encoder := s.jsonAPI().NewEncoder(buf)
 		if err := encoder.Encode(response); err != nil {
 			c.String(http.StatusInternalServerError, "JSON encoding error")
 			return
@@ -284,80 +931,215 @@ func (s *Server) handleListPackages(c *gin.Context) {
 
 		// Cache the JSON response
 		jsonData := buf.Bytes()
-		cacheKey := "json:package-list"
+		cacheKey := cachekey.PackageListResponse
 		// Make a copy for cache and response since buf will be reused
 		responseData := make([]byte, len(jsonData))
 		copy(responseData, jsonData)
-		s.responseCache.Set(cacheKey, responseData, s.config.IndexTTL)
+		s.responseCache.Set(cacheKey, responseData, s.responseTTL(c))
 
 		c.Data(http.StatusOK, "application/vnd.pypi.simple.v1+json", responseData)
 		return
 	}
 
-	// Return simple HTML for packages
-	html := `<!DOCTYPE html>
-<html>
-<head><title>Package Index</title></head>
-<body>
-	<h1>Simple index</h1>
-	<p>No packages cached yet. Install a package to populate the cache.</p>
-	<p><a href="/">← Back to home</a></p>
-</body>
-</html>`
-	c.Header("Content-Type", "text/html")
-	c.String(http.StatusOK, html)
+	// A full index renders to tens of MB of HTML, so it is streamed rather
+	// than built in memory
+	s.streamPackageListHTML(c, packages, page)
+}
+
+// getPackageList returns the cached package list, fetching it from upstream
+// on a miss. A fresh list also triggers a rebuild of the search index.
+func (s *Server) getPackageList(c *gin.Context) ([]string, error) {
+	if cachedData, found := s.indexCache.Get(cachekey.PackageList); found {
+		if cachedPackages, ok := cachedData.([]string); ok && len(cachedPackages) > 0 {
+			s.refreshListEarly()
+			return cachedPackages, nil
+		}
+	}
+
+	packages, err := s.fetchPackageList(requestContext(c))
+	if err != nil {
+		// Keep serving the last known list while upstream is failing
+		if staleData, found := s.indexCache.GetStale(cachekey.PackageList); found {
+			if stalePackages, ok := staleData.([]string); ok && len(stalePackages) > 0 {
+				requestLog(c).Warn().Err(err).Msg("Serving stale package list")
+				markDegraded(c)
+				return stalePackages, nil
+			}
+		}
+		return nil, err
+	}
+
+	c.Set(indexMissKey, true)
+	return packages, nil
+}
+
+// fetchPackageList fetches the package list from upstream, sharing the
+// fetch with concurrent callers, and caches it
+func (s *Server) fetchPackageList(ctx context.Context) ([]string, error) {
+	// Use singleflight to deduplicate concurrent requests
+	result, err, _ := s.sf.Do(flight.Key(s.config.IndexURL, cachekey.PackageList, ""), func() (interface{}, error) {
+		start := time.Now()
+		packages, err := s.pypiClient.GetPackageListContext(ctx)
+		if err != nil {
+			s.hooks.upstreamError(ctx, UpstreamError{Index: s.config.IndexURL, Err: err})
+			return nil, err
+		}
+
+		if s.config.StableJSON {
+			packages = slices.Sorted(slices.Values(packages))
+		}
+
+		// Cache the result and refresh the search index off the request path
+		s.indexCache.SetFetched(cachekey.PackageList, packages, s.config.IndexTTL, time.Since(start))
+		go s.rebuildSearchIndex(packages)
+		return packages, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]string), nil
 }
 
 func (s *Server) handleListFiles(c *gin.Context) {
 	packageName := c.Param("package")
 
 	// Normalize package name
-	packageName = normalizePackageName(packageName)
+	packageName = cachekey.Package(packageName)
+	if !s.checkIndexRequest(c, packageName) {
+		return
+	}
+	if _, ok := s.forceRefresh(c, packageName, ""); !ok {
+		return
+	}
+	since, delta, err := requestedSince(c)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
 
 	// Check response cache first for JSON requests
-	if wantsJSON(c) {
-		cacheKey := "json:package:" + packageName
+	if wantsJSON(c) && !delta {
+		cacheKey := cachekey.ProjectResponse(packageName)
 		if cachedJSON, found := s.responseCache.Get(cacheKey); found {
+			if cachedData, found := s.indexCache.GetPackage(packageName); found {
+				if project, ok := cachedData.(*pypi.Project); ok {
+					files := s.listedProject(packageName, project).Files
+					c.Header(serialHeader, strconv.FormatInt(projectSerial(files), 10))
+					s.prefetcher.Submit(packageName, files)
+				}
+			}
+			s.refreshProjectEarly(packageName)
+			s.hot.Record(packageName)
+			s.setIndexCacheHeaders(c, packageName)
 			c.Data(http.StatusOK, "application/vnd.pypi.simple.v1+json", cachedJSON)
 			return
 		}
 	}
 
-	// Check cache for parsed data
-	if cachedData, found := s.indexCache.GetPackage(packageName); found {
-		if cachedFiles, ok := cachedData.([]pypi.FileInfo); ok {
-			s.renderPackageFiles(c, packageName, cachedFiles)
-			return
-		}
-	}
-
-	// Use singleflight to deduplicate concurrent requests for the same package
-	key := "package-files:" + packageName
-	result, err, _ := s.sf.Do(key, func() (interface{}, error) {
-		return s.pypiClient.GetPackageFiles(packageName)
-	})
-
+	project, err := s.getProject(c, packageName)
 	if err != nil {
 		// If package not found, return 404
 		if strings.Contains(err.Error(), "not found") {
 			c.String(http.StatusNotFound, "Package not found")
 			return
 		}
-		// Log the error for debugging
-		fmt.Printf("Error fetching package %s: %v\n", packageName, err)
-		c.String(http.StatusInternalServerError, "Error fetching package: "+err.Error())
+		requestLog(c).Error().Err(err).Str("package", packageName).Msg("Failed to fetch package files")
+		respondUpstreamError(c, err, "Error fetching package")
 		return
 	}
 
-	files := result.([]pypi.FileInfo)
+	// Start fetching the file an install is likely to ask for next
+	project = s.listedProject(packageName, project)
+	s.prefetcher.Submit(packageName, project.Files)
+	s.hot.Record(packageName)
 
-	// Cache the result
-	s.indexCache.SetPackage(packageName, files, s.config.IndexTTL)
+	c.Header(serialHeader, strconv.FormatInt(projectSerial(project.Files), 10))
+	s.setIndexCacheHeaders(c, packageName)
+	if delta {
+		if project = projectSince(project, since); len(project.Files) == 0 {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		// A partial listing must not be cached as the package's page
+		c.Set(deltaKey, true)
+	}
+	s.renderPackageFiles(c, packageName, project)
+}
 
-	s.renderPackageFiles(c, packageName, files)
+// getPackageFiles returns the listed files of a normalized package name,
+// fetching them from upstream on a miss
+func (s *Server) getPackageFiles(c *gin.Context, packageName string) ([]pypi.FileInfo, error) {
+	project, err := s.getProject(c, packageName)
+	if err != nil {
+		return nil, err
+	}
+	return s.listedProject(packageName, project).Files, nil
+}
+
+// getProject returns the cached detail page for a normalized package name,
+// fetching it from upstream on a miss
+func (s *Server) getProject(c *gin.Context, packageName string) (*pypi.Project, error) {
+	// Check cache for parsed data
+	if cachedData, found := s.indexCache.GetPackage(packageName); found {
+		if cachedProject, ok := cachedData.(*pypi.Project); ok {
+			s.refreshProjectEarly(packageName)
+			return cachedProject, nil
+		}
+	}
+
+	project, err := s.fetchProject(requestContext(c), packageName)
+	if err != nil {
+		// Keep serving the last known files while upstream asks us to back off
+		if _, throttled := upstreamRetryAfter(err); throttled {
+			if staleData, found := s.indexCache.GetPackageStale(packageName); found {
+				if staleProject, ok := staleData.(*pypi.Project); ok {
+					requestLog(c).Warn().Err(err).Str("package", packageName).Msg("Serving stale package files")
+					markDegraded(c)
+					return staleProject, nil
+				}
+			}
+		}
+		return nil, err
+	}
+
+	c.Set(indexMissKey, true)
+	return project, nil
+}
+
+// fetchProject fetches a package's detail page from upstream, sharing the
+// fetch with concurrent callers, and caches it
+func (s *Server) fetchProject(ctx context.Context, packageName string) (*pypi.Project, error) {
+	// Use singleflight to deduplicate concurrent requests for the same package
+	key := flight.Key(s.config.IndexURL, "package-files", packageName)
+	result, err, _ := s.sf.Do(key, func() (interface{}, error) {
+		start := time.Now()
+		project, err := s.pypiClient.GetProjectContext(ctx, packageName)
+		if err != nil {
+			if !strings.Contains(err.Error(), "not found") {
+				s.hooks.upstreamError(ctx, UpstreamError{Index: s.config.IndexURL, Package: packageName, Err: err})
+			}
+			return nil, err
+		}
+
+		if s.config.StableJSON {
+			project = stableProject(project)
+		}
+
+		// Cache the result
+		s.cadence.Observe(packageName, fileListFingerprint(project), time.Now())
+		s.indexCache.SetPackageFetched(packageName, project, s.projectTTL(packageName), time.Since(start))
+		return project, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*pypi.Project), nil
 }
 
-func (s *Server) renderPackageFiles(c *gin.Context, packageName string, files []pypi.FileInfo) {
+func (s *Server) renderPackageFiles(c *gin.Context, packageName string, project *pypi.Project) {
+	files := project.Files
+	apiVersion, apiMinor := simpleAPIVersion(project.APIVersion)
+
 	if wantsJSON(c) {
 		// Get buffer from pool
 		buf := responseBufferPool.Get().(*bytes.Buffer)
@@ -374,7 +1156,7 @@ func (s *Server) renderPackageFiles(c *gin.Context, packageName string, files []
 			fileMap := make(map[string]interface{}, 6)
 			fileMap["filename"] = file.Name
 			// Rewrite URL to point to proxy instead of direct PyPI
-			fileMap["url"] = fmt.Sprintf("/simple/%s/%s", packageName, file.Name)
+			fileMap["url"] = s.fileURL(packageName, file.Name)
 
 			if len(file.Hashes) > 0 {
 				fileMap["hashes"] = file.Hashes
@@ -389,20 +1171,48 @@ func (s *Server) renderPackageFiles(c *gin.Context, packageName string, files []
 					fileMap["yanked-reason"] = yankedReason
 				}
 			}
+			if apiMinor >= 1 {
+				fileMap["size"] = file.Size
+				if file.UploadTime != "" {
+					fileMap["upload-time"] = file.UploadTime
+				}
+			}
+			if apiMinor >= 3 && file.Provenance != "" {
+				// Rewrite URL to point to proxy, like the file's own
+				fileMap["provenance"] = s.provenanceURL(packageName, file.Name)
+			}
+			// Pass through the fields we don't interpret, so new upstream
+			// fields reach clients without a groxpi release
+			for key, value := range file.Extra {
+				if _, set := fileMap[key]; !set {
+					fileMap[key] = value
+				}
+			}
 			fileList = append(fileList, fileMap)
 		}
 
-		// Build response structure
+		// Build response structure, declaring only the API version whose
+		// fields upstream actually provided
+		meta := map[string]interface{}{
+			"api-version": apiVersion,
+		}
 		response := map[string]interface{}{
-			"meta": map[string]interface{}{
-				"api-version": "1.0",
-			},
+			"meta":  meta,
 			"name":  packageName,
 			"files": fileList,
 		}
+		if apiMinor >= 1 {
+			response["versions"] = nonNil(project.Versions)
+		}
+		if apiMinor >= 2 {
+			if len(project.Tracks) > 0 {
+				meta["tracks"] = project.Tracks
+			}
+			response["alternate-locations"] = nonNil(project.AlternateLocations)
+		}
 
 		// Use streaming JSON encoder for zero-copy optimization
-		encoder := sonic.ConfigFastest.NewEncoder(buf)
+		encoder := s.jsonAPI().NewEncoder(buf)
 		if err := encoder.Encode(response); err != nil {
 			c.String(http.StatusInternalServerError, "JSON encoding error")
 			return
@@ -410,11 +1220,13 @@ func (s *Server) renderPackageFiles(c *gin.Context, packageName string, files []
 
 		// Cache the JSON response
 		jsonData := buf.Bytes()
-		cacheKey := "json:package:" + packageName
+		cacheKey := cachekey.ProjectResponse(packageName)
 		// Make a copy for cache and response since buf will be reused
 		responseData := make([]byte, len(jsonData))
 		copy(responseData, jsonData)
-		s.responseCache.Set(cacheKey, responseData, s.config.IndexTTL)
+		if !c.GetBool(deltaKey) {
+			s.responseCache.Set(cacheKey, responseData, min(s.responseTTL(c), s.packageTTL(packageName)))
+		}
 
 		c.Data(http.StatusOK, "application/vnd.pypi.simple.v1+json", responseData)
 		return
@@ -426,9 +1238,29 @@ func (s *Server) renderPackageFiles(c *gin.Context, packageName string, files []
 
 	sb.WriteString(`<!DOCTYPE html>
 <html>
-<head><title>Links for `)
+<head>
+	<meta name="pypi:repository-version" content="`)
+	sb.WriteString(apiVersion)
+	sb.WriteString(`">
+`)
+	if apiMinor >= 2 {
+		for _, track := range project.Tracks {
+			sb.WriteString(`	<meta name="pypi:tracks" content="`)
+			sb.WriteString(html.EscapeString(track))
+			sb.WriteString(`">
+`)
+		}
+		for _, location := range project.AlternateLocations {
+			sb.WriteString(`	<meta name="pypi:alternate-locations" content="`)
+			sb.WriteString(html.EscapeString(location))
+			sb.WriteString(`">
+`)
+		}
+	}
+	sb.WriteString(`	<title>Links for `)
 	sb.WriteString(packageName)
-	sb.WriteString(`</title></head>
+	sb.WriteString(`</title>
+</head>
 <body>
 	<h1>Links for `)
 	sb.WriteString(packageName)
@@ -438,24 +1270,29 @@ func (s *Server) renderPackageFiles(c *gin.Context, packageName string, files []
 	for _, file := range files {
 		sb.WriteString(`	<a href="`)
 		// Rewrite URL to point to proxy instead of direct PyPI
-		sb.WriteString(fmt.Sprintf("/simple/%s/%s", packageName, file.Name))
+		sb.WriteString(html.EscapeString(s.fileURL(packageName, file.Name)))
 		sb.WriteString(`"`)
 
 		if file.RequiresPython != "" {
 			sb.WriteString(` data-requires-python="`)
-			sb.WriteString(file.RequiresPython)
+			sb.WriteString(html.EscapeString(file.RequiresPython))
 			sb.WriteString(`"`)
 		}
 		if file.IsYanked() {
 			sb.WriteString(` data-yanked="`)
 			if reason := file.GetYankedReason(); reason != "" {
-				sb.WriteString(reason)
+				sb.WriteString(html.EscapeString(reason))
 			}
 			sb.WriteString(`"`)
 		}
+		if apiMinor >= 3 && file.Provenance != "" {
+			sb.WriteString(` data-provenance="`)
+			sb.WriteString(html.EscapeString(s.provenanceURL(packageName, file.Name)))
+			sb.WriteString(`"`)
+		}
 
 		sb.WriteString(`>`)
-		sb.WriteString(file.Name)
+		sb.WriteString(html.EscapeString(file.Name))
 		sb.WriteString(`</a><br>
 `)
 	}
@@ -466,11 +1303,39 @@ func (s *Server) renderPackageFiles(c *gin.Context, packageName string, files []
 	c.String(http.StatusOK, sb.String())
 }
 
+// maxSimpleAPIMinor is the newest Simple API 1.x minor version (PEP 740)
+// whose project page fields are passed through
+const maxSimpleAPIMinor = 3
+
+// simpleAPIVersion returns the api-version to declare for a project page:
+// upstream's own version capped at the newest one we pass through, or 1.0
+// when upstream did not report a 1.x version
+func simpleAPIVersion(upstream string) (string, int) {
+	major, minor, ok := strings.Cut(upstream, ".")
+	if !ok || major != "1" {
+		return "1.0", 0
+	}
+	n, err := strconv.Atoi(minor)
+	if err != nil || n < 0 {
+		return "1.0", 0
+	}
+	n = min(n, maxSimpleAPIMinor)
+	return "1." + strconv.Itoa(n), n
+}
+
+// nonNil returns list, or an empty list for nil so it encodes as []
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
 func (s *Server) handleDownloadFile(c *gin.Context) {
 	packageName := c.Param("package")
 	fileName := c.Param("file")
 
-	log.Debug().
+	requestLog(c).Debug().
 		Str("package", packageName).
 		Str("file", fileName).
 		Str("user_agent", c.GetHeader("User-Agent")).
@@ -478,27 +1343,63 @@ func (s *Server) handleDownloadFile(c *gin.Context) {
 		Msg("📦 File download request received")
 
 	// Normalize package name
-	packageName = normalizePackageName(packageName)
+	packageName = cachekey.Package(packageName)
+	if !s.checkFileRequest(c, packageName, fileName) {
+		return
+	}
+	refresh, ok := s.forceRefresh(c, packageName, fileName)
+	if !ok {
+		return
+	}
+
+	defer measureDownload(c, packageName, fileName)()
+	s.handleDownloadWithCoordination(c, packageName, fileName, refresh)
+}
+
+// isCached reports whether a package file is in storage. While a key layout
+// migration is under way, a file still stored under the fallback layout is
+// moved to the current one first.
+func (s *Server) isCached(ctx context.Context, packageName, fileName string) bool {
+	if exists, _ := s.storage.Exists(ctx, s.keys.Key(packageName, fileName)); exists {
+		return true
+	}
+	if s.fallbackKeys == nil {
+		return false
+	}
 
-	s.handleDownloadWithCoordination(c, packageName, fileName)
+	moved, err := storage.MigrateKey(ctx, s.storage, s.fallbackKeys, s.keys, packageName, fileName)
+	if err != nil {
+		log.Warn().Err(err).Str("package", packageName).Str("file", fileName).Msg("Failed to move file from the fallback key layout")
+		return false
+	}
+	return moved
 }
 
-// handleDownloadWithCoordination coordinates concurrent downloads of the same file
-func (s *Server) handleDownloadWithCoordination(c *gin.Context, packageName, fileName string) {
-	downloadKey := fmt.Sprintf("%s/%s", packageName, fileName)
-	storageKey := fmt.Sprintf("packages/%s/%s", packageName, fileName)
+// handleDownloadWithCoordination coordinates concurrent downloads of the same
+// file. With refresh, the cached copy is bypassed and the file downloaded
+// from upstream again.
+func (s *Server) handleDownloadWithCoordination(c *gin.Context, packageName, fileName string, refresh bool) {
+	downloadKey := cachekey.Download(packageName, fileName)
+	storageKey := s.keys.Key(packageName, fileName)
 
 	// Check if file already exists in storage - fast path
-	ctx := context.Background()
-	if exists, _ := s.storage.Exists(ctx, storageKey); exists {
-		log.Debug().Str("package", packageName).Str("file", fileName).Msg("✅ Serving from storage cache")
+	ctx := requestContext(c)
+	if !refresh && s.isCached(ctx, packageName, fileName) {
+		requestLog(c).Debug().Str("package", packageName).Str("file", fileName).Msg("✅ Serving from storage cache")
 		if err := s.serveFromStorageOptimized(c, storageKey); err != nil {
-			log.Error().Err(err).Str("storage_key", storageKey).Msg("Failed to serve from storage")
+			requestLog(c).Error().Err(err).Str("storage_key", storageKey).Msg("Failed to serve from storage")
 			c.String(http.StatusInternalServerError, "Failed to serve file")
 		}
 		return
 	}
 
+	// Upstream downloads buffer in memory, so they are the first to go when
+	// the heap nears the limit
+	if s.memory.Shed() {
+		respondOverloaded(c)
+		return
+	}
+
 	// Get or create download status
 	s.downloadCoord.mu.Lock()
 	status, exists := s.downloadCoord.downloads[downloadKey]
@@ -512,11 +1413,20 @@ func (s *Server) handleDownloadWithCoordination(c *gin.Context, packageName, fil
 		status.inProgress = true
 		s.downloadCoord.mu.Unlock()
 
-		// First request - handle the download
-		log.Info().Str("package", packageName).Str("file", fileName).Msg("🚀 Starting coordinated download")
-
-		// Perform the actual download
-		err := s.handleDownloadInternal(c, packageName, fileName)
+		// First request - handle the download, unless a write that bypasses
+		// the coordinator (mirror, warm, replication) stored the file since
+		// the fast path checked
+		var err error
+		if exists, _ := s.storage.Exists(ctx, storageKey); exists && !refresh {
+			requestLog(c).Debug().Str("package", packageName).Str("file", fileName).Msg("✅ Serving from storage after a concurrent write")
+			if err = s.serveFromStorageOptimized(c, storageKey); err != nil {
+				requestLog(c).Error().Err(err).Str("storage_key", storageKey).Msg("Failed to serve from storage")
+				c.String(http.StatusInternalServerError, "Failed to serve file")
+			}
+		} else {
+			requestLog(c).Info().Str("package", packageName).Str("file", fileName).Msg("🚀 Starting coordinated download")
+			err = s.handleDownloadInternal(c, packageName, fileName, refresh)
+		}
 
 		// Update status and wake up waiting requests
 		status.mu.Lock()
@@ -529,9 +1439,7 @@ func (s *Server) handleDownloadWithCoordination(c *gin.Context, packageName, fil
 		// Clean up after a delay
 		go func() {
 			time.Sleep(30 * time.Second)
-			s.downloadCoord.mu.Lock()
-			delete(s.downloadCoord.downloads, downloadKey)
-			s.downloadCoord.mu.Unlock()
+			s.downloadCoord.release(downloadKey, status)
 		}()
 
 		return
@@ -539,7 +1447,7 @@ func (s *Server) handleDownloadWithCoordination(c *gin.Context, packageName, fil
 		s.downloadCoord.mu.Unlock()
 
 		// Subsequent requests - wait for the download to complete
-		log.Debug().Str("package", packageName).Str("file", fileName).Msg("🔄 Waiting for ongoing download")
+		requestLog(c).Debug().Str("package", packageName).Str("file", fileName).Msg("🔄 Waiting for ongoing download")
 
 		// Wait for the download to complete
 		status.waitGroup.Wait()
@@ -551,20 +1459,21 @@ func (s *Server) handleDownloadWithCoordination(c *gin.Context, packageName, fil
 		// If the original download succeeded, serve from storage
 		if downloadErr == nil {
 			if exists, _ := s.storage.Exists(ctx, storageKey); exists {
-				log.Debug().Str("package", packageName).Str("file", fileName).Msg("✅ Serving from storage after coordinated download")
+				requestLog(c).Debug().Str("package", packageName).Str("file", fileName).Msg("✅ Serving from storage after coordinated download")
 				if err := s.serveFromStorageOptimized(c, storageKey); err != nil {
-					log.Error().Err(err).Str("storage_key", storageKey).Msg("Failed to serve from storage after coordinated download")
+					requestLog(c).Error().Err(err).Str("storage_key", storageKey).Msg("Failed to serve from storage after coordinated download")
 					c.String(http.StatusInternalServerError, "Failed to serve file")
 				}
 				return
 			}
 		}
 
-		// If download failed, try to get file URL and redirect
-		if files, err := s.pypiClient.GetPackageFiles(packageName); err == nil {
+		// If download failed, try to get file URL and redirect, among the
+		// listed files only so nothing held back by policy leaks out here
+		if files, err := s.getPackageFiles(c, packageName); err == nil {
 			for _, file := range files {
 				if file.Name == fileName {
-					log.Debug().Str("package", packageName).Str("file", fileName).Msg("⏭️ Redirecting to PyPI after download coordination")
+					requestLog(c).Debug().Str("package", packageName).Str("file", fileName).Msg("⏭️ Redirecting to PyPI after download coordination")
 					c.Redirect(http.StatusFound, file.URL)
 					return
 				}
@@ -575,46 +1484,40 @@ func (s *Server) handleDownloadWithCoordination(c *gin.Context, packageName, fil
 	}
 }
 
-// handleDownloadInternal performs the actual download logic with streaming and caching
-func (s *Server) handleDownloadInternal(c *gin.Context, packageName, fileName string) error {
+// handleDownloadInternal performs the actual download logic with streaming and
+// caching. With refresh, nothing cached is served.
+func (s *Server) handleDownloadInternal(c *gin.Context, packageName, fileName string, refresh bool) error {
 	// Try to get from file cache first
-	if filePath, exists := s.fileCache.Get(packageName + "/" + fileName); exists {
-		log.Debug().
+	if filePath, exists := s.fileCache.Get(cachekey.Download(packageName, fileName)); exists && !refresh {
+		requestLog(c).Debug().
 			Str("package", packageName).
 			Str("file", fileName).
 			Str("cache_path", filePath).
 			Msg("✅ Serving from file cache")
+		c.Header(cacheHeader, cacheHit+"-"+storage.TierLocal)
 		c.File(filePath)
 		return nil
 	}
 
-	// Get package files to find the download URL
-	var files []pypi.FileInfo
-	if cachedData, found := s.indexCache.GetPackage(packageName); found {
-		if cachedFiles, ok := cachedData.([]pypi.FileInfo); ok {
-			files = cachedFiles
-		}
-	}
-
-	if len(files) == 0 {
-		// Fetch from PyPI
-		var err error
-		files, err = s.pypiClient.GetPackageFiles(packageName)
-		if err != nil {
-			c.String(http.StatusNotFound, "Package not found")
+	// Get package files to find the download URL (cached by getPackageFiles)
+	files, err := s.getPackageFiles(c, packageName)
+	if err != nil {
+		if respondUpstreamUnavailable(c, err) {
 			return err
 		}
-		// Cache the result
-		s.indexCache.SetPackage(packageName, files, s.config.IndexTTL)
+		c.String(http.StatusNotFound, "Package not found")
+		return err
 	}
 
 	// Find the file URL and size
 	var fileURL string
 	var fileSize int64
+	var fileMetadata map[string]string
 	for _, file := range files {
 		if file.Name == fileName {
 			fileURL = file.URL
 			fileSize = file.Size
+			fileMetadata = file.StorageMetadata(time.Now())
 			break
 		}
 	}
@@ -625,9 +1528,9 @@ func (s *Server) handleDownloadInternal(c *gin.Context, packageName, fileName st
 	}
 
 	// Build storage key for the file
-	storageKey := fmt.Sprintf("packages/%s/%s", packageName, fileName)
+	storageKey := s.keys.Key(packageName, fileName)
 
-	log.Debug().
+	requestLog(c).Debug().
 		Str("package", packageName).
 		Str("file", fileName).
 		Str("storage_key", storageKey).
@@ -636,33 +1539,43 @@ func (s *Server) handleDownloadInternal(c *gin.Context, packageName, fileName st
 		Msg("🔍 Checking if file exists in storage")
 
 	// Check if file exists in storage
-	ctx := context.Background()
+	ctx := requestContext(c)
 	exists, err := s.storage.Exists(ctx, storageKey)
 	if err != nil {
-		log.Error().Err(err).Str("key", storageKey).Msg("Failed to check storage")
+		requestLog(c).Error().Err(err).Str("key", storageKey).Msg("Failed to check storage")
 	}
 
-	log.Debug().
+	requestLog(c).Debug().
 		Str("storage_key", storageKey).
 		Bool("exists_in_storage", exists).
 		Msg("💾 Storage existence check result")
 
-	if exists {
+	if exists && !refresh {
 		// Serve from storage using zero-copy when possible
-		log.Debug().Str("package", packageName).Str("file", fileName).Msg("✅ Serving from storage cache")
+		requestLog(c).Debug().Str("package", packageName).Str("file", fileName).Msg("✅ Serving from storage cache")
 		return s.serveFromStorageOptimized(c, storageKey)
 	}
 
-	// Check download timeout to decide whether to stream or redirect
-	if s.config.DownloadTimeout > 0 {
+	// Another index, or another name, may have brought in the same file
+	if !refresh && s.serveByHash(c, fileMetadata[storage.MetaSHA256]) {
+		return nil
+	}
+
+	// As may another groxpi on the LAN
+	if !refresh && s.fetchFromPeer(c, packageName, fileName, storageKey, fileMetadata) {
+		return nil
+	}
+
+	// Stream through the cache unless the download policy redirects
+	if !s.config.RedirectsDownload(packageName, fileSize) {
 		// Calculate dynamic timeout based on file size
 		dynamicTimeout := s.calculateDynamicTimeout(fileSize)
 
 		// Use streaming downloader for simultaneous download and serve
-		downloadCtx, cancel := context.WithTimeout(ctx, dynamicTimeout)
+		downloadCtx, cancel := context.WithTimeout(s.downloadContext(c, ctx, fileMetadata), dynamicTimeout)
 		defer cancel()
 
-		log.Info().
+		requestLog(c).Info().
 			Str("package", packageName).
 			Str("file", fileName).
 			Str("file_url", fileURL).
@@ -671,9 +1584,16 @@ func (s *Server) handleDownloadInternal(c *gin.Context, packageName, fileName st
 			Msg("🚀 Starting streaming download with simultaneous cache")
 
 		// Stream to client while caching - c.Writer is safe for goroutines (unlike Fiber's context)
+		c.Header(cacheHeader, cacheMiss)
+		setChecksumHeaders(c, fileMetadata[storage.MetaSHA256])
+		setDigestResumeHeaders(c, fileMetadata[storage.MetaSHA256])
 		result, err := s.streamDownloader.DownloadAndStream(downloadCtx, fileURL, storageKey, c.Writer)
+		if errors.Is(err, streaming.ErrClientGone) {
+			return s.logClientGone(c, packageName, fileName, result, err)
+		}
 		if err != nil {
-			log.Error().
+			clearFileHeaders(c)
+			requestLog(c).Error().
 				Err(err).
 				Str("package", packageName).
 				Str("file", fileName).
@@ -694,11 +1614,12 @@ func (s *Server) handleDownloadInternal(c *gin.Context, packageName, fileName st
 		if result.Size > 0 {
 			c.Header("Content-Length", fmt.Sprintf("%d", result.Size))
 		}
-		if result.ETag != "" {
-			c.Header("ETag", result.ETag)
+
+		if refresh && result.Error == nil {
+			s.dropFallbackCopy(c, packageName, fileName)
 		}
 
-		log.Info().
+		requestLog(c).Info().
 			Str("package", packageName).
 			Str("file", fileName).
 			Int64("size", result.Size).
@@ -707,10 +1628,11 @@ func (s *Server) handleDownloadInternal(c *gin.Context, packageName, fileName st
 
 		return nil // Response already written
 	} else {
-		log.Debug().
+		requestLog(c).Debug().
 			Str("package", packageName).
 			Str("file", fileName).
-			Msg("Download timeout is 0, redirecting directly to PyPI")
+			Int64("file_size", fileSize).
+			Msg("Download policy redirects, redirecting directly to PyPI")
 	}
 
 	// Redirect to upstream URL
@@ -719,9 +1641,22 @@ func (s *Server) handleDownloadInternal(c *gin.Context, packageName, fileName st
 }
 
 func (s *Server) handleCacheList(c *gin.Context) {
+	dry, ok := dryRun(c)
+	if !ok {
+		return
+	}
+	if dry {
+		_, cached := s.indexCache.GetStale(cachekey.PackageList)
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   gin.H{"dry_run": true, "cached": cached},
+		})
+		return
+	}
+
 	// Invalidate both index and response caches
 	s.indexCache.InvalidateList()
-	s.responseCache.Invalidate("json:package-list")
+	s.responseCache.Invalidate(cachekey.PackageListResponse)
 
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
@@ -729,6 +1664,56 @@ func (s *Server) handleCacheList(c *gin.Context) {
 	})
 }
 
+func (s *Server) handleCacheGC(c *gin.Context) {
+	opts := gc.Options{
+		MaxAge:     s.config.GCMaxAge,
+		TempMaxAge: s.config.GCTempMaxAge,
+		Retention:  s.retention,
+	}
+	dry, ok := dryRun(c)
+	if !ok {
+		return
+	}
+	opts.DryRun = dry
+
+	if raw := c.Query("max_age"); raw != "" {
+		maxAge, err := time.ParseDuration(raw)
+		if err != nil || maxAge <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Query parameter 'max_age' must be a positive duration (e.g. 720h)",
+			})
+			return
+		}
+		opts.MaxAge = maxAge
+	}
+
+	// Large stores can take a while to walk; run in the background on request
+	if c.Query("async") == "true" {
+		job := s.jobs.Start("gc", func(ctx context.Context, p *jobs.Progress) (interface{}, error) {
+			return gc.Run(ctx, s.storage, opts)
+		})
+		s.acceptJob(c, job)
+		return
+	}
+
+	report, err := gc.Run(requestContext(c), s.storage, opts)
+	if err != nil {
+		requestLog(c).Error().Err(err).Msg("Garbage collection failed")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+			"data":    report,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   report,
+	})
+}
+
 func (s *Server) handleCacheListMethodNotAllowed(c *gin.Context) {
 	if c.Request.Method != "DELETE" {
 		c.String(http.StatusMethodNotAllowed, "Method Not Allowed")
@@ -747,28 +1732,275 @@ func (s *Server) handleCachePackage(c *gin.Context) {
 		})
 		return
 	}
+	packageName = cachekey.Package(packageName)
+	dry, ok := dryRun(c)
+	if !ok {
+		return
+	}
+
+	// Optionally drop the cached files as well: "soft" moves them to the
+	// trash where they can be restored, "hard" deletes them outright
+	var data interface{}
+	switch purge := c.Query("purge"); purge {
+	case "":
+	case "soft", "hard":
+		var result interface{}
+		var err error
+		if purge == "soft" && s.trash == nil {
+			err = errTrashDisabled
+		} else if dry {
+			result, err = s.previewPackageFiles(requestContext(c), packageName)
+		} else {
+			result, err = s.purgePackageFiles(c, packageName, purge == "soft")
+		}
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, errTrashDisabled) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+		data = result
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Query parameter 'purge' must be 'soft' or 'hard'",
+		})
+		return
+	}
+
+	// A dry run reports whether there is index data to drop, along with
+	// the files a purge would remove
+	if dry {
+		preview, _ := data.(gin.H)
+		if preview == nil {
+			preview = gin.H{"package": packageName}
+		}
+		_, cached := s.indexCache.GetPackageStale(packageName)
+		preview["cached"] = cached
+		preview["dry_run"] = true
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   preview,
+		})
+		return
+	}
 
 	// Invalidate both index and response caches
 	s.indexCache.InvalidatePackage(packageName)
-	s.responseCache.Invalidate("json:package:" + packageName)
+	s.responseCache.Invalidate(cachekey.ProjectResponse(packageName))
 
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
-		"data":   nil,
+		"data":   data,
 	})
 }
 
+// upstreamRetryAfter reports whether err means upstream asked us to wait,
+// either by throttling or because the upstream request budget or in-flight
+// bound is exhausted, and for how long
+func upstreamRetryAfter(err error) (time.Duration, bool) {
+	var throttled *pypi.ThrottledError
+	if errors.As(err, &throttled) {
+		return throttled.RetryAfter, true
+	}
+	if errors.Is(err, upstream.ErrQueueTimeout) || errors.Is(err, flight.ErrTooManyInFlight) {
+		return 5 * time.Second, true
+	}
+	return 0, false
+}
+
+// respondUpstreamUnavailable answers 503 with Retry-After when err is a
+// throttling error and reports whether it did
+func respondUpstreamUnavailable(c *gin.Context, err error) bool {
+	retryAfter, ok := upstreamRetryAfter(err)
+	if !ok {
+		return false
+	}
+
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+
+	if wantsJSON(c) || strings.Contains(c.GetHeader("Accept"), "application/json") {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":      "error",
+			"message":     err.Error(),
+			"retry_after": seconds,
+		})
+		return true
+	}
+
+	c.String(http.StatusServiceUnavailable, "Upstream index unavailable, retry after %d seconds", seconds)
+	return true
+}
+
+// overloadRetryAfter is how long clients are told to wait when downloads
+// are shed for memory
+const overloadRetryAfter = 5 * time.Second
+
+// respondOverloaded answers 503 with Retry-After to a download shed because
+// the heap is over the memory threshold
+func respondOverloaded(c *gin.Context) {
+	seconds := int(overloadRetryAfter.Seconds())
+	c.Header("Retry-After", strconv.Itoa(seconds))
+
+	if wantsJSON(c) || strings.Contains(c.GetHeader("Accept"), "application/json") {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":      "error",
+			"message":     "server is low on memory",
+			"retry_after": seconds,
+		})
+		return
+	}
+
+	c.String(http.StatusServiceUnavailable, "Server is low on memory, retry after %d seconds", seconds)
+}
+
+// markDegraded records that the response is built from stale data because
+// upstream failed, so it is only cached briefly
+func markDegraded(c *gin.Context) {
+	c.Set(degradedKey, true)
+}
+
+// responseTTL returns how long the response to c may be cached: the index
+// TTL normally, and the much shorter degraded TTL when it was built from
+// stale data, so a transient failure snapshot is replaced soon after
+// upstream recovers
+func (s *Server) responseTTL(c *gin.Context) time.Duration {
+	if c.GetBool(degradedKey) {
+		return min(s.config.DegradedTTL, s.config.IndexTTL)
+	}
+	return s.config.IndexTTL
+}
+
+// respondUpstreamError answers 503 with Retry-After when upstream is
+// throttling, 504 when the request deadline passed first and 502 for any
+// other upstream failure
+func respondUpstreamError(c *gin.Context, err error, message string) {
+	if respondUpstreamUnavailable(c, err) {
+		return
+	}
+
+	status := http.StatusBadGateway
+	if errors.Is(err, context.DeadlineExceeded) {
+		status = http.StatusGatewayTimeout
+	}
+
+	if wantsJSON(c) || strings.Contains(c.GetHeader("Accept"), "application/json") {
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": message + ": " + err.Error(),
+		})
+		return
+	}
+
+	c.String(status, message+": "+err.Error())
+}
+
 func (s *Server) handleHealth(c *gin.Context) {
+	// Mounted indexes report their own health under /<name>/health
+	mounts := make(map[string]string, len(s.mounts))
+	for name, mount := range s.mounts {
+		mounts[name] = mount.config.IndexURL
+	}
+
+	data := gin.H{
+		"version":           version.Get(),
+		"user_agent":        s.config.UserAgent(),
+		"cache_dir":         s.config.CacheDir,
+		"index_url":         s.config.IndexURL,
+		"cache_size":        s.config.CacheSize,
+		"index_ttl_seconds": int(s.config.IndexTTL.Seconds()),
+		"storage_type":      s.config.StorageType,
+		"upstream":          s.upstreamLimiter.Stats(),
+		"inflight": gin.H{
+			"server": s.sf.Stats(),
+			"index":  s.pypiClient.FlightStats(),
+		},
+		"mounts":        mounts,
+		"tenant":        s.tenantStats.Snapshot(),
+		"feature_flags": s.config.Features.Status(),
+	}
+	if s.catalog != nil {
+		data["catalog"] = s.catalog.Stats()
+	}
+	if sp, ok := s.metadataStorage.(interface{ GetStats() map[string]interface{} }); ok {
+		data["metadata_cache"] = sp.GetStats()
+	}
+	if s.prober != nil {
+		data["index_mirrors"] = s.prober.Status()
+	}
+	if s.follower != nil {
+		data["replication"] = s.follower.Status()
+	}
+	if s.peers != nil {
+		data["peers"] = s.peers.Peers()
+	}
+	if s.memory != nil {
+		data["memory"] = s.memory.Stats()
+	}
+	if s.capacity != nil {
+		data["capacity"] = s.capacity.Forecast()
+	}
+	if s.prefetcher != nil {
+		data["prefetch"] = s.prefetcher.Stats()
+	}
+	if s.chaos != nil {
+		data["chaos"] = s.chaos.Stats()
+	}
+	if s.capture != nil {
+		data["capture"] = s.capture.Stats()
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":    "success",
 		"timestamp": time.Now().Unix(),
-		"data": gin.H{
-			"cache_dir":         s.config.CacheDir,
-			"index_url":         s.config.IndexURL,
-			"cache_size":        s.config.CacheSize,
-			"index_ttl_seconds": int(s.config.IndexTTL.Seconds()),
-			"storage_type":      s.config.StorageType,
-		},
+		"data":      data,
+	})
+}
+
+// Features are the optional capabilities compiled into this build
+type Features struct {
+	StorageBackends []string `json:"storage_backends"` // GROXPI_STORAGE_TYPE values
+	IndexEncodings  []string `json:"index_encodings"`  // GROXPI_INDEX_ENCODINGS values besides identity
+	HTTP3           bool     `json:"http3"`
+}
+
+// BuildFeatures reports the capabilities of this build
+func BuildFeatures() Features {
+	return Features{
+		StorageBackends: []string{"local", "s3", "hybrid"},
+		IndexEncodings:  []string{pypi.EncodingZstd, pypi.EncodingGzip},
+		HTTP3:           true,
+	}
+}
+
+func (s *Server) handleVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": struct {
+			version.BuildInfo
+			Features Features `json:"features"`
+		}{version.Info(), BuildFeatures()},
+	})
+}
+
+func (s *Server) handleMirrorStatus(c *gin.Context) {
+	if s.mirror == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Mirror mode is not enabled",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   s.mirror.Status(),
 	})
 }
 
@@ -789,95 +2021,268 @@ func wantsJSON(c *gin.Context) bool {
 		strings.Contains(accept, "json")
 }
 
-func normalizePackageName(name string) string {
-	// PyPI package names are case-insensitive and
-	// treat hyphens and underscores as equivalent
-	name = strings.ToLower(name)
-	name = strings.ReplaceAll(name, "_", "-")
-	return name
+// OpenStorage opens the configured storage backend outside of a running
+// server, e.g. for cache bundle export/import
+func OpenStorage(cfg *config.Config) (storage.Storage, error) {
+	return initStorage(cfg, nil)
+}
+
+// OpenCatalog opens the configured metadata database and has store keep
+// its bookkeeping there. It returns nil when no database is configured or
+// the backend keeps none (S3 stores it with the objects).
+func OpenCatalog(cfg *config.Config, store storage.Storage) (*catalog.Catalog, error) {
+	if cfg.MetadataDB == "" {
+		return nil, nil
+	}
+	cataloger, ok := store.(storage.Cataloger)
+	if !ok {
+		log.Warn().
+			Str("storage_type", cfg.StorageType).
+			Msg("Storage backend keeps no bookkeeping, ignoring GROXPI_METADATA_DB")
+		return nil, nil
+	}
+
+	c, err := catalog.Open(cfg.MetadataDB)
+	if err != nil {
+		return nil, err
+	}
+	if err := cataloger.UseCatalog(c); err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("failed to restore cache bookkeeping: %w", err)
+	}
+	return c, nil
+}
+
+// chaosTransport returns the S3 transport wrapper injecting injector's
+// storage faults (nil = none)
+func chaosTransport(injector *chaos.Injector) func(http.RoundTripper) http.RoundTripper {
+	if injector == nil {
+		return nil
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return injector.Transport(chaos.Storage, next)
+	}
+}
+
+// s3Config returns the settings of the default bucket, with injector's
+// faults in its requests
+func s3Config(cfg *config.Config, injector *chaos.Injector) *storage.S3Config {
+	return &storage.S3Config{
+		Endpoint:        cfg.S3Endpoint,
+		AccessKeyID:     cfg.S3AccessKeyID,
+		SecretAccessKey: cfg.S3SecretAccessKey,
+		Region:          cfg.S3Region,
+		Bucket:          cfg.S3Bucket,
+		Prefix:          cfg.S3Prefix,
+		UseSSL:          cfg.S3UseSSL,
+		ForcePathStyle:  cfg.S3ForcePathStyle,
+		PartSize:        cfg.S3PartSize,
+		MaxConnections:  cfg.S3MaxConnections,
+
+		// Performance configuration
+		ReadPoolSize:   cfg.S3ReadPoolSize,
+		WritePoolSize:  cfg.S3WritePoolSize,
+		MetaPoolSize:   cfg.S3MetaPoolSize,
+		EnableHTTP2:    cfg.S3EnableHTTP2,
+		TransferAccel:  cfg.S3TransferAccel,
+		AsyncWrites:    cfg.S3AsyncWrites,
+		AsyncWorkers:   cfg.S3AsyncWorkers,
+		AsyncQueueSize: cfg.S3AsyncQueueSize,
+		ConnectTimeout: cfg.ConnectTimeout,
+		RequestTimeout: cfg.DownloadTimeout,
+
+		// Parallel download configuration
+		DownloadPartSize:    cfg.S3DownloadPartSize,
+		DownloadConcurrency: cfg.S3DownloadConcurrency,
+
+		// Existence cache configuration
+		StatCacheTTL:         cfg.S3StatCacheTTL,
+		StatCacheNegativeTTL: cfg.S3StatCacheNegativeTTL,
+		StatCacheSize:        cfg.S3StatCacheSize,
+
+		WrapTransport: chaosTransport(injector),
+	}
+}
+
+// initS3Storage opens the default bucket and, with bucket routes
+// configured, the routed buckets, returning storage that keeps each file in
+// the bucket its name is routed to
+func initS3Storage(cfg *config.Config, injector *chaos.Injector) (storage.StreamingStorage, error) {
+	fallback, err := storage.NewS3Storage(s3Config(cfg, injector))
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.S3Routes) == 0 {
+		return fallback, nil
+	}
+
+	buckets := map[string]storage.StreamingStorage{}
+	closeAll := func() {
+		_ = fallback.Close()
+		for _, bucket := range buckets {
+			_ = bucket.Close()
+		}
+	}
+	routes := make([]storage.Route, 0, len(cfg.S3Routes))
+	for _, route := range cfg.S3Routes {
+		bucket, ok := buckets[route.Name]
+		if !ok {
+			routeConfig := s3Config(cfg, injector)
+			routeConfig.Endpoint = route.Endpoint
+			routeConfig.AccessKeyID = route.AccessKeyID
+			routeConfig.SecretAccessKey = route.SecretAccessKey
+			routeConfig.Region = route.Region
+			routeConfig.Bucket = route.Bucket
+			routeConfig.Prefix = route.Prefix
+			if bucket, err = storage.NewS3Storage(routeConfig); err != nil {
+				closeAll()
+				return nil, fmt.Errorf("failed to open routed bucket %q: %w", route.Name, err)
+			}
+			buckets[route.Name] = bucket
+		}
+		routes = append(routes, storage.Route{Pattern: route.Pattern, Storage: bucket})
+	}
+
+	routed, err := storage.NewRoutedStorage(fallback, routes)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	return routed, nil
+}
+
+// checkCacheDir makes sure files can be written atomically to dir, which
+// may be a network mount
+func checkCacheDir(dir string) error {
+	if kind := storage.NetworkFilesystem(dir); kind != "" {
+		log.Info().
+			Str("cache_dir", dir).
+			Str("filesystem", kind).
+			Msg("Cache directory is on a network filesystem")
+	}
+	if err := storage.CheckAtomicRename(dir); err != nil {
+		return fmt.Errorf("cache directory %s: %w", dir, err)
+	}
+	return nil
 }
 
-// initStorage creates the appropriate storage backend based on configuration
-func initStorage(cfg *config.Config) (storage.Storage, error) {
+// initStorage creates the appropriate storage backend based on
+// configuration, with injector's faults in its S3 and WebDAV requests
+func initStorage(cfg *config.Config, injector *chaos.Injector) (storage.Storage, error) {
+	writePolicy, err := storage.ParseWritePolicy(cfg.StorageWritePolicy)
+	if err != nil {
+		return nil, err
+	}
+	encryptionKey, err := cacheEncryptionKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nothing on disk, so no cache directory to check
+	if cfg.StorageType == "memory" {
+		return storage.NewMemoryStorage(cfg.CacheSize), nil
+	}
+
+	if cfg.StorageType == "webdav" {
+		var transport http.RoundTripper
+		if wrap := chaosTransport(injector); wrap != nil {
+			transport = wrap(http.DefaultTransport)
+		}
+		return storage.NewWebDAVStorage(&storage.WebDAVConfig{
+			URL:       cfg.WebDAVURL,
+			Username:  cfg.WebDAVUsername,
+			Password:  cfg.WebDAVPassword,
+			Transport: transport,
+		})
+	}
+
 	if cfg.StorageType == "hybrid" {
+		if err := checkCacheDir(cfg.LocalCacheDir); err != nil {
+			return nil, err
+		}
+		remote, err := initS3Storage(cfg, injector)
+		if err != nil {
+			return nil, err
+		}
+
 		// Create hybrid/tiered storage with local L1 cache and S3 L2 cache
 		return storage.NewTieredStorage(&storage.TieredConfig{
 			LocalCacheDir:  cfg.LocalCacheDir,
 			LocalCacheSize: cfg.LocalCacheSize,
 			LocalCacheTTL:  cfg.LocalCacheTTL,
-			S3Config: &storage.S3Config{
-				Endpoint:        cfg.S3Endpoint,
-				AccessKeyID:     cfg.S3AccessKeyID,
-				SecretAccessKey: cfg.S3SecretAccessKey,
-				Region:          cfg.S3Region,
-				Bucket:          cfg.S3Bucket,
-				Prefix:          cfg.S3Prefix,
-				UseSSL:          cfg.S3UseSSL,
-				ForcePathStyle:  cfg.S3ForcePathStyle,
-				PartSize:        cfg.S3PartSize,
-				MaxConnections:  cfg.S3MaxConnections,
-
-				// Performance configuration
-				ReadPoolSize:   cfg.S3ReadPoolSize,
-				WritePoolSize:  cfg.S3WritePoolSize,
-				MetaPoolSize:   cfg.S3MetaPoolSize,
-				EnableHTTP2:    cfg.S3EnableHTTP2,
-				TransferAccel:  cfg.S3TransferAccel,
-				AsyncWrites:    cfg.S3AsyncWrites,
-				AsyncWorkers:   cfg.S3AsyncWorkers,
-				AsyncQueueSize: cfg.S3AsyncQueueSize,
-				ConnectTimeout: cfg.ConnectTimeout,
-				RequestTimeout: cfg.DownloadTimeout,
-			},
-			SyncWorkers:   cfg.TieredSyncWorkers,
-			SyncQueueSize: cfg.TieredSyncQueueSize,
+			EvictionGrace:  cfg.EvictionGrace,
+
+			LocalWritePolicy:   writePolicy,
+			LocalEncryptionKey: encryptionKey,
+			S3Config:           s3Config(cfg, injector),
+			Remote:             remote,
+			SyncWorkers:        cfg.TieredSyncWorkers,
+			SyncQueueSize:      cfg.TieredSyncQueueSize,
+
+			RangeCacheSize:      cfg.RangeCacheSize,
+			RangeCacheMaxLength: cfg.RangeCacheMaxLength,
 		})
 	}
 
 	if cfg.StorageType == "s3" {
-		return storage.NewS3Storage(&storage.S3Config{
-			Endpoint:        cfg.S3Endpoint,
-			AccessKeyID:     cfg.S3AccessKeyID,
-			SecretAccessKey: cfg.S3SecretAccessKey,
-			Region:          cfg.S3Region,
-			Bucket:          cfg.S3Bucket,
-			Prefix:          cfg.S3Prefix,
-			UseSSL:          cfg.S3UseSSL,
-			ForcePathStyle:  cfg.S3ForcePathStyle,
-			PartSize:        cfg.S3PartSize,
-			MaxConnections:  cfg.S3MaxConnections,
-
-			// Performance configuration
-			ReadPoolSize:   cfg.S3ReadPoolSize,
-			WritePoolSize:  cfg.S3WritePoolSize,
-			MetaPoolSize:   cfg.S3MetaPoolSize,
-			EnableHTTP2:    cfg.S3EnableHTTP2,
-			TransferAccel:  cfg.S3TransferAccel,
-			AsyncWrites:    cfg.S3AsyncWrites,
-			AsyncWorkers:   cfg.S3AsyncWorkers,
-			AsyncQueueSize: cfg.S3AsyncQueueSize,
-			ConnectTimeout: cfg.ConnectTimeout,
-			RequestTimeout: cfg.DownloadTimeout,
-		})
+		return initS3Storage(cfg, injector)
 	}
 
 	// Default to local storage with LRU eviction (no TTL for non-hybrid mode)
-	return storage.NewLRULocalStorage(cfg.CacheDir, cfg.CacheSize, 0)
+	if err := checkCacheDir(cfg.CacheDir); err != nil {
+		return nil, err
+	}
+	local, err := storage.NewLRULocalStorage(cfg.CacheDir, cfg.CacheSize, 0)
+	if err != nil {
+		return nil, err
+	}
+	local.UseWritePolicy(writePolicy)
+	local.SetEvictionGrace(cfg.EvictionGrace)
+	if encryptionKey != nil {
+		if err := local.UseEncryption(encryptionKey); err != nil {
+			_ = local.Close()
+			return nil, err
+		}
+	}
+	return local, nil
+}
+
+// cacheEncryptionKey returns the key locally cached files are encrypted
+// with, or nil to store them in plaintext
+func cacheEncryptionKey(cfg *config.Config) ([]byte, error) {
+	switch {
+	case cfg.CacheEncryptionKeyFile != "":
+		return storage.ReadEncryptionKey(cfg.CacheEncryptionKeyFile)
+	case cfg.CacheEncryptionKey != "":
+		return storage.ParseEncryptionKey(cfg.CacheEncryptionKey)
+	}
+	return nil, nil
 }
 
 // serveFromStorage serves a file from the storage backend
 func (s *Server) serveFromStorage(c *gin.Context, storageKey string) error {
-	ctx := context.Background()
+	ctx := requestContext(c)
 
-	log.Debug().
+	requestLog(c).Debug().
 		Str("storage_key", storageKey).
 		Str("method", c.Request.Method).
 		Msg("Starting file serve from storage")
 
+	// Resumed downloads only need part of the file
+	if c.GetHeader("Range") != "" {
+		if info := s.setStoredHeaders(ctx, c, storageKey); info != nil {
+			if info.ContentType != "" {
+				c.Header("Content-Type", info.ContentType)
+			}
+			c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, path.Base(storageKey)))
+			return s.serveStoredRange(c, storageKey, info)
+		}
+	}
+
 	// Get file from storage
 	reader, info, err := s.storage.Get(ctx, storageKey)
 	if err != nil {
-		log.Error().Err(err).Str("key", storageKey).Msg("Failed to get from storage")
+		requestLog(c).Error().Err(err).Str("key", storageKey).Msg("Failed to get from storage")
 		c.String(http.StatusInternalServerError, "Storage error")
 		return err
 	}
@@ -889,6 +2294,7 @@ func (s *Server) serveFromStorage(c *gin.Context, storageKey string) error {
 	} else {
 		c.Header("Content-Type", "application/octet-stream")
 	}
+	setChecksumHeaders(c, info.Metadata[storage.MetaSHA256])
 
 	if info.Size > 0 {
 		c.Header("Content-Length", fmt.Sprintf("%d", info.Size))
@@ -900,18 +2306,18 @@ func (s *Server) serveFromStorage(c *gin.Context, storageKey string) error {
 
 	// Set cache headers for better performance
 	c.Header("Cache-Control", "public, max-age=3600")
-	c.Header("ETag", fmt.Sprintf(`"%s"`, info.ETag))
+	setResumeHeaders(c, info)
 
 	// Handle HEAD requests without reading body
 	if c.Request.Method == "HEAD" {
-		log.Debug().
+		requestLog(c).Debug().
 			Str("storage_key", storageKey).
 			Int64("size", info.Size).
 			Msg("Serving HEAD request from storage")
 		return nil
 	}
 
-	log.Debug().
+	requestLog(c).Debug().
 		Str("storage_key", storageKey).
 		Int64("size", info.Size).
 		Msg("Starting file stream from storage")
@@ -920,7 +2326,7 @@ func (s *Server) serveFromStorage(c *gin.Context, storageKey string) error {
 	// c.Writer is safe for concurrent use (unlike Fiber's context)
 	written, err := io.Copy(c.Writer, reader)
 	if err != nil {
-		log.Error().
+		requestLog(c).Error().
 			Err(err).
 			Str("storage_key", storageKey).
 			Int64("bytes_written", written).
@@ -928,7 +2334,7 @@ func (s *Server) serveFromStorage(c *gin.Context, storageKey string) error {
 		return err
 	}
 
-	log.Debug().
+	requestLog(c).Debug().
 		Str("storage_key", storageKey).
 		Int64("bytes_written", written).
 		Msg("File stream completed successfully")
@@ -938,13 +2344,32 @@ func (s *Server) serveFromStorage(c *gin.Context, storageKey string) error {
 
 // serveFromStorageOptimized serves a file from storage with zero-copy optimizations when possible
 func (s *Server) serveFromStorageOptimized(c *gin.Context, storageKey string) error {
-	ctx := context.Background()
+	ctx := requestContext(c)
+
+	// Redirect to the CDN when configured so the edge serves the cached object
+	if s.cdnSigner != nil {
+		if err := s.redirectToCDN(c, storageKey); err == nil {
+			return nil
+		}
+	}
+
+	setCacheHeader(c, s.storedCacheHit(ctx, storageKey))
+
+	// A sampled download is hashed on the way out, so it gives up zero-copy
+	defer s.startSpotCheck(c, storageKey)()
 
 	// Try to get local file path for zero-copy operations (local storage only)
 	if streamStorage, ok := s.storage.(storage.StreamingStorage); ok && streamStorage.SupportsZeroCopy() {
+		// The file is opened by path, so keep it from being evicted until
+		// it has been sent
+		if pinner, ok := s.storage.(storage.Pinner); ok {
+			defer pinner.Pin(storageKey)()
+		}
 		if filePath, err := streamStorage.GetFilePath(ctx, storageKey); err == nil {
-			// Use Gin's File for local file serving
-			log.Debug().
+			s.setStoredHeaders(ctx, c, storageKey)
+			// Use Gin's File for local file serving, which also answers
+			// range and If-Range requests against the ETag set above
+			requestLog(c).Debug().
 				Str("storage_key", storageKey).
 				Str("file_path", filePath).
 				Msg("Using File serving")
@@ -954,30 +2379,33 @@ func (s *Server) serveFromStorageOptimized(c *gin.Context, storageKey string) er
 	}
 
 	// Fall back to streaming from storage
-	log.Debug().
+	requestLog(c).Debug().
 		Str("storage_key", storageKey).
 		Msg("Using streaming from storage backend")
 
 	if streamStorage, ok := s.storage.(storage.StreamingStorage); ok {
+		// The body is written before the object info comes back, so the
+		// headers come from a lookup beforehand
+		if info := s.setStoredHeaders(ctx, c, storageKey); info != nil {
+			if info.ContentType != "" {
+				c.Header("Content-Type", info.ContentType)
+			}
+			if c.GetHeader("Range") != "" {
+				return s.serveStoredRange(c, storageKey, info)
+			}
+			if info.Size > 0 {
+				c.Header("Content-Length", fmt.Sprintf("%d", info.Size))
+			}
+		}
+
 		// Use optimized streaming - c.Writer is safe for concurrent use
-		info, err := streamStorage.StreamingGet(ctx, storageKey, c.Writer)
-		if err != nil {
-			log.Error().Err(err).Str("key", storageKey).Msg("Failed to stream from storage")
+		if _, err := streamStorage.StreamingGet(ctx, storageKey, c.Writer); err != nil {
+			requestLog(c).Error().Err(err).Str("key", storageKey).Msg("Failed to stream from storage")
+			clearFileHeaders(c)
 			c.String(http.StatusInternalServerError, "Storage error")
 			return err
 		}
 
-		// Set headers
-		if info.ContentType != "" {
-			c.Header("Content-Type", info.ContentType)
-		}
-		if info.Size > 0 {
-			c.Header("Content-Length", fmt.Sprintf("%d", info.Size))
-		}
-		if info.ETag != "" {
-			c.Header("ETag", fmt.Sprintf("\"%s\"", info.ETag))
-		}
-
 		return nil
 	}
 
@@ -985,12 +2413,70 @@ func (s *Server) serveFromStorageOptimized(c *gin.Context, storageKey string) er
 	return s.serveFromStorage(c, storageKey)
 }
 
-// storageAdapter adapts storage.Storage to streaming.StorageWriter
+// errNotAtOrigin is returned by redirectToCDN for objects the CDN can't
+// serve, which are served from storage instead
+var errNotAtOrigin = errors.New("object not in the CDN's origin bucket")
+
+// redirectToCDN redirects the client to a signed CDN URL for a stored
+// object. Only objects confirmed in the default bucket, the CDN's origin,
+// are redirected: a file routed to another bucket, or cached in L1 and not
+// uploaded yet, would be a 404 at the edge.
+func (s *Server) redirectToCDN(c *gin.Context, storageKey string) error {
+	origin, ok := s.storage.(storage.Origin)
+	if !ok {
+		return errNotAtOrigin
+	}
+	objectPath, ok := origin.OriginKey(requestContext(c), storageKey)
+	if !ok {
+		requestLog(c).Debug().Str("storage_key", storageKey).Msg("Object not in the CDN origin bucket, serving from storage")
+		return errNotAtOrigin
+	}
+
+	ttl := s.config.CDNURLTTL
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+
+	signedURL, err := s.cdnSigner.SignURL(objectPath, time.Now().Add(ttl))
+	if err != nil {
+		requestLog(c).Error().Err(err).Str("storage_key", storageKey).Msg("Failed to sign CDN URL, serving from storage")
+		return err
+	}
+
+	requestLog(c).Debug().Str("storage_key", storageKey).Msg("🌍 Redirecting to CDN")
+	c.Header("Cache-Control", "private, no-store")
+	c.Redirect(http.StatusFound, signedURL)
+	return nil
+}
+
+// storageAdapter adapts storage.Storage to streaming.StorageWriter, announcing
+// each file fetched from upstream
 type storageAdapter struct {
-	storage storage.Storage
+	storage     storage.Storage
+	webhooks    *webhook.Notifier
+	hooks       hookList
+	keys        *storage.KeyLayout
+	indexURL    string
+	replication *replication.Log
 }
 
 func (sa *storageAdapter) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
-	_, err := sa.storage.Put(ctx, key, reader, size, contentType)
+	if sha256Hex := digestCheckFrom(ctx); sha256Hex != "" {
+		reader = storage.Verify(reader, size, sha256Hex)
+	}
+	info, err := sa.storage.Put(ctx, key, reader, size, contentType)
+	if err == nil {
+		if info != nil {
+			size = info.Size
+		}
+		sa.webhooks.Notify(webhook.EventFileCached, cacheEventData(sa.indexURL, sa.keys, key, size))
+		pkg, file, ok := sa.keys.Parse(key)
+		if ok {
+			sa.replication.Append(key, pkg, file, size)
+		}
+		if len(sa.hooks) > 0 {
+			sa.hooks.fileCached(ctx, FileCached{Index: sa.indexURL, Package: pkg, File: file, Key: key, Size: size})
+		}
+	}
 	return err
 }
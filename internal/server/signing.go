@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/signing"
+)
+
+// signedRoutes are the responses signed when a signing key is configured:
+// the simple API pages installers resolve from, and the provenance they
+// may check files against
+var signedRoutes = map[string]bool{
+	"/simple/":                   true,
+	"/simple/:package/":          true,
+	"/index/":                    true,
+	"/index/:package":            true,
+	"/provenance/:package/:file": true,
+}
+
+// signingMiddleware holds back the responses of signed routes until the
+// handler is done, then sends them with a signature of the body in
+// signing.Header. It runs inside compression, so the signature covers the
+// body as clients see it after decoding.
+func (s *Server) signingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.signer == nil || c.Request.Method != http.MethodGet || !signedRoutes[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		w := &signingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		body := w.body.Bytes()
+		c.Header(signing.Header, s.signer.Sign(s.config.BasePath+c.Request.URL.RequestURI(), time.Now(), body))
+		c.Writer.WriteHeader(w.Status())
+		if _, err := c.Writer.Write(body); err != nil {
+			requestLog(c).Debug().Err(err).Msg("Failed to send signed response")
+		}
+	}
+}
+
+// signingWriter buffers a response, status included, so its signature can
+// be sent in a header before the body
+type signingWriter struct {
+	gin.ResponseWriter
+	body    bytes.Buffer
+	status  int
+	written bool
+}
+
+// WriteHeader sets the status, which can change until the body is written
+func (w *signingWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *signingWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *signingWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *signingWriter) WriteString(data string) (int, error) {
+	w.written = true
+	return w.body.WriteString(data)
+}
+
+// Flush is a no-op: nothing is sent before the signature
+func (w *signingWriter) Flush() {}
+
+func (w *signingWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *signingWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *signingWriter) Written() bool {
+	return w.written
+}
+
+// handleSigningKey publishes the public key index responses are signed with
+func (s *Server) handleSigningKey(c *gin.Context) {
+	if s.signer == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Response signing is not enabled",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"algorithm":  "ed25519",
+			"key_id":     s.signer.KeyID(),
+			"public_key": base64.StdEncoding.EncodeToString(s.signer.PublicKey()),
+			"header":     signing.Header,
+		},
+	})
+}
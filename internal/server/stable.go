@@ -0,0 +1,52 @@
+package server
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/huyhandes/groxpi/internal/distfile"
+	"github.com/huyhandes/groxpi/internal/pypi"
+)
+
+// stableJSON encodes like sonic.ConfigFastest but sorts map keys, so the
+// same data always renders to the same bytes
+var stableJSON = sonic.Config{
+	SortMapKeys:             true,
+	NoValidateJSONMarshaler: true,
+	NoValidateJSONSkip:      true,
+}.Froze()
+
+// jsonAPI returns the encoder index pages are rendered with
+func (s *Server) jsonAPI() sonic.API {
+	if s.config.StableJSON {
+		return stableJSON
+	}
+	return sonic.ConfigFastest
+}
+
+// stableProject returns a copy of project with its files ordered by
+// version and then filename, and its versions in PEP 440 order, so every
+// instance renders the same page whatever order upstream listed them in.
+// The fetched project may be shared with other callers, so it is left as is.
+func stableProject(project *pypi.Project) *pypi.Project {
+	stable := *project
+	stable.Files = slices.Clone(project.Files)
+	stable.Versions = slices.Clone(project.Versions)
+	stable.Tracks = slices.Sorted(slices.Values(project.Tracks))
+	stable.AlternateLocations = slices.Sorted(slices.Values(project.AlternateLocations))
+
+	versions := make(map[string]string, len(stable.Files))
+	for _, file := range stable.Files {
+		versions[file.Name] = pypi.FileVersion(file.Name)
+	}
+	slices.SortStableFunc(stable.Files, func(a, b pypi.FileInfo) int {
+		if c := distfile.CompareVersions(versions[a.Name], versions[b.Name]); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	slices.SortStableFunc(stable.Versions, distfile.CompareVersions)
+	return &stable
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/clientid"
+	"github.com/huyhandes/groxpi/internal/pypi"
+	"github.com/huyhandes/groxpi/internal/tenant"
+	"github.com/huyhandes/groxpi/internal/upstream"
+)
+
+// defaultTenant labels the root index in metrics
+const defaultTenant = "default"
+
+// tenantMiddleware enforces an index's access tokens and rate limit and
+// counts its traffic. Health checks are exempt so probes keep working
+// without credentials.
+func tenantMiddleware(tokens tenant.Tokens, limiter *tenant.RateLimiter, stats *tenant.Stats) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.URL.Path == "/health" {
+			c.Next()
+			return
+		}
+
+		if !tokens.Authorized(c.Request) {
+			stats.RecordUnauthorized()
+			c.Header("WWW-Authenticate", `Basic realm="groxpi"`)
+			c.String(http.StatusUnauthorized, "Unauthorized")
+			c.Abort()
+			return
+		}
+
+		if ok, wait := limiter.Allow(); !ok {
+			stats.RecordRateLimited()
+			seconds := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.String(http.StatusTooManyRequests, "Rate limit exceeded, retry after %d seconds", seconds)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+		stats.RecordRequest(int64(c.Writer.Size()))
+	}
+}
+
+// tenantName returns the metrics label for this index
+func (s *Server) tenantName() string {
+	if s.config.BasePath == "" {
+		return defaultTenant
+	}
+	return strings.TrimPrefix(s.config.BasePath, "/")
+}
+
+// cacheUsage reports the bytes held in and allowed for the index's
+// size-bounded cache, if its storage backend has one
+func (s *Server) cacheUsage() (used, quota int64, ok bool) {
+	statter, isStatter := s.storage.(interface{ GetStats() map[string]interface{} })
+	if !isStatter {
+		return 0, 0, false
+	}
+	stats := statter.GetStats()
+	used, _ = stats["current_size_bytes"].(int64)
+	quota, _ = stats["max_size_bytes"].(int64)
+	return used, quota, true
+}
+
+// handleMetrics exposes per-tenant counters in the Prometheus text format
+// for fair-share monitoring and chargeback
+func (s *Server) handleMetrics(c *gin.Context) {
+	servers := []*Server{s}
+	names := make([]string, 0, len(s.mounts))
+	for name := range s.mounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		servers = append(servers, s.mounts[name])
+	}
+
+	var sb strings.Builder
+	metric := func(name, kind, help string, value func(*Server) (int64, bool)) {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, srv := range servers {
+			if v, ok := value(srv); ok {
+				fmt.Fprintf(&sb, "%s{tenant=%q} %d\n", name, srv.tenantName(), v)
+			}
+		}
+	}
+
+	metric("groxpi_tenant_requests_total", "counter", "Requests served per tenant",
+		func(srv *Server) (int64, bool) { return srv.tenantStats.Snapshot().Requests, true })
+	metric("groxpi_tenant_response_bytes_total", "counter", "Response bytes sent per tenant",
+		func(srv *Server) (int64, bool) { return srv.tenantStats.Snapshot().ResponseBytes, true })
+	metric("groxpi_tenant_rate_limited_total", "counter", "Requests rejected by the tenant rate limit",
+		func(srv *Server) (int64, bool) { return srv.tenantStats.Snapshot().RateLimited, true })
+	metric("groxpi_tenant_unauthorized_total", "counter", "Requests rejected for missing or invalid tokens",
+		func(srv *Server) (int64, bool) { return srv.tenantStats.Snapshot().Unauthorized, true })
+	metric("groxpi_tenant_cache_bytes", "gauge", "Bytes held in the tenant's local cache",
+		func(srv *Server) (int64, bool) { used, _, ok := srv.cacheUsage(); return used, ok })
+	metric("groxpi_tenant_cache_quota_bytes", "gauge", "Size quota of the tenant's local cache",
+		func(srv *Server) (int64, bool) { _, quota, ok := srv.cacheUsage(); return quota, ok })
+	metric("groxpi_tenant_cache_growth_bytes_per_day", "gauge", "Growth of the tenant's local cache over the capacity window",
+		func(srv *Server) (int64, bool) { return srv.capacity.Forecast().GrowthPerDay, srv.capacity != nil })
+	metric("groxpi_tenant_cache_full_in_seconds", "gauge", "Time until the tenant's local cache is projected to reach its size quota",
+		func(srv *Server) (int64, bool) {
+			forecast := srv.capacity.Forecast()
+			return forecast.FullInSeconds, forecast.Projected
+		})
+	metric("groxpi_tenant_cache_capacity_alert", "gauge", "Whether the tenant's local cache is projected full within the alert horizon",
+		func(srv *Server) (int64, bool) {
+			return int64(boolMetric(srv.capacity.Forecast().Alerting)), srv.capacity != nil
+		})
+	metric("groxpi_tenant_cache_hits", "gauge", "Downloads served from files currently in the tenant's local cache",
+		func(srv *Server) (int64, bool) {
+			if srv.catalog == nil {
+				return 0, false
+			}
+			return srv.catalog.Stats().Hits, true
+		})
+	metric("groxpi_tenant_dedup_hits_total", "counter", "Downloads served from an identical file cached under another name or by another tenant",
+		func(srv *Server) (int64, bool) { return srv.dedupHits.Load(), srv.catalog != nil })
+	metric("groxpi_tenant_peer_hits_total", "counter", "Downloads copied from another groxpi on the LAN instead of upstream",
+		func(srv *Server) (int64, bool) { return srv.peerHits.Load(), srv.peers != nil })
+	metric("groxpi_tenant_index_early_refreshes_total", "counter", "Index pages refreshed in the background before their cache entry expired",
+		func(srv *Server) (int64, bool) { return srv.earlyRefreshes.Load(), true })
+	metric("groxpi_tenant_spot_checks_total", "counter", "Served files re-hashed against their stored SHA-256",
+		func(srv *Server) (int64, bool) { return srv.spotChecks.Load(), srv.config.VerifyRate > 0 })
+	metric("groxpi_tenant_corrupt_files_total", "counter", "Spot-checked files whose bytes did not match their stored SHA-256 and were evicted",
+		func(srv *Server) (int64, bool) { return srv.corruptFiles.Load(), srv.config.VerifyRate > 0 })
+
+	// Traffic per tenant, installer, team and CI use
+	clientMetric := func(name, help string, value func(clientid.Count) int64) {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, srv := range servers {
+			for _, count := range srv.clientStats.Snapshot() {
+				fmt.Fprintf(&sb, "%s{tenant=%q,installer=%q,team=%q,ci=%q} %d\n", name, srv.tenantName(), count.Installer, count.Team, strconv.FormatBool(count.CI), value(count))
+			}
+		}
+	}
+	clientMetric("groxpi_client_requests_total", "Requests per installer and team",
+		func(count clientid.Count) int64 { return count.Requests })
+	clientMetric("groxpi_client_downloads_total", "Package file downloads per installer and team",
+		func(count clientid.Count) int64 { return count.Downloads })
+	clientMetric("groxpi_client_download_bytes_total", "Package file bytes sent per installer and team",
+		func(count clientid.Count) int64 { return count.DownloadBytes })
+
+	// Upstream connection timings, per tenant and upstream host
+	traces := make([]map[string]upstream.TraceStats, len(servers))
+	hosts := make([][]string, len(servers))
+	for i, srv := range servers {
+		traces[i] = srv.tracer.Stats()
+		for host := range traces[i] {
+			hosts[i] = append(hosts[i], host)
+		}
+		sort.Strings(hosts[i])
+	}
+	hostMetric := func(name, kind, help string, value func(upstream.TraceStats) int64) {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for i, srv := range servers {
+			for _, host := range hosts[i] {
+				fmt.Fprintf(&sb, "%s{tenant=%q,host=%q} %d\n", name, srv.tenantName(), host, value(traces[i][host]))
+			}
+		}
+	}
+	hostMetric("groxpi_upstream_requests_total", "counter", "Requests sent to the upstream host",
+		func(st upstream.TraceStats) int64 { return st.Requests })
+	hostMetric("groxpi_upstream_connections_reused_total", "counter", "Upstream requests sent on a reused connection",
+		func(st upstream.TraceStats) int64 { return st.Reused })
+	fmt.Fprintf(&sb, "# HELP groxpi_upstream_phase_seconds Time spent in each phase of upstream requests (ttfb: request written to first response byte)\n# TYPE groxpi_upstream_phase_seconds summary\n")
+	for i, srv := range servers {
+		for _, host := range hosts[i] {
+			st := traces[i][host]
+			for _, phase := range []struct {
+				name  string
+				stats upstream.PhaseStats
+			}{{"dns", st.DNS}, {"connect", st.Connect}, {"tls", st.TLS}, {"ttfb", st.TTFB}} {
+				labels := fmt.Sprintf("tenant=%q,host=%q,phase=%q", srv.tenantName(), host, phase.name)
+				fmt.Fprintf(&sb, "groxpi_upstream_phase_seconds_sum{%s} %g\n", labels, phase.stats.Total.Seconds())
+				fmt.Fprintf(&sb, "groxpi_upstream_phase_seconds_count{%s} %d\n", labels, phase.stats.Count)
+			}
+		}
+	}
+
+	// Index page compression, per tenant and content encoding
+	encodingMetric := func(name, help string, value func(pypi.EncodingStats) int64) {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, srv := range servers {
+			stats := srv.pypiClient.EncodingStats()
+			encodings := make([]string, 0, len(stats))
+			for encoding := range stats {
+				encodings = append(encodings, encoding)
+			}
+			sort.Strings(encodings)
+			for _, encoding := range encodings {
+				fmt.Fprintf(&sb, "%s{tenant=%q,encoding=%q} %d\n", name, srv.tenantName(), encoding, value(stats[encoding]))
+			}
+		}
+	}
+	encodingMetric("groxpi_upstream_index_wire_bytes_total", "Index response bytes received from upstream, before decoding",
+		func(st pypi.EncodingStats) int64 { return st.WireBytes })
+	encodingMetric("groxpi_upstream_index_decoded_bytes_total", "Index response bytes after decoding",
+		func(st pypi.EncodingStats) int64 { return st.DecodedBytes })
+
+	// The heap is shared by every tenant
+	if s.memory != nil {
+		stats := s.memory.Stats()
+		fmt.Fprintf(&sb, "# HELP groxpi_memory_heap_bytes Heap bytes at the last watchdog sample\n# TYPE groxpi_memory_heap_bytes gauge\ngroxpi_memory_heap_bytes %d\n", stats.HeapBytes)
+		fmt.Fprintf(&sb, "# HELP groxpi_memory_overloaded Whether downloads are being shed for memory\n# TYPE groxpi_memory_overloaded gauge\ngroxpi_memory_overloaded %d\n", boolMetric(stats.Overloaded))
+		fmt.Fprintf(&sb, "# HELP groxpi_memory_shed_total Downloads rejected because the heap was over its threshold\n# TYPE groxpi_memory_shed_total counter\ngroxpi_memory_shed_total %d\n", stats.Shed)
+	}
+
+	if s.prefetcher != nil {
+		stats := s.prefetcher.Stats()
+		fmt.Fprintf(&sb, "# HELP groxpi_prefetch_total Prefetches after package listings by outcome\n# TYPE groxpi_prefetch_total counter\n")
+		fmt.Fprintf(&sb, "groxpi_prefetch_total{result=\"downloaded\"} %d\n", stats.Downloaded)
+		fmt.Fprintf(&sb, "groxpi_prefetch_total{result=\"skipped\"} %d\n", stats.Skipped)
+		fmt.Fprintf(&sb, "groxpi_prefetch_total{result=\"dropped\"} %d\n", stats.Dropped)
+		fmt.Fprintf(&sb, "groxpi_prefetch_total{result=\"failed\"} %d\n", stats.Failed)
+		fmt.Fprintf(&sb, "# HELP groxpi_prefetch_bytes_total Bytes downloaded by prefetches\n# TYPE groxpi_prefetch_bytes_total counter\ngroxpi_prefetch_bytes_total %d\n", stats.BytesDownloaded)
+	}
+
+	if s.chaos != nil {
+		stats := s.chaos.Stats()
+		fmt.Fprintf(&sb, "# HELP groxpi_chaos_faults_total Faults injected for resilience testing\n# TYPE groxpi_chaos_faults_total counter\n")
+		for _, boundary := range slices.Sorted(maps.Keys(stats)) {
+			for _, fault := range slices.Sorted(maps.Keys(stats[boundary])) {
+				fmt.Fprintf(&sb, "groxpi_chaos_faults_total{boundary=%q,fault=%q} %d\n", boundary, fault, stats[boundary][fault])
+			}
+		}
+	}
+
+	// Index mirror probing belongs to the root index
+	if s.prober != nil {
+		status := s.prober.Status()
+		fmt.Fprintf(&sb, "# HELP groxpi_index_up Whether the index or mirror passes health probes\n# TYPE groxpi_index_up gauge\n")
+		for _, st := range status {
+			fmt.Fprintf(&sb, "groxpi_index_up{index=%q} %d\n", st.URL, boolMetric(st.Healthy))
+		}
+		fmt.Fprintf(&sb, "# HELP groxpi_index_active Whether requests are currently sent to the index or mirror\n# TYPE groxpi_index_active gauge\n")
+		for _, st := range status {
+			fmt.Fprintf(&sb, "groxpi_index_active{index=%q} %d\n", st.URL, boolMetric(st.Active))
+		}
+		fmt.Fprintf(&sb, "# HELP groxpi_index_probe_latency_seconds Moving average of probe latency\n# TYPE groxpi_index_probe_latency_seconds gauge\n")
+		for _, st := range status {
+			fmt.Fprintf(&sb, "groxpi_index_probe_latency_seconds{index=%q} %g\n", st.URL, st.Latency.Seconds())
+		}
+		fmt.Fprintf(&sb, "# HELP groxpi_index_switches_total Times requests moved to another index or mirror\n# TYPE groxpi_index_switches_total counter\ngroxpi_index_switches_total %d\n", s.prober.Switches())
+	}
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(sb.String()))
+}
+
+func boolMetric(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
+	"github.com/huyhandes/groxpi/internal/storage"
+	"github.com/huyhandes/groxpi/internal/trash"
+)
+
+var errTrashDisabled = errors.New("trash is disabled (GROXPI_TRASH_RETENTION=0)")
+
+// purgePackageFiles removes a package's cached files, moving them to the
+// trash when soft is set
+func (s *Server) purgePackageFiles(c *gin.Context, packageName string, soft bool) (interface{}, error) {
+	ctx := requestContext(c)
+
+	// Gather files left under the fallback key layout first, or the purge
+	// would miss them and the next download would bring them back
+	if s.fallbackKeys != nil {
+		if _, err := storage.MigratePackage(ctx, s.storage, s.fallbackKeys, s.keys, packageName); err != nil {
+			return nil, fmt.Errorf("failed to move files from the fallback key layout: %w", err)
+		}
+	}
+
+	if soft {
+		if s.trash == nil {
+			return nil, errTrashDisabled
+		}
+		return s.trash.Move(ctx, packageName)
+	}
+
+	files, size, err := s.deletePackageFiles(ctx, s.keys.PackagePrefix(packageName))
+	if err != nil {
+		return nil, err
+	}
+
+	requestLog(c).Info().
+		Str("package", packageName).
+		Int("files", files).
+		Int64("bytes", size).
+		Msg("Package files deleted")
+
+	return gin.H{"package": packageName, "files": files, "bytes": size}, nil
+}
+
+// deletePackageFiles deletes the objects under prefix, in bulk where the
+// backend supports it
+func (s *Server) deletePackageFiles(ctx context.Context, prefix string) (int, int64, error) {
+	if deleter, ok := s.storage.(storage.PrefixDeleter); ok {
+		files, size, err := deleter.DeletePrefix(ctx, prefix)
+		if err != nil {
+			return files, size, fmt.Errorf("failed to delete cached files: %w", err)
+		}
+		return files, size, nil
+	}
+
+	objects, err := s.storage.List(ctx, storage.ListOptions{Prefix: prefix})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list cached files: %w", err)
+	}
+
+	var size int64
+	for _, obj := range objects {
+		if err := s.storage.Delete(ctx, obj.Key); err != nil {
+			return 0, 0, fmt.Errorf("failed to delete %s: %w", obj.Key, err)
+		}
+		size += obj.Size
+	}
+	return len(objects), size, nil
+}
+
+func (s *Server) handleTrashList(c *gin.Context) {
+	if s.trash == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": errTrashDisabled.Error(),
+		})
+		return
+	}
+
+	entries, err := s.trash.List(requestContext(c))
+	if err != nil {
+		requestLog(c).Error().Err(err).Msg("Failed to list trash")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"retention_seconds": int64(s.trash.Retention().Seconds()),
+			"packages":          entries,
+		},
+	})
+}
+
+func (s *Server) handleTrashRestore(c *gin.Context) {
+	if s.trash == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": errTrashDisabled.Error(),
+		})
+		return
+	}
+
+	packageName := cachekey.Package(c.Param("package"))
+
+	result, err := s.trash.Restore(requestContext(c), packageName)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, trash.ErrNotFound) {
+			status = http.StatusNotFound
+		} else {
+			requestLog(c).Error().Err(err).Str("package", packageName).Msg("Failed to restore package")
+		}
+		c.JSON(status, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   result,
+	})
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validatedParams are the path parameters naming a package or file, which
+// end up in storage keys and upstream URLs
+var validatedParams = []string{"package", "file"}
+
+// Parameter error codes returned in 400 responses
+const (
+	codeEmptyParam       = "empty_parameter"
+	codeParamTooLong     = "parameter_too_long"
+	codePathTraversal    = "path_traversal"
+	codeEncodedSlash     = "encoded_slash"
+	codeInvalidCharacter = "invalid_character"
+)
+
+// paramError describes why a path parameter was rejected
+type paramError struct {
+	Code    string
+	Param   string
+	Message string
+}
+
+// validateParamsMiddleware rejects package and file names that could escape
+// their storage prefix or confuse upstream lookups, so handlers can use them
+// as-is. Names longer than maxLength (0 = unlimited) are rejected too.
+func validateParamsMiddleware(maxLength int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := validateParams(c, maxLength); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": err.Message,
+				"code":    err.Code,
+				"param":   err.Param,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func validateParams(c *gin.Context, maxLength int) *paramError {
+	var checked bool
+	for _, name := range validatedParams {
+		value, ok := c.Params.Get(name)
+		if !ok {
+			continue
+		}
+		checked = true
+		if err := validatePathParam(name, value, maxLength); err != nil {
+			return err
+		}
+	}
+
+	// A %2F or %5C decodes to a separator inside a single segment; the
+	// router has already split on the decoded path, so refuse to guess
+	if checked {
+		escaped := strings.ToLower(c.Request.URL.EscapedPath())
+		if strings.Contains(escaped, "%2f") || strings.Contains(escaped, "%5c") {
+			return &paramError{Code: codeEncodedSlash, Message: "Encoded slashes are not allowed in the path"}
+		}
+	}
+	return nil
+}
+
+// validatePathParam checks a single package or file name
+func validatePathParam(name, value string, maxLength int) *paramError {
+	switch {
+	case value == "":
+		return &paramError{Code: codeEmptyParam, Param: name, Message: fmt.Sprintf("Parameter %q is empty", name)}
+	case maxLength > 0 && len(value) > maxLength:
+		return &paramError{Code: codeParamTooLong, Param: name, Message: fmt.Sprintf("Parameter %q exceeds %d bytes", name, maxLength)}
+	case value == "." || value == ".." || strings.ContainsAny(value, `/\`):
+		return &paramError{Code: codePathTraversal, Param: name, Message: fmt.Sprintf("Parameter %q must not be a path", name)}
+	}
+
+	for i := 0; i < len(value); i++ {
+		if ch := value[i]; ch < 0x20 || ch == 0x7f {
+			return &paramError{Code: codeInvalidCharacter, Param: name, Message: fmt.Sprintf("Parameter %q contains a control character", name)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// startSpotCheck samples a download of the object stored under key for
+// re-verification, at the configured verify rate. A sampled response is
+// hashed as it is written, and the returned func, called once the body has
+// been sent, compares the digest against the stored SHA-256 and evicts the
+// object if they differ. Range, HEAD and conditional responses don't carry
+// the whole file, so they are not checked.
+func (s *Server) startSpotCheck(c *gin.Context, key string) (finish func()) {
+	if s.config.VerifyRate <= 0 || c.Request.Method != http.MethodGet || c.GetHeader("Range") != "" || rand.Float64() >= s.config.VerifyRate {
+		return func() {}
+	}
+
+	ctx := requestContext(c)
+	info, err := s.storage.Stat(ctx, key)
+	if err != nil {
+		return func() {}
+	}
+	expected := strings.ToLower(info.Metadata[storage.MetaSHA256])
+	if expected == "" {
+		return func() {}
+	}
+
+	w := &hashingWriter{ResponseWriter: c.Writer, hash: sha256.New()}
+	c.Writer = w
+	return func() {
+		c.Writer = w.ResponseWriter
+		if w.Status() != http.StatusOK || w.written != info.Size {
+			return
+		}
+
+		s.spotChecks.Add(1)
+		if actual := hex.EncodeToString(w.hash.Sum(nil)); actual != expected {
+			s.corruptFiles.Add(1)
+			requestLog(c).Error().
+				Str("storage_key", key).
+				Str("expected_sha256", expected).
+				Str("actual_sha256", actual).
+				Msg("🚨 Served file does not match its stored hash, evicting it")
+			// The client already has the bad bytes; evicting makes the next
+			// request fetch a fresh copy from upstream
+			if err := s.storage.Delete(context.WithoutCancel(ctx), key); err != nil {
+				requestLog(c).Error().Err(err).Str("storage_key", key).Msg("Failed to evict corrupt file")
+			}
+		}
+	}
+}
+
+// hashingWriter tees a response body through a hash as it is sent
+type hashingWriter struct {
+	gin.ResponseWriter
+	hash    hash.Hash
+	written int64
+}
+
+func (w *hashingWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.hash.Write(data[:n])
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *hashingWriter) WriteString(data string) (int, error) {
+	return w.Write([]byte(data))
+}
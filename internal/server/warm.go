@@ -0,0 +1,63 @@
+package server
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/lockfile"
+)
+
+// maxLockfileSize bounds POST /warm bodies; large uv.lock files are a few MB
+const maxLockfileSize = 16 * 1024 * 1024
+
+// handleWarm parses a requirements.txt, poetry.lock or uv.lock body and
+// starts a job downloading the files it pins into storage. The format is
+// detected from the content unless given as ?format=requirements|poetry|uv.
+func (s *Server) handleWarm(c *gin.Context) {
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxLockfileSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Failed to read request body",
+		})
+		return
+	}
+	if len(data) > maxLockfileSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"status":  "error",
+			"message": "Lockfile too large",
+		})
+		return
+	}
+
+	reqs, err := lockfile.Parse(data, c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	s.acceptJob(c, s.warmer.Submit(reqs))
+}
+
+// handleWarmStatus reports the progress of a warm job. Kept alongside
+// GET /jobs/:id for clients written before the job API.
+func (s *Server) handleWarmStatus(c *gin.Context) {
+	job, ok := s.warmer.Status(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Warm job not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   job,
+	})
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/huyhandes/groxpi/internal/capacity"
+	"github.com/huyhandes/groxpi/internal/storage"
+	"github.com/huyhandes/groxpi/internal/webhook"
+)
+
+// cacheEventData describes a cached object in file.cached and cache.evicted
+// payloads. The index URL tells mounted indexes apart.
+func cacheEventData(indexURL string, keys *storage.KeyLayout, key string, size int64) gin.H {
+	data := gin.H{
+		"index": indexURL,
+		"key":   key,
+		"size":  size,
+	}
+	if pkg, file, ok := keys.Parse(key); ok {
+		data["package"] = pkg
+		data["file"] = file
+	}
+	return data
+}
+
+// capacityEventData describes the forecast in cache.capacity payloads
+func capacityEventData(indexURL string, forecast capacity.Forecast) gin.H {
+	return gin.H{
+		"index":                indexURL,
+		"used_bytes":           forecast.UsedBytes,
+		"quota_bytes":          forecast.QuotaBytes,
+		"growth_bytes_per_day": forecast.GrowthPerDay,
+		"full_in_seconds":      forecast.FullInSeconds,
+	}
+}
+
+// upstreamHealthNotifier turns upstream health changes into upstream.down
+// and upstream.recovered events
+func upstreamHealthNotifier(webhooks *webhook.Notifier, indexURL string) func(down bool, err error) {
+	return func(down bool, err error) {
+		if !down {
+			webhooks.Notify(webhook.EventUpstreamRecovered, gin.H{"index": indexURL})
+			return
+		}
+
+		data := gin.H{"index": indexURL}
+		if err != nil {
+			data["error"] = err.Error()
+		}
+		webhooks.Notify(webhook.EventUpstreamDown, data)
+	}
+}
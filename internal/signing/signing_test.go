@@ -0,0 +1,72 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := NewSigner(key)
+	at := time.Unix(1700000000, 0)
+	body := []byte(`<a href="/simple/six/six-1.16.0.tar.gz">six-1.16.0.tar.gz</a>`)
+	header := signer.Sign("/simple/six/", at, body)
+
+	signed, err := Verify(signer.PublicKey(), header, "/simple/six/", body)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !signed.Equal(at) {
+		t.Errorf("Expected signing time %v, got %v", at, signed)
+	}
+
+	if _, err := Verify(signer.PublicKey(), header, "/simple/six/", []byte("tampered")); err == nil {
+		t.Error("Expected a tampered body to fail verification")
+	}
+	if _, err := Verify(signer.PublicKey(), header, "/simple/requests/", body); err == nil {
+		t.Error("Expected a signature replayed for another path to fail verification")
+	}
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := Verify(other, header, "/simple/six/", body); err == nil {
+		t.Error("Expected verification with another key to fail")
+	}
+	if _, err := Verify(signer.PublicKey(), "garbage", "/simple/six/", body); err == nil {
+		t.Error("Expected a malformed header to fail verification")
+	}
+}
+
+func TestLoadSigner(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := LoadSigner(path)
+	if err != nil {
+		t.Fatalf("LoadSigner failed: %v", err)
+	}
+	if signer.KeyID() != KeyID(key.Public().(ed25519.PublicKey)) || len(signer.KeyID()) != 16 {
+		t.Errorf("Unexpected key ID %q", signer.KeyID())
+	}
+
+	if _, err := LoadSigner(filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("Expected a missing key file to fail")
+	}
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Encrypted local files are AES-256-GCM in fixed-size segments, so a range
+// can be served by decrypting only the segments it covers:
+//
+//	magic (4) | nonce prefix (8) | segment 0 | segment 1 | ...
+//
+// Each segment seals up to encryptedSegmentSize bytes under the nonce
+// prefix followed by its big-endian index, with a final-segment flag as
+// additional data so a truncated file fails to decrypt rather than reading
+// short. An empty file is a single empty final segment. The plaintext size
+// follows from the file size, so stat and listings need not open the file.
+const (
+	encryptedMagic       = "GXE1"
+	encryptedHeaderSize  = len(encryptedMagic) + 8
+	encryptedSegmentSize = 64 * 1024
+	encryptedOverhead    = 16 // GCM tag per segment
+	encryptedSealedSize  = encryptedSegmentSize + encryptedOverhead
+)
+
+var (
+	segmentFinal    = []byte{1}
+	segmentNotFinal = []byte{0}
+)
+
+// ParseEncryptionKey decodes a base64-encoded 32-byte AES-256 key, as
+// generated by "openssl rand -base64 32"
+func ParseEncryptionKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode encryption key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// ReadEncryptionKey reads a base64-encoded key from path, such as a secret
+// mounted by a KMS or secrets manager agent
+func ReadEncryptionKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption key: %w", err)
+	}
+	return ParseEncryptionKey(string(data))
+}
+
+func newFileCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// plaintextSize returns the size of the data an encrypted file of size
+// bytes holds
+func plaintextSize(size int64) int64 {
+	body := size - int64(encryptedHeaderSize)
+	if body <= 0 {
+		return 0
+	}
+	segments := (body + encryptedSealedSize - 1) / encryptedSealedSize
+	return body - segments*encryptedOverhead
+}
+
+func segmentNonce(prefix []byte, index uint32) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[8:], index)
+	return nonce
+}
+
+// encryptingWriter seals what is written to it into w, one segment at a
+// time. Close writes the final segment; it does not close w.
+type encryptingWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	buf    []byte
+	sealed []byte
+	n      int64 // Plaintext bytes written
+}
+
+func newEncryptingWriter(w io.Writer, aead cipher.AEAD) (*encryptingWriter, error) {
+	prefix := make([]byte, 8)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	if _, err := w.Write(append([]byte(encryptedMagic), prefix...)); err != nil {
+		return nil, err
+	}
+	return &encryptingWriter{
+		w:      w,
+		aead:   aead,
+		prefix: prefix,
+		buf:    make([]byte, 0, encryptedSegmentSize),
+		sealed: make([]byte, 0, encryptedSealedSize),
+	}, nil
+}
+
+func (e *encryptingWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// A full segment is only sealed once more data arrives, since the
+		// last one must be sealed as final
+		if len(e.buf) == encryptedSegmentSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):encryptedSegmentSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+		e.n += int64(n)
+	}
+	return written, nil
+}
+
+func (e *encryptingWriter) seal(final bool) error {
+	flag := segmentNotFinal
+	if final {
+		flag = segmentFinal
+	}
+	e.sealed = e.aead.Seal(e.sealed[:0], segmentNonce(e.prefix, e.index), e.buf, flag)
+	if _, err := e.w.Write(e.sealed); err != nil {
+		return err
+	}
+	e.index++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+func (e *encryptingWriter) Close() error {
+	return e.seal(true)
+}
+
+// decryptingReader reads the plaintext of an encrypted file from an offset
+type decryptingReader struct {
+	file     *os.File
+	aead     cipher.AEAD
+	prefix   []byte
+	fileSize int64
+	size     int64 // Plaintext size
+	pos      int64 // Next plaintext offset to return
+	end      int64 // Plaintext offset to stop at
+	segments int64
+	sealed   []byte
+	plain    []byte // Rest of the current segment from pos
+}
+
+// newDecryptingReader reads the plaintext of file, whose size on disk is
+// fileSize, from offset up to length bytes (0 = to the end). It takes
+// ownership of file.
+func newDecryptingReader(file *os.File, fileSize int64, aead cipher.AEAD, offset, length int64) (*decryptingReader, error) {
+	header := make([]byte, encryptedHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil || string(header[:len(encryptedMagic)]) != encryptedMagic {
+		return nil, errors.New("file is not encrypted")
+	}
+
+	size := plaintextSize(fileSize)
+	if offset < 0 || offset > size {
+		return nil, fmt.Errorf("range offset %d out of bounds", offset)
+	}
+	end := size
+	if length > 0 && offset+length < size {
+		end = offset + length
+	}
+	body := fileSize - int64(encryptedHeaderSize)
+	return &decryptingReader{
+		file:     file,
+		aead:     aead,
+		prefix:   header[len(encryptedMagic):],
+		fileSize: fileSize,
+		size:     size,
+		pos:      offset,
+		end:      end,
+		segments: (body + encryptedSealedSize - 1) / encryptedSealedSize,
+		sealed:   make([]byte, encryptedSealedSize),
+	}, nil
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	if d.pos >= d.end {
+		return 0, io.EOF
+	}
+	if len(d.plain) == 0 {
+		if err := d.open(d.pos / encryptedSegmentSize); err != nil {
+			return 0, err
+		}
+		d.plain = d.plain[d.pos%encryptedSegmentSize:]
+	}
+	n := copy(p, d.plain)
+	if remaining := d.end - d.pos; int64(n) > remaining {
+		n = int(remaining)
+	}
+	d.plain = d.plain[n:]
+	d.pos += int64(n)
+	return n, nil
+}
+
+// open decrypts segment index into plain
+func (d *decryptingReader) open(index int64) error {
+	at := int64(encryptedHeaderSize) + index*encryptedSealedSize
+	sealed := d.sealed
+	if index == d.segments-1 {
+		sealed = sealed[:d.fileSize-at]
+	}
+	if _, err := d.file.ReadAt(sealed, at); err != nil {
+		return fmt.Errorf("failed to read encrypted file: %w", err)
+	}
+	flag := segmentNotFinal
+	if index == d.segments-1 {
+		flag = segmentFinal
+	}
+	plain, err := d.aead.Open(sealed[:0], segmentNonce(d.prefix, uint32(index)), sealed, flag)
+	if err != nil {
+		return errors.New("failed to decrypt file: wrong key or corrupt data")
+	}
+	d.plain = plain
+	return nil
+}
+
+func (d *decryptingReader) Close() error {
+	return d.file.Close()
+}
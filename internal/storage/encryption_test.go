@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newEncryptedStorage(t *testing.T, key []byte) *LocalStorage {
+	t.Helper()
+	storage, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+	if err := storage.UseEncryption(key); err != nil {
+		t.Fatalf("UseEncryption failed: %v", err)
+	}
+	return storage
+}
+
+func TestLocalStorage_Encryption(t *testing.T) {
+	ctx := context.Background()
+	key := bytes.Repeat([]byte{7}, 32)
+
+	// Sizes around segment boundaries, including an empty file
+	for _, size := range []int{0, 1, encryptedSegmentSize, encryptedSegmentSize + 1, 3*encryptedSegmentSize - 5} {
+		storage := newEncryptedStorage(t, key)
+		data := make([]byte, size)
+		_, _ = rand.Read(data)
+
+		info, err := storage.StreamingPut(ctx, "pkg/file.whl", bytes.NewReader(data), int64(size), "")
+		if err != nil {
+			t.Fatalf("StreamingPut(%d bytes) failed: %v", size, err)
+		}
+		if info.Size != int64(size) {
+			t.Errorf("Expected Put to report %d bytes, got %d", size, info.Size)
+		}
+
+		// Nothing readable on disk
+		raw, _ := os.ReadFile(storage.buildPath("pkg/file.whl"))
+		if size > 16 && bytes.Contains(raw, data[:16]) {
+			t.Errorf("Expected %d bytes to be encrypted on disk", size)
+		}
+
+		if stat, err := storage.Stat(ctx, "pkg/file.whl"); err != nil || stat.Size != int64(size) {
+			t.Errorf("Expected Stat to report %d bytes, got %+v, %v", size, stat, err)
+		}
+
+		reader, _, err := storage.Get(ctx, "pkg/file.whl")
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		got, err := io.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Expected %d bytes back, got %d (%v)", size, len(got), err)
+		}
+
+		var buf bytes.Buffer
+		if _, err := storage.StreamingGet(ctx, "pkg/file.whl", &buf); err != nil || !bytes.Equal(buf.Bytes(), data) {
+			t.Errorf("Expected StreamingGet to return %d bytes, got %d (%v)", size, buf.Len(), err)
+		}
+	}
+}
+
+func TestLocalStorage_EncryptedRange(t *testing.T) {
+	ctx := context.Background()
+	storage := newEncryptedStorage(t, bytes.Repeat([]byte{7}, 32))
+	data := make([]byte, 3*encryptedSegmentSize)
+	_, _ = rand.Read(data)
+	if _, err := storage.Put(ctx, "file", bytes.NewReader(data), int64(len(data)), ""); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// A range spanning a segment boundary, and one running to the end
+	for _, r := range [][2]int64{{encryptedSegmentSize - 10, 20}, {2*encryptedSegmentSize + 5, 0}} {
+		reader, _, err := storage.GetRange(ctx, "file", r[0], r[1])
+		if err != nil {
+			t.Fatalf("GetRange failed: %v", err)
+		}
+		got, _ := io.ReadAll(reader)
+		_ = reader.Close()
+
+		end := int64(len(data))
+		if r[1] > 0 {
+			end = r[0] + r[1]
+		}
+		if !bytes.Equal(got, data[r[0]:end]) {
+			t.Errorf("Expected range %v to match, got %d bytes", r, len(got))
+		}
+	}
+}
+
+func TestLocalStorage_EncryptionRejectsTampering(t *testing.T) {
+	ctx := context.Background()
+	storage := newEncryptedStorage(t, bytes.Repeat([]byte{7}, 32))
+	data := bytes.Repeat([]byte("wheel"), 30000)
+	if _, err := storage.Put(ctx, "file", bytes.NewReader(data), int64(len(data)), ""); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	path := storage.buildPath("file")
+	raw, _ := os.ReadFile(path)
+
+	readAll := func() error {
+		reader, _, err := storage.Get(ctx, "file")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = reader.Close() }()
+		_, err = io.ReadAll(reader)
+		return err
+	}
+
+	// Cutting off the final segment must not pass as a shorter file
+	_ = os.WriteFile(path, raw[:encryptedHeaderSize+encryptedSealedSize], 0644)
+	if err := readAll(); err == nil {
+		t.Error("Expected a truncated file to fail to decrypt")
+	}
+
+	flipped := append([]byte(nil), raw...)
+	flipped[len(flipped)-1] ^= 1
+	_ = os.WriteFile(path, flipped, 0644)
+	if err := readAll(); err == nil {
+		t.Error("Expected a modified file to fail to decrypt")
+	}
+
+	// Another key can't read the file
+	_ = os.WriteFile(path, raw, 0644)
+	_ = storage.UseEncryption(bytes.Repeat([]byte{8}, 32))
+	if err := readAll(); err == nil {
+		t.Error("Expected the wrong key to fail to decrypt")
+	}
+}
+
+func TestLocalStorage_EncryptionDisablesZeroCopy(t *testing.T) {
+	storage := newEncryptedStorage(t, bytes.Repeat([]byte{7}, 32))
+	if storage.SupportsZeroCopy() {
+		t.Error("Expected encrypted storage not to support zero-copy")
+	}
+	if _, err := storage.GetFilePath(context.Background(), "file"); err == nil {
+		t.Error("Expected encrypted storage not to serve files by path")
+	}
+}
+
+func TestParseEncryptionKey(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	encoded := base64.StdEncoding.EncodeToString(key)
+
+	if got, err := ParseEncryptionKey(encoded + "\n"); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("ParseEncryptionKey = %x, %v; want %x", got, err, key)
+	}
+	if _, err := ParseEncryptionKey(base64.StdEncoding.EncodeToString(key[:16])); err == nil {
+		t.Error("Expected a 16-byte key to be rejected")
+	}
+	if _, err := ParseEncryptionKey("not base64!"); err == nil {
+		t.Error("Expected an undecodable key to be rejected")
+	}
+
+	path := filepath.Join(t.TempDir(), "key")
+	_ = os.WriteFile(path, []byte(encoded+"\n"), 0600)
+	if got, err := ReadEncryptionKey(path); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("ReadEncryptionKey = %x, %v; want %x", got, err, key)
+	}
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// CheckAtomicRename verifies that dir's filesystem supports what local
+// storage relies on to never expose partial files: renaming a temp file
+// over an existing one replaces it in a single step. Some network mounts
+// (older SMB servers, FUSE filesystems) refuse to rename over an existing
+// file or leave the source behind, which surfaces only as failed writes
+// under load; checking at startup turns that into a clear error.
+func CheckAtomicRename(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	target, err := os.CreateTemp(dir, ".tmp-rename-check-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	targetPath := target.Name()
+	defer func() { _ = os.Remove(targetPath) }()
+	_, err = target.WriteString("old")
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	source, err := os.CreateTemp(dir, ".tmp-rename-check-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	sourcePath := source.Name()
+	defer func() { _ = os.Remove(sourcePath) }()
+	_, err = source.WriteString("new")
+	if closeErr := source.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if err := renameFile(sourcePath, targetPath); err != nil {
+		return fmt.Errorf("filesystem can't rename over an existing file: %w", err)
+	}
+	if data, err := os.ReadFile(targetPath); err != nil || string(data) != "new" {
+		return errors.New("filesystem did not replace the file on rename")
+	}
+	if _, err := os.Stat(sourcePath); !os.IsNotExist(err) {
+		return errors.New("filesystem left the source behind on rename")
+	}
+	return nil
+}
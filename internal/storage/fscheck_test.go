@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCheckAtomicRename(t *testing.T) {
+	dir := t.TempDir()
+	if err := CheckAtomicRename(dir); err != nil {
+		t.Fatalf("Expected a local filesystem to pass, got %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected the check to clean up after itself, found %d files", len(entries))
+	}
+	if fs := NetworkFilesystem(dir); fs != "" {
+		t.Logf("Temp directory is on %s", fs)
+	}
+}
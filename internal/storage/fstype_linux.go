@@ -0,0 +1,25 @@
+package storage
+
+import "syscall"
+
+// Filesystem magic numbers from statfs(2) of network filesystems
+var networkFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x564c:     "ncp",
+	0x73757245: "coda",
+	0x6b414653: "afs",
+}
+
+// NetworkFilesystem returns the kind of network filesystem dir is on, or ""
+// if it is local or can't be told
+func NetworkFilesystem(dir string) string {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return ""
+	}
+	return networkFilesystems[uint32(st.Type)]
+}
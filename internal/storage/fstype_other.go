@@ -0,0 +1,8 @@
+//go:build !linux
+
+package storage
+
+// NetworkFilesystem can't tell filesystems apart on this platform
+func NetworkFilesystem(dir string) string {
+	return ""
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// keyLocks serializes writers of the same key so an object and its metadata
+// sidecar are always replaced together. Keys share a fixed set of mutexes,
+// which bounds memory at the cost of occasional unrelated contention.
+type keyLocks struct {
+	mu [64]sync.Mutex
+}
+
+// lock locks key's mutex and returns the function that unlocks it
+func (k *keyLocks) lock(key string) func() {
+	m := &k.mu[k.index(key)]
+	m.Lock()
+	return m.Unlock
+}
+
+// lockPair locks the mutexes of two keys, in a fixed order so concurrent
+// pairs can't deadlock, and returns the function that unlocks them
+func (k *keyLocks) lockPair(a, b string) func() {
+	i, j := k.index(a), k.index(b)
+	if i == j {
+		return k.lock(a)
+	}
+	if i > j {
+		i, j = j, i
+	}
+	k.mu[i].Lock()
+	k.mu[j].Lock()
+	return func() {
+		k.mu[j].Unlock()
+		k.mu[i].Unlock()
+	}
+}
+
+// index returns which mutex guards key
+func (k *keyLocks) index(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32() % uint32(len(k.mu))
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
+)
+
+// DefaultKeyTemplate is the storage key layout used when none is configured
+const DefaultKeyTemplate = "packages/{package}/{file}"
+
+// PackagesPrefix is the prefix every key layout stores package files under,
+// so scans of cached files never touch bookkeeping objects
+const PackagesPrefix = "packages/"
+
+// Placeholders a key template may use. Each path segment of a template is
+// either literal text or exactly one placeholder.
+const (
+	placeholderPackage = "{package}" // Normalized package name
+	placeholderFile    = "{file}"    // File name
+	placeholderP1      = "{p1}"      // First character of the package name
+	placeholderP2      = "{p2}"      // First two characters of the package name
+	placeholderHash2   = "{hash2}"   // First two hex digits of sha256(package name)
+)
+
+// KeyLayout maps package files to storage keys. Layouts that shard by a
+// prefix of the name or its hash spread a large cache over many S3 key
+// prefixes, avoiding hot partitions.
+type KeyLayout struct {
+	template string
+	segments []string
+}
+
+// NewKeyLayout parses a key template such as
+// "packages/{hash2}/{package}/{file}". Templates must start with
+// "packages/", contain {package} once and end with {file}: per-package
+// operations (trash, bundles, cache detail) rely on all of a package's files
+// sharing one key prefix, which also rules out content-addressed layouts.
+func NewKeyLayout(template string) (*KeyLayout, error) {
+	if template == "" {
+		template = DefaultKeyTemplate
+	}
+	if !strings.HasPrefix(template, PackagesPrefix) {
+		return nil, fmt.Errorf("key template %q must start with %q", template, PackagesPrefix)
+	}
+
+	segments := strings.Split(template, "/")
+	if segments[len(segments)-1] != placeholderFile {
+		return nil, fmt.Errorf("key template %q must end with %s", template, placeholderFile)
+	}
+
+	packages := 0
+	for i, segment := range segments {
+		switch segment {
+		case placeholderPackage:
+			packages++
+		case placeholderFile:
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("key template %q may only use %s as the last segment", template, placeholderFile)
+			}
+		case placeholderP1, placeholderP2, placeholderHash2:
+		default:
+			if segment == "" || strings.ContainsAny(segment, "{}") {
+				return nil, fmt.Errorf("key template %q has invalid segment %q", template, segment)
+			}
+		}
+	}
+	if packages != 1 {
+		return nil, fmt.Errorf("key template %q must contain %s exactly once", template, placeholderPackage)
+	}
+
+	return &KeyLayout{template: template, segments: segments}, nil
+}
+
+// Template returns the layout's key template
+func (l *KeyLayout) Template() string {
+	return l.template
+}
+
+// Key returns the storage key for a package file. The package name is
+// normalized, so every spelling of it maps to the same key.
+func (l *KeyLayout) Key(pkg, file string) string {
+	return l.render(cachekey.Package(pkg), file, len(l.segments))
+}
+
+// PackagePrefix returns the key prefix shared by all of a package's files
+func (l *KeyLayout) PackagePrefix(pkg string) string {
+	return l.render(cachekey.Package(pkg), "", len(l.segments)-1) + "/"
+}
+
+// Parse extracts the package and file name from a key in this layout
+func (l *KeyLayout) Parse(key string) (pkg, file string, ok bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != len(l.segments) {
+		return "", "", false
+	}
+
+	for i, segment := range l.segments {
+		switch segment {
+		case placeholderPackage:
+			pkg = parts[i]
+		case placeholderFile:
+			file = parts[i]
+		}
+	}
+	if pkg == "" || file == "" {
+		return "", "", false
+	}
+
+	// Literal and shard segments must match what the layout would produce.
+	// Keys stored before names were fully normalized still parse.
+	if l.render(pkg, file, len(l.segments)) != key {
+		return "", "", false
+	}
+	return pkg, file, true
+}
+
+func (l *KeyLayout) render(pkg, file string, n int) string {
+	parts := make([]string, n)
+	for i, segment := range l.segments[:n] {
+		switch segment {
+		case placeholderPackage:
+			parts[i] = pkg
+		case placeholderFile:
+			parts[i] = file
+		case placeholderP1:
+			parts[i] = namePrefix(pkg, 1)
+		case placeholderP2:
+			parts[i] = namePrefix(pkg, 2)
+		case placeholderHash2:
+			sum := sha256.Sum256([]byte(pkg))
+			parts[i] = hex.EncodeToString(sum[:1])
+		default:
+			parts[i] = segment
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// namePrefix returns the first n bytes of a package name, padded with "_"
+// so one-letter names still form a full shard
+func namePrefix(pkg string, n int) string {
+	if len(pkg) >= n {
+		return pkg[:n]
+	}
+	return pkg + strings.Repeat("_", n-len(pkg))
+}
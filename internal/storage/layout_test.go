@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewKeyLayout_Validation(t *testing.T) {
+	tests := map[string]bool{
+		"":                                    true, // Default layout
+		"packages/{package}/{file}":           true,
+		"packages/{p1}/{p2}/{package}/{file}": true,
+		"packages/{hash2}/{package}/{file}":   true,
+		"cache/{package}/{file}":              false,
+		"packages/{package}":                  false,
+		"packages/{file}/{package}/{file}":    false,
+		"packages/{hash2}/{file}":             false,
+		"packages/{package}/{package}/{file}": false,
+		"packages/x{p1}/{package}/{file}":     false,
+		"packages//{package}/{file}":          false,
+	}
+
+	for template, valid := range tests {
+		if _, err := NewKeyLayout(template); (err == nil) != valid {
+			t.Errorf("NewKeyLayout(%q) error = %v, want valid = %v", template, err, valid)
+		}
+	}
+}
+
+func TestKeyLayout_KeyAndParse(t *testing.T) {
+	tests := []struct {
+		template string
+		key      string
+		prefix   string
+	}{
+		{"packages/{package}/{file}", "packages/numpy/numpy-1.0.tar.gz", "packages/numpy/"},
+		{"packages/{p1}/{p2}/{package}/{file}", "packages/n/nu/numpy/numpy-1.0.tar.gz", "packages/n/nu/numpy/"},
+		{"packages/{hash2}/{package}/{file}", "packages/73/numpy/numpy-1.0.tar.gz", "packages/73/numpy/"},
+	}
+
+	for _, tt := range tests {
+		layout, err := NewKeyLayout(tt.template)
+		if err != nil {
+			t.Fatalf("NewKeyLayout(%q) failed: %v", tt.template, err)
+		}
+
+		key := layout.Key("numpy", "numpy-1.0.tar.gz")
+		if key != tt.key {
+			t.Errorf("%s: Key = %q, want %q", tt.template, key, tt.key)
+		}
+		if prefix := layout.PackagePrefix("numpy"); prefix != tt.prefix {
+			t.Errorf("%s: PackagePrefix = %q, want %q", tt.template, prefix, tt.prefix)
+		}
+
+		pkg, file, ok := layout.Parse(key)
+		if !ok || pkg != "numpy" || file != "numpy-1.0.tar.gz" {
+			t.Errorf("%s: Parse(%q) = %q, %q, %v", tt.template, key, pkg, file, ok)
+		}
+	}
+}
+
+func TestKeyLayout_NormalizesPackage(t *testing.T) {
+	sharded, _ := NewKeyLayout("packages/{hash2}/{package}/{file}")
+	want := sharded.Key("zope-interface", "zope.interface-6.0.tar.gz")
+	for _, name := range []string{"zope.interface", "Zope_Interface", "ZOPE-INTERFACE"} {
+		if key := sharded.Key(name, "zope.interface-6.0.tar.gz"); key != want {
+			t.Errorf("Key(%q) = %q, want %q", name, key, want)
+		}
+		if prefix := sharded.PackagePrefix(name); !strings.HasPrefix(want, prefix) {
+			t.Errorf("PackagePrefix(%q) = %q, want a prefix of %q", name, prefix, want)
+		}
+	}
+
+	// File names are kept as they are
+	if key := sharded.Key("torch", "torch-2.0.0+CPU.whl"); !strings.HasSuffix(key, "/torch/torch-2.0.0+CPU.whl") {
+		t.Errorf("Expected the file name kept, got %q", key)
+	}
+
+	// Keys stored under a name normalized the old way still parse
+	legacy, _ := NewKeyLayout("")
+	if pkg, file, ok := legacy.Parse("packages/zope.interface/zope.interface-6.0.tar.gz"); !ok || pkg != "zope.interface" || file != "zope.interface-6.0.tar.gz" {
+		t.Errorf("Expected a legacy key to parse, got %q, %q, %v", pkg, file, ok)
+	}
+}
+
+func TestKeyLayout_ParseRejectsOtherLayouts(t *testing.T) {
+	sharded, _ := NewKeyLayout("packages/{p1}/{package}/{file}")
+
+	for _, key := range []string{
+		"packages/numpy/numpy-1.0.tar.gz",   // Default layout
+		"packages/x/numpy/numpy-1.0.tar.gz", // Wrong shard
+		"mirror/state.json",
+	} {
+		if _, _, ok := sharded.Parse(key); ok {
+			t.Errorf("Parse(%q) should fail for the sharded layout", key)
+		}
+	}
+
+	if key := sharded.Key("a", "a-1.0.tar.gz"); key != "packages/a/a/a-1.0.tar.gz" {
+		t.Errorf("Unexpected key for a one-letter name: %q", key)
+	}
+	p2, _ := NewKeyLayout("packages/{p2}/{package}/{file}")
+	if key := p2.Key("a", "a-1.0.tar.gz"); key != "packages/a_/a/a-1.0.tar.gz" {
+		t.Errorf("Expected padded shard for a one-letter name, got %q", key)
+	}
+}
+
+func TestMigrateKeys(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	files := map[string]string{
+		"packages/numpy/numpy-1.0.tar.gz":  "numpy",
+		"packages/six/six-1.0.tar.gz":      "six",
+		"packages/r/requests/r-1.0.tar.gz": "already migrated",
+	}
+	for key, data := range files {
+		if _, err := store.Put(ctx, key, strings.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+			t.Fatalf("Put %s failed: %v", key, err)
+		}
+	}
+
+	from, _ := NewKeyLayout(DefaultKeyTemplate)
+	to, _ := NewKeyLayout("packages/{p1}/{package}/{file}")
+
+	report, err := MigrateKeys(ctx, store, from, to, true)
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if report.Moved != 2 {
+		t.Errorf("Expected dry run to report 2 moves, got %+v", report)
+	}
+	if exists, _ := store.Exists(ctx, "packages/numpy/numpy-1.0.tar.gz"); !exists {
+		t.Error("Dry run must not move files")
+	}
+
+	report, err = MigrateKeys(ctx, store, from, to, false)
+	if err != nil {
+		t.Fatalf("MigrateKeys failed: %v", err)
+	}
+	if report.Moved != 2 || report.Skipped != 1 || report.Failed != 0 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	for _, key := range []string{"packages/n/numpy/numpy-1.0.tar.gz", "packages/s/six/six-1.0.tar.gz", "packages/r/requests/r-1.0.tar.gz"} {
+		if exists, _ := store.Exists(ctx, key); !exists {
+			t.Errorf("Expected %s after migration", key)
+		}
+	}
+	if exists, _ := store.Exists(ctx, "packages/numpy/numpy-1.0.tar.gz"); exists {
+		t.Error("Original key should be removed after migration")
+	}
+
+	// Running again finds nothing left to move
+	if report, err := MigrateKeys(ctx, store, from, to, false); err != nil || report.Moved != 0 {
+		t.Errorf("Expected idempotent rerun, got %+v, %v", report, err)
+	}
+}
+
+func TestMigrateKeys_Renormalize(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	// Older releases kept dots in package names
+	for _, key := range []string{"packages/zope.interface/zope.interface-6.0.tar.gz", "packages/six/six-1.0.tar.gz"} {
+		if _, err := store.Put(ctx, key, strings.NewReader(key), int64(len(key)), ""); err != nil {
+			t.Fatalf("Put %s failed: %v", key, err)
+		}
+	}
+
+	layout, _ := NewKeyLayout(DefaultKeyTemplate)
+	report, err := MigrateKeys(ctx, store, layout, layout, false)
+	if err != nil || report.Moved != 1 || report.Skipped != 1 {
+		t.Fatalf("Expected only the dotted name moved, got %+v, %v", report, err)
+	}
+	if exists, _ := store.Exists(ctx, layout.Key("zope.interface", "zope.interface-6.0.tar.gz")); !exists {
+		t.Error("Expected the file under the normalized package name")
+	}
+	if exists, _ := store.Exists(ctx, "packages/zope.interface/zope.interface-6.0.tar.gz"); exists {
+		t.Error("Expected the dotted key removed")
+	}
+}
+
+func TestMigrateKeyAndPackage(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	// "nu" in the flat layout shares its prefix with numpy's shard in the
+	// new one
+	for _, key := range []string{"packages/numpy/numpy-1.0.tar.gz", "packages/numpy/numpy-2.0.tar.gz", "packages/nu/nu-1.0.tar.gz", "packages/nu/numpy/numpy-3.0.tar.gz"} {
+		if _, err := store.Put(ctx, key, strings.NewReader(key), int64(len(key)), ""); err != nil {
+			t.Fatalf("Put %s failed: %v", key, err)
+		}
+	}
+	from, _ := NewKeyLayout(DefaultKeyTemplate)
+	to, _ := NewKeyLayout("packages/{p2}/{package}/{file}")
+
+	moved, err := MigrateKey(ctx, store, from, to, "numpy", "numpy-1.0.tar.gz")
+	if err != nil || !moved {
+		t.Fatalf("Expected numpy-1.0 to be moved, got %v, %v", moved, err)
+	}
+	if exists, _ := store.Exists(ctx, "packages/nu/numpy/numpy-1.0.tar.gz"); !exists {
+		t.Error("Expected numpy-1.0 under the new layout")
+	}
+	if moved, err := MigrateKey(ctx, store, from, to, "numpy", "numpy-9.0.tar.gz"); err != nil || moved {
+		t.Errorf("Expected nothing to move for an uncached file, got %v, %v", moved, err)
+	}
+
+	objects, err := PackageObjects(ctx, store, from, "nu")
+	if err != nil || len(objects) != 1 || objects[0].Key != "packages/nu/nu-1.0.tar.gz" {
+		t.Errorf("Expected only nu's own file, got %v, %v", objects, err)
+	}
+
+	if moved, err := MigratePackage(ctx, store, from, to, "numpy"); err != nil || moved != 1 {
+		t.Errorf("Expected the remaining numpy file to be moved, got %d, %v", moved, err)
+	}
+	if exists, _ := store.Exists(ctx, "packages/nu/numpy/numpy-2.0.tar.gz"); !exists {
+		t.Error("Expected numpy-2.0 under the new layout")
+	}
+}
+
+func TestMigratePrefix(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	from, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+	// The new prefix lies within the old one
+	to, err := NewLocalStorage(filepath.Join(dir, "prod", "eu"))
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	for _, key := range []string{"packages/numpy/numpy-1.0.tar.gz", "packages/six/six-1.0.tar.gz"} {
+		if _, err := from.Put(ctx, key, strings.NewReader(key), int64(len(key)), ""); err != nil {
+			t.Fatalf("Put %s failed: %v", key, err)
+		}
+	}
+	if _, err := to.Put(ctx, "packages/six/six-1.0.tar.gz", strings.NewReader("copied"), 6, ""); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	report, err := MigratePrefix(ctx, from, to, "prod/", true)
+	if err != nil || report.Moved != 2 || report.Skipped != 1 {
+		t.Fatalf("Unexpected dry run report %+v, %v", report, err)
+	}
+	if exists, _ := to.Exists(ctx, "packages/numpy/numpy-1.0.tar.gz"); exists {
+		t.Error("Dry run must not move files")
+	}
+
+	report, err = MigratePrefix(ctx, from, to, "prod/", false)
+	if err != nil || report.Moved != 2 || report.Failed != 0 {
+		t.Fatalf("Unexpected report %+v, %v", report, err)
+	}
+	for _, key := range []string{"packages/numpy/numpy-1.0.tar.gz", "packages/six/six-1.0.tar.gz"} {
+		if exists, _ := to.Exists(ctx, key); !exists {
+			t.Errorf("Expected %s under the new prefix", key)
+		}
+	}
+	if exists, _ := from.Exists(ctx, "packages/numpy/numpy-1.0.tar.gz"); exists {
+		t.Error("Original object should be removed after migration")
+	}
+
+	// Running again finds only the new prefix's objects, which it leaves alone
+	if report, err := MigratePrefix(ctx, from, to, "prod/", false); err != nil || report.Moved != 0 || report.Skipped != 2 {
+		t.Errorf("Expected idempotent rerun, got %+v, %v", report, err)
+	}
+}
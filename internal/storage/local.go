@@ -2,12 +2,14 @@ package storage
 
 import (
 	"context"
+	"crypto/cipher"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
-	"syscall"
 	"time"
 )
 
@@ -15,10 +17,44 @@ import (
 type LocalStorage struct {
 	baseDir     string
 	copyBufPool *sync.Pool
+	locks       keyLocks // Serializes replacing and deleting the same key
+	policy      WritePolicy
+	aead        cipher.AEAD // Encrypts files at rest (nil = plaintext)
+}
+
+// WritePolicy decides which of two overlapping writes of the same key is kept
+type WritePolicy string
+
+const (
+	// LastWriterWins keeps whichever write finishes last (the default)
+	LastWriterWins WritePolicy = "last-writer-wins"
+	// FirstWriterWins keeps whichever write finishes first and discards a
+	// write that overlapped it. Package files never change, so the second
+	// copy is redundant and leaving the first in place spares readers a
+	// replaced file.
+	FirstWriterWins WritePolicy = "first-writer-wins"
+)
+
+// ParseWritePolicy parses a write policy name, defaulting to LastWriterWins
+func ParseWritePolicy(name string) (WritePolicy, error) {
+	switch WritePolicy(name) {
+	case "", LastWriterWins:
+		return LastWriterWins, nil
+	case FirstWriterWins:
+		return FirstWriterWins, nil
+	}
+	return "", fmt.Errorf("unknown write policy %q (want %s or %s)", name, LastWriterWins, FirstWriterWins)
 }
 
 // NewLocalStorage creates a new local filesystem storage backend
 func NewLocalStorage(baseDir string) (*LocalStorage, error) {
+	// An absolute base lets Windows address paths beyond MAX_PATH, which the
+	// os package only does for absolute paths
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve base directory: %w", err)
+	}
+
 	// Ensure base directory exists
 	if err := os.MkdirAll(baseDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create base directory: %w", err)
@@ -35,6 +71,59 @@ func NewLocalStorage(baseDir string) (*LocalStorage, error) {
 	}, nil
 }
 
+// UseWritePolicy sets how overlapping writes of the same key are resolved.
+// Call it before the storage is shared.
+func (l *LocalStorage) UseWritePolicy(policy WritePolicy) {
+	l.policy = policy
+}
+
+// UseEncryption encrypts files written from now on with key, a 32-byte
+// AES-256 key, and decrypts files on read. Encrypted files can't be served
+// by path, so zero-copy serving is turned off. Call it before the storage
+// is shared.
+func (l *LocalStorage) UseEncryption(key []byte) error {
+	aead, err := newFileCipher(key)
+	if err != nil {
+		return err
+	}
+	l.aead = aead
+	return nil
+}
+
+// objectSize returns the size of the object stored in a file of fileSize
+// bytes
+func (l *LocalStorage) objectSize(fileSize int64) int64 {
+	if l.aead != nil {
+		return plaintextSize(fileSize)
+	}
+	return fileSize
+}
+
+// writeFile copies reader into a new temp file, encrypting it if enabled,
+// and returns the number of bytes read. buf may be nil.
+func (l *LocalStorage) writeFile(file *os.File, reader io.Reader, buf []byte) (int64, error) {
+	if l.aead == nil {
+		if buf == nil {
+			return io.Copy(file, reader)
+		}
+		return io.CopyBuffer(file, reader, buf)
+	}
+
+	enc, err := newEncryptingWriter(file, l.aead)
+	if err != nil {
+		return 0, err
+	}
+	if buf == nil {
+		_, err = io.Copy(enc, reader)
+	} else {
+		_, err = io.CopyBuffer(enc, reader, buf)
+	}
+	if err != nil {
+		return enc.n, err
+	}
+	return enc.n, enc.Close()
+}
+
 // buildPath constructs the full filesystem path
 func (l *LocalStorage) buildPath(key string) string {
 	return filepath.Join(l.baseDir, key)
@@ -60,10 +149,19 @@ func (l *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, *Obj
 
 	info := &ObjectInfo{
 		Key:          key,
-		Size:         stat.Size(),
+		Size:         l.objectSize(stat.Size()),
 		LastModified: stat.ModTime(),
+		Metadata:     readSidecar(l.baseDir, key),
 	}
 
+	if l.aead != nil {
+		reader, err := newDecryptingReader(file, stat.Size(), l.aead, 0, 0)
+		if err != nil {
+			_ = file.Close()
+			return nil, nil, fmt.Errorf("failed to open %s: %w", key, err)
+		}
+		return reader, info, nil
+	}
 	return file, info, nil
 }
 
@@ -85,6 +183,22 @@ func (l *LocalStorage) GetRange(ctx context.Context, key string, offset, length
 		return nil, nil, fmt.Errorf("failed to stat file: %w", err)
 	}
 
+	info := &ObjectInfo{
+		Key:          key,
+		Size:         l.objectSize(stat.Size()),
+		LastModified: stat.ModTime(),
+		Metadata:     readSidecar(l.baseDir, key),
+	}
+
+	if l.aead != nil {
+		reader, err := newDecryptingReader(file, stat.Size(), l.aead, offset, length)
+		if err != nil {
+			_ = file.Close()
+			return nil, nil, fmt.Errorf("failed to open %s: %w", key, err)
+		}
+		return reader, info, nil
+	}
+
 	// Seek to offset if specified
 	if offset > 0 {
 		_, err = file.Seek(offset, io.SeekStart)
@@ -103,17 +217,12 @@ func (l *LocalStorage) GetRange(ctx context.Context, key string, offset, length
 		}
 	}
 
-	info := &ObjectInfo{
-		Key:          key,
-		Size:         stat.Size(),
-		LastModified: stat.ModTime(),
-	}
-
 	return reader, info, nil
 }
 
 // Put stores an object in local filesystem
 func (l *LocalStorage) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (*ObjectInfo, error) {
+	started := time.Now()
 	path := l.buildPath(key)
 
 	// Ensure directory exists
@@ -138,28 +247,66 @@ func (l *LocalStorage) Put(ctx context.Context, key string, reader io.Reader, si
 	}()
 
 	// Copy data
-	written, err := io.Copy(tmpFile, reader)
+	written, err := l.writeFile(tmpFile, reader, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to write file: %w", err)
 	}
 
-	// Close temp file
+	// Flush to disk so a crash after the rename can't leave a truncated file
+	// under the final name
+	if err := tmpFile.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync temp file: %w", err)
+	}
 	if err := tmpFile.Close(); err != nil {
 		return nil, fmt.Errorf("failed to close temp file: %w", err)
 	}
 	tmpFile = nil // Prevent defer cleanup
 
+	return l.commit(ctx, key, tmpPath, path, started, &ObjectInfo{
+		Key:         key,
+		Size:        written,
+		ContentType: contentType,
+	})
+}
+
+// commit moves a finished temp file into place under key along with the
+// metadata from ctx, and returns info completed with that metadata. Writers
+// of the same key are serialized so the object and its sidecar always come
+// from the same write. Under FirstWriterWins, a write started before the
+// current object was committed is discarded in favour of that object.
+func (l *LocalStorage) commit(ctx context.Context, key, tmpPath, path string, started time.Time, info *ObjectInfo) (*ObjectInfo, error) {
+	unlock := l.locks.lock(key)
+	defer unlock()
+
+	if l.policy == FirstWriterWins {
+		if stat, err := os.Stat(path); err == nil && !stat.ModTime().Before(started) {
+			_ = os.Remove(tmpPath)
+			info.Size = l.objectSize(stat.Size())
+			info.Metadata = readSidecar(l.baseDir, key)
+			return info, nil
+		}
+	}
+
+	// Write metadata first so the object never appears without it
+	metadata := metadataFromContext(ctx)
+	if err := writeSidecar(l.baseDir, key, metadata); err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, err
+	}
+
 	// Move to final location
-	if err := os.Rename(tmpPath, path); err != nil {
+	if err := renameFile(tmpPath, path); err != nil {
 		_ = os.Remove(tmpPath)
 		return nil, fmt.Errorf("failed to move file: %w", err)
 	}
-
-	return &ObjectInfo{
-		Key:         key,
-		Size:        written,
-		ContentType: contentType,
-	}, nil
+	if l.policy == FirstWriterWins {
+		// The temp file's mtime is when its data was written, which may
+		// predate writers that started since; stamp the commit time instead
+		now := time.Now()
+		_ = os.Chtimes(path, now, now)
+	}
+	info.Metadata = metadata
+	return info, nil
 }
 
 // PutMultipart is the same as Put for local storage
@@ -171,11 +318,47 @@ func (l *LocalStorage) PutMultipart(ctx context.Context, key string, reader io.R
 func (l *LocalStorage) Delete(ctx context.Context, key string) error {
 	path := l.buildPath(key)
 
+	unlock := l.locks.lock(key)
+	defer unlock()
+
 	err := os.Remove(path)
 	if err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
+	removeSidecar(l.baseDir, key)
+
+	return nil
+}
+
+// Rename moves src and its metadata to dst with a file rename. The moved
+// file is stamped with the time of the move, as a copy would be.
+func (l *LocalStorage) Rename(ctx context.Context, src, dst string) error {
+	srcPath, dstPath := l.buildPath(src), l.buildPath(dst)
+
+	unlock := l.locks.lockPair(src, dst)
+	defer unlock()
+
+	if _, err := os.Stat(srcPath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("object not found: %s", src)
+		}
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
 
+	// Metadata first, as in commit, so dst never appears without it
+	if err := writeSidecar(l.baseDir, dst, readSidecar(l.baseDir, src)); err != nil {
+		return err
+	}
+	if err := renameFile(srcPath, dstPath); err != nil {
+		return fmt.Errorf("failed to move file: %w", err)
+	}
+	removeSidecar(l.baseDir, src)
+
+	now := time.Now()
+	_ = os.Chtimes(dstPath, now, now)
 	return nil
 }
 
@@ -208,8 +391,9 @@ func (l *LocalStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error
 
 	return &ObjectInfo{
 		Key:          key,
-		Size:         stat.Size(),
+		Size:         l.objectSize(stat.Size()),
 		LastModified: stat.ModTime(),
+		Metadata:     readSidecar(l.baseDir, key),
 	}, nil
 }
 
@@ -243,6 +427,7 @@ func (l *LocalStorage) List(ctx context.Context, opts ListOptions) ([]*ObjectInf
 		if err != nil {
 			continue
 		}
+		key = filepath.ToSlash(key)
 
 		// Skip if before StartAfter
 		if opts.StartAfter != "" && key <= opts.StartAfter {
@@ -251,7 +436,7 @@ func (l *LocalStorage) List(ctx context.Context, opts ListOptions) ([]*ObjectInf
 
 		objects = append(objects, &ObjectInfo{
 			Key:          key,
-			Size:         stat.Size(),
+			Size:         l.objectSize(stat.Size()),
 			LastModified: stat.ModTime(),
 		})
 		count++
@@ -260,6 +445,94 @@ func (l *LocalStorage) List(ctx context.Context, opts ListOptions) ([]*ObjectInf
 	return objects, nil
 }
 
+// Walk calls fn for every stored file under prefix, skipping in-flight temp files
+func (l *LocalStorage) Walk(ctx context.Context, prefix string, fn func(*ObjectInfo) error) error {
+	root := l.buildPath(prefix)
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() && isInternalDir(l.baseDir, path) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || isTempFile(d.Name()) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed while walking
+		}
+
+		key, err := filepath.Rel(l.baseDir, path)
+		if err != nil {
+			return err
+		}
+
+		return fn(&ObjectInfo{
+			Key:          filepath.ToSlash(key),
+			Size:         l.objectSize(info.Size()),
+			LastModified: info.ModTime(),
+		})
+	})
+}
+
+// CleanupTemp removes temp files left behind by interrupted writes
+func (l *LocalStorage) CleanupTemp(ctx context.Context, olderThan time.Duration, dryRun bool) (int, int64, error) {
+	return l.cleanupTemp(ctx, olderThan, dryRun, nil)
+}
+
+func (l *LocalStorage) cleanupTemp(ctx context.Context, olderThan time.Duration, dryRun bool, onRemove func(key string)) (int, int64, error) {
+	cutoff := time.Now().Add(-olderThan)
+	count := 0
+	var size int64
+
+	err := filepath.WalkDir(l.baseDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() || !isTempFile(d.Name()) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			return nil // Gone, or possibly still being written
+		}
+
+		if !dryRun {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove temp file: %w", err)
+			}
+			if onRemove != nil {
+				if key, err := filepath.Rel(l.baseDir, path); err == nil {
+					onRemove(filepath.ToSlash(key))
+				}
+			}
+		}
+		count++
+		size += info.Size()
+		return nil
+	})
+
+	return count, size, err
+}
+
+// isTempFile reports whether name is a temp file created by Put/StreamingPut
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".tmp-")
+}
+
 // GetPresignedURL is not supported for local storage
 func (l *LocalStorage) GetPresignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
 	// For local storage, return a file:// URL
@@ -279,6 +552,7 @@ func (l *LocalStorage) Close() error {
 // StreamingPut stores an object with streaming support and concurrent reads
 func (l *LocalStorage) StreamingPut(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (*ObjectInfo, error) {
 	// For local storage, streaming put is same as regular put but with optimized copy
+	started := time.Now()
 	path := l.buildPath(key)
 
 	// Ensure directory exists
@@ -308,28 +582,26 @@ func (l *LocalStorage) StreamingPut(ctx context.Context, key string, reader io.R
 	copyBuf := *copyBufPtr
 
 	// Copy data with pooled buffer
-	written, err := io.CopyBuffer(tmpFile, reader, copyBuf)
+	written, err := l.writeFile(tmpFile, reader, copyBuf)
 	if err != nil {
 		return nil, fmt.Errorf("failed to write file: %w", err)
 	}
 
-	// Close temp file
+	// Flush to disk so a crash after the rename can't leave a truncated file
+	// under the final name
+	if err := tmpFile.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync temp file: %w", err)
+	}
 	if err := tmpFile.Close(); err != nil {
 		return nil, fmt.Errorf("failed to close temp file: %w", err)
 	}
 	tmpFile = nil // Prevent defer cleanup
 
-	// Move to final location
-	if err := os.Rename(tmpPath, path); err != nil {
-		_ = os.Remove(tmpPath)
-		return nil, fmt.Errorf("failed to move file: %w", err)
-	}
-
-	return &ObjectInfo{
+	return l.commit(ctx, key, tmpPath, path, started, &ObjectInfo{
 		Key:         key,
 		Size:        written,
 		ContentType: contentType,
-	}, nil
+	})
 }
 
 // StreamingGet retrieves an object with zero-copy optimizations
@@ -347,8 +619,13 @@ func (l *LocalStorage) StreamingGet(ctx context.Context, key string, writer io.W
 
 	info := &ObjectInfo{
 		Key:          key,
-		Size:         stat.Size(),
+		Size:         l.objectSize(stat.Size()),
 		LastModified: stat.ModTime(),
+		Metadata:     readSidecar(l.baseDir, key),
+	}
+
+	if l.aead != nil {
+		return l.streamDecrypted(ctx, key, writer)
 	}
 
 	// Try sendfile optimization if writer supports it
@@ -376,8 +653,28 @@ func (l *LocalStorage) StreamingGet(ctx context.Context, key string, writer io.W
 	return info, nil
 }
 
-// GetFilePath returns the local file path for zero-copy operations
+// streamDecrypted copies the plaintext of an encrypted object to writer
+func (l *LocalStorage) streamDecrypted(ctx context.Context, key string, writer io.Writer) (*ObjectInfo, error) {
+	reader, info, err := l.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = reader.Close() }()
+
+	copyBufPtr := l.copyBufPool.Get().(*[]byte)
+	defer l.copyBufPool.Put(copyBufPtr)
+	if _, err := io.CopyBuffer(writer, reader, *copyBufPtr); err != nil {
+		return nil, fmt.Errorf("failed to copy file: %w", err)
+	}
+	return info, nil
+}
+
+// GetFilePath returns the local file path for zero-copy operations, unless
+// files are encrypted
 func (l *LocalStorage) GetFilePath(ctx context.Context, key string) (string, error) {
+	if l.aead != nil {
+		return "", errors.New("encrypted local storage doesn't serve files by path")
+	}
 	path := l.buildPath(key)
 
 	// Check if file exists
@@ -393,7 +690,9 @@ func (l *LocalStorage) GetFilePath(ctx context.Context, key string) (string, err
 
 // SupportsZeroCopy indicates if the backend supports zero-copy operations
 func (l *LocalStorage) SupportsZeroCopy() bool {
-	return true // Local storage supports sendfile and direct file serving
+	// Local storage supports sendfile and direct file serving, but not of
+	// encrypted files
+	return l.aead == nil
 }
 
 // trySendfile attempts to use sendfile for zero-copy transfer
@@ -433,31 +732,6 @@ func (l *LocalStorage) trySendfile(writer io.Writer, filepath string, size int64
 	return fmt.Errorf("writer doesn't support sendfile")
 }
 
-// sendfile performs the actual sendfile syscall
-func (l *LocalStorage) sendfile(dst, src int, size int64) error {
-	var offset int64 = 0
-	remaining := size
-
-	for remaining > 0 {
-		n, err := syscall.Sendfile(dst, src, &offset, int(remaining))
-		if err != nil {
-			if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK {
-				continue // Retry on would-block
-			}
-			return fmt.Errorf("sendfile failed: %w", err)
-		}
-
-		if n == 0 {
-			break // EOF
-		}
-
-		remaining -= int64(n)
-		offset += int64(n)
-	}
-
-	return nil
-}
-
 // limitedReadCloser wraps a limited reader with a closer
 type limitedReadCloser struct {
 	io.Reader
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 	"testing"
@@ -47,6 +48,10 @@ func TestNewLocalStorage(t *testing.T) {
 	})
 
 	t.Run("fails_with_permission_error", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("No unwritable absolute path to use on Windows")
+		}
+
 		// Try to create in a location that should fail (root directory with invalid permissions)
 		invalidDir := "/root/invalid-test-dir"
 
@@ -259,6 +264,37 @@ func TestLocalStorage_Delete(t *testing.T) {
 	})
 }
 
+func TestLocalStorage_Rename(t *testing.T) {
+	storage, _ := NewLocalStorage(t.TempDir())
+	ctx := context.Background()
+
+	putCtx := WithMetadata(ctx, map[string]string{MetaSHA256: "abc123"})
+	if _, err := storage.Put(putCtx, "packages/six/six.whl", strings.NewReader("six"), 3, "application/octet-stream"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	if err := storage.Rename(ctx, "packages/six/six.whl", "trash/six/six.whl"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if exists, _ := storage.Exists(ctx, "packages/six/six.whl"); exists {
+		t.Error("Expected the source gone")
+	}
+	info, err := storage.Stat(ctx, "trash/six/six.whl")
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Size != 3 || info.Metadata[MetaSHA256] != "abc123" {
+		t.Errorf("Expected the object and its metadata moved, got %+v", info)
+	}
+	if readSidecar(storage.baseDir, "packages/six/six.whl") != nil {
+		t.Error("Expected the source's metadata removed")
+	}
+
+	if err := storage.Rename(ctx, "packages/six/six.whl", "trash/six/six.whl"); err == nil {
+		t.Error("Expected renaming a missing object to fail")
+	}
+}
+
 func TestLocalStorage_Exists(t *testing.T) {
 	storage, _ := NewLocalStorage(t.TempDir())
 	ctx := context.Background()
@@ -501,6 +537,162 @@ func TestLocalStorage_ConcurrentAccess(t *testing.T) {
 	}
 }
 
+func TestLocalStorage_ConcurrentWritesSameKey(t *testing.T) {
+	storage, _ := NewLocalStorage(t.TempDir())
+	ctx := context.Background()
+	key := "packages/numpy/numpy-1.26.4.tar.gz"
+
+	// Every writer stores different content with matching metadata; whichever
+	// wins, the object and its sidecar must come from the same write
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			content := fmt.Sprintf("content-%d-%s", id, strings.Repeat("x", id*1024))
+			putCtx := WithMetadata(ctx, map[string]string{MetaUpstreamURL: fmt.Sprintf("content-%d", id)})
+			if _, err := storage.Put(putCtx, key, strings.NewReader(content), int64(len(content)), ""); err != nil {
+				t.Errorf("Put %d failed: %v", id, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	reader, info, err := storage.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	_ = reader.Close()
+	if want := info.Metadata[MetaUpstreamURL]; !strings.HasPrefix(string(data), want+"-") {
+		t.Errorf("Object %q... does not match its metadata %q", data[:12], want)
+	}
+
+	// No temp files are left behind
+	entries, _ := os.ReadDir(filepath.Dir(storage.buildPath(key)))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the object in its directory, got %d entries", len(entries))
+	}
+}
+
+func TestLocalStorage_WritePolicy(t *testing.T) {
+	ctx := context.Background()
+	key := "packages/numpy/numpy-1.26.4.tar.gz"
+
+	// The slow write starts first but finishes after the fast one
+	overlap := func(t *testing.T, storage *LocalStorage) (*ObjectInfo, string) {
+		t.Helper()
+		pr, pw := io.Pipe()
+		done := make(chan *ObjectInfo)
+		go func() {
+			info, err := storage.Put(ctx, key, pr, -1, "")
+			if err != nil {
+				t.Errorf("Slow Put failed: %v", err)
+			}
+			done <- info
+		}()
+		_, _ = pw.Write([]byte("slow"))
+
+		fastCtx := WithMetadata(ctx, map[string]string{MetaUpstreamURL: "fast"})
+		if _, err := storage.Put(fastCtx, key, strings.NewReader("fast"), 4, ""); err != nil {
+			t.Fatalf("Fast Put failed: %v", err)
+		}
+		_, _ = pw.Write([]byte("-and-late"))
+		_ = pw.Close()
+		info := <-done
+
+		reader, _, err := storage.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		defer func() { _ = reader.Close() }()
+		data, _ := io.ReadAll(reader)
+		return info, string(data)
+	}
+
+	t.Run("last_writer_wins", func(t *testing.T) {
+		storage, _ := NewLocalStorage(t.TempDir())
+		if info, data := overlap(t, storage); data != "slow-and-late" || info.Size != 13 {
+			t.Errorf("Expected the later write to be kept, got %q (size %d)", data, info.Size)
+		}
+	})
+
+	t.Run("first_writer_wins", func(t *testing.T) {
+		storage, _ := NewLocalStorage(t.TempDir())
+		storage.UseWritePolicy(FirstWriterWins)
+
+		// The discarded write reports the object that was kept
+		info, data := overlap(t, storage)
+		if data != "fast" || info.Size != 4 || info.Metadata[MetaUpstreamURL] != "fast" {
+			t.Errorf("Expected the earlier write to be kept, got %q (%+v)", data, info)
+		}
+		entries, _ := os.ReadDir(filepath.Dir(storage.buildPath(key)))
+		if len(entries) != 1 {
+			t.Errorf("Expected the discarded temp file to be removed, got %d entries", len(entries))
+		}
+
+		// A write that starts after the object was stored still replaces it
+		if _, err := storage.Put(ctx, key, strings.NewReader("replaced"), 8, ""); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if info, _ := storage.Stat(ctx, key); info.Size != 8 {
+			t.Errorf("Expected a later write to replace the object, got size %d", info.Size)
+		}
+	})
+}
+
+func TestParseWritePolicy(t *testing.T) {
+	for name, want := range map[string]WritePolicy{"": LastWriterWins, "last-writer-wins": LastWriterWins, "first-writer-wins": FirstWriterWins} {
+		if got, err := ParseWritePolicy(name); err != nil || got != want {
+			t.Errorf("ParseWritePolicy(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseWritePolicy("newest"); err == nil {
+		t.Error("Expected an unknown policy to be rejected")
+	}
+}
+
+func TestLocalStorage_Portability(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	storage, err := NewLocalStorage("cache")
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+	if !filepath.IsAbs(storage.baseDir) {
+		t.Errorf("Expected an absolute base directory, got %s", storage.baseDir)
+	}
+
+	// Deeply nested keys exceed Windows' 260 character MAX_PATH
+	ctx := context.Background()
+	key := strings.Repeat("deeply-nested-directory/", 12) + "numpy-1.26.4-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl"
+	if _, err := storage.Put(ctx, key, strings.NewReader("wheel"), 5, ""); err != nil {
+		t.Fatalf("Put with a long path failed: %v", err)
+	}
+	if exists, _ := storage.Exists(ctx, key); !exists {
+		t.Error("Expected the long path to exist")
+	}
+
+	// Keys keep forward slashes on every OS
+	objects, err := storage.List(ctx, ListOptions{Prefix: "deeply-nested-directory/"})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("Expected List to match files only at the prefix level, got %d", len(objects))
+	}
+	var walked []string
+	if err := storage.Walk(ctx, "", func(info *ObjectInfo) error {
+		walked = append(walked, info.Key)
+		return nil
+	}); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if len(walked) != 1 || walked[0] != key {
+		t.Errorf("Expected to walk %q, got %v", key, walked)
+	}
+}
+
 func TestLocalStorage_ErrorConditions(t *testing.T) {
 	storage, _ := NewLocalStorage(t.TempDir())
 	ctx := context.Background()
@@ -7,10 +7,14 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/phuslu/log"
+
+	"github.com/huyhandes/groxpi/internal/catalog"
 )
 
 // LRUEntry represents an entry in the LRU cache
@@ -33,6 +37,13 @@ type LRUCache struct {
 	baseDir      string                   // Base directory for cached files
 	evictionChan chan struct{}            // Channel to trigger eviction checks
 	stopChan     chan struct{}            // Channel to stop background eviction
+	onEvict      func(key string, size int64)
+	prioritize   func(keys []string) map[string]bool
+	lockKey      func(key string) (unlock func()) // Excludes writers of a key while it is evicted
+	catalog      *catalog.Catalog                 // Persists access times and hits (nil = memory only)
+	pins         map[string]int                   // Readers of each key still in progress
+	grace        time.Duration                    // Entries written more recently are not evicted (0 = disabled)
+	excluded     []string                         // Key prefixes neither counted nor evicted
 	wg           sync.WaitGroup
 }
 
@@ -43,6 +54,7 @@ func NewLRUCache(baseDir string, maxSize int64, ttl time.Duration) *LRUCache {
 		currentSize:  0,
 		ttl:          ttl,
 		entries:      make(map[string]*list.Element),
+		pins:         make(map[string]int),
 		lruList:      list.New(),
 		baseDir:      baseDir,
 		evictionChan: make(chan struct{}, 1),
@@ -78,25 +90,201 @@ func (lru *LRUCache) evictionWorker() {
 		case <-lru.evictionChan:
 			lru.performEviction()
 		case <-ticker.C:
-			// Periodic cleanup of stale entries
+			// Periodic cleanup of stale entries, then a retry of whatever
+			// eviction skipped while it was in use
 			lru.cleanupStaleEntries()
+			lru.performEviction()
 		}
 	}
 }
 
-// performEviction evicts entries until size is under limit
+// OnEvict registers fn to be called after each eviction
+func (lru *LRUCache) OnEvict(fn func(key string, size int64)) {
+	lru.mu.Lock()
+	lru.onEvict = fn
+	lru.mu.Unlock()
+}
+
+// PrioritizeEviction registers fn to choose entries evicted before pure LRU
+// order applies, e.g. superseded package versions
+func (lru *LRUCache) PrioritizeEviction(fn func(keys []string) map[string]bool) {
+	lru.mu.Lock()
+	lru.prioritize = fn
+	lru.mu.Unlock()
+}
+
+// LockKeys makes eviction take lock(key) before deleting a file, so it
+// can't remove a file that a concurrent write is replacing
+func (lru *LRUCache) LockKeys(lock func(key string) (unlock func())) {
+	lru.mu.Lock()
+	lru.lockKey = lock
+	lru.mu.Unlock()
+}
+
+// SetGrace exempts entries written less than d ago from eviction, so a file
+// is not evicted before the clients that asked for it have read it
+func (lru *LRUCache) SetGrace(d time.Duration) {
+	lru.mu.Lock()
+	lru.grace = d
+	lru.mu.Unlock()
+}
+
+// Exclude stops tracking keys under prefix: they don't count against the
+// size limit and are never evicted. Entries already tracked are dropped.
+func (lru *LRUCache) Exclude(prefix string) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	lru.excluded = append(lru.excluded, prefix)
+	for key, elem := range lru.entries {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		lru.currentSize -= elem.Value.(*LRUEntry).Size
+		delete(lru.entries, key)
+		lru.lruList.Remove(elem)
+		if lru.catalog != nil {
+			lru.catalog.Delete(key)
+		}
+	}
+}
+
+// excludes reports whether key is under an excluded prefix; lru.mu must be
+// held
+func (lru *LRUCache) excludes(key string) bool {
+	for _, prefix := range lru.excluded {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Pin exempts key from eviction until the returned function is called. Pins
+// are counted, so a key stays pinned while any reader holds it.
+func (lru *LRUCache) Pin(key string) (unpin func()) {
+	lru.mu.Lock()
+	lru.pins[key]++
+	lru.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			lru.mu.Lock()
+			defer lru.mu.Unlock()
+			if lru.pins[key]--; lru.pins[key] <= 0 {
+				delete(lru.pins, key)
+				lru.scheduleEviction()
+			}
+		})
+	}
+}
+
+// exempt reports whether entry must not be evicted now: it is being read,
+// or was written within the grace period; lru.mu must be held
+func (lru *LRUCache) exempt(entry *LRUEntry, now time.Time) bool {
+	return lru.pins[entry.Key] > 0 || lru.grace > 0 && now.Sub(entry.CreatedAt) < lru.grace
+}
+
+// scheduleEviction queues an eviction pass if the cache is over its limit;
+// lru.mu must be held
+func (lru *LRUCache) scheduleEviction() {
+	if lru.maxSize > 0 && lru.currentSize > lru.maxSize {
+		select {
+		case lru.evictionChan <- struct{}{}:
+		default:
+			// Eviction already queued
+		}
+	}
+}
+
+// UseCatalog persists access times and hit counts in c and restores them
+// for the files found by ScanAndRebuild, so eviction keeps its LRU order
+// across restarts. Catalog entries for files that disappeared while groxpi
+// was down are dropped and files the catalog doesn't know are added.
+func (lru *LRUCache) UseCatalog(c *catalog.Catalog) error {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	restored := make(map[string]bool, len(lru.entries))
+	err := c.Range(func(key string, e catalog.Entry) {
+		elem, exists := lru.entries[key]
+		if !exists {
+			c.Delete(key)
+			return
+		}
+		entry := elem.Value.(*LRUEntry)
+		entry.LastAccessed = e.LastAccessed
+		entry.CreatedAt = e.CreatedAt
+		restored[key] = true
+	})
+	if err != nil {
+		return err
+	}
+	lru.catalog = c
+
+	// Reorder by access time, most recent first, as if the entries had
+	// been accessed in order
+	entries := make([]*LRUEntry, 0, lru.lruList.Len())
+	for elem := lru.lruList.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*LRUEntry)
+		entries = append(entries, entry)
+		if !restored[entry.Key] {
+			c.Put(entry.Key, catalog.Entry{
+				Size:         entry.Size,
+				CreatedAt:    entry.CreatedAt,
+				LastAccessed: entry.LastAccessed,
+			})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastAccessed.After(entries[j].LastAccessed)
+	})
+	lru.lruList.Init()
+	for _, entry := range entries {
+		lru.entries[entry.Key] = lru.lruList.PushBack(entry)
+	}
+
+	log.Info().
+		Int("restored_count", len(restored)).
+		Int("entry_count", len(entries)).
+		Msg("Restored L1 cache access times from metadata database")
+
+	return nil
+}
+
+// performEviction evicts entries until size is under limit, then reports
+// them to the eviction handler outside the lock
+func (lru *LRUCache) performEviction() {
+	evicted := lru.evict()
+
+	lru.mu.RLock()
+	onEvict := lru.onEvict
+	lru.mu.RUnlock()
+
+	if onEvict != nil {
+		for _, entry := range evicted {
+			onEvict(entry.Key, entry.Size)
+		}
+	}
+}
+
+// evict removes entries until size is under limit and returns them
 // Two-phase eviction when TTL is enabled:
 // Phase 1: Evict only expired entries (in LRU order)
-// Phase 2: If still over limit, fall back to pure LRU eviction
-func (lru *LRUCache) performEviction() {
+// Phase 2: Evict prioritized entries, if a policy is registered (in LRU order)
+// Phase 3: If still over limit, fall back to pure LRU eviction
+func (lru *LRUCache) evict() []*LRUEntry {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
 	// If maxSize is 0, treat as unlimited (no eviction)
 	if lru.maxSize == 0 || lru.currentSize <= lru.maxSize {
-		return
+		return nil
 	}
 
+	var evicted []*LRUEntry
+
 	evictedCount := 0
 	evictedSize := int64(0)
 	now := time.Now()
@@ -113,7 +301,7 @@ func (lru *LRUCache) performEviction() {
 		var expiredElements []*list.Element
 		for elem := lru.lruList.Back(); elem != nil; elem = elem.Prev() {
 			entry := elem.Value.(*LRUEntry)
-			if now.Sub(entry.CreatedAt) > lru.ttl {
+			if now.Sub(entry.CreatedAt) > lru.ttl && !lru.exempt(entry, now) {
 				expiredElements = append(expiredElements, elem)
 			}
 		}
@@ -128,11 +316,34 @@ func (lru *LRUCache) performEviction() {
 			if err := lru.evictEntry(elem, entry, true); err == nil {
 				evictedCount++
 				evictedSize += entry.Size
+				evicted = append(evicted, entry)
+			}
+		}
+	}
+
+	// Phase 2: Evict entries the policy gives up first
+	if lru.prioritize != nil && lru.currentSize > lru.maxSize {
+		keys := make([]string, 0, len(lru.entries))
+		for key := range lru.entries {
+			keys = append(keys, key)
+		}
+		preferred := lru.prioritize(keys)
+
+		for elem := lru.lruList.Back(); elem != nil && lru.currentSize > lru.maxSize; {
+			prev := elem.Prev()
+			entry := elem.Value.(*LRUEntry)
+			if preferred[entry.Key] && !lru.exempt(entry, now) {
+				if err := lru.evictEntry(elem, entry, false); err == nil {
+					evictedCount++
+					evictedSize += entry.Size
+					evicted = append(evicted, entry)
+				}
 			}
+			elem = prev
 		}
 	}
 
-	// Phase 2: If still over limit, fall back to pure LRU eviction
+	// Phase 3: If still over limit, fall back to pure LRU eviction
 	if lru.currentSize > lru.maxSize {
 		if lru.ttl > 0 {
 			log.Warn().
@@ -141,29 +352,47 @@ func (lru *LRUCache) performEviction() {
 				Msg("Evicting unexpired entries to meet size limit (all expired entries already evicted)")
 		}
 
-		for lru.currentSize > lru.maxSize && lru.lruList.Len() > 0 {
-			elem := lru.lruList.Back()
-			if elem == nil {
-				break
-			}
-
+		for elem := lru.lruList.Back(); elem != nil && lru.currentSize > lru.maxSize; {
+			prev := elem.Prev()
 			entry := elem.Value.(*LRUEntry)
-			if err := lru.evictEntry(elem, entry, false); err == nil {
-				evictedCount++
-				evictedSize += entry.Size
+			if !lru.exempt(entry, now) {
+				if err := lru.evictEntry(elem, entry, false); err == nil {
+					evictedCount++
+					evictedSize += entry.Size
+					evicted = append(evicted, entry)
+				}
 			}
+			elem = prev
 		}
 	}
 
+	// What is left over the limit is in use or just written; it goes once
+	// unpinned or out of its grace period
+	if lru.currentSize > lru.maxSize {
+		log.Warn().
+			Int64("current_size_mb", lru.currentSize/(1024*1024)).
+			Int64("max_size_mb", lru.maxSize/(1024*1024)).
+			Int("pinned", len(lru.pins)).
+			Msg("Cache over its size limit with every remaining entry in use or recently written")
+	}
+
 	log.Info().
 		Int("evicted_count", evictedCount).
 		Int64("evicted_size_mb", evictedSize/(1024*1024)).
 		Int64("new_size_mb", lru.currentSize/(1024*1024)).
 		Msg("LRU eviction completed")
+
+	return evicted
 }
 
 // evictEntry removes a single entry from the cache
 func (lru *LRUCache) evictEntry(elem *list.Element, entry *LRUEntry, expired bool) error {
+	// Don't delete a file a concurrent write is just replacing
+	if lru.lockKey != nil {
+		unlock := lru.lockKey(entry.Key)
+		defer unlock()
+	}
+
 	// Delete the file
 	if err := os.Remove(entry.FilePath); err != nil {
 		if !os.IsNotExist(err) {
@@ -176,6 +405,11 @@ func (lru *LRUCache) evictEntry(elem *list.Element, entry *LRUEntry, expired boo
 		}
 	}
 
+	removeSidecar(lru.baseDir, entry.Key)
+	if lru.catalog != nil {
+		lru.catalog.Delete(entry.Key)
+	}
+
 	// Remove from tracking
 	lru.currentSize -= entry.Size
 	delete(lru.entries, entry.Key)
@@ -210,6 +444,9 @@ func (lru *LRUCache) cleanupStaleEntries() {
 
 			delete(lru.entries, key)
 			lru.lruList.Remove(elem)
+			if lru.catalog != nil {
+				lru.catalog.Delete(key)
+			}
 
 			log.Debug().
 				Str("key", key).
@@ -231,6 +468,35 @@ func (lru *LRUCache) RecordAccess(key string, size int64) error {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
 
+	if lru.excludes(key) {
+		return nil
+	}
+
+	lru.track(key, size)
+	if lru.catalog != nil {
+		lru.catalog.RecordHit(key, size)
+	}
+	return nil
+}
+
+// RecordWrite records a write operation and adds/updates entry
+func (lru *LRUCache) RecordWrite(key string, size int64) error {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	if lru.excludes(key) {
+		return nil
+	}
+
+	lru.track(key, size)
+	if lru.catalog != nil {
+		lru.catalog.RecordWrite(key, size, readSidecar(lru.baseDir, key)[MetaSHA256])
+	}
+	return nil
+}
+
+// track marks key as most recently used, adding it if new; lru.mu must be held
+func (lru *LRUCache) track(key string, size int64) {
 	filePath := filepath.Join(lru.baseDir, key)
 
 	// Check if entry already exists
@@ -241,7 +507,7 @@ func (lru *LRUCache) RecordAccess(key string, size int64) error {
 		lru.lruList.MoveToFront(elem)
 
 		log.Debug().Str("key", key).Msg("Updated access time for existing entry")
-		return nil
+		return
 	}
 
 	// New entry
@@ -265,20 +531,7 @@ func (lru *LRUCache) RecordAccess(key string, size int64) error {
 		Msg("Added new entry to L1 cache")
 
 	// Trigger eviction if over size limit (skip if maxSize is 0 - unlimited)
-	if lru.maxSize > 0 && lru.currentSize > lru.maxSize {
-		select {
-		case lru.evictionChan <- struct{}{}:
-		default:
-			// Eviction already queued
-		}
-	}
-
-	return nil
-}
-
-// RecordWrite records a write operation and adds/updates entry
-func (lru *LRUCache) RecordWrite(key string, size int64) error {
-	return lru.RecordAccess(key, size)
+	lru.scheduleEviction()
 }
 
 // RecordDelete removes an entry from tracking
@@ -296,6 +549,9 @@ func (lru *LRUCache) RecordDelete(key string) error {
 
 	delete(lru.entries, key)
 	lru.lruList.Remove(elem)
+	if lru.catalog != nil {
+		lru.catalog.Delete(key)
+	}
 
 	log.Debug().
 		Str("key", key).
@@ -305,6 +561,18 @@ func (lru *LRUCache) RecordDelete(key string) error {
 	return nil
 }
 
+// LastAccessed returns when key was last read or written
+func (lru *LRUCache) LastAccessed(key string) (time.Time, bool) {
+	lru.mu.RLock()
+	defer lru.mu.RUnlock()
+
+	elem, exists := lru.entries[key]
+	if !exists {
+		return time.Time{}, false
+	}
+	return elem.Value.(*LRUEntry).LastAccessed, true
+}
+
 // GetStats returns current cache statistics
 func (lru *LRUCache) GetStats() map[string]interface{} {
 	lru.mu.RLock()
@@ -361,8 +629,11 @@ func (lru *LRUCache) ScanAndRebuild(ctx context.Context) error {
 			return err
 		}
 
-		// Skip directories
+		// Skip directories, the metadata sidecars and the range cache
 		if info.IsDir() {
+			if isInternalDir(lru.baseDir, path) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
@@ -372,6 +643,12 @@ func (lru *LRUCache) ScanAndRebuild(ctx context.Context) error {
 			return err
 		}
 
+		// Keys use forward slashes on every OS
+		relPath = filepath.ToSlash(relPath)
+		if lru.excludes(relPath) {
+			return nil
+		}
+
 		// Add to LRU cache (use ModTime as CreatedAt for existing files)
 		entry := &LRUEntry{
 			Key:          relPath,
@@ -428,7 +705,8 @@ func NewLRULocalStorage(baseDir string, maxSize int64, ttl time.Duration) (*LRUL
 	}
 
 	// Create LRU cache with TTL
-	lruCache := NewLRUCache(baseDir, maxSize, ttl)
+	lruCache := NewLRUCache(localStorage.baseDir, maxSize, ttl)
+	lruCache.LockKeys(localStorage.locks.lock)
 
 	storage := &LRULocalStorage{
 		LocalStorage: localStorage,
@@ -444,14 +722,33 @@ func NewLRULocalStorage(baseDir string, maxSize int64, ttl time.Duration) (*LRUL
 	return storage, nil
 }
 
-// Get wraps LocalStorage.Get with LRU tracking
+// Get wraps LocalStorage.Get with LRU tracking. The object is pinned until
+// the reader is closed.
 func (lru *LRULocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	unpin := lru.lruCache.Pin(key)
 	reader, info, err := lru.LocalStorage.Get(ctx, key)
-	if err == nil {
-		// Record access for LRU
-		_ = lru.lruCache.RecordAccess(key, info.Size)
+	if err != nil {
+		unpin()
+		return nil, nil, err
+	}
+	// Record access for LRU
+	_ = lru.lruCache.RecordAccess(key, info.Size)
+	return &pinnedReader{ReadCloser: reader, unpin: unpin}, info, nil
+}
+
+// GetRange wraps LocalStorage.GetRange with LRU tracking, so resumed
+// downloads count as uses too. The object is pinned until the reader is
+// closed.
+func (lru *LRULocalStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, *ObjectInfo, error) {
+	unpin := lru.lruCache.Pin(key)
+	reader, info, err := lru.LocalStorage.GetRange(ctx, key, offset, length)
+	if err != nil {
+		unpin()
+		return nil, nil, err
 	}
-	return reader, info, err
+	// Record access for LRU
+	_ = lru.lruCache.RecordAccess(key, info.Size)
+	return &pinnedReader{ReadCloser: reader, unpin: unpin}, info, nil
 }
 
 // Put wraps LocalStorage.Put with LRU tracking
@@ -474,6 +771,43 @@ func (lru *LRULocalStorage) StreamingPut(ctx context.Context, key string, reader
 	return info, err
 }
 
+// StreamingGet wraps LocalStorage.StreamingGet with LRU tracking, pinning
+// the object while it is written out
+func (lru *LRULocalStorage) StreamingGet(ctx context.Context, key string, writer io.Writer) (*ObjectInfo, error) {
+	defer lru.lruCache.Pin(key)()
+	info, err := lru.LocalStorage.StreamingGet(ctx, key, writer)
+	if err == nil {
+		// Record access for LRU
+		_ = lru.lruCache.RecordAccess(key, info.Size)
+	}
+	return info, err
+}
+
+// GetFilePath wraps LocalStorage.GetFilePath with LRU tracking, since the
+// zero-copy serving path never goes through Get
+func (lru *LRULocalStorage) GetFilePath(ctx context.Context, key string) (string, error) {
+	path, err := lru.LocalStorage.GetFilePath(ctx, key)
+	if err == nil {
+		if stat, statErr := os.Stat(path); statErr == nil {
+			// Record access for LRU
+			_ = lru.lruCache.RecordAccess(key, stat.Size())
+		}
+	}
+	return path, err
+}
+
+// Rename wraps LocalStorage.Rename with LRU tracking
+func (lru *LRULocalStorage) Rename(ctx context.Context, src, dst string) error {
+	if err := lru.LocalStorage.Rename(ctx, src, dst); err != nil {
+		return err
+	}
+	_ = lru.lruCache.RecordDelete(src)
+	if info, err := lru.LocalStorage.Stat(ctx, dst); err == nil {
+		_ = lru.lruCache.RecordWrite(dst, info.Size)
+	}
+	return nil
+}
+
 // Delete wraps LocalStorage.Delete with LRU tracking
 func (lru *LRULocalStorage) Delete(ctx context.Context, key string) error {
 	err := lru.LocalStorage.Delete(ctx, key)
@@ -484,6 +818,50 @@ func (lru *LRULocalStorage) Delete(ctx context.Context, key string) error {
 	return err
 }
 
+// CleanupTemp removes stale temp files and drops them from LRU tracking
+func (lru *LRULocalStorage) CleanupTemp(ctx context.Context, olderThan time.Duration, dryRun bool) (int, int64, error) {
+	return lru.LocalStorage.cleanupTemp(ctx, olderThan, dryRun, func(key string) {
+		_ = lru.lruCache.RecordDelete(key)
+	})
+}
+
+// Pin exempts key from eviction until the returned function is called, for
+// readers that open the file by its path
+func (lru *LRULocalStorage) Pin(key string) (unpin func()) {
+	return lru.lruCache.Pin(key)
+}
+
+// ExcludeFromEviction keeps objects under prefix out of the size limit and
+// eviction
+func (lru *LRULocalStorage) ExcludeFromEviction(prefix string) {
+	lru.lruCache.Exclude(prefix)
+}
+
+// SetEvictionGrace exempts objects written less than d ago from eviction
+func (lru *LRULocalStorage) SetEvictionGrace(d time.Duration) {
+	lru.lruCache.SetGrace(d)
+}
+
+// LastAccessed returns when key was last read or written through this storage
+func (lru *LRULocalStorage) LastAccessed(key string) (time.Time, bool) {
+	return lru.lruCache.LastAccessed(key)
+}
+
+// OnEvict registers fn to be called after the LRU evicts an object
+func (lru *LRULocalStorage) OnEvict(fn func(key string, size int64)) {
+	lru.lruCache.OnEvict(fn)
+}
+
+// UseCatalog persists LRU access times and hit counts in c
+func (lru *LRULocalStorage) UseCatalog(c *catalog.Catalog) error {
+	return lru.lruCache.UseCatalog(c)
+}
+
+// PrioritizeEviction registers fn to pick objects evicted before LRU order
+func (lru *LRULocalStorage) PrioritizeEviction(fn func(keys []string) map[string]bool) {
+	lru.lruCache.PrioritizeEviction(fn)
+}
+
 // GetStats returns LRU cache statistics
 func (lru *LRULocalStorage) GetStats() map[string]interface{} {
 	return lru.lruCache.GetStats()
@@ -494,3 +872,19 @@ func (lru *LRULocalStorage) Close() error {
 	_ = lru.lruCache.Close()
 	return lru.LocalStorage.Close()
 }
+
+// pinnedReader unpins its object when closed
+type pinnedReader struct {
+	io.ReadCloser
+	unpin func()
+}
+
+func (r *pinnedReader) Close() error {
+	defer r.unpin()
+	return r.ReadCloser.Close()
+}
+
+// WriteTo keeps the zero-copy paths io.Copy takes for files
+func (r *pinnedReader) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, r.ReadCloser)
+}
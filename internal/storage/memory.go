@@ -0,0 +1,327 @@
+package storage
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps objects in memory, evicting the least recently used
+// ones to stay under a size limit. Nothing survives a restart, which suits
+// tests, short-lived CI jobs and benchmarks of the handler path without
+// disk or network noise.
+type MemoryStorage struct {
+	mu      sync.Mutex
+	maxSize int64 // 0 = unlimited
+	size    int64
+	objects map[string]*list.Element
+	lru     *list.List // Front = most recently used
+	onEvict []func(key string, size int64)
+}
+
+// memoryObject is a stored object; its data is never modified in place, so
+// readers handed out earlier keep seeing the version they opened
+type memoryObject struct {
+	info     ObjectInfo
+	data     []byte
+	accessed time.Time
+}
+
+// NewMemoryStorage creates in-memory storage holding up to maxSize bytes
+// (0 = unlimited)
+func NewMemoryStorage(maxSize int64) *MemoryStorage {
+	return &MemoryStorage{
+		maxSize: maxSize,
+		objects: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// lookup returns key's object, marking it as used
+func (m *MemoryStorage) lookup(key string, touch bool) (*memoryObject, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("object not found: %s", key)
+	}
+	obj := elem.Value.(*memoryObject)
+	if touch {
+		m.lru.MoveToFront(elem)
+		obj.accessed = time.Now()
+	}
+	return obj, nil
+}
+
+// infoOf returns a copy of obj's info callers are free to modify
+func infoOf(obj *memoryObject) *ObjectInfo {
+	info := obj.info
+	if obj.info.Metadata != nil {
+		info.Metadata = make(map[string]string, len(obj.info.Metadata))
+		for k, v := range obj.info.Metadata {
+			info.Metadata[k] = v
+		}
+	}
+	return &info
+}
+
+// Get retrieves an object from memory
+func (m *MemoryStorage) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	obj, err := m.lookup(key, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), infoOf(obj), nil
+}
+
+// GetRange retrieves a byte range of an object
+func (m *MemoryStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, *ObjectInfo, error) {
+	obj, err := m.lookup(key, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	size := int64(len(obj.data))
+	if offset < 0 || offset > size {
+		return nil, nil, fmt.Errorf("range offset %d out of bounds for %s", offset, key)
+	}
+	end := size
+	if length > 0 && offset+length < size {
+		end = offset + length
+	}
+	return io.NopCloser(bytes.NewReader(obj.data[offset:end])), infoOf(obj), nil
+}
+
+// Put stores an object, evicting the least recently used ones to make room
+func (m *MemoryStorage) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (*ObjectInfo, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	if m.maxSize > 0 && int64(len(data)) > m.maxSize {
+		return nil, fmt.Errorf("object %s of %d bytes exceeds the memory storage limit of %d bytes", key, len(data), m.maxSize)
+	}
+
+	now := time.Now()
+	obj := &memoryObject{
+		info: ObjectInfo{
+			Key:          key,
+			Size:         int64(len(data)),
+			LastModified: now,
+			ContentType:  contentType,
+			Metadata:     metadataFromContext(ctx),
+		},
+		data:     data,
+		accessed: now,
+	}
+
+	m.mu.Lock()
+	m.remove(key)
+	m.objects[key] = m.lru.PushFront(obj)
+	m.size += obj.info.Size
+	evicted := m.evict()
+	callbacks := m.onEvict
+	m.mu.Unlock()
+
+	for _, old := range evicted {
+		for _, fn := range callbacks {
+			fn(old.info.Key, old.info.Size)
+		}
+	}
+	return infoOf(obj), nil
+}
+
+// evict drops least recently used objects until the total fits the limit.
+// Must be called with mu held.
+func (m *MemoryStorage) evict() []*memoryObject {
+	var evicted []*memoryObject
+	for m.maxSize > 0 && m.size > m.maxSize {
+		obj := m.lru.Back().Value.(*memoryObject)
+		m.remove(obj.info.Key)
+		evicted = append(evicted, obj)
+	}
+	return evicted
+}
+
+// remove drops key if present. Must be called with mu held.
+func (m *MemoryStorage) remove(key string) (*memoryObject, bool) {
+	elem, ok := m.objects[key]
+	if !ok {
+		return nil, false
+	}
+	obj := elem.Value.(*memoryObject)
+	m.lru.Remove(elem)
+	delete(m.objects, key)
+	m.size -= obj.info.Size
+	return obj, true
+}
+
+// PutMultipart is the same as Put for memory storage
+func (m *MemoryStorage) PutMultipart(ctx context.Context, key string, reader io.Reader, size int64, contentType string, partSize int64) (*ObjectInfo, error) {
+	return m.Put(ctx, key, reader, size, contentType)
+}
+
+// Delete removes an object
+func (m *MemoryStorage) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(key)
+	return nil
+}
+
+// Exists checks if an object exists
+func (m *MemoryStorage) Exists(ctx context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.objects[key]
+	return ok, nil
+}
+
+// Stat retrieves object metadata
+func (m *MemoryStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	obj, err := m.lookup(key, false)
+	if err != nil {
+		return nil, err
+	}
+	return infoOf(obj), nil
+}
+
+// List returns the objects directly under the directory of opts.Prefix
+// whose key starts with it, like a local directory listing
+func (m *MemoryStorage) List(ctx context.Context, opts ListOptions) ([]*ObjectInfo, error) {
+	dir, _ := path.Split(opts.Prefix)
+
+	m.mu.Lock()
+	var objects []*ObjectInfo
+	for key, elem := range m.objects {
+		if !strings.HasPrefix(key, opts.Prefix) || strings.Contains(key[len(dir):], "/") {
+			continue
+		}
+		if opts.StartAfter != "" && key <= opts.StartAfter {
+			continue
+		}
+		objects = append(objects, infoOf(elem.Value.(*memoryObject)))
+	}
+	m.mu.Unlock()
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	if opts.MaxKeys > 0 && len(objects) > opts.MaxKeys {
+		objects = objects[:opts.MaxKeys]
+	}
+	return objects, nil
+}
+
+// Walk calls fn for every object under prefix, in key order
+func (m *MemoryStorage) Walk(ctx context.Context, prefix string, fn func(*ObjectInfo) error) error {
+	m.mu.Lock()
+	var objects []*ObjectInfo
+	for key, elem := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, infoOf(elem.Value.(*memoryObject)))
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	for _, obj := range objects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeletePrefix removes every object under prefix
+func (m *MemoryStorage) DeletePrefix(ctx context.Context, prefix string) (int, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var count int
+	var size int64
+	for key := range m.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if obj, ok := m.remove(key); ok {
+			count++
+			size += obj.info.Size
+		}
+	}
+	return count, size, nil
+}
+
+// GetPresignedURL is not supported for memory storage
+func (m *MemoryStorage) GetPresignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return "", errors.New("memory storage doesn't support presigned URLs")
+}
+
+// Close drops every object
+func (m *MemoryStorage) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects = make(map[string]*list.Element)
+	m.lru.Init()
+	m.size = 0
+	return nil
+}
+
+// StreamingPut is the same as Put for memory storage
+func (m *MemoryStorage) StreamingPut(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (*ObjectInfo, error) {
+	return m.Put(ctx, key, reader, size, contentType)
+}
+
+// StreamingGet copies an object to writer
+func (m *MemoryStorage) StreamingGet(ctx context.Context, key string, writer io.Writer) (*ObjectInfo, error) {
+	obj, err := m.lookup(key, true)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(obj.data); err != nil {
+		return nil, fmt.Errorf("failed to stream object %s: %w", key, err)
+	}
+	return infoOf(obj), nil
+}
+
+// GetFilePath is not supported for memory storage
+func (m *MemoryStorage) GetFilePath(ctx context.Context, key string) (string, error) {
+	return "", errors.New("memory storage doesn't support local file paths")
+}
+
+// SupportsZeroCopy indicates if the backend supports zero-copy operations
+func (m *MemoryStorage) SupportsZeroCopy() bool {
+	return false
+}
+
+// LastAccessed returns when key was last read or written
+func (m *MemoryStorage) LastAccessed(key string) (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.objects[key]
+	if !ok {
+		return time.Time{}, false
+	}
+	return elem.Value.(*memoryObject).accessed, true
+}
+
+// OnEvict registers fn to be called after an object is evicted
+func (m *MemoryStorage) OnEvict(fn func(key string, size int64)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onEvict = append(m.onEvict, fn)
+}
+
+// Size returns the total size of the stored objects
+func (m *MemoryStorage) Size() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.size
+}
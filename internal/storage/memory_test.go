@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStorage(20)
+	defer func() { _ = store.Close() }()
+
+	var evicted []string
+	store.OnEvict(func(key string, size int64) { evicted = append(evicted, key) })
+
+	if _, _, err := store.Get(ctx, "packages/six/a.whl"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+
+	metaCtx := WithMetadata(ctx, map[string]string{MetaSHA256: "abc123"})
+	if _, err := store.Put(metaCtx, "packages/six/a.whl", strings.NewReader("0123456789"), 10, "application/octet-stream"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := store.Put(ctx, "packages/six/sub/b.whl", strings.NewReader("abcde"), 5, ""); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	reader, info, err := store.GetRange(ctx, "packages/six/a.whl", 2, 3)
+	if err != nil {
+		t.Fatalf("GetRange failed: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	if string(data) != "234" || info.Size != 10 || info.Metadata[MetaSHA256] != "abc123" {
+		t.Errorf("Unexpected range %q %+v", data, info)
+	}
+
+	listed, err := store.List(ctx, ListOptions{Prefix: "packages/six/"})
+	if err != nil || len(listed) != 1 || listed[0].Key != "packages/six/a.whl" {
+		t.Errorf("Expected only the top-level object listed, got %v (%v)", listed, err)
+	}
+
+	// a.whl was read last, so b.whl goes to make room
+	if _, err := store.Put(ctx, "packages/six/c.whl", strings.NewReader("0123456789"), 10, ""); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if len(evicted) != 1 || evicted[0] != "packages/six/sub/b.whl" || store.Size() != 20 {
+		t.Errorf("Expected b.whl evicted leaving 20 bytes, got %v and %d bytes", evicted, store.Size())
+	}
+
+	var out bytes.Buffer
+	if _, err := store.StreamingGet(ctx, "packages/six/a.whl", &out); err != nil || out.String() != "0123456789" {
+		t.Errorf("Unexpected streamed object %q (%v)", out.String(), err)
+	}
+
+	if _, err := store.Put(ctx, "packages/huge.whl", strings.NewReader(strings.Repeat("x", 21)), 21, ""); err == nil {
+		t.Error("Expected an object over the limit to be rejected")
+	}
+
+	count, size, err := store.DeletePrefix(ctx, "packages/six/")
+	if err != nil || count != 2 || size != 20 || store.Size() != 0 {
+		t.Errorf("Expected 2 objects of 20 bytes deleted, got %d/%d (%v)", count, size, err)
+	}
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Metadata keys recorded for cached package files, so verification, audits
+// and re-download decisions don't need to query the index again
+const (
+	MetaUpstreamURL    = "upstream-url"
+	MetaSHA256         = "sha256"
+	MetaUploadTime     = "upload-time"
+	MetaRequiresPython = "requires-python"
+	MetaFetchedAt      = "fetched-at"
+)
+
+// metadataDir holds local sidecar files, outside the packages/ and trash/
+// trees so listings and walks never see them
+const metadataDir = ".meta"
+
+// isInternalDir reports whether path is one of the directories groxpi keeps
+// for itself inside a local cache rooted at baseDir
+func isInternalDir(baseDir, path string) bool {
+	return path == filepath.Join(baseDir, metadataDir) || path == filepath.Join(baseDir, rangeCacheDir)
+}
+
+type metadataKey struct{}
+
+// WithMetadata returns a context carrying metadata for objects stored with
+// it. Backends persist it alongside the object (S3 user metadata, local
+// sidecar files) and return it in ObjectInfo.Metadata. Threading it through
+// the context lets callers that only see a StorageWriter, such as the
+// streaming downloader, attach it without changing every Put signature.
+func WithMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	if len(metadata) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, metadataKey{}, metadata)
+}
+
+// metadataFromContext returns the metadata attached by WithMetadata, if any
+func metadataFromContext(ctx context.Context) map[string]string {
+	metadata, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return metadata
+}
+
+// normalizeMetadata lowercases keys, since S3 returns user metadata with
+// canonicalized header names ("Upstream-Url")
+func normalizeMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	normalized := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		normalized[strings.ToLower(k)] = v
+	}
+	return normalized
+}
+
+// sidecarPath returns where the local backend keeps key's metadata
+func sidecarPath(baseDir, key string) string {
+	return filepath.Join(baseDir, metadataDir, key+".json")
+}
+
+// writeSidecar stores metadata for key, or removes a stale sidecar left by
+// an earlier write of the same key when there is none
+func writeSidecar(baseDir, key string, metadata map[string]string) error {
+	path := sidecarPath(baseDir, key)
+	if len(metadata) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove metadata: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = renameFile(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return nil
+}
+
+// readSidecar loads key's metadata, returning nil if it has none
+func readSidecar(baseDir, key string) map[string]string {
+	data, err := os.ReadFile(sidecarPath(baseDir, key))
+	if err != nil {
+		return nil
+	}
+	var metadata map[string]string
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil
+	}
+	return metadata
+}
+
+// removeSidecar deletes key's metadata, if any
+func removeSidecar(baseDir, key string) {
+	_ = os.Remove(sidecarPath(baseDir, key))
+}
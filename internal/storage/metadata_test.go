@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorage_Metadata(t *testing.T) {
+	store, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	key := "packages/numpy/numpy-1.26.4.tar.gz"
+	metadata := map[string]string{
+		MetaUpstreamURL: "https://files.example/numpy-1.26.4.tar.gz",
+		MetaSHA256:      "abc123",
+	}
+	ctx := WithMetadata(context.Background(), metadata)
+	if _, err := store.Put(ctx, key, strings.NewReader("data"), 4, "application/octet-stream"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	info, err := store.Stat(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Metadata[MetaUpstreamURL] != metadata[MetaUpstreamURL] || info.Metadata[MetaSHA256] != "abc123" {
+		t.Errorf("Unexpected metadata %v", info.Metadata)
+	}
+
+	// Sidecars must not show up as stored objects
+	var keys []string
+	if err := store.Walk(context.Background(), "", func(obj *ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	}); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != key {
+		t.Errorf("Expected only %s, got %v", key, keys)
+	}
+
+	// Rewriting without metadata drops the stale sidecar
+	if _, err := store.Put(context.Background(), key, strings.NewReader("data"), 4, "application/octet-stream"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if info, _ := store.Stat(context.Background(), key); len(info.Metadata) != 0 {
+		t.Errorf("Expected no metadata after rewrite, got %v", info.Metadata)
+	}
+
+	if _, err := store.Put(ctx, key, strings.NewReader("data"), 4, "application/octet-stream"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := store.Delete(context.Background(), key); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := os.Stat(sidecarPath(store.baseDir, key)); !os.IsNotExist(err) {
+		t.Error("Expected sidecar to be removed with the object")
+	}
+}
+
+func TestNormalizeMetadata(t *testing.T) {
+	got := normalizeMetadata(map[string]string{"Upstream-Url": "https://files.example/a.whl"})
+	if got[MetaUpstreamURL] != "https://files.example/a.whl" {
+		t.Errorf("Expected lowercased keys, got %v", got)
+	}
+	if normalizeMetadata(nil) != nil {
+		t.Error("Expected nil for empty metadata")
+	}
+}
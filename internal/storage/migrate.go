@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+// MigrateReport summarizes a key layout migration
+type MigrateReport struct {
+	DryRun   bool          `json:"dry_run"`
+	Scanned  int           `json:"scanned"`
+	Moved    int           `json:"moved"`
+	Skipped  int           `json:"skipped"` // Already in the target layout or not a package file
+	Failed   int           `json:"failed"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// MigrateKeys relocates package files stored in the from layout to the to
+// layout. Each object is copied before its original is deleted, so an
+// interrupted migration can be resumed by running it again. from and to may
+// be the same layout: keys whose package name to would normalize are moved.
+func MigrateKeys(ctx context.Context, store Storage, from, to *KeyLayout, dryRun bool) (*MigrateReport, error) {
+	walker, ok := store.(Walker)
+	if !ok {
+		return nil, errors.New("storage backend does not support key migration")
+	}
+
+	start := time.Now()
+	report := &MigrateReport{DryRun: dryRun}
+
+	// Collect first and move afterwards so new keys don't disturb the walk
+	var pending []*ObjectInfo
+	err := walker.Walk(ctx, PackagesPrefix, func(obj *ObjectInfo) error {
+		report.Scanned++
+		pkg, file, ok := from.Parse(obj.Key)
+		if !ok || to.Key(pkg, file) == obj.Key {
+			report.Skipped++
+			return nil
+		}
+		pending = append(pending, obj)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan storage: %w", err)
+	}
+
+	for _, obj := range pending {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+
+		pkg, file, _ := from.Parse(obj.Key)
+		dst := to.Key(pkg, file)
+		if !dryRun {
+			if err := moveObject(ctx, store, obj.Key, dst); err != nil {
+				log.Warn().Err(err).Str("key", obj.Key).Str("destination", dst).Msg("Failed to migrate object")
+				report.Failed++
+				continue
+			}
+		}
+		report.Moved++
+		report.Bytes += obj.Size
+	}
+
+	report.Duration = time.Since(start)
+
+	log.Info().
+		Bool("dry_run", report.DryRun).
+		Str("from", from.Template()).
+		Str("to", to.Template()).
+		Int("scanned", report.Scanned).
+		Int("moved", report.Moved).
+		Int("skipped", report.Skipped).
+		Int("failed", report.Failed).
+		Int64("bytes", report.Bytes).
+		Dur("duration", report.Duration).
+		Msg("Storage key migration completed")
+
+	return report, nil
+}
+
+// MigratePrefix moves every object of from to the same key in to, for
+// moving a bucket's objects to another prefix. Keys starting with exclude
+// are left alone (empty = none), for when to's prefix lies within from's.
+// As with MigrateKeys, an interrupted migration can be resumed by running it
+// again.
+func MigratePrefix(ctx context.Context, from, to Storage, exclude string, dryRun bool) (*MigrateReport, error) {
+	walker, ok := from.(Walker)
+	if !ok {
+		return nil, errors.New("storage backend does not support prefix migration")
+	}
+
+	start := time.Now()
+	report := &MigrateReport{DryRun: dryRun}
+
+	var pending []*ObjectInfo
+	err := walker.Walk(ctx, "", func(obj *ObjectInfo) error {
+		report.Scanned++
+		if exclude != "" && strings.HasPrefix(obj.Key, exclude) {
+			report.Skipped++
+			return nil
+		}
+		pending = append(pending, obj)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan storage: %w", err)
+	}
+
+	for _, obj := range pending {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+
+		if !dryRun {
+			if err := moveBetween(ctx, from, obj.Key, to, obj.Key); err != nil {
+				log.Warn().Err(err).Str("key", obj.Key).Msg("Failed to migrate object")
+				report.Failed++
+				continue
+			}
+		}
+		report.Moved++
+		report.Bytes += obj.Size
+	}
+
+	report.Duration = time.Since(start)
+
+	log.Info().
+		Bool("dry_run", report.DryRun).
+		Int("scanned", report.Scanned).
+		Int("moved", report.Moved).
+		Int("skipped", report.Skipped).
+		Int("failed", report.Failed).
+		Int64("bytes", report.Bytes).
+		Dur("duration", report.Duration).
+		Msg("Storage prefix migration completed")
+
+	return report, nil
+}
+
+// moveObject copies src to dst unless dst already exists, then deletes src
+func moveObject(ctx context.Context, store Storage, src, dst string) error {
+	return moveBetween(ctx, store, src, store, dst)
+}
+
+// moveBetween copies srcKey from src to dstKey in dst unless it already
+// exists there, then deletes it from src
+func moveBetween(ctx context.Context, src Storage, srcKey string, dst Storage, dstKey string) error {
+	exists, err := dst.Exists(ctx, dstKey)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		reader, info, err := src.Get(ctx, srcKey)
+		if err != nil {
+			return err
+		}
+		_, err = dst.Put(WithMetadata(ctx, info.Metadata), dstKey, reader, info.Size, info.ContentType)
+		_ = reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return src.Delete(ctx, srcKey)
+}
+
+// MigrateKey moves one package file to the to layout if it is still stored
+// under the from layout, so a migration can proceed lazily as files are
+// requested. It reports whether the file was moved.
+func MigrateKey(ctx context.Context, store Storage, from, to *KeyLayout, pkg, file string) (bool, error) {
+	src, dst := from.Key(pkg, file), to.Key(pkg, file)
+	if src == dst {
+		return false, nil
+	}
+
+	exists, err := store.Exists(ctx, src)
+	if err != nil || !exists {
+		return false, err
+	}
+	if err := moveObject(ctx, store, src, dst); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MigratePackage moves every file of a package still stored under the from
+// layout to the to layout, returning how many were moved
+func MigratePackage(ctx context.Context, store Storage, from, to *KeyLayout, pkg string) (int, error) {
+	objects, err := PackageObjects(ctx, store, from, pkg)
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, obj := range objects {
+		_, file, _ := from.Parse(obj.Key)
+		if dst := to.Key(pkg, file); dst != obj.Key {
+			if err := moveObject(ctx, store, obj.Key, dst); err != nil {
+				return moved, err
+			}
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// PackageObjects lists a package's files stored under layout. Objects that
+// merely share the prefix, such as another layout's shard directories, are
+// left out.
+func PackageObjects(ctx context.Context, store Storage, layout *KeyLayout, pkg string) ([]*ObjectInfo, error) {
+	objects, err := store.List(ctx, ListOptions{Prefix: layout.PackagePrefix(pkg)})
+	if err != nil {
+		return nil, err
+	}
+
+	matching := objects[:0]
+	for _, obj := range objects {
+		if p, _, ok := layout.Parse(obj.Key); ok && p == pkg {
+			matching = append(matching, obj)
+		}
+	}
+	return matching, nil
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// Move moves src to dst in store, with a rename where the backend has one,
+// and otherwise by copying src, metadata included, and removing it once the
+// copy is stored
+func Move(ctx context.Context, store Storage, src, dst string) error {
+	if renamer, ok := store.(Renamer); ok {
+		if err := renamer.Rename(ctx, src, dst); err != nil {
+			return fmt.Errorf("failed to move %s: %w", src, err)
+		}
+		return nil
+	}
+
+	reader, info, err := store.Get(ctx, src)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", src, err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	size := int64(-1)
+	contentType := "application/octet-stream"
+	if info != nil {
+		size = info.Size
+		if info.ContentType != "" {
+			contentType = info.ContentType
+		}
+		ctx = WithMetadata(ctx, info.Metadata)
+	}
+
+	if _, err := store.Put(ctx, dst, reader, size, contentType); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+
+	if err := store.Delete(ctx, src); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", src, err)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package storage
+
+import "os"
+
+// renameFile moves src over dst; replacing an open file is atomic here
+func renameFile(src, dst string) error {
+	return os.Rename(src, dst)
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// errSharingViolation is ERROR_SHARING_VIOLATION, which syscall does not name
+const errSharingViolation syscall.Errno = 32
+
+// renameFile moves src over dst. Windows refuses to replace a file another
+// handle has open, e.g. one being served or scanned by antivirus, so the
+// rename is retried while those handles close.
+func renameFile(src, dst string) error {
+	delay := 10 * time.Millisecond
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		err := os.Rename(src, dst)
+		if err == nil || !isTransientRenameError(err) || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(delay)
+		delay = min(2*delay, 200*time.Millisecond)
+	}
+}
+
+func isTransientRenameError(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	return errno == syscall.ERROR_ACCESS_DENIED || errno == errSharingViolation
+}
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+)
+
+// Route sends the objects whose file name (the last segment of the key)
+// matches Pattern, a path.Match glob such as "torch-*" or "*.provenance",
+// to Storage
+type Route struct {
+	Pattern string
+	Storage StreamingStorage
+}
+
+// RoutedStorage spreads objects over several backends by file name, e.g.
+// huge ML wheels to a cheaper bucket and metadata documents to a faster
+// one. Each key lives in the backend of the first matching route, or the
+// fallback if none matches; objects stored elsewhere before a route was
+// added are not seen through it.
+type RoutedStorage struct {
+	routes   []Route
+	fallback StreamingStorage
+	backends []StreamingStorage // Each distinct backend once, fallback first
+}
+
+// NewRoutedStorage creates storage routing keys to routes, in order, and
+// everything else to fallback. It owns the backends and closes them.
+func NewRoutedStorage(fallback StreamingStorage, routes []Route) (*RoutedStorage, error) {
+	rs := &RoutedStorage{routes: routes, fallback: fallback, backends: []StreamingStorage{fallback}}
+	for _, route := range routes {
+		if _, err := path.Match(route.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid route pattern %q: %w", route.Pattern, err)
+		}
+		if !rs.hasBackend(route.Storage) {
+			rs.backends = append(rs.backends, route.Storage)
+		}
+	}
+	return rs, nil
+}
+
+func (rs *RoutedStorage) hasBackend(backend StreamingStorage) bool {
+	for _, b := range rs.backends {
+		if b == backend {
+			return true
+		}
+	}
+	return false
+}
+
+// route returns the backend key is kept in
+func (rs *RoutedStorage) route(key string) StreamingStorage {
+	name := path.Base(key)
+	for _, route := range rs.routes {
+		if ok, _ := path.Match(route.Pattern, name); ok {
+			return route.Storage
+		}
+	}
+	return rs.fallback
+}
+
+// OriginKey locates key in the fallback, the default bucket; keys routed
+// to other buckets aren't there
+func (rs *RoutedStorage) OriginKey(ctx context.Context, key string) (string, bool) {
+	origin, ok := rs.fallback.(Origin)
+	if !ok || rs.route(key) != rs.fallback {
+		return "", false
+	}
+	return origin.OriginKey(ctx, key)
+}
+
+func (rs *RoutedStorage) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	return rs.route(key).Get(ctx, key)
+}
+
+func (rs *RoutedStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, *ObjectInfo, error) {
+	return rs.route(key).GetRange(ctx, key, offset, length)
+}
+
+func (rs *RoutedStorage) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (*ObjectInfo, error) {
+	return rs.route(key).Put(ctx, key, reader, size, contentType)
+}
+
+func (rs *RoutedStorage) PutMultipart(ctx context.Context, key string, reader io.Reader, size int64, contentType string, partSize int64) (*ObjectInfo, error) {
+	return rs.route(key).PutMultipart(ctx, key, reader, size, contentType, partSize)
+}
+
+func (rs *RoutedStorage) Delete(ctx context.Context, key string) error {
+	return rs.route(key).Delete(ctx, key)
+}
+
+func (rs *RoutedStorage) Exists(ctx context.Context, key string) (bool, error) {
+	return rs.route(key).Exists(ctx, key)
+}
+
+func (rs *RoutedStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	return rs.route(key).Stat(ctx, key)
+}
+
+// List merges the listings of every backend in key order, leaving out
+// objects a backend holds for keys routed elsewhere
+func (rs *RoutedStorage) List(ctx context.Context, opts ListOptions) ([]*ObjectInfo, error) {
+	var objects []*ObjectInfo
+	for _, backend := range rs.backends {
+		listed, err := backend.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range listed {
+			if rs.route(obj.Key) == backend {
+				objects = append(objects, obj)
+			}
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	if opts.MaxKeys > 0 && len(objects) > opts.MaxKeys {
+		objects = objects[:opts.MaxKeys]
+	}
+	return objects, nil
+}
+
+func (rs *RoutedStorage) GetPresignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return rs.route(key).GetPresignedURL(ctx, key, expiry)
+}
+
+func (rs *RoutedStorage) StreamingPut(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (*ObjectInfo, error) {
+	return rs.route(key).StreamingPut(ctx, key, reader, size, contentType)
+}
+
+func (rs *RoutedStorage) StreamingGet(ctx context.Context, key string, writer io.Writer) (*ObjectInfo, error) {
+	return rs.route(key).StreamingGet(ctx, key, writer)
+}
+
+func (rs *RoutedStorage) GetFilePath(ctx context.Context, key string) (string, error) {
+	return rs.route(key).GetFilePath(ctx, key)
+}
+
+// SupportsZeroCopy reports whether every backend serves from local files
+func (rs *RoutedStorage) SupportsZeroCopy() bool {
+	for _, backend := range rs.backends {
+		if !backend.SupportsZeroCopy() {
+			return false
+		}
+	}
+	return true
+}
+
+// Walk walks every backend, leaving out objects a backend holds for keys
+// routed elsewhere
+func (rs *RoutedStorage) Walk(ctx context.Context, prefix string, fn func(*ObjectInfo) error) error {
+	for _, backend := range rs.backends {
+		walker, ok := backend.(Walker)
+		if !ok {
+			return errors.New("routed storage backend does not support walking")
+		}
+		err := walker.Walk(ctx, prefix, func(obj *ObjectInfo) error {
+			if rs.route(obj.Key) != backend {
+				return nil
+			}
+			return fn(obj)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeletePrefix deletes under prefix in every backend, one object at a time
+// in backends without multi-object deletes
+func (rs *RoutedStorage) DeletePrefix(ctx context.Context, prefix string) (int, int64, error) {
+	var count int
+	var size int64
+	for _, backend := range rs.backends {
+		var n int
+		var bytes int64
+		var err error
+		if deleter, ok := backend.(PrefixDeleter); ok {
+			n, bytes, err = deleter.DeletePrefix(ctx, prefix)
+		} else {
+			n, bytes, err = deleteEach(ctx, backend, prefix)
+		}
+		count += n
+		size += bytes
+		if err != nil {
+			return count, size, err
+		}
+	}
+	return count, size, nil
+}
+
+// deleteEach deletes the objects under prefix one by one
+func deleteEach(ctx context.Context, backend Storage, prefix string) (int, int64, error) {
+	walker, ok := backend.(Walker)
+	if !ok {
+		return 0, 0, errors.New("routed storage backend does not support prefix deletes")
+	}
+	var objects []*ObjectInfo
+	if err := walker.Walk(ctx, prefix, func(obj *ObjectInfo) error {
+		objects = append(objects, obj)
+		return nil
+	}); err != nil {
+		return 0, 0, err
+	}
+
+	var size int64
+	for i, obj := range objects {
+		if err := backend.Delete(ctx, obj.Key); err != nil {
+			return i, size, err
+		}
+		size += obj.Size
+	}
+	return len(objects), size, nil
+}
+
+// CleanupTemp cleans up partial writes in every backend that leaves them
+func (rs *RoutedStorage) CleanupTemp(ctx context.Context, olderThan time.Duration, dryRun bool) (int, int64, error) {
+	var count int
+	var size int64
+	for _, backend := range rs.backends {
+		cleaner, ok := backend.(TempCleaner)
+		if !ok {
+			continue
+		}
+		n, bytes, err := cleaner.CleanupTemp(ctx, olderThan, dryRun)
+		count += n
+		size += bytes
+		if err != nil {
+			return count, size, err
+		}
+	}
+	return count, size, nil
+}
+
+// Close closes every backend
+func (rs *RoutedStorage) Close() error {
+	var errs []error
+	for _, backend := range rs.backends {
+		if err := backend.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRoutedStorage(t *testing.T) {
+	ctx := context.Background()
+	newBackend := func() *LocalStorage {
+		backend, err := NewLocalStorage(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewLocalStorage failed: %v", err)
+		}
+		return backend
+	}
+	fallback, bulk, fast := newBackend(), newBackend(), newBackend()
+
+	rs, err := NewRoutedStorage(fallback, []Route{
+		{Pattern: "torch-*", Storage: bulk},
+		{Pattern: "*.provenance", Storage: fast},
+		{Pattern: "tensorflow-*", Storage: bulk},
+	})
+	if err != nil {
+		t.Fatalf("NewRoutedStorage failed: %v", err)
+	}
+	defer func() { _ = rs.Close() }()
+	if len(rs.backends) != 3 {
+		t.Errorf("Expected each backend once, got %d", len(rs.backends))
+	}
+
+	keys := map[string]*LocalStorage{
+		"packages/torch/torch-2.5.0-cp312-none-linux_x86_64.whl":            bulk,
+		"packages/six/six-1.16.0-py2.py3-none-any.whl.provenance":           fast,
+		"packages/tensorflow/tensorflow-2.18.0-cp312-none-linux_x86_64.whl": bulk,
+		"packages/six/six-1.16.0-py2.py3-none-any.whl":                      fallback,
+	}
+	for key := range keys {
+		if _, err := rs.Put(ctx, key, strings.NewReader(key), int64(len(key)), ""); err != nil {
+			t.Fatalf("Put %s failed: %v", key, err)
+		}
+	}
+
+	for key, want := range keys {
+		for _, backend := range []*LocalStorage{fallback, bulk, fast} {
+			exists, _ := backend.Exists(ctx, key)
+			if exists != (backend == want) {
+				t.Errorf("Expected %s only in its routed backend", key)
+			}
+		}
+		reader, _, err := rs.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get %s failed: %v", key, err)
+		}
+		data, _ := io.ReadAll(reader)
+		_ = reader.Close()
+		if string(data) != key {
+			t.Errorf("Expected %s, got %q", key, data)
+		}
+	}
+
+	// A stray copy in the wrong backend is not listed
+	stray := "packages/torch/torch-2.4.0-cp312-none-linux_x86_64.whl"
+	if _, err := fallback.Put(ctx, stray, strings.NewReader("stray"), 5, ""); err != nil {
+		t.Fatal(err)
+	}
+	var walked []string
+	if err := rs.Walk(ctx, "packages/", func(obj *ObjectInfo) error {
+		walked = append(walked, obj.Key)
+		return nil
+	}); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if len(walked) != len(keys) {
+		t.Errorf("Expected %d objects, got %v", len(keys), walked)
+	}
+
+	count, _, err := rs.DeletePrefix(ctx, "packages/six/")
+	if err != nil || count != 2 {
+		t.Errorf("Expected 2 objects deleted, got %d (%v)", count, err)
+	}
+	if exists, _ := rs.Exists(ctx, "packages/six/six-1.16.0-py2.py3-none-any.whl.provenance"); exists {
+		t.Error("Expected the routed object to be deleted")
+	}
+
+	if _, err := NewRoutedStorage(fallback, []Route{{Pattern: "torch-[", Storage: bulk}}); err == nil {
+		t.Error("Expected an invalid pattern to be rejected")
+	}
+}
+
+// originBackend is local storage standing in for the CDN's origin bucket
+type originBackend struct {
+	*LocalStorage
+}
+
+func (o originBackend) OriginKey(ctx context.Context, key string) (string, bool) {
+	exists, _ := o.Exists(ctx, key)
+	return "prefix/" + key, exists
+}
+
+func TestRoutedStorage_OriginKey(t *testing.T) {
+	ctx := context.Background()
+	fallback, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+	bulk, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+	rs, err := NewRoutedStorage(originBackend{fallback}, []Route{{Pattern: "torch-*", Storage: bulk}})
+	if err != nil {
+		t.Fatalf("NewRoutedStorage failed: %v", err)
+	}
+	defer func() { _ = rs.Close() }()
+
+	six := "packages/six/six-1.16.0-py2.py3-none-any.whl"
+	torch := "packages/torch/torch-2.5.0-cp312-none-linux_x86_64.whl"
+	if _, ok := rs.OriginKey(ctx, six); ok {
+		t.Error("Expected a missing object not at the origin")
+	}
+	for _, key := range []string{six, torch} {
+		if _, err := rs.Put(ctx, key, strings.NewReader("data"), 4, ""); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	if objectKey, ok := rs.OriginKey(ctx, six); !ok || objectKey != "prefix/"+six {
+		t.Errorf("Expected %s at the origin, got %q, %v", six, objectKey, ok)
+	}
+	if _, ok := rs.OriginKey(ctx, torch); ok {
+		t.Error("Expected a routed object not at the origin")
+	}
+}
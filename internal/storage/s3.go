@@ -5,12 +5,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/huyhandes/groxpi/internal/logger"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/phuslu/log"
@@ -35,6 +37,10 @@ type S3Config struct {
 	ConnectTimeout time.Duration
 	RequestTimeout time.Duration
 
+	// Parallel download configuration
+	DownloadPartSize    int64 // Range fetched per request when streaming large objects (default: 16MB)
+	DownloadConcurrency int   // Ranges fetched at once for objects over DownloadPartSize (default: 4, 1 = single GET)
+
 	// Connection pool configuration
 	ReadPoolSize  int  // Max connections for GET operations (default: 50)
 	WritePoolSize int  // Max connections for PUT operations (default: 30)
@@ -46,6 +52,15 @@ type S3Config struct {
 	AsyncWrites    bool // Enable async writes for non-blocking operations (default: true)
 	AsyncWorkers   int  // Number of async write workers (default: 10)
 	AsyncQueueSize int  // Size of async write queue (default: 1000)
+
+	// Existence cache configuration
+	StatCacheTTL         time.Duration // How long HEAD results are reused (0 = disabled)
+	StatCacheNegativeTTL time.Duration // How long a missing object is remembered (0 = not at all)
+	StatCacheSize        int           // Max cached results
+
+	// WrapTransport, if set, wraps the transports of every S3 client, e.g.
+	// to inject faults
+	WrapTransport func(http.RoundTripper) http.RoundTripper
 }
 
 // Adaptive buffer pools for different file sizes to optimize memory usage
@@ -346,6 +361,10 @@ type S3Storage struct {
 	partSize    int64
 	connPool    *S3ConnectionPool
 
+	// Parallel ranged downloads of large objects
+	downloadPartSize    int64
+	downloadConcurrency int
+
 	// Async write queue for non-blocking operations
 	asyncQueue  *AsyncWriteQueue
 	asyncWrites bool
@@ -353,6 +372,8 @@ type S3Storage struct {
 	// Singleflight groups for deduplicating concurrent operations
 	statSF singleflight.Group // For Stat/Exists operations
 	listSF singleflight.Group // For List operations
+
+	stats *statCache // Recent Stat/Exists results (nil = disabled)
 }
 
 // NewS3Storage creates a new S3 storage backend
@@ -364,6 +385,12 @@ func NewS3Storage(cfg *S3Config) (*S3Storage, error) {
 	if cfg.MaxConnections == 0 {
 		cfg.MaxConnections = 100
 	}
+	if cfg.DownloadPartSize == 0 {
+		cfg.DownloadPartSize = 16 * 1024 * 1024 // 16MB default
+	}
+	if cfg.DownloadConcurrency == 0 {
+		cfg.DownloadConcurrency = 4
+	}
 	if cfg.ConnectTimeout == 0 {
 		cfg.ConnectTimeout = 10 * time.Second
 	}
@@ -421,11 +448,15 @@ func NewS3Storage(cfg *S3Config) (*S3Storage, error) {
 
 	// Helper function to create MinIO client with specific transport
 	createClient := func(transport *http.Transport, clientType string) (*minio.Client, error) {
+		var roundTripper http.RoundTripper = transport
+		if cfg.WrapTransport != nil {
+			roundTripper = cfg.WrapTransport(transport)
+		}
 		opts := &minio.Options{
 			Creds:     credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
 			Secure:    cfg.UseSSL,
 			Region:    cfg.Region,
-			Transport: transport,
+			Transport: roundTripper,
 		}
 
 		// Enable path-style addressing for MinIO
@@ -482,6 +513,10 @@ func NewS3Storage(cfg *S3Config) (*S3Storage, error) {
 		partSize:    cfg.PartSize,
 		connPool:    connPool,
 		asyncWrites: cfg.AsyncWrites,
+		stats:       newStatCache(cfg.StatCacheTTL, cfg.StatCacheNegativeTTL, cfg.StatCacheSize),
+
+		downloadPartSize:    cfg.DownloadPartSize,
+		downloadConcurrency: cfg.DownloadConcurrency,
 	}
 
 	// Initialize async write queue if enabled
@@ -501,6 +536,9 @@ func NewS3Storage(cfg *S3Config) (*S3Storage, error) {
 		Bool("async_writes", cfg.AsyncWrites).
 		Int("async_workers", cfg.AsyncWorkers).
 		Int("async_queue_size", cfg.AsyncQueueSize).
+		Int64("download_part_size", cfg.DownloadPartSize).
+		Int("download_concurrency", cfg.DownloadConcurrency).
+		Dur("stat_cache_ttl", cfg.StatCacheTTL).
 		Msg("S3 storage backend initialized successfully with performance optimizations")
 
 	return storage, nil
@@ -581,12 +619,12 @@ func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, *Object
 func (s *S3Storage) getInternal(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
 	fullKey := s.buildKey(key)
 
-	log.Debug().Str("key", key).Str("full_key", fullKey).Msg("Getting object from S3")
+	logger.FromContext(ctx).Debug().Str("key", key).Str("full_key", fullKey).Msg("Getting object from S3")
 
 	// Get object using read-optimized client
 	object, err := s.readClient.GetObject(ctx, s.bucket, fullKey, minio.GetObjectOptions{})
 	if err != nil {
-		log.Error().Err(err).Str("key", key).Msg("Failed to get object")
+		logger.FromContext(ctx).Error().Err(err).Str("key", key).Msg("Failed to get object")
 		return nil, nil, fmt.Errorf("failed to get object %s: %w", key, err)
 	}
 
@@ -594,6 +632,9 @@ func (s *S3Storage) getInternal(ctx context.Context, key string) (io.ReadCloser,
 	stat, err := object.Stat()
 	if err != nil {
 		_ = object.Close()
+		// A cached HEAD result may say otherwise, e.g. after another
+		// instance deleted the object
+		s.stats.invalidate(key)
 		return nil, nil, fmt.Errorf("failed to stat object %s: %w", key, err)
 	}
 
@@ -603,7 +644,7 @@ func (s *S3Storage) getInternal(ctx context.Context, key string) (io.ReadCloser,
 		LastModified: stat.LastModified,
 		ETag:         stat.ETag,
 		ContentType:  stat.ContentType,
-		Metadata:     stat.UserMetadata,
+		Metadata:     normalizeMetadata(stat.UserMetadata),
 	}
 
 	return object, info, nil
@@ -613,7 +654,7 @@ func (s *S3Storage) getInternal(ctx context.Context, key string) (io.ReadCloser,
 func (s *S3Storage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, *ObjectInfo, error) {
 	fullKey := s.buildKey(key)
 
-	log.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("key", key).
 		Str("full_key", fullKey).
 		Int64("offset", offset).
@@ -624,7 +665,7 @@ func (s *S3Storage) GetRange(ctx context.Context, key string, offset, length int
 	if offset >= 0 && length > 0 {
 		// Set the range header for partial content
 		_ = opts.SetRange(offset, offset+length-1)
-		log.Debug().
+		logger.FromContext(ctx).Debug().
 			Int64("range_start", offset).
 			Int64("range_end", offset+length-1).
 			Msg("Setting range header for S3 request")
@@ -632,7 +673,7 @@ func (s *S3Storage) GetRange(ctx context.Context, key string, offset, length int
 
 	object, err := s.readClient.GetObject(ctx, s.bucket, fullKey, opts)
 	if err != nil {
-		log.Error().Err(err).Str("key", key).Msg("Failed to get object range from S3")
+		logger.FromContext(ctx).Error().Err(err).Str("key", key).Msg("Failed to get object range from S3")
 		return nil, nil, fmt.Errorf("failed to get object range %s: %w", key, err)
 	}
 
@@ -641,7 +682,7 @@ func (s *S3Storage) GetRange(ctx context.Context, key string, offset, length int
 	fullObjectInfo, err := s.Stat(ctx, key)
 	if err != nil {
 		_ = object.Close()
-		log.Error().Err(err).Str("key", key).Msg("Failed to get object info for range request")
+		logger.FromContext(ctx).Error().Err(err).Str("key", key).Msg("Failed to get object info for range request")
 		return nil, nil, fmt.Errorf("failed to get object info for range %s: %w", key, err)
 	}
 
@@ -655,7 +696,7 @@ func (s *S3Storage) GetRange(ctx context.Context, key string, offset, length int
 		Metadata:     fullObjectInfo.Metadata,
 	}
 
-	log.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("key", key).
 		Int64("requested_length", length).
 		Int64("object_size", fullObjectInfo.Size).
@@ -708,21 +749,22 @@ func (r *s3BufferedReader) Close() error {
 func (s *S3Storage) putInternal(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (*ObjectInfo, error) {
 	fullKey := s.buildKey(key)
 
-	log.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("key", key).
 		Int64("size", size).
 		Str("content_type", contentType).
 		Msg("Storing object in S3")
 
 	opts := minio.PutObjectOptions{
-		ContentType: contentType,
+		ContentType:  contentType,
+		UserMetadata: metadataFromContext(ctx),
 	}
 
 	// Use optimized multipart for large files
 	if size > s.partSize {
 		partSize := s.calculateOptimalPartSize(size)
 		opts.PartSize = uint64(partSize)
-		log.Debug().
+		logger.FromContext(ctx).Debug().
 			Int64("file_size", size).
 			Int64("part_size", partSize).
 			Msg("Using optimized multipart upload")
@@ -748,13 +790,14 @@ func (s *S3Storage) putInternal(ctx context.Context, key string, reader io.Reade
 
 	start := time.Now()
 	uploadInfo, err := s.writeClient.PutObject(ctx, s.bucket, fullKey, actualReader, size, opts)
+	s.stats.invalidate(key)
 	if err != nil {
-		log.Error().Err(err).Str("key", key).Msg("Failed to put object")
+		logger.FromContext(ctx).Error().Err(err).Str("key", key).Msg("Failed to put object")
 		return nil, fmt.Errorf("failed to put object %s: %w", key, err)
 	}
 
 	duration := time.Since(start)
-	log.Info().
+	logger.FromContext(ctx).Info().
 		Str("key", key).
 		Int64("size", uploadInfo.Size).
 		Str("etag", uploadInfo.ETag).
@@ -819,11 +862,13 @@ func (s *S3Storage) PutMultipart(ctx context.Context, key string, reader io.Read
 	}
 
 	opts := minio.PutObjectOptions{
-		ContentType: contentType,
-		PartSize:    uint64(partSize),
+		ContentType:  contentType,
+		PartSize:     uint64(partSize),
+		UserMetadata: metadataFromContext(ctx),
 	}
 
 	uploadInfo, err := s.writeClient.PutObject(ctx, s.bucket, fullKey, reader, size, opts)
+	s.stats.invalidate(key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to put multipart object %s: %w", key, err)
 	}
@@ -840,68 +885,102 @@ func (s *S3Storage) PutMultipart(ctx context.Context, key string, reader io.Read
 func (s *S3Storage) Delete(ctx context.Context, key string) error {
 	fullKey := s.buildKey(key)
 
-	log.Debug().Str("key", key).Msg("Deleting object from S3")
+	logger.FromContext(ctx).Debug().Str("key", key).Msg("Deleting object from S3")
 
 	err := s.writeClient.RemoveObject(ctx, s.bucket, fullKey, minio.RemoveObjectOptions{})
+	s.stats.invalidate(key)
 	if err != nil {
-		log.Error().Err(err).Str("key", key).Msg("Failed to delete object")
+		logger.FromContext(ctx).Error().Err(err).Str("key", key).Msg("Failed to delete object")
 		return fmt.Errorf("failed to delete object %s: %w", key, err)
 	}
 
-	log.Debug().Str("key", key).Msg("Object deleted successfully")
+	logger.FromContext(ctx).Debug().Str("key", key).Msg("Object deleted successfully")
 	return nil
 }
 
-// Exists checks if an object exists in S3 with singleflight deduplication
-func (s *S3Storage) Exists(ctx context.Context, key string) (bool, error) {
-	// Use singleflight to deduplicate concurrent stat requests
-	result, err, _ := s.statSF.Do("exists:"+key, func() (interface{}, error) {
-		return s.existsInternal(ctx, key)
-	})
-
+// Rename copies src to dst inside the bucket, metadata included, and then
+// deletes src; the data never leaves S3
+func (s *S3Storage) Rename(ctx context.Context, src, dst string) error {
+	_, err := s.writeClient.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucket, Object: s.buildKey(dst)},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: s.buildKey(src)},
+	)
+	s.stats.invalidate(dst)
 	if err != nil {
-		return false, err
+		return fmt.Errorf("failed to copy object %s to %s: %w", src, dst, err)
 	}
-
-	return result.(bool), nil
+	return s.Delete(ctx, src)
 }
 
-// existsInternal performs the actual S3 Exists operation
-func (s *S3Storage) existsInternal(ctx context.Context, key string) (bool, error) {
-	fullKey := s.buildKey(key)
-
-	_, err := s.metaClient.StatObject(ctx, s.bucket, fullKey, minio.StatObjectOptions{})
+// Exists checks if an object exists in S3, sharing HEAD requests and their
+// cached results with Stat
+func (s *S3Storage) Exists(ctx context.Context, key string) (bool, error) {
+	info, err := s.head(ctx, key)
 	if err != nil {
-		errResponse := minio.ToErrorResponse(err)
-		if errResponse.Code == "NoSuchKey" {
-			return false, nil
-		}
-		return false, fmt.Errorf("failed to check object existence %s: %w", key, err)
+		return false, err
 	}
+	return info != nil, nil
+}
 
-	return true, nil
+// OriginKey returns key's object key in the bucket once it exists there
+func (s *S3Storage) OriginKey(ctx context.Context, key string) (string, bool) {
+	if info, err := s.head(ctx, key); err != nil || info == nil {
+		return "", false
+	}
+	return s.buildKey(key), true
 }
 
-// Stat retrieves object metadata without downloading content with singleflight deduplication
+// Stat retrieves object metadata without downloading content, sharing HEAD
+// requests and their cached results with Exists
 func (s *S3Storage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
-	// Use singleflight to deduplicate concurrent stat requests
-	result, err, _ := s.statSF.Do("stat:"+key, func() (interface{}, error) {
-		return s.statInternal(ctx, key)
-	})
-
+	info, err := s.head(ctx, key)
 	if err != nil {
 		return nil, err
 	}
+	if info == nil {
+		return nil, fmt.Errorf("failed to stat object %s: %w", key, fs.ErrNotExist)
+	}
+	return info, nil
+}
 
-	return result.(*ObjectInfo), nil
+// head returns key's metadata, or nil if it doesn't exist. Recent results
+// are served from the stat cache, and concurrent calls for the same key
+// share one HEAD request.
+func (s *S3Storage) head(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, ok := s.stats.get(key)
+	if !ok {
+		token := s.stats.begin()
+		result, err, _ := s.statSF.Do(key, func() (interface{}, error) {
+			info, err := s.statInternal(ctx, key)
+			if err == nil {
+				s.stats.put(key, info, token)
+			}
+			return info, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		info = result.(*ObjectInfo)
+	}
+
+	if info == nil {
+		return nil, nil
+	}
+	// Callers share cached results, so each gets its own copy
+	copied := *info
+	return &copied, nil
 }
 
-// statInternal performs the actual S3 Stat operation
+// statInternal performs the actual S3 HEAD request, returning nil for a
+// missing object
 func (s *S3Storage) statInternal(ctx context.Context, key string) (*ObjectInfo, error) {
 	fullKey := s.buildKey(key)
 
 	stat, err := s.metaClient.StatObject(ctx, s.bucket, fullKey, minio.StatObjectOptions{})
 	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil
+		}
 		return nil, fmt.Errorf("failed to stat object %s: %w", key, err)
 	}
 
@@ -911,7 +990,7 @@ func (s *S3Storage) statInternal(ctx context.Context, key string) (*ObjectInfo,
 		LastModified: stat.LastModified,
 		ETag:         stat.ETag,
 		ContentType:  stat.ContentType,
-		Metadata:     stat.UserMetadata,
+		Metadata:     normalizeMetadata(stat.UserMetadata),
 	}, nil
 }
 
@@ -932,6 +1011,135 @@ func (s *S3Storage) List(ctx context.Context, opts ListOptions) ([]*ObjectInfo,
 	return result.([]*ObjectInfo), nil
 }
 
+// Walk calls fn for every object under prefix using a recursive listing
+func (s *S3Storage) Walk(ctx context.Context, prefix string, fn func(*ObjectInfo) error) error {
+	listOpts := minio.ListObjectsOptions{
+		Prefix:    s.buildKey(prefix),
+		Recursive: true,
+	}
+
+	for object := range s.metaClient.ListObjects(ctx, s.bucket, listOpts) {
+		if object.Err != nil {
+			return fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+
+		err := fn(&ObjectInfo{
+			Key:          strings.TrimPrefix(object.Key, s.prefix+"/"),
+			Size:         object.Size,
+			LastModified: object.LastModified,
+			ETag:         object.ETag,
+			ContentType:  object.ContentType,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// DeletePrefix removes every object under prefix with multi-object delete
+// requests of up to 1000 keys each, rather than one request per object
+func (s *S3Storage) DeletePrefix(ctx context.Context, prefix string) (int, int64, error) {
+	// List everything first so deletes don't disturb the listing
+	var objects []minio.ObjectInfo
+	listOpts := minio.ListObjectsOptions{
+		Prefix:    s.buildKey(prefix),
+		Recursive: true,
+	}
+	for object := range s.metaClient.ListObjects(ctx, s.bucket, listOpts) {
+		if object.Err != nil {
+			return 0, 0, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		objects = append(objects, object)
+	}
+	if len(objects) == 0 {
+		return 0, 0, nil
+	}
+
+	objectsCh := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objectsCh)
+		for _, object := range objects {
+			select {
+			case objectsCh <- object:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// minio-go splits the keys into batches of 1000 and reports only failures
+	failed := make(map[string]bool)
+	var firstErr error
+	for removeErr := range s.writeClient.RemoveObjects(ctx, s.bucket, objectsCh, minio.RemoveObjectsOptions{}) {
+		failed[removeErr.ObjectName] = true
+		if firstErr == nil {
+			firstErr = fmt.Errorf("failed to delete object %s: %w", removeErr.ObjectName, removeErr.Err)
+		}
+	}
+
+	count := 0
+	var size int64
+	for _, object := range objects {
+		s.stats.invalidate(strings.TrimPrefix(object.Key, s.prefix+"/"))
+		if !failed[object.Key] {
+			count++
+			size += object.Size
+		}
+	}
+	if firstErr == nil && ctx.Err() != nil {
+		return count, size, ctx.Err()
+	}
+
+	logger.FromContext(ctx).Debug().
+		Str("prefix", prefix).
+		Int("objects", count).
+		Int("failed", len(failed)).
+		Msg("Deleted objects by prefix")
+
+	return count, size, firstErr
+}
+
+// CleanupTemp aborts incomplete multipart uploads older than olderThan,
+// releasing the storage held by their uploaded parts
+func (s *S3Storage) CleanupTemp(ctx context.Context, olderThan time.Duration, dryRun bool) (int, int64, error) {
+	cutoff := time.Now().Add(-olderThan)
+	count := 0
+	var size int64
+
+	prefix := ""
+	if s.prefix != "" {
+		prefix = s.prefix + "/"
+	}
+
+	for upload := range s.metaClient.ListIncompleteUploads(ctx, s.bucket, prefix, true) {
+		if upload.Err != nil {
+			return count, size, fmt.Errorf("failed to list incomplete uploads: %w", upload.Err)
+		}
+		if upload.Initiated.After(cutoff) {
+			continue // May still be in progress
+		}
+
+		if !dryRun {
+			if err := s.writeClient.RemoveIncompleteUpload(ctx, s.bucket, upload.Key); err != nil {
+				return count, size, fmt.Errorf("failed to abort upload of %s: %w", upload.Key, err)
+			}
+		}
+
+		logger.FromContext(ctx).Debug().
+			Str("key", upload.Key).
+			Time("initiated", upload.Initiated).
+			Bool("dry_run", dryRun).
+			Msg("Aborted incomplete multipart upload")
+
+		count++
+		size += upload.Size
+	}
+
+	return count, size, nil
+}
+
 // listInternal performs the actual S3 List operation
 func (s *S3Storage) listInternal(ctx context.Context, opts ListOptions) ([]*ObjectInfo, error) {
 	prefix := s.buildKey(opts.Prefix)
@@ -981,12 +1189,13 @@ func (s *S3Storage) GetPresignedURL(ctx context.Context, key string, expiry time
 func (s *S3Storage) StreamingPut(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (*ObjectInfo, error) {
 	fullKey := s.buildKey(key)
 
-	log.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("key", key).
 		Str("full_key", fullKey).
 		Int64("size", size).
 		Str("content_type", contentType).
 		Msg("Streaming put to S3")
+	defer s.stats.invalidate(key)
 
 	// Use multipart upload for better streaming performance
 	if size > s.partSize {
@@ -996,7 +1205,8 @@ func (s *S3Storage) StreamingPut(ctx context.Context, key string, reader io.Read
 
 	// For smaller objects, use regular put with buffer optimization
 	opts := minio.PutObjectOptions{
-		ContentType: contentType,
+		ContentType:  contentType,
+		UserMetadata: metadataFromContext(ctx),
 	}
 
 	// Use appropriately sized pooled buffer for streaming
@@ -1020,7 +1230,7 @@ func (s *S3Storage) StreamingPut(ctx context.Context, key string, reader io.Read
 	duration := time.Since(start)
 
 	if err != nil {
-		log.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("key", key).
 			Int64("size", size).
@@ -1029,7 +1239,7 @@ func (s *S3Storage) StreamingPut(ctx context.Context, key string, reader io.Read
 		return nil, fmt.Errorf("failed to put object %s: %w", key, err)
 	}
 
-	log.Info().
+	logger.FromContext(ctx).Info().
 		Str("key", key).
 		Str("etag", info.ETag).
 		Int64("size", info.Size).
@@ -1048,11 +1258,12 @@ func (s *S3Storage) StreamingPut(ctx context.Context, key string, reader io.Read
 // streamingMultipartPut uses multipart upload for large objects
 func (s *S3Storage) streamingMultipartPut(ctx context.Context, fullKey string, reader io.Reader, size int64, contentType string, partSize int64) (*ObjectInfo, error) {
 	opts := minio.PutObjectOptions{
-		ContentType: contentType,
-		PartSize:    uint64(partSize),
+		ContentType:  contentType,
+		PartSize:     uint64(partSize),
+		UserMetadata: metadataFromContext(ctx),
 	}
 
-	log.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("full_key", fullKey).
 		Int64("size", size).
 		Int64("part_size", partSize).
@@ -1063,7 +1274,7 @@ func (s *S3Storage) streamingMultipartPut(ctx context.Context, fullKey string, r
 	duration := time.Since(start)
 
 	if err != nil {
-		log.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("full_key", fullKey).
 			Int64("size", size).
@@ -1072,7 +1283,7 @@ func (s *S3Storage) streamingMultipartPut(ctx context.Context, fullKey string, r
 		return nil, fmt.Errorf("failed multipart upload: %w", err)
 	}
 
-	log.Info().
+	logger.FromContext(ctx).Info().
 		Str("full_key", fullKey).
 		Str("etag", info.ETag).
 		Int64("size", info.Size).
@@ -1091,7 +1302,7 @@ func (s *S3Storage) streamingMultipartPut(ctx context.Context, fullKey string, r
 func (s *S3Storage) StreamingGet(ctx context.Context, key string, writer io.Writer) (*ObjectInfo, error) {
 	fullKey := s.buildKey(key)
 
-	log.Debug().Str("key", key).Str("full_key", fullKey).Msg("Streaming get from S3")
+	logger.FromContext(ctx).Debug().Str("key", key).Str("full_key", fullKey).Msg("Streaming get from S3")
 
 	// Get object info first for metadata using metadata client
 	objInfo, err := s.metaClient.StatObject(ctx, s.bucket, fullKey, minio.StatObjectOptions{})
@@ -1099,30 +1310,22 @@ func (s *S3Storage) StreamingGet(ctx context.Context, key string, writer io.Writ
 		return nil, fmt.Errorf("failed to stat object %s: %w", key, err)
 	}
 
-	// Get object stream using read client
-	object, err := s.readClient.GetObject(ctx, s.bucket, fullKey, minio.GetObjectOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get object %s: %w", key, err)
-	}
-	defer func() {
-		if err := object.Close(); err != nil {
-			// Log error but continue
-			_ = err
-		}
-	}()
-
-	// Use appropriately sized pooled buffer for optimized streaming
-	pool := getOptimalBufferPool(objInfo.Size)
-	copyBufPtr := pool.Get().(*[]byte)
-	defer pool.Put(copyBufPtr)
-	copyBuf := *copyBufPtr
-
 	start := time.Now()
-	written, err := io.CopyBuffer(writer, object, copyBuf)
+	var written int64
+	if s.downloadConcurrency > 1 && objInfo.Size > s.downloadPartSize {
+		// Large objects are fetched as concurrent ranges, which a single
+		// connection can't match on high-latency links
+		written, err = copyRanges(ctx, writer, objInfo.Size, s.downloadPartSize, s.downloadConcurrency,
+			func(ctx context.Context, offset, length int64) ([]byte, error) {
+				return s.getPart(ctx, fullKey, objInfo.ETag, offset, length)
+			})
+	} else {
+		written, err = s.copyObject(ctx, fullKey, objInfo.Size, writer)
+	}
 	duration := time.Since(start)
 
 	if err != nil {
-		log.Error().
+		logger.FromContext(ctx).Error().
 			Err(err).
 			Str("key", key).
 			Int64("bytes_written", written).
@@ -1131,7 +1334,7 @@ func (s *S3Storage) StreamingGet(ctx context.Context, key string, writer io.Writ
 		return nil, fmt.Errorf("failed to stream object %s: %w", key, err)
 	}
 
-	log.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("key", key).
 		Int64("bytes_streamed", written).
 		Dur("duration", duration).
@@ -1147,6 +1350,98 @@ func (s *S3Storage) StreamingGet(ctx context.Context, key string, writer io.Writ
 	}, nil
 }
 
+// copyObject streams an object to writer with a single GET
+func (s *S3Storage) copyObject(ctx context.Context, fullKey string, size int64, writer io.Writer) (int64, error) {
+	object, err := s.readClient.GetObject(ctx, s.bucket, fullKey, minio.GetObjectOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = object.Close() }()
+
+	// Use appropriately sized pooled buffer for optimized streaming
+	pool := getOptimalBufferPool(size)
+	copyBufPtr := pool.Get().(*[]byte)
+	defer pool.Put(copyBufPtr)
+
+	return io.CopyBuffer(writer, object, *copyBufPtr)
+}
+
+// getPart reads one byte range of an object. The range is pinned to etag,
+// so an object replaced mid-download fails instead of being stitched from
+// two versions.
+func (s *S3Storage) getPart(ctx context.Context, fullKey, etag string, offset, length int64) ([]byte, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset+length-1); err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		if err := opts.SetMatchETag(etag); err != nil {
+			return nil, err
+		}
+	}
+
+	object, err := s.readClient.GetObject(ctx, s.bucket, fullKey, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = object.Close() }()
+
+	part := make([]byte, length)
+	if _, err := io.ReadFull(object, part); err != nil {
+		return nil, fmt.Errorf("failed to read range %d-%d: %w", offset, offset+length-1, err)
+	}
+	return part, nil
+}
+
+// copyRanges writes size bytes to writer in order, fetching partSize ranges
+// with up to concurrency fetches in flight. At most concurrency parts are
+// held in memory: the one being written and those fetched ahead of it. The
+// first error stops the copy and cancels the fetches.
+func copyRanges(ctx context.Context, writer io.Writer, size, partSize int64, concurrency int,
+	fetch func(ctx context.Context, offset, length int64) ([]byte, error)) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		data []byte
+		err  error
+	}
+
+	// Parts are queued in order as they are started, so the writer can wait
+	// for each in turn while later ones download
+	queue := make(chan chan result, max(concurrency-1, 0))
+	go func() {
+		defer close(queue)
+		for offset := int64(0); offset < size; offset += partSize {
+			part := make(chan result, 1)
+			select {
+			case queue <- part:
+			case <-ctx.Done():
+				return
+			}
+			length := min(partSize, size-offset)
+			go func(offset int64) {
+				data, err := fetch(ctx, offset, length)
+				part <- result{data: data, err: err}
+			}(offset)
+		}
+	}()
+
+	var written int64
+	for part := range queue {
+		res := <-part
+		if res.err != nil {
+			return written, res.err
+		}
+		n, err := writer.Write(res.data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, ctx.Err()
+}
+
 // GetFilePath returns empty path as S3 doesn't support local file paths
 func (s *S3Storage) GetFilePath(ctx context.Context, key string) (string, error) {
 	return "", fmt.Errorf("S3 storage doesn't support local file paths")
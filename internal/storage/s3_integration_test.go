@@ -15,6 +15,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/huyhandes/groxpi/internal/testsupport"
 )
 
 // TestS3WithMinIO tests basic S3 operations with MinIO
@@ -23,7 +25,7 @@ func TestS3WithMinIO(t *testing.T) {
 		t.Skip("Skipping S3 integration test in short mode")
 	}
 
-	storage := createTestS3Storage(t)
+	storage := createTestS3Storage(t, testsupport.StartMinIO(t))
 	defer func() { _ = storage.Close() }()
 
 	ctx := context.Background()
@@ -63,9 +65,102 @@ func TestS3WithMinIO(t *testing.T) {
 		require.NoError(t, err, "Failed to check existence after delete")
 		assert.False(t, exists, "Object should not exist after deletion")
 	})
+
+	t.Run("parallel_streaming_get", func(t *testing.T) {
+		key := fmt.Sprintf("test/%d.whl", time.Now().UnixNano())
+		content := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+		_, err := storage.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "application/octet-stream")
+		require.NoError(t, err, "Failed to put object")
+		defer func() { _ = storage.Delete(ctx, key) }()
+
+		// Small ranges, so the object is fetched in 10 parts
+		partSize := storage.downloadPartSize
+		storage.downloadPartSize = 16 * 1000
+		defer func() { storage.downloadPartSize = partSize }()
+
+		var out bytes.Buffer
+		info, err := storage.StreamingGet(ctx, key, &out)
+		require.NoError(t, err, "Failed to stream object")
+		assert.Equal(t, int64(len(content)), info.Size)
+		assert.Equal(t, content, out.Bytes())
+	})
+
+	t.Run("delete_prefix", func(t *testing.T) {
+		prefix := fmt.Sprintf("test/%d/", time.Now().UnixNano())
+		for i := 0; i < 3; i++ {
+			key := fmt.Sprintf("%s%d.txt", prefix, i)
+			_, err := storage.Put(ctx, key, strings.NewReader("content"), 7, "text/plain")
+			require.NoError(t, err, "Failed to put object")
+		}
+		other := strings.TrimSuffix(prefix, "/") + "-other.txt"
+		_, err := storage.Put(ctx, other, strings.NewReader("content"), 7, "text/plain")
+		require.NoError(t, err, "Failed to put object")
+		defer func() { _ = storage.Delete(ctx, other) }()
+
+		// Cache an answer the delete has to invalidate
+		exists, err := storage.Exists(ctx, prefix+"0.txt")
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		count, size, err := storage.DeletePrefix(ctx, prefix)
+		require.NoError(t, err, "Failed to delete by prefix")
+		assert.Equal(t, 3, count)
+		assert.Equal(t, int64(21), size)
+
+		exists, err = storage.Exists(ctx, prefix+"0.txt")
+		require.NoError(t, err)
+		assert.False(t, exists, "Object should not exist after deletion")
+		exists, err = storage.Exists(ctx, other)
+		require.NoError(t, err)
+		assert.True(t, exists, "Objects outside the prefix should be kept")
+	})
 }
 
 // TestS3WithRealClients tests that real package managers work with S3 backend
+// TestTieredStorageWithMinIO tests that tiered storage writes through to S3
+// and refills its local cache from it
+func TestTieredStorageWithMinIO(t *testing.T) {
+	minio := testsupport.StartMinIO(t)
+	ctx := context.Background()
+
+	ts, err := NewTieredStorage(&TieredConfig{
+		LocalCacheDir:  t.TempDir(),
+		LocalCacheSize: 10 * 1024 * 1024,
+		S3Config:       testS3Config(minio),
+	})
+	require.NoError(t, err, "Failed to create tiered storage")
+	defer func() { _ = ts.Close() }()
+
+	key := "packages/six/six-1.16.0-py2.py3-none-any.whl"
+	content := []byte("six wheel contents")
+	_, err = ts.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "application/octet-stream")
+	require.NoError(t, err, "Failed to put object")
+	assert.Contains(t, minio.Keys(t), key, "Expected the object in S3")
+
+	// Lose the local copy; reads fall back to S3 and refill L1
+	require.NoError(t, ts.localCache.Delete(ctx, key))
+	reader, _, err := ts.Get(ctx, key)
+	require.NoError(t, err, "Failed to get object from L2")
+	data, err := io.ReadAll(reader)
+	_ = reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+
+	require.Eventually(t, func() bool {
+		exists, _ := ts.localCache.Exists(ctx, key)
+		return exists
+	}, 10*time.Second, 50*time.Millisecond, "Expected L1 to be refilled from S3")
+
+	reader, _, err = ts.GetRange(ctx, key, 4, 5)
+	require.NoError(t, err, "Failed to get range")
+	data, _ = io.ReadAll(reader)
+	_ = reader.Close()
+	assert.Equal(t, "wheel", string(data))
+
+	require.NoError(t, ts.Delete(ctx, key))
+	assert.NotContains(t, minio.Keys(t), key, "Expected the object removed from S3")
+}
+
 func TestS3WithRealClients(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping S3 client integration test in short mode")
@@ -76,6 +171,8 @@ func TestS3WithRealClients(t *testing.T) {
 		t.Skip("Skipping S3 client integration test: TEST_S3_ENDPOINT not set")
 	}
 
+	minio := testsupport.StartMinIO(t)
+
 	// Check if groxpi binary exists or build it
 	groxpiBinary := buildGroxpiBinary(t)
 
@@ -83,7 +180,7 @@ func TestS3WithRealClients(t *testing.T) {
 	testDir := t.TempDir()
 
 	// Start groxpi server with S3 backend
-	server := startGroxpiServer(t, groxpiBinary)
+	server := startGroxpiServer(t, groxpiBinary, minio)
 	defer server.Stop()
 
 	// Wait for server to be ready
@@ -98,24 +195,26 @@ func TestS3WithRealClients(t *testing.T) {
 	})
 
 	t.Run("verify_s3_storage", func(t *testing.T) {
-		verifyS3Storage(t)
+		verifyS3Storage(t, minio)
 	})
 }
 
-// createTestS3Storage creates an S3 storage instance for testing with MinIO defaults
-func createTestS3Storage(t *testing.T) *S3Storage {
-	endpoint := getEnvOrDefault("TEST_S3_ENDPOINT", "localhost:9000")
-	accessKey := getEnvOrDefault("TEST_S3_ACCESS_KEY", "minioadmin")
-	secretKey := getEnvOrDefault("TEST_S3_SECRET_KEY", "minioadmin")
-	bucket := getEnvOrDefault("TEST_S3_BUCKET", "groxpi-test")
-
-	cfg := &S3Config{
-		Endpoint:        endpoint,
-		AccessKeyID:     accessKey,
-		SecretAccessKey: secretKey,
-		Region:          "us-east-1",
-		Bucket:          bucket,
-		Prefix:          "client-test",
+// createTestS3Storage creates an S3 storage instance on the test's MinIO
+func createTestS3Storage(t *testing.T, minio *testsupport.MinIO) *S3Storage {
+	storage, err := NewS3Storage(testS3Config(minio))
+	require.NoError(t, err, "Failed to create S3 storage")
+	return storage
+}
+
+// testS3Config returns the S3 settings for the test's MinIO
+func testS3Config(minio *testsupport.MinIO) *S3Config {
+	return &S3Config{
+		Endpoint:        minio.Endpoint,
+		AccessKeyID:     minio.AccessKey,
+		SecretAccessKey: minio.SecretKey,
+		Region:          minio.Region,
+		Bucket:          minio.Bucket,
+		Prefix:          minio.Prefix,
 		UseSSL:          false,
 		ForcePathStyle:  true,
 		PartSize:        5 * 1024 * 1024,
@@ -123,16 +222,6 @@ func createTestS3Storage(t *testing.T) *S3Storage {
 		ConnectTimeout:  30 * time.Second,
 		RequestTimeout:  5 * time.Minute,
 	}
-
-	storage, err := NewS3Storage(cfg)
-	if err != nil {
-		if strings.Contains(err.Error(), "connection refused") {
-			t.Skipf("MinIO not available, skipping S3 integration test: %v", err)
-		}
-		require.NoError(t, err, "Failed to create S3 storage")
-	}
-
-	return storage
 }
 
 // buildGroxpiBinary builds the groxpi binary if it doesn't exist
@@ -166,15 +255,15 @@ func (gs *groxpiServer) Stop() {
 }
 
 // startGroxpiServer starts groxpi with S3 backend configuration
-func startGroxpiServer(t *testing.T, groxpiBinary string) *groxpiServer {
+func startGroxpiServer(t *testing.T, groxpiBinary string, minio *testsupport.MinIO) *groxpiServer {
 	cmd := exec.Command(groxpiBinary)
 	cmd.Env = append(os.Environ(),
 		"GROXPI_STORAGE_TYPE=s3",
-		"AWS_ENDPOINT_URL=http://127.0.0.1:9000",
-		"AWS_ACCESS_KEY_ID=minioadmin",
-		"AWS_SECRET_ACCESS_KEY=minioadmin",
-		"GROXPI_S3_BUCKET=groxpi-test",
-		"GROXPI_S3_PREFIX=client-test",
+		"AWS_ENDPOINT_URL=http://"+minio.Endpoint,
+		"AWS_ACCESS_KEY_ID="+minio.AccessKey,
+		"AWS_SECRET_ACCESS_KEY="+minio.SecretKey,
+		"GROXPI_S3_BUCKET="+minio.Bucket,
+		"GROXPI_S3_PREFIX="+minio.Prefix,
 		"GROXPI_S3_USE_SSL=false",
 		"GROXPI_S3_FORCE_PATH_STYLE=true",
 		"GROXPI_LOGGING_LEVEL=INFO",
@@ -259,8 +348,8 @@ func testUVAdd(t *testing.T, testDir string) {
 }
 
 // verifyS3Storage verifies that packages are actually stored in S3
-func verifyS3Storage(t *testing.T) {
-	storage := createTestS3Storage(t)
+func verifyS3Storage(t *testing.T, minio *testsupport.MinIO) {
+	storage := createTestS3Storage(t, minio)
 	defer func() { _ = storage.Close() }()
 
 	ctx := context.Background()
@@ -280,11 +369,3 @@ func verifyS3Storage(t *testing.T) {
 		t.Logf("  - %s (size: %d)", obj.Key, obj.Size)
 	}
 }
-
-// getEnvOrDefault returns environment variable value or default
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
@@ -1,7 +1,12 @@
 package storage
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -188,3 +193,47 @@ func TestS3Storage_CalculateOptimalPartSize_Performance(t *testing.T) {
 	t.Logf("Calculated part size for %dMB file: %dMB",
 		fileSize/(1024*1024), results[0]/(1024*1024))
 }
+
+// TestCopyRanges tests that ranges fetched concurrently are written in order
+func TestCopyRanges(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	var inFlight, maxInFlight atomic.Int64
+	fetch := func(ctx context.Context, offset, length int64) ([]byte, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			peak := maxInFlight.Load()
+			if n <= peak || maxInFlight.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+		// Later parts finish first
+		time.Sleep(time.Duration(1000-offset) * time.Microsecond)
+		return data[offset : offset+length], nil
+	}
+
+	var out bytes.Buffer
+	written, err := copyRanges(context.Background(), &out, int64(len(data)), 64, 4, fetch)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), written)
+	assert.Equal(t, data, out.Bytes())
+	assert.LessOrEqual(t, maxInFlight.Load(), int64(4))
+
+	t.Run("error", func(t *testing.T) {
+		failing := func(ctx context.Context, offset, length int64) ([]byte, error) {
+			if offset == 256 {
+				return nil, errors.New("connection reset")
+			}
+			return data[offset : offset+length], nil
+		}
+		var out bytes.Buffer
+		written, err := copyRanges(context.Background(), &out, int64(len(data)), 64, 4, failing)
+		assert.Error(t, err)
+		assert.Equal(t, int64(256), written)
+		assert.Equal(t, data[:256], out.Bytes())
+	})
+}
@@ -0,0 +1,34 @@
+//go:build darwin || freebsd
+
+package storage
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// sendfile performs the actual sendfile syscall. Unlike Linux, the BSD
+// wrappers leave offset alone, so it is advanced here.
+func (l *LocalStorage) sendfile(dst, src int, size int64) error {
+	var offset int64 = 0
+	remaining := size
+
+	for remaining > 0 {
+		n, err := syscall.Sendfile(dst, src, &offset, int(remaining))
+		if err != nil && n == 0 {
+			if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK {
+				continue // Retry on would-block
+			}
+			return fmt.Errorf("sendfile failed: %w", err)
+		}
+
+		if n == 0 {
+			break // EOF
+		}
+
+		remaining -= int64(n)
+		offset += int64(n)
+	}
+
+	return nil
+}
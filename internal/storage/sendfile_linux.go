@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// sendfile performs the actual sendfile syscall. Linux advances offset
+// itself.
+func (l *LocalStorage) sendfile(dst, src int, size int64) error {
+	var offset int64 = 0
+	remaining := size
+
+	for remaining > 0 {
+		n, err := syscall.Sendfile(dst, src, &offset, int(remaining))
+		if err != nil {
+			if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK {
+				continue // Retry on would-block
+			}
+			return fmt.Errorf("sendfile failed: %w", err)
+		}
+
+		if n == 0 {
+			break // EOF
+		}
+
+		remaining -= int64(n)
+	}
+
+	return nil
+}
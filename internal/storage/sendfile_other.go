@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package storage
+
+import "errors"
+
+// sendfile is unavailable on this platform; callers fall back to copying
+func (l *LocalStorage) sendfile(dst, src int, size int64) error {
+	return errors.New("sendfile not supported on this platform")
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// statCache remembers recent HEAD results so a hot file doesn't cost an S3
+// request on every download. Misses are remembered too, for a shorter time,
+// since another instance sharing the bucket may store the object meanwhile.
+// A nil statCache caches nothing.
+type statCache struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	negativeTTL time.Duration
+	maxEntries  int
+	entries     map[string]*list.Element
+	order       *list.List // Most recently used first
+	generation  uint64     // Bumped by every invalidation
+	now         func() time.Time
+}
+
+type statEntry struct {
+	key     string
+	info    *ObjectInfo // nil = the object doesn't exist
+	expires time.Time
+}
+
+// newStatCache returns a cache of up to maxEntries results, or nil when ttl
+// or maxEntries is not positive. Misses are kept for negativeTTL (not at
+// all if it is not positive).
+func newStatCache(ttl, negativeTTL time.Duration, maxEntries int) *statCache {
+	if ttl <= 0 || maxEntries <= 0 {
+		return nil
+	}
+	return &statCache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		maxEntries:  maxEntries,
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+		now:         time.Now,
+	}
+}
+
+// get returns the cached result for key: ok reports whether there is one,
+// and a nil info means the object is known not to exist
+func (c *statCache) get(key string) (info *ObjectInfo, ok bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*statEntry)
+	if c.now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.info, true
+}
+
+// begin returns the token to pass to put for a lookup starting now
+func (c *statCache) begin() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// put caches the result of a lookup started at token (nil info for a
+// missing object). It is dropped if any key was invalidated meanwhile, as
+// the lookup may predate that write.
+func (c *statCache) put(key string, info *ObjectInfo, token uint64) {
+	if c == nil || (info == nil && c.negativeTTL <= 0) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if token != c.generation {
+		return
+	}
+	ttl := c.ttl
+	if info == nil {
+		ttl = c.negativeTTL
+	}
+	entry := &statEntry{key: key, info: info, expires: c.now().Add(ttl)}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+// invalidate forgets key, after it was written or deleted
+func (c *statCache) invalidate(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// remove drops elem; c.mu must be held
+func (c *statCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*statEntry).key)
+}
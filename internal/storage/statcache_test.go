@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatCache_TTLs(t *testing.T) {
+	c := newStatCache(time.Minute, time.Second, 10)
+	now := time.Unix(1700000000, 0)
+	c.now = func() time.Time { return now }
+
+	c.put("packages/a/a-1.0.tar.gz", &ObjectInfo{Size: 1}, c.begin())
+	c.put("packages/b/b-1.0.tar.gz", nil, c.begin())
+
+	if info, ok := c.get("packages/a/a-1.0.tar.gz"); !ok || info.Size != 1 {
+		t.Errorf("Expected a cached hit, got %+v %v", info, ok)
+	}
+	if info, ok := c.get("packages/b/b-1.0.tar.gz"); !ok || info != nil {
+		t.Errorf("Expected a cached miss, got %+v %v", info, ok)
+	}
+
+	// Misses expire sooner than hits
+	now = now.Add(2 * time.Second)
+	if _, ok := c.get("packages/b/b-1.0.tar.gz"); ok {
+		t.Error("Expected the miss to expire after the negative TTL")
+	}
+	if _, ok := c.get("packages/a/a-1.0.tar.gz"); !ok {
+		t.Error("Expected the hit to outlive the negative TTL")
+	}
+	now = now.Add(time.Minute)
+	if _, ok := c.get("packages/a/a-1.0.tar.gz"); ok {
+		t.Error("Expected the hit to expire after the TTL")
+	}
+}
+
+func TestStatCache_Invalidate(t *testing.T) {
+	c := newStatCache(time.Minute, time.Minute, 10)
+
+	c.put("packages/a/a-1.0.tar.gz", nil, c.begin())
+	c.invalidate("packages/a/a-1.0.tar.gz")
+	if _, ok := c.get("packages/a/a-1.0.tar.gz"); ok {
+		t.Error("Expected a write to invalidate the cached miss")
+	}
+
+	// A lookup that raced with a write must not cache its stale answer
+	token := c.begin()
+	c.invalidate("packages/a/a-1.0.tar.gz")
+	c.put("packages/a/a-1.0.tar.gz", nil, token)
+	if _, ok := c.get("packages/a/a-1.0.tar.gz"); ok {
+		t.Error("Expected a lookup predating a write to be dropped")
+	}
+}
+
+func TestStatCache_Bounded(t *testing.T) {
+	c := newStatCache(time.Minute, time.Minute, 2)
+
+	c.put("a", &ObjectInfo{}, c.begin())
+	c.put("b", &ObjectInfo{}, c.begin())
+	c.get("a")
+	c.put("c", &ObjectInfo{}, c.begin())
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := c.get(key); ok != want {
+			t.Errorf("Expected cached(%s) = %v", key, want)
+		}
+	}
+	if len(c.entries) != 2 {
+		t.Errorf("Expected 2 entries, got %d", len(c.entries))
+	}
+}
+
+func TestStatCache_Disabled(t *testing.T) {
+	for _, c := range []*statCache{newStatCache(0, time.Second, 10), newStatCache(time.Minute, time.Second, 0)} {
+		if c != nil {
+			t.Fatal("Expected no cache without a TTL or size")
+		}
+		c.put("a", &ObjectInfo{}, c.begin())
+		c.invalidate("a")
+		if _, ok := c.get("a"); ok {
+			t.Error("Expected a disabled cache to cache nothing")
+		}
+	}
+
+	// Without a negative TTL, misses are not cached
+	c := newStatCache(time.Minute, 0, 10)
+	c.put("a", nil, c.begin())
+	if _, ok := c.get("a"); ok {
+		t.Errorf("Expected misses not to be cached, got %d entries", len(c.entries))
+	}
+}
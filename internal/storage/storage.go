@@ -4,6 +4,8 @@ import (
 	"context"
 	"io"
 	"time"
+
+	"github.com/huyhandes/groxpi/internal/catalog"
 )
 
 // ObjectInfo contains metadata about a stored object
@@ -56,6 +58,15 @@ type Storage interface {
 	Close() error
 }
 
+// Origin is implemented by backends that keep objects in S3, so a CDN
+// fronting the default bucket can serve them
+type Origin interface {
+	// OriginKey returns the object key key is stored under in the default
+	// bucket, and false when it isn't there: routed to another bucket, or
+	// not uploaded yet
+	OriginKey(ctx context.Context, key string) (string, bool)
+}
+
 // StreamingStorage extends Storage with streaming-specific methods
 type StreamingStorage interface {
 	Storage
@@ -73,6 +84,97 @@ type StreamingStorage interface {
 	SupportsZeroCopy() bool
 }
 
+// AccessTracker is implemented by backends that track per-object access
+// times for eviction (local LRU storage and the L1 tier of hybrid storage)
+type AccessTracker interface {
+	// LastAccessed returns when key was last read or written, if tracked
+	LastAccessed(key string) (time.Time, bool)
+}
+
+// EvictionNotifier is implemented by backends that evict objects on their
+// own to stay under a size limit (local LRU storage and the L1 tier of
+// hybrid storage)
+type EvictionNotifier interface {
+	// OnEvict registers fn to be called after an object is evicted
+	OnEvict(fn func(key string, size int64))
+}
+
+// EvictionPrioritizer is implemented by backends that evict on their own
+// and can be told which objects to give up first
+type EvictionPrioritizer interface {
+	// PrioritizeEviction registers fn to pick, from the keys currently held,
+	// those to evict before falling back to least recently used order
+	PrioritizeEviction(fn func(keys []string) map[string]bool)
+}
+
+// Pinner is implemented by backends that evict on their own. Objects read
+// through Get and StreamingGet are pinned automatically; Pin covers readers
+// that open a file by its path.
+type Pinner interface {
+	// Pin exempts key from eviction until the returned function is called
+	Pin(key string) (unpin func())
+}
+
+// EvictionExcluder is implemented by backends that evict on their own and
+// can leave keys under a prefix alone, e.g. the trash, which has its own
+// retention
+type EvictionExcluder interface {
+	// ExcludeFromEviction stops counting keys under prefix against the size
+	// limit and never evicts them
+	ExcludeFromEviction(prefix string)
+}
+
+// Renamer is implemented by backends that can move an object to another key
+// without copying its data through groxpi: a file rename on local disk, a
+// server-side copy in S3
+type Renamer interface {
+	// Rename moves src and its metadata to dst, replacing dst
+	Rename(ctx context.Context, src, dst string) error
+}
+
+// Cataloger is implemented by backends whose bookkeeping (access times, hit
+// counts) otherwise lives in memory only: local LRU storage and the L1 tier
+// of hybrid storage
+type Cataloger interface {
+	// UseCatalog records accesses in c and restores them from it
+	UseCatalog(c *catalog.Catalog) error
+}
+
+// Cache tiers an object can be served from
+const (
+	TierLocal  = "L1" // Local disk or memory
+	TierRemote = "L2" // S3 or WebDAV
+)
+
+// Locator is implemented by backends made of several cache tiers
+type Locator interface {
+	// Locate returns the tier key is served from, TierLocal or TierRemote
+	Locate(ctx context.Context, key string) string
+}
+
+// Walker is implemented by backends that can enumerate every stored object
+// under a prefix, unlike List which only returns a single level
+type Walker interface {
+	// Walk calls fn for each object under prefix; returning an error from fn stops the walk
+	Walk(ctx context.Context, prefix string, fn func(*ObjectInfo) error) error
+}
+
+// PrefixDeleter is implemented by backends that can delete many objects
+// in one request, such as S3's multi-object delete
+type PrefixDeleter interface {
+	// DeletePrefix removes every object under prefix and returns how many
+	// were removed and their total size
+	DeletePrefix(ctx context.Context, prefix string) (int, int64, error)
+}
+
+// TempCleaner is implemented by backends that can leave partial writes
+// behind after a crash (temp files, incomplete multipart uploads)
+type TempCleaner interface {
+	// CleanupTemp removes partial writes older than olderThan and returns how
+	// many were found and their size. With dryRun nothing is removed.
+	CleanupTemp(ctx context.Context, olderThan time.Duration, dryRun bool) (int, int64, error)
+}
+
 // StorageType represents the type of storage backend
 type StorageType string
 
@@ -1,12 +1,17 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/huyhandes/groxpi/internal/catalog"
+	"github.com/huyhandes/groxpi/internal/logger"
 	"github.com/phuslu/log"
 	"golang.org/x/sync/semaphore"
 	"golang.org/x/sync/singleflight"
@@ -18,6 +23,20 @@ type TieredStorage struct {
 	remoteStorage StreamingStorage // L2 cache - persistent S3 storage
 	syncQueue     *TieredSyncQueue // Async queue for L1 cache population
 	sf            singleflight.Group
+
+	// rangeCache keeps small byte ranges of objects missing from L1, such
+	// as the central directories lazy importers read from giant wheels, so
+	// repeated reads don't go to L2 (nil = disabled)
+	rangeCache     *LRULocalStorage
+	rangeMaxLength int64
+}
+
+// rangeCacheDir holds the range cache inside the L1 cache directory
+const rangeCacheDir = ".ranges"
+
+// rangeKey names the cached range of key at offset with length
+func rangeKey(key string, offset, length int64) string {
+	return key + "/" + strconv.FormatInt(offset, 10) + "-" + strconv.FormatInt(length, 10)
 }
 
 // TieredSyncRequest represents a pending L1 cache population request
@@ -135,7 +154,7 @@ func (tsq *TieredSyncQueue) SubmitSync(ctx context.Context, key string) <-chan e
 		resultCh <- ctx.Err()
 	default:
 		// Queue full, skip async sync (not critical)
-		log.Warn().Str("key", key).Msg("Tiered sync queue is full, skipping L1 population")
+		logger.FromContext(ctx).Warn().Str("key", key).Msg("Tiered sync queue is full, skipping L1 population")
 		resultCh <- fmt.Errorf("sync queue is full")
 	}
 
@@ -163,12 +182,31 @@ type TieredConfig struct {
 	LocalCacheSize int64
 	LocalCacheTTL  time.Duration // TTL for local cache entries (0 = disabled)
 
+	// EvictionGrace exempts L1 objects written less than this long ago from
+	// eviction (0 = disabled)
+	EvictionGrace time.Duration
+
+	// LocalWritePolicy resolves overlapping writes of the same key in L1
+	LocalWritePolicy WritePolicy
+
+	// LocalEncryptionKey, if set, encrypts files cached in L1 with AES-256
+	LocalEncryptionKey []byte
+
 	// S3 (L2) configuration
 	S3Config *S3Config
 
+	// Remote, if set, is used as L2 instead of a bucket opened from
+	// S3Config, e.g. storage routing files over several buckets. The tiered
+	// storage owns it, closing it on Close or if it can't be created.
+	Remote StreamingStorage
+
 	// Sync queue configuration
 	SyncWorkers   int // Number of workers for L1 population (default: 5)
 	SyncQueueSize int // Size of sync queue (default: 100)
+
+	// Range cache configuration
+	RangeCacheSize      int64 // Size limit for cached byte ranges (0 = disabled)
+	RangeCacheMaxLength int64 // Longest range cached
 }
 
 // NewTieredStorage creates a new tiered storage backend
@@ -187,13 +225,30 @@ func NewTieredStorage(cfg *TieredConfig) (*TieredStorage, error) {
 	// Create local storage with LRU eviction (L1 cache)
 	localStorage, err := NewLRULocalStorage(cfg.LocalCacheDir, cfg.LocalCacheSize, cfg.LocalCacheTTL)
 	if err != nil {
+		if cfg.Remote != nil {
+			_ = cfg.Remote.Close()
+		}
 		return nil, fmt.Errorf("failed to create local storage: %w", err)
 	}
+	localStorage.UseWritePolicy(cfg.LocalWritePolicy)
+	localStorage.SetEvictionGrace(cfg.EvictionGrace)
+	if cfg.LocalEncryptionKey != nil {
+		if err := localStorage.UseEncryption(cfg.LocalEncryptionKey); err != nil {
+			_ = localStorage.Close()
+			if cfg.Remote != nil {
+				_ = cfg.Remote.Close()
+			}
+			return nil, err
+		}
+	}
 
 	// Create S3 storage (L2 cache)
-	s3Storage, err := NewS3Storage(cfg.S3Config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create S3 storage: %w", err)
+	s3Storage := cfg.Remote
+	if s3Storage == nil {
+		s3Storage, err = NewS3Storage(cfg.S3Config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create S3 storage: %w", err)
+		}
 	}
 
 	// Create tiered storage
@@ -202,6 +257,20 @@ func NewTieredStorage(cfg *TieredConfig) (*TieredStorage, error) {
 		remoteStorage: s3Storage,
 	}
 
+	if cfg.RangeCacheSize > 0 && cfg.RangeCacheMaxLength > 0 {
+		ts.rangeCache, err = NewLRULocalStorage(filepath.Join(cfg.LocalCacheDir, rangeCacheDir), cfg.RangeCacheSize, cfg.LocalCacheTTL)
+		if err != nil {
+			_ = localStorage.Close()
+			_ = s3Storage.Close()
+			return nil, fmt.Errorf("failed to create range cache: %w", err)
+		}
+		if cfg.LocalEncryptionKey != nil {
+			// The key was already checked for L1
+			_ = ts.rangeCache.UseEncryption(cfg.LocalEncryptionKey)
+		}
+		ts.rangeMaxLength = cfg.RangeCacheMaxLength
+	}
+
 	// Initialize sync queue
 	ts.syncQueue = NewTieredSyncQueue(ts, cfg.SyncQueueSize, cfg.SyncWorkers)
 
@@ -214,6 +283,8 @@ func NewTieredStorage(cfg *TieredConfig) (*TieredStorage, error) {
 		Str("s3_bucket", cfg.S3Config.Bucket).
 		Int("sync_workers", cfg.SyncWorkers).
 		Int("sync_queue_size", cfg.SyncQueueSize).
+		Int64("range_cache_size_bytes", cfg.RangeCacheSize).
+		Int64("range_cache_max_length", cfg.RangeCacheMaxLength).
 		Msg("Tiered storage initialized successfully")
 
 	return ts, nil
@@ -224,16 +295,16 @@ func (ts *TieredStorage) Get(ctx context.Context, key string) (io.ReadCloser, *O
 	// Try L1 (local) cache first
 	reader, info, err := ts.localCache.Get(ctx, key)
 	if err == nil {
-		log.Debug().Str("key", key).Msg("✅ Tiered storage: L1 hit (local)")
+		logger.FromContext(ctx).Debug().Str("key", key).Msg("✅ Tiered storage: L1 hit (local)")
 		return reader, info, nil
 	}
 
 	// L1 miss, try L2 (S3) cache
-	log.Debug().Str("key", key).Msg("🔍 Tiered storage: L1 miss, checking L2 (S3)")
+	logger.FromContext(ctx).Debug().Str("key", key).Msg("🔍 Tiered storage: L1 miss, checking L2 (S3)")
 
 	reader, info, err = ts.remoteStorage.Get(ctx, key)
 	if err == nil {
-		log.Info().Str("key", key).Msg("✅ Tiered storage: L2 hit (S3), populating L1 async")
+		logger.FromContext(ctx).Info().Str("key", key).Msg("✅ Tiered storage: L2 hit (S3), populating L1 async")
 
 		// Asynchronously populate L1 cache for future requests
 		// Don't block current request on L1 population
@@ -250,7 +321,7 @@ func (ts *TieredStorage) Get(ctx context.Context, key string) (io.ReadCloser, *O
 	}
 
 	// Both L1 and L2 miss
-	log.Debug().Str("key", key).Msg("❌ Tiered storage: L1 and L2 miss")
+	logger.FromContext(ctx).Debug().Str("key", key).Msg("❌ Tiered storage: L1 and L2 miss")
 	return nil, nil, fmt.Errorf("object not found in tiered storage: %s", key)
 }
 
@@ -259,19 +330,33 @@ func (ts *TieredStorage) GetRange(ctx context.Context, key string, offset, lengt
 	// Try L1 (local) cache first
 	reader, info, err := ts.localCache.GetRange(ctx, key, offset, length)
 	if err == nil {
-		log.Debug().Str("key", key).Msg("✅ Tiered storage range: L1 hit (local)")
+		logger.FromContext(ctx).Debug().Str("key", key).Msg("✅ Tiered storage range: L1 hit (local)")
 		return reader, info, nil
 	}
 
-	// L1 miss, try L2 (S3) cache
-	log.Debug().Str("key", key).Msg("🔍 Tiered storage range: L1 miss, checking L2 (S3)")
+	// L1 miss, try the range cache
+	cacheable := ts.cachesRange(offset, length)
+	if cacheable {
+		reader, info, err = ts.rangeCache.Get(ctx, rangeKey(key, offset, length))
+		if err == nil {
+			logger.FromContext(ctx).Debug().Str("key", key).Int64("offset", offset).Int64("length", length).Msg("✅ Tiered storage range: range cache hit")
+			info.Key = key
+			return reader, info, nil
+		}
+	}
+
+	// Try L2 (S3) cache
+	logger.FromContext(ctx).Debug().Str("key", key).Msg("🔍 Tiered storage range: L1 miss, checking L2 (S3)")
 
 	reader, info, err = ts.remoteStorage.GetRange(ctx, key, offset, length)
 	if err == nil {
-		log.Debug().Str("key", key).Msg("✅ Tiered storage range: L2 hit (S3)")
+		logger.FromContext(ctx).Debug().Str("key", key).Msg("✅ Tiered storage range: L2 hit (S3)")
 
-		// For range requests, we don't populate L1 cache
-		// Only full file downloads populate L1 cache
+		// Ranges don't populate L1, only full file downloads do. Small
+		// ones are kept in the range cache instead.
+		if cacheable {
+			return ts.cacheRange(ctx, key, offset, length, reader, info)
+		}
 		return reader, info, nil
 	}
 
@@ -279,6 +364,51 @@ func (ts *TieredStorage) GetRange(ctx context.Context, key string, offset, lengt
 	return nil, nil, fmt.Errorf("object not found in tiered storage: %s", key)
 }
 
+// cachesRange reports whether a range of length bytes at offset goes in the
+// range cache
+func (ts *TieredStorage) cachesRange(offset, length int64) bool {
+	return ts.rangeCache != nil && offset >= 0 && length > 0 && length <= ts.rangeMaxLength
+}
+
+// cacheRange reads a range from L2 into memory and stores it in the range
+// cache, returning a reader over it. Failing to store it is non-fatal.
+func (ts *TieredStorage) cacheRange(ctx context.Context, key string, offset, length int64, reader io.ReadCloser, info *ObjectInfo) (io.ReadCloser, *ObjectInfo, error) {
+	defer func() { _ = reader.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(reader, length))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read range of %s: %w", key, err)
+	}
+
+	if _, err := ts.rangeCache.Put(WithMetadata(ctx, info.Metadata), rangeKey(key, offset, length), bytes.NewReader(data), int64(len(data)), info.ContentType); err != nil {
+		logger.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("Failed to store range in range cache")
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), info, nil
+}
+
+// dropRanges removes the cached ranges of every object under prefix, so
+// rewritten or deleted objects aren't served stale
+func (ts *TieredStorage) dropRanges(ctx context.Context, prefix string) {
+	if ts.rangeCache == nil {
+		return
+	}
+
+	var keys []string
+	err := ts.rangeCache.Walk(ctx, prefix, func(obj *ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	})
+	for _, key := range keys {
+		if err := ts.rangeCache.Delete(ctx, key); err != nil {
+			logger.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("Failed to delete from range cache")
+		}
+	}
+	if err != nil {
+		logger.FromContext(ctx).Warn().Err(err).Str("prefix", prefix).Msg("Failed to list cached ranges for deletion")
+	}
+}
+
 // Put stores an object in both L1 and L2 concurrently
 func (ts *TieredStorage) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (*ObjectInfo, error) {
 	// Use singleflight to prevent duplicate concurrent puts
@@ -295,6 +425,8 @@ func (ts *TieredStorage) Put(ctx context.Context, key string, reader io.Reader,
 
 // putInternal performs the actual concurrent put to both L1 and L2
 func (ts *TieredStorage) putInternal(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (*ObjectInfo, error) {
+	ts.dropRanges(ctx, key)
+
 	// Create pipes for concurrent writes to both L1 and L2
 	pr1, pw1 := io.Pipe()
 	pr2, pw2 := io.Pipe()
@@ -317,7 +449,7 @@ func (ts *TieredStorage) putInternal(ctx context.Context, key string, reader io.
 		multiWriter := io.MultiWriter(pw1, pw2)
 		_, err := io.Copy(multiWriter, reader)
 		if err != nil {
-			log.Error().Err(err).Str("key", key).Msg("Failed to read source data")
+			logger.FromContext(ctx).Error().Err(err).Str("key", key).Msg("Failed to read source data")
 		}
 	}()
 
@@ -338,15 +470,15 @@ func (ts *TieredStorage) putInternal(ctx context.Context, key string, reader io.
 
 	// L2 (S3) is primary - if it fails, the operation fails
 	if l2Err != nil {
-		log.Error().Err(l2Err).Str("key", key).Msg("Failed to write to L2 (S3)")
+		logger.FromContext(ctx).Error().Err(l2Err).Str("key", key).Msg("Failed to write to L2 (S3)")
 		return nil, fmt.Errorf("failed to write to L2 storage: %w", l2Err)
 	}
 
 	// L1 failure is non-fatal (just log warning)
 	if l1Err != nil {
-		log.Warn().Err(l1Err).Str("key", key).Msg("Failed to write to L1 (local), but L2 (S3) succeeded")
+		logger.FromContext(ctx).Warn().Err(l1Err).Str("key", key).Msg("Failed to write to L1 (local), but L2 (S3) succeeded")
 	} else {
-		log.Debug().Str("key", key).Msg("✅ Successfully wrote to both L1 and L2")
+		logger.FromContext(ctx).Debug().Str("key", key).Msg("✅ Successfully wrote to both L1 and L2")
 	}
 
 	// Return L2 info as the authoritative source
@@ -357,18 +489,20 @@ func (ts *TieredStorage) putInternal(ctx context.Context, key string, reader io.
 func (ts *TieredStorage) PutMultipart(ctx context.Context, key string, reader io.Reader, size int64, contentType string, partSize int64) (*ObjectInfo, error) {
 	// For multipart uploads, only write to L2 (S3) initially
 	// L1 cache will be populated on first read
-	log.Debug().
+	logger.FromContext(ctx).Debug().
 		Str("key", key).
 		Int64("size", size).
 		Int64("part_size", partSize).
 		Msg("Tiered storage: Multipart upload to L2 only")
 
+	ts.dropRanges(ctx, key)
+
 	info, err := ts.remoteStorage.PutMultipart(ctx, key, reader, size, contentType, partSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed multipart upload to L2: %w", err)
 	}
 
-	log.Info().
+	logger.FromContext(ctx).Info().
 		Str("key", key).
 		Int64("size", size).
 		Msg("✅ Multipart upload to L2 succeeded, L1 will be populated on first read")
@@ -380,6 +514,8 @@ func (ts *TieredStorage) PutMultipart(ctx context.Context, key string, reader io
 func (ts *TieredStorage) Delete(ctx context.Context, key string) error {
 	var l1Err, l2Err error
 
+	ts.dropRanges(ctx, key)
+
 	// Delete from both caches concurrently
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -398,13 +534,13 @@ func (ts *TieredStorage) Delete(ctx context.Context, key string) error {
 
 	// L2 is primary - if it fails, the operation fails
 	if l2Err != nil {
-		log.Error().Err(l2Err).Str("key", key).Msg("Failed to delete from L2 (S3)")
+		logger.FromContext(ctx).Error().Err(l2Err).Str("key", key).Msg("Failed to delete from L2 (S3)")
 		return fmt.Errorf("failed to delete from L2 storage: %w", l2Err)
 	}
 
 	// L1 failure is non-fatal
 	if l1Err != nil {
-		log.Warn().Err(l1Err).Str("key", key).Msg("Failed to delete from L1, but L2 succeeded")
+		logger.FromContext(ctx).Warn().Err(l1Err).Str("key", key).Msg("Failed to delete from L1, but L2 succeeded")
 	}
 
 	return nil
@@ -422,6 +558,16 @@ func (ts *TieredStorage) Exists(ctx context.Context, key string) (bool, error) {
 	return ts.remoteStorage.Exists(ctx, key)
 }
 
+// OriginKey locates key in L2. A file just written to L1 isn't there until
+// it has been uploaded.
+func (ts *TieredStorage) OriginKey(ctx context.Context, key string) (string, bool) {
+	origin, ok := ts.remoteStorage.(Origin)
+	if !ok {
+		return "", false
+	}
+	return origin.OriginKey(ctx, key)
+}
+
 // Stat retrieves object metadata from L1 or L2
 func (ts *TieredStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
 	// Try L1 first
@@ -457,16 +603,16 @@ func (ts *TieredStorage) StreamingGet(ctx context.Context, key string, writer io
 	// Try L1 first (supports zero-copy)
 	info, err := ts.localCache.StreamingGet(ctx, key, writer)
 	if err == nil {
-		log.Debug().Str("key", key).Msg("✅ Tiered streaming get: L1 hit (local, zero-copy)")
+		logger.FromContext(ctx).Debug().Str("key", key).Msg("✅ Tiered streaming get: L1 hit (local, zero-copy)")
 		return info, nil
 	}
 
 	// L1 miss, try L2
-	log.Debug().Str("key", key).Msg("🔍 Tiered streaming get: L1 miss, streaming from L2 (S3)")
+	logger.FromContext(ctx).Debug().Str("key", key).Msg("🔍 Tiered streaming get: L1 miss, streaming from L2 (S3)")
 
 	info, err = ts.remoteStorage.StreamingGet(ctx, key, writer)
 	if err == nil {
-		log.Info().Str("key", key).Msg("✅ Tiered streaming get: L2 hit (S3), populating L1 async")
+		logger.FromContext(ctx).Info().Str("key", key).Msg("✅ Tiered streaming get: L2 hit (S3), populating L1 async")
 
 		// Asynchronously populate L1 cache for future requests
 		go func() {
@@ -488,6 +634,121 @@ func (ts *TieredStorage) GetFilePath(ctx context.Context, key string) (string, e
 	return ts.localCache.GetFilePath(ctx, key)
 }
 
+// Locate reports whether key is served from L1 or has to come from L2
+func (ts *TieredStorage) Locate(ctx context.Context, key string) string {
+	if exists, _ := ts.localCache.Exists(ctx, key); exists {
+		return TierLocal
+	}
+	return TierRemote
+}
+
+// Walk enumerates objects in L2 (authoritative source)
+func (ts *TieredStorage) Walk(ctx context.Context, prefix string, fn func(*ObjectInfo) error) error {
+	walker, ok := ts.remoteStorage.(Walker)
+	if !ok {
+		return fmt.Errorf("L2 storage does not support walking")
+	}
+	return walker.Walk(ctx, prefix, fn)
+}
+
+// DeletePrefix removes every object under prefix from both tiers, in bulk
+// on L2
+func (ts *TieredStorage) DeletePrefix(ctx context.Context, prefix string) (int, int64, error) {
+	deleter, ok := ts.remoteStorage.(PrefixDeleter)
+	if !ok {
+		return 0, 0, fmt.Errorf("L2 storage does not support bulk deletes")
+	}
+
+	ts.dropRanges(ctx, prefix)
+
+	// L1 failures are non-fatal, as with Delete
+	if walker, ok := ts.localCache.(Walker); ok {
+		var keys []string
+		err := walker.Walk(ctx, prefix, func(obj *ObjectInfo) error {
+			keys = append(keys, obj.Key)
+			return nil
+		})
+		for _, key := range keys {
+			if err := ts.localCache.Delete(ctx, key); err != nil {
+				logger.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("Failed to delete from L1")
+			}
+		}
+		if err != nil {
+			logger.FromContext(ctx).Warn().Err(err).Str("prefix", prefix).Msg("Failed to list L1 objects for deletion")
+		}
+	}
+
+	return deleter.DeletePrefix(ctx, prefix)
+}
+
+// CleanupTemp removes partial writes from both tiers
+func (ts *TieredStorage) CleanupTemp(ctx context.Context, olderThan time.Duration, dryRun bool) (int, int64, error) {
+	count := 0
+	var size int64
+
+	for _, backend := range []Storage{ts.localCache, ts.remoteStorage} {
+		cleaner, ok := backend.(TempCleaner)
+		if !ok {
+			continue
+		}
+		n, bytes, err := cleaner.CleanupTemp(ctx, olderThan, dryRun)
+		count += n
+		size += bytes
+		if err != nil {
+			return count, size, err
+		}
+	}
+
+	return count, size, nil
+}
+
+// LastAccessed returns the L1 access time for key
+func (ts *TieredStorage) LastAccessed(key string) (time.Time, bool) {
+	if tracker, ok := ts.localCache.(AccessTracker); ok {
+		return tracker.LastAccessed(key)
+	}
+	return time.Time{}, false
+}
+
+// Pin exempts key from L1 eviction until the returned function is called
+func (ts *TieredStorage) Pin(key string) (unpin func()) {
+	if pinner, ok := ts.localCache.(Pinner); ok {
+		return pinner.Pin(key)
+	}
+	return func() {}
+}
+
+// OnEvict registers fn to be called after L1 evicts an object. The object
+// stays available from L2.
+func (ts *TieredStorage) OnEvict(fn func(key string, size int64)) {
+	if notifier, ok := ts.localCache.(EvictionNotifier); ok {
+		notifier.OnEvict(fn)
+	}
+}
+
+// PrioritizeEviction registers fn to pick objects L1 evicts before LRU order
+func (ts *TieredStorage) PrioritizeEviction(fn func(keys []string) map[string]bool) {
+	if prioritizer, ok := ts.localCache.(EvictionPrioritizer); ok {
+		prioritizer.PrioritizeEviction(fn)
+	}
+}
+
+// ExcludeFromEviction keeps L1 objects under prefix out of its size limit
+// and eviction
+func (ts *TieredStorage) ExcludeFromEviction(prefix string) {
+	if excluder, ok := ts.localCache.(EvictionExcluder); ok {
+		excluder.ExcludeFromEviction(prefix)
+	}
+}
+
+// UseCatalog persists L1 access times and hit counts in c
+func (ts *TieredStorage) UseCatalog(c *catalog.Catalog) error {
+	if cataloger, ok := ts.localCache.(Cataloger); ok {
+		return cataloger.UseCatalog(c)
+	}
+	return nil
+}
+
 // SupportsZeroCopy indicates if L1 supports zero-copy operations
 func (ts *TieredStorage) SupportsZeroCopy() bool {
 	return ts.localCache.SupportsZeroCopy()
@@ -513,6 +774,12 @@ func (ts *TieredStorage) Close() error {
 		l2Err = ts.remoteStorage.Close()
 	}
 
+	if ts.rangeCache != nil {
+		if err := ts.rangeCache.Close(); err != nil {
+			log.Error().Err(err).Msg("Failed to close range cache")
+		}
+	}
+
 	// Return first error encountered
 	if l1Err != nil {
 		return l1Err
@@ -530,7 +797,7 @@ func (ts *TieredStorage) populateLocalCache(ctx context.Context, key string) err
 	// Check if already in L1
 	exists, err := ts.localCache.Exists(ctx, key)
 	if err == nil && exists {
-		log.Debug().Str("key", key).Msg("Object already in L1 cache, skipping population")
+		logger.FromContext(ctx).Debug().Str("key", key).Msg("Object already in L1 cache, skipping population")
 		return nil
 	}
 
@@ -541,13 +808,13 @@ func (ts *TieredStorage) populateLocalCache(ctx context.Context, key string) err
 	}
 	defer func() { _ = reader.Close() }()
 
-	// Write to L1
-	_, err = ts.localCache.Put(ctx, key, reader, info.Size, info.ContentType)
+	// Write to L1, keeping the object's metadata
+	_, err = ts.localCache.Put(WithMetadata(ctx, info.Metadata), key, reader, info.Size, info.ContentType)
 	if err != nil {
 		return fmt.Errorf("failed to populate L1 cache: %w", err)
 	}
 
-	log.Info().
+	logger.FromContext(ctx).Info().
 		Str("key", key).
 		Int64("size", info.Size).
 		Msg("✅ Successfully populated L1 cache from L2")
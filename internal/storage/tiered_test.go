@@ -6,8 +6,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/huyhandes/groxpi/internal/catalog"
 )
 
 // TestTieredStorage_BasicOperations tests basic tiered storage operations
@@ -93,6 +96,203 @@ func TestLRUCache(t *testing.T) {
 	})
 }
 
+func TestLRUCache_OnEvict(t *testing.T) {
+	lru := NewLRUCache(t.TempDir(), 1024, 0)
+	defer func() { _ = lru.Close() }()
+
+	evicted := make(chan string, 3)
+	lru.OnEvict(func(key string, size int64) {
+		if size != 400 {
+			t.Errorf("Expected evicted size 400, got %d", size)
+		}
+		evicted <- key
+	})
+
+	_ = lru.RecordAccess("oldest", 400)
+	_ = lru.RecordAccess("middle", 400)
+	_ = lru.RecordAccess("newest", 400)
+
+	select {
+	case key := <-evicted:
+		if key != "oldest" {
+			t.Errorf("Expected least recently used entry evicted, got %q", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Eviction handler not called")
+	}
+}
+
+func TestLRUCache_PrioritizeEviction(t *testing.T) {
+	lru := NewLRUCache(t.TempDir(), 1024, 0)
+	defer func() { _ = lru.Close() }()
+
+	lru.PrioritizeEviction(func(keys []string) map[string]bool {
+		return map[string]bool{"superseded": true}
+	})
+	evicted := make(chan string, 3)
+	lru.OnEvict(func(key string, size int64) { evicted <- key })
+
+	_ = lru.RecordAccess("oldest", 400)
+	_ = lru.RecordAccess("superseded", 400)
+	_ = lru.RecordAccess("newest", 400)
+
+	select {
+	case key := <-evicted:
+		if key != "superseded" {
+			t.Errorf("Expected prioritized entry evicted before LRU order, got %q", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Eviction handler not called")
+	}
+	if _, ok := lru.LastAccessed("oldest"); !ok {
+		t.Error("Expected least recently used entry kept once under the limit")
+	}
+}
+
+func TestLRUCache_Pin(t *testing.T) {
+	lru := NewLRUCache(t.TempDir(), 1024, 0)
+	defer func() { _ = lru.Close() }()
+
+	evicted := make(chan string, 3)
+	lru.OnEvict(func(key string, size int64) { evicted <- key })
+
+	_ = lru.RecordAccess("oldest", 400)
+	unpinOldest := lru.Pin("oldest")
+	_ = lru.RecordAccess("middle", 400)
+	_ = lru.RecordAccess("newest", 400)
+
+	select {
+	case key := <-evicted:
+		if key != "middle" {
+			t.Errorf("Expected the pinned entry skipped, got %q evicted", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Eviction handler not called")
+	}
+
+	// Over the limit with every entry pinned: nothing is evicted
+	defer lru.Pin("newest")()
+	defer lru.Pin("newer")()
+	_ = lru.RecordAccess("newer", 400)
+	select {
+	case key := <-evicted:
+		t.Errorf("Expected pinned entries kept, got %q evicted", key)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unpinOldest()
+	unpinOldest() // Unpinning twice releases one pin only
+	select {
+	case key := <-evicted:
+		if key != "oldest" {
+			t.Errorf("Expected the unpinned entry evicted, got %q", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected eviction once the entry was unpinned")
+	}
+}
+
+func TestLRUCache_Grace(t *testing.T) {
+	lru := NewLRUCache(t.TempDir(), 1024, 0)
+	defer func() { _ = lru.Close() }()
+	lru.SetGrace(time.Hour)
+
+	evicted := make(chan string, 3)
+	lru.OnEvict(func(key string, size int64) { evicted <- key })
+
+	_ = lru.RecordAccess("oldest", 400)
+	_ = lru.RecordAccess("middle", 400)
+	_ = lru.RecordAccess("newest", 400)
+
+	select {
+	case key := <-evicted:
+		t.Errorf("Expected entries written within the grace period kept, got %q evicted", key)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	lru.SetGrace(0)
+	_ = lru.RecordAccess("newer", 100)
+	select {
+	case key := <-evicted:
+		if key != "oldest" {
+			t.Errorf("Expected least recently used entry evicted, got %q", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected eviction once the grace period was over")
+	}
+}
+
+func TestLRULocalStorage_UseCatalog(t *testing.T) {
+	baseDir := t.TempDir()
+	dbPath := filepath.Join(t.TempDir(), "catalog.db")
+	ctx := context.Background()
+
+	open := func() (*LRULocalStorage, *catalog.Catalog) {
+		store, err := NewLRULocalStorage(baseDir, 0, 0)
+		if err != nil {
+			t.Fatalf("NewLRULocalStorage failed: %v", err)
+		}
+		c, err := catalog.Open(dbPath)
+		if err != nil {
+			t.Fatalf("catalog.Open failed: %v", err)
+		}
+		if err := store.UseCatalog(c); err != nil {
+			t.Fatalf("UseCatalog failed: %v", err)
+		}
+		return store, c
+	}
+
+	store, c := open()
+	putCtx := WithMetadata(ctx, map[string]string{MetaSHA256: "abc123"})
+	for _, key := range []string{"packages/a/a-1.0.tar.gz", "packages/b/b-1.0.tar.gz", "packages/c/c-1.0.tar.gz"} {
+		if _, err := store.Put(putCtx, key, strings.NewReader("data"), 4, ""); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	reader, _, err := store.Get(ctx, "packages/a/a-1.0.tar.gz")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	_ = reader.Close()
+	accessed, _ := store.LastAccessed("packages/a/a-1.0.tar.gz")
+	_ = store.Close()
+	_ = c.Close()
+
+	// A file removed while groxpi is down
+	if err := os.Remove(filepath.Join(baseDir, "packages/c/c-1.0.tar.gz")); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+
+	store, c = open()
+	defer func() {
+		_ = store.Close()
+		_ = c.Close()
+	}()
+
+	// Access times survive the restart instead of coming from modification times
+	if got, _ := store.LastAccessed("packages/a/a-1.0.tar.gz"); got.Sub(accessed).Abs() > time.Second {
+		t.Errorf("Expected restored access time %v, got %v", accessed, got)
+	}
+	if back := store.lruCache.lruList.Back().Value.(*LRUEntry); back.Key != "packages/b/b-1.0.tar.gz" {
+		t.Errorf("Expected the unread file to be evicted first, got %q", back.Key)
+	}
+
+	e, ok := c.Get("packages/a/a-1.0.tar.gz")
+	if !ok || e.Hits != 1 || e.SHA256 != "abc123" || e.Size != 4 {
+		t.Errorf("Unexpected catalog entry %+v", e)
+	}
+	if _, ok := c.Get("packages/c/c-1.0.tar.gz"); ok {
+		t.Error("Expected the entry of the removed file to be dropped")
+	}
+
+	if err := store.Delete(ctx, "packages/b/b-1.0.tar.gz"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if stats := c.Stats(); stats.Objects != 1 {
+		t.Errorf("Expected 1 object left in the catalog, got %+v", stats)
+	}
+}
+
 // TestLRULocalStorage tests LRU local storage wrapper
 func TestLRULocalStorage(t *testing.T) {
 	baseDir := t.TempDir()
@@ -169,6 +369,32 @@ func TestLRULocalStorage(t *testing.T) {
 		}
 	})
 
+	t.Run("zero-copy path records access", func(t *testing.T) {
+		testData := []byte("zero-copy access tracking")
+		if _, err := storage.Put(ctx, "test/zero-copy.txt", bytes.NewReader(testData), int64(len(testData)), "text/plain"); err != nil {
+			t.Fatalf("Failed to put file: %v", err)
+		}
+
+		written, ok := storage.LastAccessed("test/zero-copy.txt")
+		if !ok {
+			t.Fatal("Expected access time after put")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		if _, err := storage.GetFilePath(ctx, "test/zero-copy.txt"); err != nil {
+			t.Fatalf("Failed to get file path: %v", err)
+		}
+
+		accessed, _ := storage.LastAccessed("test/zero-copy.txt")
+		if !accessed.After(written) {
+			t.Errorf("Expected GetFilePath to update access time (written %v, accessed %v)", written, accessed)
+		}
+
+		if _, ok := storage.LastAccessed("test/missing.txt"); ok {
+			t.Error("Expected no access time for untracked key")
+		}
+	})
+
 	t.Run("rebuild from existing files", func(t *testing.T) {
 		// Create some files directly in the directory
 		testFile := filepath.Join(baseDir, "rebuild-test.txt")
@@ -236,3 +462,113 @@ func TestTieredStorage_ConcurrentAccess(t *testing.T) {
 		<-done
 	}
 }
+
+// countingRanges counts the range reads reaching a backend
+type countingRanges struct {
+	*LocalStorage
+	ranges int
+}
+
+func (c *countingRanges) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, *ObjectInfo, error) {
+	c.ranges++
+	return c.LocalStorage.GetRange(ctx, key, offset, length)
+}
+
+// TestTieredStorage_RangeCache tests that small ranges of L2 objects are
+// served from the range cache once read
+func TestTieredStorage_RangeCache(t *testing.T) {
+	ctx := context.Background()
+	localDir := t.TempDir()
+
+	remote, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create L2 storage: %v", err)
+	}
+	l2 := &countingRanges{LocalStorage: remote}
+	l1, err := NewLRULocalStorage(localDir, 1024*1024, 0)
+	if err != nil {
+		t.Fatalf("Failed to create L1 storage: %v", err)
+	}
+	ranges, err := NewLRULocalStorage(filepath.Join(localDir, rangeCacheDir), 1024*1024, 0)
+	if err != nil {
+		t.Fatalf("Failed to create range cache: %v", err)
+	}
+	ts := &TieredStorage{localCache: l1, remoteStorage: l2, rangeCache: ranges, rangeMaxLength: 16}
+	defer func() { _ = ts.Close() }()
+
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	if _, err := remote.Put(ctx, "packages/big.whl", bytes.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+		t.Fatalf("Failed to put object: %v", err)
+	}
+
+	readRange := func(offset, length int64) string {
+		t.Helper()
+		reader, _, err := ts.GetRange(ctx, "packages/big.whl", offset, length)
+		if err != nil {
+			t.Fatalf("GetRange(%d, %d) failed: %v", offset, length, err)
+		}
+		defer func() { _ = reader.Close() }()
+		got, _ := io.ReadAll(reader)
+		return string(got)
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := readRange(26, 10); got != "qrstuvwxyz" {
+			t.Fatalf("Expected tail range, got %q", got)
+		}
+	}
+	if l2.ranges != 1 {
+		t.Errorf("Expected one L2 read for a repeated small range, got %d", l2.ranges)
+	}
+
+	// Ranges over the cap always go to L2
+	readRange(0, 20)
+	readRange(0, 20)
+	if l2.ranges != 3 {
+		t.Errorf("Expected large ranges to bypass the range cache, got %d L2 reads", l2.ranges)
+	}
+
+	// The L1 cache doesn't count cached ranges as objects
+	if err := l1.Walk(ctx, "", func(obj *ObjectInfo) error {
+		t.Errorf("Unexpected L1 object %s", obj.Key)
+		return nil
+	}); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+
+	// Rewriting the object drops its cached ranges
+	ts.dropRanges(ctx, "packages/big.whl")
+	readRange(26, 10)
+	if l2.ranges != 4 {
+		t.Errorf("Expected dropped range to be read from L2 again, got %d L2 reads", l2.ranges)
+	}
+}
+
+func TestTieredStorage_Locate(t *testing.T) {
+	ctx := context.Background()
+	l1, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create L1 storage: %v", err)
+	}
+	l2, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create L2 storage: %v", err)
+	}
+	ts := &TieredStorage{localCache: l1, remoteStorage: l2}
+	defer func() { _ = ts.Close() }()
+
+	data := []byte("wheel")
+	if _, err := l2.Put(ctx, "packages/six.whl", bytes.NewReader(data), int64(len(data)), ""); err != nil {
+		t.Fatalf("Failed to put object: %v", err)
+	}
+	if tier := ts.Locate(ctx, "packages/six.whl"); tier != TierRemote {
+		t.Errorf("Expected %s before the file is copied to L1, got %s", TierRemote, tier)
+	}
+
+	if _, err := l1.Put(ctx, "packages/six.whl", bytes.NewReader(data), int64(len(data)), ""); err != nil {
+		t.Fatalf("Failed to put object: %v", err)
+	}
+	if tier := ts.Locate(ctx, "packages/six.whl"); tier != TierLocal {
+		t.Errorf("Expected %s, got %s", TierLocal, tier)
+	}
+}
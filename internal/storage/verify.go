@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// ErrDigestMismatch is returned by a reader from Verify whose bytes don't
+// hash to the expected SHA-256
+var ErrDigestMismatch = errors.New("file does not match its SHA-256")
+
+// Verify returns a reader of r that fails with ErrDigestMismatch unless the
+// bytes read hash to sha256Hex, so a Put of a bad copy is abandoned rather
+// than committed. With a known size, the digest is checked by the read that
+// completes it, whose bytes are withheld on a mismatch: backends that read
+// exactly size bytes, like S3 uploads of small files, never reach EOF. A
+// size of -1 is checked at EOF.
+func Verify(r io.Reader, size int64, sha256Hex string) io.Reader {
+	return &verifyingReader{r: r, hash: sha256.New(), want: strings.ToLower(sha256Hex), size: size}
+}
+
+type verifyingReader struct {
+	r    io.Reader
+	hash hash.Hash
+	want string
+	size int64 // Declared length, -1 if unknown
+	read int64
+	err  error // Set once the copy was found bad
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	n, err := v.r.Read(p)
+	v.hash.Write(p[:n])
+	v.read += int64(n)
+	switch {
+	case v.size >= 0 && v.read > v.size:
+		v.err = fmt.Errorf("%w: longer than the %d bytes announced", ErrDigestMismatch, v.size)
+	case v.size >= 0 && v.read == v.size, err == io.EOF:
+		if hex.EncodeToString(v.hash.Sum(nil)) != v.want {
+			v.err = ErrDigestMismatch
+		}
+	}
+	if v.err != nil {
+		return 0, v.err
+	}
+	return n, err
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	sum := sha256.Sum256([]byte("six wheel"))
+	digest := hex.EncodeToString(sum[:])
+
+	for _, size := range []int64{-1, 9} {
+		if data, err := io.ReadAll(Verify(strings.NewReader("six wheel"), size, strings.ToUpper(digest))); err != nil || string(data) != "six wheel" {
+			t.Errorf("Size %d: expected matching bytes to read through, got %q, %v", size, data, err)
+		}
+		if _, err := io.ReadAll(Verify(strings.NewReader("six whee!"), size, digest)); !errors.Is(err, ErrDigestMismatch) {
+			t.Errorf("Size %d: expected ErrDigestMismatch, got %v", size, err)
+		}
+	}
+
+	// Readers of exactly the announced length never see EOF; the last read
+	// fails instead of handing over the bad bytes
+	buf := make([]byte, 9)
+	if _, err := io.ReadFull(Verify(strings.NewReader("six whee!"), 9, digest), buf); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected ErrDigestMismatch through io.ReadFull, got %v", err)
+	}
+	if _, err := io.ReadAll(Verify(strings.NewReader("six wheel!"), 9, digest)); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected a copy longer than announced rejected, got %v", err)
+	}
+	if _, err := io.ReadAll(Verify(strings.NewReader("six"), 9, digest)); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected a copy shorter than announced rejected, got %v", err)
+	}
+}
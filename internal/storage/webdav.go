@@ -0,0 +1,630 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/logger"
+)
+
+// WebDAVConfig holds WebDAV storage configuration
+type WebDAVConfig struct {
+	URL      string // Collection objects are stored under, e.g. https://nas.example.com/dav/groxpi/
+	Username string
+	Password string
+
+	// Transport, if set, carries the requests, e.g. to inject faults
+	Transport http.RoundTripper
+}
+
+// WebDAVStorage implements StreamingStorage on a WebDAV collection, for
+// sites whose only shared storage is a NAS. Writes upload to a temp name and
+// MOVE it into place, so readers never see a partial file; metadata is kept
+// in sidecar files under .meta/ like local storage.
+type WebDAVStorage struct {
+	base     *url.URL // Always ends with "/"
+	username string
+	password string
+	client   *http.Client
+
+	collections sync.Map // Collections known to exist, by path relative to base
+}
+
+// NewWebDAVStorage creates a WebDAV storage backend, creating the base
+// collection if needed
+func NewWebDAVStorage(cfg *WebDAVConfig) (*WebDAVStorage, error) {
+	base, err := url.Parse(cfg.URL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid WebDAV URL %q", cfg.URL)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		base.RawPath = ""
+	}
+
+	transport := cfg.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	w := &WebDAVStorage{
+		base:     base,
+		username: cfg.Username,
+		password: cfg.Password,
+		client:   &http.Client{Transport: transport},
+	}
+
+	// Fail at startup rather than on the first download if the server is
+	// unreachable or rejects the credentials
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := w.mkcol(ctx, ""); err != nil {
+		return nil, fmt.Errorf("failed to open WebDAV collection: %w", err)
+	}
+	return w, nil
+}
+
+// url returns the URL of key, a path relative to the base collection
+func (w *WebDAVStorage) url(key string) string {
+	return w.base.JoinPath(key).String()
+}
+
+func (w *WebDAVStorage) do(ctx context.Context, method, key string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, w.url(key), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if w.username != "" || w.password != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	return w.client.Do(req)
+}
+
+// drain discards the rest of a response so its connection can be reused
+func drain(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	_ = resp.Body.Close()
+}
+
+func statusError(method, key string, resp *http.Response) error {
+	return fmt.Errorf("WebDAV %s %s: %s", method, key, resp.Status)
+}
+
+// objectInfo builds the info of key from the headers of a GET or HEAD
+func objectInfo(key string, resp *http.Response) *ObjectInfo {
+	info := &ObjectInfo{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = modified
+	}
+	return info
+}
+
+// get issues a GET of key, returning an error unless the server answered
+// with one of the accepted statuses
+func (w *WebDAVStorage) get(ctx context.Context, key string, header http.Header, accepted ...int) (*http.Response, error) {
+	resp, err := w.do(ctx, http.MethodGet, key, nil, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	for _, status := range accepted {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	drain(resp)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("object not found: %s", key)
+	}
+	return nil, statusError(http.MethodGet, key, resp)
+}
+
+// Get retrieves an object from the WebDAV server
+func (w *WebDAVStorage) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	resp, err := w.get(ctx, key, nil, http.StatusOK)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := objectInfo(key, resp)
+	info.Metadata = w.readSidecar(ctx, key)
+	return resp.Body, info, nil
+}
+
+// GetRange retrieves a byte range of an object, skipping to it when the
+// server ignores the Range header
+func (w *WebDAVStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, *ObjectInfo, error) {
+	header := http.Header{}
+	if length > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := w.get(ctx, key, header, http.StatusOK, http.StatusPartialContent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := objectInfo(key, resp)
+	info.Metadata = w.readSidecar(ctx, key)
+	if resp.StatusCode == http.StatusPartialContent {
+		// Content-Range: bytes <start>-<end>/<size>
+		if _, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/"); ok {
+			if size, err := strconv.ParseInt(total, 10, 64); err == nil {
+				info.Size = size
+			}
+		}
+		return resp.Body, info, nil
+	}
+
+	if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+		_ = resp.Body.Close()
+		return nil, nil, fmt.Errorf("failed to seek: %w", err)
+	}
+	var reader io.ReadCloser = resp.Body
+	if length > 0 {
+		reader = &limitedReadCloser{Reader: io.LimitReader(resp.Body, length), Closer: resp.Body}
+	}
+	return reader, info, nil
+}
+
+// Put stores an object on the WebDAV server
+func (w *WebDAVStorage) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (*ObjectInfo, error) {
+	// Write metadata first so the object never appears without it
+	metadata := metadataFromContext(ctx)
+	if err := w.writeSidecar(ctx, key, metadata); err != nil {
+		return nil, err
+	}
+
+	counter := &countingReader{Reader: reader}
+	if err := w.upload(ctx, key, counter, size, contentType); err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:         key,
+		Size:        counter.n,
+		ContentType: contentType,
+		Metadata:    metadata,
+	}, nil
+}
+
+// upload PUTs the body to a temp name beside key and moves it into place
+func (w *WebDAVStorage) upload(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	dir := path.Dir(key)
+	if dir == "." {
+		dir = ""
+	}
+	if err := w.mkcolAll(ctx, dir); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 8)
+	_, _ = rand.Read(suffix)
+	tmpKey := path.Join(dir, ".tmp-"+hex.EncodeToString(suffix))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, w.url(tmpKey), body)
+	if err != nil {
+		return err
+	}
+	if size > 0 {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if w.username != "" || w.password != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		_ = w.remove(context.WithoutCancel(ctx), tmpKey)
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	drain(resp)
+	if resp.StatusCode/100 != 2 {
+		_ = w.remove(context.WithoutCancel(ctx), tmpKey)
+		return statusError(http.MethodPut, key, resp)
+	}
+
+	resp, err = w.do(ctx, "MOVE", tmpKey, nil, http.Header{
+		"Destination": {w.url(key)},
+		"Overwrite":   {"T"},
+	})
+	if err != nil {
+		_ = w.remove(context.WithoutCancel(ctx), tmpKey)
+		return fmt.Errorf("failed to move %s into place: %w", key, err)
+	}
+	drain(resp)
+	if resp.StatusCode/100 != 2 {
+		_ = w.remove(context.WithoutCancel(ctx), tmpKey)
+		return statusError("MOVE", key, resp)
+	}
+	return nil
+}
+
+// mkcolAll creates the collection dir and its parents
+func (w *WebDAVStorage) mkcolAll(ctx context.Context, dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if _, ok := w.collections.Load(dir); ok {
+		return nil
+	}
+	if parent := path.Dir(dir); parent != "." {
+		if err := w.mkcolAll(ctx, parent); err != nil {
+			return err
+		}
+	}
+	return w.mkcol(ctx, dir)
+}
+
+// mkcol creates the collection dir, whose parent must exist
+func (w *WebDAVStorage) mkcol(ctx context.Context, dir string) error {
+	resp, err := w.do(ctx, "MKCOL", dir+"/", nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create collection %s: %w", dir, err)
+	}
+	drain(resp)
+	// 405 Method Not Allowed: the collection already exists
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusMethodNotAllowed {
+		return statusError("MKCOL", dir+"/", resp)
+	}
+	w.collections.Store(dir, true)
+	return nil
+}
+
+// PutMultipart is the same as Put for WebDAV storage
+func (w *WebDAVStorage) PutMultipart(ctx context.Context, key string, reader io.Reader, size int64, contentType string, partSize int64) (*ObjectInfo, error) {
+	return w.Put(ctx, key, reader, size, contentType)
+}
+
+// remove deletes key, treating a missing object as deleted
+func (w *WebDAVStorage) remove(ctx context.Context, key string) error {
+	resp, err := w.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	drain(resp)
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return statusError(http.MethodDelete, key, resp)
+	}
+	return nil
+}
+
+// Delete removes an object and its metadata
+func (w *WebDAVStorage) Delete(ctx context.Context, key string) error {
+	if err := w.remove(ctx, key); err != nil {
+		return err
+	}
+	return w.remove(ctx, webdavSidecarKey(key))
+}
+
+// Exists checks if an object exists on the WebDAV server
+func (w *WebDAVStorage) Exists(ctx context.Context, key string) (bool, error) {
+	resp, err := w.do(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat object %s: %w", key, err)
+	}
+	drain(resp)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode/100 == 2:
+		return true, nil
+	}
+	return false, statusError(http.MethodHead, key, resp)
+}
+
+// Stat retrieves object metadata without downloading content
+func (w *WebDAVStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := w.do(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat object %s: %w", key, err)
+	}
+	drain(resp)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("object not found: %s", key)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, statusError(http.MethodHead, key, resp)
+	}
+	info := objectInfo(key, resp)
+	info.Metadata = w.readSidecar(ctx, key)
+	return info, nil
+}
+
+// List returns the objects in the collection holding opts.Prefix whose
+// names start with the rest of it
+func (w *WebDAVStorage) List(ctx context.Context, opts ListOptions) ([]*ObjectInfo, error) {
+	dir, namePrefix := path.Split(opts.Prefix)
+	entries, err := w.propfind(ctx, strings.TrimSuffix(dir, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []*ObjectInfo
+	for _, entry := range entries {
+		name := path.Base(entry.Key)
+		if entry.dir || isTempFile(name) || !strings.HasPrefix(name, namePrefix) {
+			continue
+		}
+		if opts.StartAfter != "" && entry.Key <= opts.StartAfter {
+			continue
+		}
+		objects = append(objects, entry.ObjectInfo)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	if opts.MaxKeys > 0 && len(objects) > opts.MaxKeys {
+		objects = objects[:opts.MaxKeys]
+	}
+	return objects, nil
+}
+
+// Walk calls fn for every stored object under prefix, skipping metadata
+// and in-flight temp files
+func (w *WebDAVStorage) Walk(ctx context.Context, prefix string, fn func(*ObjectInfo) error) error {
+	return w.walk(ctx, strings.TrimSuffix(prefix, "/"), func(entry *davEntry) error {
+		if isTempFile(path.Base(entry.Key)) {
+			return nil
+		}
+		return fn(entry.ObjectInfo)
+	})
+}
+
+// walk calls fn for every file under dir, depth first, leaving out the
+// metadata collection unless dir is inside it
+func (w *WebDAVStorage) walk(ctx context.Context, dir string, fn func(*davEntry) error) error {
+	entries, err := w.propfind(ctx, dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !entry.dir {
+			if err := fn(entry); err != nil {
+				return err
+			}
+			continue
+		}
+		if entry.Key == metadataDir {
+			continue
+		}
+		if err := w.walk(ctx, entry.Key, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CleanupTemp removes temp files left behind by interrupted uploads
+func (w *WebDAVStorage) CleanupTemp(ctx context.Context, olderThan time.Duration, dryRun bool) (int, int64, error) {
+	cutoff := time.Now().Add(-olderThan)
+	count := 0
+	var size int64
+
+	cleanup := func(entry *davEntry) error {
+		if !isTempFile(path.Base(entry.Key)) || entry.LastModified.After(cutoff) {
+			return nil
+		}
+		if !dryRun {
+			if err := w.remove(ctx, entry.Key); err != nil {
+				return err
+			}
+		}
+		count++
+		size += entry.Size
+		return nil
+	}
+	if err := w.walk(ctx, "", cleanup); err != nil {
+		return count, size, err
+	}
+	err := w.walk(ctx, metadataDir, cleanup)
+	return count, size, err
+}
+
+// GetPresignedURL is not supported for WebDAV storage
+func (w *WebDAVStorage) GetPresignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return "", errors.New("WebDAV storage doesn't support presigned URLs")
+}
+
+// Close releases idle connections
+func (w *WebDAVStorage) Close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
+
+// StreamingPut is the same as Put for WebDAV storage, which streams the
+// body to the server
+func (w *WebDAVStorage) StreamingPut(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (*ObjectInfo, error) {
+	return w.Put(ctx, key, reader, size, contentType)
+}
+
+// StreamingGet copies an object to writer
+func (w *WebDAVStorage) StreamingGet(ctx context.Context, key string, writer io.Writer) (*ObjectInfo, error) {
+	reader, info, err := w.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = reader.Close() }()
+
+	if _, err := io.Copy(writer, reader); err != nil {
+		return nil, fmt.Errorf("failed to stream object %s: %w", key, err)
+	}
+	return info, nil
+}
+
+// GetFilePath is not supported for WebDAV storage
+func (w *WebDAVStorage) GetFilePath(ctx context.Context, key string) (string, error) {
+	return "", errors.New("WebDAV storage doesn't support local file paths")
+}
+
+// SupportsZeroCopy indicates if the backend supports zero-copy operations
+func (w *WebDAVStorage) SupportsZeroCopy() bool {
+	return false
+}
+
+// webdavSidecarKey returns where key's metadata is kept
+func webdavSidecarKey(key string) string {
+	return metadataDir + "/" + key + ".json"
+}
+
+// writeSidecar stores metadata for key, or removes a stale sidecar left by
+// an earlier write of the same key when there is none
+func (w *WebDAVStorage) writeSidecar(ctx context.Context, key string, metadata map[string]string) error {
+	if len(metadata) == 0 {
+		return w.remove(ctx, webdavSidecarKey(key))
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	if err := w.upload(ctx, webdavSidecarKey(key), bytes.NewReader(data), int64(len(data)), "application/json"); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return nil
+}
+
+// readSidecar loads key's metadata, returning nil if it has none
+func (w *WebDAVStorage) readSidecar(ctx context.Context, key string) map[string]string {
+	resp, err := w.get(ctx, webdavSidecarKey(key), nil, http.StatusOK)
+	if err != nil {
+		return nil
+	}
+	defer drain(resp)
+
+	var metadata map[string]string
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&metadata); err != nil {
+		logger.FromContext(ctx).Debug().Err(err).Str("key", key).Msg("Ignoring unreadable WebDAV metadata")
+		return nil
+	}
+	return metadata
+}
+
+// davEntry is a member of a collection listed by PROPFIND
+type davEntry struct {
+	*ObjectInfo
+	dir bool
+}
+
+// propfindBody asks for the properties object info is built from
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/><D:getlastmodified/><D:getetag/><D:getcontenttype/></D:prop></D:propfind>`
+
+// multistatus is the part of a PROPFIND response groxpi reads
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ContentLength string `xml:"DAV: getcontentlength"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+				ETag          string `xml:"DAV: getetag"`
+				ContentType   string `xml:"DAV: getcontenttype"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// propfind lists the members of the collection dir, or none if it doesn't
+// exist. Only one level is requested, since many servers refuse
+// "Depth: infinity".
+func (w *WebDAVStorage) propfind(ctx context.Context, dir string) ([]*davEntry, error) {
+	collection := dir
+	if collection != "" {
+		collection += "/"
+	}
+	resp, err := w.do(ctx, "PROPFIND", collection, strings.NewReader(propfindBody), http.Header{
+		"Depth":        {"1"},
+		"Content-Type": {"application/xml; charset=utf-8"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", collection, err)
+	}
+	defer drain(resp)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, statusError("PROPFIND", collection, resp)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("failed to parse listing of %s: %w", collection, err)
+	}
+
+	entries := make([]*davEntry, 0, len(ms.Responses))
+	for _, r := range ms.Responses {
+		key, ok := w.hrefKey(r.Href)
+		if !ok || key == dir {
+			continue // The collection itself
+		}
+		entry := &davEntry{ObjectInfo: &ObjectInfo{Key: key}}
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			entry.dir = ps.Prop.ResourceType.Collection != nil
+			entry.Size, _ = strconv.ParseInt(ps.Prop.ContentLength, 10, 64)
+			entry.ETag = strings.Trim(ps.Prop.ETag, `"`)
+			entry.ContentType = ps.Prop.ContentType
+			if modified, err := http.ParseTime(ps.Prop.LastModified); err == nil {
+				entry.LastModified = modified
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// hrefKey converts a PROPFIND href, a path or a full URL, to a key
+func (w *WebDAVStorage) hrefKey(href string) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	rel, ok := strings.CutPrefix(u.Path, w.base.Path)
+	if !ok {
+		// The base collection itself, listed without its trailing slash
+		return "", u.Path == strings.TrimSuffix(w.base.Path, "/")
+	}
+	return strings.TrimSuffix(rel, "/"), true
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// newTestWebDAV serves an in-memory WebDAV share under /dav/ and opens
+// storage on a collection inside it
+func newTestWebDAV(t *testing.T) (*WebDAVStorage, *int) {
+	handler := &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}
+	var unauthorized int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "groxpi" || pass != "secret" {
+			unauthorized++
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	store, err := NewWebDAVStorage(&WebDAVConfig{URL: server.URL + "/dav/groxpi cache", Username: "groxpi", Password: "secret"})
+	if err != nil {
+		t.Fatalf("NewWebDAVStorage failed: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store, &unauthorized
+}
+
+func TestWebDAVStorage(t *testing.T) {
+	store, unauthorized := newTestWebDAV(t)
+	ctx := context.Background()
+	key := "packages/six/six-1.16.0-py2.py3-none-any.whl"
+	content := "wheel contents"
+
+	if exists, err := store.Exists(ctx, key); err != nil || exists {
+		t.Fatalf("Expected no object yet, got %v (%v)", exists, err)
+	}
+	if _, _, err := store.Get(ctx, key); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+
+	metaCtx := WithMetadata(ctx, map[string]string{MetaSHA256: "abc123"})
+	info, err := store.Put(metaCtx, key, strings.NewReader(content), int64(len(content)), "application/octet-stream")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if info.Size != int64(len(content)) || info.Metadata[MetaSHA256] != "abc123" {
+		t.Errorf("Unexpected put info %+v", info)
+	}
+
+	reader, info, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	_ = reader.Close()
+	if string(data) != content || info.Size != int64(len(content)) || info.Metadata[MetaSHA256] != "abc123" {
+		t.Errorf("Unexpected object %q %+v", data, info)
+	}
+
+	stat, err := store.Stat(ctx, key)
+	if err != nil || stat.Size != int64(len(content)) || stat.LastModified.IsZero() || stat.Metadata[MetaSHA256] != "abc123" {
+		t.Errorf("Unexpected stat %+v (%v)", stat, err)
+	}
+
+	reader, info, err = store.GetRange(ctx, key, 6, 5)
+	if err != nil {
+		t.Fatalf("GetRange failed: %v", err)
+	}
+	data, _ = io.ReadAll(reader)
+	_ = reader.Close()
+	if string(data) != "conte" || info.Size != int64(len(content)) {
+		t.Errorf("Unexpected range %q of %d bytes", data, info.Size)
+	}
+
+	var out bytes.Buffer
+	if _, err := store.StreamingGet(ctx, key, &out); err != nil || out.String() != content {
+		t.Errorf("Unexpected streamed object %q (%v)", out.String(), err)
+	}
+
+	other := "packages/six/six-1.16.0.tar.gz"
+	if _, err := store.Put(ctx, other, strings.NewReader("sdist"), 5, ""); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	listed, err := store.List(ctx, ListOptions{Prefix: "packages/six/six-1.16.0-"})
+	if err != nil || len(listed) != 1 || listed[0].Key != key {
+		t.Errorf("Unexpected listing %v (%v)", listed, err)
+	}
+
+	var walked []string
+	if err := store.Walk(ctx, "packages/", func(obj *ObjectInfo) error {
+		walked = append(walked, obj.Key)
+		return nil
+	}); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if len(walked) != 2 {
+		t.Errorf("Expected 2 objects without metadata or temp files, got %v", walked)
+	}
+
+	// An interrupted upload is cleaned up
+	if err := store.upload(ctx, "packages/six/.tmp-interrupted", strings.NewReader("partial"), 7, ""); err != nil {
+		t.Fatal(err)
+	}
+	if count, _, err := store.CleanupTemp(ctx, -time.Minute, false); err != nil || count != 1 {
+		t.Errorf("Expected 1 temp file cleaned up, got %d (%v)", count, err)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if exists, _ := store.Exists(ctx, key); exists {
+		t.Error("Expected the object to be deleted")
+	}
+	if metadata := store.readSidecar(ctx, key); metadata != nil {
+		t.Errorf("Expected the metadata to be deleted, got %v", metadata)
+	}
+	if *unauthorized != 0 {
+		t.Errorf("Expected every request to carry credentials, %d did not", *unauthorized)
+	}
+}
+
+func TestNewWebDAVStorage_Unauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	if _, err := NewWebDAVStorage(&WebDAVConfig{URL: server.URL + "/dav/"}); err == nil {
+		t.Error("Expected rejected credentials to fail at startup")
+	}
+	if _, err := NewWebDAVStorage(&WebDAVConfig{URL: "nas.example.com/dav"}); err == nil {
+		t.Error("Expected a URL without a scheme to be rejected")
+	}
+}
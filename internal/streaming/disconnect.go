@@ -0,0 +1,131 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// ErrClientGone is returned by DownloadAndStream when the client went away
+// mid-stream. The result is returned along with it when the download was
+// completed into storage regardless.
+var ErrClientGone = errors.New("client disconnected")
+
+type (
+	completionKey struct{}
+	clientKey     struct{}
+)
+
+// WithCompletionThreshold returns a context under which a download whose
+// client disconnects is finished into storage when at least threshold (0-1)
+// of it was already sent, and aborted otherwise. Without it, a download
+// lives and dies with its client. Downloads of unknown length are always
+// aborted.
+func WithCompletionThreshold(ctx context.Context, threshold float64) context.Context {
+	return context.WithValue(ctx, completionKey{}, threshold)
+}
+
+// WithClient returns a context under which a download takes client ending,
+// such as the context of the request it serves, as its client going away.
+// Servers that detach downloads from request cancellation pass the
+// request's context here so a disconnect is still noticed before the next
+// write fails. Without it, the end of the download's own context is taken.
+func WithClient(ctx, client context.Context) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// States of a clientLink
+const (
+	clientConnected int32 = iota
+	clientLeftLate        // The download goes on into storage
+	clientLeftEarly       // The download is cancelled
+)
+
+// clientLink is the writer a download streams to its client through. It
+// decides what happens when the client goes away, either because its
+// connection fails or because its context (see WithClient) ends: past the
+// completion threshold the download carries on into storage with the
+// client's bytes discarded, before it the download is cancelled.
+type clientLink struct {
+	w         io.Writer
+	linked    bool // Whether the download may outlive the client
+	threshold float64
+	size      atomic.Int64 // Content length, -1 while unknown
+	written   atomic.Int64
+	state     atomic.Int32
+	cancel    context.CancelFunc
+	stop      func() bool
+}
+
+// linkClient returns the context a download streaming to w runs under and
+// the link to write to the client through. Without a completion threshold
+// on ctx the download keeps ctx, and client write errors end it as before.
+func linkClient(ctx context.Context, w io.Writer) (context.Context, *clientLink) {
+	link := &clientLink{w: w, cancel: func() {}, stop: func() bool { return true }}
+	link.size.Store(-1)
+	threshold, ok := ctx.Value(completionKey{}).(float64)
+	if !ok {
+		return ctx, link
+	}
+	link.linked = true
+	link.threshold = threshold
+
+	// The download outlives the client's request, but not its deadline
+	var fetchCtx context.Context
+	var cancel context.CancelFunc
+	if deadline, ok := ctx.Deadline(); ok {
+		fetchCtx, cancel = context.WithDeadline(context.WithoutCancel(ctx), deadline)
+	} else {
+		fetchCtx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+	}
+	link.cancel = cancel
+	client := ctx
+	if c, ok := ctx.Value(clientKey{}).(context.Context); ok {
+		client = c
+	}
+	link.stop = context.AfterFunc(client, func() {
+		// A passed deadline ends the download through fetchCtx as well
+		if errors.Is(client.Err(), context.Canceled) {
+			link.leave()
+		}
+	})
+	return fetchCtx, link
+}
+
+// setSize records the download's content length once known
+func (l *clientLink) setSize(size int64) {
+	l.size.Store(size)
+}
+
+// leave handles the client going away and reports whether the download
+// goes on
+func (l *clientLink) leave() bool {
+	size := l.size.Load()
+	if size > 0 && float64(l.written.Load()) >= l.threshold*float64(size) {
+		l.state.CompareAndSwap(clientConnected, clientLeftLate)
+	} else if l.state.CompareAndSwap(clientConnected, clientLeftEarly) {
+		l.cancel()
+	}
+	return l.state.Load() == clientLeftLate
+}
+
+func (l *clientLink) Write(p []byte) (int, error) {
+	if l.state.Load() == clientLeftLate {
+		return len(p), nil
+	}
+	n, err := l.w.Write(p)
+	l.written.Add(int64(n))
+	if err != nil && l.linked && l.leave() {
+		return len(p), nil
+	}
+	return n, err
+}
+
+// close releases the link once the download is over and reports whether
+// the client went away during it
+func (l *clientLink) close() bool {
+	l.stop()
+	l.cancel()
+	return l.state.Load() != clientConnected
+}
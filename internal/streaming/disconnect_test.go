@@ -0,0 +1,145 @@
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// leavingClient accepts limit bytes and then fails, like a client whose
+// connection dropped
+type leavingClient struct {
+	bytes.Buffer
+	limit int
+}
+
+func (w *leavingClient) Write(p []byte) (int, error) {
+	if w.Len()+len(p) > w.limit {
+		return 0, errors.New("broken pipe")
+	}
+	return w.Buffer.Write(p)
+}
+
+func downloaders(storage StorageWriter) map[string]StreamingDownloader {
+	return map[string]StreamingDownloader{
+		"plain": NewStreamingDownloader(storage, nil),
+		"tee":   NewTeeStreamingDownloader(storage, nil),
+	}
+}
+
+func TestDownloadAndStream_ClientLeaves(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 256*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.whl", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	for name := range downloaders(nil) {
+		t.Run(name, func(t *testing.T) {
+			storage := newMockStorageWriter()
+			downloader := downloaders(storage)[name]
+			ctx := WithCompletionThreshold(context.Background(), 0.5)
+
+			// Late: the rest is downloaded into storage
+			result, err := downloader.DownloadAndStream(ctx, server.URL, "late", &leavingClient{limit: 200 * 1024})
+			if !errors.Is(err, ErrClientGone) || result == nil {
+				t.Fatalf("Expected a result with ErrClientGone, got %v, %v", result, err)
+			}
+			if stored, _ := storage.Get("late"); !bytes.Equal(stored, data) || result.Error != nil {
+				t.Errorf("Expected the whole file to be stored, got %d bytes (%v)", len(stored), result.Error)
+			}
+
+			// Early: the download is abandoned
+			result, err = downloader.DownloadAndStream(ctx, server.URL, "early", &leavingClient{limit: 10 * 1024})
+			if !errors.Is(err, ErrClientGone) || result != nil {
+				t.Errorf("Expected ErrClientGone without a result, got %v, %v", result, err)
+			}
+			if _, stored := storage.Get("early"); stored {
+				t.Error("Expected an abandoned download not to be stored")
+			}
+
+			// Of unknown length, the download is abandoned too
+			chunked := createTestServer(string(data), http.StatusOK, 0)
+			defer chunked.Close()
+			if result, err := downloader.DownloadAndStream(ctx, chunked.URL, "chunked", &leavingClient{limit: 200 * 1024}); !errors.Is(err, ErrClientGone) || result != nil {
+				t.Errorf("Expected ErrClientGone without a result, got %v, %v", result, err)
+			}
+
+			// Without a threshold the download ends with its client
+			if _, err := downloader.DownloadAndStream(context.Background(), server.URL, "default", &leavingClient{limit: 200 * 1024}); err == nil || errors.Is(err, ErrClientGone) {
+				t.Errorf("Expected a plain streaming error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDownloadAndStream_RequestCancelled(t *testing.T) {
+	const size = 256 * 1024
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent, _ := strconv.Atoi(r.URL.Query().Get("sent"))
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		_, _ = w.Write(bytes.Repeat([]byte("x"), sent))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+			_, _ = w.Write(bytes.Repeat([]byte("x"), size-sent))
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	storage := newMockStorageWriter()
+	downloader := NewTeeStreamingDownloader(storage, nil)
+
+	// Cancelled before the threshold, the upstream fetch stops at once
+	ctx, cancel := context.WithCancel(WithCompletionThreshold(context.Background(), 0.5))
+	client := &cancellingClient{at: 10 * 1024, cancel: cancel}
+	if result, err := downloader.DownloadAndStream(ctx, server.URL+"?sent=10240", "early", client); !errors.Is(err, ErrClientGone) || result != nil {
+		t.Errorf("Expected ErrClientGone without a result, got %v, %v", result, err)
+	}
+
+	// Cancelled past it, the download finishes once upstream sends the rest
+	ctx, cancel = context.WithCancel(WithCompletionThreshold(context.Background(), 0.5))
+	client = &cancellingClient{at: 200 * 1024, cancel: func() {
+		cancel()
+		release <- struct{}{}
+	}}
+	result, err := downloader.DownloadAndStream(ctx, server.URL+"?sent=204800", "late", client)
+	if !errors.Is(err, ErrClientGone) || result == nil || result.Error != nil {
+		t.Fatalf("Expected a stored result with ErrClientGone, got %v, %v", result, err)
+	}
+	if stored, _ := storage.Get("late"); len(stored) != size {
+		t.Errorf("Expected the whole file to be stored, got %d bytes", len(stored))
+	}
+
+	// A download detached from its request still notices the request end
+	clientCtx, cancel := context.WithCancel(context.Background())
+	ctx = WithCompletionThreshold(WithClient(context.Background(), clientCtx), 0.5)
+	client = &cancellingClient{at: 10 * 1024, cancel: cancel}
+	if result, err := downloader.DownloadAndStream(ctx, server.URL+"?sent=10240", "detached", client); !errors.Is(err, ErrClientGone) || result != nil {
+		t.Errorf("Expected ErrClientGone from the client's context, got %v, %v", result, err)
+	}
+}
+
+// cancellingClient calls cancel once it has received at bytes
+type cancellingClient struct {
+	bytes.Buffer
+	at     int
+	cancel func()
+}
+
+func (w *cancellingClient) Write(p []byte) (int, error) {
+	n, err := w.Buffer.Write(p)
+	if w.cancel != nil && w.Len() >= w.at {
+		w.cancel()
+		w.cancel = nil
+	}
+	return n, err
+}
@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/huyhandes/groxpi/internal/version"
 )
 
 // StorageWriter interface to avoid import cycle with storage package
@@ -48,6 +50,8 @@ func (sd *streamingDownloader) DownloadAndStream(ctx context.Context, url, stora
 	// Logging disabled for tests
 
 	start := time.Now()
+	ctx, link := linkClient(ctx, writer)
+	defer link.close()
 
 	// Create HTTP request
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -56,7 +60,7 @@ func (sd *streamingDownloader) DownloadAndStream(ctx context.Context, url, stora
 	}
 
 	// Add appropriate headers
-	req.Header.Set("User-Agent", "groxpi/1.0.0")
+	req.Header.Set("User-Agent", version.UserAgent(""))
 	req.Header.Set("Accept", "*/*")
 
 	// Perform request
@@ -77,6 +81,7 @@ func (sd *streamingDownloader) DownloadAndStream(ctx context.Context, url, stora
 	}
 
 	contentLength := resp.ContentLength
+	link.setSize(contentLength)
 
 	// Debug logging disabled for tests
 
@@ -90,7 +95,7 @@ func (sd *streamingDownloader) DownloadAndStream(ctx context.Context, url, stora
 	// 1. Client (writer parameter)
 	// 2. Storage (via pipe)
 	// 3. Hash calculation
-	multiWriter := io.MultiWriter(writer, storageWriter, hasher)
+	multiWriter := io.MultiWriter(link, storageWriter, hasher)
 
 	// Create buffered reader for better performance
 	var totalSize int64
@@ -116,8 +121,9 @@ func (sd *streamingDownloader) DownloadAndStream(ctx context.Context, url, stora
 
 	totalSize, streamErr = io.CopyBuffer(multiWriter, resp.Body, copyBuf)
 
-	// Close storage writer to signal completion
-	if err := storageWriter.Close(); err != nil {
+	// Close storage writer to signal completion; a failed stream fails the
+	// write so a truncated body is never stored
+	if err := storageWriter.CloseWithError(streamErr); err != nil {
 		// Log error but continue
 		_ = err
 	}
@@ -128,8 +134,11 @@ func (sd *streamingDownloader) DownloadAndStream(ctx context.Context, url, stora
 	// duration calculation for logging (disabled in tests)
 	_ = time.Since(start)
 
+	gone := link.close()
 	if streamErr != nil {
-		// Error logging disabled for tests
+		if gone {
+			return nil, fmt.Errorf("%w, download aborted: %v", ErrClientGone, streamErr)
+		}
 		return nil, fmt.Errorf("streaming failed: %w", streamErr)
 	}
 
@@ -145,6 +154,9 @@ func (sd *streamingDownloader) DownloadAndStream(ctx context.Context, url, stora
 		ETag:        etag,
 		Error:       storageErr, // Include storage error for caller to decide
 	}
+	if gone {
+		return result, ErrClientGone
+	}
 
 	// Info logging disabled for tests
 
@@ -183,6 +195,8 @@ func (tsd *teeStreamingDownloader) DownloadAndStream(ctx context.Context, url, s
 	// Debug logging disabled for tests
 
 	start := time.Now()
+	ctx, link := linkClient(ctx, writer)
+	defer link.close()
 
 	// Create HTTP request
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -190,7 +204,7 @@ func (tsd *teeStreamingDownloader) DownloadAndStream(ctx context.Context, url, s
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("User-Agent", "groxpi/1.0.0")
+	req.Header.Set("User-Agent", version.UserAgent(""))
 
 	// Perform request
 	resp, err := tsd.httpClient.Do(req)
@@ -208,6 +222,8 @@ func (tsd *teeStreamingDownloader) DownloadAndStream(ctx context.Context, url, s
 		contentType = "application/octet-stream"
 	}
 
+	link.setSize(resp.ContentLength)
+
 	// Create hash calculator
 	hasher := md5.New()
 
@@ -235,10 +251,11 @@ func (tsd *teeStreamingDownloader) DownloadAndStream(ctx context.Context, url, s
 	defer tsd.copyBufPool.Put(copyBufPtr)
 	copyBuf := *copyBufPtr
 
-	totalSize, streamErr := io.CopyBuffer(writer, teeReader, copyBuf)
+	totalSize, streamErr := io.CopyBuffer(link, teeReader, copyBuf)
 
-	// Close storage writer
-	if err := storageWriter.Close(); err != nil {
+	// Close storage writer; a failed stream fails the write so a truncated
+	// body is never stored
+	if err := storageWriter.CloseWithError(streamErr); err != nil {
 		// Log error but continue
 		_ = err
 	}
@@ -249,8 +266,11 @@ func (tsd *teeStreamingDownloader) DownloadAndStream(ctx context.Context, url, s
 	// duration calculation for logging (disabled in tests)
 	_ = time.Since(start)
 
+	gone := link.close()
 	if streamErr != nil {
-		// TeeReader error logging disabled for tests
+		if gone {
+			return nil, fmt.Errorf("%w, download aborted: %v", ErrClientGone, streamErr)
+		}
 		return nil, fmt.Errorf("tee streaming failed: %w", streamErr)
 	}
 
@@ -262,6 +282,9 @@ func (tsd *teeStreamingDownloader) DownloadAndStream(ctx context.Context, url, s
 		ETag:        etag,
 		Error:       storageErr,
 	}
+	if gone {
+		return result, ErrClientGone
+	}
 
 	// TeeReader info logging disabled for tests
 
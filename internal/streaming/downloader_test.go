@@ -342,6 +342,26 @@ func TestTeeStreamingDownloader_DownloadAndStream(t *testing.T) {
 			t.Errorf("Size mismatch: expected %d, got %d", len(testData), result.Size)
 		}
 	})
+
+	t.Run("truncated body is not stored", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "100")
+			_, _ = w.Write([]byte("only part of it"))
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}))
+		defer server.Close()
+
+		storage := newMockStorageWriter()
+		downloader := NewTeeStreamingDownloader(storage, &http.Client{Timeout: 5 * time.Second})
+
+		if _, err := downloader.DownloadAndStream(context.Background(), server.URL, "tee-key", io.Discard); err == nil {
+			t.Error("Expected an error for a truncated body")
+		}
+		if _, exists := storage.Get("tee-key"); exists {
+			t.Error("A truncated body should not be cached")
+		}
+	})
 }
 
 func TestHashingWriter(t *testing.T) {
@@ -15,7 +15,8 @@ type StreamResult struct {
 
 // StreamingDownloader handles simultaneous download and cache operations
 type StreamingDownloader interface {
-	// DownloadAndStream downloads from URL while simultaneously streaming to writer and caching
+	// DownloadAndStream downloads from URL while simultaneously streaming to writer and caching.
+	// A download whose writer fails mid-stream returns ErrClientGone; see WithCompletionThreshold.
 	DownloadAndStream(ctx context.Context, url, storageKey string, writer io.Writer) (*StreamResult, error)
 }
 
@@ -0,0 +1,48 @@
+package tenant
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokens_Authorized(t *testing.T) {
+	tokens := Tokens{"alpha", "beta"}
+
+	tests := []struct {
+		name  string
+		setup func(r *http.Request)
+		want  bool
+	}{
+		{"no credentials", func(r *http.Request) {}, false},
+		{"bearer token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer beta") }, true},
+		{"wrong bearer token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer gamma") }, false},
+		{"basic auth password", func(r *http.Request) { r.SetBasicAuth("ci", "alpha") }, true},
+		{"basic auth username only", func(r *http.Request) { r.SetBasicAuth("alpha", "") }, true},
+		{"token as username with a password", func(r *http.Request) { r.SetBasicAuth("alpha", "wrong") }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/simple/", nil)
+			tt.setup(r)
+			if got := tokens.Authorized(r); got != tt.want {
+				t.Errorf("Authorized = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if !Tokens(nil).Authorized(httptest.NewRequest("GET", "/simple/", nil)) {
+		t.Error("Empty token set should allow every request")
+	}
+}
+
+func TestTokens_Has(t *testing.T) {
+	tokens := Tokens{"alpha", "beta"}
+	if !tokens.Has("beta") || tokens.Has("gamma") || tokens.Has("") {
+		t.Error("Expected only listed tokens to be had")
+	}
+	if Tokens(nil).Has("alpha") {
+		t.Error("Empty token set should have no tokens")
+	}
+}
@@ -0,0 +1,54 @@
+package tenant
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Burst(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewRateLimiter(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow(); !ok {
+			t.Fatalf("Request %d within burst was rejected", i)
+		}
+	}
+
+	ok, wait := l.Allow()
+	if ok {
+		t.Fatal("Expected request over burst to be rejected")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("Expected 500ms until the next token, got %v", wait)
+	}
+
+	// Tokens refill at the configured rate
+	now = now.Add(time.Second)
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow(); !ok {
+			t.Fatalf("Refilled request %d was rejected", i)
+		}
+	}
+	if ok, _ := l.Allow(); ok {
+		t.Error("Expected only two tokens after one second")
+	}
+}
+
+func TestRateLimiter_Disabled(t *testing.T) {
+	l := NewRateLimiter(0, 10)
+	if l != nil {
+		t.Fatal("Expected nil limiter for zero rate")
+	}
+	if ok, _ := l.Allow(); !ok {
+		t.Error("Nil limiter should allow everything")
+	}
+}
+
+func TestRateLimiter_DefaultBurst(t *testing.T) {
+	l := NewRateLimiter(2.5, 0)
+	if l.burst != 3 {
+		t.Errorf("Expected default burst of 3, got %v", l.burst)
+	}
+}
@@ -0,0 +1,48 @@
+package tenant
+
+import "sync/atomic"
+
+// Stats counts a tenant's traffic for fair-share monitoring and chargeback
+type Stats struct {
+	requests      atomic.Int64
+	rateLimited   atomic.Int64
+	unauthorized  atomic.Int64
+	responseBytes atomic.Int64
+}
+
+// Snapshot is a point-in-time copy of Stats
+type Snapshot struct {
+	Requests      int64 `json:"requests"`
+	RateLimited   int64 `json:"rate_limited"`
+	Unauthorized  int64 `json:"unauthorized"`
+	ResponseBytes int64 `json:"response_bytes"`
+}
+
+// RecordRequest counts a request that reached the tenant and the bytes
+// sent back for it
+func (s *Stats) RecordRequest(responseBytes int64) {
+	s.requests.Add(1)
+	if responseBytes > 0 {
+		s.responseBytes.Add(responseBytes)
+	}
+}
+
+// RecordRateLimited counts a request rejected by the tenant's rate limit
+func (s *Stats) RecordRateLimited() {
+	s.rateLimited.Add(1)
+}
+
+// RecordUnauthorized counts a request rejected for missing or bad credentials
+func (s *Stats) RecordUnauthorized() {
+	s.unauthorized.Add(1)
+}
+
+// Snapshot returns the current counters
+func (s *Stats) Snapshot() Snapshot {
+	return Snapshot{
+		Requests:      s.requests.Load(),
+		RateLimited:   s.rateLimited.Load(),
+		Unauthorized:  s.unauthorized.Load(),
+		ResponseBytes: s.responseBytes.Load(),
+	}
+}
@@ -0,0 +1,16 @@
+package tenant
+
+import "testing"
+
+func TestStats_Snapshot(t *testing.T) {
+	var s Stats
+	s.RecordRequest(100)
+	s.RecordRequest(-1) // Nothing written
+	s.RecordRateLimited()
+	s.RecordUnauthorized()
+
+	want := Snapshot{Requests: 2, RateLimited: 1, Unauthorized: 1, ResponseBytes: 100}
+	if got := s.Snapshot(); got != want {
+		t.Errorf("Snapshot = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,167 @@
+// Package testsupport provides the external services integration tests run
+// against: an ephemeral MinIO server and a scripted fake PyPI index.
+package testsupport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// defaultMinIOImage is the MinIO image started when no endpoint is given
+const defaultMinIOImage = "quay.io/minio/minio:latest"
+
+// minioStartTimeout bounds how long a fresh container may take to serve
+const minioStartTimeout = 30 * time.Second
+
+// MinIO is an S3 endpoint for one test. Objects are kept under Prefix,
+// unique to the test, and removed when it ends.
+type MinIO struct {
+	Endpoint  string // host:port
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Prefix    string
+	Region    string
+
+	client *minio.Client
+}
+
+// StartMinIO returns MinIO for t. TEST_S3_ENDPOINT (with TEST_S3_ACCESS_KEY,
+// TEST_S3_SECRET_KEY and TEST_S3_BUCKET) selects a running server, as in
+// CI; otherwise a throwaway container is started with docker and removed
+// when the test ends (TEST_MINIO_IMAGE overrides the image). The test is
+// skipped in short mode or when neither is available.
+func StartMinIO(t testing.TB) *MinIO {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("Skipping MinIO integration test in short mode")
+	}
+
+	m := &MinIO{
+		Endpoint:  os.Getenv("TEST_S3_ENDPOINT"),
+		AccessKey: getEnv("TEST_S3_ACCESS_KEY", "minioadmin"),
+		SecretKey: getEnv("TEST_S3_SECRET_KEY", "minioadmin"),
+		Bucket:    getEnv("TEST_S3_BUCKET", "groxpi-test"),
+		Prefix:    testPrefix(t),
+		Region:    "us-east-1",
+	}
+	if m.Endpoint == "" {
+		if _, err := exec.LookPath("docker"); err != nil {
+			t.Skip("Skipping MinIO integration test: TEST_S3_ENDPOINT not set and docker not available")
+		}
+		m.Endpoint = startContainer(t, m.AccessKey, m.SecretKey)
+	}
+
+	client, err := minio.New(m.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(m.AccessKey, m.SecretKey, ""),
+		Region: m.Region,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create MinIO client: %v", err)
+	}
+	m.client = client
+
+	ctx, cancel := context.WithTimeout(context.Background(), minioStartTimeout)
+	defer cancel()
+	exists, err := client.BucketExists(ctx, m.Bucket)
+	if err != nil {
+		t.Fatalf("MinIO at %s not reachable: %v", m.Endpoint, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, m.Bucket, minio.MakeBucketOptions{Region: m.Region}); err != nil {
+			t.Fatalf("Failed to create bucket %s: %v", m.Bucket, err)
+		}
+	}
+
+	t.Cleanup(m.clear)
+	return m
+}
+
+// Keys lists the keys stored under the test's prefix, relative to it
+func (m *MinIO) Keys(t testing.TB) []string {
+	t.Helper()
+	var keys []string
+	for obj := range m.client.ListObjects(context.Background(), m.Bucket, minio.ListObjectsOptions{Prefix: m.Prefix + "/", Recursive: true}) {
+		if obj.Err != nil {
+			t.Fatalf("Failed to list %s: %v", m.Prefix, obj.Err)
+		}
+		keys = append(keys, strings.TrimPrefix(obj.Key, m.Prefix+"/"))
+	}
+	return keys
+}
+
+// clear removes the test's objects, leaving the bucket for other tests
+func (m *MinIO) clear() {
+	ctx := context.Background()
+	objects := m.client.ListObjects(ctx, m.Bucket, minio.ListObjectsOptions{Prefix: m.Prefix + "/", Recursive: true})
+	for range m.client.RemoveObjects(ctx, m.Bucket, objects, minio.RemoveObjectsOptions{}) {
+		// Leftovers only cost space under a prefix no other test uses
+	}
+}
+
+// startContainer runs MinIO on a free local port and returns its endpoint
+func startContainer(t testing.TB, accessKey, secretKey string) string {
+	t.Helper()
+
+	image := getEnv("TEST_MINIO_IMAGE", defaultMinIOImage)
+	out, err := exec.Command("docker", "run", "-d", "--rm",
+		"-p", "127.0.0.1::9000",
+		"-e", "MINIO_ROOT_USER="+accessKey,
+		"-e", "MINIO_ROOT_PASSWORD="+secretKey,
+		image, "server", "/data").Output()
+	if err != nil {
+		t.Skipf("Skipping MinIO integration test: failed to start %s: %v", image, err)
+	}
+	id := strings.TrimSpace(string(out))
+	t.Cleanup(func() { _ = exec.Command("docker", "rm", "-f", id).Run() })
+
+	out, err = exec.Command("docker", "port", id, "9000/tcp").Output()
+	if err != nil {
+		t.Fatalf("Failed to find MinIO port: %v", err)
+	}
+	// One line per address family, e.g. "127.0.0.1:49153"
+	endpoint := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+
+	client := &http.Client{Timeout: time.Second}
+	deadline := time.Now().Add(minioStartTimeout)
+	for time.Now().Before(deadline) {
+		if resp, err := client.Get("http://" + endpoint + "/minio/health/live"); err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return endpoint
+			}
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	t.Fatalf("MinIO did not become ready within %s", minioStartTimeout)
+	return ""
+}
+
+// testPrefix returns a key prefix unique to this run of t
+func testPrefix(t testing.TB) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			return r
+		}
+		return '-'
+	}, t.Name())
+	return fmt.Sprintf("test/%s-%s", name, strconv.FormatInt(time.Now().UnixNano(), 36))
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,224 @@
+package testsupport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const simpleJSON = "application/vnd.pypi.simple.v1+json"
+
+// Fault changes how the fake index answers one request
+type Fault struct {
+	Latency    time.Duration // Delay before answering
+	Status     int           // Answer with this status and no body instead (0 = normal answer)
+	RetryAfter time.Duration // Retry-After sent with Status
+	Truncate   int64         // Cut the connection after this many body bytes, with the full Content-Length announced (0 = whole body)
+}
+
+type fakeFile struct {
+	name   string
+	data   []byte
+	sha256 string
+}
+
+// FakeIndex is a PyPI simple index (PEP 503 HTML and PEP 691 JSON) serving
+// the files added to it, with faults injected per request path. Point
+// groxpi's index URL at IndexURL.
+type FakeIndex struct {
+	URL      string // Server root
+	Host     string // Server host:port, as in URL
+	IndexURL string // Simple API root
+
+	server *httptest.Server
+
+	mu       sync.Mutex
+	packages map[string][]fakeFile
+	faults   map[string][]Fault
+	requests map[string]int
+}
+
+// NewFakeIndex starts an empty fake index, closed when t ends
+func NewFakeIndex(t testing.TB) *FakeIndex {
+	t.Helper()
+	f := &FakeIndex{
+		packages: make(map[string][]fakeFile),
+		faults:   make(map[string][]Fault),
+		requests: make(map[string]int),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	f.URL = f.server.URL
+	f.Host = f.server.Listener.Addr().String()
+	f.IndexURL = f.server.URL + "/simple"
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// AddFile publishes data as filename of the (normalized) package pkg
+func (f *FakeIndex) AddFile(pkg, filename string, data []byte) {
+	sum := sha256.Sum256(data)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.packages[pkg] = append(f.packages[pkg], fakeFile{name: filename, data: data, sha256: hex.EncodeToString(sum[:])})
+}
+
+// Corrupt serves data as filename of pkg from now on, while the project page
+// keeps listing the SHA-256 of what was added
+func (f *FakeIndex) Corrupt(pkg, filename string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, file := range f.packages[pkg] {
+		if file.name == filename {
+			f.packages[pkg][i].data = data
+		}
+	}
+}
+
+// PagePath is the path of pkg's project page
+func (f *FakeIndex) PagePath(pkg string) string {
+	return "/simple/" + pkg + "/"
+}
+
+// FilePath is the path filename of pkg is downloaded from
+func (f *FakeIndex) FilePath(pkg, filename string) string {
+	return "/files/" + pkg + "/" + filename
+}
+
+// Inject queues faults for requests to path, one per request in order;
+// requests after the last are answered normally
+func (f *FakeIndex) Inject(path string, faults ...Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults[path] = append(f.faults[path], faults...)
+}
+
+// Requests returns how many requests reached path
+func (f *FakeIndex) Requests(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[path]
+}
+
+func (f *FakeIndex) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests[r.URL.Path]++
+	var fault Fault
+	if queued := f.faults[r.URL.Path]; len(queued) > 0 {
+		fault, f.faults[r.URL.Path] = queued[0], queued[1:]
+	}
+	f.mu.Unlock()
+
+	if fault.Latency > 0 {
+		select {
+		case <-time.After(fault.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if fault.Status != 0 {
+		if fault.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(fault.RetryAfter.Seconds())))
+		}
+		w.WriteHeader(fault.Status)
+		return
+	}
+
+	body, contentType, ok := f.render(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if fault.Truncate > 0 && fault.Truncate < int64(len(body)) {
+		_, _ = w.Write(body[:fault.Truncate])
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		panic(http.ErrAbortHandler) // Closes the connection mid-body
+	}
+	_, _ = w.Write(body)
+}
+
+// render returns the body answering r
+func (f *FakeIndex) render(r *http.Request) ([]byte, string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	wantsJSON := strings.Contains(r.Header.Get("Accept"), simpleJSON)
+	switch path := r.URL.Path; {
+	case path == "/simple/":
+		names := make([]string, 0, len(f.packages))
+		for name := range f.packages {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if wantsJSON {
+			projects := make([]map[string]string, 0, len(names))
+			for _, name := range names {
+				projects = append(projects, map[string]string{"name": name})
+			}
+			return encodeJSON(map[string]any{"meta": map[string]string{"api-version": "1.0"}, "projects": projects})
+		}
+		var b strings.Builder
+		b.WriteString("<!DOCTYPE html>\n<html><body>\n")
+		for _, name := range names {
+			fmt.Fprintf(&b, "<a href=\"/simple/%s/\">%s</a>\n", name, html.EscapeString(name))
+		}
+		b.WriteString("</body></html>\n")
+		return []byte(b.String()), "text/html", true
+
+	case strings.HasPrefix(path, "/simple/"):
+		pkg := strings.Trim(strings.TrimPrefix(path, "/simple/"), "/")
+		files, ok := f.packages[pkg]
+		if !ok {
+			return nil, "", false
+		}
+		if wantsJSON {
+			entries := make([]map[string]any, 0, len(files))
+			for _, file := range files {
+				entries = append(entries, map[string]any{
+					"filename": file.name,
+					"url":      f.URL + f.FilePath(pkg, file.name),
+					"hashes":   map[string]string{"sha256": file.sha256},
+					"size":     len(file.data),
+				})
+			}
+			return encodeJSON(map[string]any{"meta": map[string]string{"api-version": "1.0"}, "name": pkg, "files": entries})
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "<!DOCTYPE html>\n<html><body><h1>Links for %s</h1>\n", html.EscapeString(pkg))
+		for _, file := range files {
+			fmt.Fprintf(&b, "<a href=\"%s%s#sha256=%s\">%s</a>\n", f.URL, f.FilePath(pkg, file.name), file.sha256, html.EscapeString(file.name))
+		}
+		b.WriteString("</body></html>\n")
+		return []byte(b.String()), "text/html", true
+
+	case strings.HasPrefix(path, "/files/"):
+		pkg, name, _ := strings.Cut(strings.TrimPrefix(path, "/files/"), "/")
+		for _, file := range f.packages[pkg] {
+			if file.name == name {
+				return file.data, "application/octet-stream", true
+			}
+		}
+	}
+	return nil, "", false
+}
+
+func encodeJSON(v any) ([]byte, string, bool) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, "", false
+	}
+	return data, simpleJSON, true
+}
@@ -0,0 +1,257 @@
+package trash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/phuslu/log"
+
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// Prefix holds soft-deleted files as trash/<package>/<file>, whatever the
+// cache's key layout
+const Prefix = "trash/"
+
+// ErrNotFound is returned when a package has nothing in the trash
+var ErrNotFound = errors.New("package not found in trash")
+
+// Entry describes a soft-deleted package
+type Entry struct {
+	Package   string    `json:"package"`
+	Files     int       `json:"files"`
+	Bytes     int64     `json:"bytes"`
+	DeletedAt time.Time `json:"deleted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// RestoreResult summarizes a restore
+type RestoreResult struct {
+	Package  string `json:"package"`
+	Restored int    `json:"restored"`
+	Skipped  int    `json:"skipped"` // Already re-cached since the delete
+	Bytes    int64  `json:"bytes"`
+}
+
+// Trash moves cached package files aside instead of deleting them, so a
+// mistaken purge can be undone without refetching everything upstream.
+// Trashed files are removed for good once the retention period has passed.
+type Trash struct {
+	store     storage.Storage
+	keys      *storage.KeyLayout
+	retention time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a trash on store, whose package files are laid out by keys,
+// keeping deleted packages for retention. Trashed files are kept out of the
+// store's own eviction, so they neither push cached files out nor expire
+// before their retention.
+func New(store storage.Storage, keys *storage.KeyLayout, retention time.Duration) *Trash {
+	if excluder, ok := store.(storage.EvictionExcluder); ok {
+		excluder.ExcludeFromEviction(Prefix)
+	}
+	return &Trash{
+		store:     store,
+		keys:      keys,
+		retention: retention,
+	}
+}
+
+// Retention returns how long trashed packages are kept
+func (t *Trash) Retention() time.Duration {
+	return t.retention
+}
+
+// Move moves every cached file of the (normalized) package into the trash
+func (t *Trash) Move(ctx context.Context, pkg string) (*Entry, error) {
+	objects, err := t.store.List(ctx, storage.ListOptions{Prefix: t.keys.PackagePrefix(pkg)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", pkg, err)
+	}
+
+	now := time.Now()
+	entry := &Entry{
+		Package:   pkg,
+		DeletedAt: now,
+		ExpiresAt: now.Add(t.retention),
+	}
+
+	for _, obj := range objects {
+		dst := Prefix + pkg + "/" + path.Base(obj.Key)
+		if err := storage.Move(ctx, t.store, obj.Key, dst); err != nil {
+			return entry, err
+		}
+		entry.Files++
+		entry.Bytes += obj.Size
+	}
+
+	log.Info().
+		Str("package", pkg).
+		Int("files", entry.Files).
+		Int64("bytes", entry.Bytes).
+		Time("expires_at", entry.ExpiresAt).
+		Msg("Package moved to trash")
+
+	return entry, nil
+}
+
+// Restore moves a package's trashed files back into the cache. Files that
+// were downloaded again after the delete are kept and their trashed copy
+// dropped.
+func (t *Trash) Restore(ctx context.Context, pkg string) (*RestoreResult, error) {
+	objects, err := t.store.List(ctx, storage.ListOptions{Prefix: Prefix + pkg + "/"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash for %s: %w", pkg, err)
+	}
+	if len(objects) == 0 {
+		return nil, ErrNotFound
+	}
+
+	result := &RestoreResult{Package: pkg}
+	for _, obj := range objects {
+		dst := t.keys.Key(pkg, path.Base(obj.Key))
+
+		if exists, err := t.store.Exists(ctx, dst); err == nil && exists {
+			if err := t.store.Delete(ctx, obj.Key); err != nil {
+				log.Warn().Err(err).Str("key", obj.Key).Msg("Failed to drop superseded trash file")
+			}
+			result.Skipped++
+			continue
+		}
+
+		if err := storage.Move(ctx, t.store, obj.Key, dst); err != nil {
+			return result, err
+		}
+		result.Restored++
+		result.Bytes += obj.Size
+	}
+
+	log.Info().
+		Str("package", pkg).
+		Int("restored", result.Restored).
+		Int("skipped", result.Skipped).
+		Int64("bytes", result.Bytes).
+		Msg("Package restored from trash")
+
+	return result, nil
+}
+
+// List returns the packages currently in the trash, sorted by name
+func (t *Trash) List(ctx context.Context) ([]Entry, error) {
+	walker, ok := t.store.(storage.Walker)
+	if !ok {
+		return nil, errors.New("storage backend does not support listing the trash")
+	}
+
+	entries := make(map[string]*Entry)
+	err := walker.Walk(ctx, Prefix, func(obj *storage.ObjectInfo) error {
+		pkg, _, ok := strings.Cut(strings.TrimPrefix(obj.Key, Prefix), "/")
+		if !ok {
+			return nil
+		}
+
+		entry, found := entries[pkg]
+		if !found {
+			entry = &Entry{Package: pkg}
+			entries[pkg] = entry
+		}
+		entry.Files++
+		entry.Bytes += obj.Size
+		// Moving a file into the trash stamps it, so the newest one marks the
+		// delete
+		if obj.LastModified.After(entry.DeletedAt) {
+			entry.DeletedAt = obj.LastModified
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan trash: %w", err)
+	}
+
+	result := make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		entry.ExpiresAt = entry.DeletedAt.Add(t.retention)
+		result = append(result, *entry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Package < result[j].Package })
+
+	return result, nil
+}
+
+// Purge permanently removes packages whose retention has expired and
+// returns how many files and bytes were freed
+func (t *Trash) Purge(ctx context.Context) (int, int64, error) {
+	entries, err := t.List(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	now := time.Now()
+	count := 0
+	var size int64
+
+	for _, entry := range entries {
+		if entry.ExpiresAt.After(now) {
+			continue
+		}
+
+		objects, err := t.store.List(ctx, storage.ListOptions{Prefix: Prefix + entry.Package + "/"})
+		if err != nil {
+			return count, size, fmt.Errorf("failed to list trash for %s: %w", entry.Package, err)
+		}
+		for _, obj := range objects {
+			if err := t.store.Delete(ctx, obj.Key); err != nil {
+				log.Warn().Err(err).Str("key", obj.Key).Msg("Failed to purge trash file")
+				continue
+			}
+			count++
+			size += obj.Size
+		}
+
+		log.Info().Str("package", entry.Package).Msg("Expired package purged from trash")
+	}
+
+	return count, size, nil
+}
+
+// Start purges expired packages every interval until Stop is called
+func (t *Trash) Start(interval time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	t.done = make(chan struct{})
+
+	go func() {
+		defer close(t.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, _, err := t.Purge(ctx); err != nil && ctx.Err() == nil {
+					log.Error().Err(err).Msg("Trash purge failed")
+				}
+			}
+		}
+	}()
+}
+
+// Stop halts the purge loop started by Start
+func (t *Trash) Stop() {
+	if t.cancel == nil {
+		return
+	}
+	t.cancel()
+	<-t.done
+}
@@ -0,0 +1,213 @@
+package trash
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+func newStore(t *testing.T, files map[string]string) (storage.Storage, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	store, err := storage.NewLocalStorage(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+
+	for key, data := range files {
+		if _, err := store.Put(context.Background(), key, strings.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+			t.Fatalf("Put %s failed: %v", key, err)
+		}
+	}
+	return store, dir
+}
+
+func keyLayout(t *testing.T, template string) *storage.KeyLayout {
+	t.Helper()
+
+	keys, err := storage.NewKeyLayout(template)
+	if err != nil {
+		t.Fatalf("NewKeyLayout failed: %v", err)
+	}
+	return keys
+}
+
+func read(t *testing.T, store storage.Storage, key string) string {
+	t.Helper()
+
+	reader, _, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get %s failed: %v", key, err)
+	}
+	defer func() { _ = reader.Close() }()
+	data, _ := io.ReadAll(reader)
+	return string(data)
+}
+
+func TestMoveAndRestore(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newStore(t, map[string]string{
+		"packages/numpy/numpy-1.0.tar.gz": "old",
+		"packages/numpy/numpy-2.0.tar.gz": "new",
+		"packages/six/six-1.0.tar.gz":     "six",
+	})
+	tr := New(store, keyLayout(t, storage.DefaultKeyTemplate), time.Hour)
+
+	entry, err := tr.Move(ctx, "numpy")
+	if err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if entry.Files != 2 || entry.Bytes != 6 {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	if exists, _ := store.Exists(ctx, "packages/numpy/numpy-1.0.tar.gz"); exists {
+		t.Error("Moved file should no longer be cached")
+	}
+	if exists, _ := store.Exists(ctx, "packages/six/six-1.0.tar.gz"); !exists {
+		t.Error("Other packages must not be touched")
+	}
+
+	entries, err := tr.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Package != "numpy" || entries[0].Files != 2 {
+		t.Errorf("Unexpected trash listing: %+v", entries)
+	}
+
+	// Re-cached after the delete: the fresh copy wins
+	if _, err := store.Put(ctx, "packages/numpy/numpy-2.0.tar.gz", strings.NewReader("fresh"), 5, "application/octet-stream"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	result, err := tr.Restore(ctx, "numpy")
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if result.Restored != 1 || result.Skipped != 1 {
+		t.Errorf("Expected 1 restored and 1 skipped, got %+v", result)
+	}
+	if got := read(t, store, "packages/numpy/numpy-1.0.tar.gz"); got != "old" {
+		t.Errorf("Restored content = %q, want %q", got, "old")
+	}
+	if got := read(t, store, "packages/numpy/numpy-2.0.tar.gz"); got != "fresh" {
+		t.Errorf("Re-cached content = %q, want %q", got, "fresh")
+	}
+
+	if _, err := tr.Restore(ctx, "numpy"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after restore, got %v", err)
+	}
+}
+
+func TestMoveAndRestore_ShardedLayout(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newStore(t, map[string]string{
+		"packages/n/numpy/numpy-1.0.tar.gz": "numpy",
+	})
+	tr := New(store, keyLayout(t, "packages/{p1}/{package}/{file}"), time.Hour)
+
+	if _, err := tr.Move(ctx, "numpy"); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if got := read(t, store, "trash/numpy/numpy-1.0.tar.gz"); got != "numpy" {
+		t.Errorf("Trashed content = %q, want %q", got, "numpy")
+	}
+
+	if _, err := tr.Restore(ctx, "numpy"); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if got := read(t, store, "packages/n/numpy/numpy-1.0.tar.gz"); got != "numpy" {
+		t.Errorf("Restored content = %q, want %q", got, "numpy")
+	}
+}
+
+func TestPurge_RemovesExpiredPackages(t *testing.T) {
+	ctx := context.Background()
+	store, dir := newStore(t, map[string]string{
+		"trash/numpy/numpy-1.0.tar.gz": "expired",
+		"trash/six/six-1.0.tar.gz":     "recent",
+	})
+	tr := New(store, keyLayout(t, storage.DefaultKeyTemplate), 24*time.Hour)
+
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "trash/numpy/numpy-1.0.tar.gz"), old, old); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+
+	count, size, err := tr.Purge(ctx)
+	if err != nil {
+		t.Fatalf("Purge failed: %v", err)
+	}
+	if count != 1 || size != 7 {
+		t.Errorf("Expected 1 file (7 bytes) purged, got %d (%d bytes)", count, size)
+	}
+
+	entries, err := tr.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Package != "six" {
+		t.Errorf("Expected only six left in trash, got %+v", entries)
+	}
+}
+
+func TestMove_KeptOutOfEviction(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := storage.NewLRULocalStorage(dir, 10, 0)
+	if err != nil {
+		t.Fatalf("NewLRULocalStorage failed: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	put := func(key string) {
+		if _, err := store.Put(ctx, key, strings.NewReader("0123456789"), 10, "application/octet-stream"); err != nil {
+			t.Fatalf("Put %s failed: %v", key, err)
+		}
+	}
+
+	put("packages/numpy/numpy-1.0.tar.gz")
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "packages/numpy/numpy-1.0.tar.gz"), old, old); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	tr := New(store, keyLayout(t, storage.DefaultKeyTemplate), time.Hour)
+	if _, err := tr.Move(ctx, "numpy"); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	// The trashed file no longer counts against the size limit
+	put("packages/six/six-1.0.tar.gz")
+	if size := store.GetStats()["current_size_bytes"]; size != int64(10) {
+		t.Errorf("Expected only the cached file counted, got %v bytes", size)
+	}
+
+	// Going over the limit evicts cached files, never the trash
+	put("packages/six/six-1.1.tar.gz")
+	deadline := time.Now().Add(5 * time.Second)
+	for store.GetStats()["current_size_bytes"] != int64(10) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if exists, _ := store.Exists(ctx, "packages/six/six-1.0.tar.gz"); exists {
+		t.Error("Expected the least recently used cached file evicted")
+	}
+	if got := read(t, store, "trash/numpy/numpy-1.0.tar.gz"); got != "0123456789" {
+		t.Errorf("Trashed content = %q, want it kept", got)
+	}
+
+	// Moving stamps the file, so its retention runs from the delete
+	entries, err := tr.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].DeletedAt.Before(old.Add(time.Minute)) {
+		t.Errorf("Expected the delete time of the move, got %+v", entries)
+	}
+}
@@ -0,0 +1,43 @@
+package upstream
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// BasicAuth returns a transport adding basic auth credentials to requests
+// for the host of indexURL. Requests to other hosts, such as a public file
+// CDN the index links to, are sent without them. If username is empty, next
+// is returned unchanged.
+func BasicAuth(next http.RoundTripper, indexURL, username, password string) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if username == "" {
+		return next
+	}
+
+	parsed, err := url.Parse(indexURL)
+	if err != nil || parsed.Host == "" {
+		return next
+	}
+	return &authTransport{next: next, host: parsed.Host, username: username, password: password}
+}
+
+type authTransport struct {
+	next     http.RoundTripper
+	host     string
+	username string
+	password string
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		return t.next.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(t.username, t.password)
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,69 @@
+package upstream
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasicAuth_OnlyForIndexHost(t *testing.T) {
+	var gotAuth bool
+	index := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		gotAuth = ok && user == "ci" && pass == "secret"
+	}))
+	defer index.Close()
+
+	var leaked bool
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, leaked = r.BasicAuth()
+	}))
+	defer files.Close()
+
+	client := &http.Client{Transport: BasicAuth(nil, index.URL+"/simple/", "ci", "secret")}
+
+	for _, url := range []string{index.URL + "/simple/numpy/", files.URL + "/numpy.whl"} {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", url, err)
+		}
+		_ = resp.Body.Close()
+	}
+
+	if !gotAuth {
+		t.Error("Expected credentials on requests to the index host")
+	}
+	if leaked {
+		t.Error("Credentials must not be sent to other hosts")
+	}
+}
+
+func TestBasicAuth_NoCredentials(t *testing.T) {
+	if BasicAuth(nil, "https://pypi.org/simple/", "", "") != http.DefaultTransport {
+		t.Error("Expected transport to be unchanged without credentials")
+	}
+}
+
+func TestUserAgent_ReplacesHeader(t *testing.T) {
+	var got string
+	index := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+	}))
+	defer index.Close()
+
+	client := &http.Client{Transport: UserAgent(nil, "groxpi/1.4.0 (+ops@example.com)")}
+	req, _ := http.NewRequest(http.MethodGet, index.URL, nil)
+	req.Header.Set("User-Agent", "groxpi/dev")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if got != "groxpi/1.4.0 (+ops@example.com)" {
+		t.Errorf("Expected configured User-Agent, got %q", got)
+	}
+	if req.Header.Get("User-Agent") != "groxpi/dev" {
+		t.Error("The caller's request must not be modified")
+	}
+}
@@ -0,0 +1,94 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Health tracks consecutive upstream failures and reports when upstream goes
+// down and comes back, rather than once per failed request. A failure is a
+// transport error or a 5xx answer; canceled requests are ignored.
+type Health struct {
+	threshold int
+	onChange  func(down bool, err error)
+
+	mu       sync.Mutex
+	failures int
+	down     bool
+}
+
+// NewHealth creates a tracker calling onChange with down=true after
+// threshold consecutive failures, and with down=false on the next success.
+// It returns nil when threshold is not positive; a nil tracker observes
+// nothing.
+func NewHealth(threshold int, onChange func(down bool, err error)) *Health {
+	if threshold <= 0 {
+		return nil
+	}
+	return &Health{threshold: threshold, onChange: onChange}
+}
+
+// Down reports whether upstream is currently considered down
+func (h *Health) Down() bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.down
+}
+
+// Observe records the outcome of one upstream request
+func (h *Health) Observe(resp *http.Response, err error) {
+	if h == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	if err == nil && resp != nil && resp.StatusCode >= 500 {
+		err = fmt.Errorf("upstream returned %d", resp.StatusCode)
+	}
+
+	h.mu.Lock()
+	var changed bool
+	if err != nil {
+		h.failures++
+		changed = !h.down && h.failures >= h.threshold
+		if changed {
+			h.down = true
+		}
+	} else {
+		h.failures = 0
+		changed = h.down
+		h.down = false
+	}
+	down := h.down
+	h.mu.Unlock()
+
+	if changed && h.onChange != nil {
+		h.onChange(down, err)
+	}
+}
+
+// Transport wraps next so every request made through it is observed
+func (h *Health) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if h == nil {
+		return next
+	}
+	return &observedTransport{health: h, next: next}
+}
+
+type observedTransport struct {
+	health *Health
+	next   http.RoundTripper
+}
+
+func (t *observedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	t.health.Observe(resp, err)
+	return resp, err
+}
@@ -0,0 +1,74 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewHealth_DisabledWhenZero(t *testing.T) {
+	h := NewHealth(0, nil)
+	if h != nil {
+		t.Fatal("Expected nil tracker for zero threshold")
+	}
+
+	h.Observe(nil, errors.New("boom"))
+	if h.Down() {
+		t.Error("Nil tracker should never report down")
+	}
+	if h.Transport(nil) != http.DefaultTransport {
+		t.Error("Nil tracker should not wrap the transport")
+	}
+}
+
+func TestHealth_DownAndRecovered(t *testing.T) {
+	var changes []bool
+	h := NewHealth(2, func(down bool, err error) {
+		changes = append(changes, down)
+		if down && err == nil {
+			t.Error("Expected the failure that took upstream down")
+		}
+	})
+
+	h.Observe(nil, errors.New("connection refused"))
+	if h.Down() {
+		t.Error("One failure should not mark upstream down")
+	}
+
+	h.Observe(&http.Response{StatusCode: http.StatusBadGateway}, nil)
+	h.Observe(nil, errors.New("connection refused")) // Already down, no second change
+	if !h.Down() {
+		t.Error("Expected upstream down after consecutive failures")
+	}
+
+	h.Observe(nil, context.Canceled) // Client gave up; says nothing about upstream
+	h.Observe(&http.Response{StatusCode: http.StatusNotFound}, nil)
+	if h.Down() {
+		t.Error("Expected upstream recovered after a non-5xx answer")
+	}
+
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Errorf("Expected down then recovered, got %v", changes)
+	}
+}
+
+func TestHealth_Transport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+
+	h := NewHealth(1, nil)
+	client := &http.Client{Transport: h.Transport(nil)}
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if !h.Down() {
+		t.Error("Expected a 503 through the transport to mark upstream down")
+	}
+}
@@ -0,0 +1,142 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// ErrQueueTimeout is returned when a request waited longer than the queue
+// timeout for an upstream slot
+var ErrQueueTimeout = errors.New("timed out waiting for an upstream connection slot")
+
+// Stats is a snapshot of limiter usage
+type Stats struct {
+	MaxConcurrency int   `json:"max_concurrency"`
+	Active         int64 `json:"active"`
+	Waiting        int64 `json:"waiting"`
+	Rejected       int64 `json:"rejected"`
+}
+
+// Limiter bounds the number of concurrent upstream requests across the
+// process. Requests beyond the limit queue in arrival order for up to the
+// queue timeout. A slot is held until the response body is closed, so
+// streamed file downloads count for their whole duration.
+type Limiter struct {
+	sem          *semaphore.Weighted
+	max          int
+	queueTimeout time.Duration
+
+	active   atomic.Int64
+	waiting  atomic.Int64
+	rejected atomic.Int64
+}
+
+// NewLimiter creates a limiter allowing max concurrent requests. It returns
+// nil when max is not positive; a nil limiter does not limit anything.
+func NewLimiter(max int, queueTimeout time.Duration) *Limiter {
+	if max <= 0 {
+		return nil
+	}
+	return &Limiter{
+		sem:          semaphore.NewWeighted(int64(max)),
+		max:          max,
+		queueTimeout: queueTimeout,
+	}
+}
+
+// Acquire waits for a slot and returns a function releasing it
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	if l.queueTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.queueTimeout)
+		defer cancel()
+	}
+
+	l.waiting.Add(1)
+	err := l.sem.Acquire(ctx, 1)
+	l.waiting.Add(-1)
+	if err != nil {
+		l.rejected.Add(1)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, ErrQueueTimeout
+		}
+		return nil, err
+	}
+
+	l.active.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.active.Add(-1)
+			l.sem.Release(1)
+		})
+	}, nil
+}
+
+// Stats returns current usage
+func (l *Limiter) Stats() Stats {
+	if l == nil {
+		return Stats{}
+	}
+	return Stats{
+		MaxConcurrency: l.max,
+		Active:         l.active.Load(),
+		Waiting:        l.waiting.Load(),
+		Rejected:       l.rejected.Load(),
+	}
+}
+
+// Transport wraps next so every request made through it holds a slot
+func (l *Limiter) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if l == nil {
+		return next
+	}
+	return &limitedTransport{limiter: l, next: next}
+}
+
+type limitedTransport struct {
+	limiter *Limiter
+	next    http.RoundTripper
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.limiter.Acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody frees the limiter slot when the response body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,103 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewLimiter_DisabledWhenZero(t *testing.T) {
+	l := NewLimiter(0, time.Second)
+	if l != nil {
+		t.Fatal("Expected nil limiter for zero concurrency")
+	}
+
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Nil limiter should never block: %v", err)
+	}
+	release()
+
+	if l.Transport(nil) != http.DefaultTransport {
+		t.Error("Nil limiter should not wrap the transport")
+	}
+}
+
+func TestLimiter_QueueTimeout(t *testing.T) {
+	l := NewLimiter(1, 20*time.Millisecond)
+
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	if _, err := l.Acquire(context.Background()); !errors.Is(err, ErrQueueTimeout) {
+		t.Errorf("Expected ErrQueueTimeout, got %v", err)
+	}
+	if stats := l.Stats(); stats.Active != 1 || stats.Rejected != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	release()
+	release() // Releasing twice must not free a second slot
+
+	if _, err := l.Acquire(context.Background()); err != nil {
+		t.Errorf("Expected slot after release, got %v", err)
+	}
+	if _, err := l.Acquire(context.Background()); !errors.Is(err, ErrQueueTimeout) {
+		t.Errorf("Double release freed an extra slot: %v", err)
+	}
+}
+
+func TestTransport_HoldsSlotUntilBodyClosed(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+		_, _ = io.WriteString(w, "ok")
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	l := NewLimiter(2, 5*time.Second)
+	client := &http.Client{Transport: l.Transport(nil)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(srv.URL)
+			if err != nil {
+				t.Errorf("Request failed: %v", err)
+				return
+			}
+			_, _ = io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("Expected at most 2 concurrent upstream requests, saw %d", peak)
+	}
+	if stats := l.Stats(); stats.Active != 0 || stats.Waiting != 0 {
+		t.Errorf("All slots should be released, got %+v", stats)
+	}
+}
@@ -0,0 +1,298 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phuslu/log"
+
+	"github.com/huyhandes/groxpi/internal/version"
+)
+
+// ProberConfig configures active probing of an index and its mirrors
+type ProberConfig struct {
+	URLs      []string          // Primary index first, then mirrors serving the same packages
+	Path      string            // Probed below each URL, e.g. "pip/"
+	Interval  time.Duration     // Time between probe rounds
+	Timeout   time.Duration     // Per-probe timeout
+	Transport http.RoundTripper // Used for probes (nil = http.DefaultTransport)
+
+	// Hysteresis: an index changes health after Threshold consecutive probes
+	// agree, and a healthy index is only replaced by one at least
+	// SwitchMargin faster (0.3 = 30%) for SwitchRounds rounds in a row
+	Threshold    int
+	SwitchMargin float64
+	SwitchRounds int
+}
+
+// ProbeStatus is the probed state of one index
+type ProbeStatus struct {
+	URL       string        `json:"url"`
+	Active    bool          `json:"active"`
+	Healthy   bool          `json:"healthy"`
+	Latency   time.Duration `json:"latency_ns"` // Moving average of successful probes
+	LastProbe time.Time     `json:"last_probe"`
+	LastError string        `json:"last_error,omitempty"`
+}
+
+// latencyWeight is the weight of the newest sample in the latency average
+const latencyWeight = 0.3
+
+type candidate struct {
+	ProbeStatus
+	streak int // Consecutive probes disagreeing with the current health
+}
+
+// Prober periodically checks every configured index and routes requests to
+// the healthiest one, preferring the current choice unless another is
+// clearly better so requests don't flap between mirrors.
+type Prober struct {
+	cfg    ProberConfig
+	client *http.Client
+
+	mu         sync.Mutex
+	candidates []*candidate
+	active     int
+	challenger int // Index outperforming the active one, -1 = none
+	rounds     int // Consecutive rounds the challenger has led
+	switches   int64
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewProber creates a prober for cfg.URLs. It returns nil when there are no
+// mirrors to choose from; a nil prober resolves every index to itself.
+func NewProber(cfg ProberConfig) *Prober {
+	if len(cfg.URLs) < 2 {
+		return nil
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 1
+	}
+	if cfg.SwitchRounds <= 0 {
+		cfg.SwitchRounds = 1
+	}
+	if cfg.Transport == nil {
+		cfg.Transport = http.DefaultTransport
+	}
+
+	p := &Prober{
+		cfg:        cfg,
+		client:     &http.Client{Transport: cfg.Transport, Timeout: cfg.Timeout},
+		challenger: -1,
+	}
+	for _, u := range cfg.URLs {
+		// Indexes start out healthy so the primary serves until probes say otherwise
+		p.candidates = append(p.candidates, &candidate{ProbeStatus: ProbeStatus{URL: u, Healthy: true}})
+	}
+	return p
+}
+
+// Start probes immediately and then every interval until Stop
+func (p *Prober) Start() {
+	if p == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.done = make(chan struct{})
+
+	go func() {
+		defer close(p.done)
+
+		ticker := time.NewTicker(p.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			p.probe(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends probing
+func (p *Prober) Stop() {
+	if p == nil || p.cancel == nil {
+		return
+	}
+	p.cancel()
+	<-p.done
+}
+
+// Resolve returns the index to send requests for indexURL to: the active
+// index when indexURL is the probed primary, indexURL itself otherwise
+func (p *Prober) Resolve(indexURL string) string {
+	if p == nil || strings.TrimSuffix(indexURL, "/") != strings.TrimSuffix(p.cfg.URLs[0], "/") {
+		return indexURL
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.candidates[p.active].URL
+}
+
+// Status returns the probed state of every index, primary first
+func (p *Prober) Status() []ProbeStatus {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := make([]ProbeStatus, len(p.candidates))
+	for i, c := range p.candidates {
+		status[i] = c.ProbeStatus
+		status[i].Active = i == p.active
+	}
+	return status
+}
+
+// Switches returns how often the active index has changed
+func (p *Prober) Switches() int64 {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.switches
+}
+
+// probe checks every index concurrently and then reconsiders the choice
+func (p *Prober) probe(ctx context.Context) {
+	type result struct {
+		latency time.Duration
+		err     error
+	}
+	results := make([]result, len(p.candidates))
+
+	var wg sync.WaitGroup
+	for i, u := range p.cfg.URLs {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			latency, err := p.probeOne(ctx, u)
+			results[i] = result{latency, err}
+		}(i, u)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for i, c := range p.candidates {
+		r := results[i]
+		c.LastProbe = now
+		c.LastError = ""
+		if r.err != nil {
+			c.LastError = r.err.Error()
+		} else if c.Latency == 0 {
+			c.Latency = r.latency
+		} else {
+			c.Latency = time.Duration(latencyWeight*float64(r.latency) + (1-latencyWeight)*float64(c.Latency))
+		}
+
+		// Health flips only after Threshold probes in a row disagree with it
+		if (r.err == nil) == c.Healthy {
+			c.streak = 0
+			continue
+		}
+		c.streak++
+		if c.streak >= p.cfg.Threshold {
+			c.Healthy = !c.Healthy
+			c.streak = 0
+			log.Info().Str("index_url", c.URL).Bool("healthy", c.Healthy).Str("error", c.LastError).Msg("Index health changed")
+		}
+	}
+
+	p.choose()
+}
+
+// probeOne measures the time to response headers for one index
+func (p *Prober) probeOne(ctx context.Context, indexURL string) (time.Duration, error) {
+	probeURL := strings.TrimSuffix(indexURL, "/") + "/" + strings.TrimPrefix(p.cfg.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/vnd.pypi.simple.v1+json")
+	req.Header.Set("User-Agent", version.UserAgent(""))
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	latency := time.Since(start)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return 0, fmt.Errorf("probe returned %d", resp.StatusCode)
+	}
+	return latency, nil
+}
+
+// choose picks the active index. An unhealthy active index is replaced at
+// once; a healthy one only when a challenger has been clearly faster for
+// SwitchRounds rounds. Callers hold mu.
+func (p *Prober) choose() {
+	best := -1
+	for i, c := range p.candidates {
+		if i == p.active || !c.Healthy || c.Latency == 0 {
+			continue
+		}
+		if best == -1 || c.Latency < p.candidates[best].Latency {
+			best = i
+		}
+	}
+
+	active := p.candidates[p.active]
+	if !active.Healthy {
+		if best != -1 {
+			p.switchTo(best, "active index unhealthy")
+		}
+		return
+	}
+
+	if best == -1 || active.Latency == 0 ||
+		float64(p.candidates[best].Latency) > float64(active.Latency)*(1-p.cfg.SwitchMargin) {
+		p.challenger, p.rounds = -1, 0
+		return
+	}
+	if best != p.challenger {
+		p.challenger, p.rounds = best, 0
+	}
+	p.rounds++
+	if p.rounds >= p.cfg.SwitchRounds {
+		p.switchTo(best, "faster index available")
+	}
+}
+
+// switchTo makes candidate i active. Callers hold mu.
+func (p *Prober) switchTo(i int, reason string) {
+	log.Warn().
+		Str("from", p.candidates[p.active].URL).
+		Str("to", p.candidates[i].URL).
+		Str("reason", reason).
+		Msg("Switching upstream index")
+
+	p.active = i
+	p.challenger, p.rounds = -1, 0
+	p.switches++
+}
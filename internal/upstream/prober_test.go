@@ -0,0 +1,111 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeIndex serves probes with a configurable status and delay
+type fakeIndex struct {
+	*httptest.Server
+	status atomic.Int32
+	delay  atomic.Int64
+}
+
+func newFakeIndex(t *testing.T) *fakeIndex {
+	f := &fakeIndex{}
+	f.status.Store(http.StatusOK)
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/simple/pip/" {
+			t.Errorf("Unexpected probe path %s", r.URL.Path)
+		}
+		time.Sleep(time.Duration(f.delay.Load()))
+		w.WriteHeader(int(f.status.Load()))
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func TestNewProber_DisabledWithoutMirrors(t *testing.T) {
+	p := NewProber(ProberConfig{URLs: []string{"https://pypi.org/simple/"}})
+	if p != nil {
+		t.Fatal("Expected nil prober without mirrors")
+	}
+
+	p.Start()
+	p.Stop()
+	if got := p.Resolve("https://pypi.org/simple/"); got != "https://pypi.org/simple/" {
+		t.Errorf("Nil prober should resolve an index to itself, got %q", got)
+	}
+	if p.Status() != nil || p.Switches() != 0 {
+		t.Error("Nil prober should report nothing")
+	}
+}
+
+func TestProber_SwitchesAwayFromUnhealthyIndex(t *testing.T) {
+	primary, mirror := newFakeIndex(t), newFakeIndex(t)
+	p := NewProber(ProberConfig{
+		URLs:      []string{primary.URL + "/simple/", mirror.URL + "/simple"},
+		Path:      "pip/",
+		Threshold: 2,
+	})
+	ctx := context.Background()
+
+	p.probe(ctx)
+	if got := p.Resolve(primary.URL + "/simple"); got != primary.URL+"/simple/" {
+		t.Fatalf("Expected primary active while healthy, got %q", got)
+	}
+
+	primary.status.Store(http.StatusBadGateway)
+	p.probe(ctx)
+	if p.Switches() != 0 {
+		t.Error("One failed probe should not switch indexes")
+	}
+	p.probe(ctx)
+	if got := p.Resolve(primary.URL + "/simple/"); got != mirror.URL+"/simple" {
+		t.Fatalf("Expected mirror active after primary failures, got %q", got)
+	}
+
+	status := p.Status()
+	if status[0].Healthy || status[0].Active || status[0].LastError == "" || !status[1].Active {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	// Other indexes are never redirected
+	if got := p.Resolve("https://other.example/simple/"); got != "https://other.example/simple/" {
+		t.Errorf("Expected unrelated index unchanged, got %q", got)
+	}
+}
+
+func TestProber_PrefersFasterIndexWithHysteresis(t *testing.T) {
+	primary, mirror := newFakeIndex(t), newFakeIndex(t)
+	primary.delay.Store(int64(50 * time.Millisecond))
+	p := NewProber(ProberConfig{
+		URLs:         []string{primary.URL, mirror.URL},
+		Path:         "/simple/pip/",
+		SwitchMargin: 0.5,
+		SwitchRounds: 2,
+	})
+	ctx := context.Background()
+
+	p.probe(ctx)
+	if p.Resolve(primary.URL) != primary.URL {
+		t.Fatal("Expected a single faster round not to switch")
+	}
+	p.probe(ctx)
+	if p.Resolve(primary.URL) != mirror.URL || p.Switches() != 1 {
+		t.Fatalf("Expected switch to the faster mirror, active=%q switches=%d", p.Resolve(primary.URL), p.Switches())
+	}
+
+	// The primary catching up within the margin does not switch back
+	primary.delay.Store(0)
+	p.probe(ctx)
+	p.probe(ctx)
+	if p.Resolve(primary.URL) != mirror.URL || p.Switches() != 1 {
+		t.Errorf("Expected to stay on the mirror, active=%q switches=%d", p.Resolve(primary.URL), p.Switches())
+	}
+}
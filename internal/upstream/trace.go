@@ -0,0 +1,169 @@
+package upstream
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/logger"
+)
+
+// PhaseStats accumulates the durations of one request phase
+type PhaseStats struct {
+	Count int64         `json:"count"`
+	Total time.Duration `json:"total_ns"`
+}
+
+func (p *PhaseStats) add(d time.Duration) {
+	p.Count++
+	p.Total += d
+}
+
+// TraceStats are the connection timings of requests to one upstream host.
+// Phases are only counted when they happened: a request on a reused
+// connection has no DNS, connect or TLS phase.
+type TraceStats struct {
+	Requests int64      `json:"requests"`
+	Reused   int64      `json:"connections_reused"`
+	DNS      PhaseStats `json:"dns"`
+	Connect  PhaseStats `json:"connect"`
+	TLS      PhaseStats `json:"tls"`
+	TTFB     PhaseStats `json:"ttfb"` // Request written to first response byte
+}
+
+// Tracer times the phases of upstream requests with httptrace, so slow DNS,
+// TLS handshakes or connections that are not being reused show up in
+// metrics and debug logs. A nil tracer traces nothing.
+type Tracer struct {
+	mu    sync.Mutex
+	hosts map[string]*TraceStats
+}
+
+// NewTracer creates a tracer with no recorded requests
+func NewTracer() *Tracer {
+	return &Tracer{hosts: make(map[string]*TraceStats)}
+}
+
+// Stats returns the timings recorded so far, by host
+func (t *Tracer) Stats() map[string]TraceStats {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make(map[string]TraceStats, len(t.hosts))
+	for host, s := range t.hosts {
+		stats[host] = *s
+	}
+	return stats
+}
+
+// Transport wraps next so every request made through it is traced
+func (t *Tracer) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if t == nil {
+		return next
+	}
+	return &tracedTransport{tracer: t, next: next}
+}
+
+type tracedTransport struct {
+	tracer *Tracer
+	next   http.RoundTripper
+}
+
+// requestTrace collects one request's phase timings. Dials can finish on
+// another goroutine after the response, hence the lock.
+type requestTrace struct {
+	mu                            sync.Mutex
+	reused                        bool
+	dnsStart, connStart, tlsStart time.Time
+	wrote                         time.Time
+	dns, connect, tls, ttfb       time.Duration
+}
+
+func (t *tracedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt := &requestTrace{}
+	at := func(fn func()) {
+		rt.mu.Lock()
+		fn()
+		rt.mu.Unlock()
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { at(func() { rt.dnsStart = time.Now() }) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { at(func() { rt.dns = time.Since(rt.dnsStart) }) },
+		ConnectStart: func(string, string) {
+			at(func() {
+				if rt.connStart.IsZero() {
+					rt.connStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(_, _ string, err error) {
+			at(func() {
+				if err == nil && rt.connect == 0 {
+					rt.connect = time.Since(rt.connStart)
+				}
+			})
+		},
+		TLSHandshakeStart: func() { at(func() { rt.tlsStart = time.Now() }) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			at(func() {
+				if err == nil {
+					rt.tls = time.Since(rt.tlsStart)
+				}
+			})
+		},
+		GotConn:      func(info httptrace.GotConnInfo) { at(func() { rt.reused = info.Reused }) },
+		WroteRequest: func(httptrace.WroteRequestInfo) { at(func() { rt.wrote = time.Now() }) },
+		GotFirstResponseByte: func() {
+			at(func() {
+				if !rt.wrote.IsZero() {
+					rt.ttfb = time.Since(rt.wrote)
+				}
+			})
+		},
+	}
+
+	resp, err := t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+
+	rt.mu.Lock()
+	reused, dns, connect, tlsTime, ttfb := rt.reused, rt.dns, rt.connect, rt.tls, rt.ttfb
+	rt.mu.Unlock()
+
+	t.tracer.mu.Lock()
+	stats := t.tracer.hosts[req.URL.Host]
+	if stats == nil {
+		stats = &TraceStats{}
+		t.tracer.hosts[req.URL.Host] = stats
+	}
+	stats.Requests++
+	if reused {
+		stats.Reused++
+	}
+	for _, phase := range []struct {
+		stats *PhaseStats
+		d     time.Duration
+	}{{&stats.DNS, dns}, {&stats.Connect, connect}, {&stats.TLS, tlsTime}, {&stats.TTFB, ttfb}} {
+		if phase.d > 0 {
+			phase.stats.add(phase.d)
+		}
+	}
+	t.tracer.mu.Unlock()
+
+	logger.FromContext(req.Context()).Debug().
+		Str("host", req.URL.Host).
+		Bool("reused", reused).
+		Dur("dns", dns).
+		Dur("connect", connect).
+		Dur("tls", tlsTime).
+		Dur("ttfb", ttfb).
+		Msg("Upstream connection timings")
+
+	return resp, err
+}
@@ -0,0 +1,54 @@
+package upstream
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestTracer_Nil(t *testing.T) {
+	var tracer *Tracer
+	if tracer.Transport(nil) != http.DefaultTransport {
+		t.Error("Nil tracer should not wrap the transport")
+	}
+	if tracer.Stats() != nil {
+		t.Error("Nil tracer should have no stats")
+	}
+}
+
+func TestTracer_Phases(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	tracer := NewTracer()
+	client := &http.Client{Transport: tracer.Transport(server.Client().Transport)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	u, _ := url.Parse(server.URL)
+	stats, ok := tracer.Stats()[u.Host]
+	if !ok {
+		t.Fatalf("Expected stats for %s, got %+v", u.Host, tracer.Stats())
+	}
+	// The second request reuses the first one's connection, so it has no
+	// connect or TLS phase
+	if stats.Requests != 2 || stats.Reused != 1 {
+		t.Errorf("Expected 2 requests with 1 reused, got %+v", stats)
+	}
+	if stats.Connect.Count != 1 || stats.TLS.Count != 1 || stats.TLS.Total <= 0 {
+		t.Errorf("Expected one connect and TLS handshake, got %+v", stats)
+	}
+	if stats.TTFB.Count != 2 {
+		t.Errorf("Expected a TTFB for each request, got %+v", stats.TTFB)
+	}
+}
@@ -0,0 +1,28 @@
+package upstream
+
+import "net/http"
+
+// UserAgent returns a transport sending every request with the given
+// User-Agent, replacing whatever the caller set. If userAgent is empty,
+// next is returned unchanged.
+func UserAgent(next http.RoundTripper, userAgent string) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if userAgent == "" {
+		return next
+	}
+	return &userAgentTransport{next: next, userAgent: userAgent}
+}
+
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,105 @@
+// Package version reports the groxpi build version and the User-Agent
+// groxpi identifies itself with upstream.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Build details, injected at build time:
+//
+//	go build -ldflags "-X github.com/huyhandes/groxpi/internal/version.Version=1.4.0
+//	  -X github.com/huyhandes/groxpi/internal/version.Commit=$(git rev-parse HEAD)
+//	  -X github.com/huyhandes/groxpi/internal/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/groxpi
+//
+// When they are not set, the version falls back to the module version
+// recorded by "go install" and the commit and date to the VCS stamp of the
+// build, if any.
+var (
+	Version   = ""
+	Commit    = ""
+	BuildDate = ""
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // Built from a tree with uncommitted changes
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// Info returns the build details of the running binary
+func Info() BuildInfo {
+	info := BuildInfo{
+		Version:   Get(),
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+// String formats the build details on one line, as printed by --version
+func (b BuildInfo) String() string {
+	s := "groxpi " + b.Version
+	if b.Commit != "" {
+		commit := b.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		if b.Modified {
+			commit += "-dirty"
+		}
+		s += " (" + commit
+		if b.BuildDate != "" {
+			s += ", " + b.BuildDate
+		}
+		s += ")"
+	}
+	return fmt.Sprintf("%s %s %s", s, b.GoVersion, b.Platform)
+}
+
+// Get returns the groxpi version
+func Get() string {
+	if Version != "" {
+		return strings.TrimPrefix(Version, "v")
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return strings.TrimPrefix(info.Main.Version, "v")
+	}
+	return "dev"
+}
+
+// UserAgent returns the User-Agent for upstream requests. PyPI asks
+// automated clients to say how to reach their operator, so a contact (a URL
+// or email address) is appended when given: "groxpi/1.4.0 (+ops@example.com)".
+func UserAgent(contact string) string {
+	ua := "groxpi/" + Get()
+	if contact = strings.TrimSpace(contact); contact != "" {
+		ua += " (+" + contact + ")"
+	}
+	return ua
+}
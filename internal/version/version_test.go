@@ -0,0 +1,50 @@
+package version
+
+import "testing"
+
+func TestGet_Injected(t *testing.T) {
+	defer func(v string) { Version = v }(Version)
+
+	Version = "v1.4.0"
+	if got := Get(); got != "1.4.0" {
+		t.Errorf("Expected 1.4.0, got %q", got)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	defer func(v string) { Version = v }(Version)
+	Version = "1.4.0"
+
+	testCases := []struct {
+		contact  string
+		expected string
+	}{
+		{"", "groxpi/1.4.0"},
+		{"  ", "groxpi/1.4.0"},
+		{"ops@example.com", "groxpi/1.4.0 (+ops@example.com)"},
+		{"https://example.com/pypi-proxy", "groxpi/1.4.0 (+https://example.com/pypi-proxy)"},
+	}
+	for _, tc := range testCases {
+		if got := UserAgent(tc.contact); got != tc.expected {
+			t.Errorf("UserAgent(%q) = %q, expected %q", tc.contact, got, tc.expected)
+		}
+	}
+}
+
+func TestInfo_Injected(t *testing.T) {
+	defer func(v, c, d string) { Version, Commit, BuildDate = v, c, d }(Version, Commit, BuildDate)
+	Version, Commit, BuildDate = "1.4.0", "0123456789abcdef0123", "2024-05-01T10:00:00Z"
+
+	info := Info()
+	if info.Version != "1.4.0" || info.Commit != Commit || info.BuildDate != BuildDate {
+		t.Errorf("Expected injected build details, got %+v", info)
+	}
+	if info.GoVersion == "" || info.Platform == "" {
+		t.Errorf("Expected Go version and platform, got %+v", info)
+	}
+
+	info.Modified = false
+	if got, want := info.String(), "groxpi 1.4.0 (0123456789ab, 2024-05-01T10:00:00Z) "+info.GoVersion+" "+info.Platform; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
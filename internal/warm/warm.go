@@ -0,0 +1,310 @@
+// Package warm pre-fetches the files pinned by a lockfile into storage so
+// caches are hot before a release day
+package warm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phuslu/log"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/huyhandes/groxpi/internal/cachekey"
+	"github.com/huyhandes/groxpi/internal/jobs"
+	"github.com/huyhandes/groxpi/internal/lockfile"
+	"github.com/huyhandes/groxpi/internal/pypi"
+	"github.com/huyhandes/groxpi/internal/storage"
+	"github.com/huyhandes/groxpi/internal/streaming"
+)
+
+// fileTimeout bounds a single file download, like the mirror's
+const fileTimeout = 30 * time.Minute
+
+// JobKind identifies warm jobs in the job manager
+const JobKind = "warm"
+
+// Index is the subset of the PyPI client used to resolve lockfile entries
+// and download the files they pin
+type Index interface {
+	GetPackageFilesContext(ctx context.Context, packageName string) ([]pypi.FileInfo, error)
+	DownloadFileContext(ctx context.Context, url, dest string, opts pypi.DownloadOptions) (*pypi.Download, error)
+}
+
+// Config configures cache warming
+type Config struct {
+	Workers int // Concurrent file downloads per job
+
+	// Keys is the storage key layout the server reads cached files from
+	// (nil = storage.DefaultKeyTemplate)
+	Keys *storage.KeyLayout
+
+	// Jobs tracks warm jobs (nil = a private in-memory manager)
+	Jobs *jobs.Manager
+
+	// TempDir holds files while they are downloaded and verified, before
+	// they are stored ("" = the system temp directory)
+	TempDir string
+}
+
+// Progress reports how far a warm job got
+type Progress struct {
+	Requirements    int      `json:"requirements"`
+	FilesTotal      int      `json:"files_total"`
+	FilesDownloaded int      `json:"files_downloaded"`
+	FilesSkipped    int      `json:"files_skipped"` // Already in storage
+	FilesFailed     int      `json:"files_failed"`
+	BytesDownloaded int64    `json:"bytes_downloaded"`
+	Unresolved      []string `json:"unresolved,omitempty"` // Requirements matching no upstream file
+	LastError       string   `json:"last_error,omitempty"`
+}
+
+// Warmer runs cache warming jobs in the background
+type Warmer struct {
+	cfg      Config
+	index    Index
+	storage  storage.Storage
+	writer   streaming.StorageWriter
+	ownsJobs bool // Stop the manager on Stop
+}
+
+// New creates a warmer. Files are downloaded and checked against their
+// published digest, then stored through writer under the same keys the
+// server reads from.
+func New(cfg Config, index Index, store storage.Storage, writer streaming.StorageWriter) *Warmer {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.Keys == nil {
+		cfg.Keys, _ = storage.NewKeyLayout(storage.DefaultKeyTemplate)
+	}
+	ownsJobs := cfg.Jobs == nil
+	if ownsJobs {
+		cfg.Jobs = jobs.NewManager(nil, false)
+	}
+
+	return &Warmer{
+		cfg:      cfg,
+		index:    index,
+		storage:  store,
+		writer:   writer,
+		ownsJobs: ownsJobs,
+	}
+}
+
+// Submit starts a job fetching the files pinned by reqs and returns its
+// initial state
+func (w *Warmer) Submit(reqs []lockfile.Requirement) jobs.Job {
+	job := w.cfg.Jobs.Start(JobKind, func(ctx context.Context, p *jobs.Progress) (interface{}, error) {
+		return nil, w.run(ctx, p, reqs)
+	})
+	log.Info().Str("job", job.ID).Int("requirements", len(reqs)).Msg("Cache warm job submitted")
+	return job
+}
+
+// Status returns a snapshot of a warm job
+func (w *Warmer) Status(id string) (jobs.Job, bool) {
+	job, ok := w.cfg.Jobs.Get(id)
+	if !ok || job.Kind != JobKind {
+		return jobs.Job{}, false
+	}
+	return job, true
+}
+
+// Stop cancels running jobs and waits for them to exit when the warmer
+// owns its job manager; a shared manager is stopped by its owner
+func (w *Warmer) Stop() {
+	if w.ownsJobs {
+		w.cfg.Jobs.Stop()
+	}
+}
+
+// tracker guards a job's progress
+type tracker struct {
+	mu       sync.Mutex
+	progress Progress
+}
+
+func (t *tracker) update(fn func(p *Progress)) {
+	t.mu.Lock()
+	fn(&t.progress)
+	t.mu.Unlock()
+}
+
+func (t *tracker) snapshot() interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.progress
+	p.Unresolved = append([]string(nil), t.progress.Unresolved...)
+	return p
+}
+
+func (w *Warmer) run(ctx context.Context, jp *jobs.Progress, reqs []lockfile.Requirement) error {
+	start := time.Now()
+	t := &tracker{progress: Progress{Requirements: len(reqs)}}
+	jp.Report(t.snapshot)
+
+	type target struct {
+		pkg  string
+		file pypi.FileInfo
+	}
+	var targets []target
+	for _, req := range reqs {
+		if ctx.Err() != nil {
+			break
+		}
+		pkg := cachekey.Package(req.Name)
+		files, err := w.resolve(ctx, pkg, req)
+		if err != nil || len(files) == 0 {
+			t.update(func(p *Progress) {
+				p.Unresolved = append(p.Unresolved, describe(req))
+				if err != nil {
+					p.LastError = fmt.Sprintf("%s: %v", pkg, err)
+				}
+			})
+			continue
+		}
+		for _, file := range files {
+			targets = append(targets, target{pkg: pkg, file: file})
+		}
+	}
+	t.update(func(p *Progress) { p.FilesTotal = len(targets) })
+
+	dir, err := os.MkdirTemp(w.cfg.TempDir, "groxpi-warm-")
+	if err != nil {
+		return fmt.Errorf("failed to create download directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	sem := semaphore.NewWeighted(int64(w.cfg.Workers))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sem.Release(1)
+			w.fetch(ctx, t, filepath.Join(dir, strconv.Itoa(i)), target.pkg, target.file)
+		}()
+	}
+	wg.Wait()
+
+	progress := t.snapshot().(Progress)
+	log.Info().
+		Int("files", progress.FilesTotal).
+		Int("downloaded", progress.FilesDownloaded).
+		Int("skipped", progress.FilesSkipped).
+		Int("failed", progress.FilesFailed).
+		Int("unresolved", len(progress.Unresolved)).
+		Int64("bytes", progress.BytesDownloaded).
+		Dur("duration", time.Since(start)).
+		Msg("Cache warm job finished")
+
+	return ctx.Err()
+}
+
+// resolve returns the upstream files a requirement pins: those matching one
+// of its hashes, or else every file of its version
+func (w *Warmer) resolve(ctx context.Context, pkg string, req lockfile.Requirement) ([]pypi.FileInfo, error) {
+	if req.Version == "" && len(req.Hashes) == 0 {
+		return nil, nil // Unpinned; picking a version would be guesswork
+	}
+
+	files, err := w.index.GetPackageFilesContext(ctx, pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[string]bool, len(req.Hashes))
+	for _, h := range req.Hashes {
+		hashes[h] = true
+	}
+
+	var matched []pypi.FileInfo
+	for _, file := range files {
+		if sha := strings.ToLower(file.SHA256()); len(hashes) > 0 && sha != "" {
+			if hashes[sha] {
+				matched = append(matched, file)
+			}
+			continue
+		}
+		if req.Version != "" && strings.EqualFold(pypi.FileVersion(file.Name), req.Version) {
+			matched = append(matched, file)
+		}
+	}
+	return matched, nil
+}
+
+// fetch downloads file to dest, then stores it unless its digest didn't
+// match the index's
+func (w *Warmer) fetch(ctx context.Context, t *tracker, dest, pkg string, file pypi.FileInfo) {
+	key := w.cfg.Keys.Key(pkg, file.Name)
+
+	if exists, err := w.storage.Exists(ctx, key); err == nil && exists {
+		t.update(func(p *Progress) { p.FilesSkipped++ })
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(storage.WithMetadata(ctx, file.StorageMetadata(time.Now())), fileTimeout)
+	defer cancel()
+
+	var reported int64
+	download, err := w.index.DownloadFileContext(ctx, file.URL, dest, pypi.DownloadOptions{
+		ExpectedSHA256: file.SHA256(),
+		Progress: func(written, _ int64) {
+			delta := written - reported
+			reported = written
+			t.update(func(p *Progress) { p.BytesDownloaded += delta })
+		},
+	})
+	if err == nil {
+		err = w.store(ctx, key, download)
+		_ = os.Remove(dest)
+	}
+
+	t.update(func(p *Progress) {
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				p.FilesFailed++
+				p.LastError = err.Error()
+				log.Warn().Err(err).Str("key", key).Msg("Failed to warm file")
+			}
+			return
+		}
+		p.FilesDownloaded++
+	})
+}
+
+// store writes a verified download to storage
+func (w *Warmer) store(ctx context.Context, key string, download *pypi.Download) error {
+	f, err := os.Open(download.Path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	contentType := download.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if err := w.writer.Put(ctx, key, f, download.Size, contentType); err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	return nil
+}
+
+// describe renders a requirement for the unresolved list
+func describe(req lockfile.Requirement) string {
+	if req.Version == "" {
+		return req.Name + " (not pinned)"
+	}
+	return req.Name + "==" + req.Version
+}
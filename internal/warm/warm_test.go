@@ -0,0 +1,167 @@
+package warm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huyhandes/groxpi/internal/config"
+	"github.com/huyhandes/groxpi/internal/jobs"
+	"github.com/huyhandes/groxpi/internal/lockfile"
+	"github.com/huyhandes/groxpi/internal/pypi"
+	"github.com/huyhandes/groxpi/internal/storage"
+)
+
+// fileContent is what the test file server sends for a file
+func fileContent(name string) string {
+	return "contents of /files/" + name
+}
+
+// digest is the published sha256 of a file
+func digest(name string) string {
+	sum := sha256.Sum256([]byte(fileContent(name)))
+	return hex.EncodeToString(sum[:])
+}
+
+// fakeIndex serves fixed files whose URLs point at baseURL, downloading
+// them with a real client
+type fakeIndex struct {
+	*pypi.Client
+	baseURL  string
+	packages map[string][]string
+}
+
+func (f *fakeIndex) GetPackageFilesContext(ctx context.Context, packageName string) ([]pypi.FileInfo, error) {
+	filenames, ok := f.packages[packageName]
+	if !ok {
+		return nil, fmt.Errorf("package %s not found", packageName)
+	}
+
+	files := make([]pypi.FileInfo, 0, len(filenames))
+	for _, name := range filenames {
+		files = append(files, pypi.FileInfo{
+			Name:   name,
+			URL:    f.baseURL + "/files/" + name,
+			Hashes: map[string]string{"sha256": digest(name)},
+		})
+	}
+	return files, nil
+}
+
+type storageAdapter struct {
+	storage storage.Storage
+}
+
+func (sa *storageAdapter) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) error {
+	_, err := sa.storage.Put(ctx, key, reader, size, contentType)
+	return err
+}
+
+func waitForJob(t *testing.T, w *Warmer, id string) jobs.Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := w.Status(id); ok && job.Finished() {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish", id)
+	return jobs.Job{}
+}
+
+func TestWarmer_Submit(t *testing.T) {
+	fileServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/files/six-") {
+			_, _ = io.WriteString(w, "tampered")
+			return
+		}
+		_, _ = fmt.Fprintf(w, "contents of %s", r.URL.Path)
+	}))
+	defer fileServer.Close()
+
+	store, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage failed: %v", err)
+	}
+	index := &fakeIndex{
+		Client:  pypi.NewClient(&config.Config{}),
+		baseURL: fileServer.URL,
+		packages: map[string][]string{
+			"numpy":    {"numpy-1.26.4.tar.gz", "numpy-1.26.4-cp312-cp312-linux_x86_64.whl", "numpy-1.26.3.tar.gz"},
+			"requests": {"requests-2.31.0.tar.gz", "requests-2.30.0.tar.gz"},
+			"six":      {"six-1.16.0.tar.gz"},
+		},
+	}
+	tempDir := t.TempDir()
+	w := New(Config{Workers: 2, TempDir: tempDir}, index, store, &storageAdapter{store})
+	defer w.Stop()
+
+	// Already cached files are skipped
+	if _, err := store.Put(context.Background(), "packages/requests/requests-2.31.0.tar.gz", strings.NewReader("cached"), 6, ""); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	job := w.Submit([]lockfile.Requirement{
+		{Name: "numpy", Version: "1.26.4", Hashes: []string{digest("numpy-1.26.4.tar.gz")}}, // Hash pins the sdist only
+		{Name: "requests", Version: "2.31.0"},
+		{Name: "six", Version: "1.16.0"}, // Served with the wrong content
+		{Name: "flask"},
+		{Name: "missing", Version: "1.0"},
+	})
+	finished := waitForJob(t, w, job.ID)
+
+	if finished.State != jobs.StateCompleted {
+		t.Errorf("Expected completed job, got %q", finished.State)
+	}
+	status, ok := finished.Progress.(Progress)
+	if !ok {
+		t.Fatalf("Expected warm progress, got %T", finished.Progress)
+	}
+	if status.FilesTotal != 3 || status.FilesDownloaded != 1 || status.FilesSkipped != 1 || status.FilesFailed != 1 {
+		t.Errorf("Unexpected file counts %+v", status)
+	}
+	if want := int64(len(fileContent("numpy-1.26.4.tar.gz")) + len("tampered")); status.BytesDownloaded != want {
+		t.Errorf("Expected %d bytes downloaded, got %d", want, status.BytesDownloaded)
+	}
+	if !strings.Contains(status.LastError, "sha256 mismatch") {
+		t.Errorf("Expected the digest mismatch reported, got %q", status.LastError)
+	}
+	if len(status.Unresolved) != 2 {
+		t.Errorf("Expected flask and missing unresolved, got %v", status.Unresolved)
+	}
+
+	if exists, _ := store.Exists(context.Background(), "packages/numpy/numpy-1.26.4.tar.gz"); !exists {
+		t.Error("Expected pinned sdist in storage")
+	}
+	if exists, _ := store.Exists(context.Background(), "packages/numpy/numpy-1.26.4-cp312-cp312-linux_x86_64.whl"); exists {
+		t.Error("Wheel not listed in the hashes should not be fetched")
+	}
+	if exists, _ := store.Exists(context.Background(), "packages/six/six-1.16.0.tar.gz"); exists {
+		t.Error("A file failing its digest check should not be stored")
+	}
+	if info, err := store.Stat(context.Background(), "packages/numpy/numpy-1.26.4.tar.gz"); err == nil && info.Metadata[storage.MetaSHA256] != digest("numpy-1.26.4.tar.gz") {
+		t.Errorf("Expected file metadata recorded, got %v", info.Metadata)
+	}
+	if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+		t.Errorf("Expected downloads cleaned up, got %v", entries)
+	}
+}
+
+func TestWarmer_StatusUnknownJob(t *testing.T) {
+	w := New(Config{}, &fakeIndex{}, nil, nil)
+	defer w.Stop()
+
+	if _, ok := w.Status("nope"); ok {
+		t.Error("Expected unknown job to be reported missing")
+	}
+}
@@ -0,0 +1,215 @@
+// Package webhook posts cache events to configured HTTP endpoints so ops
+// automation (Slack, incident tooling) can react without scraping logs
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/phuslu/log"
+
+	"github.com/huyhandes/groxpi/internal/version"
+)
+
+// Event types
+const (
+	EventFileCached        = "file.cached"        // A file was fetched upstream and stored
+	EventCacheEvicted      = "cache.evicted"      // The local cache evicted a file to stay under its size limit
+	EventCacheCapacity     = "cache.capacity"     // The local cache is projected to reach its size limit soon
+	EventUpstreamDown      = "upstream.down"      // Upstream requests started failing consecutively
+	EventUpstreamRecovered = "upstream.recovered" // Upstream answered again after being down
+)
+
+const (
+	// queueSize bounds events waiting for delivery; further events are dropped
+	queueSize = 1000
+
+	// maxAttempts bounds deliveries of one event to one endpoint
+	maxAttempts = 3
+
+	// SignatureHeader carries the HMAC-SHA256 of the body when a secret is set
+	SignatureHeader = "X-Groxpi-Signature"
+)
+
+// retryDelay is the wait before the first retry; it doubles per attempt
+var retryDelay = time.Second
+
+// Config configures webhook delivery
+type Config struct {
+	URLs    []string      // Endpoints every event is posted to
+	Secret  string        // Signs payloads with HMAC-SHA256 (empty = unsigned)
+	Events  []string      // Event types to send (empty = all)
+	Timeout time.Duration // Per-delivery timeout
+}
+
+// Event is the JSON payload posted to endpoints
+type Event struct {
+	ID   string      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Notifier delivers events in the background, in order, retrying failed
+// deliveries with backoff
+type Notifier struct {
+	cfg    Config
+	events map[string]bool // nil = all
+	client *http.Client
+
+	queue   chan Event
+	dropped atomic.Int64
+	wg      sync.WaitGroup
+	once    sync.Once
+}
+
+// New creates a notifier. It returns nil when no URLs are configured; a nil
+// notifier ignores every event.
+func New(cfg Config) *Notifier {
+	if len(cfg.URLs) == 0 {
+		return nil
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	n := &Notifier{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan Event, queueSize),
+	}
+	if len(cfg.Events) > 0 {
+		n.events = make(map[string]bool, len(cfg.Events))
+		for _, event := range cfg.Events {
+			n.events[event] = true
+		}
+	}
+
+	n.wg.Add(1)
+	go n.run()
+
+	log.Info().Strs("urls", cfg.URLs).Strs("events", cfg.Events).Msg("Webhooks enabled")
+	return n
+}
+
+// Notify queues an event without blocking. Events are dropped while the
+// queue is full, e.g. when an endpoint is down during an eviction storm.
+func (n *Notifier) Notify(eventType string, data interface{}) {
+	if n == nil || (n.events != nil && !n.events[eventType]) {
+		return
+	}
+
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	event := Event{
+		ID:   hex.EncodeToString(b[:]),
+		Type: eventType,
+		Time: time.Now().UTC(),
+		Data: data,
+	}
+
+	select {
+	case n.queue <- event:
+	default:
+		if n.dropped.Add(1)%100 == 1 {
+			log.Warn().Str("event", eventType).Int64("dropped", n.dropped.Load()).Msg("Webhook queue full, dropping events")
+		}
+	}
+}
+
+// Dropped returns how many events were dropped because the queue was full
+func (n *Notifier) Dropped() int64 {
+	if n == nil {
+		return 0
+	}
+	return n.dropped.Load()
+}
+
+// Close delivers the queued events and stops the notifier
+func (n *Notifier) Close() {
+	if n == nil {
+		return
+	}
+	n.once.Do(func() { close(n.queue) })
+	n.wg.Wait()
+}
+
+func (n *Notifier) run() {
+	defer n.wg.Done()
+
+	for event := range n.queue {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Error().Err(err).Str("event", event.Type).Msg("Failed to encode webhook event")
+			continue
+		}
+		for _, url := range n.cfg.URLs {
+			n.deliver(url, event, body)
+		}
+	}
+}
+
+// deliver posts body to url, retrying transport errors and non-2xx answers
+func (n *Notifier) deliver(url string, event Event, body []byte) {
+	delay := retryDelay
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err = n.post(url, event, body); err == nil {
+			return
+		}
+		if attempt < maxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+
+	log.Warn().
+		Err(err).
+		Str("url", url).
+		Str("event", event.Type).
+		Str("delivery", event.ID).
+		Msg("Webhook delivery failed")
+}
+
+func (n *Notifier) post(url string, event Event, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "groxpi-webhook/"+version.Get())
+	req.Header.Set("X-Groxpi-Event", event.Type)
+	req.Header.Set("X-Groxpi-Delivery", event.ID)
+	if n.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(n.cfg.Secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the signature header value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of body keyed with secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
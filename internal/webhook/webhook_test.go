@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNew_Disabled(t *testing.T) {
+	n := New(Config{})
+	if n != nil {
+		t.Fatal("Expected nil notifier without URLs")
+	}
+
+	// A nil notifier ignores events
+	n.Notify(EventFileCached, nil)
+	n.Close()
+}
+
+func TestNotifier_Deliver(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []Event
+	)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get(SignatureHeader); got != Sign("s3cret", body) {
+			t.Errorf("Unexpected signature %q", got)
+		}
+
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("Invalid payload: %v", err)
+		}
+		if r.Header.Get("X-Groxpi-Event") != event.Type || r.Header.Get("X-Groxpi-Delivery") != event.ID {
+			t.Errorf("Headers do not match event %+v", event)
+		}
+
+		mu.Lock()
+		received = append(received, event)
+		mu.Unlock()
+	}))
+	defer endpoint.Close()
+
+	n := New(Config{
+		URLs:   []string{endpoint.URL},
+		Secret: "s3cret",
+		Events: []string{EventFileCached, EventUpstreamDown},
+	})
+	n.Notify(EventFileCached, map[string]string{"key": "packages/numpy/numpy-1.26.4.tar.gz"})
+	n.Notify(EventCacheEvicted, nil) // Filtered out
+	n.Notify(EventUpstreamDown, nil)
+	n.Close()
+
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 deliveries, got %+v", received)
+	}
+	if received[0].Type != EventFileCached || received[1].Type != EventUpstreamDown {
+		t.Errorf("Expected events in order, got %+v", received)
+	}
+	if data, _ := received[0].Data.(map[string]interface{}); data["key"] != "packages/numpy/numpy-1.26.4.tar.gz" {
+		t.Errorf("Unexpected event data %v", received[0].Data)
+	}
+}
+
+func TestNotifier_Retry(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+
+	var attempts atomic.Int32
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < maxAttempts {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer endpoint.Close()
+
+	n := New(Config{URLs: []string{endpoint.URL}})
+	n.Notify(EventUpstreamRecovered, nil)
+	n.Close()
+
+	if got := attempts.Load(); got != maxAttempts {
+		t.Errorf("Expected %d attempts, got %d", maxAttempts, got)
+	}
+}
+
+func TestSign(t *testing.T) {
+	// Known HMAC-SHA256 test vector (RFC 4231 test case 2)
+	got := Sign("Jefe", []byte("what do ya want for nothing?"))
+	want := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}